@@ -6,7 +6,10 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -30,7 +33,7 @@ import (
 // Requires the `httplistener` plugin for the API listener.
 //
 // Usage examples:
-// Start a job with the provided job description from a JSON file
+// Start a job with the provided job description from a JSON or YAML file
 //   ./contestcli-http start < start.json
 //
 // Get the status of a job whose ID is 10
@@ -45,24 +48,101 @@ var (
 	flagAddr      = flag.StringP("addr", "a", "http://localhost:8080", "ConTest server [scheme://]host:port[/basepath] to connect to")
 	flagRequestor = flag.StringP("requestor", "r", defaultRequestor, "Identifier of the requestor of the API call")
 	flagWait      = flag.BoolP("wait", "w", false, "After starting a job, wait for it to finish, and exit 0 only if it is successful")
-	flagYAML      = flag.BoolP("yaml", "Y", false, "Parse job descriptor as YAML instead of JSON")
+	flagYAML      = flag.BoolP("yaml", "Y", false, "Parse job descriptors as YAML, instead of detecting whether they are JSON or YAML")
+	flagLimit     = flag.UintP("limit", "l", 0, "Maximum number of items returned by list, reports, events and search, or of jobs aggregated by history, if not zero. The server caps it")
+	flagToken     = flag.StringP("token", "t", os.Getenv("CONTEST_TOKEN"), "Bearer token authenticating the client, if the server requires it. Defaults to the CONTEST_TOKEN environment variable")
+	flagCACert    = flag.String("cacert", "", "PEM file of the CAs of the server certificate, if not signed by a system CA")
+	flagCert      = flag.String("cert", "", "Client certificate, for servers requiring mutual TLS")
+	flagKey       = flag.String("key", "", "Key of the client certificate")
+	flagOffset    = flag.UintP("offset", "o", 0, "Number of items skipped by list, reports, events and search, to fetch the next pages")
+	flagAtomic    = flag.Bool("atomic", false, "With batch, start no job unless all the job descriptors are valid")
+	flagFailed    = flag.Bool("failedTargetsOnly", false, "With rerun, only test the targets which did not pass the job")
 )
 
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage of contestcli-http:\n\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "  contestcli-http [args] command\n\n")
-		fmt.Fprintf(flag.CommandLine.Output(), "command: start, stop, status, retry, version\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "command: start, validate, batch, stop, pause, resume, approve, reject, status, retry,\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "         rerun, follow, list, reports, history, events, search, schedule, schedules,\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "         pauseSchedule, resumeSchedule, deleteSchedule, saveTemplate, templates, deleteTemplate,\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "         startTemplate, plugins, quotas, setQuota, logLevels, setLogLevel, auditLog, unlockTargets,\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "         drain, version\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "  start\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "        start a new job using the job description passed via stdin\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "        when used with -wait flag, stdout will have two JSON outputs\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "        for job start and completion status separated with newline\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  validate\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        validate the job description passed via stdin, without starting a job\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  batch file...\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        start a job for each job description file, see -atomic\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "  stop int\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "        stop a job by job ID\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  pause int, resume int\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        pause a running job by job ID, or resume a paused one\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  approve int [reason], reject int [reason]\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        approve or reject a job awaiting approval by job ID\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "  status int\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "        get the status of a job by job ID\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "  retry int\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "        retry a job by job ID\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  rerun int\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        start an ended job again by job ID, as a new job, see -failedTargetsOnly\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  follow int\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        print the state transitions of a job by job ID until it completes\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  list [key=value...]\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        list the job IDs, most recent first, see -limit and -offset\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        optionally filtered, e.g. list jobRequestor=alice state=JobStateFailed tag=nightly\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        keys: jobRequestor, state, tag, requestedAfter, requestedBefore, name, scheduleID, retryOf,\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        rerunOf\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  reports [key=value...]\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        get the reports of the jobs selected like with list, e.g. reports tag=release-1.2\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  history key=value...\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        get the pass rate and durations of the most recent jobs sharing a name or a template,\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        and of their tests and steps, e.g. history template=flash\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        keys: jobName, template, tag, requestedAfter, requestedBefore\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  events int\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        get the test events of a job by job ID, see -limit and -offset\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  search key=value...\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        search test events, e.g. search jobID=10 targetID=host1 payloadContains=panic\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        keys: jobID, runID, testName, testStepLabel, eventName, targetID,\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        emittedStartTime, emittedEndTime, payloadContains, payloadPath, payloadValue\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  schedule cron [name]\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        start the job description passed via stdin every time the cron expression\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        activates, e.g. schedule '0 2 * * *' nightly\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  schedules\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        list the schedules\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  pauseSchedule int, resumeSchedule int, deleteSchedule int\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        pause, resume or delete a schedule by schedule ID\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  saveTemplate\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        store the job template passed via stdin, with Name, Description, Variables\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        and JobDescriptor, whose strings may reference the variables as ${name}\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  templates\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        list the job templates\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  deleteTemplate name\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        delete a job template by name\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  startTemplate name [variable=value...]\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        start a job from a job template, e.g. startTemplate flash platform=arm64\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  plugins\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        list the plugins registered in the server\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  quotas\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        get the quotas of the requestors, and the targets and runtime their jobs use\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  setQuota key=value...\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        set the quota of a requestor, or the default one, e.g. setQuota quotaRequestor=ci maxTargets=20\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        keys: quotaRequestor, maxTargets, maxRuntimePerDay, reset\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  logLevels\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        get the default log level of the server, and the levels of its modules\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  setLogLevel key=value...\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        set the log level of a module, or the default one, e.g. setLogLevel module=pkg/runner level=debug\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        keys: module, level. An unset level makes the module log at the default level again\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  auditLog [key=value...]\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        get the records of the calls which changed jobs or the server, see -limit and -offset\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        optionally filtered, e.g. auditLog auditRequestor=alice action=stop\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        keys: auditRequestor, action, jobID, startTime, endTime\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  unlockTargets targetID...\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        release the locks held on the targets by jobs which the server does not run\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  drain [duration]\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "        stop starting jobs, and exit once the running jobs ended, or pause them after duration, e.g. 30m\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "  version\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "        request the API version to the server\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "\nargs:\n")
@@ -80,24 +160,42 @@ func main() {
 	}
 }
 
+// addKeyValues adds the key=value arguments of the list, reports, history,
+// search, setQuota, setLogLevel and auditLog verbs to the request parameters.
+func addKeyValues(params url.Values, args []string) error {
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid parameter '%s', expected key=value", arg)
+		}
+		params.Add(kv[0], kv[1])
+	}
+	return nil
+}
+
+// jobDescFormat returns the format of the job descriptors, which is detected
+// unless -yaml is set.
+func jobDescFormat() config.JobDescFormat {
+	if *flagYAML {
+		return config.JobDescFormatYAML
+	}
+	return config.JobDescFormatAuto
+}
+
 func run(verb string) error {
 	var (
 		params = url.Values{}
 	)
 	params.Set("requestor", *flagRequestor)
 	switch verb {
-	case "start":
+	case "start", "validate":
 		fmt.Fprintf(os.Stderr, "Reading from stdin...\n")
 		jobDesc, err := ioutil.ReadAll(os.Stdin)
 		if err != nil {
 			return fmt.Errorf("failed to read job descriptor: %v", err)
 		}
 
-		jobDescFormat := config.JobDescFormatJSON
-		if *flagYAML {
-			jobDescFormat = config.JobDescFormatYAML
-		}
-		jobDescJSON, err := config.ParseJobDescriptor(jobDesc, jobDescFormat)
+		jobDescJSON, err := config.ParseJobDescriptor(jobDesc, jobDescFormat())
 		if err != nil {
 			return fmt.Errorf("failed to parse job descriptor: %w", err)
 		}
@@ -108,7 +206,7 @@ func run(verb string) error {
 		}
 		fmt.Println(resp)
 
-		if *flagWait {
+		if *flagWait && verb == "start" {
 			fmt.Fprintf(os.Stderr, "\nWaiting for job to complete...\n")
 			parsedData := &api.ResponseDataStart{}
 			parsedResp := &httplistener.HTTPAPIResponse{Data: parsedData}
@@ -124,12 +222,219 @@ func run(verb string) error {
 			}
 			fmt.Println(resp)
 		}
-	case "stop", "status", "retry":
+	case "batch":
+		if flag.NArg() < 2 {
+			return errors.New("missing job description files")
+		}
+		for _, path := range flag.Args()[1:] {
+			jobDesc, err := ioutil.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read job descriptor: %v", err)
+			}
+			jobDescJSON, err := config.ParseJobDescriptor(jobDesc, jobDescFormat())
+			if err != nil {
+				return fmt.Errorf("failed to parse job descriptor %s: %w", path, err)
+			}
+			params.Add("jobDesc", string(jobDescJSON))
+		}
+		params.Set("atomic", strconv.FormatBool(*flagAtomic))
+		resp, err := request(verb, params)
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp)
+	case "stop", "pause", "resume", "status", "retry":
+		jobID := flag.Arg(1)
+		if jobID == "" {
+			return errors.New("missing job ID")
+		}
+		params.Set("jobID", jobID)
+		resp, err := request(verb, params)
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp)
+	case "approve", "reject":
+		jobID := flag.Arg(1)
+		if jobID == "" {
+			return errors.New("missing job ID")
+		}
+		params.Set("jobID", jobID)
+		params.Set("reason", strings.Join(flag.Args()[2:], " "))
+		resp, err := request(verb, params)
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp)
+	case "rerun":
 		jobID := flag.Arg(1)
 		if jobID == "" {
 			return errors.New("missing job ID")
 		}
 		params.Set("jobID", jobID)
+		params.Set("failedTargetsOnly", strconv.FormatBool(*flagFailed))
+		resp, err := request(verb, params)
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp)
+	case "follow":
+		jobID := flag.Arg(1)
+		if jobID == "" {
+			return errors.New("missing job ID")
+		}
+		params.Set("jobID", jobID)
+		return follow(params)
+	case "list", "reports", "events":
+		if verb == "events" {
+			jobID := flag.Arg(1)
+			if jobID == "" {
+				return errors.New("missing job ID")
+			}
+			params.Set("jobID", jobID)
+		} else if err := addKeyValues(params, flag.Args()[1:]); err != nil {
+			return err
+		}
+		if *flagLimit > 0 {
+			params.Set("limit", strconv.FormatUint(uint64(*flagLimit), 10))
+		}
+		if *flagOffset > 0 {
+			params.Set("offset", strconv.FormatUint(uint64(*flagOffset), 10))
+		}
+		resp, err := request(verb, params)
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp)
+	case "history":
+		if err := addKeyValues(params, flag.Args()[1:]); err != nil {
+			return err
+		}
+		if *flagLimit > 0 {
+			params.Set("limit", strconv.FormatUint(uint64(*flagLimit), 10))
+		}
+		resp, err := request(verb, params)
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp)
+	case "search", "auditLog":
+		if err := addKeyValues(params, flag.Args()[1:]); err != nil {
+			return err
+		}
+		if *flagLimit > 0 {
+			params.Set("limit", strconv.FormatUint(uint64(*flagLimit), 10))
+		}
+		if *flagOffset > 0 {
+			params.Set("offset", strconv.FormatUint(uint64(*flagOffset), 10))
+		}
+		resp, err := request(verb, params)
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp)
+	case "unlockTargets":
+		if flag.NArg() < 2 {
+			return errors.New("missing target IDs")
+		}
+		for _, id := range flag.Args()[1:] {
+			params.Add("target", id)
+		}
+		resp, err := request(verb, params)
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp)
+	case "drain":
+		if deadline := flag.Arg(1); deadline != "" {
+			if _, err := time.ParseDuration(deadline); err != nil {
+				return fmt.Errorf("invalid duration '%s': %v", deadline, err)
+			}
+			params.Set("deadline", deadline)
+		}
+		resp, err := request(verb, params)
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp)
+	case "schedule":
+		cron := flag.Arg(1)
+		if cron == "" {
+			return errors.New("missing cron expression")
+		}
+		fmt.Fprintf(os.Stderr, "Reading from stdin...\n")
+		jobDesc, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read job descriptor: %v", err)
+		}
+		jobDescJSON, err := config.ParseJobDescriptor(jobDesc, jobDescFormat())
+		if err != nil {
+			return fmt.Errorf("failed to parse job descriptor: %w", err)
+		}
+		params.Set("jobDesc", string(jobDescJSON))
+		params.Set("cron", cron)
+		params.Set("name", flag.Arg(2))
+		resp, err := request(verb, params)
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp)
+	case "pauseSchedule", "resumeSchedule", "deleteSchedule":
+		scheduleID := flag.Arg(1)
+		if scheduleID == "" {
+			return errors.New("missing schedule ID")
+		}
+		params.Set("scheduleID", scheduleID)
+		resp, err := request(verb, params)
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp)
+	case "saveTemplate":
+		fmt.Fprintf(os.Stderr, "Reading from stdin...\n")
+		template, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read template: %v", err)
+		}
+		templateJSON, err := config.ParseJobDescriptor(template, jobDescFormat())
+		if err != nil {
+			return fmt.Errorf("failed to parse template: %w", err)
+		}
+		params.Set("template", string(templateJSON))
+		resp, err := request(verb, params)
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp)
+	case "deleteTemplate", "startTemplate":
+		name := flag.Arg(1)
+		if name == "" {
+			return errors.New("missing template name")
+		}
+		params.Set("name", name)
+		if verb == "startTemplate" {
+			for _, pair := range flag.Args()[2:] {
+				if !strings.Contains(pair, "=") {
+					return fmt.Errorf("invalid variable '%s', expected name=value", pair)
+				}
+				params.Add("var", pair)
+			}
+		}
+		resp, err := request(verb, params)
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp)
+	case "setQuota", "setLogLevel":
+		if err := addKeyValues(params, flag.Args()[1:]); err != nil {
+			return err
+		}
+		resp, err := request(verb, params)
+		if err != nil {
+			return err
+		}
+		fmt.Println(resp)
+	case "schedules", "templates", "plugins", "quotas", "logLevels":
 		resp, err := request(verb, params)
 		if err != nil {
 			return err
@@ -143,25 +448,76 @@ func run(verb string) error {
 	return nil
 }
 
-func request(verb string, params url.Values) (string, error) {
+func verbURL(verb string) (*url.URL, error) {
 	u, err := url.Parse(*flagAddr)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse server address '%s': %v", *flagAddr, err)
+		return nil, fmt.Errorf("failed to parse server address '%s': %v", *flagAddr, err)
 	}
 	if u.Scheme == "" {
-		return "", errors.New("server URL scheme not specified")
+		return nil, errors.New("server URL scheme not specified")
 	}
 	if u.Scheme != "http" && u.Scheme != "https" {
-		return "", fmt.Errorf("unsupported URL scheme '%s', please specify either http or https", u.Scheme)
+		return nil, fmt.Errorf("unsupported URL scheme '%s', please specify either http or https", u.Scheme)
 	}
 	u.Path += "/" + verb
+	return u, nil
+}
+
+// httpClient returns a client configured with the TLS flags.
+func httpClient() (*http.Client, error) {
+	if *flagCACert == "" && *flagCert == "" {
+		return http.DefaultClient, nil
+	}
+	config := &tls.Config{}
+	if *flagCACert != "" {
+		pem, err := ioutil.ReadFile(*flagCACert)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA file: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA file %s", *flagCACert)
+		}
+	}
+	if *flagCert != "" {
+		cert, err := tls.LoadX509KeyPair(*flagCert, *flagKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config}}, nil
+}
+
+// setToken authenticates the request with the bearer token, if any.
+func setToken(req *http.Request) {
+	if *flagToken != "" {
+		req.Header.Set("Authorization", "Bearer "+*flagToken)
+	}
+}
+
+func request(verb string, params url.Values) (string, error) {
+	u, err := verbURL(verb)
+	if err != nil {
+		return "", err
+	}
 	fmt.Fprintf(os.Stderr, "Requesting URL %s with requestor ID '%s'\n", u.String(), *flagRequestor)
 	fmt.Fprintf(os.Stderr, "  with params:\n")
 	for k, v := range params {
 		fmt.Fprintf(os.Stderr, "    %s: %s\n", k, v)
 	}
 	fmt.Fprintf(os.Stderr, "\n")
-	resp, err := http.PostForm(u.String(), params)
+	req, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(params.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	setToken(req)
+	client, err := httpClient()
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return "", fmt.Errorf("HTTP POST failed: %v", err)
 	}
@@ -171,6 +527,9 @@ func request(verb string, params url.Values) (string, error) {
 		return "", fmt.Errorf("Cannot read HTTP response: %v", err)
 	}
 	fmt.Fprintf(os.Stderr, "The server responded with status %s", resp.Status)
+	if requestID := resp.Header.Get(api.RequestIDHeader); requestID != "" {
+		fmt.Fprintf(os.Stderr, " to request %s", requestID)
+	}
 	var indentedJSON []byte
 	if resp.StatusCode == http.StatusOK {
 		// the Data field of apiResp will result in a map[string]interface{}
@@ -241,3 +600,41 @@ func wait(params url.Values, jobWaitPoll time.Duration) (string, error) {
 		time.Sleep(jobWaitPoll)
 	}
 }
+
+// follow prints the state transitions of a job, one JSON object per line, as
+// they are pushed by the server, until the job completes.
+func follow(params url.Values) error {
+	u, err := verbURL("status/stream")
+	if err != nil {
+		return err
+	}
+	u.RawQuery = params.Encode()
+	fmt.Fprintf(os.Stderr, "Following job %s at %s\n\n", params.Get("jobID"), u.String())
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	setToken(req)
+	client, err := httpClient()
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("the server responded with status %s: %s", resp.Status, body)
+	}
+	// only the data of the events is printed, comments and event names are
+	// skipped
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if data := strings.TrimPrefix(scanner.Text(), "data: "); data != scanner.Text() {
+			fmt.Println(data)
+		}
+	}
+	return scanner.Err()
+}
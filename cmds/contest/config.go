@@ -0,0 +1,290 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/config"
+	"github.com/facebookincubator/contest/pkg/jobmanager"
+	"github.com/facebookincubator/contest/pkg/logging"
+	jobwebhook "github.com/facebookincubator/contest/pkg/webhook"
+	"github.com/facebookincubator/contest/plugins/spanexporters/otlp"
+	"github.com/sirupsen/logrus"
+)
+
+// target lockers selected by -targetLocker
+const (
+	targetLockerAuto     = "auto"
+	targetLockerInMemory = "inmemory"
+	targetLockerDB       = "dblocker"
+)
+
+// configSections are the sections of the server configuration file, and the
+// flags which they set. Every flag but -config belongs to one section.
+var configSections = config.ServerConfigSections{
+	"server": {"serverID", "metricsAddr"},
+	"listeners": {
+		"httpAddr", "httpCertFile", "httpKeyFile", "httpClientCAFile",
+		"grpcAddr", "grpcCertFile", "grpcKeyFile",
+	},
+	"storage": {
+		"dbURI", "dbReadURI", "dbAutoMigrate", "dbSlowQueryThreshold",
+		"eventCompression", "eventCompressionThreshold",
+	},
+	"locker":  {"targetLocker"},
+	"cluster": {"clusterHeartbeatInterval", "clusterFailoverTimeout"},
+	"auth":    {"authOIDCIssuer", "authOIDCAudience", "authRequestorClaim", "authzPolicyFile"},
+	"limits": {
+		"rateLimit", "rateLimitBurst",
+		"maxRunningJobsPerRequestor", "maxConcurrentJobs", "maxConcurrentJobsPerRequestor", "requestorMaxConcurrentJobs",
+		"maxTargetsPerRequestor", "requestorMaxTargets", "maxRuntimePerRequestorPerDay", "requestorMaxRuntimePerDay",
+		"maxQueuedJobs",
+	},
+	"jobs": {
+		"interruptedJobs", "approvalPolicyFile", "preemptJobs", "descriptorLibrary",
+		"webhookSecretFile", "webhookURLs",
+	},
+	"retention": {"retentionDays", "retentionInterval", "retentionPruneJobs", "retentionDryRun", "retentionArchive"},
+	"plugins": {
+		"artifactStore", "artifactS3Region", "artifactS3Endpoint",
+		"eventKafkaRESTProxy", "eventKafkaTopic", "eventKafkaSerialization",
+		"emailSMTPServer", "emailFrom", "emailSMTPUsername", "emailSMTPPasswordFile", "emailJobURL",
+		"gitCredentialsDir",
+		"externalPlugins",
+	},
+	"logging": {"logLevel", "logFormat", "logModuleLevels"},
+	"tracing": {"otlpEndpoint", "otlpServiceName"},
+	"health":  {"healthCheckInterval", "healthCheckURLs"},
+	"timeouts": {
+		"targetManagerTimeout", "stepInjectTimeout", "testRunnerMsgTimeout",
+		"testRunnerShutdownTimeout", "testRunnerStepShutdownTimeout", "testRunnerCleanupTimeout",
+		"lockRefreshTimeout",
+	},
+}
+
+// isMySQL returns whether a database URI selects the MySQL storage.
+func isMySQL(dbURI string) bool {
+	for _, prefix := range []string{"postgres://", "postgresql://", "sqlite://"} {
+		if strings.HasPrefix(dbURI, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// targetLocker returns the target locker selected by -targetLocker.
+func targetLocker() string {
+	if *flagTargetLocker == targetLockerAuto {
+		if *flagClusterHeartbeatInterval > 0 {
+			return targetLockerDB
+		}
+		return targetLockerInMemory
+	}
+	return *flagTargetLocker
+}
+
+// checkFlags returns an error if the flags, as set on the command line and
+// by the configuration file, are invalid or inconsistent. It does not connect
+// to any service.
+func checkFlags() error {
+	if _, err := parseRequestorLimits(*flagRequestorMaxConcurrentJobs); err != nil {
+		return fmt.Errorf("invalid -requestorMaxConcurrentJobs: %v", err)
+	}
+	// the jobs beyond the concurrency cap of a requestor are queued, and
+	// rejected only beyond its cap of unfinished jobs
+	if *flagMaxRunningJobsPerRequestor > 0 && *flagMaxConcurrentJobsPerRequestor >= *flagMaxRunningJobsPerRequestor {
+		return errors.New("-maxRunningJobsPerRequestor must be larger than -maxConcurrentJobsPerRequestor, or no job of a requestor would ever be queued")
+	}
+	if *flagMaxTargetsPerRequestor < 0 || *flagMaxRuntimePerRequestorPerDay < 0 {
+		return errors.New("-maxTargetsPerRequestor and -maxRuntimePerRequestorPerDay cannot be negative")
+	}
+	if _, _, err := requestorQuotas(); err != nil {
+		return err
+	}
+	if _, err := jobmanager.ParseInterruptedJobPolicy(*flagInterruptedJobs); err != nil {
+		return fmt.Errorf("invalid -interruptedJobs: %v", err)
+	}
+	switch *flagTargetLocker {
+	case targetLockerAuto, targetLockerInMemory, targetLockerDB:
+	default:
+		return fmt.Errorf("invalid -targetLocker %s, expected %s, %s or %s", *flagTargetLocker, targetLockerAuto, targetLockerInMemory, targetLockerDB)
+	}
+	if targetLocker() == targetLockerDB && !isMySQL(*flagDBURI) {
+		return errors.New("the dblocker target locker requires the MySQL storage, whose database holds the target locks")
+	}
+	if *flagClusterHeartbeatInterval > 0 {
+		if targetLocker() != targetLockerDB {
+			return errors.New("-clusterHeartbeatInterval requires the dblocker target locker, which the servers share")
+		}
+		if *flagClusterFailoverTimeout <= *flagClusterHeartbeatInterval {
+			return errors.New("-clusterFailoverTimeout must be longer than -clusterHeartbeatInterval")
+		}
+	}
+	if *flagWebhookURLs != "" && *flagWebhookSecretFile == "" {
+		return errors.New("-webhookURLs requires -webhookSecretFile")
+	}
+	for _, u := range strings.Split(*flagWebhookURLs, ",") {
+		if u = strings.TrimSpace(u); u == "" {
+			continue
+		}
+		if err := jobwebhook.CheckURL(u); err != nil {
+			return fmt.Errorf("invalid -webhookURLs: %v", err)
+		}
+	}
+	if (*flagHTTPCertFile == "") != (*flagHTTPKeyFile == "") {
+		return errors.New("-httpCertFile and -httpKeyFile must be set together")
+	}
+	if (*flagGRPCCertFile == "") != (*flagGRPCKeyFile == "") {
+		return errors.New("-grpcCertFile and -grpcKeyFile must be set together")
+	}
+	if *flagGRPCAddr != "" && *flagGRPCCertFile == "" {
+		return errors.New("-grpcAddr requires -grpcCertFile and -grpcKeyFile, as the gRPC API is only served over TLS")
+	}
+	if _, err := logrus.ParseLevel(*flagLogLevel); err != nil {
+		return fmt.Errorf("invalid -logLevel: %v", err)
+	}
+	if *flagLogFormat != logging.FormatText && *flagLogFormat != logging.FormatJSON {
+		return fmt.Errorf("invalid -logFormat %s, expected %s or %s", *flagLogFormat, logging.FormatText, logging.FormatJSON)
+	}
+	if _, err := parseLogModuleLevels(*flagLogModuleLevels); err != nil {
+		return fmt.Errorf("invalid -logModuleLevels: %v", err)
+	}
+	if *flagOTLPEndpoint != "" {
+		if _, err := otlp.New(otlp.Config{Endpoint: *flagOTLPEndpoint}); err != nil {
+			return err
+		}
+	}
+	if *flagHealthCheckInterval < 0 {
+		return errors.New("-healthCheckInterval cannot be negative")
+	}
+	if *flagHealthCheckURLs != "" && *flagHealthCheckInterval == 0 {
+		return errors.New("-healthCheckURLs requires -healthCheckInterval")
+	}
+	if _, err := parseHealthCheckURLs(*flagHealthCheckURLs); err != nil {
+		return fmt.Errorf("invalid -healthCheckURLs: %v", err)
+	}
+	if *flagDescriptorLibrary != "" {
+		if fi, err := os.Stat(*flagDescriptorLibrary); err != nil || !fi.IsDir() {
+			return fmt.Errorf("invalid -descriptorLibrary %s: not a directory", *flagDescriptorLibrary)
+		}
+	}
+	for _, path := range externalPlugins() {
+		if fi, err := os.Stat(path); err != nil || !fi.Mode().IsRegular() {
+			return fmt.Errorf("invalid -externalPlugins: %s is not a file", path)
+		}
+	}
+	for name, timeout := range map[string]time.Duration{
+		"targetManagerTimeout":          *flagTargetManagerTimeout,
+		"stepInjectTimeout":             *flagStepInjectTimeout,
+		"testRunnerMsgTimeout":          *flagTestRunnerMsgTimeout,
+		"testRunnerShutdownTimeout":     *flagTestRunnerShutdownTimeout,
+		"testRunnerStepShutdownTimeout": *flagTestRunnerStepShutdownTimeout,
+		"testRunnerCleanupTimeout":      *flagTestRunnerCleanupTimeout,
+		"lockRefreshTimeout":            *flagLockRefreshTimeout,
+	} {
+		if timeout <= 0 {
+			return fmt.Errorf("-%s must be positive", name)
+		}
+	}
+	return nil
+}
+
+// externalPlugins returns the paths of the plugin binaries of
+// -externalPlugins.
+func externalPlugins() []string {
+	var paths []string
+	for _, path := range strings.Split(*flagExternalPlugins, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// parseHealthCheckURLs parses the name=URL pairs of -healthCheckURLs into
+// the dependencies checked by the health checks, in the order of the pairs.
+func parseHealthCheckURLs(s string) ([]jobmanager.Dependency, error) {
+	var deps []jobmanager.Dependency
+	names := make(map[string]bool)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid pair '%s', expected name=URL", pair)
+		}
+		name, rawURL := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if name == "storage" || name == "locker" || names[name] {
+			return nil, fmt.Errorf("duplicate dependency '%s'", name)
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid URL '%s' of %s, expected an http or https URL", rawURL, name)
+		}
+		names[name] = true
+		deps = append(deps, jobmanager.HTTPDependency(name, rawURL))
+	}
+	return deps, nil
+}
+
+// parseLogModuleLevels parses the module=level pairs of -logModuleLevels.
+// Modules must be known, i.e. have a logger.
+func parseLogModuleLevels(s string) (map[string]string, error) {
+	known := make(map[string]bool)
+	_, modules := logging.Levels()
+	for _, m := range modules {
+		known[m.Module] = true
+	}
+	levels := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid pair '%s', expected module=level", pair)
+		}
+		module, level := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		if !known[module] {
+			return nil, fmt.Errorf("unknown module '%s'", module)
+		}
+		if _, err := logrus.ParseLevel(level); err != nil {
+			return nil, fmt.Errorf("invalid level in '%s': %v", pair, err)
+		}
+		levels[module] = level
+	}
+	return levels, nil
+}
+
+// setLogging sets the format and the levels of the logs. The flags must have
+// been checked.
+func setLogging() {
+	_ = logging.SetFormat(*flagLogFormat)
+	_ = logging.SetLevel(*flagLogLevel)
+	levels, _ := parseLogModuleLevels(*flagLogModuleLevels)
+	for module, level := range levels {
+		_ = logging.SetModuleLevel(module, level)
+	}
+}
+
+// setTimeouts sets the timeouts of the framework from the flags.
+func setTimeouts() {
+	config.TargetManagerTimeout = *flagTargetManagerTimeout
+	config.StepInjectTimeout = *flagStepInjectTimeout
+	config.TestRunnerMsgTimeout = *flagTestRunnerMsgTimeout
+	config.TestRunnerShutdownTimeout = *flagTestRunnerShutdownTimeout
+	config.TestRunnerStepShutdownTimeout = *flagTestRunnerStepShutdownTimeout
+	config.TestRunnerCleanupTimeout = *flagTestRunnerCleanupTimeout
+	config.LockRefreshTimeout = *flagLockRefreshTimeout
+	config.LockInitialTimeout = config.TargetManagerTimeout + config.LockRefreshTimeout
+}
@@ -8,43 +8,165 @@ package main
 import (
 	"errors"
 	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/artifact"
 	"github.com/facebookincubator/contest/pkg/config"
 	"github.com/facebookincubator/contest/pkg/job"
 	"github.com/facebookincubator/contest/pkg/jobmanager"
 	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/metrics"
+	"github.com/facebookincubator/contest/pkg/pluginbridge"
 	"github.com/facebookincubator/contest/pkg/pluginregistry"
 	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/storage/retention"
 	"github.com/facebookincubator/contest/pkg/target"
 	"github.com/facebookincubator/contest/pkg/test"
+	"github.com/facebookincubator/contest/pkg/tracing"
+	jobwebhook "github.com/facebookincubator/contest/pkg/webhook"
+	"github.com/facebookincubator/contest/plugins/artifactstores/localdir"
+	artifacts3 "github.com/facebookincubator/contest/plugins/artifactstores/s3"
+	"github.com/facebookincubator/contest/plugins/eventforwarders/kafka"
+	"github.com/facebookincubator/contest/plugins/listeners/grpclistener"
 	"github.com/facebookincubator/contest/plugins/listeners/httplistener"
+	"github.com/facebookincubator/contest/plugins/reporters/clickhouse"
+	"github.com/facebookincubator/contest/plugins/reporters/composite"
+	"github.com/facebookincubator/contest/plugins/reporters/email"
+	"github.com/facebookincubator/contest/plugins/reporters/html"
+	"github.com/facebookincubator/contest/plugins/reporters/junit"
 	"github.com/facebookincubator/contest/plugins/reporters/noop"
+	"github.com/facebookincubator/contest/plugins/reporters/pushgateway"
+	"github.com/facebookincubator/contest/plugins/reporters/tap"
 	"github.com/facebookincubator/contest/plugins/reporters/targetsuccess"
+	"github.com/facebookincubator/contest/plugins/reporters/webhook"
+	"github.com/facebookincubator/contest/plugins/spanexporters/otlp"
+	"github.com/facebookincubator/contest/plugins/storage/postgres"
 	"github.com/facebookincubator/contest/plugins/storage/rdbms"
+	"github.com/facebookincubator/contest/plugins/storage/sqlite"
+	"github.com/facebookincubator/contest/plugins/targetlocker/dblocker"
 	"github.com/facebookincubator/contest/plugins/targetlocker/inmemory"
 	"github.com/facebookincubator/contest/plugins/targetmanagers/csvtargetmanager"
 	"github.com/facebookincubator/contest/plugins/targetmanagers/targetlist"
+	"github.com/facebookincubator/contest/plugins/testfetchers/git"
+	"github.com/facebookincubator/contest/plugins/testfetchers/glob"
 	"github.com/facebookincubator/contest/plugins/testfetchers/literal"
+	tests3 "github.com/facebookincubator/contest/plugins/testfetchers/s3"
+	"github.com/facebookincubator/contest/plugins/testfetchers/templated"
 	"github.com/facebookincubator/contest/plugins/testfetchers/uri"
 	"github.com/facebookincubator/contest/plugins/teststeps/cmd"
+	"github.com/facebookincubator/contest/plugins/teststeps/crashcollect"
 	"github.com/facebookincubator/contest/plugins/teststeps/echo"
 	"github.com/facebookincubator/contest/plugins/teststeps/example"
+	"github.com/facebookincubator/contest/plugins/teststeps/exec"
+	"github.com/facebookincubator/contest/plugins/teststeps/lava"
+	"github.com/facebookincubator/contest/plugins/teststeps/limitedcmd"
+	"github.com/facebookincubator/contest/plugins/teststeps/parallel"
 	"github.com/facebookincubator/contest/plugins/teststeps/randecho"
 	"github.com/facebookincubator/contest/plugins/teststeps/slowecho"
 	"github.com/facebookincubator/contest/plugins/teststeps/sshcmd"
 	"github.com/facebookincubator/contest/plugins/teststeps/terminalexpect"
-	"github.com/sirupsen/logrus"
 )
 
 const defaultDBURI = "contest:contest@tcp(localhost:3306)/contest?parseTime=true"
 
 var (
-	flagDBURI    = flag.String("dbURI", defaultDBURI, "Database URI")
-	flagServerID = flag.String("serverID", "", "Set a static server ID, e.g. the host name or another unique identifier. If unset, will use the listener's default")
+	flagConfig = flag.String("config", "", "YAML or JSON server configuration file, whose sections set the flags, see contest.yaml. Flags set on the command line override the file")
+
+	flagDBURI                = flag.String("dbURI", defaultDBURI, "Database URI. URIs starting with postgres:// or postgresql:// select the PostgreSQL storage, sqlite://<path> selects the embedded SQLite storage, otherwise MySQL is used")
+	flagDBReadURI            = flag.String("dbReadURI", "", "Database URI of a read replica serving job status requests, using the same storage as dbURI. If unset, dbURI serves all requests")
+	flagDBAutoMigrate        = flag.Bool("dbAutoMigrate", false, "Upgrade the schema of the MySQL database on startup. PostgreSQL and SQLite databases are always upgraded. The schema can also be upgraded by running the migrate command")
+	flagDBSlowQueryThreshold = flag.Duration("dbSlowQueryThreshold", 0, "Log the database statements which take longer than this duration. If 0, no statement is logged")
+	flagServerID             = flag.String("serverID", "", "Set a static server ID, e.g. the host name or another unique identifier. If unset, will use the listener's default")
+
+	flagAuthOIDCIssuer     = flag.String("authOIDCIssuer", "", "URL of an OpenID Connect issuer. If set, API clients must authenticate with a bearer JWT signed by the issuer, and the requestor of their calls is taken from the token")
+	flagAuthOIDCAudience   = flag.String("authOIDCAudience", "", "Audience which the tokens must be intended for, e.g. the client ID of ConTest at the issuer. If unset, the audience is not checked")
+	flagAuthRequestorClaim = flag.String("authRequestorClaim", "sub", "Claim of the tokens used as requestor, e.g. sub, email or preferred_username")
+	flagAuthzPolicyFile    = flag.String("authzPolicyFile", "", "JSON file assigning roles (submitter, operator, admin) to requestors, e.g. {\"default\": [\"submitter\"], \"requestors\": {\"alice\": [\"admin\"]}}. If unset, every requestor may do anything")
+
+	flagRateLimit                     = flag.Float64("rateLimit", 0, "Average number of API calls per second allowed for each requestor, or for each client host if calls are not authenticated. Calls beyond the limit are rejected and must be retried later. If 0, calls are not limited")
+	flagRateLimitBurst                = flag.Int("rateLimitBurst", 10, "Number of API calls which each requestor may make at once, beyond the average rate")
+	flagMaxRunningJobsPerRequestor    = flag.Int("maxRunningJobsPerRequestor", 0, "Number of unfinished jobs, running or waiting to run, which each requestor may have at once. Jobs started beyond it are rejected. It must be larger than -maxConcurrentJobsPerRequestor, beyond which jobs are queued. If 0, jobs are not limited")
+	flagMaxConcurrentJobs             = flag.Int("maxConcurrentJobs", 0, "Number of jobs which the server runs at once. Jobs started beyond it wait in a queue, by priority. If 0, jobs are not limited")
+	flagMaxConcurrentJobsPerRequestor = flag.Int("maxConcurrentJobsPerRequestor", 0, "Number of jobs which each requestor runs at once. Jobs started beyond it wait in a queue, while the jobs of other requestors may start. If 0, jobs are not limited")
+	flagRequestorMaxConcurrentJobs    = flag.String("requestorMaxConcurrentJobs", "", "Comma-separated requestor=N pairs overriding -maxConcurrentJobsPerRequestor for some requestors, e.g. ci=10,alice=0. 0 means no limit")
+	flagMaxTargetsPerRequestor        = flag.Int("maxTargetsPerRequestor", 0, "Number of targets which the jobs of each requestor may lock at once. Jobs started once it is reached are rejected, and jobs which would lock more targets fail. If 0, targets are not limited")
+	flagRequestorMaxTargets           = flag.String("requestorMaxTargets", "", "Comma-separated requestor=N pairs overriding -maxTargetsPerRequestor for some requestors, e.g. ci=100,alice=0. 0 means no limit")
+	flagMaxRuntimePerRequestorPerDay  = flag.Duration("maxRuntimePerRequestorPerDay", 0, "Time for which the jobs of each requestor may run each day, in UTC. Jobs started once it is reached are rejected until the next day, and jobs locking targets afterwards fail. If 0, runtime is not limited")
+	flagRequestorMaxRuntimePerDay     = flag.String("requestorMaxRuntimePerDay", "", "Comma-separated requestor=duration pairs overriding -maxRuntimePerRequestorPerDay for some requestors, e.g. ci=24h,alice=0. 0 means no limit")
+	flagMaxQueuedJobs                 = flag.Int("maxQueuedJobs", 1000, "Number of jobs which may wait in the queue. Jobs started beyond it are rejected. If 0, the queue is not limited")
+	flagInterruptedJobs               = flag.String("interruptedJobs", string(jobmanager.InterruptedJobsKeep), "What to do at startup with the jobs which this server did not finish before it stopped: keep them until they are retried, resume them from the interrupted run, or fail them")
+	flagApprovalPolicyFile            = flag.String("approvalPolicyFile", "", "JSON file selecting the jobs which wait for the approval of an operator before they start, by tags, target manager names or a regular expression matching target manager acquire parameters, e.g. {\"tags\": [\"production\"], \"targetManagers\": [\"ProdPool\"]}. If unset, jobs need no approval")
+	flagPreemptJobs                   = flag.Bool("preemptJobs", false, "Let the jobs which cannot lock their targets pause the jobs of lower priority holding them, and take over their locks. The preempted jobs are resumed once the jobs preempting them ended")
+	flagClusterHeartbeatInterval      = flag.Duration("clusterHeartbeatInterval", 0, "Run the server in a cluster of servers sharing the MySQL database, recording a heartbeat at this interval. The leader of the cluster takes over the unfinished jobs of the servers which stopped, and runs the schedules. Servers must have unique IDs, see -serverID. If 0, the server runs on its own")
+	flagClusterFailoverTimeout        = flag.Duration("clusterFailoverTimeout", time.Minute, "Time after which the servers of the cluster which did not record a heartbeat are considered stopped, and their jobs are taken over. A server which could not record a heartbeat for this long stops its running jobs. It must be several heartbeat intervals")
+	flagWebhookSecretFile             = flag.String("webhookSecretFile", "", "File containing the secret signing the payloads of the webhooks called when jobs change state. If unset, webhooks are disabled, and jobs setting webhooks are rejected")
+	flagWebhookURLs                   = flag.String("webhookURLs", "", "Comma-separated URLs of the webhooks called when any job changes state, in addition to the webhooks set in the job descriptors. Requires -webhookSecretFile")
+	flagTargetLocker                  = flag.String("targetLocker", targetLockerAuto, "Target locker holding the locks of the targets: inmemory, or dblocker, sharing the locks in the MySQL database. auto selects dblocker in a cluster, see -clusterHeartbeatInterval, and inmemory otherwise")
+	flagDescriptorLibrary             = flag.String("descriptorLibrary", "", "Directory of the job descriptor fragments, e.g. reporters or target manager configurations, which job descriptors include by name with \"$include\": \"name\", from the name.json, name.yaml or name.yml file. If unset, job descriptors cannot include fragments")
+
+	flagHTTPAddr         = flag.String("httpAddr", httplistener.DefaultAddr, "Address on which the HTTP API is served")
+	flagHTTPCertFile     = flag.String("httpCertFile", "", "TLS certificate of the HTTP API. If unset, the HTTP API is served over cleartext HTTP")
+	flagHTTPKeyFile      = flag.String("httpKeyFile", "", "TLS key of the HTTP API")
+	flagHTTPClientCAFile = flag.String("httpClientCAFile", "", "PEM file of the CAs of the client certificates. If set, HTTP API clients must authenticate with a certificate, whose common name is the requestor of their calls")
+
+	flagGRPCAddr     = flag.String("grpcAddr", "", "Address on which the gRPC API is served, in addition to the HTTP API, e.g. :8081. If unset, the gRPC API is disabled")
+	flagGRPCCertFile = flag.String("grpcCertFile", "", "TLS certificate of the gRPC API, which is required as the gRPC API is only served over TLS")
+	flagGRPCKeyFile  = flag.String("grpcKeyFile", "", "TLS key of the gRPC API")
+	flagMetricsAddr  = flag.String("metricsAddr", "", "Address on which the server metrics are exposed, at /metrics in the Prometheus text format and at /debug/vars as JSON, e.g. :9090. If unset, metrics are not exposed")
+
+	flagLogLevel        = flag.String("logLevel", "debug", "Default log level of the modules of the server: panic, fatal, error, warning, info, debug or trace")
+	flagLogFormat       = flag.String("logFormat", logging.FormatText, "Format of the logs: text, or json with one object per entry. The entries about jobs carry their job_id, run_id, test, step and target fields")
+	flagLogModuleLevels = flag.String("logModuleLevels", "", "Comma-separated module=level pairs overriding -logLevel for some modules, e.g. pkg/runner=info,pkg/storage=warning. Levels can also be changed at runtime with the setLogLevel API")
+
+	flagOTLPEndpoint    = flag.String("otlpEndpoint", "", "Base URL of an OpenTelemetry collector, e.g. http://collector:4318, to which the spans tracing the jobs, their tests, steps, target operations and event writes are exported with OTLP over HTTP. If unset, jobs are not traced")
+	flagOTLPServiceName = flag.String("otlpServiceName", otlp.DefaultServiceName, "Service name of the exported spans")
+
+	flagHealthCheckInterval = flag.Duration("healthCheckInterval", 0, "Check the storage, the target locker and the services of -healthCheckURLs at this interval. Readiness then reports the state found by the last check, and every change of state is recorded as a DependencyDown or DependencyUp event. If 0, dependencies are only checked by readiness requests")
+	flagHealthCheckURLs     = flag.String("healthCheckURLs", "", "Comma-separated name=URL pairs of the external services the server depends on, which are up if they answer a GET request with a 2xx status, e.g. inventory=http://inventory/health. Requires -healthCheckInterval")
+
+	flagEventCompression          = flag.String("eventCompression", "", "Compress the payloads of events stored in the database with this algorithm, e.g. gzip. If unset, payloads are stored uncompressed")
+	flagEventCompressionThreshold = flag.Int("eventCompressionThreshold", 4096, "Minimum size in bytes of the event payloads to compress")
+
+	flagRetentionDays      = flag.Int("retentionDays", 0, "Delete the events of the jobs which ended more than this number of days ago. The events of the jobs which did not end are kept, as their state is derived from them. If 0, events are kept forever")
+	flagRetentionInterval  = flag.Duration("retentionInterval", retention.DefaultInterval, "Interval between two runs of the retention policy")
+	flagRetentionPruneJobs = flag.Bool("retentionPruneJobs", false, "Also delete the requests and reports of the jobs which were requested and ended before the retention period")
+	flagRetentionDryRun    = flag.Bool("retentionDryRun", false, "Only log what the retention policy would delete")
+	flagRetentionArchive   = flag.Bool("retentionArchive", false, "Archive the events in the artifact store before deleting them")
+
+	flagArtifactStore    = flag.String("artifactStore", "", "Where to store test step artifacts: a local directory, or an s3://bucket/prefix URI. If unset, artifacts are disabled")
+	flagArtifactS3Region = flag.String("artifactS3Region", "", "Region of the S3 artifact store")
+	flagArtifactS3URL    = flag.String("artifactS3Endpoint", "", "Endpoint of the S3 artifact store, if not AWS")
+
+	flagEventKafkaRESTProxy     = flag.String("eventKafkaRESTProxy", "", "URL of a Kafka REST Proxy to which all the test and framework events are forwarded. If unset, events are not forwarded")
+	flagEventKafkaTopic         = flag.String("eventKafkaTopic", "contest-events", "Kafka topic to which events are forwarded")
+	flagEventKafkaSerialization = flag.String("eventKafkaSerialization", kafka.SerializationJSON, "Serialization of the forwarded events, either json or cloudevents")
+
+	flagEmailSMTPServer       = flag.String("emailSMTPServer", "", "SMTP server used by the Email reporter, in host:port form. If unset, the Email reporter is disabled")
+	flagEmailFrom             = flag.String("emailFrom", "contest@localhost", "Sender of the emails sent by the Email reporter")
+	flagEmailSMTPUsername     = flag.String("emailSMTPUsername", "", "Username to authenticate to the SMTP server, if any")
+	flagEmailSMTPPasswordFile = flag.String("emailSMTPPasswordFile", "", "File containing the password to authenticate to the SMTP server")
+	flagEmailJobURL           = flag.String("emailJobURL", "", "URL to which the job ID is appended to link jobs from the emails, e.g. https://contest.example.com/status?jobID=")
+
+	flagGitCredentialsDir = flag.String("gitCredentialsDir", "", "Directory of the passwords, SSH keys and known hosts files which the fetch parameters of the Git test fetcher name, e.g. \"SSHKeyFile\": \"deploy_key\". If unset, the Git test fetcher can only fetch repositories requiring no credentials")
+
+	flagExternalPlugins = flag.String("externalPlugins", "", "Comma-separated paths of plugin binaries implementing test steps, target managers and reporters over the gRPC protocol of pkg/pluginbridge. They are launched at startup, and their plugins are registered like the built-in ones")
+
+	flagTargetManagerTimeout          = flag.Duration("targetManagerTimeout", config.TargetManagerTimeout, "Maximum time the target managers may take to acquire or release targets")
+	flagStepInjectTimeout             = flag.Duration("stepInjectTimeout", config.StepInjectTimeout, "Maximum time the first step of a test may take to accept a target")
+	flagTestRunnerMsgTimeout          = flag.Duration("testRunnerMsgTimeout", config.TestRunnerMsgTimeout, "Maximum time the components of the test runner wait for the delivery of a message")
+	flagTestRunnerShutdownTimeout     = flag.Duration("testRunnerShutdownTimeout", config.TestRunnerShutdownTimeout, "Maximum time the test runner waits for the steps to return after a cancellation")
+	flagTestRunnerStepShutdownTimeout = flag.Duration("testRunnerStepShutdownTimeout", config.TestRunnerStepShutdownTimeout, "Maximum time the test runner waits for the steps to return once all the targets went through them")
+	flagTestRunnerCleanupTimeout      = flag.Duration("testRunnerCleanupTimeout", config.TestRunnerCleanupTimeout, "Maximum time the cleanup steps of a test may still run once the test is cancelled or paused")
+	flagLockRefreshTimeout            = flag.Duration("lockRefreshTimeout", config.LockRefreshTimeout, "Time by which the locks of the targets are extended periodically while their jobs run. Targets are first locked for -targetManagerTimeout in addition")
 )
 
 var targetManagers = []target.TargetManagerLoader{
@@ -55,6 +177,10 @@ var targetManagers = []target.TargetManagerLoader{
 var testFetchers = []test.TestFetcherLoader{
 	uri.Load,
 	literal.Load,
+	git.Load,
+	tests3.Load,
+	templated.Load,
+	glob.Load,
 }
 
 var testSteps = []test.TestStepLoader{
@@ -65,11 +191,24 @@ var testSteps = []test.TestStepLoader{
 	sshcmd.Load,
 	randecho.Load,
 	terminalexpect.Load,
+	limitedcmd.Load,
+	exec.Load,
+	lava.Load,
+	crashcollect.Load,
+	parallel.Load,
 }
 
 var reporters = []job.ReporterLoader{
 	targetsuccess.Load,
 	noop.Load,
+	junit.Load,
+	tap.Load,
+	email.Load,
+	webhook.Load,
+	pushgateway.Load,
+	html.Load,
+	clickhouse.Load,
+	composite.Load,
 }
 
 // user-defined functions that will be made available to plugins for advanced
@@ -84,12 +223,163 @@ var userFunctions = map[string]interface{}{
 	},
 }
 
+// newStorage creates the storage engine selected by the database URI. Replicas
+// are read-only, so their schema is not migrated.
+func newStorage(dbURI string, replica bool) (storage.Storage, error) {
+	opts := []rdbms.Opt{rdbms.SlowQueryThreshold(*flagDBSlowQueryThreshold)}
+	if *flagEventCompression != "" {
+		opts = append(opts, rdbms.PayloadCompression(*flagEventCompression, *flagEventCompressionThreshold))
+	}
+	switch {
+	case strings.HasPrefix(dbURI, "postgres://") || strings.HasPrefix(dbURI, "postgresql://"):
+		if replica {
+			return postgres.NewReplica(dbURI, opts...)
+		}
+		return postgres.New(dbURI, opts...)
+	case strings.HasPrefix(dbURI, "sqlite://"):
+		if replica {
+			return nil, errors.New("the SQLite storage does not support replicas")
+		}
+		return sqlite.New(strings.TrimPrefix(dbURI, "sqlite://"), opts...)
+	default:
+		return rdbms.New(dbURI, opts...)
+	}
+}
+
+// migrateSchema creates or upgrades the schema of the database selected by
+// the database URI. The MySQL database also holds the locks table of the
+// DBLocker target locker.
+func migrateSchema(dbURI string) error {
+	switch {
+	case strings.HasPrefix(dbURI, "postgres://") || strings.HasPrefix(dbURI, "postgresql://"):
+		return postgres.Migrate(dbURI)
+	case strings.HasPrefix(dbURI, "sqlite://"):
+		return sqlite.Migrate(strings.TrimPrefix(dbURI, "sqlite://"))
+	default:
+		if err := rdbms.Migrate(dbURI); err != nil {
+			return err
+		}
+		return dblocker.Migrate(dbURI)
+	}
+}
+
+// parseRequestorLimits parses comma-separated requestor=N pairs.
+func parseRequestorLimits(s string) (map[api.EventRequestor]int, error) {
+	limits := make(map[api.EventRequestor]int)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid pair '%s', expected requestor=N", pair)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid limit in '%s'", pair)
+		}
+		limits[api.EventRequestor(strings.TrimSpace(kv[0]))] = n
+	}
+	return limits, nil
+}
+
+// parseRequestorDurations parses comma-separated requestor=duration pairs.
+func parseRequestorDurations(s string) (map[api.EventRequestor]time.Duration, error) {
+	durations := make(map[api.EventRequestor]time.Duration)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid pair '%s', expected requestor=duration", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(kv[1]))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid duration in '%s'", pair)
+		}
+		durations[api.EventRequestor(strings.TrimSpace(kv[0]))] = d
+	}
+	return durations, nil
+}
+
+// requestorQuotas returns the default quota, and the quotas of the requestors
+// overriding part of it, as set by the flags.
+func requestorQuotas() (api.Quota, map[api.EventRequestor]api.Quota, error) {
+	defaultQuota := api.Quota{
+		MaxTargets:       *flagMaxTargetsPerRequestor,
+		MaxRuntimePerDay: *flagMaxRuntimePerRequestorPerDay,
+	}
+	maxTargets, err := parseRequestorLimits(*flagRequestorMaxTargets)
+	if err != nil {
+		return defaultQuota, nil, fmt.Errorf("invalid -requestorMaxTargets: %v", err)
+	}
+	maxRuntimes, err := parseRequestorDurations(*flagRequestorMaxRuntimePerDay)
+	if err != nil {
+		return defaultQuota, nil, fmt.Errorf("invalid -requestorMaxRuntimePerDay: %v", err)
+	}
+	overrides := make(map[api.EventRequestor]api.Quota)
+	for requestor, n := range maxTargets {
+		quota := defaultQuota
+		quota.MaxTargets = n
+		overrides[requestor] = quota
+	}
+	for requestor, d := range maxRuntimes {
+		quota, ok := overrides[requestor]
+		if !ok {
+			quota = defaultQuota
+		}
+		quota.MaxRuntimePerDay = d
+		overrides[requestor] = quota
+	}
+	return defaultQuota, overrides, nil
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "Without a command, runs the ConTest server. Commands:\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  migrate\tcreate or upgrade the schema of the database, then exit\n")
+	fmt.Fprintf(flag.CommandLine.Output(), "  validateConfig\tcheck the configuration file and the flags, then exit\n\nFlags:\n")
+	flag.PrintDefaults()
+}
+
 func main() {
+	flag.Usage = usage
 	flag.Parse()
 	log := logging.GetLogger("contest")
-	log.Level = logrus.DebugLevel
+
+	if *flagConfig != "" {
+		if err := config.ApplyServerConfig(flag.CommandLine, *flagConfig, configSections); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if err := checkFlags(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	setTimeouts()
+	setLogging()
+
+	switch flag.Arg(0) {
+	case "":
+	case "validateConfig":
+		log.Infof("Configuration is valid")
+		return
+	case "migrate":
+		log.Infof("Migrating database URI: %s", *flagDBURI)
+		if err := migrateSchema(*flagDBURI); err != nil {
+			log.Fatalf("could not migrate database: %v", err)
+		}
+		log.Infof("Database schema is up to date")
+		return
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
 
 	pluginRegistry := pluginregistry.NewPluginRegistry()
+	parallel.SetPluginRegistry(pluginRegistry)
+	templated.SetPluginRegistry(pluginRegistry)
+	composite.SetPluginRegistry(pluginRegistry)
 
 	// Register TargetManager plugins
 	for _, tmloader := range targetManagers {
@@ -120,16 +410,152 @@ func main() {
 		}
 	}
 
+	// Register the plugins of external binaries, which exit with the server
+	for _, path := range externalPlugins() {
+		client, err := pluginbridge.Launch(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer client.Kill()
+		if err := client.Register(pluginRegistry); err != nil {
+			log.Fatalf("could not register the plugins of %s: %v", path, err)
+		}
+	}
+
+	// Register Locker plugins
+	if err := pluginRegistry.RegisterLocker(inmemory.Name, inmemory.New); err != nil {
+		log.Fatal(err)
+	}
+
+	// metrics endpoint. Metrics are published via expvar, which registers
+	// its handler on the default mux, and exported to Prometheus.
+	if *flagMetricsAddr != "" {
+		http.Handle("/metrics", metrics.Handler())
+		go func() {
+			log.Infof("Exposing metrics on %s/metrics and %s/debug/vars", *flagMetricsAddr, *flagMetricsAddr)
+			if err := http.ListenAndServe(*flagMetricsAddr, http.DefaultServeMux); err != nil {
+				log.Fatalf("metrics listener failed: %v", err)
+			}
+		}()
+	}
+
 	// storage initialization
 	log.Infof("Using database URI: %s", *flagDBURI)
-	s, err := rdbms.New(*flagDBURI)
+	if *flagDBAutoMigrate {
+		if err := migrateSchema(*flagDBURI); err != nil {
+			log.Fatalf("could not migrate database: %v", err)
+		}
+	}
+	s, err := newStorage(*flagDBURI, false)
 	if err != nil {
 		log.Fatalf("could not initialize database: %v", err)
 	}
 	storage.SetStorage(s)
+	if *flagDBReadURI != "" {
+		log.Infof("Using read replica database URI: %s", *flagDBReadURI)
+		rs, err := newStorage(*flagDBReadURI, true)
+		if err != nil {
+			log.Fatalf("could not initialize read replica database: %v", err)
+		}
+		storage.SetReadStorage(rs)
+	}
 
-	// set Locker engine
-	target.SetLocker(inmemory.New(config.LockInitialTimeout, config.LockRefreshTimeout))
+	// artifact store initialization
+	if *flagArtifactStore != "" {
+		var (
+			as  artifact.Store
+			err error
+		)
+		if strings.HasPrefix(*flagArtifactStore, "s3://") {
+			as, err = artifacts3.New(*flagArtifactStore, *flagArtifactS3URL, *flagArtifactS3Region)
+		} else {
+			as, err = localdir.New(*flagArtifactStore)
+		}
+		if err != nil {
+			log.Fatalf("could not initialize artifact store: %v", err)
+		}
+		log.Infof("Using artifact store: %s", *flagArtifactStore)
+		artifact.SetStore(as)
+	}
+
+	// tracing
+	if *flagOTLPEndpoint != "" {
+		exporter, err := otlp.New(otlp.Config{Endpoint: *flagOTLPEndpoint, ServiceName: *flagOTLPServiceName})
+		if err != nil {
+			log.Fatalf("could not initialize OTLP span exporter: %v", err)
+		}
+		log.Infof("Exporting the spans of the jobs to %s", *flagOTLPEndpoint)
+		tracing.SetExporter(exporter)
+		go exporter.Run(nil)
+	}
+
+	// event forwarding
+	if *flagEventKafkaRESTProxy != "" {
+		producer, err := kafka.NewRESTProducer(*flagEventKafkaRESTProxy)
+		if err != nil {
+			log.Fatalf("could not initialize Kafka producer: %v", err)
+		}
+		forwarder, err := kafka.New(producer, kafka.Config{
+			Topic:         *flagEventKafkaTopic,
+			Serialization: *flagEventKafkaSerialization,
+		})
+		if err != nil {
+			log.Fatalf("could not initialize Kafka event forwarder: %v", err)
+		}
+		log.Infof("Forwarding events to Kafka topic %s via %s", *flagEventKafkaTopic, *flagEventKafkaRESTProxy)
+		storage.SetEventForwarder(forwarder)
+		go forwarder.Run(nil)
+	}
+
+	// retention policy
+	if *flagRetentionDays > 0 {
+		pruner, err := retention.New(s, retention.Policy{
+			MaxAge:    time.Duration(*flagRetentionDays) * 24 * time.Hour,
+			EndStates: jobmanager.JobCompletionEvents,
+			Interval:  *flagRetentionInterval,
+			PruneJobs: *flagRetentionPruneJobs,
+			DryRun:    *flagRetentionDryRun,
+			Archive:   *flagRetentionArchive,
+		})
+		if err != nil {
+			log.Fatalf("could not initialize retention policy: %v", err)
+		}
+		go pruner.Run(nil)
+	}
+
+	// email reporter configuration
+	if *flagEmailSMTPServer != "" {
+		var password string
+		if *flagEmailSMTPPasswordFile != "" {
+			buf, err := ioutil.ReadFile(*flagEmailSMTPPasswordFile)
+			if err != nil {
+				log.Fatalf("could not read SMTP password file: %v", err)
+			}
+			password = strings.TrimSpace(string(buf))
+		}
+		email.SetConfig(email.Config{
+			Server:   *flagEmailSMTPServer,
+			From:     *flagEmailFrom,
+			Username: *flagEmailSMTPUsername,
+			Password: password,
+			JobURL:   *flagEmailJobURL,
+		})
+	}
+
+	git.SetCredentialsDir(*flagGitCredentialsDir)
+
+	// set Locker engine. The servers of a cluster share the locks of their
+	// targets via the MySQL database.
+	var locker target.Locker
+	if targetLocker() == targetLockerDB {
+		locker, err = dblocker.New(*flagDBURI, config.LockInitialTimeout, config.LockRefreshTimeout)
+	} else {
+		locker, err = pluginRegistry.NewLocker(inmemory.Name, config.LockInitialTimeout, config.LockRefreshTimeout)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	target.SetLocker(locker)
 
 	// user-defined function registration
 	for name, fn := range userFunctions {
@@ -139,13 +565,151 @@ func main() {
 	}
 
 	// spawn JobManager
-	listener := httplistener.HTTPListener{}
+	var authenticators api.Authenticators
+	if *flagAuthOIDCIssuer != "" {
+		a, err := api.NewOIDCAuthenticator(api.OIDCConfig{
+			Issuer:         *flagAuthOIDCIssuer,
+			Audience:       *flagAuthOIDCAudience,
+			RequestorClaim: *flagAuthRequestorClaim,
+		})
+		if err != nil {
+			log.Fatalf("could not initialize authentication: %v", err)
+		}
+		log.Infof("Authenticating API clients with tokens of %s", *flagAuthOIDCIssuer)
+		authenticators = append(authenticators, a)
+	}
+	// the gRPC listener does not support client certificates
+	var grpcAuthenticator api.Authenticator
+	if len(authenticators) > 0 {
+		grpcAuthenticator = authenticators
+	}
+	// the listeners share the rate limits of the requestors
+	var rateLimiter *api.RateLimiter
+	if *flagRateLimit > 0 {
+		var err error
+		if rateLimiter, err = api.NewRateLimiter(*flagRateLimit, *flagRateLimitBurst); err != nil {
+			log.Fatalf("could not initialize rate limiting: %v", err)
+		}
+	}
+	httpListener := &httplistener.HTTPListener{
+		Addr:         *flagHTTPAddr,
+		CertFile:     *flagHTTPCertFile,
+		KeyFile:      *flagHTTPKeyFile,
+		ClientCAFile: *flagHTTPClientCAFile,
+		RateLimiter:  rateLimiter,
+	}
+	if *flagHTTPClientCAFile != "" {
+		log.Infof("Authenticating HTTP API clients with certificates signed by %s", *flagHTTPClientCAFile)
+		authenticators = append(authenticators, api.ClientCertAuthenticator{})
+	}
+	if len(authenticators) > 0 {
+		httpListener.Authenticator = authenticators
+	}
+	var listener api.Listener = httpListener
+	if *flagGRPCAddr != "" {
+		listener = api.Listeners{listener, &grpclistener.GRPCListener{
+			Addr:          *flagGRPCAddr,
+			CertFile:      *flagGRPCCertFile,
+			KeyFile:       *flagGRPCKeyFile,
+			Authenticator: grpcAuthenticator,
+			RateLimiter:   rateLimiter,
+		}}
+	}
 
 	var serverIDFunc api.ServerIDFunc
 	if *flagServerID != "" {
 		serverIDFunc = func() string { return *flagServerID }
 	}
-	jm, err := jobmanager.New(&listener, serverIDFunc, pluginRegistry)
+	var jmOpts []jobmanager.Opt
+	if *flagAuthzPolicyFile != "" {
+		policy, err := api.LoadStaticPolicy(*flagAuthzPolicyFile)
+		if err != nil {
+			log.Fatalf("could not initialize authorization: %v", err)
+		}
+		authorizer, err := api.NewAuthorizer(policy)
+		if err != nil {
+			log.Fatalf("could not initialize authorization: %v", err)
+		}
+		log.Infof("Authorizing API calls with the policy in %s", *flagAuthzPolicyFile)
+		jmOpts = append(jmOpts, jobmanager.Authorizer(authorizer))
+	}
+	if *flagMaxRunningJobsPerRequestor > 0 {
+		jmOpts = append(jmOpts, jobmanager.MaxRunningJobsPerRequestor(*flagMaxRunningJobsPerRequestor))
+	}
+	if *flagMaxConcurrentJobs > 0 {
+		jmOpts = append(jmOpts, jobmanager.MaxConcurrentJobs(*flagMaxConcurrentJobs))
+	}
+	if *flagMaxConcurrentJobsPerRequestor > 0 || *flagRequestorMaxConcurrentJobs != "" {
+		overrides, err := parseRequestorLimits(*flagRequestorMaxConcurrentJobs)
+		if err != nil {
+			log.Fatalf("invalid -requestorMaxConcurrentJobs: %v", err)
+		}
+		jmOpts = append(jmOpts, jobmanager.MaxConcurrentJobsPerRequestor(*flagMaxConcurrentJobsPerRequestor, overrides))
+	}
+	jmOpts = append(jmOpts, jobmanager.MaxQueuedJobs(*flagMaxQueuedJobs))
+	defaultQuota, quotaOverrides, err := requestorQuotas()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	jmOpts = append(jmOpts, jobmanager.Quotas(defaultQuota, quotaOverrides))
+	interruptedJobPolicy, err := jobmanager.ParseInterruptedJobPolicy(*flagInterruptedJobs)
+	if err != nil {
+		log.Fatalf("invalid -interruptedJobs: %v", err)
+	}
+	jmOpts = append(jmOpts, jobmanager.InterruptedJobs(interruptedJobPolicy))
+	if *flagApprovalPolicyFile != "" {
+		approvalPolicy, err := jobmanager.LoadApprovalPolicy(*flagApprovalPolicyFile)
+		if err != nil {
+			log.Fatalf("could not initialize job approval: %v", err)
+		}
+		log.Infof("Jobs matching the approval policy in %s must be approved", *flagApprovalPolicyFile)
+		jmOpts = append(jmOpts, jobmanager.RequireApproval(approvalPolicy))
+	}
+	if *flagPreemptJobs {
+		if _, ok := locker.(target.TransferableLocker); !ok {
+			log.Fatalf("-preemptJobs requires a target locker which can transfer locks, got %T", locker)
+		}
+		jmOpts = append(jmOpts, jobmanager.PreemptJobs())
+	}
+	if *flagClusterHeartbeatInterval > 0 {
+		log.Infof("Running in a cluster, with heartbeats every %v and a failover timeout of %v", *flagClusterHeartbeatInterval, *flagClusterFailoverTimeout)
+		jmOpts = append(jmOpts, jobmanager.Cluster(*flagClusterHeartbeatInterval, *flagClusterFailoverTimeout))
+	}
+	if *flagWebhookSecretFile != "" {
+		buf, err := ioutil.ReadFile(*flagWebhookSecretFile)
+		if err != nil {
+			log.Fatalf("could not read webhook secret file: %v", err)
+		}
+		sender, err := jobwebhook.NewSender(jobwebhook.Config{Secret: []byte(strings.TrimSpace(string(buf)))})
+		if err != nil {
+			log.Fatalf("could not initialize webhooks: %v", err)
+		}
+		var urls []string
+		for _, u := range strings.Split(*flagWebhookURLs, ",") {
+			if u = strings.TrimSpace(u); u == "" {
+				continue
+			}
+			if err := jobwebhook.CheckURL(u); err != nil {
+				log.Fatalf("invalid -webhookURLs: %v", err)
+			}
+			urls = append(urls, u)
+		}
+		log.Infof("Calling webhooks when jobs change state, and %d webhooks for every job", len(urls))
+		jmOpts = append(jmOpts, jobmanager.Webhooks(sender, urls))
+	}
+	if *flagHealthCheckInterval > 0 {
+		deps, err := parseHealthCheckURLs(*flagHealthCheckURLs)
+		if err != nil {
+			log.Fatalf("invalid -healthCheckURLs: %v", err)
+		}
+		log.Infof("Checking the health of the storage, the target locker and %d services every %v", len(deps), *flagHealthCheckInterval)
+		jmOpts = append(jmOpts, jobmanager.HealthChecks(*flagHealthCheckInterval, deps...))
+	}
+	if *flagDescriptorLibrary != "" {
+		log.Infof("Job descriptors include the fragments of %s", *flagDescriptorLibrary)
+		jmOpts = append(jmOpts, jobmanager.DescriptorLibrary(job.NewLibrary(*flagDescriptorLibrary)))
+	}
+	jm, err := jobmanager.New(listener, serverIDFunc, pluginRegistry, jmOpts...)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -30,6 +30,9 @@ done
 
 echo "MySQL is healthy!"
 
+echo "Migrating the schema of the integration tests database"
+go run ./cmds/contest -dbURI 'contest:contest@tcp(mysql:3306)/contest_integ?parseTime=true' migrate
+
 # disable CGO for the build
 export CGO_ENABLED=0
 for d in $(go list ./cmds/... | grep -v vendor); do
@@ -16,8 +16,7 @@ GRANT ALL ON contest.* TO 'contest'@'%';
 GRANT ALL ON contest_integ.* TO 'contest'@'%';
 FLUSH PRIVILEGES;
 
-USE contest;
-source /create_contest_db.sql
-
-USE contest_integ;
-source /create_contest_db.sql
+/*
+ * The schema of the databases is created by ConTest itself, see the migrate
+ * command and the -dbAutoMigrate flag of cmds/contest.
+ */
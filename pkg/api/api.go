@@ -11,6 +11,8 @@ import (
 	"os"
 	"time"
 
+	"github.com/facebookincubator/contest/pkg/config"
+	"github.com/facebookincubator/contest/pkg/job"
 	"github.com/facebookincubator/contest/pkg/storage/limits"
 	"github.com/facebookincubator/contest/pkg/types"
 )
@@ -18,12 +20,32 @@ import (
 // CurrentAPIVersion is the current version of the API that the clients must be
 // able to speak in order to communicate with the server. Versioning starts at
 // 1, while 0 is to be considered an error indicator.
-const CurrentAPIVersion uint32 = 5
+const CurrentAPIVersion uint32 = 7
 
 // DefaultEventTimeout is the default time to wait for sending or receiving an
 // event on the events channel.
 var DefaultEventTimeout = 3 * time.Second
 
+// DefaultPageLimit is the number of items returned by paginated requests,
+// like List and TestEvents, when the client does not set a limit. MaxPageLimit
+// caps the limit set by clients, so that a single request cannot make the
+// server load millions of events in memory.
+var (
+	DefaultPageLimit uint = 100
+	MaxPageLimit     uint = 1000
+)
+
+// PageLimit returns the limit applied to a paginated request.
+func PageLimit(limit uint) uint {
+	if limit == 0 {
+		return DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return limit
+}
+
 // ServerIDFunc is used to return a custom server ID in api responses.
 type ServerIDFunc func() string
 
@@ -38,6 +60,9 @@ type API struct {
 	// serverID is used by ServerID() to return a custom server ID in API
 	// responses.
 	serverID string
+	// requestID is the ID of the request whose calls are made via this API
+	// object, see ForRequest.
+	requestID string
 }
 
 // New returns an initialized instance of an API struct with the specified
@@ -74,12 +99,23 @@ func (a API) ServerID() string {
 	return a.serverID
 }
 
-// newResponse returns a new Response object with type and server ID set. The
-// Data field has to be set by the user.
+// ForRequest returns a copy of the API object whose calls record the ID of
+// the request which made them, e.g. one set by AccessLogMiddleware. The
+// JobManager logs it, and records it in the framework events emitted while
+// handling the calls and in the audit log, and the responses carry it.
+func (a *API) ForRequest(requestID string) *API {
+	c := *a
+	c.requestID = requestID
+	return &c
+}
+
+// newResponse returns a new Response object with type, server ID and request
+// ID set. The Data field has to be set by the user.
 func (a API) newResponse(rtype ResponseType) Response {
 	return Response{
-		Type:     rtype,
-		ServerID: a.ServerID(),
+		Type:      rtype,
+		ServerID:  a.ServerID(),
+		RequestID: a.requestID,
 	}
 }
 
@@ -94,7 +130,8 @@ func (a API) Version() Response {
 	// over.
 	resp := a.newResponse(ResponseTypeVersion)
 	resp.Data = ResponseDataVersion{
-		Version: CurrentAPIVersion,
+		Version:             CurrentAPIVersion,
+		ReportSchemaVersion: job.ReportSchemaVersion,
 	}
 	return resp
 }
@@ -108,6 +145,9 @@ func (a *API) SendEvent(ev *Event, timeout *time.Duration) error {
 	if err := limits.NewValidator().ValidateRequestorName(string(ev.Msg.Requestor())); err != nil {
 		return err
 	}
+	if ev.RequestID == "" {
+		ev.RequestID = a.requestID
+	}
 	to := DefaultEventTimeout
 	if timeout != nil {
 		to = *timeout
@@ -123,7 +163,15 @@ func (a *API) SendEvent(ev *Event, timeout *time.Duration) error {
 // SendReceiveEvent sends an Event object on the event channel, and waits for a reply
 // from the consumer. The timeout is used once for the send, and once for the
 // receive, it's not a cumulative timeout.
-func (a *API) SendReceiveEvent(ev *Event, timeout *time.Duration) (*EventResponse, error) {
+func (a *API) SendReceiveEvent(ev *Event, timeout *time.Duration) (resp *EventResponse, err error) {
+	start := time.Now()
+	defer func() {
+		respErr := err
+		if respErr == nil && resp != nil {
+			respErr = resp.Err
+		}
+		observeRequest(ev.Type, start, respErr)
+	}()
 	to := DefaultEventTimeout
 	if timeout != nil {
 		to = *timeout
@@ -133,7 +181,6 @@ func (a *API) SendReceiveEvent(ev *Event, timeout *time.Duration) (*EventRespons
 		return nil, err
 	}
 	// receive
-	var resp *EventResponse
 	select {
 	case resp = <-ev.RespCh:
 		return resp, nil
@@ -142,6 +189,20 @@ func (a *API) SendReceiveEvent(ev *Event, timeout *time.Duration) (*EventRespons
 	}
 }
 
+// jobDescriptorJSON returns a job descriptor converted to JSON, if it is
+// YAML, see config.DetectJobDescFormat. JSON job descriptors are returned
+// unchanged.
+func jobDescriptorJSON(jobDescriptor string) (string, error) {
+	if config.DetectJobDescFormat([]byte(jobDescriptor)) == config.JobDescFormatJSON {
+		return jobDescriptor, nil
+	}
+	jobDescJSON, err := config.ParseJobDescriptor([]byte(jobDescriptor), config.JobDescFormatYAML)
+	if err != nil {
+		return "", err
+	}
+	return string(jobDescJSON), nil
+}
+
 // Start requests to create a new test job, as described by the job descriptor.
 // A job descriptor may contain multiple tests, which will be run sequentially,
 // not in parallel. If you need parallelism, you need to submit multiple
@@ -150,14 +211,19 @@ func (a *API) SendReceiveEvent(ev *Event, timeout *time.Duration) (*EventRespons
 // API), but no inter-job synchronization is implemented in the framework
 // itself. This is intentional, to avoid overcomplicating the orchestration
 // for a few edge cases.
-// Each job descriptor must be JSON-encoded, and will be deserialized in a
-// `contest.JobDescriptor` object by the JobManager.
+// Each job descriptor must be JSON or YAML-encoded, YAML ones being converted
+// to JSON, and will be deserialized in a `contest.JobDescriptor` object by the
+// JobManager.
 // This method must return a unique job ID, that can be used for various
 // operations via the API, e.g. getting the job status or stopping it.
 // This method should return an error if the job description is malformed or
 // invalid, and if the API version is incompatible.
 func (a *API) Start(requestor EventRequestor, jobDescriptor string) (Response, error) {
 	resp := a.newResponse(ResponseTypeStart)
+	jobDescriptor, err := jobDescriptorJSON(jobDescriptor)
+	if err != nil {
+		return resp, err
+	}
 	ev := &Event{
 		Type:     EventTypeStart,
 		ServerID: resp.ServerID,
@@ -178,6 +244,489 @@ func (a *API) Start(requestor EventRequestor, jobDescriptor string) (Response, e
 	return resp, nil
 }
 
+// Validate checks a job descriptor like Start does, resolving the plugins,
+// validating their parameters and fetching the tests, but starts no job and
+// acquires no target. The response lists the problems found and the tests
+// which the job would run.
+func (a *API) Validate(requestor EventRequestor, jobDescriptor string) (Response, error) {
+	resp := a.newResponse(ResponseTypeValidate)
+	jobDescriptor, err := jobDescriptorJSON(jobDescriptor)
+	if err != nil {
+		return resp, err
+	}
+	ev := &Event{
+		Type:     EventTypeValidate,
+		ServerID: resp.ServerID,
+		Msg: EventValidateMsg{
+			requestor:     requestor,
+			JobDescriptor: jobDescriptor,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	if respEv.Validation != nil {
+		resp.Data = *respEv.Validation
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// Plugins lists the plugins registered in the server, along with the events
+// which each test step may emit.
+func (a *API) Plugins(requestor EventRequestor) (Response, error) {
+	resp := a.newResponse(ResponseTypePlugins)
+	ev := &Event{
+		Type:     EventTypePlugins,
+		ServerID: resp.ServerID,
+		Msg: EventPluginsMsg{
+			requestor: requestor,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	if respEv.Plugins != nil {
+		resp.Data = *respEv.Plugins
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// Readiness checks whether the server is ready to run jobs, i.e. whether
+// the job manager is responsive and its dependencies, such as the storage
+// engine and the target locker, are reachable.
+func (a *API) Readiness(requestor EventRequestor) (Response, error) {
+	resp := a.newResponse(ResponseTypeReadiness)
+	ev := &Event{
+		Type:     EventTypeReadiness,
+		ServerID: resp.ServerID,
+		Msg: EventReadinessMsg{
+			requestor: requestor,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	if respEv.Readiness != nil {
+		resp.Data = *respEv.Readiness
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// ErrDraining is returned when starting a job on a server being drained.
+var ErrDraining = errors.New("server is draining, no job can be started")
+
+// Drain puts the server in drain mode: no job is started anymore, and the
+// server exits once the running jobs ended. If deadline is positive, the
+// jobs still running after it are paused, so that they can be resumed by
+// another server. Draining a server twice does not change its deadline.
+func (a *API) Drain(requestor EventRequestor, deadline time.Duration) (Response, error) {
+	resp := a.newResponse(ResponseTypeDrain)
+	ev := &Event{
+		Type:     EventTypeDrain,
+		ServerID: resp.ServerID,
+		Msg: EventDrainMsg{
+			requestor: requestor,
+			Deadline:  deadline,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	if respEv.Drain != nil {
+		resp.Data = *respEv.Drain
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// ErrQuotaExceeded is wrapped by the errors of the jobs which cannot lock
+// their targets, as their requestor exhausted its quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quotas returns the quotas of the requestors, and the resources their jobs
+// use.
+func (a *API) Quotas(requestor EventRequestor) (Response, error) {
+	resp := a.newResponse(ResponseTypeQuotas)
+	ev := &Event{
+		Type:     EventTypeQuotas,
+		ServerID: resp.ServerID,
+		Msg: EventQuotasMsg{
+			requestor: requestor,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	if respEv.Quotas != nil {
+		resp.Data = *respEv.Quotas
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// SetQuota sets the quota of a requestor, or the default quota of the
+// requestors without their own quota if quotaRequestor is empty, until the
+// server restarts. A nil quota makes the requestor use the default quota
+// again. The new quota applies to the jobs started and the targets locked
+// afterwards.
+func (a *API) SetQuota(requestor, quotaRequestor EventRequestor, quota *Quota) (Response, error) {
+	resp := a.newResponse(ResponseTypeQuotas)
+	ev := &Event{
+		Type:     EventTypeSetQuota,
+		ServerID: resp.ServerID,
+		Msg: EventSetQuotaMsg{
+			requestor:      requestor,
+			QuotaRequestor: quotaRequestor,
+			Quota:          quota,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	if respEv.Quotas != nil {
+		resp.Data = *respEv.Quotas
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// LogLevels returns the default log level of the server, and the levels of
+// its modules.
+func (a *API) LogLevels(requestor EventRequestor) (Response, error) {
+	return a.sendLogLevelsEvent(EventTypeLogLevels, EventLogLevelsMsg{
+		requestor: requestor,
+	})
+}
+
+// SetLogLevel sets the log level, e.g. debug, of a module of the server, or
+// the default level of the modules without their own level if module is
+// empty, until the server restarts. An empty level makes the module log at
+// the default level again.
+func (a *API) SetLogLevel(requestor EventRequestor, module, level string) (Response, error) {
+	return a.sendLogLevelsEvent(EventTypeSetLogLevel, EventSetLogLevelMsg{
+		requestor: requestor,
+		Module:    module,
+		Level:     level,
+	})
+}
+
+func (a *API) sendLogLevelsEvent(eventType EventType, msg EventMsg) (Response, error) {
+	resp := a.newResponse(ResponseTypeLogLevels)
+	ev := &Event{
+		Type:     eventType,
+		ServerID: resp.ServerID,
+		Msg:      msg,
+		RespCh:   make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	if respEv.LogLevels != nil {
+		resp.Data = *respEv.LogLevels
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// AuditLog fetches the records of the audit log matching the search, in the
+// order the calls were made. Every API call changing the state of jobs or of
+// the server is recorded, if the storage engine supports it.
+func (a *API) AuditLog(requestor EventRequestor, search AuditSearch) (Response, error) {
+	resp := a.newResponse(ResponseTypeAuditLog)
+	search.Limit = PageLimit(search.Limit)
+	ev := &Event{
+		Type:     EventTypeAuditLog,
+		ServerID: resp.ServerID,
+		Msg: EventAuditLogMsg{
+			requestor: requestor,
+			Search:    search,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	resp.Data = ResponseDataAuditLog{Records: respEv.AuditRecords, Limit: search.Limit}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// ErrNoTargets is returned when unlocking an empty list of targets.
+var ErrNoTargets = errors.New("no target to unlock")
+
+// UnlockTargets releases the locks held on the given targets by any job,
+// e.g. by jobs which crashed, so that other jobs can use the targets without
+// waiting for the locks to expire. The locks held by the jobs running on the
+// server are not released, as the jobs would lock their targets again: they
+// must be stopped instead.
+func (a *API) UnlockTargets(requestor EventRequestor, targetIDs []string) (Response, error) {
+	resp := a.newResponse(ResponseTypeUnlockTargets)
+	if len(targetIDs) == 0 {
+		return resp, ErrNoTargets
+	}
+	ev := &Event{
+		Type:     EventTypeUnlockTargets,
+		ServerID: resp.ServerID,
+		Msg: EventUnlockTargetsMsg{
+			requestor: requestor,
+			TargetIDs: targetIDs,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	resp.Data = ResponseDataUnlockTargets{Unlocked: respEv.UnlockedTargets}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// CreateSchedule creates a recurring job, which starts the job descriptor
+// every time the cron expression activates, see the cron package. The jobs
+// are started on behalf of the requestor, and can be listed by schedule.
+func (a *API) CreateSchedule(requestor EventRequestor, name, cron, jobDescriptor string) (Response, error) {
+	jobDescriptor, err := jobDescriptorJSON(jobDescriptor)
+	if err != nil {
+		return a.newResponse(ResponseTypeSchedule), err
+	}
+	return a.sendScheduleEvent(EventTypeCreateSchedule, EventCreateScheduleMsg{
+		requestor:     requestor,
+		Name:          name,
+		Cron:          cron,
+		JobDescriptor: jobDescriptor,
+	})
+}
+
+// ListSchedules lists the recurring jobs, in the order they were created.
+func (a *API) ListSchedules(requestor EventRequestor) (Response, error) {
+	resp := a.newResponse(ResponseTypeSchedules)
+	ev := &Event{
+		Type:     EventTypeListSchedules,
+		ServerID: resp.ServerID,
+		Msg: EventListSchedulesMsg{
+			requestor: requestor,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	resp.Data = ResponseDataSchedules{
+		Schedules: respEv.Schedules,
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// PauseSchedule pauses a recurring job: no job is started by it until it is
+// resumed. The jobs it already started are not affected.
+func (a *API) PauseSchedule(requestor EventRequestor, scheduleID types.ScheduleID) (Response, error) {
+	return a.sendScheduleEvent(EventTypePauseSchedule, EventPauseScheduleMsg{
+		requestor:  requestor,
+		ScheduleID: scheduleID,
+		Paused:     true,
+	})
+}
+
+// ResumeSchedule resumes a paused recurring job. If activations were missed
+// while it was paused, a single job is started at once.
+func (a *API) ResumeSchedule(requestor EventRequestor, scheduleID types.ScheduleID) (Response, error) {
+	return a.sendScheduleEvent(EventTypePauseSchedule, EventPauseScheduleMsg{
+		requestor:  requestor,
+		ScheduleID: scheduleID,
+		Paused:     false,
+	})
+}
+
+// DeleteSchedule deletes a recurring job. The jobs it already started are
+// not affected.
+func (a *API) DeleteSchedule(requestor EventRequestor, scheduleID types.ScheduleID) (Response, error) {
+	return a.sendScheduleEvent(EventTypeDeleteSchedule, EventDeleteScheduleMsg{
+		requestor:  requestor,
+		ScheduleID: scheduleID,
+	})
+}
+
+// sendScheduleEvent sends an event affecting a single schedule, which is
+// returned in the response.
+func (a *API) sendScheduleEvent(eventType EventType, msg EventMsg) (Response, error) {
+	resp := a.newResponse(ResponseTypeSchedule)
+	ev := &Event{
+		Type:     eventType,
+		ServerID: resp.ServerID,
+		Msg:      msg,
+		RespCh:   make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	if len(respEv.Schedules) > 0 {
+		resp.Data = ResponseDataSchedule{
+			Schedule: respEv.Schedules[0],
+		}
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// SaveTemplate stores a job template, the JSON encoded job.Template, or
+// replaces the template with the same name. Jobs are then started from the
+// template by name, see StartTemplate.
+func (a *API) SaveTemplate(requestor EventRequestor, template string) (Response, error) {
+	return a.sendTemplateEvent(EventTypeSaveTemplate, EventSaveTemplateMsg{
+		requestor: requestor,
+		Template:  template,
+	})
+}
+
+// ListTemplates lists the job templates, sorted by name.
+func (a *API) ListTemplates(requestor EventRequestor) (Response, error) {
+	resp := a.newResponse(ResponseTypeTemplates)
+	ev := &Event{
+		Type:     EventTypeListTemplates,
+		ServerID: resp.ServerID,
+		Msg: EventListTemplatesMsg{
+			requestor: requestor,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	resp.Data = ResponseDataTemplates{
+		Templates: respEv.Templates,
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// DeleteTemplate deletes a job template. The jobs started from it are not
+// affected.
+func (a *API) DeleteTemplate(requestor EventRequestor, name string) (Response, error) {
+	return a.sendTemplateEvent(EventTypeDeleteTemplate, EventDeleteTemplateMsg{
+		requestor: requestor,
+		Name:      name,
+	})
+}
+
+// sendTemplateEvent sends an event affecting a single template, which is
+// returned in the response.
+func (a *API) sendTemplateEvent(eventType EventType, msg EventMsg) (Response, error) {
+	resp := a.newResponse(ResponseTypeTemplate)
+	ev := &Event{
+		Type:     eventType,
+		ServerID: resp.ServerID,
+		Msg:      msg,
+		RespCh:   make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	if len(respEv.Templates) > 0 {
+		resp.Data = ResponseDataTemplate{
+			Template: respEv.Templates[0],
+		}
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// StartTemplate starts a job from a job template, whose variables are
+// replaced by the given values, or by their default values. The job is
+// started like with Start.
+func (a *API) StartTemplate(requestor EventRequestor, name string, values map[string]string) (Response, error) {
+	resp := a.newResponse(ResponseTypeStart)
+	ev := &Event{
+		Type:     EventTypeStartTemplate,
+		ServerID: resp.ServerID,
+		Msg: EventStartTemplateMsg{
+			requestor: requestor,
+			Name:      name,
+			Values:    values,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	resp.Data = ResponseDataStart{
+		JobID: respEv.JobID,
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// MaxBatchSize is the maximum number of job descriptors of a StartBatch
+// request.
+var MaxBatchSize = 1000
+
+// StartBatch requests to create several jobs at once, e.g. the nightly runs of
+// a matrix of configurations, see Start. The job descriptors are validated
+// first: if atomic is set, no job is started unless all of them are valid,
+// otherwise the valid ones are started. The response reports the job ID, or
+// the error, of each job descriptor.
+func (a *API) StartBatch(requestor EventRequestor, jobDescriptors []string, atomic bool) (Response, error) {
+	resp := a.newResponse(ResponseTypeStartBatch)
+	if len(jobDescriptors) == 0 {
+		return resp, errors.New("no job descriptor")
+	}
+	if len(jobDescriptors) > MaxBatchSize {
+		return resp, fmt.Errorf("too many job descriptors: %d, the maximum is %d", len(jobDescriptors), MaxBatchSize)
+	}
+	jsonDescriptors := make([]string, 0, len(jobDescriptors))
+	for idx, jobDescriptor := range jobDescriptors {
+		jobDescriptor, err := jobDescriptorJSON(jobDescriptor)
+		if err != nil {
+			return resp, fmt.Errorf("job descriptor #%d: %w", idx, err)
+		}
+		jsonDescriptors = append(jsonDescriptors, jobDescriptor)
+	}
+	ev := &Event{
+		Type:     EventTypeStartBatch,
+		ServerID: resp.ServerID,
+		Msg: EventStartBatchMsg{
+			requestor:      requestor,
+			JobDescriptors: jsonDescriptors,
+			Atomic:         atomic,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	// the batch is given the time of as many Start requests
+	timeout := DefaultEventTimeout * time.Duration(len(jobDescriptors))
+	respEv, err := a.SendReceiveEvent(ev, &timeout)
+	if err != nil {
+		return resp, err
+	}
+	resp.Data = ResponseDataStartBatch{
+		Jobs: respEv.BatchJobs,
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
 // Stop requests a job cancellation by the given job ID.
 func (a *API) Stop(requestor EventRequestor, jobID types.JobID) (Response, error) {
 	resp := a.newResponse(ResponseTypeStop)
@@ -199,8 +748,98 @@ func (a *API) Stop(requestor EventRequestor, jobID types.JobID) (Response, error
 	return resp, nil
 }
 
+// PauseJob requests to pause a running job. The steps of the job are asked to
+// pause, and the job does not release its targets, so that it can be resumed
+// with ResumeJob. Other jobs are not affected.
+func (a *API) PauseJob(requestor EventRequestor, jobID types.JobID) (Response, error) {
+	return a.sendPauseJobEvent(EventPauseJobMsg{
+		requestor: requestor,
+		JobID:     jobID,
+		Paused:    true,
+	})
+}
+
+// ResumeJob resumes a paused job from the run in which it was paused. The
+// steps which support it are resumed from their checkpoints, the other ones
+// run again.
+func (a *API) ResumeJob(requestor EventRequestor, jobID types.JobID) (Response, error) {
+	return a.sendPauseJobEvent(EventPauseJobMsg{
+		requestor: requestor,
+		JobID:     jobID,
+		Paused:    false,
+	})
+}
+
+// sendPauseJobEvent sends an event pausing or resuming a job, whose new state
+// is returned in the response.
+func (a *API) sendPauseJobEvent(msg EventPauseJobMsg) (Response, error) {
+	resp := a.newResponse(ResponseTypePauseJob)
+	ev := &Event{
+		Type:     EventTypePauseJob,
+		ServerID: resp.ServerID,
+		Msg:      msg,
+		RespCh:   make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	data := ResponseDataPauseJob{JobID: msg.JobID}
+	if respEv.Status != nil {
+		data.State = respEv.Status.State
+	}
+	resp.Data = data
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// ApproveJob approves a job awaiting approval, which then starts like any
+// other job. The reason is recorded along with the approval.
+func (a *API) ApproveJob(requestor EventRequestor, jobID types.JobID, reason string) (Response, error) {
+	return a.sendApproveJobEvent(EventApproveJobMsg{
+		requestor: requestor,
+		JobID:     jobID,
+		Approved:  true,
+		Reason:    reason,
+	})
+}
+
+// RejectJob rejects a job awaiting approval, which is cancelled without
+// running. The reason is recorded along with the rejection.
+func (a *API) RejectJob(requestor EventRequestor, jobID types.JobID, reason string) (Response, error) {
+	return a.sendApproveJobEvent(EventApproveJobMsg{
+		requestor: requestor,
+		JobID:     jobID,
+		Approved:  false,
+		Reason:    reason,
+	})
+}
+
+// sendApproveJobEvent sends an event approving or rejecting a job, whose new
+// state is returned in the response.
+func (a *API) sendApproveJobEvent(msg EventApproveJobMsg) (Response, error) {
+	resp := a.newResponse(ResponseTypeApproveJob)
+	ev := &Event{
+		Type:     EventTypeApproveJob,
+		ServerID: resp.ServerID,
+		Msg:      msg,
+		RespCh:   make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	data := ResponseDataApproveJob{JobID: msg.JobID}
+	if respEv.Status != nil {
+		data.State = respEv.Status.State
+	}
+	resp.Data = data
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
 // Status polls the status of a job by its ID, and returns a contest.Status
-//object
+// object
 func (a *API) Status(requestor EventRequestor, jobID types.JobID) (Response, error) {
 	resp := a.newResponse(ResponseTypeStatus)
 	ev := &Event{
@@ -224,15 +863,26 @@ func (a *API) Status(requestor EventRequestor, jobID types.JobID) (Response, err
 }
 
 // Retry will retry a job identified by its ID, using the same job
-// description. If the job is still running, an error is returned.
+// description. If the job is still running, an error is returned. It is a
+// Rerun on all the targets of the job.
 func (a *API) Retry(requestor EventRequestor, jobID types.JobID) (Response, error) {
+	return a.Rerun(requestor, jobID, false)
+}
+
+// Rerun starts a new job with the job descriptor of an ended job, on behalf
+// of the requestor. If failedTargetsOnly is set, the new job only tests the
+// targets which did not pass the ended job. The new job records the job it
+// reruns, see JobSearch.RerunOf. If the job is still running, an error is
+// returned.
+func (a *API) Rerun(requestor EventRequestor, jobID types.JobID, failedTargetsOnly bool) (Response, error) {
 	resp := a.newResponse(ResponseTypeRetry)
 	ev := &Event{
 		Type:     EventTypeRetry,
 		ServerID: resp.ServerID,
 		Msg: EventRetryMsg{
-			requestor: requestor,
-			JobID:     jobID,
+			requestor:         requestor,
+			JobID:             jobID,
+			FailedTargetsOnly: failedTargetsOnly,
 		},
 		RespCh: make(chan *EventResponse, 1),
 	}
@@ -242,9 +892,160 @@ func (a *API) Retry(requestor EventRequestor, jobID types.JobID) (Response, erro
 	}
 	resp.Data = ResponseDataRetry{
 		// this is the job ID of the job to retry, not the new job ID
-		JobID: jobID,
-		// TODO this should set the new Job ID
-		// NewJobID: ...
+		JobID:    jobID,
+		NewJobID: respEv.JobID,
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// List lists the jobs known to the server, most recent first. The limit is
+// capped, see PageLimit.
+func (a *API) List(requestor EventRequestor, limit, offset uint) (Response, error) {
+	return a.ListJobs(requestor, JobSearch{Limit: limit, Offset: offset})
+}
+
+// ListJobs lists the jobs matching a search, most recent first, e.g. the
+// failed jobs of a requestor. The limit is capped, see PageLimit.
+func (a *API) ListJobs(requestor EventRequestor, search JobSearch) (Response, error) {
+	resp := a.newResponse(ResponseTypeList)
+	search.Limit = PageLimit(search.Limit)
+	ev := &Event{
+		Type:     EventTypeList,
+		ServerID: resp.ServerID,
+		Msg: EventListMsg{
+			requestor: requestor,
+			Search:    search,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	resp.Data = ResponseDataList{
+		JobIDs: respEv.JobIDs,
+		Limit:  search.Limit,
+		Offset: search.Offset,
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// Reports fetches the reports of the jobs matching a search, most recent
+// first, e.g. the reports of the jobs tagged with a release. The limit is
+// capped, see PageLimit.
+func (a *API) Reports(requestor EventRequestor, search JobSearch) (Response, error) {
+	resp := a.newResponse(ResponseTypeReports)
+	search.Limit = PageLimit(search.Limit)
+	ev := &Event{
+		Type:     EventTypeReports,
+		ServerID: resp.ServerID,
+		Msg: EventReportsMsg{
+			requestor: requestor,
+			Search:    search,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	resp.Data = ResponseDataReports{
+		Reports: respEv.Reports,
+		Limit:   search.Limit,
+		Offset:  search.Offset,
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// History aggregates the results of the most recent jobs sharing a name, or
+// started from a template, to follow their pass rate and the duration of
+// their tests and steps over time, e.g. for regression dashboards. The limit
+// is capped, see PageLimit.
+func (a *API) History(requestor EventRequestor, search HistorySearch) (Response, error) {
+	resp := a.newResponse(ResponseTypeHistory)
+	search.Limit = PageLimit(search.Limit)
+	ev := &Event{
+		Type:     EventTypeHistory,
+		ServerID: resp.ServerID,
+		Msg: EventHistoryMsg{
+			requestor: requestor,
+			Search:    search,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	data := ResponseDataHistory{Limit: search.Limit}
+	if respEv.History != nil {
+		data.Jobs = respEv.History.Jobs
+		data.Tests = respEv.History.Tests
+	}
+	resp.Data = data
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// TestEvents fetches the test events of a job in emission order, optionally
+// only the ones of a run, test or test step if runID, testName or
+// testStepLabel are set. The limit is capped, see PageLimit.
+func (a *API) TestEvents(requestor EventRequestor, jobID types.JobID, runID types.RunID, testName, testStepLabel string, limit, offset uint) (Response, error) {
+	resp := a.newResponse(ResponseTypeTestEvents)
+	limit = PageLimit(limit)
+	ev := &Event{
+		Type:     EventTypeTestEvents,
+		ServerID: resp.ServerID,
+		Msg: EventTestEventsMsg{
+			requestor:     requestor,
+			JobID:         jobID,
+			RunID:         runID,
+			TestName:      testName,
+			TestStepLabel: testStepLabel,
+			Limit:         limit,
+			Offset:        offset,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	resp.Data = ResponseDataTestEvents{
+		Events: respEv.TestEvents,
+		Limit:  limit,
+		Offset: offset,
+	}
+	resp.Err = respEv.Err
+	return resp, nil
+}
+
+// SearchTestEvents fetches the test events matching a search in emission
+// order, e.g. to find the events of failed targets. Searches by payload
+// content require a job ID. The limit is capped, see PageLimit.
+func (a *API) SearchTestEvents(requestor EventRequestor, search TestEventSearch) (Response, error) {
+	resp := a.newResponse(ResponseTypeTestEvents)
+	search.Limit = PageLimit(search.Limit)
+	ev := &Event{
+		Type:     EventTypeSearch,
+		ServerID: resp.ServerID,
+		Msg: EventSearchMsg{
+			requestor: requestor,
+			Search:    search,
+		},
+		RespCh: make(chan *EventResponse, 1),
+	}
+	respEv, err := a.SendReceiveEvent(ev, nil)
+	if err != nil {
+		return resp, err
+	}
+	resp.Data = ResponseDataTestEvents{
+		Events: respEv.TestEvents,
+		Limit:  search.Limit,
+		Offset: search.Offset,
 	}
 	resp.Err = respEv.Err
 	return resp, nil
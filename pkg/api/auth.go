@@ -0,0 +1,120 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrUnauthenticated is returned by authenticators when a request carries no
+// credentials, or invalid ones.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Identity is the verified identity of the client of an API request.
+type Identity struct {
+	// Requestor is the requestor of the API calls made by the client, which
+	// replaces the one supplied by the client
+	Requestor EventRequestor
+	// Claims are the attributes of the client asserted by the credentials,
+	// e.g. the claims of a JWT
+	Claims map[string]interface{}
+}
+
+// Authenticator verifies the credentials of API requests. Listeners serving
+// the API over HTTP, including gRPC, use it via AuthMiddleware.
+type Authenticator interface {
+	// Authenticate returns the identity of the client of the request, or an
+	// error wrapping ErrUnauthenticated if the client cannot be
+	// authenticated.
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of the context carrying the identity.
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity carried by the context, if any.
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(*Identity)
+	return identity, ok && identity != nil
+}
+
+// RequestorFromContext returns the requestor of the verified identity carried
+// by the context, or the requestor supplied by the client if the request was
+// not authenticated.
+func RequestorFromContext(ctx context.Context, supplied string) EventRequestor {
+	if identity, ok := IdentityFromContext(ctx); ok {
+		return identity.Requestor
+	}
+	return EventRequestor(supplied)
+}
+
+// AuthMiddleware authenticates the requests before passing them to next,
+// with their identity in their context. Requests which cannot be
+// authenticated are rejected with a 401 status. If auth is nil, requests are
+// passed as they are.
+func AuthMiddleware(auth Authenticator, next http.Handler) http.Handler {
+	if auth == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := auth.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="contest"`)
+			http.Error(w, fmt.Sprintf("authentication failed: %v", err), http.StatusUnauthorized)
+			return
+		}
+		setAccessRequestor(r.Context(), identity.Requestor)
+		next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+	})
+}
+
+// Authenticators authenticates requests with the first of several
+// authenticators which succeeds, e.g. with a token if the client sends one,
+// and with its certificate otherwise. If none succeeds, the error of the last
+// one is returned.
+type Authenticators []Authenticator
+
+// Authenticate implements Authenticator.
+func (as Authenticators) Authenticate(r *http.Request) (*Identity, error) {
+	err := fmt.Errorf("%w: no authenticator", ErrUnauthenticated)
+	for _, a := range as {
+		var identity *Identity
+		if identity, err = a.Authenticate(r); err == nil {
+			return identity, nil
+		}
+	}
+	return nil, err
+}
+
+// ClientCertAuthenticator authenticates the requests made over mutual TLS,
+// using the common name of the verified client certificate as requestor.
+type ClientCertAuthenticator struct{}
+
+// Authenticate implements Authenticator.
+func (ClientCertAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, fmt.Errorf("%w: no verified client certificate", ErrUnauthenticated)
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	if cert.Subject.CommonName == "" {
+		return nil, fmt.Errorf("%w: client certificate has no common name", ErrUnauthenticated)
+	}
+	return &Identity{
+		Requestor: EventRequestor(cert.Subject.CommonName),
+		Claims: map[string]interface{}{
+			"cn":     cert.Subject.CommonName,
+			"issuer": cert.Issuer.String(),
+			"serial": cert.SerialNumber.String(),
+		},
+	}, nil
+}
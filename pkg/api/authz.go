@@ -0,0 +1,150 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// ErrForbidden is returned when a requestor lacks the permission to perform
+// an API call.
+var ErrForbidden = errors.New("forbidden")
+
+// Role is a set of permissions granted to requestors.
+type Role string
+
+// The roles known to ConTest.
+const (
+	// RoleSubmitter may submit jobs, and stop its own jobs
+	RoleSubmitter Role = "submitter"
+	// RoleOperator may also stop the jobs of others, approve jobs,
+	// force-unlock targets and read the audit log
+	RoleOperator Role = "operator"
+	// RoleAdmin may also change the state of the server, e.g. drain it
+	RoleAdmin Role = "admin"
+)
+
+// Permission is an action which requires authorization. Reading the status
+// and the events of jobs requires no permission.
+type Permission string
+
+// The permissions checked by ConTest.
+const (
+	// PermissionSubmitJobs allows starting jobs, and stopping or retrying
+	// the jobs of the same requestor
+	PermissionSubmitJobs Permission = "submit_jobs"
+	// PermissionManageAnyJob allows stopping or retrying the jobs of other
+	// requestors
+	PermissionManageAnyJob Permission = "manage_any_job"
+	// PermissionApproveJobs allows approving or rejecting the jobs which
+	// await approval
+	PermissionApproveJobs Permission = "approve_jobs"
+	// PermissionUnlockTargets allows releasing the locks held on targets by
+	// any job, see API.UnlockTargets
+	PermissionUnlockTargets Permission = "unlock_targets"
+	// PermissionManageServer allows changing the state of the server, e.g.
+	// pausing or draining it
+	PermissionManageServer Permission = "manage_server"
+	// PermissionReadAuditLog allows reading the audit log of the API calls
+	PermissionReadAuditLog Permission = "read_audit_log"
+)
+
+// RolePermissions maps the roles to the permissions they grant.
+var RolePermissions = map[Role][]Permission{
+	RoleSubmitter: {PermissionSubmitJobs},
+	RoleOperator:  {PermissionSubmitJobs, PermissionManageAnyJob, PermissionApproveJobs, PermissionUnlockTargets, PermissionReadAuditLog},
+	RoleAdmin:     {PermissionSubmitJobs, PermissionManageAnyJob, PermissionApproveJobs, PermissionUnlockTargets, PermissionReadAuditLog, PermissionManageServer},
+}
+
+// PolicyProvider returns the roles of requestors. Requestors are trusted as
+// they are, so authorization should be paired with authentication, see
+// AuthMiddleware.
+type PolicyProvider interface {
+	Roles(requestor EventRequestor) ([]Role, error)
+}
+
+// StaticPolicy is a PolicyProvider assigning roles to requestors by name,
+// and default roles to the others.
+type StaticPolicy struct {
+	Requestors map[EventRequestor][]Role `json:"requestors"`
+	Default    []Role                    `json:"default"`
+}
+
+// Roles implements PolicyProvider.
+func (p *StaticPolicy) Roles(requestor EventRequestor) ([]Role, error) {
+	if roles, ok := p.Requestors[requestor]; ok {
+		return roles, nil
+	}
+	return p.Default, nil
+}
+
+// LoadStaticPolicy reads a StaticPolicy from a JSON file, e.g.
+//
+//	{"default": ["submitter"], "requestors": {"alice": ["admin"]}}
+func LoadStaticPolicy(path string) (*StaticPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read policy file: %v", err)
+	}
+	var p StaticPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("cannot parse policy file %s: %v", path, err)
+	}
+	check := func(roles []Role) error {
+		for _, role := range roles {
+			if _, ok := RolePermissions[role]; !ok {
+				return fmt.Errorf("unknown role '%s' in policy file %s", role, path)
+			}
+		}
+		return nil
+	}
+	if err := check(p.Default); err != nil {
+		return nil, err
+	}
+	for _, roles := range p.Requestors {
+		if err := check(roles); err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+// Authorizer checks the permissions of requestors against a policy. A nil
+// Authorizer grants every permission, as when authorization is disabled.
+type Authorizer struct {
+	policy PolicyProvider
+}
+
+// NewAuthorizer returns an Authorizer enforcing the given policy.
+func NewAuthorizer(policy PolicyProvider) (*Authorizer, error) {
+	if policy == nil {
+		return nil, errors.New("policy provider cannot be nil")
+	}
+	return &Authorizer{policy: policy}, nil
+}
+
+// Authorize returns an error wrapping ErrForbidden if the requestor lacks
+// the permission.
+func (a *Authorizer) Authorize(requestor EventRequestor, permission Permission) error {
+	if a == nil {
+		return nil
+	}
+	roles, err := a.policy.Roles(requestor)
+	if err != nil {
+		return fmt.Errorf("cannot get roles of requestor %s: %v", requestor, err)
+	}
+	for _, role := range roles {
+		for _, p := range RolePermissions[role] {
+			if p == permission {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: requestor %s lacks permission %s", ErrForbidden, requestor, permission)
+}
@@ -0,0 +1,74 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package api
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorize(t *testing.T) {
+	a, err := NewAuthorizer(&StaticPolicy{
+		Requestors: map[EventRequestor][]Role{
+			"alice": {RoleAdmin},
+			"bob":   {RoleOperator},
+			"eve":   {},
+		},
+		Default: []Role{RoleSubmitter},
+	})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		requestor  EventRequestor
+		permission Permission
+		allowed    bool
+	}{
+		{"alice", PermissionManageServer, true},
+		{"bob", PermissionUnlockTargets, true},
+		{"bob", PermissionApproveJobs, true},
+		{"bob", PermissionManageServer, false},
+		{"carol", PermissionSubmitJobs, true},
+		{"carol", PermissionManageAnyJob, false},
+		{"eve", PermissionSubmitJobs, false},
+	} {
+		err := a.Authorize(tc.requestor, tc.permission)
+		if tc.allowed {
+			require.NoError(t, err, "%s: %s", tc.requestor, tc.permission)
+		} else {
+			require.True(t, errors.Is(err, ErrForbidden), "%s: %s: %v", tc.requestor, tc.permission, err)
+		}
+	}
+
+	// a nil authorizer allows everything
+	var none *Authorizer
+	require.NoError(t, none.Authorize("eve", PermissionManageServer))
+}
+
+func TestLoadStaticPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "contest-authz")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "policy.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"default": ["submitter"], "requestors": {"alice": ["admin"]}}`), 0600))
+	p, err := LoadStaticPolicy(path)
+	require.NoError(t, err)
+	roles, err := p.Roles("alice")
+	require.NoError(t, err)
+	require.Equal(t, []Role{RoleAdmin}, roles)
+	roles, err = p.Roles("bob")
+	require.NoError(t, err)
+	require.Equal(t, []Role{RoleSubmitter}, roles)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"requestors": {"alice": ["root"]}}`), 0600))
+	_, err = LoadStaticPolicy(path)
+	require.Error(t, err)
+}
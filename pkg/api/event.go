@@ -6,6 +6,10 @@
 package api
 
 import (
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
 	"github.com/facebookincubator/contest/pkg/job"
 	"github.com/facebookincubator/contest/pkg/types"
 )
@@ -27,11 +31,37 @@ func (e EventType) String() string {
 }
 
 var eventTypeNames = map[EventType]string{
-	EventTypeStart:  "event_type_start",
-	EventTypeStatus: "event_type_status",
-	EventTypeStop:   "event_type_stop",
-	EventTypeRetry:  "event_type_retry",
-	EventTypeError:  "event_type_error",
+	EventTypeStart:          "event_type_start",
+	EventTypeStatus:         "event_type_status",
+	EventTypeStop:           "event_type_stop",
+	EventTypeRetry:          "event_type_retry",
+	EventTypeError:          "event_type_error",
+	EventTypeList:           "event_type_list",
+	EventTypeTestEvents:     "event_type_test_events",
+	EventTypeSearch:         "event_type_search",
+	EventTypeStartBatch:     "event_type_start_batch",
+	EventTypeValidate:       "event_type_validate",
+	EventTypePlugins:        "event_type_plugins",
+	EventTypeReadiness:      "event_type_readiness",
+	EventTypeDrain:          "event_type_drain",
+	EventTypeCreateSchedule: "event_type_create_schedule",
+	EventTypeListSchedules:  "event_type_list_schedules",
+	EventTypePauseSchedule:  "event_type_pause_schedule",
+	EventTypeDeleteSchedule: "event_type_delete_schedule",
+	EventTypeSaveTemplate:   "event_type_save_template",
+	EventTypeListTemplates:  "event_type_list_templates",
+	EventTypeDeleteTemplate: "event_type_delete_template",
+	EventTypeStartTemplate:  "event_type_start_template",
+	EventTypeReports:        "event_type_reports",
+	EventTypePauseJob:       "event_type_pause_job",
+	EventTypeApproveJob:     "event_type_approve_job",
+	EventTypeHistory:        "event_type_history",
+	EventTypeQuotas:         "event_type_quotas",
+	EventTypeSetQuota:       "event_type_set_quota",
+	EventTypeLogLevels:      "event_type_log_levels",
+	EventTypeSetLogLevel:    "event_type_set_log_level",
+	EventTypeAuditLog:       "event_type_audit_log",
+	EventTypeUnlockTargets:  "event_type_unlock_targets",
 }
 
 // list of existing API event types.
@@ -41,6 +71,32 @@ const (
 	EventTypeStop
 	EventTypeRetry
 	EventTypeError
+	EventTypeList
+	EventTypeTestEvents
+	EventTypeSearch
+	EventTypeStartBatch
+	EventTypeValidate
+	EventTypePlugins
+	EventTypeReadiness
+	EventTypeDrain
+	EventTypeCreateSchedule
+	EventTypeListSchedules
+	EventTypePauseSchedule
+	EventTypeDeleteSchedule
+	EventTypeSaveTemplate
+	EventTypeListTemplates
+	EventTypeDeleteTemplate
+	EventTypeStartTemplate
+	EventTypeReports
+	EventTypePauseJob
+	EventTypeApproveJob
+	EventTypeHistory
+	EventTypeQuotas
+	EventTypeSetQuota
+	EventTypeLogLevels
+	EventTypeSetLogLevel
+	EventTypeAuditLog
+	EventTypeUnlockTargets
 )
 
 // Event represents an event that the API can generate. This is used by the API
@@ -48,8 +104,10 @@ const (
 type Event struct {
 	Type     EventType
 	ServerID string
-	Err      error
-	Msg      EventMsg
+	// RequestID is the ID of the request which made the call, if any
+	RequestID string
+	Err       error
+	Msg       EventMsg
 	// RespCh is a channel where the JobManager can send the responses back to
 	// what generated the event. E.g. if a job status is requested, the answer
 	// goes back to the caller in an EventResponse via this channel.
@@ -74,6 +132,211 @@ type EventStartMsg struct {
 // Requestor returns the requestor of the API call as reported by the client.
 func (e EventStartMsg) Requestor() EventRequestor { return e.requestor }
 
+// EventValidateMsg contains the arguments for an event of type Validate.
+type EventValidateMsg struct {
+	requestor     EventRequestor
+	JobDescriptor string
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventValidateMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventPluginsMsg contains the arguments for an event of type Plugins.
+type EventPluginsMsg struct {
+	requestor EventRequestor
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventPluginsMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventReadinessMsg contains the arguments for an event of type Readiness.
+type EventReadinessMsg struct {
+	requestor EventRequestor
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventReadinessMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventDrainMsg contains the arguments for an event of type Drain. The jobs
+// still running after Deadline are paused, if it is positive.
+type EventDrainMsg struct {
+	requestor EventRequestor
+	Deadline  time.Duration
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventDrainMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventQuotasMsg contains the arguments for an event of type Quotas.
+type EventQuotasMsg struct {
+	requestor EventRequestor
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventQuotasMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventSetQuotaMsg contains the arguments for an event of type SetQuota. It
+// sets the quota of QuotaRequestor, or the default quota if QuotaRequestor is
+// empty. A nil Quota makes QuotaRequestor use the default quota again.
+type EventSetQuotaMsg struct {
+	requestor      EventRequestor
+	QuotaRequestor EventRequestor
+	Quota          *Quota
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventSetQuotaMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventLogLevelsMsg contains the arguments for an event of type LogLevels.
+type EventLogLevelsMsg struct {
+	requestor EventRequestor
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventLogLevelsMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventSetLogLevelMsg contains the arguments for an event of type
+// SetLogLevel. It sets the log level of Module, or the default level if
+// Module is empty. An empty Level makes Module log at the default level
+// again.
+type EventSetLogLevelMsg struct {
+	requestor EventRequestor
+	Module    string
+	Level     string
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventSetLogLevelMsg) Requestor() EventRequestor { return e.requestor }
+
+// AuditSearch defines the records returned by an audit log request. Fields
+// only restrict the records if set: AuditRequestor selects the calls of a
+// requestor, Action the calls of a type, e.g. stop, JobID the calls affecting
+// a job, and StartTime and EndTime bound the time of the calls.
+type AuditSearch struct {
+	AuditRequestor EventRequestor
+	Action         string
+	JobID          types.JobID
+	StartTime      time.Time
+	EndTime        time.Time
+	Limit          uint
+	Offset         uint
+}
+
+// EventAuditLogMsg is the message of a request fetching the records of the
+// audit log.
+type EventAuditLogMsg struct {
+	requestor EventRequestor
+	Search    AuditSearch
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventAuditLogMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventUnlockTargetsMsg contains the arguments for an event of type
+// UnlockTargets.
+type EventUnlockTargetsMsg struct {
+	requestor EventRequestor
+	TargetIDs []string
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventUnlockTargetsMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventCreateScheduleMsg contains the arguments for an event of type
+// CreateSchedule.
+type EventCreateScheduleMsg struct {
+	requestor     EventRequestor
+	Name          string
+	Cron          string
+	JobDescriptor string
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventCreateScheduleMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventListSchedulesMsg contains the arguments for an event of type
+// ListSchedules.
+type EventListSchedulesMsg struct {
+	requestor EventRequestor
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventListSchedulesMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventPauseScheduleMsg contains the arguments for an event of type
+// PauseSchedule, which pauses the schedule if Paused is set, and resumes it
+// otherwise.
+type EventPauseScheduleMsg struct {
+	requestor  EventRequestor
+	ScheduleID types.ScheduleID
+	Paused     bool
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventPauseScheduleMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventDeleteScheduleMsg contains the arguments for an event of type
+// DeleteSchedule.
+type EventDeleteScheduleMsg struct {
+	requestor  EventRequestor
+	ScheduleID types.ScheduleID
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventDeleteScheduleMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventSaveTemplateMsg contains the arguments for an event of type
+// SaveTemplate.
+type EventSaveTemplateMsg struct {
+	requestor EventRequestor
+	Template  string
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventSaveTemplateMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventListTemplatesMsg contains the arguments for an event of type
+// ListTemplates.
+type EventListTemplatesMsg struct {
+	requestor EventRequestor
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventListTemplatesMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventDeleteTemplateMsg contains the arguments for an event of type
+// DeleteTemplate.
+type EventDeleteTemplateMsg struct {
+	requestor EventRequestor
+	Name      string
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventDeleteTemplateMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventStartTemplateMsg contains the arguments for an event of type
+// StartTemplate.
+type EventStartTemplateMsg struct {
+	requestor EventRequestor
+	Name      string
+	Values    map[string]string
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventStartTemplateMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventStartBatchMsg contains the arguments for an event of type StartBatch.
+// If Atomic is set, no job is started unless all the job descriptors are
+// valid.
+type EventStartBatchMsg struct {
+	requestor      EventRequestor
+	JobDescriptors []string
+	Atomic         bool
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventStartBatchMsg) Requestor() EventRequestor { return e.requestor }
+
 // EventStatusMsg contains the arguments for an event of type Status.
 type EventStatusMsg struct {
 	requestor EventRequestor
@@ -92,19 +355,183 @@ type EventStopMsg struct {
 // Requestor returns the requestor of the API call as reported by the client.
 func (e EventStopMsg) Requestor() EventRequestor { return e.requestor }
 
-// EventRetryMsg contains the arguments for an event of type Retry.
-type EventRetryMsg struct {
+// EventPauseJobMsg contains the arguments for an event of type PauseJob,
+// which pauses the job if Paused is set, and resumes it otherwise.
+type EventPauseJobMsg struct {
 	requestor EventRequestor
 	JobID     types.JobID
+	Paused    bool
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventPauseJobMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventApproveJobMsg contains the arguments for an event of type ApproveJob,
+// which approves the job if Approved is set, and rejects it otherwise.
+type EventApproveJobMsg struct {
+	requestor EventRequestor
+	JobID     types.JobID
+	Approved  bool
+	Reason    string
+}
+
+// Requestor returns the requestor of the API call as reported by the client.
+func (e EventApproveJobMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventRetryMsg contains the arguments for an event of type Retry, which
+// reruns the job only on the targets which did not pass it if
+// FailedTargetsOnly is set.
+type EventRetryMsg struct {
+	requestor         EventRequestor
+	JobID             types.JobID
+	FailedTargetsOnly bool
 }
 
 // Requestor returns the requestor of the API call as reported by the client.
 func (e EventRetryMsg) Requestor() EventRequestor { return e.requestor }
 
 // EventResponse is a response to an EventMsg.
+// JobSearch defines the jobs returned by a list request. Zero fields are
+// ignored. JobRequestor selects the jobs of a requestor, States the jobs whose
+// current state is one of the given job state events, e.g. JobStateCompleted,
+// Tags the jobs having all the given tags, RequestedAfter and RequestedBefore
+// bound the request time of the jobs, NameContains selects the jobs whose
+// name contains the given string, ScheduleID the jobs started by a schedule,
+// RetryOf the retries of a job, and RerunOf its reruns.
+type JobSearch struct {
+	JobRequestor    EventRequestor
+	States          []string
+	Tags            []string
+	RequestedAfter  time.Time
+	RequestedBefore time.Time
+	NameContains    string
+	ScheduleID      types.ScheduleID
+	RetryOf         types.JobID
+	RerunOf         types.JobID
+	Limit           uint
+	Offset          uint
+}
+
+// EventListMsg is the message of a request listing jobs, most recent first.
+type EventListMsg struct {
+	requestor EventRequestor
+	Search    JobSearch
+}
+
+func (e EventListMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventReportsMsg is the message of a request fetching the reports of the
+// jobs matching a search, most recent first.
+type EventReportsMsg struct {
+	requestor EventRequestor
+	Search    JobSearch
+}
+
+func (e EventReportsMsg) Requestor() EventRequestor { return e.requestor }
+
+// HistorySearch defines the jobs whose results are aggregated by a history
+// request: the jobs named JobName, or the jobs started from the template
+// named Template, whatever the values given to its variables. Exactly one of
+// them must be set. The other fields restrict the jobs like the ones of
+// JobSearch, and Limit is the number of most recent jobs aggregated. Only the
+// jobs which ended are aggregated, as the results of the other ones are
+// partial.
+type HistorySearch struct {
+	JobName         string
+	Template        string
+	Tags            []string
+	RequestedAfter  time.Time
+	RequestedBefore time.Time
+	Limit           uint
+}
+
+// EventHistoryMsg is the message of a request aggregating the results of the
+// jobs sharing a name or a template.
+type EventHistoryMsg struct {
+	requestor EventRequestor
+	Search    HistorySearch
+}
+
+func (e EventHistoryMsg) Requestor() EventRequestor { return e.requestor }
+
+// EventTestEventsMsg is the message of a request fetching the test events of a
+// job, optionally only the ones of a run, test or test step.
+type EventTestEventsMsg struct {
+	requestor     EventRequestor
+	JobID         types.JobID
+	RunID         types.RunID
+	TestName      string
+	TestStepLabel string
+	Limit         uint
+	Offset        uint
+}
+
+func (e EventTestEventsMsg) Requestor() EventRequestor { return e.requestor }
+
+// TestEventSearch defines the test events returned by a search request. Zero
+// fields are ignored. PayloadContains selects the events whose payload
+// contains the given string, and PayloadPath and PayloadValue the ones whose
+// payload holds the given value at the given JSON path, see
+// testevent.PayloadMatch.
+type TestEventSearch struct {
+	JobID            types.JobID
+	RunID            types.RunID
+	TestName         string
+	TestStepLabel    string
+	EventNames       []event.Name
+	TargetID         string
+	EmittedStartTime time.Time
+	EmittedEndTime   time.Time
+	PayloadContains  string
+	PayloadPath      string
+	PayloadValue     string
+	Limit            uint
+	Offset           uint
+}
+
+// EventSearchMsg is the message of a request searching test events.
+type EventSearchMsg struct {
+	requestor EventRequestor
+	Search    TestEventSearch
+}
+
+func (e EventSearchMsg) Requestor() EventRequestor { return e.requestor }
+
 type EventResponse struct {
 	Requestor EventRequestor
 	JobID     types.JobID
 	Err       error
 	Status    *job.Status
+	// JobIDs is set in response to list requests
+	JobIDs []types.JobID
+	// BatchJobs is set in response to start batch requests
+	BatchJobs []BatchJob
+	// Validation is set in response to validate requests
+	Validation *ResponseDataValidate
+	// Plugins is set in response to plugins requests
+	Plugins *ResponseDataPlugins
+	// Readiness is set in response to readiness requests
+	Readiness *ResponseDataReadiness
+	// Drain is set in response to drain requests
+	Drain *ResponseDataDrain
+	// Schedules is set in response to schedule requests. It holds the
+	// affected schedule, if a single one is.
+	Schedules []Schedule
+	// Templates is set in response to template requests. It holds the
+	// affected template, if a single one is.
+	Templates []JobTemplate
+	// TestEvents is set in response to test events and search requests
+	TestEvents []testevent.Event
+	// Reports is set in response to reports requests
+	Reports []*job.JobReport
+	// History is set in response to history requests
+	History *ResponseDataHistory
+	// Quotas is set in response to quota requests
+	Quotas *ResponseDataQuotas
+	// LogLevels is set in response to log level requests
+	LogLevels *ResponseDataLogLevels
+	// AuditRecords is set in response to audit log requests
+	AuditRecords []AuditRecord
+	// UnlockedTargets is set in response to unlock targets requests
+	UnlockedTargets map[string]types.JobID
 }
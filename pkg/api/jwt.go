@@ -0,0 +1,363 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/logging"
+)
+
+var log = logging.GetLogger("pkg/api")
+
+// DefaultJWKSRefreshInterval is the minimum interval between two fetches of
+// the signing keys of an issuer.
+const DefaultJWKSRefreshInterval = 5 * time.Minute
+
+// DefaultClockSkew is the tolerance applied when checking the validity
+// period of tokens.
+const DefaultClockSkew = time.Minute
+
+// OIDCConfig configures a JWTAuthenticator validating the tokens of an OpenID
+// Connect issuer.
+type OIDCConfig struct {
+	// Issuer is the URL of the issuer, which must match the iss claim. Its
+	// signing keys are discovered via /.well-known/openid-configuration,
+	// unless JWKSURL is set.
+	Issuer string
+	// Audience, if set, must be one of the aud claims, e.g. the client ID of
+	// ConTest at the issuer.
+	Audience string
+	// RequestorClaim is the claim used as requestor, "sub" if empty. It must
+	// be a string, e.g. "email" or "preferred_username".
+	RequestorClaim string
+	// JWKSURL overrides the URL of the signing keys of the issuer
+	JWKSURL string
+	// HTTPClient is used to fetch the discovery document and the keys,
+	// http.DefaultClient if nil
+	HTTPClient *http.Client
+	// RefreshInterval is the minimum interval between two fetches of the
+	// keys, DefaultJWKSRefreshInterval if 0. Keys are fetched when a token is
+	// signed with an unknown key.
+	RefreshInterval time.Duration
+}
+
+// JWTAuthenticator authenticates the requests bearing a JWT signed by an
+// OpenID Connect issuer, in the Authorization header. RS256, RS384, RS512,
+// ES256, ES384 and ES512 signatures are supported.
+type JWTAuthenticator struct {
+	config OIDCConfig
+	now    func() time.Time
+
+	lock        sync.Mutex
+	jwksURL     string
+	keys        map[string]crypto.PublicKey
+	lastRefresh time.Time
+}
+
+// NewOIDCAuthenticator returns an authenticator validating the tokens of the
+// configured issuer. The keys of the issuer are fetched on first use, so
+// that ConTest can start while the issuer is unreachable.
+func NewOIDCAuthenticator(config OIDCConfig) (*JWTAuthenticator, error) {
+	if config.Issuer == "" {
+		return nil, errors.New("OIDC issuer cannot be empty")
+	}
+	if config.RequestorClaim == "" {
+		config.RequestorClaim = "sub"
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = http.DefaultClient
+	}
+	if config.RefreshInterval == 0 {
+		config.RefreshInterval = DefaultJWKSRefreshInterval
+	}
+	return &JWTAuthenticator{config: config, now: time.Now, jwksURL: config.JWKSURL}, nil
+}
+
+// Authenticate implements Authenticator.
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) < 7 || !strings.EqualFold(authorization[:7], "Bearer ") {
+		return nil, fmt.Errorf("%w: missing bearer token", ErrUnauthenticated)
+	}
+	claims, err := a.Verify(strings.TrimSpace(authorization[7:]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+	requestor, _ := claims[a.config.RequestorClaim].(string)
+	if requestor == "" {
+		return nil, fmt.Errorf("%w: token has no %s claim", ErrUnauthenticated, a.config.RequestorClaim)
+	}
+	return &Identity{Requestor: EventRequestor(requestor), Claims: claims}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Verify checks the signature and the claims of a token, and returns its
+// claims.
+func (a *JWTAuthenticator) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %v", err)
+	}
+	key, err := a.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %v", err)
+	}
+	if err := a.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (a *JWTAuthenticator) checkClaims(claims map[string]interface{}) error {
+	if iss, _ := claims["iss"].(string); iss != a.config.Issuer {
+		return fmt.Errorf("unexpected issuer '%s'", iss)
+	}
+	if a.config.Audience != "" {
+		var found bool
+		switch aud := claims["aud"].(type) {
+		case string:
+			found = aud == a.config.Audience
+		case []interface{}:
+			for _, v := range aud {
+				if v == a.config.Audience {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("token is not intended for audience '%s'", a.config.Audience)
+		}
+	}
+	now := a.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token has no expiration time")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(DefaultClockSkew)) {
+		return errors.New("token is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(DefaultClockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token is not valid yet")
+	}
+	return nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported signature algorithm '%s'", alg)
+	}
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signature algorithm '%s'", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("algorithm '%s' does not match RSA key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, signature); err != nil {
+			return errors.New("invalid token signature")
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return fmt.Errorf("algorithm '%s' does not match EC key", alg)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid token signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+	return nil
+}
+
+// key returns the signing key with the given ID, refreshing the keys of the
+// issuer if it is unknown.
+func (a *JWTAuthenticator) key(kid string) (crypto.PublicKey, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+	if a.now().Sub(a.lastRefresh) < a.config.RefreshInterval {
+		return nil, fmt.Errorf("unknown signing key '%s'", kid)
+	}
+	a.lastRefresh = a.now()
+	keys, err := a.fetchKeys()
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch signing keys: %v", err)
+	}
+	a.keys = keys
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key '%s'", kid)
+}
+
+func (a *JWTAuthenticator) getJSON(url string, v interface{}) error {
+	resp, err := a.config.HTTPClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// fetchKeys fetches the signing keys of the issuer, discovering their URL
+// first if needed. It must be called with the lock held.
+func (a *JWTAuthenticator) fetchKeys() (map[string]crypto.PublicKey, error) {
+	if a.jwksURL == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := a.getJSON(strings.TrimSuffix(a.config.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, fmt.Errorf("OIDC discovery failed: %v", err)
+		}
+		if discovery.Issuer != a.config.Issuer {
+			return nil, fmt.Errorf("OIDC discovery returned issuer '%s', expected '%s'", discovery.Issuer, a.config.Issuer)
+		}
+		if discovery.JWKSURI == "" {
+			return nil, errors.New("OIDC discovery returned no jwks_uri")
+		}
+		a.jwksURL = discovery.JWKSURI
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := a.getJSON(a.jwksURL, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Warningf("Ignoring signing key '%s' of %s: %v", jwk.Kid, a.config.Issuer, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+// jsonWebKey is a public key of a JWK set, see RFC 7517.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC keys
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %v", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %v", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %v", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type '%s'", k.Kty)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+type testIssuer struct {
+	server *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+	// jwksFetches counts the fetches of the keys
+	jwksFetches int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	issuer := &testIssuer{rsaKey: rsaKey, ecKey: ecKey}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   issuer.server.URL,
+			"jwks_uri": issuer.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		issuer.jwksFetches++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		}})
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+func (i *testIssuer) token(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	if alg == "ES256" {
+		r, s, err := ecdsa.Sign(rand.Reader, i.ecKey, digest[:])
+		require.NoError(t, err)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	} else {
+		signature, err = rsa.SignPKCS1v15(rand.Reader, i.rsaKey, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	}
+	return signed + "." + b64(signature)
+}
+
+func (i *testIssuer) claims(overrides map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"iss":   i.server.URL,
+		"aud":   []string{"contest"},
+		"sub":   "1234",
+		"email": "user@example.com",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(claims, k)
+		} else {
+			claims[k] = v
+		}
+	}
+	return claims
+}
+
+// tamper returns the first token with the payload of the second one.
+func tamper(token, other string) string {
+	parts, otherParts := strings.Split(token, "."), strings.Split(other, ".")
+	return parts[0] + "." + otherParts[1] + "." + parts[2]
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	issuer := newTestIssuer(t)
+	auth, err := NewOIDCAuthenticator(OIDCConfig{Issuer: issuer.server.URL, Audience: "contest", RequestorClaim: "email"})
+	require.NoError(t, err)
+
+	authenticate := func(token string) (*Identity, error) {
+		r := httptest.NewRequest(http.MethodPost, "/status", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return auth.Authenticate(r)
+	}
+
+	for _, alg := range []string{"RS256", "ES256"} {
+		kid := "rsa"
+		if alg == "ES256" {
+			kid = "ec"
+		}
+		identity, err := authenticate(issuer.token(t, alg, kid, issuer.claims(nil)))
+		require.NoError(t, err, alg)
+		require.Equal(t, EventRequestor("user@example.com"), identity.Requestor)
+		require.Equal(t, "1234", identity.Claims["sub"])
+	}
+	// keys are fetched once
+	require.Equal(t, 1, issuer.jwksFetches)
+
+	for name, token := range map[string]string{
+		"no token":         "",
+		"malformed":        "not.a.jwt",
+		"expired":          issuer.token(t, "RS256", "rsa", issuer.claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"no expiration":    issuer.token(t, "RS256", "rsa", issuer.claims(map[string]interface{}{"exp": nil})),
+		"not yet valid":    issuer.token(t, "RS256", "rsa", issuer.claims(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()})),
+		"other issuer":     issuer.token(t, "RS256", "rsa", issuer.claims(map[string]interface{}{"iss": "https://example.com"})),
+		"other audience":   issuer.token(t, "RS256", "rsa", issuer.claims(map[string]interface{}{"aud": "other"})),
+		"no requestor":     issuer.token(t, "RS256", "rsa", issuer.claims(map[string]interface{}{"email": nil})),
+		"algorithm none":   issuer.token(t, "none", "rsa", issuer.claims(nil)),
+		"key mismatch":     issuer.token(t, "ES256", "rsa", issuer.claims(nil)),
+		"bad signature":    tamper(issuer.token(t, "RS256", "rsa", issuer.claims(nil)), issuer.token(t, "RS256", "rsa", issuer.claims(map[string]interface{}{"email": "admin@example.com"}))),
+		"unknown key":      issuer.token(t, "RS256", "other", issuer.claims(nil)),
+		"tampered payload": issuer.token(t, "RS256", "rsa", issuer.claims(nil)) + "x",
+	} {
+		_, err := authenticate(token)
+		require.Error(t, err, name)
+		require.True(t, errors.Is(err, ErrUnauthenticated), name)
+	}
+	// unknown keys do not trigger a fetch within the refresh interval
+	require.Equal(t, 1, issuer.jwksFetches)
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	issuer := newTestIssuer(t)
+	auth, err := NewOIDCAuthenticator(OIDCConfig{Issuer: issuer.server.URL})
+	require.NoError(t, err)
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(RequestorFromContext(r.Context(), r.FormValue("requestor"))))
+	})
+	handler := AuthMiddleware(auth, echo)
+
+	r := httptest.NewRequest(http.MethodGet, "/status?requestor=spoofed", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+
+	r.Header.Set("Authorization", "Bearer "+issuer.token(t, "RS256", "rsa", issuer.claims(nil)))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "1234", w.Body.String())
+
+	// without authenticator, the requestor supplied by the client is used
+	w = httptest.NewRecorder()
+	AuthMiddleware(nil, echo).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status?requestor=client", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "client", w.Body.String())
+}
@@ -15,3 +15,37 @@ type Listener interface {
 	// shutdown.
 	Serve(<-chan struct{}, *API) error
 }
+
+// Listeners serves the API on several listeners at once, e.g. HTTP and gRPC.
+// When one of them terminates, or upon cancellation, the others are shut down
+// too, and the first error is returned.
+type Listeners []Listener
+
+// Serve implements the Listener interface.
+func (ls Listeners) Serve(cancel <-chan struct{}, a *API) error {
+	var (
+		errCh = make(chan error, len(ls))
+		stop  = make(chan struct{})
+	)
+	for _, l := range ls {
+		go func(l Listener) {
+			errCh <- l.Serve(stop, a)
+		}(l)
+	}
+	var (
+		err     error
+		pending = len(ls)
+	)
+	select {
+	case err = <-errCh:
+		pending--
+	case <-cancel:
+	}
+	close(stop)
+	for ; pending > 0; pending-- {
+		if listenerErr := <-errCh; err == nil {
+			err = listenerErr
+		}
+	}
+	return err
+}
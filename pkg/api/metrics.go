@@ -0,0 +1,46 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package api
+
+import (
+	"expvar"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/metrics"
+)
+
+// apiMetrics are published via expvar, as "contest_api". Counters are:
+//
+// * requests: API calls handled by the job manager, by type
+// * request_errors: the calls which failed, by type
+// * rate_limited: API calls rejected by the rate limiter
+//
+// The histogram request_seconds is the latency of the calls, by type.
+var apiMetrics = expvar.NewMap("contest_api")
+
+var (
+	requests       = metrics.NewCounterVec("type")
+	requestErrors  = metrics.NewCounterVec("type")
+	requestLatency = metrics.NewHistogramVec("type", metrics.DefaultLatencyBuckets)
+)
+
+func init() {
+	apiMetrics.Set("requests", requests)
+	apiMetrics.Set("request_errors", requestErrors)
+	apiMetrics.Set("request_seconds", requestLatency)
+}
+
+// observeRequest records the outcome of an API call of the given type, which
+// started at the given time.
+func observeRequest(eventType EventType, start time.Time, err error) {
+	name := strings.TrimPrefix(eventType.String(), "event_type_")
+	requests.Add(name, 1)
+	if err != nil {
+		requestErrors.Add(name, 1)
+	}
+	requestLatency.Observe(name, time.Since(start).Seconds())
+}
@@ -0,0 +1,176 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package api
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrLimitExceeded is wrapped by the errors returned when a requestor
+// exceeds a limit, e.g. makes too many API calls or runs too many jobs.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// LimitError is returned when a requestor exceeds a limit. It tells when the
+// call may be retried.
+type LimitError struct {
+	// Limit describes the exceeded limit
+	Limit string
+	// RetryAfter is the time to wait before retrying the call
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v: %s, retry after %s", ErrLimitExceeded, e.Limit, e.RetryAfter)
+}
+
+// Unwrap returns ErrLimitExceeded.
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// RetryAfter returns the time to wait before retrying a call which failed
+// with the error, if the error wraps a LimitError.
+func RetryAfter(err error) (time.Duration, bool) {
+	var le *LimitError
+	if errors.As(err, &le) {
+		return le.RetryAfter, true
+	}
+	return 0, false
+}
+
+// RetryAfterSeconds returns a delay as the value of a Retry-After HTTP header,
+// i.e. in whole seconds, rounded up.
+func RetryAfterSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// maxBuckets is the number of requestors whose buckets are kept. Above it,
+// the buckets of the requestors which did not call the API for the longest
+// time are dropped.
+const maxBuckets = 10000
+
+type bucket struct {
+	requestor EventRequestor
+	tokens    float64
+	last      time.Time
+}
+
+// RateLimiter limits the rate of the API calls of each requestor with a token
+// bucket: a requestor may make up to Burst calls at once, and Rate calls per
+// second on average.
+type RateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[EventRequestor]*list.Element
+	// lru holds the buckets, from the least to the most recently used
+	lru *list.List
+}
+
+// NewRateLimiter returns a RateLimiter allowing rate calls per second, with
+// bursts of up to burst calls.
+func NewRateLimiter(rate float64, burst int) (*RateLimiter, error) {
+	if rate <= 0 {
+		return nil, fmt.Errorf("rate must be positive, got %v", rate)
+	}
+	if burst < 1 {
+		return nil, fmt.Errorf("burst must be at least 1, got %d", burst)
+	}
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[EventRequestor]*list.Element),
+		lru:     list.New(),
+	}, nil
+}
+
+// Allow consumes a call of the requestor, or returns a LimitError if the
+// requestor made too many calls. A nil RateLimiter allows every call.
+func (l *RateLimiter) Allow(requestor EventRequestor) error {
+	if l == nil {
+		return nil
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var b *bucket
+	if e, ok := l.buckets[requestor]; ok {
+		b = e.Value.(*bucket)
+		l.lru.MoveToBack(e)
+	} else {
+		if l.lru.Len() >= maxBuckets {
+			oldest := l.lru.Remove(l.lru.Front()).(*bucket)
+			delete(l.buckets, oldest.requestor)
+		}
+		b = &bucket{requestor: requestor, tokens: l.burst, last: now}
+		l.buckets[requestor] = l.lru.PushBack(b)
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		apiMetrics.Add("rate_limited", 1)
+		return &LimitError{
+			Limit:      fmt.Sprintf("requestor %s exceeded %v calls per second", requestor, l.rate),
+			RetryAfter: time.Duration((1 - b.tokens) / l.rate * float64(time.Second)),
+		}
+	}
+	b.tokens--
+	return nil
+}
+
+// requestKey returns the requestor whose budget is consumed by the request:
+// the authenticated requestor, or the host of the client for requests which
+// were not authenticated, as the requestors they supply cannot be trusted.
+func requestKey(r *http.Request) EventRequestor {
+	if identity, ok := IdentityFromContext(r.Context()); ok {
+		return identity.Requestor
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return EventRequestor("host:" + host)
+}
+
+// RateLimitMiddleware rate-limits the requests before passing them to next.
+// It must wrap next inside AuthMiddleware, so that the requests are counted
+// against the authenticated requestor. Requests over the limit are rejected
+// with a 429 status, a Retry-After header, and a JSON body with the error
+// message and the number of seconds to wait. If limiter is nil, requests are
+// passed as they are.
+func RateLimitMiddleware(limiter *RateLimiter, next http.Handler) http.Handler {
+	if limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := limiter.Allow(requestKey(r))
+		if err == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		retryAfter, _ := RetryAfter(err)
+		seconds := RetryAfterSeconds(retryAfter)
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_ = json.NewEncoder(w).Encode(struct {
+			Msg        string
+			RetryAfter int
+		}{Msg: err.Error(), RetryAfter: seconds})
+	})
+}
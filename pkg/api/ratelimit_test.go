@@ -0,0 +1,92 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l, err := NewRateLimiter(2, 3)
+	require.NoError(t, err)
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Allow("alice"))
+	}
+	err = l.Allow("alice")
+	require.True(t, errors.Is(err, ErrLimitExceeded))
+	retryAfter, ok := RetryAfter(err)
+	require.True(t, ok)
+	require.Equal(t, 500*time.Millisecond, retryAfter)
+
+	// requestors have separate budgets
+	require.NoError(t, l.Allow("bob"))
+
+	now = now.Add(retryAfter)
+	require.NoError(t, l.Allow("alice"))
+	require.Error(t, l.Allow("alice"))
+
+	// a nil limiter allows everything
+	var none *RateLimiter
+	require.NoError(t, none.Allow("alice"))
+
+	_, err = NewRateLimiter(0, 1)
+	require.Error(t, err)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	l, err := NewRateLimiter(0.5, 1)
+	require.NoError(t, err)
+	h := RateLimitMiddleware(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	get := func(requestor string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status?requestor="+requestor, nil))
+		return w
+	}
+	require.Equal(t, http.StatusOK, get("alice").Code)
+	w := get("alice")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "2", w.Header().Get("Retry-After"))
+	var body struct {
+		Msg        string
+		RetryAfter int
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, 2, body.RetryAfter)
+	require.Contains(t, body.Msg, "host:192.0.2.1")
+
+	// the requestors supplied by anonymous clients do not matter
+	require.Equal(t, http.StatusTooManyRequests, get("bob").Code)
+	require.Equal(t, http.StatusTooManyRequests, get("").Code)
+}
+
+func TestRateLimiterMaxBuckets(t *testing.T) {
+	l, err := NewRateLimiter(1, 1)
+	require.NoError(t, err)
+	now := time.Unix(0, 0)
+	l.now = func() time.Time { return now }
+
+	require.NoError(t, l.Allow("alice"))
+	for i := 0; i < maxBuckets; i++ {
+		require.NoError(t, l.Allow(EventRequestor(fmt.Sprintf("requestor%d", i))))
+		require.LessOrEqual(t, len(l.buckets), maxBuckets)
+	}
+	require.Equal(t, maxBuckets, l.lru.Len())
+	// the bucket of the least recently seen requestor was dropped
+	require.NoError(t, l.Allow("alice"))
+	require.Error(t, l.Allow(EventRequestor(fmt.Sprintf("requestor%d", maxBuckets-1))))
+}
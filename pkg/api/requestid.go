@@ -0,0 +1,178 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/logging"
+)
+
+// RequestIDHeader is the header carrying the ID of a request. Clients may set
+// it to correlate their calls with the server logs, e.g. with the ID of the
+// request which made the call, and the server always sets it in responses.
+const RequestIDHeader = "X-Request-ID"
+
+// MaxRequestIDLength is the maximum length of the request IDs set by clients.
+// Longer or non-printable IDs are replaced by IDs generated by the server.
+const MaxRequestIDLength = 64
+
+// accessLog logs a line for each request served by AccessLogMiddleware. It is
+// a module of its own, so that its level can be set independently.
+var accessLog = logging.GetLogger("pkg/api/access")
+
+// NewRequestID returns a new random request ID.
+func NewRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// the time is unique enough for correlating logs
+		return time.Now().UTC().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID returns whether a request ID set by a client can be used as
+// it is.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestInfo is what the access log records about a request, besides the
+// request itself. The requestor is set once the request is authenticated.
+type requestInfo struct {
+	id        string
+	requestor EventRequestor
+}
+
+type requestInfoKey struct{}
+
+// WithRequestID returns a copy of the context carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, &requestInfo{id: id})
+}
+
+// RequestIDFromContext returns the request ID carried by the context, or an
+// empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// setAccessRequestor records the authenticated requestor of a request in its
+// access log line.
+func setAccessRequestor(ctx context.Context, requestor EventRequestor) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.requestor = requestor
+	}
+}
+
+// statusRecorder records the status and the size of a response. The streams
+// still flush and hijack the underlying connection through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.size += n
+	return n, err
+}
+
+// Flush implements http.Flusher.
+func (s *statusRecorder) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, for the WebSocket streams.
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection cannot be hijacked")
+	}
+	if s.status == 0 {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying ResponseWriter, see http.ResponseController.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// AccessLogMiddleware assigns an ID to every request, which is the one set
+// by the client in the RequestIDHeader header if valid, and returns it in the
+// same header of the response. The ID is carried by the context of the
+// request, see RequestIDFromContext, so that the API calls made for the
+// request record it, see API.ForRequest. Once served, each request is logged
+// with its ID, method, path, status, duration, client address and, if it
+// was authenticated, requestor. It must wrap AuthMiddleware, so that the
+// rejected requests are logged too.
+func AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := WithRequestID(r.Context(), id)
+		info := ctx.Value(requestInfoKey{}).(*requestInfo)
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		fields := map[string]interface{}{
+			logging.FieldRequestID: id,
+			"method":               r.Method,
+			"path":                 r.URL.Path,
+			"status":               rec.status,
+			"bytes":                rec.size,
+			"duration_ms":          time.Since(start).Milliseconds(),
+			"remote_addr":          r.RemoteAddr,
+		}
+		if info.requestor != "" {
+			fields["requestor"] = info.requestor
+		}
+		// gRPC calls report their status in the trailers
+		if status := rec.Header().Get(http.TrailerPrefix + "Grpc-Status"); status != "" {
+			fields["grpc_status"] = status
+		}
+		logging.AddFields(accessLog, fields).Infof("%s %s %d", r.Method, r.URL.Path, rec.status)
+	})
+}
@@ -0,0 +1,83 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/stretchr/testify/require"
+)
+
+type staticAuthenticator EventRequestor
+
+func (a staticAuthenticator) Authenticate(r *http.Request) (*Identity, error) {
+	return &Identity{Requestor: EventRequestor(a)}, nil
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logging.SetOutput(&buf)
+	require.NoError(t, logging.SetFormat(logging.FormatJSON))
+	defer func() {
+		logging.SetOutput(os.Stderr)
+		require.NoError(t, logging.SetFormat(logging.FormatText))
+	}()
+
+	var requestID string
+	h := AccessLogMiddleware(AuthMiddleware(staticAuthenticator("alice"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = RequestIDFromContext(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("tea"))
+	})))
+
+	// the ID set by the client is kept
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/status", nil)
+	req.Header.Set(RequestIDHeader, "client-id")
+	h.ServeHTTP(rec, req)
+	require.Equal(t, "client-id", requestID)
+	require.Equal(t, "client-id", rec.Header().Get(RequestIDHeader))
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, "client-id", entry[logging.FieldRequestID])
+	require.Equal(t, "POST", entry["method"])
+	require.Equal(t, "/status", entry["path"])
+	require.Equal(t, float64(http.StatusTeapot), entry["status"])
+	require.Equal(t, float64(3), entry["bytes"])
+	require.Equal(t, "alice", entry["requestor"])
+
+	// invalid IDs are replaced
+	for _, id := range []string{"", "with space", strings.Repeat("x", MaxRequestIDLength+1)} {
+		rec = httptest.NewRecorder()
+		req = httptest.NewRequest(http.MethodPost, "/status", nil)
+		req.Header.Set(RequestIDHeader, id)
+		h.ServeHTTP(rec, req)
+		require.NotEqual(t, id, requestID)
+		require.Len(t, requestID, 32)
+		require.Equal(t, requestID, rec.Header().Get(RequestIDHeader))
+	}
+}
+
+func TestForRequest(t *testing.T) {
+	a, err := New(func() string { return "server" })
+	require.NoError(t, err)
+	r := a.ForRequest("request-id")
+	require.Equal(t, "request-id", r.newResponse(ResponseTypeVersion).RequestID)
+	require.Empty(t, a.newResponse(ResponseTypeVersion).RequestID)
+
+	ev := &Event{Type: EventTypeStatus, Msg: EventStatusMsg{requestor: "alice"}}
+	go func() { <-a.Events }()
+	require.NoError(t, r.SendEvent(ev, nil))
+	require.Equal(t, "request-id", ev.RequestID)
+}
@@ -6,6 +6,10 @@
 package api
 
 import (
+	"encoding/json"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event/testevent"
 	"github.com/facebookincubator/contest/pkg/job"
 	"github.com/facebookincubator/contest/pkg/types"
 )
@@ -20,23 +24,64 @@ const (
 	ResponseTypeStatus
 	ResponseTypeRetry
 	ResponseTypeVersion
+	ResponseTypeList
+	ResponseTypeTestEvents
+	ResponseTypeStartBatch
+	ResponseTypeValidate
+	ResponseTypePlugins
+	ResponseTypeReadiness
+	ResponseTypeDrain
+	ResponseTypeSchedule
+	ResponseTypeSchedules
+	ResponseTypeTemplate
+	ResponseTypeTemplates
+	ResponseTypeReports
+	ResponseTypePauseJob
+	ResponseTypeApproveJob
+	ResponseTypeHistory
+	ResponseTypeQuotas
+	ResponseTypeLogLevels
+	ResponseTypeAuditLog
+	ResponseTypeUnlockTargets
 )
 
 // ResponseTypeToName maps response types to their names.
 var ResponseTypeToName = map[ResponseType]string{
-	ResponseTypeStart:   "ResponseTypeStart",
-	ResponseTypeStop:    "ResponseTypeStop",
-	ResponseTypeStatus:  "ResponseTypeStatus",
-	ResponseTypeRetry:   "ResponseTypeRetry",
-	ResponseTypeVersion: "ResponseTypeVersion",
+	ResponseTypeStart:         "ResponseTypeStart",
+	ResponseTypeStop:          "ResponseTypeStop",
+	ResponseTypeStatus:        "ResponseTypeStatus",
+	ResponseTypeRetry:         "ResponseTypeRetry",
+	ResponseTypeVersion:       "ResponseTypeVersion",
+	ResponseTypeList:          "ResponseTypeList",
+	ResponseTypeTestEvents:    "ResponseTypeTestEvents",
+	ResponseTypeStartBatch:    "ResponseTypeStartBatch",
+	ResponseTypeValidate:      "ResponseTypeValidate",
+	ResponseTypePlugins:       "ResponseTypePlugins",
+	ResponseTypeReadiness:     "ResponseTypeReadiness",
+	ResponseTypeDrain:         "ResponseTypeDrain",
+	ResponseTypeSchedule:      "ResponseTypeSchedule",
+	ResponseTypeSchedules:     "ResponseTypeSchedules",
+	ResponseTypeTemplate:      "ResponseTypeTemplate",
+	ResponseTypeTemplates:     "ResponseTypeTemplates",
+	ResponseTypeReports:       "ResponseTypeReports",
+	ResponseTypePauseJob:      "ResponseTypePauseJob",
+	ResponseTypeApproveJob:    "ResponseTypeApproveJob",
+	ResponseTypeHistory:       "ResponseTypeHistory",
+	ResponseTypeQuotas:        "ResponseTypeQuotas",
+	ResponseTypeLogLevels:     "ResponseTypeLogLevels",
+	ResponseTypeAuditLog:      "ResponseTypeAuditLog",
+	ResponseTypeUnlockTargets: "ResponseTypeUnlockTargets",
 }
 
 // Response is the type returned to any API request.
 type Response struct {
 	ServerID string
-	Type     ResponseType
-	Data     ResponseData
-	Err      error
+	// RequestID is the ID of the request which made the call, if any, see
+	// API.ForRequest
+	RequestID string
+	Type      ResponseType
+	Data      ResponseData
+	Err       error
 }
 
 // ResponseData is the interface type implemented by the various response types.
@@ -63,6 +108,32 @@ func (r ResponseDataStop) Type() ResponseType {
 	return ResponseTypeStop
 }
 
+// ResponseDataPauseJob is the response type for the requests which pause or
+// resume a job. State is the state of the job once the request was handled,
+// e.g. JobStatePausing until the steps of a paused job returned.
+type ResponseDataPauseJob struct {
+	JobID types.JobID
+	State string
+}
+
+// Type returns the response type.
+func (r ResponseDataPauseJob) Type() ResponseType {
+	return ResponseTypePauseJob
+}
+
+// ResponseDataApproveJob is the response type for the requests which approve
+// or reject a job. State is the state of the job once the request was
+// handled.
+type ResponseDataApproveJob struct {
+	JobID types.JobID
+	State string
+}
+
+// Type returns the response type.
+func (r ResponseDataApproveJob) Type() ResponseType {
+	return ResponseTypeApproveJob
+}
+
 // ResponseDataStatus is the response type for a Status request.
 type ResponseDataStatus struct {
 	Status *job.Status
@@ -87,9 +158,391 @@ func (r ResponseDataRetry) Type() ResponseType {
 // ResponseDataVersion is the response type for a Version request.
 type ResponseDataVersion struct {
 	Version uint32
+	// ReportSchemaVersion is the version of the schema of the reports, see
+	// job.ReportSchema
+	ReportSchemaVersion int
 }
 
 // Type returns the response type.
 func (r ResponseDataVersion) Type() ResponseType {
 	return ResponseTypeVersion
 }
+
+// ResponseDataList is the response type for a List request. Limit and Offset
+// are the ones applied to the request, see PageLimit.
+type ResponseDataList struct {
+	JobIDs []types.JobID
+	Limit  uint
+	Offset uint
+}
+
+// Type returns the response type.
+func (r ResponseDataList) Type() ResponseType {
+	return ResponseTypeList
+}
+
+// ResponseDataTestEvents is the response type for a TestEvents request. Limit
+// and Offset are the ones applied to the request, see PageLimit.
+type ResponseDataTestEvents struct {
+	Events []testevent.Event
+	Limit  uint
+	Offset uint
+}
+
+// Type returns the response type.
+func (r ResponseDataTestEvents) Type() ResponseType {
+	return ResponseTypeTestEvents
+}
+
+// BatchJob is the outcome of one of the job descriptors of a StartBatch
+// request: either the ID of the started job, or the reason why it was not
+// started.
+type BatchJob struct {
+	JobID types.JobID `json:",omitempty"`
+	Error string      `json:",omitempty"`
+}
+
+// ResponseDataStartBatch is the response type for a StartBatch request. The
+// jobs are in the order of the job descriptors.
+type ResponseDataStartBatch struct {
+	Jobs []BatchJob
+}
+
+// Type returns the response type.
+func (r ResponseDataStartBatch) Type() ResponseType {
+	return ResponseTypeStartBatch
+}
+
+// The severities of the diagnostics of a job descriptor.
+const (
+	// SeverityError is the severity of the problems which prevent the job
+	// from starting
+	SeverityError = "error"
+	// SeverityWarning is the severity of the suspicious settings which do
+	// not prevent the job from starting
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is a problem found in a job descriptor by a Validate request.
+type Diagnostic struct {
+	// Severity is SeverityError or SeverityWarning
+	Severity string
+	// Path locates the problem in the job descriptor, e.g.
+	// TestDescriptors[0].SetupSteps[1], or is empty for the whole descriptor
+	Path    string `json:",omitempty"`
+	Message string
+}
+
+// ValidatedTest is a test which a validated job descriptor would run.
+type ValidatedTest struct {
+	Name string
+	// Steps are the labels of the test steps, setup and cleanup steps
+	// included, in order
+	Steps []string
+}
+
+// ResponseDataValidate is the response type for a Validate request. The job
+// descriptor is valid if no diagnostic is an error.
+type ResponseDataValidate struct {
+	Valid       bool
+	Diagnostics []Diagnostic
+	Tests       []ValidatedTest
+}
+
+// Type returns the response type.
+func (r ResponseDataValidate) Type() ResponseType {
+	return ResponseTypeValidate
+}
+
+// PluginDescription describes a registered plugin.
+type PluginDescription struct {
+	Name string
+	// Events are the names of the events which a test step may emit
+	Events []string `json:",omitempty"`
+	// ParametersSchemas are the JSON schemas of the parameters of the
+	// plugin, keyed by the parameters they describe, e.g. acquire and
+	// release for a target manager, if the plugin publishes any
+	ParametersSchemas map[string]json.RawMessage `json:",omitempty"`
+}
+
+// ResponseDataPlugins is the response type for a Plugins request, listing
+// the plugins which job descriptors may refer to.
+type ResponseDataPlugins struct {
+	TargetManagers []PluginDescription
+	TestFetchers   []PluginDescription
+	TestSteps      []PluginDescription
+	Reporters      []PluginDescription
+	Lockers        []PluginDescription
+}
+
+// Type returns the response type.
+func (r ResponseDataPlugins) Type() ResponseType {
+	return ResponseTypePlugins
+}
+
+// ReadinessCheck is the result of a check of a dependency of the server.
+type ReadinessCheck struct {
+	Name string
+	// Error is empty if the check passed
+	Error  string `json:",omitempty"`
+	Detail string `json:",omitempty"`
+}
+
+// ResponseDataReadiness is the response type for a Readiness request. The
+// server is ready to run jobs if all the checks passed.
+type ResponseDataReadiness struct {
+	Ready  bool
+	Checks []ReadinessCheck
+}
+
+// Type returns the response type.
+func (r ResponseDataReadiness) Type() ResponseType {
+	return ResponseTypeReadiness
+}
+
+// ResponseDataDrain is the response type for a Drain request.
+type ResponseDataDrain struct {
+	// RunningJobs is the number of jobs which the server still runs
+	RunningJobs int
+	// Deadline is when the jobs still running are paused, or the zero time
+	// if they are waited for
+	Deadline time.Time
+}
+
+// Type returns the response type.
+func (r ResponseDataDrain) Type() ResponseType {
+	return ResponseTypeDrain
+}
+
+// Quota bounds the resources used by the jobs of a requestor. Zero fields
+// mean no bound. MaxTargets bounds the number of targets locked at once by
+// the jobs, and MaxRuntimePerDay the total time they run each day, in UTC.
+type Quota struct {
+	MaxTargets       int
+	MaxRuntimePerDay time.Duration
+}
+
+// RequestorQuota is the quota of a requestor, which is the default quota
+// unless Override is set, and the resources its jobs use: the targets they
+// lock, and the time they ran today.
+type RequestorQuota struct {
+	Requestor EventRequestor
+	Quota
+	Override      bool
+	LockedTargets int
+	RuntimeToday  time.Duration
+}
+
+// ResponseDataQuotas is the response type for the Quotas and SetQuota
+// requests, holding the default quota, and the quotas of the requestors
+// which have their own quota or whose jobs use resources, sorted by
+// requestor.
+type ResponseDataQuotas struct {
+	Default    Quota
+	Requestors []RequestorQuota
+}
+
+// Type returns the response type.
+func (r ResponseDataQuotas) Type() ResponseType {
+	return ResponseTypeQuotas
+}
+
+// ModuleLogLevel is the log level of a module of the server, which is the
+// default level unless Override is set.
+type ModuleLogLevel struct {
+	Module   string
+	Level    string
+	Override bool
+}
+
+// ResponseDataLogLevels is the response type for the LogLevels and
+// SetLogLevel requests, holding the default log level, and the levels of the
+// modules sorted by module.
+type ResponseDataLogLevels struct {
+	Default string
+	Modules []ModuleLogLevel
+}
+
+// Type returns the response type.
+func (r ResponseDataLogLevels) Type() ResponseType {
+	return ResponseTypeLogLevels
+}
+
+// AuditRecord records an API call which changed the state of jobs or of the
+// server. Action is the type of the call, e.g. start or stop, and JobID the
+// job it affected or started, if any. PayloadHash is the hex encoded SHA-256
+// hash of the JSON encoded arguments of the call, and Error why the call
+// failed, if it did.
+type AuditRecord struct {
+	ID          int64
+	Time        time.Time
+	ServerID    string
+	RequestID   string
+	Requestor   EventRequestor
+	Action      string
+	JobID       types.JobID
+	PayloadHash string
+	Error       string
+}
+
+// ResponseDataAuditLog is the response type for an AuditLog request, holding
+// the matching records in the order the calls were made. Limit is the one
+// applied to the request, see PageLimit.
+type ResponseDataAuditLog struct {
+	Records []AuditRecord
+	Limit   uint
+}
+
+// Type returns the response type.
+func (r ResponseDataAuditLog) Type() ResponseType {
+	return ResponseTypeAuditLog
+}
+
+// ResponseDataUnlockTargets is the response type for an UnlockTargets
+// request. Unlocked are the jobs whose locks were released, by target ID.
+// The targets which were not locked are omitted.
+type ResponseDataUnlockTargets struct {
+	Unlocked map[string]types.JobID
+}
+
+// Type returns the response type.
+func (r ResponseDataUnlockTargets) Type() ResponseType {
+	return ResponseTypeUnlockTargets
+}
+
+// Schedule describes a recurring job, which starts its job descriptor every
+// time its cron expression activates, unless it is paused. NextRunTime is
+// zero if the schedule is paused or never activates again, and LastJobID and
+// LastError describe the job started at LastRunTime, or why it could not be.
+type Schedule struct {
+	ID            types.ScheduleID
+	Name          string
+	Requestor     EventRequestor
+	Cron          string
+	JobDescriptor string
+	Paused        bool
+	CreateTime    time.Time
+	NextRunTime   time.Time
+	LastRunTime   time.Time
+	LastJobID     types.JobID `json:",omitempty"`
+	LastError     string      `json:",omitempty"`
+}
+
+// ResponseDataSchedule is the response type for the requests which create,
+// pause, resume or delete a schedule.
+type ResponseDataSchedule struct {
+	Schedule Schedule
+}
+
+// Type returns the response type.
+func (r ResponseDataSchedule) Type() ResponseType {
+	return ResponseTypeSchedule
+}
+
+// ResponseDataSchedules is the response type for a ListSchedules request.
+type ResponseDataSchedules struct {
+	Schedules []Schedule
+}
+
+// Type returns the response type.
+func (r ResponseDataSchedules) Type() ResponseType {
+	return ResponseTypeSchedules
+}
+
+// JobTemplate is a job template stored by the server, see job.Template.
+// Requestor is the requestor who stored it last.
+type JobTemplate struct {
+	job.Template
+	Requestor  EventRequestor
+	CreateTime time.Time
+	UpdateTime time.Time
+}
+
+// ResponseDataTemplate is the response type for the requests which save or
+// delete a job template.
+type ResponseDataTemplate struct {
+	Template JobTemplate
+}
+
+// Type returns the response type.
+func (r ResponseDataTemplate) Type() ResponseType {
+	return ResponseTypeTemplate
+}
+
+// ResponseDataTemplates is the response type for a ListTemplates request.
+type ResponseDataTemplates struct {
+	Templates []JobTemplate
+}
+
+// Type returns the response type.
+func (r ResponseDataTemplates) Type() ResponseType {
+	return ResponseTypeTemplates
+}
+
+// ResponseDataReports is the response type for a Reports request, holding the
+// reports of the matching jobs in the order of the jobs. Limit and Offset are
+// the ones applied to the request, see PageLimit.
+type ResponseDataReports struct {
+	Reports []*job.JobReport
+	Limit   uint
+	Offset  uint
+}
+
+// Type returns the response type.
+func (r ResponseDataReports) Type() ResponseType {
+	return ResponseTypeReports
+}
+
+// JobResults are the results of a job aggregated by a History request, from
+// the per-target results of all its runs. PassRate is the percentage of the
+// results which passed, among the ones which were not skipped, and Duration
+// is the time from the start of the job to its end.
+type JobResults struct {
+	JobID       types.JobID
+	JobName     string
+	RequestTime time.Time
+	State       string
+	Passed      uint
+	Failed      uint
+	Skipped     uint
+	PassRate    float64
+	Duration    time.Duration
+}
+
+// StepResults are the results of a test step across the jobs of a History
+// request. Failed and Skipped count the targets the step failed or skipped,
+// and AverageDuration is the average time the targets spent in the step.
+type StepResults struct {
+	TestStepLabel   string
+	Failed          uint
+	Skipped         uint
+	AverageDuration time.Duration
+}
+
+// TestResults are the results of a test across the jobs of a History
+// request. AverageDuration is the average time the targets took to complete
+// the test, and Steps are the results of its steps sorted by label.
+type TestResults struct {
+	TestName        string
+	Passed          uint
+	Failed          uint
+	Skipped         uint
+	PassRate        float64
+	AverageDuration time.Duration
+	Steps           []StepResults
+}
+
+// ResponseDataHistory is the response type for a History request, holding
+// the results of each job, most recent first, and of each test across all
+// the jobs, sorted by name, e.g. to follow the pass rate of a job over time.
+// Limit is the one applied to the request, see PageLimit.
+type ResponseDataHistory struct {
+	Jobs  []JobResults
+	Tests []TestResults
+	Limit uint
+}
+
+// Type returns the response type.
+func (r ResponseDataHistory) Type() ResponseType {
+	return ResponseTypeHistory
+}
@@ -0,0 +1,157 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package artifact implements the storage of large binary artifacts produced
+// by test steps (logs, crash dumps, firmware images, ...). Artifacts are
+// written to a pluggable Store, and events only carry a reference to them
+// instead of embedding the content in the payload.
+package artifact
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/target"
+)
+
+// store defines the artifact store used by ConTest.
+var store Store
+
+// Store is the interface implemented by artifact storage backends.
+type Store interface {
+	// Name returns the name of the store, which is recorded in references.
+	Name() string
+	// Put stores the content of the reader under the given key. Keys are
+	// slash-separated paths.
+	Put(key string, r io.Reader) error
+	// Get returns the content stored under the given key. The caller must
+	// close the returned reader.
+	Get(key string) (io.ReadCloser, error)
+}
+
+// Ref is a reference to an artifact held by a Store.
+type Ref struct {
+	Store  string
+	Key    string
+	Name   string
+	Size   int64
+	SHA256 string
+}
+
+// Payload is the payload of events carrying artifacts.
+type Payload struct {
+	Artifacts []Ref
+}
+
+// Emitter is implemented by test event emitters that are able to attach
+// artifacts to the events they emit.
+type Emitter interface {
+	testevent.Emitter
+	// EmitArtifact stores the content of the reader as an artifact with the
+	// given name and emits the event with a Payload referencing it. Any
+	// payload already set in data is replaced.
+	EmitArtifact(data testevent.Data, name string, r io.Reader) error
+}
+
+// ErrNoStore is returned when attaching an artifact while no Store is set.
+var ErrNoStore = errors.New("no artifact store configured")
+
+// SetStore sets the desired artifact store.
+func SetStore(s Store) {
+	store = s
+}
+
+// GetStore returns the artifact store in use, or nil if none is set.
+func GetStore() Store {
+	return store
+}
+
+// Emit attaches an artifact to an event via the given emitter. It fails if
+// the emitter does not support artifacts.
+func Emit(ev testevent.Emitter, data testevent.Data, name string, r io.Reader) error {
+	ae, ok := ev.(Emitter)
+	if !ok {
+		return fmt.Errorf("emitter %T does not support artifacts", ev)
+	}
+	return ae.EmitArtifact(data, name, r)
+}
+
+// Key builds the key of an artifact from the header of the event it is
+// attached to, so that artifacts of the same job are stored together.
+func Key(header testevent.Header, tgt *target.Target, name string) string {
+	elems := []string{
+		fmt.Sprintf("%d", header.JobID),
+		fmt.Sprintf("%d", header.RunID),
+		url.PathEscape(header.TestName),
+		url.PathEscape(header.TestStepLabel),
+	}
+	if tgt != nil {
+		elems = append(elems, url.PathEscape(tgt.ID))
+	}
+	elems = append(elems, url.PathEscape(name))
+	return strings.Join(elems, "/")
+}
+
+// ValidateKey checks that a key is a relative, clean slash-separated path, so
+// that stores can safely join it to their root or prefix.
+func ValidateKey(key string) error {
+	if key == "" || path.Clean("/"+key) != "/"+key {
+		return fmt.Errorf("invalid artifact key '%s'", key)
+	}
+	return nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// Put stores an artifact in the current Store and returns a reference to it.
+func Put(key, name string, r io.Reader) (*Ref, error) {
+	if store == nil {
+		return nil, ErrNoStore
+	}
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	cw := countingWriter{}
+	if err := store.Put(key, io.TeeReader(r, io.MultiWriter(h, &cw))); err != nil {
+		return nil, fmt.Errorf("cannot store artifact '%s': %v", key, err)
+	}
+	return &Ref{
+		Store:  store.Name(),
+		Key:    key,
+		Name:   name,
+		Size:   cw.n,
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// Get returns the content of the referenced artifact. The caller must close
+// the returned reader.
+func Get(ref Ref) (io.ReadCloser, error) {
+	if store == nil {
+		return nil, ErrNoStore
+	}
+	if ref.Store != store.Name() {
+		return nil, fmt.Errorf("artifact '%s' belongs to store '%s', current store is '%s'", ref.Key, ref.Store, store.Name())
+	}
+	if err := ValidateKey(ref.Key); err != nil {
+		return nil, err
+	}
+	return store.Get(ref.Key)
+}
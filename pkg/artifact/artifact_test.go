@@ -0,0 +1,147 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package artifact
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/stretchr/testify/require"
+)
+
+// memStore is a Store keeping artifacts in memory.
+type memStore struct {
+	name    string
+	objects map[string][]byte
+}
+
+func newMemStore(name string) *memStore {
+	return &memStore{name: name, objects: make(map[string][]byte)}
+}
+
+func (s *memStore) Name() string {
+	return s.name
+}
+
+func (s *memStore) Put(key string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.objects[key] = data
+	return nil
+}
+
+func (s *memStore) Get(key string) (io.ReadCloser, error) {
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func TestKey(t *testing.T) {
+	header := testevent.Header{JobID: 1, RunID: 2, TestName: "my test", TestStepLabel: "../step"}
+	require.Equal(t, "1/2/my%20test/..%2Fstep/T%2F1/dmesg.txt", Key(header, &target.Target{ID: "T/1"}, "dmesg.txt"))
+	require.Equal(t, "1/2/my%20test/..%2Fstep/dmesg.txt", Key(header, nil, "dmesg.txt"))
+	require.NoError(t, ValidateKey(Key(header, nil, "dmesg.txt")))
+}
+
+func TestValidateKey(t *testing.T) {
+	for _, key := range []string{"a", "a/b", "1/2/test/step/T1/dmesg.txt", "a..b", ".hidden"} {
+		require.NoError(t, ValidateKey(key), key)
+	}
+	for _, key := range []string{"", ".", "..", "../x", "a/../../x", "a/../b", "./a", "/a", "a/", "a//b", "a/./b"} {
+		require.Error(t, ValidateKey(key), key)
+	}
+}
+
+func TestPutGet(t *testing.T) {
+	s := newMemStore("mem")
+	SetStore(s)
+	defer SetStore(nil)
+
+	ref, err := Put("1/2/dmesg.txt", "dmesg.txt", strings.NewReader("kernel log"))
+	require.NoError(t, err)
+	require.Equal(t, Ref{
+		Store:  "mem",
+		Key:    "1/2/dmesg.txt",
+		Name:   "dmesg.txt",
+		Size:   int64(len("kernel log")),
+		SHA256: "e034eba3dba42a465b0c9370d9a1ae7e08433ca1ac7e0f1dd011c23a49cdff1c",
+	}, *ref)
+	require.Equal(t, "kernel log", string(s.objects["1/2/dmesg.txt"]))
+
+	r, err := Get(*ref)
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "kernel log", string(data))
+}
+
+func TestInvalidKey(t *testing.T) {
+	s := newMemStore("mem")
+	SetStore(s)
+	defer SetStore(nil)
+
+	for _, key := range []string{"", "../x", "a/../../x", "a/../b", "/a", "a//b"} {
+		_, err := Put(key, "x", strings.NewReader("data"))
+		require.Error(t, err, key)
+		_, err = Get(Ref{Store: "mem", Key: key})
+		require.Error(t, err, key)
+	}
+	require.Empty(t, s.objects)
+}
+
+func TestNoStore(t *testing.T) {
+	_, err := Put("a", "a", strings.NewReader(""))
+	require.Equal(t, ErrNoStore, err)
+	_, err = Get(Ref{Store: "mem", Key: "a"})
+	require.Equal(t, ErrNoStore, err)
+}
+
+func TestStoreMismatch(t *testing.T) {
+	old := newMemStore("old")
+	SetStore(old)
+	defer SetStore(nil)
+	ref, err := Put("a", "a", strings.NewReader("data"))
+	require.NoError(t, err)
+
+	SetStore(newMemStore("new"))
+	_, err = Get(*ref)
+	require.EqualError(t, err, "artifact 'a' belongs to store 'old', current store is 'new'")
+}
+
+type plainEmitter struct{}
+
+func (plainEmitter) Emit(data testevent.Data) error {
+	return nil
+}
+
+type recordingEmitter struct {
+	plainEmitter
+	names []string
+}
+
+func (e *recordingEmitter) EmitArtifact(data testevent.Data, name string, r io.Reader) error {
+	e.names = append(e.names, name)
+	return nil
+}
+
+func TestEmit(t *testing.T) {
+	require.Error(t, Emit(plainEmitter{}, testevent.Data{}, "a", strings.NewReader("")))
+
+	ev := &recordingEmitter{}
+	require.NoError(t, Emit(ev, testevent.Data{}, "a", strings.NewReader("")))
+	require.Equal(t, []string{"a"}, ev.names)
+}
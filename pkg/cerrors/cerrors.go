@@ -8,6 +8,7 @@ package cerrors
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/facebookincubator/contest/pkg/target"
 )
@@ -20,6 +21,31 @@ type TargetError struct {
 	Err    error
 }
 
+// ErrTargetSkipped is used by TestSteps as the error of a TargetError to
+// indicate that a Target has been skipped rather than failed, e.g. because the
+// test does not apply to its hardware revision. Like failed Targets, skipped
+// Targets do not proceed further in the test run.
+type ErrTargetSkipped struct {
+	Reason string
+}
+
+// Error returns the error string associated with the error
+func (e *ErrTargetSkipped) Error() string {
+	return fmt.Sprintf("target skipped: %s", e.Reason)
+}
+
+// ErrTargetTimedOut is used by the TestRunner as the error of a TargetError to
+// indicate that a Target has exceeded the maximum time it is allowed to spend
+// in the test pipeline.
+type ErrTargetTimedOut struct {
+	Timeout time.Duration
+}
+
+// Error returns the error string associated with the error
+func (e *ErrTargetTimedOut) Error() string {
+	return fmt.Sprintf("target did not complete the test within %v", e.Timeout)
+}
+
 // ErrResumeNotSupported indicates that a test step cannot resume. This can
 // be checked explicitly by the framework
 type ErrResumeNotSupported struct {
@@ -43,6 +69,56 @@ func (e *ErrTestStepsNeverReturned) Error() string {
 	return fmt.Sprintf("test step [%s] did not return", strings.Join(e.StepNames, ", "))
 }
 
+// ErrTestStepPanicked indicates that a TestStep panicked while running. The
+// panic is recovered by the TestRunner, which fails the test instead of
+// crashing the server.
+type ErrTestStepPanicked struct {
+	StepName string
+	Value    string
+	Stack    string
+}
+
+// Error returns the error string associated with the error
+func (e *ErrTestStepPanicked) Error() string {
+	return fmt.Sprintf("test step %s panicked: %s", e.StepName, e.Value)
+}
+
+// ErrTestStepTimedOut indicates that a TestStep did not complete within the
+// timeout specified in the test descriptor, and that it was abandoned.
+type ErrTestStepTimedOut struct {
+	StepName string
+	Timeout  time.Duration
+}
+
+// Error returns the error string associated with the error
+func (e *ErrTestStepTimedOut) Error() string {
+	return fmt.Sprintf("test step %s did not complete within %v", e.StepName, e.Timeout)
+}
+
+// ErrTestStepLostTargets indicates that a TestStep returned without forwarding
+// or erroring some of the Targets that were injected into it.
+type ErrTestStepLostTargets struct {
+	StepName string
+	Targets  []string
+}
+
+// Error returns the error string associated with the error
+func (e *ErrTestStepLostTargets) Error() string {
+	return fmt.Sprintf("test step %s lost targets [%s]", e.StepName, strings.Join(e.Targets, ", "))
+}
+
+// ErrAbortThresholdExceeded indicates that a test has been aborted because
+// the number of failed Targets exceeded the abort threshold of the job.
+type ErrAbortThresholdExceeded struct {
+	Failed int
+	Total  int
+}
+
+// Error returns the error string associated with the error
+func (e *ErrAbortThresholdExceeded) Error() string {
+	return fmt.Sprintf("test aborted, %d out of %d targets failed", e.Failed, e.Total)
+}
+
 // ErrTestStepClosedChannels indicates that the test step returned after
 // closing its output channels, which constitutes an API violation
 type ErrTestStepClosedChannels struct {
@@ -6,6 +6,7 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 
@@ -19,8 +20,19 @@ type JobDescFormat int
 const (
 	JobDescFormatJSON JobDescFormat = iota
 	JobDescFormatYAML
+	// JobDescFormatAuto detects the format, see DetectJobDescFormat
+	JobDescFormatAuto
 )
 
+// DetectJobDescFormat returns the format of a job descriptor: JSON if it is
+// a JSON object, YAML otherwise.
+func DetectJobDescFormat(data []byte) JobDescFormat {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return JobDescFormatJSON
+	}
+	return JobDescFormatYAML
+}
+
 // ParseJobDescriptor validates a job descriptor's well-formedness, and returns a
 // JSON-formatted descriptor if it was provided in a different format.
 // The currently supported format are JSON and YAML.
@@ -28,6 +40,9 @@ func ParseJobDescriptor(data []byte, jobDescFormat JobDescFormat) ([]byte, error
 	var (
 		jobDesc = make(map[string]interface{})
 	)
+	if jobDescFormat == JobDescFormatAuto {
+		jobDescFormat = DetectJobDescFormat(data)
+	}
 	switch jobDescFormat {
 	case JobDescFormatJSON:
 		if err := json.Unmarshal(data, &jobDesc); err != nil {
@@ -0,0 +1,51 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJobDescriptorAuto(t *testing.T) {
+	require.Equal(t, JobDescFormatJSON, DetectJobDescFormat([]byte("\n  {\"JobName\": \"test\"}")))
+	require.Equal(t, JobDescFormatYAML, DetectJobDescFormat([]byte("JobName: test\n")))
+
+	jobDescJSON, err := ParseJobDescriptor([]byte("JobName: test\nRuns: 2\nTags:\n  - nightly\n"), JobDescFormatAuto)
+	require.NoError(t, err)
+	var jobDesc map[string]interface{}
+	require.NoError(t, json.Unmarshal(jobDescJSON, &jobDesc))
+	require.Equal(t, map[string]interface{}{"JobName": "test", "Runs": float64(2), "Tags": []interface{}{"nightly"}}, jobDesc)
+
+	_, err = ParseJobDescriptor([]byte("{\"JobName\": "), JobDescFormatAuto)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "JSON")
+}
+
+func TestParseJobDescriptorYAMLAnchors(t *testing.T) {
+	jobDescJSON, err := ParseJobDescriptor([]byte(`
+targets: &targets
+  TargetManagerName: TargetList
+  TestFetcherName: literal
+TestDescriptors:
+  - <<: *targets
+    TestFetcherFetchParameters: {TestName: first}
+  - <<: *targets
+    TestFetcherFetchParameters: {TestName: second}
+`), JobDescFormatYAML)
+	require.NoError(t, err)
+	var jobDesc struct {
+		TestDescriptors []map[string]interface{}
+	}
+	require.NoError(t, json.Unmarshal(jobDescJSON, &jobDesc))
+	require.Equal(t, 2, len(jobDesc.TestDescriptors))
+	for _, td := range jobDesc.TestDescriptors {
+		require.Equal(t, "TargetList", td["TargetManagerName"])
+		require.Equal(t, "literal", td["TestFetcherName"])
+	}
+}
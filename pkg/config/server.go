@@ -0,0 +1,116 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ServerConfigSections maps the sections of a server configuration file to
+// the names of the flags which their keys set.
+type ServerConfigSections map[string][]string
+
+// ApplyServerConfig sets the flags of a flag set from a YAML (or JSON) server
+// configuration file, whose top-level keys are the sections, and whose
+// section keys are the names of the flags. The flags already set, e.g. on the
+// command line, are left unchanged, so that they override the file. Lists
+// are set as comma-separated values, and objects as comma-separated key=value
+// pairs. Unknown sections and keys are rejected.
+func ApplyServerConfig(fs *flag.FlagSet, path string, sections ServerConfigSections) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read server configuration: %v", err)
+	}
+	var cfg map[string]map[string]interface{}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("invalid server configuration %s: %v", path, err)
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	names := make([]string, 0, len(cfg))
+	for name := range cfg {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		keys, ok := sections[name]
+		if !ok {
+			return fmt.Errorf("invalid server configuration %s: unknown section '%s'", path, name)
+		}
+		known := make(map[string]bool, len(keys))
+		for _, key := range keys {
+			known[key] = true
+		}
+		section := cfg[name]
+		sectionKeys := make([]string, 0, len(section))
+		for key := range section {
+			sectionKeys = append(sectionKeys, key)
+		}
+		sort.Strings(sectionKeys)
+		for _, key := range sectionKeys {
+			if !known[key] || fs.Lookup(key) == nil {
+				return fmt.Errorf("invalid server configuration %s: unknown key '%s.%s'", path, name, key)
+			}
+			if set[key] {
+				continue
+			}
+			value, err := flagValue(section[key])
+			if err == nil {
+				err = fs.Set(key, value)
+			}
+			if err != nil {
+				return fmt.Errorf("invalid server configuration %s: %s.%s: %v", path, name, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// flagValue returns the flag value of a decoded YAML value.
+func flagValue(v interface{}) (string, error) {
+	switch val := v.(type) {
+	case nil:
+		return "", nil
+	case []interface{}:
+		items := make([]string, 0, len(val))
+		for _, item := range val {
+			s, err := scalarValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		pairs := make([]string, 0, len(val))
+		for key, item := range val {
+			s, err := scalarValue(item)
+			if err != nil {
+				return "", err
+			}
+			pairs = append(pairs, key+"="+s)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ","), nil
+	}
+	return scalarValue(v)
+}
+
+func scalarValue(v interface{}) (string, error) {
+	switch v.(type) {
+	case []interface{}, map[string]interface{}:
+		return "", fmt.Errorf("unexpected nested value %v", v)
+	}
+	return fmt.Sprint(v), nil
+}
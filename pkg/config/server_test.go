@@ -0,0 +1,80 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyServerConfig(t *testing.T) {
+	newFlagSet := func() (*flag.FlagSet, *string, *string, *int, *time.Duration, *bool) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		return fs,
+			fs.String("dbURI", "default", ""),
+			fs.String("requestorMaxTargets", "", ""),
+			fs.Int("maxQueuedJobs", 1000, ""),
+			fs.Duration("lockRefreshTimeout", time.Minute, ""),
+			fs.Bool("preemptJobs", false, "")
+	}
+	sections := ServerConfigSections{
+		"storage":  {"dbURI"},
+		"limits":   {"requestorMaxTargets", "maxQueuedJobs", "preemptJobs"},
+		"timeouts": {"lockRefreshTimeout"},
+	}
+	path := filepath.Join(t.TempDir(), "contest.yaml")
+	write := func(cfg string) {
+		require.NoError(t, ioutil.WriteFile(path, []byte(cfg), 0644))
+	}
+
+	write(`
+storage:
+  dbURI: sqlite:///tmp/contest.db
+limits:
+  requestorMaxTargets:
+    ci: 100
+    alice: 0
+  maxQueuedJobs: 10
+  preemptJobs: true
+timeouts:
+  lockRefreshTimeout: 2m
+`)
+	fs, dbURI, requestorMaxTargets, maxQueuedJobs, lockRefreshTimeout, preemptJobs := newFlagSet()
+	require.NoError(t, fs.Parse([]string{"-maxQueuedJobs", "5"}))
+	require.NoError(t, ApplyServerConfig(fs, path, sections))
+	require.Equal(t, "sqlite:///tmp/contest.db", *dbURI)
+	require.Equal(t, "alice=0,ci=100", *requestorMaxTargets)
+	// flags set on the command line override the file
+	require.Equal(t, 5, *maxQueuedJobs)
+	require.Equal(t, 2*time.Minute, *lockRefreshTimeout)
+	require.True(t, *preemptJobs)
+
+	for cfg, msg := range map[string]string{
+		"storage:\n  dbURI: [a, b]\n":          "",
+		"logging:\n  level: debug\n":           "unknown section 'logging'",
+		"storage:\n  dbReadURI: x\n":           "unknown key 'storage.dbReadURI'",
+		"timeouts:\n  lockRefreshTimeout: 2\n": "timeouts.lockRefreshTimeout",
+		"storage: [dbURI]\n":                   "invalid server configuration",
+	} {
+		write(cfg)
+		fs, dbURI, _, _, _, _ := newFlagSet()
+		require.NoError(t, fs.Parse(nil))
+		err := ApplyServerConfig(fs, path, sections)
+		if msg == "" {
+			// lists are set as comma-separated values
+			require.NoError(t, err)
+			require.Equal(t, "a,b", *dbURI)
+			continue
+		}
+		require.Error(t, err, cfg)
+		require.Contains(t, err.Error(), msg)
+	}
+}
@@ -41,6 +41,18 @@ var TestRunnerShutdownTimeout = 30 * time.Second
 // doesn't reset when a TestStep returns.
 var TestRunnerStepShutdownTimeout = 5 * time.Second
 
+// TestRunnerLostTargetsTimeout represents the maximum time that the TestRunner
+// will wait, after a TestStep has returned, for the Targets that the TestStep
+// has not forwarded yet. Targets that are still missing afterwards are
+// considered lost, and the test fails.
+var TestRunnerLostTargetsTimeout = 5 * time.Second
+
+// TestRunnerCleanupTimeout represents the maximum time that the cleanup steps
+// of a test may still run once the test is cancelled or paused, after which
+// they are cancelled too, so that hung cleanup steps do not block the
+// cancellation of jobs nor the shutdown of the server.
+var TestRunnerCleanupTimeout = 5 * time.Minute
+
 // LockRefreshTimeout is the amount of time by which a target lock is extended
 // periodically while a job is running.
 var LockRefreshTimeout = 1 * time.Minute
@@ -15,12 +15,14 @@ import (
 	"github.com/facebookincubator/contest/pkg/types"
 )
 
-// Event represents an event emitted by the framework
+// Event represents an event emitted by the framework. RequestID is the ID of
+// the API request whose handling emitted the event, if any.
 type Event struct {
 	JobID     types.JobID
 	EventName event.Name
 	Payload   *json.RawMessage
 	EmitTime  time.Time
+	RequestID string `json:",omitempty"`
 }
 
 // New creates a new FrameworkEvent
@@ -63,6 +65,8 @@ type queryFieldJobID types.JobID
 type queryFieldEventNames []event.Name
 type queryFieldEmittedStartTime time.Time
 type queryFieldEmittedEndTime time.Time
+type queryFieldLimit uint
+type queryFieldOffset uint
 
 // QueryJobID sets the JobID field of the Query object
 func QueryJobID(jobID types.JobID) QueryField                            { return queryFieldJobID(jobID) }
@@ -93,6 +97,14 @@ func (value queryFieldEmittedEndTime) queryFieldPointer(query *Query) interface{
 	return &query.EmittedEndTime
 }
 
+// QueryLimit sets the Limit field of the Query object
+func QueryLimit(limit uint) QueryField                                   { return queryFieldLimit(limit) }
+func (value queryFieldLimit) queryFieldPointer(query *Query) interface{} { return &query.Limit }
+
+// QueryOffset sets the Offset field of the Query object
+func QueryOffset(offset uint) QueryField                                  { return queryFieldOffset(offset) }
+func (value queryFieldOffset) queryFieldPointer(query *Query) interface{} { return &query.Offset }
+
 // Emitter defines the interface that emitter objects for framework vents must implement
 type Emitter interface {
 	Emit(event Event) error
@@ -17,6 +17,11 @@ type Query struct {
 	EventNames       []Name
 	EmittedStartTime time.Time
 	EmittedEndTime   time.Time
+	// Limit is the maximum number of events returned, if positive, and
+	// Offset is the number of matching events skipped, in emission order.
+	// They allow paging through the events of large jobs.
+	Limit  uint
+	Offset uint
 }
 
 type QueryField interface{}
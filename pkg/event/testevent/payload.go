@@ -0,0 +1,82 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package testevent
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// PayloadMatch selects the events whose payload holds Value at Path. Path is
+// a JSON path made of object keys and array indexes separated by dots, e.g.
+// "$.Results.0.Stdout" or "Results.0.Stdout". String values are compared as
+// they are, other values by their JSON encoding, e.g. "42" or "true".
+type PayloadMatch struct {
+	Path  string
+	Value string
+}
+
+// HasPayloadFilter returns whether the query selects events by the content of
+// their payload. Storage engines which cannot filter payloads natively, e.g.
+// because payloads may be compressed, apply MatchPayload to the candidate
+// events instead.
+func (q *Query) HasPayloadFilter() bool {
+	return q.PayloadContains != "" || q.PayloadMatch.Path != ""
+}
+
+// MatchPayload returns whether a payload satisfies the payload filters of the
+// query. Without payload filters, every payload matches.
+func (q *Query) MatchPayload(payload *json.RawMessage) bool {
+	if !q.HasPayloadFilter() {
+		return true
+	}
+	if payload == nil {
+		return false
+	}
+	if q.PayloadContains != "" && !strings.Contains(string(*payload), q.PayloadContains) {
+		return false
+	}
+	if q.PayloadMatch.Path != "" {
+		return q.PayloadMatch.match(*payload)
+	}
+	return true
+}
+
+func (m PayloadMatch) match(payload json.RawMessage) bool {
+	var v interface{}
+	if err := json.Unmarshal(payload, &v); err != nil {
+		return false
+	}
+	path := strings.TrimPrefix(strings.TrimPrefix(m.Path, "$"), ".")
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			switch node := v.(type) {
+			case map[string]interface{}:
+				var ok bool
+				if v, ok = node[key]; !ok {
+					return false
+				}
+			case []interface{}:
+				idx, err := strconv.Atoi(key)
+				if err != nil || idx < 0 || idx >= len(node) {
+					return false
+				}
+				v = node[idx]
+			default:
+				return false
+			}
+		}
+	}
+	if s, ok := v.(string); ok {
+		return s == m.Value
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+	return string(encoded) == m.Value
+}
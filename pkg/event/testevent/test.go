@@ -52,6 +52,11 @@ type Query struct {
 	RunID         types.RunID
 	TestName      string
 	TestStepLabel string
+	TargetID      string
+	// PayloadContains and PayloadMatch select events by the content of their
+	// payload, see MatchPayload
+	PayloadContains string
+	PayloadMatch    PayloadMatch
 }
 
 // QueryField defines a function type used to set a field's value on Query objects
@@ -87,6 +92,11 @@ type queryFieldEmittedEndTime time.Time
 type queryFieldTestName string
 type queryFieldTestStepLabel string
 type queryFieldRunID types.RunID
+type queryFieldTargetID string
+type queryFieldPayloadContains string
+type queryFieldPayloadMatch PayloadMatch
+type queryFieldLimit uint
+type queryFieldOffset uint
 
 // QueryJobID sets the JobID field of the Query object
 func QueryJobID(jobID types.JobID) QueryField                            { return queryFieldJobID(jobID) }
@@ -137,6 +147,36 @@ func QueryRunID(runID types.RunID) QueryField {
 }
 func (value queryFieldRunID) queryFieldPointer(query *Query) interface{} { return &query.RunID }
 
+// QueryTargetID sets the TargetID field of the Query object
+func QueryTargetID(targetID string) QueryField {
+	return queryFieldTargetID(targetID)
+}
+func (value queryFieldTargetID) queryFieldPointer(query *Query) interface{} { return &query.TargetID }
+
+// QueryPayloadContains sets the PayloadContains field of the Query object
+func QueryPayloadContains(s string) QueryField {
+	return queryFieldPayloadContains(s)
+}
+func (value queryFieldPayloadContains) queryFieldPointer(query *Query) interface{} {
+	return &query.PayloadContains
+}
+
+// QueryPayloadMatch sets the PayloadMatch field of the Query object
+func QueryPayloadMatch(path, value string) QueryField {
+	return queryFieldPayloadMatch{Path: path, Value: value}
+}
+func (value queryFieldPayloadMatch) queryFieldPointer(query *Query) interface{} {
+	return &query.PayloadMatch
+}
+
+// QueryLimit sets the Limit field of the Query object
+func QueryLimit(limit uint) QueryField                                   { return queryFieldLimit(limit) }
+func (value queryFieldLimit) queryFieldPointer(query *Query) interface{} { return &query.Limit }
+
+// QueryOffset sets the Offset field of the Query object
+func QueryOffset(offset uint) QueryField                                  { return queryFieldOffset(offset) }
+func (value queryFieldOffset) queryFieldPointer(query *Query) interface{} { return &query.Offset }
+
 // Emitter defines the interface that emitter objects must implement
 type Emitter interface {
 	Emit(event Data) error
@@ -6,6 +6,7 @@
 package testevent_test
 
 import (
+	"encoding/json"
 	"errors"
 	"testing"
 	"time"
@@ -44,3 +45,35 @@ func TestBuildQuery_NoZeroValues(t *testing.T) {
 	assert.Error(t, err)
 	assert.True(t, errors.As(err, &event.ErrQueryFieldHasZeroValue{}))
 }
+
+func TestMatchPayload(t *testing.T) {
+	payload := json.RawMessage(`{"Results": [{"Stdout": "kernel panic", "ExitCode": 1}], "Ok": false}`)
+
+	query, err := BuildQuery(QueryPayloadContains("panic"))
+	assert.NoError(t, err)
+	assert.True(t, query.MatchPayload(&payload))
+	assert.False(t, query.MatchPayload(nil))
+
+	query, err = BuildQuery(QueryPayloadContains("oops"))
+	assert.NoError(t, err)
+	assert.False(t, query.MatchPayload(&payload))
+
+	for path, value := range map[string]string{
+		"$.Results.0.Stdout":  "kernel panic",
+		"Results.0.ExitCode":  "1",
+		"Ok":                  "false",
+		"$.Results.0":         `{"ExitCode":1,"Stdout":"kernel panic"}`,
+		"$.Results.1.Stdout":  "",
+		"Results.x":           "",
+		"Results.0.Stdout.no": "",
+	} {
+		query, err := BuildQuery(QueryPayloadMatch(path, value))
+		assert.NoError(t, err)
+		assert.Equal(t, value != "", query.MatchPayload(&payload), path)
+	}
+
+	// without payload filters, all events match
+	query, err = BuildQuery(QueryJobID(1))
+	assert.NoError(t, err)
+	assert.True(t, query.MatchPayload(nil))
+}
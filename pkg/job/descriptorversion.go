@@ -0,0 +1,99 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// DescriptorVersion is the version of the job descriptors of this version of
+// ConTest, set in their Version field. It is increased on every incompatible
+// change of JobDescriptor, along with a migration from the previous version,
+// so that the job descriptors stored with earlier jobs can still be resumed,
+// retried and rerun. Job descriptors without a Version are of version 0.
+const DescriptorVersion = 1
+
+// descriptorMigrations migrate the decoded job descriptors of each version to
+// the next one: descriptorMigrations[v] migrates version v to version v+1.
+var descriptorMigrations = []func(jd map[string]interface{}) error{
+	migrateDescriptorV0,
+}
+
+// migrateDescriptorV0 turns the single run reporter of the job descriptors of
+// version 0, set by ReporterName and ReporterParameters, into a run reporter
+// of Reporting, unless Reporting already sets some.
+func migrateDescriptorV0(jd map[string]interface{}) error {
+	name, _ := jd["ReporterName"].(string)
+	parameters := jd["ReporterParameters"]
+	delete(jd, "ReporterName")
+	delete(jd, "ReporterParameters")
+	if name == "" {
+		return nil
+	}
+	reporting, ok := jd["Reporting"].(map[string]interface{})
+	if !ok {
+		if jd["Reporting"] != nil {
+			return errors.New("invalid Reporting")
+		}
+		reporting = make(map[string]interface{})
+		jd["Reporting"] = reporting
+	}
+	if runReporters, _ := reporting["RunReporters"].([]interface{}); len(runReporters) > 0 {
+		return nil
+	}
+	reporting["RunReporters"] = []interface{}{
+		map[string]interface{}{"Name": name, "Parameters": parameters},
+	}
+	return nil
+}
+
+// descriptorVersion returns the version of a decoded job descriptor.
+func descriptorVersion(jd map[string]interface{}) (int, error) {
+	v, ok := jd["Version"]
+	if !ok || v == nil {
+		return 0, nil
+	}
+	f, ok := v.(float64)
+	if !ok || f < 0 || f != math.Trunc(f) {
+		return 0, fmt.Errorf("invalid job descriptor version %v", v)
+	}
+	if f > DescriptorVersion {
+		return 0, fmt.Errorf("job descriptor version %v is not supported, the latest version being %d", v, DescriptorVersion)
+	}
+	return int(f), nil
+}
+
+// MigrateDescriptor returns a JSON job descriptor migrated to
+// DescriptorVersion. Job descriptors of the current version, and the ones
+// which are not JSON objects, are returned unchanged, while the ones of a
+// later version are rejected.
+func MigrateDescriptor(jobDescriptor string) (string, error) {
+	var jd map[string]interface{}
+	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil || jd == nil {
+		return jobDescriptor, nil
+	}
+	version, err := descriptorVersion(jd)
+	if err != nil {
+		return "", err
+	}
+	if version == DescriptorVersion {
+		return jobDescriptor, nil
+	}
+	for v := version; v < DescriptorVersion; v++ {
+		if err := descriptorMigrations[v](jd); err != nil {
+			return "", fmt.Errorf("could not migrate job descriptor from version %d: %v", v, err)
+		}
+	}
+	jd["Version"] = DescriptorVersion
+	data, err := json.Marshal(jd)
+	if err != nil {
+		return "", fmt.Errorf("could not migrate job descriptor: %v", err)
+	}
+	return string(data), nil
+}
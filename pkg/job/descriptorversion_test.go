@@ -0,0 +1,50 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package job
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescriptorMigrations(t *testing.T) {
+	// every version but the current one is migrated
+	require.Equal(t, DescriptorVersion, len(descriptorMigrations))
+}
+
+func TestMigrateDescriptor(t *testing.T) {
+	// the run reporter of version 0 is moved to Reporting
+	migrated, err := MigrateDescriptor(`{"JobName": "test", "ReporterName": "TargetSuccess", "ReporterParameters": {"SuccessExpression": ">80%"}}`)
+	require.NoError(t, err)
+	var jd JobDescriptor
+	require.NoError(t, json.Unmarshal([]byte(migrated), &jd))
+	require.Equal(t, DescriptorVersion, jd.Version)
+	require.Equal(t, "test", jd.JobName)
+	require.Equal(t, 1, len(jd.Reporting.RunReporters))
+	require.Equal(t, "TargetSuccess", jd.Reporting.RunReporters[0].Name)
+	require.JSONEq(t, `{"SuccessExpression": ">80%"}`, string(jd.Reporting.RunReporters[0].Parameters))
+	require.NotContains(t, migrated, "ReporterName")
+
+	// the run reporters of Reporting are kept
+	migrated, err = MigrateDescriptor(`{"ReporterName": "noop", "Reporting": {"RunReporters": [{"Name": "TargetSuccess"}]}}`)
+	require.NoError(t, err)
+	jd = JobDescriptor{}
+	require.NoError(t, json.Unmarshal([]byte(migrated), &jd))
+	require.Equal(t, "TargetSuccess", jd.Reporting.RunReporters[0].Name)
+
+	// job descriptors of the current version are unchanged
+	current := `{"Version": 1, "JobName": "test"}`
+	migrated, err = MigrateDescriptor(current)
+	require.NoError(t, err)
+	require.Equal(t, current, migrated)
+
+	for _, invalid := range []string{`{"Version": 2}`, `{"Version": -1}`, `{"Version": 0.5}`, `{"Version": "1"}`} {
+		_, err = MigrateDescriptor(invalid)
+		require.Error(t, err, invalid)
+	}
+}
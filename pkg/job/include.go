@@ -0,0 +1,218 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IncludeKey is the key of the objects of job descriptors which include
+// fragments of a Library.
+const IncludeKey = "$include"
+
+// MaxIncludeDepth is the maximum nesting of the fragments including other
+// fragments.
+const MaxIncludeDepth = 8
+
+// fragmentNameRe matches valid fragment names, which cannot escape the
+// directory of the library.
+var fragmentNameRe = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// fragmentExtensions are the extensions of the files of the fragments, in
+// the order they are looked up.
+var fragmentExtensions = []string{".json", ".yaml", ".yml"}
+
+// Library is a directory of job descriptor fragments, e.g. common reporters
+// or target manager configurations, which job descriptors include by name
+// rather than copying them. A fragment named lab-targets is read from the
+// lab-targets.json, lab-targets.yaml or lab-targets.yml file of the
+// directory. Fragments are read every time they are included, so that the
+// library can be changed without restarting the server.
+type Library struct {
+	dir string
+}
+
+// NewLibrary returns the library of the fragments in a directory.
+func NewLibrary(dir string) *Library {
+	return &Library{dir: dir}
+}
+
+// Fragment returns the decoded JSON value of a fragment.
+func (l *Library) Fragment(name string) (interface{}, error) {
+	if !fragmentNameRe.MatchString(name) {
+		return nil, fmt.Errorf("invalid fragment name '%s'", name)
+	}
+	for _, ext := range fragmentExtensions {
+		data, err := ioutil.ReadFile(filepath.Join(l.dir, name+ext))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read fragment %s: %v", name, err)
+		}
+		var fragment interface{}
+		if ext == ".json" {
+			err = json.Unmarshal(data, &fragment)
+		} else {
+			err = yaml.Unmarshal(data, &fragment)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid fragment %s: %v", name, err)
+		}
+		return fragment, nil
+	}
+	return nil, fmt.Errorf("no fragment %s in the job descriptor library", name)
+}
+
+// Expand returns a JSON job descriptor with its includes replaced by the
+// fragments of the library. An object whose IncludeKey is the name of a
+// fragment, or a list of names, is replaced by these fragments merged in
+// order, and then by its other keys: objects are merged key by key, while
+// other values replace the previous ones. Fragments may include other
+// fragments. Job descriptors without includes are returned unchanged, and
+// the ones with includes are rejected if the library is nil.
+func (l *Library) Expand(jobDescriptor string) (string, error) {
+	if !strings.Contains(jobDescriptor, IncludeKey) {
+		return jobDescriptor, nil
+	}
+	var jd interface{}
+	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil {
+		return "", fmt.Errorf("invalid job descriptor: %v", err)
+	}
+	expanded, err := l.expand(jd, nil)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(expanded)
+	if err != nil {
+		return "", fmt.Errorf("could not expand job descriptor: %v", err)
+	}
+	return string(data), nil
+}
+
+// expand replaces the includes of a decoded JSON value. including lists the
+// fragments being included, to detect cycles.
+func (l *Library) expand(v interface{}, including []string) (interface{}, error) {
+	switch val := v.(type) {
+	case []interface{}:
+		for idx, item := range val {
+			expanded, err := l.expand(item, including)
+			if err != nil {
+				return nil, err
+			}
+			val[idx] = expanded
+		}
+		return val, nil
+	case map[string]interface{}:
+		for key, item := range val {
+			if key == IncludeKey {
+				continue
+			}
+			expanded, err := l.expand(item, including)
+			if err != nil {
+				return nil, err
+			}
+			val[key] = expanded
+		}
+		include, ok := val[IncludeKey]
+		if !ok {
+			return val, nil
+		}
+		names, err := includeNames(include)
+		if err != nil {
+			return nil, err
+		}
+		delete(val, IncludeKey)
+		var result interface{}
+		for _, name := range names {
+			fragment, err := l.include(name, including)
+			if err != nil {
+				return nil, err
+			}
+			result = merge(result, fragment)
+		}
+		if len(val) > 0 {
+			if _, ok := result.(map[string]interface{}); !ok {
+				return nil, fmt.Errorf("fragments %s are not objects, and cannot be merged with the keys of the including object", strings.Join(names, ", "))
+			}
+			result = merge(result, val)
+		}
+		return result, nil
+	}
+	return v, nil
+}
+
+// include returns a fragment, with its own includes expanded.
+func (l *Library) include(name string, including []string) (interface{}, error) {
+	if l == nil {
+		return nil, fmt.Errorf("job descriptor includes fragment %s, but the server has no job descriptor library", name)
+	}
+	for _, n := range including {
+		if n == name {
+			return nil, fmt.Errorf("fragment %s includes itself: %s", name, strings.Join(append(including, name), " -> "))
+		}
+	}
+	if len(including) >= MaxIncludeDepth {
+		return nil, fmt.Errorf("fragment %s is included by more than %d nested fragments", name, MaxIncludeDepth)
+	}
+	fragment, err := l.Fragment(name)
+	if err != nil {
+		return nil, err
+	}
+	return l.expand(fragment, append(including[:len(including):len(including)], name))
+}
+
+// includeNames returns the names of the fragments of an include, which is a
+// name or a list of names.
+func includeNames(include interface{}) ([]string, error) {
+	switch val := include.(type) {
+	case string:
+		return []string{val}, nil
+	case []interface{}:
+		names := make([]string, 0, len(val))
+		for _, item := range val {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid %s, expected fragment names", IncludeKey)
+			}
+			names = append(names, name)
+		}
+		if len(names) > 0 {
+			return names, nil
+		}
+	}
+	return nil, errors.New("invalid " + IncludeKey + ", expected a fragment name or a list of fragment names")
+}
+
+// merge returns the value of base overridden by the one of override: objects
+// are merged key by key, other values are replaced.
+func merge(base, override interface{}) interface{} {
+	baseObj, ok := base.(map[string]interface{})
+	if !ok {
+		return override
+	}
+	overrideObj, ok := override.(map[string]interface{})
+	if !ok {
+		return override
+	}
+	merged := make(map[string]interface{}, len(baseObj)+len(overrideObj))
+	for key, v := range baseObj {
+		merged[key] = v
+	}
+	for key, v := range overrideObj {
+		merged[key] = merge(merged[key], v)
+	}
+	return merged
+}
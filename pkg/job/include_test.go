@@ -0,0 +1,76 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package job
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLibraryExpand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "contest-library")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fragments := map[string]string{
+		"reporting.json": `{"RunReporters": [{"Name": "TargetSuccess", "Parameters": {"SuccessExpression": ">80%"}}]}`,
+		"lab.yaml":       "TargetManagerName: TargetList\nTargetManagerAcquireParameters:\n  Targets:\n    - ID: id1\n  Shuffle: true\n",
+		"lab-ssh.yaml":   "$include: lab\nTestFetcherName: literal\n",
+		"loop.json":      `{"$include": "loop"}`,
+	}
+	for name, data := range fragments {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+	}
+	l := NewLibrary(dir)
+
+	// job descriptors without includes are unchanged
+	jd := `{"JobName": "test", "Runs": 1}`
+	expanded, err := l.Expand(jd)
+	require.NoError(t, err)
+	require.Equal(t, jd, expanded)
+
+	// the keys of the including objects override the ones of the fragments
+	expanded, err = l.Expand(`{
+		"JobName": "test",
+		"Reporting": {"$include": "reporting"},
+		"TestDescriptors": [{"$include": "lab-ssh", "TargetManagerAcquireParameters": {"Shuffle": false}}]
+	}`)
+	require.NoError(t, err)
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(expanded), &decoded))
+	require.Equal(t, map[string]interface{}{
+		"JobName": "test",
+		"Reporting": map[string]interface{}{
+			"RunReporters": []interface{}{map[string]interface{}{"Name": "TargetSuccess", "Parameters": map[string]interface{}{"SuccessExpression": ">80%"}}},
+		},
+		"TestDescriptors": []interface{}{map[string]interface{}{
+			"TargetManagerName": "TargetList",
+			"TargetManagerAcquireParameters": map[string]interface{}{
+				"Targets": []interface{}{map[string]interface{}{"ID": "id1"}},
+				"Shuffle": false,
+			},
+			"TestFetcherName": "literal",
+		}},
+	}, decoded)
+
+	_, err = l.Expand(`{"Reporting": {"$include": "missing"}}`)
+	require.Error(t, err)
+	_, err = l.Expand(`{"Reporting": {"$include": "../reporting"}}`)
+	require.Error(t, err)
+	_, err = l.Expand(`{"Reporting": {"$include": "loop"}}`)
+	require.Error(t, err)
+	_, err = l.Expand(`{"Reporting": {"$include": 1}}`)
+	require.Error(t, err)
+
+	// includes are rejected without a library
+	var none *Library
+	_, err = none.Expand(`{"Reporting": {"$include": "reporting"}}`)
+	require.Error(t, err)
+}
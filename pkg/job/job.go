@@ -17,14 +17,83 @@ import (
 // JobDescriptor models the JSON encoded blob which is given as input to the
 // job creation request. A JobDescriptor embeds a list of TestDescriptor.
 type JobDescriptor struct {
-	JobName         string
-	Tags            []string
-	Runs            uint
-	RunInterval     xjson.Duration
+	// Version is the version of the format of the job descriptor, see
+	// DescriptorVersion. Job descriptors of earlier versions are migrated.
+	Version     int `json:",omitempty"`
+	JobName     string
+	Tags        []string
+	Runs        uint
+	RunInterval xjson.Duration
+	// TargetTimeout is the maximum time a target can spend in the pipeline
+	// of a test. Zero means no limit.
+	TargetTimeout xjson.Duration `json:",omitempty"`
+	// Timeout is the maximum time the job may run, after which it is
+	// cancelled and fails. Zero means no limit.
+	Timeout        xjson.Duration `json:",omitempty"`
+	AbortThreshold AbortThreshold
+	// TargetBatchSize is the number of targets injected into the pipeline of
+	// a test at once. Zero means all targets are injected at once.
+	TargetBatchSize uint `json:",omitempty"`
+	// MaxParallelTests is the maximum number of tests of the job which run
+	// at the same time. Zero or one means that tests run sequentially.
+	MaxParallelTests uint `json:",omitempty"`
+	// Priority orders the jobs waiting to run when the server runs as many
+	// jobs as it can: jobs of higher priority start first, and jobs of the
+	// same priority start in submission order. It may be negative, e.g. for
+	// bulk jobs.
+	Priority int `json:",omitempty"`
+	// StartAt is the time before which the job does not start, e.g. the
+	// start of a maintenance window. Jobs starting in the past start at once.
+	StartAt *time.Time `json:",omitempty"`
+	// DependsOn lists the jobs which must complete successfully before the
+	// job starts. The job fails if any of them fails or is cancelled.
+	DependsOn []types.JobID `json:",omitempty"`
+	// Retry defines whether the job is started again if it fails.
+	Retry RetryPolicy
+	// TargetIDs restricts the tests to the acquired targets with these IDs,
+	// e.g. to run again the targets which failed. Empty means all targets.
+	TargetIDs []string `json:",omitempty"`
+	// Webhooks are URLs called with a signed JSON payload whenever the job
+	// changes state, in addition to the webhooks of the server.
+	Webhooks        []string `json:",omitempty"`
 	TestDescriptors []*test.TestDescriptor
 	Reporting       Reporting
 }
 
+// AbortThreshold defines when a test is aborted early, failing the job,
+// because too many targets failed. Zero values disable the respective check.
+type AbortThreshold struct {
+	// MaxFailedTargets aborts the test once more than this number of targets
+	// failed.
+	MaxFailedTargets uint
+	// MaxFailedPercent aborts the test once more than this percentage of the
+	// targets failed.
+	MaxFailedPercent float64
+}
+
+// Exceeded returns whether the threshold is exceeded given the number of
+// failed targets and the total number of targets in the test.
+func (a AbortThreshold) Exceeded(failed, total int) bool {
+	if a.MaxFailedTargets > 0 && failed > int(a.MaxFailedTargets) {
+		return true
+	}
+	if a.MaxFailedPercent > 0 && total > 0 && float64(failed)*100/float64(total) > a.MaxFailedPercent {
+		return true
+	}
+	return false
+}
+
+// RetryPolicy defines whether a job is started again when it fails, or when
+// any of its reports is unsuccessful. Each retry is a new job, linked to the
+// original job. Zero values disable retries.
+type RetryPolicy struct {
+	// MaxRetries is the number of times the job is started again.
+	MaxRetries uint
+	// FailedTargetsOnly restricts the retries to the targets which did not
+	// pass the job being retried.
+	FailedTargetsOnly bool `json:",omitempty"`
+}
+
 // Job is used to run a type of test job on a given set of targets.
 type Job struct {
 	ID   types.JobID
@@ -54,6 +123,81 @@ type Job struct {
 	// unlimited, are specified.
 	RunInterval time.Duration
 
+	// TargetTimeout is the maximum time a target can spend in the pipeline
+	// of a test. Targets exceeding it are failed wherever they are in the
+	// pipeline, so that a single slow target cannot hold the whole job.
+	// Zero means no limit.
+	TargetTimeout time.Duration
+
+	// Timeout is the maximum time the job may run. A job running longer is
+	// cancelled like on request, so that its targets are released and its
+	// cleanup steps run, and then fails. The time spent waiting to run is
+	// not counted. Zero means no limit.
+	Timeout time.Duration
+
+	// AbortThreshold defines when a test is aborted because too many targets
+	// failed.
+	AbortThreshold AbortThreshold
+
+	// TargetBatchSize is the number of targets which are injected into the
+	// pipeline of a test at once. Each batch is injected only once the
+	// previous one has completed the whole pipeline, so that steps with
+	// limited capacity don't need to throttle targets themselves. Steps must
+	// not hold targets until their input channel is closed when batching is
+	// enabled. Zero means that all targets are injected at once.
+	TargetBatchSize uint
+
+	// MaxParallelTests is the maximum number of tests which run at the same
+	// time within a run of the job. Each test acquires, locks and releases
+	// its own targets, so tests running concurrently should not share
+	// targets. The reports are built from the events of all the tests, as
+	// in sequential runs. Zero or one means that tests run sequentially, in
+	// the order they are defined.
+	MaxParallelTests uint
+
+	// Priority orders the jobs waiting in the run queue of the JobManager,
+	// higher first.
+	Priority int
+
+	// StartAt is the time before which the job does not start. The job is
+	// held until then, and then waits for the jobs it depends on, or for a
+	// run slot, like a job submitted at that time. Zero means that the job
+	// starts at once.
+	StartAt time.Time
+
+	// DependsOn lists the jobs which must complete successfully before the
+	// job starts.
+	DependsOn []types.JobID
+
+	// ScheduleID is the ID of the schedule which started the job, if any.
+	ScheduleID types.ScheduleID
+
+	// Retry defines whether the job is started again when it fails.
+	Retry RetryPolicy
+
+	// RetryOf is the ID of the job which this job retries, if any. Retries
+	// of retries are linked to the original job.
+	RetryOf types.JobID
+
+	// RerunOf is the ID of the job which this job reruns on request, if
+	// any. Reruns of reruns are linked to the job they rerun.
+	RerunOf types.JobID
+
+	// TargetIDs restricts the tests to the acquired targets with these IDs.
+	// The other targets are unlocked as soon as they are acquired. Empty
+	// means all targets.
+	TargetIDs []string
+
+	// Webhooks are URLs called by the JobManager whenever the job changes
+	// state.
+	Webhooks []string
+
+	// ResumeRunID is the run from which a job resumes after the server
+	// running it stopped, and which runs again from its start. The runs
+	// before it are only reported. Zero means that the job runs from the
+	// first run.
+	ResumeRunID types.RunID
+
 	// TestDescriptors is the string form of the fetched test step
 	// descriptors.
 	TestDescriptors string
@@ -86,6 +230,16 @@ func (j *Job) IsCancelled() bool {
 	}
 }
 
+// IsPaused returns whether the job has been paused
+func (j *Job) IsPaused() bool {
+	select {
+	case _, ok := <-j.PauseCh:
+		return !ok
+	default:
+		return false
+	}
+}
+
 // InfoFetcher defines how to fetch job information
 type InfoFetcher interface {
 	FetchJob(types.JobID) (*Job, error)
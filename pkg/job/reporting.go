@@ -8,6 +8,8 @@ package job
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/facebookincubator/contest/pkg/event/testevent"
@@ -52,6 +54,16 @@ type Reporter interface {
 	FinalReport(cancel <-chan struct{}, parameters interface{}, runStatuses []RunStatus, ev testevent.Fetcher) (bool, interface{}, error)
 }
 
+// ReporterWithSchema is implemented by Reporters which publish JSON schemas of
+// their run and final parameters. Either may be nil, if the parameters are
+// not described. Descriptors are validated against them before
+// ValidateRunParameters and ValidateFinalParameters are called.
+type ReporterWithSchema interface {
+	Reporter
+	RunParametersSchema() json.RawMessage
+	FinalParametersSchema() json.RawMessage
+}
+
 // ReporterBundle bundles the selected Reporter together with its parameters
 // based on the content of the job descriptor
 type ReporterBundle struct {
@@ -61,10 +73,12 @@ type ReporterBundle struct {
 
 // Report wraps the information of a run report or a final report.
 type Report struct {
-	ReporterName string
-	Success      bool
-	ReportTime   time.Time
-	Data         interface{}
+	// SchemaVersion is the version of ReportSchema the report conforms to
+	SchemaVersion int
+	ReporterName  string
+	Success       bool
+	ReportTime    time.Time
+	Data          interface{}
 }
 
 // JobReport represents the whole job report generated by ConTest.
@@ -83,3 +97,52 @@ func (r *Report) ToJSON() ([]byte, error) {
 	err := encoder.Encode(r.Data)
 	return buffer.Bytes(), err
 }
+
+// FindReport returns the report of the given reporter, matched case
+// insensitively. If runID is 0, the final report is returned if there is one,
+// or the report of the last run otherwise.
+func (r *JobReport) FindReport(reporter string, runID int) (*Report, error) {
+	find := func(reports []*Report) *Report {
+		for _, report := range reports {
+			if strings.EqualFold(report.ReporterName, reporter) {
+				return report
+			}
+		}
+		return nil
+	}
+	if runID == 0 {
+		if report := find(r.FinalReports); report != nil {
+			return report, nil
+		}
+		if len(r.RunReports) > 0 {
+			if report := find(r.RunReports[len(r.RunReports)-1]); report != nil {
+				return report, nil
+			}
+		}
+		return nil, fmt.Errorf("no report from reporter %s", reporter)
+	}
+	if runID < 1 || runID > len(r.RunReports) {
+		return nil, fmt.Errorf("invalid run %d", runID)
+	}
+	if report := find(r.RunReports[runID-1]); report != nil {
+		return report, nil
+	}
+	return nil, fmt.Errorf("no report from reporter %s for run %d", reporter, runID)
+}
+
+// Successful returns whether all the reports of the job are successful.
+func (r *JobReport) Successful() bool {
+	for _, runReports := range r.RunReports {
+		for _, report := range runReports {
+			if !report.Success {
+				return false
+			}
+		}
+	}
+	for _, report := range r.FinalReports {
+		if !report.Success {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package job
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ReportSchemaVersion is the version of the schema of the reports produced by
+// this version of ConTest. It is stored along with each report, and it is
+// increased on every incompatible change of ReportSchema, so that clients
+// can tell reports of different versions apart.
+const ReportSchemaVersion = 1
+
+// Limits enforced by the report schema, which match what the storage can
+// hold.
+const (
+	MaxReporterNameLength = 32
+	MaxReportDataSize     = 65535
+)
+
+// ReportSchema is the JSON schema of run and final reports, as returned by
+// the API. Data is whatever the reporter returned, encoded as JSON.
+var ReportSchema = fmt.Sprintf(`{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"$id": "https://github.com/facebookincubator/contest/schemas/report/v%d.json",
+	"title": "ConTest report",
+	"type": "object",
+	"properties": {
+		"SchemaVersion": {"type": "integer", "minimum": 1, "maximum": %d},
+		"ReporterName": {"type": "string", "minLength": 1, "maxLength": %d},
+		"Success": {"type": "boolean"},
+		"ReportTime": {"type": "string", "format": "date-time"},
+		"Data": {}
+	},
+	"required": ["SchemaVersion", "ReporterName", "Success", "ReportTime", "Data"]
+}`, ReportSchemaVersion, ReportSchemaVersion, MaxReporterNameLength)
+
+// Validate checks that the report conforms to ReportSchema, and that its
+// data fits in the storage.
+func (r *Report) Validate() error {
+	if r.SchemaVersion < 1 || r.SchemaVersion > ReportSchemaVersion {
+		return fmt.Errorf("unsupported report schema version %d", r.SchemaVersion)
+	}
+	if r.ReporterName == "" {
+		return fmt.Errorf("reporter name cannot be empty")
+	}
+	if len(r.ReporterName) > MaxReporterNameLength {
+		return fmt.Errorf("reporter name '%s' is longer than %d characters", r.ReporterName, MaxReporterNameLength)
+	}
+	if r.ReportTime.IsZero() {
+		return fmt.Errorf("report time cannot be empty")
+	}
+	data, err := r.ToJSON()
+	if err != nil {
+		return fmt.Errorf("report data cannot be encoded as JSON: %v", err)
+	}
+	if len(data) > MaxReportDataSize {
+		return fmt.Errorf("report data is %d bytes, which is more than the maximum of %d", len(data), MaxReportDataSize)
+	}
+	if !json.Valid(data) {
+		return fmt.Errorf("report data is not valid JSON")
+	}
+	return nil
+}
+
+// EnforceSchema validates all the reports, and replaces the data of the
+// invalid ones with the validation error, marking them as unsuccessful, so
+// that they can be stored and clients can rely on the schema. It returns the
+// validation errors.
+func (r *JobReport) EnforceSchema() []error {
+	var errs []error
+	enforce := func(report *Report) {
+		if err := report.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("invalid report from %s: %v", report.ReporterName, err))
+			if len(report.ReporterName) > MaxReporterNameLength {
+				report.ReporterName = report.ReporterName[:MaxReporterNameLength]
+			}
+			if report.ReportTime.IsZero() {
+				report.ReportTime = time.Now()
+			}
+			report.SchemaVersion = ReportSchemaVersion
+			report.Success = false
+			report.Data = fmt.Sprintf("invalid report: %v", err)
+		}
+	}
+	for _, runReports := range r.RunReports {
+		for _, report := range runReports {
+			enforce(report)
+		}
+	}
+	for _, report := range r.FinalReports {
+		enforce(report)
+	}
+	return errs
+}
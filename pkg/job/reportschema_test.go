@@ -0,0 +1,49 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package job
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportSchema(t *testing.T) {
+	require.True(t, json.Valid([]byte(ReportSchema)))
+}
+
+func TestReportValidate(t *testing.T) {
+	valid := Report{SchemaVersion: ReportSchemaVersion, ReporterName: "TargetSuccess", ReportTime: time.Now(), Data: []string{"ok"}}
+	require.NoError(t, valid.Validate())
+
+	for name, report := range map[string]Report{
+		"no version":   {ReporterName: "TargetSuccess", ReportTime: time.Now()},
+		"future":       {SchemaVersion: ReportSchemaVersion + 1, ReporterName: "TargetSuccess", ReportTime: time.Now()},
+		"no name":      {SchemaVersion: ReportSchemaVersion, ReportTime: time.Now()},
+		"long name":    {SchemaVersion: ReportSchemaVersion, ReporterName: strings.Repeat("x", MaxReporterNameLength+1), ReportTime: time.Now()},
+		"no time":      {SchemaVersion: ReportSchemaVersion, ReporterName: "TargetSuccess"},
+		"not json":     {SchemaVersion: ReportSchemaVersion, ReporterName: "TargetSuccess", ReportTime: time.Now(), Data: func() {}},
+		"data too big": {SchemaVersion: ReportSchemaVersion, ReporterName: "TargetSuccess", ReportTime: time.Now(), Data: strings.Repeat("x", MaxReportDataSize)},
+	} {
+		require.Error(t, report.Validate(), name)
+	}
+}
+
+func TestEnforceSchema(t *testing.T) {
+	valid := &Report{SchemaVersion: ReportSchemaVersion, ReporterName: "noop", Success: true, ReportTime: time.Now(), Data: "ok"}
+	invalid := &Report{SchemaVersion: ReportSchemaVersion, ReporterName: "noop", Success: true, ReportTime: time.Now(), Data: make(chan int)}
+	jobReport := JobReport{RunReports: [][]*Report{{valid, invalid}}}
+	errs := jobReport.EnforceSchema()
+	require.Len(t, errs, 1)
+	require.True(t, valid.Success)
+	require.Equal(t, "ok", valid.Data)
+	require.False(t, invalid.Success)
+	require.Contains(t, invalid.Data, "invalid report")
+	require.NoError(t, invalid.Validate())
+}
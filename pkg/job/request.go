@@ -22,4 +22,12 @@ type Request struct {
 	// TestDescriptors are the fetched test steps as per the test fetcher
 	// defined in the JobDescriptor above.
 	TestDescriptors string
+	// Tags are the tags of the job descriptor, by which jobs are looked up.
+	Tags []string
+	// ScheduleID is the ID of the schedule which started the job, if any.
+	ScheduleID types.ScheduleID
+	// RetryOf is the ID of the job which this job retries, if any.
+	RetryOf types.JobID
+	// RerunOf is the ID of the job which this job reruns, if any.
+	RerunOf types.JobID
 }
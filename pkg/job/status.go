@@ -45,6 +45,16 @@ type TargetStatus struct {
 	InTime  time.Time
 	OutTime time.Time
 	Error   string
+	// Skipped is true if the TestStep skipped the Target rather than
+	// failing it. In this case Error is empty, and SkipReason explains why.
+	Skipped    bool
+	SkipReason string
+	// Attempts is the number of times the Target was injected into the
+	// TestStep, if it was retried. It is zero otherwise.
+	Attempts int
+	// LastHeartbeat is the time of the last heartbeat emitted by the
+	// TestStep for the Target, if any. Heartbeats are not listed in Events.
+	LastHeartbeat time.Time
 	// these are events that have an associated target. For events
 	// that are not associated to a target, see TestStepStatus.Events .
 	Events []testevent.Event
@@ -60,11 +70,61 @@ type TestStepStatus struct {
 	TargetStatuses []TargetStatus
 }
 
+// TargetResult represents the final result of a Target in a Test
+type TargetResult struct {
+	Target *target.Target
+	target.Result
+	// Duration is how long the Target took to complete the Test, if known
+	Duration time.Duration `json:",omitempty"`
+}
+
+// TargetProgress tells which TestStep a Target is currently in
+type TargetProgress struct {
+	Target        *target.Target
+	TestStepLabel string
+}
+
+// TestStepProgress summarizes how many Targets went through a TestStep and
+// how fast
+type TestStepProgress struct {
+	TestStepLabel string
+	// InProgress is the number of Targets currently in the TestStep
+	InProgress int
+	// Completed is the number of Targets which left the TestStep, whether
+	// they succeeded or not, and Failed is how many of them failed
+	Completed int
+	Failed    int
+	// Throughput is the number of Targets completed per second, from the
+	// time the first Target entered the TestStep until the last one left it,
+	// or until now if Targets are still in the TestStep
+	Throughput float64
+}
+
+// TestProgress summarizes the progress of the Targets in a Test
+type TestProgress struct {
+	// Total is the number of Targets acquired for the Test
+	Total int
+	// InProgress is the number of Targets which are currently in a TestStep,
+	// and Completed is the number of Targets which have a result
+	InProgress int
+	Completed  int
+	// Targets lists the Targets which are currently in a TestStep, in order
+	// of acquisition
+	Targets []TargetProgress
+	// Steps has the progress of each TestStep, in order of execution
+	Steps []TestStepProgress
+}
+
 // TestStatus bundles together all TestStepStatus for a specific Test within the run
 type TestStatus struct {
 	TestCoordinates
 	TestStepStatuses []TestStepStatus
 	TargetStatuses   []TargetStatus
+	// TargetResults holds the result of each Target which completed the
+	// Test, in order of acquisition
+	TargetResults []TargetResult
+	// Progress summarizes where the Targets are in the Test
+	Progress TestProgress
 }
 
 // RunStatus bundles together all TestStatus for a specific run within the job
@@ -80,6 +140,9 @@ type Status struct {
 	// Name is the name of the job.
 	Name string
 
+	// Tags are the tags of the job.
+	Tags []string `json:",omitempty"`
+
 	// State represents the last recorded state of a job
 	State string
 
@@ -93,9 +156,21 @@ type Status struct {
 	// EndTime indicates when the job ended.
 	EndTime *time.Time
 
+	// StartAt is the time before which the job does not start, if any.
+	StartAt *time.Time `json:",omitempty"`
+
 	// RunStatuses represents the status of the current run of the job
 	RunStatus RunStatus
 
 	// Job report information
 	JobReport *JobReport
+
+	// ScheduleID is the ID of the schedule which started the job, if any.
+	ScheduleID types.ScheduleID `json:",omitempty"`
+
+	// RetryOf is the ID of the job which this job retries, if any.
+	RetryOf types.JobID `json:",omitempty"`
+
+	// RerunOf is the ID of the job which this job reruns, if any.
+	RerunOf types.JobID `json:",omitempty"`
 }
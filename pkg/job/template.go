@@ -0,0 +1,187 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// templateVariableRe matches the references to the variables of a
+	// template, e.g. ${platform}, and the escaped ones, e.g. $${HOME}.
+	templateVariableRe = regexp.MustCompile(`\$(\$?)\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+	// templateVariableNameRe matches valid variable names.
+	templateVariableNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// TemplateVariable is a variable declared by a job template. A variable
+// without a default value must be given a value when the template is used.
+type TemplateVariable struct {
+	Name        string
+	Description string  `json:",omitempty"`
+	Default     *string `json:",omitempty"`
+}
+
+// Template is a job descriptor skeleton, stored by the server, from which
+// jobs are started by name. Its string values may reference the declared
+// variables as ${name}, which are replaced by the values given when the
+// template is used, while $${name} stands for the literal ${name}, e.g. for
+// shell variables. References to undeclared variables are not allowed, and
+// values are only substituted within strings, so that they cannot alter the
+// structure of the job descriptor.
+type Template struct {
+	Name          string
+	Description   string `json:",omitempty"`
+	Variables     []TemplateVariable
+	JobDescriptor json.RawMessage
+}
+
+// walkStrings calls f on every string of a decoded JSON value, and replaces
+// the strings with the values it returns.
+func walkStrings(v interface{}, f func(string) (string, error)) (interface{}, error) {
+	switch val := v.(type) {
+	case string:
+		return f(val)
+	case []interface{}:
+		for idx, item := range val {
+			s, err := walkStrings(item, f)
+			if err != nil {
+				return nil, err
+			}
+			val[idx] = s
+		}
+	case map[string]interface{}:
+		for key, item := range val {
+			s, err := walkStrings(item, f)
+			if err != nil {
+				return nil, err
+			}
+			val[key] = s
+		}
+	}
+	return v, nil
+}
+
+// Validate checks that the variables of the template are declared once, and
+// that its job descriptor is a JSON object which only references declared
+// variables.
+func (t *Template) Validate() error {
+	if strings.TrimSpace(t.Name) == "" {
+		return errors.New("template name cannot be empty")
+	}
+	declared := make(map[string]bool, len(t.Variables))
+	for _, v := range t.Variables {
+		if !templateVariableNameRe.MatchString(v.Name) {
+			return fmt.Errorf("invalid template variable name '%s'", v.Name)
+		}
+		if declared[v.Name] {
+			return fmt.Errorf("template variable '%s' is declared more than once", v.Name)
+		}
+		declared[v.Name] = true
+	}
+	var jd map[string]interface{}
+	if err := json.Unmarshal(t.JobDescriptor, &jd); err != nil {
+		return fmt.Errorf("invalid job descriptor in template: %v", err)
+	}
+	_, err := walkStrings(jd, func(s string) (string, error) {
+		for _, match := range templateVariableRe.FindAllStringSubmatch(s, -1) {
+			if match[1] == "" && !declared[match[2]] {
+				return "", fmt.Errorf("template references undeclared variable '%s'", match[2])
+			}
+		}
+		return s, nil
+	})
+	return err
+}
+
+// Render returns the job descriptor of the template, with its variables
+// replaced by the given values or by their default values. All the values
+// must be of declared variables, and all the variables without a default
+// must have a value.
+func (t *Template) Render(values map[string]string) (string, error) {
+	if err := t.Validate(); err != nil {
+		return "", err
+	}
+	resolved := make(map[string]string, len(t.Variables))
+	var missing []string
+	for _, v := range t.Variables {
+		if value, ok := values[v.Name]; ok {
+			resolved[v.Name] = value
+		} else if v.Default != nil {
+			resolved[v.Name] = *v.Default
+		} else {
+			missing = append(missing, v.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("template %s requires values for variables %s", t.Name, strings.Join(missing, ", "))
+	}
+	var unknown []string
+	for name := range values {
+		if _, ok := resolved[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return "", fmt.Errorf("template %s does not declare variables %s", t.Name, strings.Join(unknown, ", "))
+	}
+	var jd interface{}
+	if err := json.Unmarshal(t.JobDescriptor, &jd); err != nil {
+		return "", fmt.Errorf("invalid job descriptor in template: %v", err)
+	}
+	jd, _ = walkStrings(jd, func(s string) (string, error) {
+		return templateVariableRe.ReplaceAllStringFunc(s, func(ref string) string {
+			if strings.HasPrefix(ref, "$$") {
+				return ref[1:]
+			}
+			return resolved[ref[2:len(ref)-1]]
+		}), nil
+	})
+	data, err := json.Marshal(jd)
+	if err != nil {
+		return "", fmt.Errorf("could not render template %s: %v", t.Name, err)
+	}
+	return string(data), nil
+}
+
+// JobNamePattern returns a regular expression matching the names of the jobs
+// started from the template, whatever the values of the variables referenced
+// by the JobName of its job descriptor.
+func (t *Template) JobNamePattern() (*regexp.Regexp, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	var jd struct {
+		JobName string
+	}
+	if err := json.Unmarshal(t.JobDescriptor, &jd); err != nil {
+		return nil, fmt.Errorf("invalid job descriptor in template: %v", err)
+	}
+	var (
+		pattern strings.Builder
+		last    int
+	)
+	pattern.WriteString("^")
+	for _, loc := range templateVariableRe.FindAllStringSubmatchIndex(jd.JobName, -1) {
+		pattern.WriteString(regexp.QuoteMeta(jd.JobName[last:loc[0]]))
+		if loc[3] > loc[2] {
+			// escaped reference, rendered as a literal ${name}
+			pattern.WriteString(regexp.QuoteMeta(jd.JobName[loc[0]+1 : loc[1]]))
+		} else {
+			pattern.WriteString("(?s:.*)")
+		}
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(jd.JobName[last:]))
+	pattern.WriteString("$")
+	return regexp.Compile(pattern.String())
+}
@@ -0,0 +1,73 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package job
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTemplate(t *testing.T, jobDescriptor string, variables ...TemplateVariable) *Template {
+	require.True(t, json.Valid([]byte(jobDescriptor)))
+	return &Template{Name: "flash", Variables: variables, JobDescriptor: json.RawMessage(jobDescriptor)}
+}
+
+func TestTemplateRender(t *testing.T) {
+	defaultBuild := "latest"
+	tmpl := newTemplate(t,
+		`{"JobName": "flash ${platform}", "Runs": 1, "Tags": ["${platform}", "build-${build}"], "Cmd": "echo $${HOME}"}`,
+		TemplateVariable{Name: "platform"},
+		TemplateVariable{Name: "build", Default: &defaultBuild},
+	)
+	require.NoError(t, tmpl.Validate())
+
+	jd, err := tmpl.Render(map[string]string{"platform": `x86 "v2"`})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"JobName": "flash x86 \"v2\"", "Runs": 1, "Tags": ["x86 \"v2\"", "build-latest"], "Cmd": "echo ${HOME}"}`, jd)
+
+	jd, err = tmpl.Render(map[string]string{"platform": "arm", "build": "42"})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"JobName": "flash arm", "Runs": 1, "Tags": ["arm", "build-42"], "Cmd": "echo ${HOME}"}`, jd)
+
+	_, err = tmpl.Render(nil)
+	require.Error(t, err)
+	_, err = tmpl.Render(map[string]string{"platform": "arm", "board": "a"})
+	require.Error(t, err)
+}
+
+func TestTemplateValidate(t *testing.T) {
+	for name, tmpl := range map[string]*Template{
+		"no name":      {JobDescriptor: json.RawMessage(`{}`)},
+		"undeclared":   newTemplate(t, `{"JobName": "${platform}"}`),
+		"invalid name": newTemplate(t, `{}`, TemplateVariable{Name: "a-b"}),
+		"duplicated":   newTemplate(t, `{}`, TemplateVariable{Name: "a"}, TemplateVariable{Name: "a"}),
+		"not object":   newTemplate(t, `[]`),
+	} {
+		require.Error(t, tmpl.Validate(), name)
+	}
+}
+
+func TestTemplateJobNamePattern(t *testing.T) {
+	tmpl := newTemplate(t,
+		`{"JobName": "flash ${platform} (build $${BUILD})", "Runs": 1}`,
+		TemplateVariable{Name: "platform"},
+	)
+	pattern, err := tmpl.JobNamePattern()
+	require.NoError(t, err)
+	jd, err := tmpl.Render(map[string]string{"platform": "x86 v2"})
+	require.NoError(t, err)
+	var rendered struct{ JobName string }
+	require.NoError(t, json.Unmarshal([]byte(jd), &rendered))
+	require.True(t, pattern.MatchString(rendered.JobName))
+	require.True(t, pattern.MatchString("flash  (build ${BUILD})"))
+	require.False(t, pattern.MatchString("flash arm (build 42)"))
+	require.False(t, pattern.MatchString("reflash arm (build ${BUILD})"))
+
+	_, err = newTemplate(t, `{"JobName": "${platform}"}`).JobNamePattern()
+	require.Error(t, err)
+}
@@ -0,0 +1,223 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// ApprovalPolicy selects the submitted jobs which wait for the approval of an
+// operator before they start, e.g. the jobs testing production targets. A job
+// matches the policy if it has any of the Tags, or if any of its tests
+// acquires targets with one of the TargetManagers, or with acquire parameters
+// matching the TargetParameters regular expression.
+type ApprovalPolicy struct {
+	Tags             []string `json:"tags"`
+	TargetManagers   []string `json:"targetManagers"`
+	TargetParameters string   `json:"targetParameters"`
+
+	targetParametersRe *regexp.Regexp
+}
+
+// NewApprovalPolicy returns an ApprovalPolicy matching the jobs with any of
+// the tags, or acquiring targets with any of the target managers, or with
+// acquire parameters matching targetParameters, if not empty.
+func NewApprovalPolicy(tags, targetManagers []string, targetParameters string) (*ApprovalPolicy, error) {
+	p := ApprovalPolicy{
+		Tags:             tags,
+		TargetManagers:   targetManagers,
+		TargetParameters: targetParameters,
+	}
+	if targetParameters != "" {
+		re, err := regexp.Compile(targetParameters)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target parameters expression: %v", err)
+		}
+		p.targetParametersRe = re
+	}
+	return &p, nil
+}
+
+// LoadApprovalPolicy reads an ApprovalPolicy from a JSON file, e.g.
+//
+//	{"tags": ["production"], "targetParameters": "\"Pool\":\\s*\"prod"}
+func LoadApprovalPolicy(path string) (*ApprovalPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read approval policy file: %v", err)
+	}
+	var p ApprovalPolicy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("cannot parse approval policy file %s: %v", path, err)
+	}
+	return NewApprovalPolicy(p.Tags, p.TargetManagers, p.TargetParameters)
+}
+
+// match returns why a job descriptor matches the policy, or an empty string
+// if it does not.
+func (p *ApprovalPolicy) match(jd *job.JobDescriptor) string {
+	for _, tag := range jd.Tags {
+		for _, t := range p.Tags {
+			if tag == t {
+				return fmt.Sprintf("job has tag %s", tag)
+			}
+		}
+	}
+	for _, td := range jd.TestDescriptors {
+		for _, name := range p.TargetManagers {
+			if td.TargetManagerName == name {
+				return fmt.Sprintf("job acquires targets with target manager %s", name)
+			}
+		}
+		if p.targetParametersRe != nil && p.targetParametersRe.Match(td.TargetManagerAcquireParameters) {
+			return fmt.Sprintf("job acquires targets with parameters matching %s", p.TargetParameters)
+		}
+	}
+	return ""
+}
+
+// RequireApproval makes the jobs matching the policy wait for the approval of
+// an operator, see api.PermissionApproveJobs, before they start. Retries of
+// approved jobs do not need to be approved again.
+func RequireApproval(p *ApprovalPolicy) Opt {
+	return func(jm *JobManager) {
+		jm.approvalPolicy = p
+	}
+}
+
+// ApprovalEventPayload is the payload of the events recording the approval
+// workflow of a job. Requestor is the operator who approved or rejected the
+// job, if any.
+type ApprovalEventPayload struct {
+	Requestor string `json:",omitempty"`
+	Reason    string `json:",omitempty"`
+}
+
+// awaitingJob is a job waiting for the approval of an operator.
+type awaitingJob struct {
+	requestor api.EventRequestor
+	job       *job.Job
+}
+
+// approvalReason returns why a new job must be approved before it starts, or
+// an empty string if it needs no approval.
+func (jm *JobManager) approvalReason(j *job.Job, jobDescriptor string) (string, error) {
+	if jm.approvalPolicy == nil || j.RetryOf != 0 {
+		return "", nil
+	}
+	var jd job.JobDescriptor
+	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil {
+		return "", fmt.Errorf("invalid job descriptor: %v", err)
+	}
+	return jm.approvalPolicy.match(&jd), nil
+}
+
+// awaitApproval holds a stored job until an operator approves or rejects it.
+func (jm *JobManager) awaitApproval(requestor api.EventRequestor, j *job.Job) {
+	jm.jobsMu.Lock()
+	jm.awaitingJobs[j.ID] = &awaitingJob{requestor: requestor, job: j}
+	jm.jobsMu.Unlock()
+}
+
+// cancelAwaitingJob stops tracking a job awaiting approval, and returns it,
+// or nil if the job does not await approval.
+func (jm *JobManager) cancelAwaitingJob(jobID types.JobID) *awaitingJob {
+	jm.jobsMu.Lock()
+	defer jm.jobsMu.Unlock()
+	aj, ok := jm.awaitingJobs[jobID]
+	if !ok {
+		return nil
+	}
+	delete(jm.awaitingJobs, jobID)
+	return aj
+}
+
+func (jm *JobManager) approveJob(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventApproveJobMsg)
+	requestor := ev.Msg.Requestor()
+	evResp := api.EventResponse{JobID: msg.JobID, Requestor: requestor}
+	if err := jm.authorizer.Authorize(requestor, api.PermissionApproveJobs); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	aj := jm.cancelAwaitingJob(msg.JobID)
+	if aj == nil {
+		evResp.Err = fmt.Errorf("job %d does not await approval on this server", msg.JobID)
+		return &evResp
+	}
+	// when requestors are authorized, they cannot approve their own jobs
+	if jm.authorizer != nil && aj.requestor == requestor {
+		jm.awaitApproval(aj.requestor, aj.job)
+		evResp.Err = fmt.Errorf("%w: requestor %s cannot approve or reject its own job %d", api.ErrForbidden, requestor, msg.JobID)
+		return &evResp
+	}
+	payload := ApprovalEventPayload{Requestor: string(requestor), Reason: msg.Reason}
+	var state event.Name
+	if msg.Approved {
+		var err error
+		if state, err = jm.startApprovedJob(ev.RequestID, aj, payload); err != nil {
+			jm.awaitApproval(aj.requestor, aj.job)
+			evResp.Err = err
+			return &evResp
+		}
+		log.Infof("Job %d approved by %s", msg.JobID, requestor)
+	} else {
+		state = EventJobCancelled
+		emitter := forRequest(jm.frameworkEvManager, ev.RequestID)
+		_ = jm.emitPayloadEventTo(emitter, msg.JobID, EventJobRejected, payload)
+		errRejected := fmt.Errorf("job rejected by %s", requestor)
+		if msg.Reason != "" {
+			errRejected = fmt.Errorf("%v: %s", errRejected, msg.Reason)
+		}
+		_ = jm.emitErrEventTo(emitter, msg.JobID, state, errRejected)
+		jm.releaseJob(aj.requestor)
+		jm.resolveDependents(msg.JobID, state)
+		log.Infof("Job %d rejected by %s", msg.JobID, requestor)
+	}
+	evResp.Status = &job.Status{Name: aj.job.Name, State: string(state)}
+	return &evResp
+}
+
+// startApprovedJob starts an approved job, or holds it until its start time,
+// or until the jobs it depends on completed, and returns its new state. The
+// job is not approved if the run queue is full. requestID is the ID of the
+// API request which approved the job.
+func (jm *JobManager) startApprovedJob(requestID string, aj *awaitingJob, payload ApprovalEventPayload) (event.Name, error) {
+	j := aj.job
+	state := EventJobWaiting
+	switch {
+	case j.StartAt.After(time.Now()):
+		state = EventJobScheduled
+	case len(j.DependsOn) == 0:
+		var err error
+		if state, err = jm.admitJob(aj.requestor, j.Priority); err != nil {
+			return "", err
+		}
+	}
+	emitter := forRequest(jm.frameworkEvManager, requestID)
+	_ = jm.emitPayloadEventTo(emitter, j.ID, EventJobApproved, payload)
+	_ = jm.emitErrEventTo(emitter, j.ID, state, nil)
+	switch state {
+	case EventJobScheduled:
+		jm.holdUntilStartTime(aj.requestor, j)
+	case EventJobWaiting:
+		jm.waitForDependencies(aj.requestor, j)
+	case EventJobQueued:
+		jm.enqueueJob(aj.requestor, j)
+	default:
+		jm.runJob(aj.requestor, j)
+	}
+	return state, nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/storage"
+)
+
+// auditedEvents are the types of the API calls which change the state of
+// jobs or of the server, and are recorded in the audit log.
+var auditedEvents = map[api.EventType]bool{
+	api.EventTypeStart:          true,
+	api.EventTypeStartBatch:     true,
+	api.EventTypeStop:           true,
+	api.EventTypeRetry:          true,
+	api.EventTypePauseJob:       true,
+	api.EventTypeApproveJob:     true,
+	api.EventTypeDrain:          true,
+	api.EventTypeSetQuota:       true,
+	api.EventTypeSetLogLevel:    true,
+	api.EventTypeCreateSchedule: true,
+	api.EventTypePauseSchedule:  true,
+	api.EventTypeDeleteSchedule: true,
+	api.EventTypeSaveTemplate:   true,
+	api.EventTypeDeleteTemplate: true,
+	api.EventTypeStartTemplate:  true,
+	api.EventTypeUnlockTargets:  true,
+}
+
+// auditEvent records an API call, whether it succeeded or not, in the audit
+// log. Failing to record it does not fail the call.
+func (jm *JobManager) auditEvent(ev *api.Event, resp *api.EventResponse) {
+	if !auditedEvents[ev.Type] {
+		return
+	}
+	record := storage.AuditRecord{
+		Time:      time.Now(),
+		ServerID:  ev.ServerID,
+		RequestID: ev.RequestID,
+		Requestor: string(ev.Msg.Requestor()),
+		Action:    strings.TrimPrefix(ev.Type.String(), "event_type_"),
+		JobID:     resp.JobID,
+	}
+	payload, err := json.Marshal(ev.Msg)
+	if err != nil {
+		log.Warningf("Cannot encode the arguments of %s by %s for the audit log: %v", record.Action, record.Requestor, err)
+	} else {
+		hash := sha256.Sum256(payload)
+		record.PayloadHash = hex.EncodeToString(hash[:])
+	}
+	if resp.Err != nil {
+		record.Error = resp.Err.Error()
+	}
+	err = storage.NewAuditManager().StoreAuditRecord(&record)
+	if err != nil && !errors.Is(err, storage.ErrAuditNotSupported) {
+		log.Warningf("Cannot record %s by %s in the audit log: %v", record.Action, record.Requestor, err)
+	}
+}
+
+func (jm *JobManager) auditLog(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventAuditLogMsg)
+	evResp := api.EventResponse{Requestor: ev.Msg.Requestor()}
+	if err := jm.authorizer.Authorize(ev.Msg.Requestor(), api.PermissionReadAuditLog); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	records, err := storage.NewAuditManager().GetAuditRecords(&storage.AuditQuery{
+		Requestor: string(msg.Search.AuditRequestor),
+		Action:    msg.Search.Action,
+		JobID:     msg.Search.JobID,
+		StartTime: msg.Search.StartTime,
+		EndTime:   msg.Search.EndTime,
+		Limit:     msg.Search.Limit,
+		Offset:    msg.Search.Offset,
+	})
+	if err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	evResp.AuditRecords = make([]api.AuditRecord, 0, len(records))
+	for _, r := range records {
+		evResp.AuditRecords = append(evResp.AuditRecords, api.AuditRecord{
+			ID:          r.ID,
+			Time:        r.Time,
+			ServerID:    r.ServerID,
+			RequestID:   r.RequestID,
+			Requestor:   api.EventRequestor(r.Requestor),
+			Action:      r.Action,
+			JobID:       r.JobID,
+			PayloadHash: r.PayloadHash,
+			Error:       r.Error,
+		})
+	}
+	return &evResp
+}
@@ -0,0 +1,34 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"fmt"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// authorizeJobAction checks that the requestor may act on a job, e.g. stop
+// it: requestors may act on their own jobs if they can submit jobs, and on
+// the jobs of others if they can manage any job.
+func (jm *JobManager) authorizeJobAction(requestor api.EventRequestor, jobID types.JobID) error {
+	if jm.authorizer == nil {
+		return nil
+	}
+	if err := jm.authorizer.Authorize(requestor, api.PermissionManageAnyJob); err == nil {
+		return nil
+	}
+	request, err := storage.NewJobStorageManager().GetJobRequest(jobID)
+	if err != nil {
+		return fmt.Errorf("could not fetch request of job %d: %v", jobID, err)
+	}
+	if request.Requestor != string(requestor) {
+		return fmt.Errorf("%w: job %d was requested by %s, and requestor %s lacks permission %s", api.ErrForbidden, jobID, request.Requestor, requestor, api.PermissionManageAnyJob)
+	}
+	return jm.authorizer.Authorize(requestor, api.PermissionSubmitJobs)
+}
@@ -0,0 +1,296 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// Cluster makes the JobManager one of several servers sharing the storage
+// engine, which must implement storage.ClusterStorage, so that the jobs of a
+// server which stopped are taken over by the other ones. Every server records
+// a heartbeat every heartbeatInterval. The leader of the cluster, which is the
+// server with the lowest ID among the ones which recorded a heartbeat within
+// failoverTimeout, claims the unfinished jobs of the other servers and
+// resumes them, or fails them with the InterruptedJobsFail policy. Only the
+// leader runs the schedules. Heartbeats are timed with the clock of the
+// storage engine. Servers must have unique IDs, and share the locks of their
+// targets.
+//
+// A server stops its running jobs once they were claimed by another server,
+// and once it could not record a heartbeat for failoverTimeout, as the other
+// servers may take them over from then on. The jobs it stopped and still
+// owns are resumed once it records a heartbeat again.
+func Cluster(heartbeatInterval, failoverTimeout time.Duration) Opt {
+	return func(jm *JobManager) {
+		jm.heartbeatInterval = heartbeatInterval
+		jm.failoverTimeout = failoverTimeout
+	}
+}
+
+// FailoverEventPayload is the payload of the events recording that a job of
+// a server which stopped was taken over by another server.
+type FailoverEventPayload struct {
+	FromServerID string
+	ToServerID   string
+}
+
+// runsSchedules returns whether the server runs the schedules, i.e. whether
+// it does not belong to a cluster, or leads it.
+func (jm *JobManager) runsSchedules() bool {
+	return jm.heartbeatInterval <= 0 || jm.leader
+}
+
+// runCluster records the heartbeat of the server, stops the jobs which the
+// server lost, elects the leader of the cluster and, if the server leads it,
+// fails over the jobs of the servers which stopped. The server does not lead
+// the cluster while it cannot reach the storage engine.
+func (jm *JobManager) runCluster(serverID string) {
+	// the heartbeat is recorded after this time, so the jobs are stopped
+	// before the other servers see the heartbeat as lapsed
+	sent := time.Now()
+	cm := storage.NewClusterManager()
+	now, err := cm.Now()
+	if err == nil {
+		err = cm.Heartbeat(serverID, now)
+	}
+	if err != nil {
+		log.Warningf("Could not record the heartbeat of the server: %v", err)
+		jm.setLeader(false)
+		// the jobs started since the heartbeats lapsed are stopped too
+		if time.Since(jm.lastHeartbeat) >= jm.failoverTimeout {
+			jm.fenceRunningJobs()
+		}
+		return
+	}
+	jm.resetFenceTimer(sent)
+	jm.fenceLostJobs(serverID)
+	servers, err := cm.ListServers()
+	if err != nil {
+		log.Warningf("Could not look up the servers of the cluster: %v", err)
+		jm.setLeader(false)
+		return
+	}
+	cutoff := now.Add(-jm.failoverTimeout)
+	var (
+		leader  string
+		stopped []string
+	)
+	for _, s := range servers {
+		if s.ID != serverID && s.LastHeartbeat.Before(cutoff) {
+			stopped = append(stopped, s.ID)
+			continue
+		}
+		// servers are sorted by ID
+		if leader == "" {
+			leader = s.ID
+		}
+	}
+	jm.setLeader(leader == serverID)
+	if !jm.leader {
+		return
+	}
+	for _, id := range stopped {
+		jm.failOver(id, serverID, cutoff)
+	}
+}
+
+// resetFenceTimer arranges for the running jobs to be stopped once
+// failoverTimeout passed since the given time without another heartbeat.
+func (jm *JobManager) resetFenceTimer(sent time.Time) {
+	jm.lastHeartbeat = sent
+	timeout := jm.failoverTimeout - time.Since(sent)
+	if jm.fenceTimer == nil {
+		jm.fenceTimer = time.AfterFunc(timeout, jm.fenceRunningJobs)
+		return
+	}
+	jm.fenceTimer.Stop()
+	jm.fenceTimer.Reset(timeout)
+}
+
+// fenceRunningJobs stops the running jobs, as the server could not record a
+// heartbeat within failoverTimeout.
+func (jm *JobManager) fenceRunningJobs() {
+	jm.jobsMu.Lock()
+	defer jm.jobsMu.Unlock()
+	if len(jm.jobs) > 0 {
+		log.Errorf("No heartbeat recorded for %v, stopping the %d running jobs, which other servers may take over", jm.failoverTimeout, len(jm.jobs))
+	}
+	for jobID := range jm.jobs {
+		jm.fenceJobLocked(jobID)
+	}
+}
+
+// fenceJobLocked stops a running job without changing its state, which is
+// up to its owner. It must be called with jobsMu held.
+func (jm *JobManager) fenceJobLocked(jobID types.JobID) {
+	j, ok := jm.jobs[jobID]
+	if !ok {
+		return
+	}
+	jm.fencedJobs[jobID] = false
+	j.Cancel()
+	delete(jm.jobs, jobID)
+}
+
+// fencedJobStopped records that a job stopped by fencing no longer runs, and
+// returns whether it was stopped by fencing.
+func (jm *JobManager) fencedJobStopped(jobID types.JobID) bool {
+	jm.jobsMu.Lock()
+	defer jm.jobsMu.Unlock()
+	if _, ok := jm.fencedJobs[jobID]; !ok {
+		return false
+	}
+	jm.fencedJobs[jobID] = true
+	return true
+}
+
+// fenceLostJobs stops the jobs of the server which another server claimed,
+// and forgets the ones which did not start running. The jobs stopped by
+// fencing which the server still owns are resumed once they stopped.
+func (jm *JobManager) fenceLostJobs(serverID string) {
+	jm.jobsMu.Lock()
+	running := make([]types.JobID, 0, len(jm.jobs))
+	for jobID := range jm.jobs {
+		running = append(running, jobID)
+	}
+	var pending, fenced []types.JobID
+	for _, qj := range jm.queue {
+		pending = append(pending, qj.job.ID)
+	}
+	for jobID := range jm.waitingJobs {
+		pending = append(pending, jobID)
+	}
+	for jobID := range jm.awaitingJobs {
+		pending = append(pending, jobID)
+	}
+	for jobID := range jm.timedJobs {
+		pending = append(pending, jobID)
+	}
+	for jobID, stopped := range jm.fencedJobs {
+		if stopped {
+			fenced = append(fenced, jobID)
+		}
+	}
+	jm.jobsMu.Unlock()
+
+	jsm := storage.NewJobStorageManager()
+	owns := func(jobID types.JobID) bool {
+		req, err := jsm.GetJobRequest(jobID)
+		if err != nil {
+			log.Warningf("Could not check whether job %d belongs to the server: %v", jobID, err)
+			return true
+		}
+		if req.ServerID != serverID {
+			log.Warningf("Job %d was claimed by server %s, stopping it", jobID, req.ServerID)
+			return false
+		}
+		return true
+	}
+	for _, jobID := range running {
+		if !owns(jobID) {
+			jm.jobsMu.Lock()
+			jm.fenceJobLocked(jobID)
+			jm.jobsMu.Unlock()
+		}
+	}
+	for _, jobID := range pending {
+		if !owns(jobID) {
+			jm.forgetPendingJob(jobID)
+		}
+	}
+	for _, jobID := range fenced {
+		jm.jobsMu.Lock()
+		delete(jm.fencedJobs, jobID)
+		jm.jobsMu.Unlock()
+		if !owns(jobID) {
+			continue
+		}
+		state, err := jm.jobState(jobID)
+		if err != nil {
+			log.Warningf("Could not check the state of job %d: %v", jobID, err)
+			continue
+		}
+		if interruptedJobStates[state] {
+			log.Infof("Job %d was stopped while the heartbeats of the server lapsed, resuming it", jobID)
+			jm.handleInterruptedJob(jobID, state, InterruptedJobsResume)
+		}
+	}
+}
+
+// forgetPendingJob stops tracking a job which did not start running, without
+// changing its state.
+func (jm *JobManager) forgetPendingJob(jobID types.JobID) {
+	if qj := jm.dequeueJob(jobID); qj != nil {
+		jm.releaseJob(qj.requestor)
+	} else if wj := jm.cancelWaitingJob(jobID); wj != nil {
+		jm.releaseJob(wj.requestor)
+	} else if aj := jm.cancelAwaitingJob(jobID); aj != nil {
+		jm.releaseJob(aj.requestor)
+	} else if tj := jm.cancelTimedJob(jobID); tj != nil {
+		jm.releaseJob(tj.requestor)
+	}
+}
+
+// setLeader records whether the server leads the cluster.
+func (jm *JobManager) setLeader(leader bool) {
+	if leader != jm.leader {
+		if leader {
+			log.Infof("This server now leads the cluster")
+		} else {
+			log.Infof("This server no longer leads the cluster")
+		}
+	}
+	jm.leader = leader
+}
+
+// failOver claims the unfinished jobs of a server which stopped, and resumes
+// them, from the oldest one. The server is forgotten once all its jobs were
+// handled, unless it recorded a heartbeat since the cutoff time. No job is
+// claimed while the server is shutting down or draining.
+func (jm *JobManager) failOver(fromServerID, toServerID string, cutoff time.Time) {
+	if err := jm.checkResumable(); err != nil {
+		return
+	}
+	jobIDs, err := storage.NewJobStorageManager().ListJobs(&storage.JobQuery{ServerID: fromServerID})
+	if err != nil {
+		log.Warningf("Could not look up the jobs of server %s: %v", fromServerID, err)
+		return
+	}
+	policy := InterruptedJobsResume
+	if jm.interruptedJobPolicy == InterruptedJobsFail {
+		policy = InterruptedJobsFail
+	}
+	cm := storage.NewClusterManager()
+	for idx := len(jobIDs) - 1; idx >= 0; idx-- {
+		jobID := jobIDs[idx]
+		state, err := jm.jobState(jobID)
+		if err != nil {
+			log.Warningf("Could not check whether job %d of server %s is over: %v", jobID, fromServerID, err)
+			return
+		}
+		if !interruptedJobStates[state] {
+			continue
+		}
+		claimed, err := cm.ClaimJob(jobID, fromServerID, toServerID)
+		if err != nil {
+			log.Warningf("Could not fail over job %d: %v", jobID, err)
+			return
+		}
+		if !claimed {
+			continue
+		}
+		log.Infof("Job %d of server %s, which stopped in state %s, fails over to this server", jobID, fromServerID, state)
+		_ = jm.emitPayloadEvent(jobID, EventJobFailedOver, FailoverEventPayload{FromServerID: fromServerID, ToServerID: toServerID})
+		jm.handleInterruptedJob(jobID, state, policy)
+	}
+	if err := cm.ForgetServer(fromServerID, cutoff); err != nil {
+		log.Warningf("%v", err)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"fmt"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// waitingJob is a job waiting for the jobs it depends on. pending are the
+// jobs which did not complete yet.
+type waitingJob struct {
+	requestor api.EventRequestor
+	job       *job.Job
+	pending   map[types.JobID]bool
+}
+
+// jobState returns the current state of a job, or an empty name if the job
+// does not exist.
+func (jm *JobManager) jobState(jobID types.JobID) (event.Name, error) {
+	evs, err := jm.frameworkEvManager.Fetch(
+		frameworkevent.QueryJobID(jobID),
+		frameworkevent.QueryEventNames(JobStateEvents),
+	)
+	if err != nil {
+		return "", fmt.Errorf("could not fetch state of job %d: %v", jobID, err)
+	}
+	if len(evs) == 0 {
+		return "", nil
+	}
+	return evs[len(evs)-1].EventName, nil
+}
+
+func isJobEnded(state event.Name) bool {
+	for _, name := range JobCompletionEvents {
+		if state == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDependencies checks that the jobs which a new job depends on exist.
+// As jobs can only depend on existing jobs, dependencies cannot form cycles.
+func (jm *JobManager) checkDependencies(dependencies []types.JobID) error {
+	for _, dep := range dependencies {
+		state, err := jm.jobState(dep)
+		if err != nil {
+			return err
+		}
+		if state == "" {
+			return fmt.Errorf("job depends on job %d, which does not exist", dep)
+		}
+	}
+	return nil
+}
+
+// waitForDependencies holds a stored job until the jobs it depends on
+// completed, and then starts it. The job is registered before the states of
+// its dependencies are fetched, so that the end of a dependency is seen
+// either way. Dependencies run by other servers are only seen here if they
+// ended already.
+func (jm *JobManager) waitForDependencies(requestor api.EventRequestor, j *job.Job) {
+	wj := &waitingJob{
+		requestor: requestor,
+		job:       j,
+		pending:   make(map[types.JobID]bool),
+	}
+	jm.jobsMu.Lock()
+	for _, dep := range j.DependsOn {
+		if !wj.pending[dep] {
+			wj.pending[dep] = true
+			jm.dependents[dep] = append(jm.dependents[dep], j.ID)
+		}
+	}
+	jm.waitingJobs[j.ID] = wj
+	jm.jobsMu.Unlock()
+	log.Infof("Job %d waits for jobs %v", j.ID, j.DependsOn)
+
+	for _, dep := range j.DependsOn {
+		state, err := jm.jobState(dep)
+		if err != nil {
+			log.Warningf("Job %d: %v", j.ID, err)
+			continue
+		}
+		if isJobEnded(state) {
+			jm.resolveDependency(j.ID, dep, state)
+		}
+	}
+}
+
+// resolveDependents notifies the jobs waiting for a job that it ended.
+func (jm *JobManager) resolveDependents(jobID types.JobID, state event.Name) {
+	jm.jobsMu.Lock()
+	dependents := append([]types.JobID(nil), jm.dependents[jobID]...)
+	jm.jobsMu.Unlock()
+	for _, dependent := range dependents {
+		jm.resolveDependency(dependent, jobID, state)
+	}
+}
+
+// resolveDependency records that a dependency of a waiting job ended. The
+// waiting job fails unless the dependency completed, and starts once all its
+// dependencies completed.
+func (jm *JobManager) resolveDependency(jobID, dep types.JobID, state event.Name) {
+	jm.jobsMu.Lock()
+	wj, ok := jm.waitingJobs[jobID]
+	if !ok || !wj.pending[dep] {
+		jm.jobsMu.Unlock()
+		return
+	}
+	delete(wj.pending, dep)
+	jm.removeDependent(dep, jobID)
+	var err error
+	if state != EventJobCompleted {
+		err = fmt.Errorf("job %d depends on job %d, which ended in state %s", jobID, dep, state)
+	} else if len(wj.pending) > 0 {
+		jm.jobsMu.Unlock()
+		return
+	}
+	jm.unwaitJob(wj)
+	jm.jobsMu.Unlock()
+
+	if err != nil {
+		jm.failWaitingJob(wj, err)
+		return
+	}
+	jm.startWaitingJob(wj)
+}
+
+// removeDependent stops tracking a job as waiting for another one. jobsMu
+// must be held.
+func (jm *JobManager) removeDependent(dep, jobID types.JobID) {
+	dependents := jm.dependents[dep]
+	for idx, dependent := range dependents {
+		if dependent == jobID {
+			dependents = append(dependents[:idx], dependents[idx+1:]...)
+			break
+		}
+	}
+	if len(dependents) == 0 {
+		delete(jm.dependents, dep)
+	} else {
+		jm.dependents[dep] = dependents
+	}
+}
+
+// unwaitJob stops tracking a waiting job. jobsMu must be held.
+func (jm *JobManager) unwaitJob(wj *waitingJob) {
+	delete(jm.waitingJobs, wj.job.ID)
+	for dep := range wj.pending {
+		jm.removeDependent(dep, wj.job.ID)
+	}
+}
+
+// cancelWaitingJob stops tracking a waiting job which is cancelled, and
+// returns it, or nil if the job does not wait.
+func (jm *JobManager) cancelWaitingJob(jobID types.JobID) *waitingJob {
+	jm.jobsMu.Lock()
+	defer jm.jobsMu.Unlock()
+	wj, ok := jm.waitingJobs[jobID]
+	if !ok {
+		return nil
+	}
+	jm.unwaitJob(wj)
+	return wj
+}
+
+// failWaitingJob fails a job which cannot start, and in turn the jobs which
+// depend on it.
+func (jm *JobManager) failWaitingJob(wj *waitingJob, err error) {
+	_ = jm.emitErrEvent(wj.job.ID, EventJobFailed, err)
+	jm.releaseJob(wj.requestor)
+	jm.resolveDependents(wj.job.ID, EventJobFailed)
+}
+
+// startWaitingJob starts a job whose dependencies completed, or queues it if
+// the server runs as many jobs as it can. No job is started once the
+// JobManager is shutting down: the job is left in the waiting state.
+func (jm *JobManager) startWaitingJob(wj *waitingJob) {
+	select {
+	case <-jm.apiCancel:
+		return
+	default:
+	}
+	state, err := jm.admitJob(wj.requestor, wj.job.Priority)
+	if err != nil {
+		jm.failWaitingJob(wj, err)
+		return
+	}
+	log.Infof("Job %d: the jobs it depends on completed", wj.job.ID)
+	_ = jm.emitEvent(wj.job.ID, state)
+	if state == EventJobQueued {
+		jm.enqueueJob(wj.requestor, wj.job)
+	} else {
+		jm.runJob(wj.requestor, wj.job)
+	}
+}
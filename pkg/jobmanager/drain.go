@@ -0,0 +1,60 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/api"
+)
+
+// runningJobsCount returns the number of jobs which the server runs. jobsMu
+// must be held.
+func (jm *JobManager) runningJobsCount() int {
+	var n int
+	for _, count := range jm.runningJobs {
+		n += count
+	}
+	return n
+}
+
+func (jm *JobManager) drain(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventDrainMsg)
+	if err := jm.authorizer.Authorize(ev.Msg.Requestor(), api.PermissionManageServer); err != nil {
+		return &api.EventResponse{Requestor: ev.Msg.Requestor(), Err: err}
+	}
+	jm.jobsMu.Lock()
+	defer jm.jobsMu.Unlock()
+	if !jm.draining {
+		log.Infof("Draining requested by %s, with deadline %v", ev.Msg.Requestor(), msg.Deadline)
+		jm.draining = true
+		jm.idle = make(chan struct{})
+		if len(jm.runningJobs) == 0 {
+			close(jm.idle)
+		}
+		var deadline <-chan time.Time
+		if msg.Deadline > 0 {
+			jm.drainDeadline = time.Now().Add(msg.Deadline)
+			deadline = time.After(msg.Deadline)
+		}
+		go func(idle <-chan struct{}) {
+			select {
+			case <-idle:
+				log.Infof("Drain: all the jobs ended")
+			case <-deadline:
+				log.Infof("Drain: deadline passed, pausing the running jobs")
+			}
+			close(jm.drained)
+		}(jm.idle)
+	}
+	return &api.EventResponse{
+		Requestor: ev.Msg.Requestor(),
+		Drain: &api.ResponseDataDrain{
+			RunningJobs: jm.runningJobsCount(),
+			Deadline:    jm.drainDeadline,
+		},
+	}
+}
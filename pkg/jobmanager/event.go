@@ -9,6 +9,22 @@ import (
 	"github.com/facebookincubator/contest/pkg/event"
 )
 
+// EventJobAwaitingApproval indicates that a Job matches the approval policy
+// of the server, and waits until an operator approves or rejects it
+var EventJobAwaitingApproval = event.Name("JobStateAwaitingApproval")
+
+// EventJobScheduled indicates that a Job waits for the start time set in its
+// descriptor
+var EventJobScheduled = event.Name("JobStateScheduled")
+
+// EventJobQueued indicates that a Job waits in the run queue until the
+// server can run it
+var EventJobQueued = event.Name("JobStateQueued")
+
+// EventJobWaiting indicates that a Job waits for the jobs it depends on to
+// complete
+var EventJobWaiting = event.Name("JobStateWaiting")
+
 // EventJobStarted indicates that a Job is beginning execution
 var EventJobStarted = event.Name("JobStateStarted")
 
@@ -18,6 +34,14 @@ var EventJobCompleted = event.Name("JobStateCompleted")
 // EventJobFailed indicates that a Job has failed
 var EventJobFailed = event.Name("JobStateFailed")
 
+// EventJobPausing indicates that a Job has received a pause request and the
+// JobManager is waiting for JobRunner to return
+var EventJobPausing = event.Name("JobStatePausing")
+
+// EventJobPaused indicates that a Job has been paused, e.g. because the
+// server is shutting down, and may be resumed later
+var EventJobPaused = event.Name("JobStatePaused")
+
 // EventJobCancelling indicates that a Job has received a cancellation request
 // and the JobManager is waiting for JobRunner to return
 var EventJobCancelling = event.Name("JobStateCancelling")
@@ -28,6 +52,36 @@ var EventJobCancelled = event.Name("JobStateCancelled")
 // EventJobCancellationFailed indicates that the cancellation was not completed correctly
 var EventJobCancellationFailed = event.Name("JobStateCancellationFailed")
 
+// EventJobTimeout indicates that a Job ran longer than its timeout, and is
+// being cancelled. The Job fails once the cancellation completed.
+var EventJobTimeout = event.Name("JobTimeout")
+
+// EventJobApprovalRequested records why a Job awaits approval
+var EventJobApprovalRequested = event.Name("JobApprovalRequested")
+
+// EventJobApproved records that an operator approved a Job
+var EventJobApproved = event.Name("JobApproved")
+
+// EventJobRejected records that an operator rejected a Job, which is then
+// cancelled
+var EventJobRejected = event.Name("JobRejected")
+
+// EventJobPreempted records that a Job is paused so that a Job of higher
+// priority can lock its targets
+var EventJobPreempted = event.Name("JobPreempted")
+
+// EventJobLocksTransferred records that the target locks of a preempted Job
+// were handed over to the Job preempting it
+var EventJobLocksTransferred = event.Name("JobLocksTransferred")
+
+// EventJobFailedOver records that a Job of a server of the cluster which
+// stopped was taken over by another server
+var EventJobFailedOver = event.Name("JobFailedOver")
+
+// EventJobPreemptionEnded records that the Job which preempted a Job ended,
+// and that the preempted Job is resumed
+var EventJobPreemptionEnded = event.Name("JobPreemptionEnded")
+
 // JobCompletionEvents gathers all event names that mark the end of a job
 var JobCompletionEvents = []event.Name{
 	EventJobCompleted,
@@ -38,9 +92,15 @@ var JobCompletionEvents = []event.Name{
 
 // JobStateEvents gathers all event names which track the state of a job
 var JobStateEvents = []event.Name{
+	EventJobAwaitingApproval,
+	EventJobScheduled,
+	EventJobWaiting,
+	EventJobQueued,
 	EventJobStarted,
 	EventJobCompleted,
 	EventJobFailed,
+	EventJobPausing,
+	EventJobPaused,
 	EventJobCancelling,
 	EventJobCancelled,
 	EventJobCancellationFailed,
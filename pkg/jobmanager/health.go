@@ -0,0 +1,170 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/storage"
+)
+
+// EventDependencyDown records that a dependency of the server, e.g. the
+// storage engine, failed its health check. It is not related to any job, so
+// its job ID is 0.
+var EventDependencyDown = event.Name("DependencyDown")
+
+// EventDependencyUp records that a dependency of the server which was down
+// passed its health check again. Its job ID is 0.
+var EventDependencyUp = event.Name("DependencyUp")
+
+// DependencyEventPayload is the payload of the events recording that a
+// dependency of the server went down or up.
+type DependencyEventPayload struct {
+	Dependency string
+	// Error is why the dependency is down, if it is
+	Error string `json:",omitempty"`
+}
+
+// Dependency is an external service on which the server depends, e.g. a lab
+// inventory queried by the target managers. Check returns an error if the
+// service is down.
+type Dependency struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// HTTPDependency returns a dependency which is up if a GET request to url
+// succeeds with a 2xx status.
+func HTTPDependency(name, url string) Dependency {
+	return Dependency{
+		Name: name,
+		Check: func(ctx context.Context) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				return fmt.Errorf("GET %s returned %s", url, resp.Status)
+			}
+			return nil
+		},
+	}
+}
+
+// HealthChecks makes the JobManager check its dependencies every interval:
+// the storage engine, the target locker and the given external services,
+// each within ReadinessCheckTimeout. Readiness requests then report the
+// state found by the last check, so that the server is not ready while any
+// dependency is down, and every change of the state of a dependency is
+// recorded by an EventDependencyDown or EventDependencyUp event.
+func HealthChecks(interval time.Duration, deps ...Dependency) Opt {
+	return func(jm *JobManager) {
+		jm.healthCheckInterval = interval
+		jm.externalDependencies = deps
+	}
+}
+
+// dependencyState is the state of a dependency found by the health checks.
+// since is when the dependency went down or up.
+type dependencyState struct {
+	name  string
+	err   error
+	since time.Time
+}
+
+// dependencies returns the dependencies checked by the health checks.
+func (jm *JobManager) dependencies() []Dependency {
+	return append([]Dependency{
+		{Name: "storage", Check: storage.Ping},
+		{Name: "locker", Check: checkLocker},
+	}, jm.externalDependencies...)
+}
+
+// checkHealth checks the dependencies at once, records their state, and
+// emits an event for each one whose state changed. The dependencies which
+// are up at the first check are not recorded by an event.
+func (jm *JobManager) checkHealth(now time.Time) {
+	deps := jm.dependencies()
+	errs := make([]error, len(deps))
+	var wg sync.WaitGroup
+	for idx, d := range deps {
+		wg.Add(1)
+		go func(idx int, d Dependency) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), ReadinessCheckTimeout)
+			defer cancel()
+			errs[idx] = d.Check(ctx)
+		}(idx, d)
+	}
+	wg.Wait()
+
+	var changed []dependencyState
+	jm.healthMu.Lock()
+	if jm.health == nil {
+		jm.health = make(map[string]dependencyState)
+	}
+	for idx, d := range deps {
+		state := dependencyState{name: d.Name, err: errs[idx], since: now}
+		prev, checked := jm.health[d.Name]
+		if checked && (prev.err == nil) == (state.err == nil) {
+			state.since = prev.since
+		} else if checked || state.err != nil {
+			changed = append(changed, state)
+		}
+		jm.health[d.Name] = state
+	}
+	jm.healthMu.Unlock()
+
+	for _, state := range changed {
+		if state.err != nil {
+			log.Warningf("Dependency %s is down: %v", state.name, state.err)
+			_ = jm.emitPayloadEvent(0, EventDependencyDown, DependencyEventPayload{Dependency: state.name, Error: state.err.Error()})
+		} else {
+			log.Infof("Dependency %s is up again", state.name)
+			_ = jm.emitPayloadEvent(0, EventDependencyUp, DependencyEventPayload{Dependency: state.name})
+		}
+	}
+}
+
+// runHealthChecks checks the dependencies every interval until stop is
+// closed.
+func (jm *JobManager) runHealthChecks(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			jm.checkHealth(now)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// dependencyStates returns the state of the dependencies found by the last
+// health check, or nil if the dependencies are not checked periodically.
+func (jm *JobManager) dependencyStates() []dependencyState {
+	jm.healthMu.Lock()
+	defer jm.healthMu.Unlock()
+	if jm.health == nil {
+		return nil
+	}
+	var states []dependencyState
+	for _, d := range jm.dependencies() {
+		states = append(states, jm.health[d.Name])
+	}
+	return states
+}
@@ -0,0 +1,283 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// endedJobStates are the states of the jobs whose results are final.
+var endedJobStates = map[event.Name]bool{
+	EventJobCompleted:          true,
+	EventJobFailed:             true,
+	EventJobCancelled:          true,
+	EventJobCancellationFailed: true,
+}
+
+// stepEvents are the test events delimiting the time targets spend in steps.
+var stepEvents = []event.Name{target.EventTargetIn, target.EventTargetOut, target.EventTargetErr}
+
+// historyJobNamePattern returns the regular expression matching the names of
+// the jobs of a history search, and a string all the names contain.
+func historyJobNamePattern(search api.HistorySearch) (*regexp.Regexp, string, error) {
+	switch {
+	case search.JobName != "" && search.Template != "":
+		return nil, "", errors.New("job history requires either a job name or a template, not both")
+	case search.JobName != "":
+		return regexp.MustCompile("^" + regexp.QuoteMeta(search.JobName) + "$"), search.JobName, nil
+	case search.Template != "":
+		stored, err := storage.NewTemplateManager().GetTemplate(search.Template)
+		if err != nil {
+			return nil, "", err
+		}
+		template, err := toAPITemplate(stored)
+		if err != nil {
+			return nil, "", err
+		}
+		pattern, err := template.JobNamePattern()
+		if err != nil {
+			return nil, "", err
+		}
+		// the prefix of an anchored expression is not reported as literal
+		prefix, _ := regexp.MustCompile(strings.TrimPrefix(pattern.String(), "^")).LiteralPrefix()
+		return pattern, prefix, nil
+	default:
+		return nil, "", errors.New("job history requires a job name or a template")
+	}
+}
+
+// stepHistory aggregates the results of a test step.
+type stepHistory struct {
+	failed, skipped uint
+	duration        time.Duration
+	targets         uint
+}
+
+// testHistory aggregates the results of a test.
+type testHistory struct {
+	passed, failed, skipped uint
+	duration                time.Duration
+	targets                 uint
+	steps                   map[string]*stepHistory
+}
+
+func (t *testHistory) step(label string) *stepHistory {
+	s, ok := t.steps[label]
+	if !ok {
+		s = &stepHistory{}
+		t.steps[label] = s
+	}
+	return s
+}
+
+// passRate returns the percentage of passed results among the ones which
+// were not skipped.
+func passRate(passed, failed uint) float64 {
+	if passed+failed == 0 {
+		return 0
+	}
+	return 100 * float64(passed) / float64(passed+failed)
+}
+
+func averageDuration(total time.Duration, count uint) time.Duration {
+	if count == 0 {
+		return 0
+	}
+	return total / time.Duration(count)
+}
+
+// history aggregates the results of the most recent jobs which ended among
+// the ones sharing a name or a template, from the per-target results table,
+// and the time their targets spent in each step, from the test events.
+func (jm *JobManager) history(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventHistoryMsg)
+	evResp := api.EventResponse{
+		Requestor: ev.Msg.Requestor(),
+	}
+	pattern, nameContains, err := historyJobNamePattern(msg.Search)
+	if err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	jobIDs, err := jm.statusStorageManager.ListJobs(&storage.JobQuery{
+		NameContains:    nameContains,
+		Tags:            msg.Search.Tags,
+		RequestedAfter:  msg.Search.RequestedAfter,
+		RequestedBefore: msg.Search.RequestedBefore,
+	})
+	if err != nil {
+		evResp.Err = fmt.Errorf("could not list jobs: %v", err)
+		return &evResp
+	}
+	history := api.ResponseDataHistory{Limit: msg.Search.Limit}
+	tests := make(map[string]*testHistory)
+	for _, jobID := range jobIDs {
+		if msg.Search.Limit > 0 && uint(len(history.Jobs)) >= msg.Search.Limit {
+			break
+		}
+		req, err := jm.statusStorageManager.GetJobRequest(jobID)
+		if err != nil {
+			evResp.Err = fmt.Errorf("could not fetch request of job %d: %v", jobID, err)
+			return &evResp
+		}
+		if !pattern.MatchString(req.JobName) {
+			continue
+		}
+		results, err := jm.jobHistory(req, tests)
+		if err != nil {
+			evResp.Err = err
+			return &evResp
+		}
+		if results != nil {
+			history.Jobs = append(history.Jobs, *results)
+		}
+	}
+	names := make([]string, 0, len(tests))
+	for name := range tests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := tests[name]
+		tr := api.TestResults{
+			TestName:        name,
+			Passed:          t.passed,
+			Failed:          t.failed,
+			Skipped:         t.skipped,
+			PassRate:        passRate(t.passed, t.failed),
+			AverageDuration: averageDuration(t.duration, t.targets),
+		}
+		labels := make([]string, 0, len(t.steps))
+		for label := range t.steps {
+			labels = append(labels, label)
+		}
+		sort.Strings(labels)
+		for _, label := range labels {
+			s := t.steps[label]
+			tr.Steps = append(tr.Steps, api.StepResults{
+				TestStepLabel:   label,
+				Failed:          s.failed,
+				Skipped:         s.skipped,
+				AverageDuration: averageDuration(s.duration, s.targets),
+			})
+		}
+		history.Tests = append(history.Tests, tr)
+	}
+	evResp.History = &history
+	return &evResp
+}
+
+// jobHistory returns the results of a job, and adds them to the results of
+// its tests, unless the job did not end yet, in which case it returns nil.
+func (jm *JobManager) jobHistory(req *job.Request, tests map[string]*testHistory) (*api.JobResults, error) {
+	stateEvents, err := jm.statusEvFetcher.Fetch(
+		frameworkevent.QueryJobID(req.JobID),
+		frameworkevent.QueryEventNames(JobStateEvents),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch state of job %d: %v", req.JobID, err)
+	}
+	if len(stateEvents) == 0 || !endedJobStates[stateEvents[len(stateEvents)-1].EventName] {
+		return nil, nil
+	}
+	end := stateEvents[len(stateEvents)-1]
+	results := api.JobResults{
+		JobID:       req.JobID,
+		JobName:     req.JobName,
+		RequestTime: req.RequestTime,
+		State:       string(end.EventName),
+	}
+	for _, ev := range stateEvents {
+		if ev.EventName == EventJobStarted {
+			results.Duration = end.EmitTime.Sub(ev.EmitTime)
+			break
+		}
+	}
+
+	targetResults, err := storage.TargetResultManager{Consistency: storage.ConsistentEventually}.GetTargetResults(&storage.TargetResultQuery{JobID: req.JobID})
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch results of job %d: %v", req.JobID, err)
+	}
+	testOf := func(name string) *testHistory {
+		t, ok := tests[name]
+		if !ok {
+			t = &testHistory{steps: make(map[string]*stepHistory)}
+			tests[name] = t
+		}
+		return t
+	}
+	for _, r := range targetResults {
+		t := testOf(r.TestName)
+		switch r.Outcome {
+		case target.OutcomePass:
+			results.Passed++
+			t.passed++
+		case target.OutcomeSkip:
+			results.Skipped++
+			t.skipped++
+			if r.Step != "" {
+				t.step(r.Step).skipped++
+			}
+		default:
+			results.Failed++
+			t.failed++
+			if r.Step != "" {
+				t.step(r.Step).failed++
+			}
+		}
+		if r.Duration > 0 {
+			t.duration += r.Duration
+			t.targets++
+		}
+	}
+	results.PassRate = passRate(results.Passed, results.Failed)
+
+	events, err := jm.statusTestEvFetcher.Fetch(
+		testevent.QueryJobID(req.JobID),
+		testevent.QueryEventNames(stepEvents),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch events of job %d: %v", req.JobID, err)
+	}
+	type targetInStep struct {
+		runID    types.RunID
+		testName string
+		label    string
+		targetID string
+	}
+	inTimes := make(map[targetInStep]time.Time)
+	for _, ev := range events {
+		if ev.Header == nil || ev.Data == nil || ev.Data.Target == nil {
+			continue
+		}
+		key := targetInStep{ev.Header.RunID, ev.Header.TestName, ev.Header.TestStepLabel, ev.Data.Target.ID}
+		if ev.Data.EventName == target.EventTargetIn {
+			inTimes[key] = ev.EmitTime
+			continue
+		}
+		if in, ok := inTimes[key]; ok {
+			s := testOf(key.testName).step(key.label)
+			s.duration += ev.EmitTime.Sub(in)
+			s.targets++
+			delete(inTimes, key)
+		}
+	}
+	return &results, nil
+}
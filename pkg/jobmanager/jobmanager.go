@@ -26,6 +26,7 @@ import (
 	"github.com/facebookincubator/contest/pkg/storage/limits"
 	"github.com/facebookincubator/contest/pkg/test"
 	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/facebookincubator/contest/pkg/webhook"
 )
 
 var log = logging.GetLogger("pkg/jobmanager")
@@ -45,7 +46,7 @@ type ErrorEventPayload struct {
 // * fetching targets, via target managers
 // * fetching test definitions, via test fetchers
 // * enqueuing new job requests, and handling their status
-// * starting, stopping, and retrying jobs
+// * starting, stopping, pausing, and retrying jobs
 type JobManager struct {
 	jobs      map[types.JobID]*job.Job
 	jobRunner *runner.JobRunner
@@ -53,21 +54,132 @@ type JobManager struct {
 	jobsMu sync.Mutex
 	jobsWg sync.WaitGroup
 
-	jobStorageManager storage.JobStorage
-
 	frameworkEvManager frameworkevent.EmitterFetcher
 	testEvManager      testevent.Fetcher
 
+	// status, list, events and search requests from clients are served
+	// with eventually consistent reads, so that they can be offloaded to a
+	// read storage engine
+	statusRunner         *runner.JobRunner
+	statusStorageManager storage.JobStorageManager
+	statusEvFetcher      frameworkevent.Fetcher
+	statusTestEvFetcher  testevent.Fetcher
+
 	apiListener    api.Listener
 	apiCancel      chan struct{}
 	pluginRegistry *pluginregistry.PluginRegistry
 	serverIDFunc   api.ServerIDFunc
+	// authorizer checks the permissions of the requestors. If nil, every
+	// requestor is allowed to do anything.
+	authorizer *api.Authorizer
+	// maxRunningJobs caps the number of unfinished jobs of each requestor,
+	// if positive, and runningJobs counts them. runningJobs is protected by
+	// jobsMu.
+	maxRunningJobs int
+	runningJobs    map[api.EventRequestor]int
+	// draining is set once the server is being drained, after which no job
+	// is started. idle is closed once no job runs anymore, and drained once
+	// the jobs ended or were paused. draining, drainDeadline and idle are
+	// protected by jobsMu.
+	draining      bool
+	drainDeadline time.Time
+	idle          chan struct{}
+	drained       chan struct{}
+	// maxConcurrentJobs caps the number of jobs run at once by the server,
+	// if positive, and maxConcurrentJobsPerRequestor the ones of each
+	// requestor, unless overridden in requestorMaxConcurrentJobs.
+	// maxQueuedJobs bounds the queue of the jobs waiting for a run slot.
+	// activeJobs, activeRequestorJobs, queuedJobs, queue and queueSeq are
+	// protected by jobsMu.
+	maxConcurrentJobs             int
+	maxConcurrentJobsPerRequestor int
+	requestorMaxConcurrentJobs    map[api.EventRequestor]int
+	maxQueuedJobs                 int
+	activeJobs                    int
+	activeRequestorJobs           map[api.EventRequestor]int
+	queuedJobs                    int
+	queue                         runQueue
+	queueSeq                      uint64
+	// waitingJobs are the jobs waiting for the jobs they depend on, and
+	// dependents the jobs waiting for each job. They are protected by
+	// jobsMu.
+	waitingJobs map[types.JobID]*waitingJob
+	dependents  map[types.JobID][]types.JobID
+	// interruptedJobPolicy tells what to do at startup with the jobs which
+	// the server did not finish before it stopped.
+	interruptedJobPolicy InterruptedJobPolicy
+	// approvalPolicy selects the jobs which must be approved before they
+	// start, if any, and awaitingJobs are the jobs awaiting approval. They
+	// are protected by jobsMu.
+	approvalPolicy *ApprovalPolicy
+	awaitingJobs   map[types.JobID]*awaitingJob
+	// timedJobs are the jobs waiting for their start time. They are
+	// protected by jobsMu.
+	timedJobs map[types.JobID]*timedJob
+	// preemptions are closed once the jobs paused for jobs of higher
+	// priority no longer run, and preemptedJobs are the jobs which each job
+	// preempted. They are protected by jobsMu.
+	preemptions   map[types.JobID]chan struct{}
+	preemptedJobs map[types.JobID][]types.JobID
+	// webhookSender calls the webhooks of the server, webhookURLs, and the
+	// ones of the jobs when they change state. If nil, no webhook is
+	// called.
+	webhookSender *webhook.Sender
+	webhookURLs   []string
+	// heartbeatInterval is the interval between the heartbeats of the
+	// server, if it belongs to a cluster, and failoverTimeout the time
+	// after which the jobs of the servers which did not record a heartbeat
+	// are taken over. leader tells whether the server leads the cluster,
+	// lastHeartbeat when its last heartbeat was sent, and fenceTimer stops
+	// the running jobs once the heartbeats lapsed.
+	// They are only accessed by the goroutine running Start. fencedJobs are
+	// the jobs stopped as the server lost them, mapped to whether they
+	// stopped running. It is protected by jobsMu.
+	heartbeatInterval time.Duration
+	failoverTimeout   time.Duration
+	leader            bool
+	lastHeartbeat     time.Time
+	fenceTimer        *time.Timer
+	fencedJobs        map[types.JobID]bool
+	// defaultQuota bounds the resources used by the jobs of the requestors,
+	// unless overridden in requestorQuotas. lockedTargets counts the targets
+	// locked by the jobs of each requestor, runtimes the time their jobs
+	// ran on runtimeDay, the current day in UTC, before the runs in
+	// progress, and runningSince the running jobs. They are protected by
+	// quotasMu.
+	quotasMu        sync.Mutex
+	defaultQuota    api.Quota
+	requestorQuotas map[api.EventRequestor]api.Quota
+	lockedTargets   map[api.EventRequestor]int
+	runtimeDay      time.Time
+	runtimes        map[api.EventRequestor]time.Duration
+	runningSince    map[types.JobID]jobRuntime
+	// library holds the fragments which job descriptors include. If nil,
+	// job descriptors cannot include fragments.
+	library *job.Library
+	// healthCheckInterval is the interval between the health checks of the
+	// dependencies of the server, if positive, which are the storage
+	// engine, the target locker and externalDependencies. health is the
+	// state of each dependency found by the last check, by name, and is
+	// protected by healthMu.
+	healthCheckInterval  time.Duration
+	externalDependencies []Dependency
+	healthMu             sync.Mutex
+	health               map[string]dependencyState
 }
 
+// JobCapRetryAfter is the time after which clients are told to retry starting
+// a job when they run too many jobs already.
+var JobCapRetryAfter = time.Minute
+
 // NewJobFromRequest returns a new Job object from a job.Request .
 func NewJobFromRequest(pr *pluginregistry.PluginRegistry, req *job.Request) (*job.Job, error) {
+	jobDescriptor, err := job.MigrateDescriptor(req.JobDescriptor)
+	if err != nil {
+		return nil, err
+	}
 	var jd *job.JobDescriptor
-	if err := json.Unmarshal([]byte(req.JobDescriptor), &jd); err != nil {
+	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil {
 		return nil, err
 	}
 	j, err := newPartialJobFromDescriptor(pr, jd)
@@ -78,38 +190,144 @@ func NewJobFromRequest(pr *pluginregistry.PluginRegistry, req *job.Request) (*jo
 	return j, nil
 }
 
-func newPartialJobFromDescriptor(pr *pluginregistry.PluginRegistry, jd *job.JobDescriptor) (*job.Job, error) {
+// newStepBundles creates the bundles of a sequence of test steps of a test.
+// The labels already in use within the test are tracked in `labels`, and
+// `cleanup` tells whether the steps are the cleanup steps of the test.
+func newStepBundles(pr *pluginregistry.PluginRegistry, testName string, testStepDescs []*test.TestStepDescriptor, labels map[string]bool, cleanup bool) ([]test.TestStepBundle, error) {
+	var stepBundles []test.TestStepBundle
+	for idx, testStepDesc := range testStepDescs {
+		if testStepDesc == nil {
+			return nil, errors.New("test step description is null")
+		}
+		if err := limits.NewValidator().ValidateTestStepLabel(testStepDesc.Label); err != nil {
+			return nil, err
+		}
+		tse, err := pr.NewTestStepEvents(testStepDesc.Name)
+		if err != nil {
+			return nil, err
+		}
+		// test step index is incremented by 1 so we can use 0 to signal an
+		// anomaly.
+		tsb, err := pr.NewTestStepBundle(*testStepDesc, uint(idx)+1, tse)
+		if err != nil {
+			return nil, fmt.Errorf("NewTestStepBundle for test step '%s' with index %d failed: %w", testStepDesc.Name, idx, err)
+		}
+		if cts, ok := tsb.TestStep.(test.CleanupTestStep); ok && cts.CleanupOnly() && !cleanup {
+			return nil, fmt.Errorf("test step '%s' (%s) can only be used in the cleanup steps", tsb.TestStepLabel, testStepDesc.Name)
+		}
+		if _, ok := labels[tsb.TestStepLabel]; ok {
+			// validate that the label associated to the test step does not clash
+			// with any other label within the test
+			return nil, fmt.Errorf("found duplicated labels in test %s: %s ", testName, tsb.TestStepLabel)
+		}
+		labels[tsb.TestStepLabel] = true
+		stepBundles = append(stepBundles, *tsb)
+	}
+	return stepBundles, nil
+}
 
+// fetchTests fetches the tests of a test descriptor. TestFetchers return a
+// single test, unless they implement test.MultiTestFetcher.
+func fetchTests(tfb *test.TestFetcherBundle) (fetchedTests []test.FetchedTest, err error) {
+	start := time.Now()
+	defer func() {
+		observeFetch(tfb.TestFetcherName, start, err)
+	}()
+	if mtf, ok := tfb.TestFetcher.(test.MultiTestFetcher); ok {
+		fetchedTests, err = mtf.FetchTests(tfb.FetchParameters)
+		if err != nil {
+			return nil, err
+		}
+		if len(fetchedTests) == 0 {
+			return nil, errors.New("test fetcher returned no tests")
+		}
+		return fetchedTests, nil
+	}
+	name, testStepDescs, err := tfb.TestFetcher.Fetch(tfb.FetchParameters)
+	if err != nil {
+		return nil, err
+	}
+	return []test.FetchedTest{{Name: name, Steps: testStepDescs}}, nil
+}
+
+// checkJobDescriptor checks the fields of a job descriptor which do not
+// involve plugins.
+func checkJobDescriptor(jd *job.JobDescriptor) error {
 	if jd == nil {
-		return nil, errors.New("JobDescriptor cannot be nil")
+		return errors.New("JobDescriptor cannot be nil")
 	}
 	if len(jd.TestDescriptors) == 0 {
-		return nil, errors.New("need at least one TestDescriptor in the JobDescriptor")
+		return errors.New("need at least one TestDescriptor in the JobDescriptor")
 	}
 	if jd.JobName == "" {
-		return nil, errors.New("job name cannot be empty")
+		return errors.New("job name cannot be empty")
 	}
 	if err := limits.NewValidator().ValidateJobName(jd.JobName); err != nil {
-		return nil, err
+		return err
 	}
 	if jd.RunInterval < 0 {
-		return nil, errors.New("run interval must be non-negative")
+		return errors.New("run interval must be non-negative")
+	}
+	if jd.TargetTimeout < 0 {
+		return errors.New("target timeout must be non-negative")
+	}
+	if jd.Timeout < 0 {
+		return errors.New("job timeout must be non-negative")
+	}
+	if jd.AbortThreshold.MaxFailedPercent < 0 || jd.AbortThreshold.MaxFailedPercent > 100 {
+		return errors.New("abort threshold percentage must be between 0 and 100")
+	}
+	for _, jobID := range jd.DependsOn {
+		if jobID == 0 {
+			return errors.New("job dependencies must be valid job IDs")
+		}
+	}
+	for _, webhookURL := range jd.Webhooks {
+		if err := webhook.CheckURL(webhookURL); err != nil {
+			return err
+		}
 	}
 
 	if len(jd.Reporting.RunReporters) == 0 && len(jd.Reporting.FinalReporters) == 0 {
-		return nil, errors.New("at least one run reporter or one final reporter must be specified in a job")
+		return errors.New("at least one run reporter or one final reporter must be specified in a job")
 	}
 	for _, reporter := range jd.Reporting.RunReporters {
 		if strings.TrimSpace(reporter.Name) == "" {
-			return nil, errors.New("run reporters cannot have empty or all-whitespace names")
+			return errors.New("run reporters cannot have empty or all-whitespace names")
 		}
 		if err := limits.NewValidator().ValidateReporterName(reporter.Name); err != nil {
-			return nil, err
+			return err
+		}
+	}
+	return nil
+}
+
+// checkJobTags checks the tags of a new job, which are stored to look jobs up
+// by tag. The tags of stored jobs are not checked, so that the jobs stored
+// before tags were limited can still be resumed and inspected.
+func checkJobTags(tags []string) error {
+	for _, tag := range tags {
+		if strings.TrimSpace(tag) == "" {
+			return errors.New("job tags cannot be empty or all-whitespace")
+		}
+		if err := limits.NewValidator().ValidateJobTag(tag); err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+func newPartialJobFromDescriptor(pr *pluginregistry.PluginRegistry, jd *job.JobDescriptor) (*job.Job, error) {
+
+	if err := checkJobDescriptor(jd); err != nil {
+		return nil, err
+	}
 
 	tests := make([]*test.Test, 0, len(jd.TestDescriptors))
 	testDescriptors := make([][]*test.TestStepDescriptor, 0, len(jd.TestDescriptors))
+	// test names identify the tests in the status of the job, so they must
+	// be unique
+	testNames := make(map[string]bool)
 	for _, td := range jd.TestDescriptors {
 		if td == nil {
 			return nil, errors.New("test description is null")
@@ -120,64 +338,70 @@ func newPartialJobFromDescriptor(pr *pluginregistry.PluginRegistry, jd *job.JobD
 		if td.TestFetcherName == "" {
 			return nil, errors.New("test fetcher name cannot be empty")
 		}
-		// get an instance of the TargetManager and validate its parameters.
-		tmb, err := pr.NewTargetManagerBundle(td)
-		if err != nil {
-			return nil, err
-		}
 		// get an instance of the TestFetcher and validate its parameters
 		tfb, err := pr.NewTestFetcherBundle(td)
 		if err != nil {
 			return nil, err
 		}
-		name, testStepDescs, err := tfb.TestFetcher.Fetch(tfb.FetchParameters)
+		fetchedTests, err := fetchTests(tfb)
 		if err != nil {
 			return nil, err
 		}
-		if err := limits.NewValidator().ValidateTestName(name); err != nil {
-			return nil, err
-		}
-		testDescriptors = append(testDescriptors, testStepDescs)
-
-		// look up test step plugins in the plugin registry
-		var stepBundles []test.TestStepBundle
-		labels := make(map[string]bool)
-		for idx, testStepDesc := range testStepDescs {
-			if testStepDesc == nil {
-				return nil, errors.New("test step description is null")
-			}
-			if err := limits.NewValidator().ValidateTestStepLabel(testStepDesc.Label); err != nil {
+		// each fetched test becomes a test of the job, with its own
+		// instances of the target manager and of the setup and cleanup steps
+		for _, fetched := range fetchedTests {
+			name, testStepDescs := fetched.Name, fetched.Steps
+			// get an instance of the TargetManager and validate its parameters.
+			tmb, err := pr.NewTargetManagerBundle(td)
+			if err != nil {
 				return nil, err
 			}
-			tse, err := pr.NewTestStepEvents(testStepDesc.Name)
+			testStepDescs, err = pr.ResolveIncludes(testStepDescs)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("test %s: %w", name, err)
 			}
-			// test step index is incremented by 1 so we can use 0 to signal an
-			// anomaly.
-			tsb, err := pr.NewTestStepBundle(*testStepDesc, uint(idx)+1, tse)
+			setupSteps, err := pr.ResolveIncludes(td.SetupSteps)
 			if err != nil {
-				return nil, fmt.Errorf("NewTestStepBundle for test step '%s' with index %d failed: %w", testStepDesc.Name, idx, err)
+				return nil, fmt.Errorf("setup steps of test %s: %w", name, err)
 			}
-			if _, ok := labels[tsb.TestStepLabel]; ok {
-				// validate that the label associated to the test step does not clash
-				// with any other label within the test
-				return nil, fmt.Errorf("found duplicated labels in test %s: %s ", name, tsb.TestStepLabel)
+			cleanupSteps, err := pr.ResolveIncludes(td.CleanupSteps)
+			if err != nil {
+				return nil, fmt.Errorf("cleanup steps of test %s: %w", name, err)
+			}
+			if err := limits.NewValidator().ValidateTestName(name); err != nil {
+				return nil, err
+			}
+			if _, ok := testNames[name]; ok {
+				return nil, fmt.Errorf("found duplicated test name in job: %s", name)
 			}
-			labels[tsb.TestStepLabel] = true
+			testNames[name] = true
+			testDescriptors = append(testDescriptors, testStepDescs)
 
+			// look up test step plugins in the plugin registry. Labels must be
+			// unique across setup, test and cleanup steps.
+			labels := make(map[string]bool)
+			setupBundles, err := newStepBundles(pr, name, setupSteps, labels, false)
 			if err != nil {
 				return nil, err
 			}
-			stepBundles = append(stepBundles, *tsb)
-		}
-		test := test.Test{
-			Name:                name,
-			TargetManagerBundle: tmb,
-			TestFetcherBundle:   tfb,
-			TestStepsBundles:    stepBundles,
+			stepBundles, err := newStepBundles(pr, name, testStepDescs, labels, false)
+			if err != nil {
+				return nil, err
+			}
+			cleanupBundles, err := newStepBundles(pr, name, cleanupSteps, labels, true)
+			if err != nil {
+				return nil, err
+			}
+			test := test.Test{
+				Name:                name,
+				TargetManagerBundle: tmb,
+				TestFetcherBundle:   tfb,
+				TestStepsBundles:    append(setupBundles, stepBundles...),
+				RetryPolicy:         td.RetryPolicy,
+				CleanupStepsBundles: cleanupBundles,
+			}
+			tests = append(tests, &test)
 		}
-		tests = append(tests, &test)
 	}
 
 	testDescriptorsJSON, err := json.Marshal(testDescriptors)
@@ -186,11 +410,21 @@ func newPartialJobFromDescriptor(pr *pluginregistry.PluginRegistry, jd *job.JobD
 	}
 
 	job := job.Job{
-		ID:          types.JobID(0),
-		Name:        jd.JobName,
-		Tags:        jd.Tags,
-		Runs:        jd.Runs,
-		RunInterval: time.Duration(jd.RunInterval),
+		ID:               types.JobID(0),
+		Name:             jd.JobName,
+		Tags:             jd.Tags,
+		Runs:             jd.Runs,
+		RunInterval:      time.Duration(jd.RunInterval),
+		TargetTimeout:    time.Duration(jd.TargetTimeout),
+		Timeout:          time.Duration(jd.Timeout),
+		AbortThreshold:   jd.AbortThreshold,
+		TargetBatchSize:  jd.TargetBatchSize,
+		MaxParallelTests: jd.MaxParallelTests,
+		Priority:         jd.Priority,
+		DependsOn:        jd.DependsOn,
+		Retry:            jd.Retry,
+		TargetIDs:        jd.TargetIDs,
+		Webhooks:         jd.Webhooks,
 		// reporter bundles must be set externally
 		TestDescriptors:      string(testDescriptorsJSON),
 		Tests:                tests,
@@ -198,6 +432,10 @@ func newPartialJobFromDescriptor(pr *pluginregistry.PluginRegistry, jd *job.JobD
 		FinalReporterBundles: nil,
 	}
 
+	if jd.StartAt != nil {
+		job.StartAt = *jd.StartAt
+	}
+
 	job.Done = make(chan struct{})
 
 	job.CancelCh = make(chan struct{})
@@ -206,12 +444,22 @@ func newPartialJobFromDescriptor(pr *pluginregistry.PluginRegistry, jd *job.JobD
 	return &job, nil
 }
 
-// NewJob returns a new Job object and the fetched test descriptors
+// NewJob returns a new Job object and the fetched test descriptors. Job
+// descriptors of earlier versions are migrated, see job.MigrateDescriptor.
 func NewJob(pr *pluginregistry.PluginRegistry, jobDescriptor string) (*job.Job, error) {
+	jobDescriptor, err := job.MigrateDescriptor(jobDescriptor)
+	if err != nil {
+		return nil, err
+	}
 	var jd *job.JobDescriptor
 	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil {
 		return nil, err
 	}
+	if jd != nil {
+		if err := checkJobTags(jd.Tags); err != nil {
+			return nil, err
+		}
+	}
 	j, err := newPartialJobFromDescriptor(pr, jd)
 	if err != nil {
 		return nil, err
@@ -246,48 +494,167 @@ func NewJob(pr *pluginregistry.PluginRegistry, jobDescriptor string) (*job.Job,
 	return j, nil
 }
 
+// Opt is a function type that sets parameters on the JobManager object
+type Opt func(jm *JobManager)
+
+// Authorizer sets the authorizer checking the permissions of the requestors
+func Authorizer(a *api.Authorizer) Opt {
+	return func(jm *JobManager) {
+		jm.authorizer = a
+	}
+}
+
+// DescriptorLibrary makes job descriptors include the fragments of the
+// library, see job.Library. The job descriptors are expanded when the jobs
+// are submitted, and the jobs of a schedule whenever it starts one.
+func DescriptorLibrary(l *job.Library) Opt {
+	return func(jm *JobManager) {
+		jm.library = l
+	}
+}
+
+// prepareDescriptor expands the includes of a submitted job descriptor and
+// migrates it to the current version, so that it is stored complete and up to
+// date.
+func (jm *JobManager) prepareDescriptor(jobDescriptor string) (string, error) {
+	jobDescriptor, err := jm.library.Expand(jobDescriptor)
+	if err != nil {
+		return "", err
+	}
+	return job.MigrateDescriptor(jobDescriptor)
+}
+
+// MaxRunningJobsPerRequestor caps the number of unfinished jobs of each
+// requestor, i.e. of the jobs which run, or wait for their turn to run, e.g.
+// in the run queue. Jobs started beyond the cap are rejected with an
+// api.LimitError. Unlike MaxConcurrentJobsPerRequestor, which makes the jobs
+// of a requestor run in turn, it bounds the backlog of the requestor, so it
+// should be larger.
+func MaxRunningJobsPerRequestor(n int) Opt {
+	return func(jm *JobManager) {
+		jm.maxRunningJobs = n
+	}
+}
+
 // New initializes and returns a new JobManager with the given API listener.
-func New(l api.Listener, serverIDFunc api.ServerIDFunc, pr *pluginregistry.PluginRegistry) (*JobManager, error) {
+func New(l api.Listener, serverIDFunc api.ServerIDFunc, pr *pluginregistry.PluginRegistry, opts ...Opt) (*JobManager, error) {
 	if pr == nil {
 		return nil, errors.New("plugin registry cannot be nil")
 	}
-	jobStorageManager := storage.NewJobStorageManager()
-
 	frameworkEvManager := storage.NewFrameworkEventEmitterFetcher()
 	testEvManager := storage.NewTestEventFetcher()
 
 	jm := JobManager{
-		apiListener:        l,
-		pluginRegistry:     pr,
-		jobs:               make(map[types.JobID]*job.Job),
-		jobStorageManager:  jobStorageManager,
-		frameworkEvManager: frameworkEvManager,
-		testEvManager:      testEvManager,
-		apiCancel:          make(chan struct{}),
-		serverIDFunc:       serverIDFunc,
+		apiListener:         l,
+		pluginRegistry:      pr,
+		jobs:                make(map[types.JobID]*job.Job),
+		runningJobs:         make(map[api.EventRequestor]int),
+		activeRequestorJobs: make(map[api.EventRequestor]int),
+		waitingJobs:         make(map[types.JobID]*waitingJob),
+		awaitingJobs:        make(map[types.JobID]*awaitingJob),
+		timedJobs:           make(map[types.JobID]*timedJob),
+		fencedJobs:          make(map[types.JobID]bool),
+		preemptions:         make(map[types.JobID]chan struct{}),
+		preemptedJobs:       make(map[types.JobID][]types.JobID),
+		dependents:          make(map[types.JobID][]types.JobID),
+		requestorQuotas:     make(map[api.EventRequestor]api.Quota),
+		lockedTargets:       make(map[api.EventRequestor]int),
+		runtimes:            make(map[api.EventRequestor]time.Duration),
+		runningSince:        make(map[types.JobID]jobRuntime),
+		frameworkEvManager:  frameworkEvManager,
+		testEvManager:       testEvManager,
+		apiCancel:           make(chan struct{}),
+		drained:             make(chan struct{}),
+		serverIDFunc:        serverIDFunc,
 	}
 	jm.jobRunner = runner.NewJobRunner()
+	jm.jobRunner.SetReserveFunc(jm.reserveTargets)
+	jm.statusRunner = runner.NewStatusJobRunner()
+	jm.statusStorageManager = storage.JobStorageManager{Consistency: storage.ConsistentEventually}
+	jm.statusEvFetcher = storage.FrameworkEventFetcher{Consistency: storage.ConsistentEventually}
+	jm.statusTestEvFetcher = storage.TestEventFetcher{Consistency: storage.ConsistentEventually}
+	for _, opt := range opts {
+		opt(&jm)
+	}
 	return &jm, nil
 }
 
 func (jm *JobManager) handleEvent(ev *api.Event) {
 	var resp *api.EventResponse
+	log := log
+	if ev.RequestID != "" {
+		log = logging.AddField(log, logging.FieldRequestID, ev.RequestID)
+	}
 
+	log.Printf("Handling event %+v", ev)
 	switch ev.Type {
 	case api.EventTypeStart:
 		resp = jm.start(ev)
+	case api.EventTypeStartBatch:
+		resp = jm.startBatch(ev)
+	case api.EventTypeValidate:
+		resp = jm.validate(ev)
 	case api.EventTypeStatus:
 		resp = jm.status(ev)
 	case api.EventTypeStop:
 		resp = jm.stop(ev)
+	case api.EventTypePauseJob:
+		resp = jm.pauseJob(ev)
+	case api.EventTypeApproveJob:
+		resp = jm.approveJob(ev)
 	case api.EventTypeRetry:
 		resp = jm.retry(ev)
+	case api.EventTypeList:
+		resp = jm.list(ev)
+	case api.EventTypeReports:
+		resp = jm.reports(ev)
+	case api.EventTypeHistory:
+		resp = jm.history(ev)
+	case api.EventTypeQuotas:
+		resp = jm.quotas(ev)
+	case api.EventTypeSetQuota:
+		resp = jm.setQuota(ev)
+	case api.EventTypeLogLevels:
+		resp = jm.logLevels(ev)
+	case api.EventTypeSetLogLevel:
+		resp = jm.setLogLevel(ev)
+	case api.EventTypeAuditLog:
+		resp = jm.auditLog(ev)
+	case api.EventTypeTestEvents:
+		resp = jm.testEvents(ev)
+	case api.EventTypeSearch:
+		resp = jm.search(ev)
+	case api.EventTypePlugins:
+		resp = jm.plugins(ev)
+	case api.EventTypeReadiness:
+		resp = jm.readiness(ev)
+	case api.EventTypeDrain:
+		resp = jm.drain(ev)
+	case api.EventTypeUnlockTargets:
+		resp = jm.unlockTargets(ev)
+	case api.EventTypeCreateSchedule:
+		resp = jm.createSchedule(ev)
+	case api.EventTypeListSchedules:
+		resp = jm.listSchedules(ev)
+	case api.EventTypePauseSchedule:
+		resp = jm.pauseSchedule(ev)
+	case api.EventTypeDeleteSchedule:
+		resp = jm.deleteSchedule(ev)
+	case api.EventTypeSaveTemplate:
+		resp = jm.saveTemplate(ev)
+	case api.EventTypeListTemplates:
+		resp = jm.listTemplates(ev)
+	case api.EventTypeDeleteTemplate:
+		resp = jm.deleteTemplate(ev)
+	case api.EventTypeStartTemplate:
+		resp = jm.startTemplate(ev)
 	default:
 		resp = &api.EventResponse{
 			Requestor: ev.Msg.Requestor(),
 			Err:       fmt.Errorf("invalid event type: %v", ev.Type),
 		}
 	}
+	jm.auditEvent(ev, resp)
 
 	log.Printf("Sending response %+v", resp)
 	// time to wait before printing an error if the response is not received.
@@ -311,6 +678,42 @@ func (jm *JobManager) Start(sigs chan os.Signal) error {
 	if err != nil {
 		return fmt.Errorf("Cannot start JobManager: %w", err)
 	}
+	if jm.webhookSender != nil {
+		// the subscription is made before any job changes state
+		stopWebhooks := make(chan struct{})
+		defer close(stopWebhooks)
+		go jm.notifyWebhooks(storage.Subscribe(0, 0), stopWebhooks)
+	}
+	var heartbeats <-chan time.Time
+	if jm.heartbeatInterval > 0 {
+		if err := storage.CheckClusterSupported(); err != nil {
+			return fmt.Errorf("Cannot start JobManager: %w", err)
+		}
+		heartbeatTicker := time.NewTicker(jm.heartbeatInterval)
+		defer heartbeatTicker.Stop()
+		heartbeats = heartbeatTicker.C
+		jm.runCluster(a.ServerID())
+		defer func() {
+			if jm.fenceTimer != nil {
+				jm.fenceTimer.Stop()
+			}
+		}()
+	}
+	if jm.healthCheckInterval > 0 {
+		// the first check is made before serving readiness requests
+		jm.checkHealth(time.Now())
+		stopHealthChecks, healthChecksDone := make(chan struct{}), make(chan struct{})
+		defer func() {
+			// a check in progress still uses the storage and the locker
+			close(stopHealthChecks)
+			<-healthChecksDone
+		}()
+		go func() {
+			jm.runHealthChecks(jm.healthCheckInterval, stopHealthChecks)
+			close(healthChecksDone)
+		}()
+	}
+	jm.handleInterruptedJobs(a.ServerID())
 	errCh := make(chan error, 1)
 	go func() {
 		if lErr := jm.apiListener.Serve(jm.apiCancel, a); lErr != nil {
@@ -318,14 +721,24 @@ func (jm *JobManager) Start(sigs chan os.Signal) error {
 		}
 		errCh <- nil
 	}()
+	scheduleTicker := time.NewTicker(ScheduleCheckInterval)
+	defer scheduleTicker.Stop()
 loop:
 	for {
 		select {
 		// handle events from the API
 		case ev := <-a.Events:
-			log.Printf("Handling event %+v", ev)
 			// send the response, and wait for the given timeout
 			jm.handleEvent(ev)
+		// start the jobs of the schedules which are due
+		case now := <-scheduleTicker.C:
+			if jm.runsSchedules() {
+				jm.runSchedules(a.ServerID(), now)
+			}
+		// record the heartbeat of the server, and fail over the jobs of
+		// the servers of the cluster which stopped
+		case <-heartbeats:
+			jm.runCluster(a.ServerID())
 		// check for errors or premature termination from the listener.
 		case err := <-errCh:
 			log.Info("JobManager: API listener failed, triggering a cancellation of all jobs")
@@ -339,17 +752,18 @@ loop:
 		case sig := <-sigs:
 			// We were interrupted by a signal, time to leave!
 			log.Printf("Interrupted by signal '%s', trying to exit gracefully", sig)
-			jm.Pause()
-			select {
-			case err := <-errCh:
-				if err != nil {
-					return fmt.Errorf("API listener terminated with error: %v", err)
-				}
-				// break the outer loop
-				break loop
-			case <-time.After(cancellationTimeout):
-				return fmt.Errorf("API listener didn't shut down within %v, exiting", cancellationTimeout)
+			if err := jm.shutdown(errCh); err != nil {
+				return err
 			}
+			break loop
+		// the server was drained, the jobs still running past the drain
+		// deadline are paused
+		case <-jm.drained:
+			log.Printf("Drain completed, exiting")
+			if err := jm.shutdown(errCh); err != nil {
+				return err
+			}
+			break loop
 		}
 	}
 	// Downstream runner are guaranteed to have shutdown control path protected
@@ -359,6 +773,20 @@ loop:
 	return nil
 }
 
+// shutdown pauses the jobs, and waits for the API listener to terminate.
+func (jm *JobManager) shutdown(errCh <-chan error) error {
+	jm.Pause()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("API listener terminated with error: %v", err)
+		}
+		return nil
+	case <-time.After(cancellationTimeout):
+		return fmt.Errorf("API listener didn't shut down within %v, exiting", cancellationTimeout)
+	}
+}
+
 // CancelJob sends a cancellation request to a specific job.
 func (jm *JobManager) CancelJob(jobID types.JobID) error {
 	jm.jobsMu.Lock()
@@ -384,6 +812,8 @@ func (jm *JobManager) CancelAll() {
 	// Get the job from the local cache rather than the storage layer. We can
 	// only cancel jobs that we are actively handling.
 	log.Info("JobManager: cancelling all jobs")
+	jm.jobsMu.Lock()
+	defer jm.jobsMu.Unlock()
 	for jobID, job := range jm.jobs {
 		log.Debugf("JobManager: cancelling job with ID %v", jobID)
 		job.Cancel()
@@ -395,6 +825,8 @@ func (jm *JobManager) CancelAll() {
 func (jm *JobManager) Pause() {
 	log.Info("JobManager: requested pausing")
 	close(jm.apiCancel)
+	jm.jobsMu.Lock()
+	defer jm.jobsMu.Unlock()
 	for jobID, job := range jm.jobs {
 		log.Debugf("JobManager: pausing job with ID %v", jobID)
 		job.Pause()
@@ -402,6 +834,13 @@ func (jm *JobManager) Pause() {
 }
 
 func (jm *JobManager) emitErrEvent(jobID types.JobID, eventName event.Name, err error) error {
+	return jm.emitErrEventTo(jm.frameworkEvManager, jobID, eventName, err)
+}
+
+// emitErrEventTo emits a job state event via the given emitter, e.g. a
+// storage.Transaction
+func (jm *JobManager) emitErrEventTo(emitter frameworkevent.Emitter, jobID types.JobID, eventName event.Name, err error) error {
+	log := logging.AddField(log, logging.FieldJobID, jobID)
 	var (
 		rawPayload json.RawMessage
 		payloadPtr *json.RawMessage
@@ -424,13 +863,66 @@ func (jm *JobManager) emitErrEvent(jobID types.JobID, eventName event.Name, err
 		Payload:   payloadPtr,
 		EmitTime:  time.Now(),
 	}
-	if err := jm.frameworkEvManager.Emit(ev); err != nil {
+	if err := emitter.Emit(ev); err != nil {
 		log.Warningf("Could not emit event %s for job %d: %v", eventName, jobID, err)
 		return err
 	}
+	observeEvent(eventName)
 	return nil
 }
 
 func (jm *JobManager) emitEvent(jobID types.JobID, eventName event.Name) error {
 	return jm.emitErrEvent(jobID, eventName, nil)
 }
+
+// requestEmitter records the ID of the API request being handled in the
+// events it emits.
+type requestEmitter struct {
+	frameworkevent.Emitter
+	requestID string
+}
+
+// Emit implements frameworkevent.Emitter.
+func (e requestEmitter) Emit(ev frameworkevent.Event) error {
+	ev.RequestID = e.requestID
+	return e.Emitter.Emit(ev)
+}
+
+// forRequest returns an emitter recording the ID of an API request in the
+// events emitted while handling it, or emitter itself if there is no ID, e.g.
+// for the events emitted in the background.
+func forRequest(emitter frameworkevent.Emitter, requestID string) frameworkevent.Emitter {
+	if requestID == "" {
+		return emitter
+	}
+	return requestEmitter{Emitter: emitter, requestID: requestID}
+}
+
+// emitPayloadEvent emits a job event with the JSON encoded payload
+func (jm *JobManager) emitPayloadEvent(jobID types.JobID, eventName event.Name, payload interface{}) error {
+	return jm.emitPayloadEventTo(jm.frameworkEvManager, jobID, eventName, payload)
+}
+
+// emitPayloadEventTo emits a job event with the JSON encoded payload via the
+// given emitter
+func (jm *JobManager) emitPayloadEventTo(emitter frameworkevent.Emitter, jobID types.JobID, eventName event.Name, payload interface{}) error {
+	log := logging.AddField(log, logging.FieldJobID, jobID)
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		log.Warningf("Could not serialize payload for event %s: %v", eventName, err)
+		return err
+	}
+	rawPayload := json.RawMessage(payloadJSON)
+	ev := frameworkevent.Event{
+		JobID:     jobID,
+		EventName: eventName,
+		Payload:   &rawPayload,
+		EmitTime:  time.Now(),
+	}
+	if err := emitter.Emit(ev); err != nil {
+		log.Warningf("Could not emit event %s for job %d: %v", eventName, jobID, err)
+		return err
+	}
+	observeEvent(eventName)
+	return nil
+}
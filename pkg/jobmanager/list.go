@@ -0,0 +1,127 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"fmt"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+func (jm *JobManager) list(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventListMsg)
+	evResp := api.EventResponse{
+		Requestor: ev.Msg.Requestor(),
+	}
+	evResp.JobIDs, evResp.Err = jm.listJobs(msg.Search)
+	return &evResp
+}
+
+// reports fetches the reports of the jobs matching a search, e.g. to collect
+// the results of the jobs tagged with a release. The jobs which did not
+// report yet have empty reports.
+func (jm *JobManager) reports(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventReportsMsg)
+	evResp := api.EventResponse{
+		Requestor: ev.Msg.Requestor(),
+	}
+	jobIDs, err := jm.listJobs(msg.Search)
+	if err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	evResp.Reports = make([]*job.JobReport, 0, len(jobIDs))
+	for _, jobID := range jobIDs {
+		report, err := jm.statusStorageManager.GetJobReport(jobID)
+		if err != nil {
+			evResp.Err = fmt.Errorf("could not fetch report of job %d: %v", jobID, err)
+			return &evResp
+		}
+		evResp.Reports = append(evResp.Reports, report)
+	}
+	return &evResp
+}
+
+// listJobs returns the IDs of the jobs matching a search, most recent first.
+func (jm *JobManager) listJobs(search api.JobSearch) ([]types.JobID, error) {
+	states := make(map[event.Name]bool, len(search.States))
+	for _, state := range search.States {
+		if !isEventIn(event.Name(state), JobStateEvents) {
+			return nil, fmt.Errorf("unknown job state '%s'", state)
+		}
+		states[event.Name(state)] = true
+	}
+	query := storage.JobQuery{
+		Requestor:       string(search.JobRequestor),
+		NameContains:    search.NameContains,
+		Tags:            search.Tags,
+		RequestedAfter:  search.RequestedAfter,
+		RequestedBefore: search.RequestedBefore,
+		ScheduleID:      search.ScheduleID,
+		RetryOf:         search.RetryOf,
+		RerunOf:         search.RerunOf,
+		Limit:           search.Limit,
+		Offset:          search.Offset,
+	}
+	// the state of the jobs is not known to the storage engine, so the jobs
+	// are filtered by state here, and so is the pagination
+	if len(states) > 0 {
+		query.Limit, query.Offset = 0, 0
+	}
+	jobIDs, err := jm.statusStorageManager.ListJobs(&query)
+	if err != nil {
+		return nil, fmt.Errorf("could not list jobs: %v", err)
+	}
+	if len(states) > 0 {
+		if jobIDs, err = jm.filterJobsByState(jobIDs, states, search.Limit, search.Offset); err != nil {
+			return nil, fmt.Errorf("could not list jobs: %v", err)
+		}
+	}
+	return jobIDs, nil
+}
+
+// filterJobsByState returns the page selected by limit and offset of the jobs
+// whose current state is one of states. The state of the jobs is only fetched
+// until the page is full.
+func (jm *JobManager) filterJobsByState(jobIDs []types.JobID, states map[event.Name]bool, limit, offset uint) ([]types.JobID, error) {
+	matching := []types.JobID{}
+	var skipped uint
+	for _, jobID := range jobIDs {
+		if limit > 0 && uint(len(matching)) >= limit {
+			break
+		}
+		evs, err := jm.statusEvFetcher.Fetch(
+			frameworkevent.QueryJobID(jobID),
+			frameworkevent.QueryEventNames(JobStateEvents),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch state of job %d: %v", jobID, err)
+		}
+		if len(evs) == 0 || !states[evs[len(evs)-1].EventName] {
+			continue
+		}
+		if skipped < offset {
+			skipped++
+			continue
+		}
+		matching = append(matching, jobID)
+	}
+	return matching, nil
+}
+
+func isEventIn(name event.Name, names []event.Name) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/logging"
+)
+
+// logLevelsData returns the log levels of the server.
+func logLevelsData() *api.ResponseDataLogLevels {
+	defaultLevel, levels := logging.Levels()
+	data := api.ResponseDataLogLevels{Default: defaultLevel}
+	for _, l := range levels {
+		data.Modules = append(data.Modules, api.ModuleLogLevel{
+			Module:   l.Module,
+			Level:    l.Level,
+			Override: l.Override,
+		})
+	}
+	return &data
+}
+
+func (jm *JobManager) logLevels(ev *api.Event) *api.EventResponse {
+	return &api.EventResponse{
+		Requestor: ev.Msg.Requestor(),
+		LogLevels: logLevelsData(),
+	}
+}
+
+func (jm *JobManager) setLogLevel(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventSetLogLevelMsg)
+	if err := jm.authorizer.Authorize(ev.Msg.Requestor(), api.PermissionManageServer); err != nil {
+		return &api.EventResponse{Requestor: ev.Msg.Requestor(), Err: err}
+	}
+	var err error
+	if msg.Module == "" {
+		err = logging.SetLevel(msg.Level)
+	} else {
+		err = logging.SetModuleLevel(msg.Module, msg.Level)
+	}
+	if err != nil {
+		return &api.EventResponse{Requestor: ev.Msg.Requestor(), Err: err}
+	}
+	switch {
+	case msg.Module == "":
+		log.Infof("Default log level set to %s by %s", msg.Level, ev.Msg.Requestor())
+	case msg.Level == "":
+		log.Infof("Log level of %s reset to the default one by %s", msg.Module, ev.Msg.Requestor())
+	default:
+		log.Infof("Log level of %s set to %s by %s", msg.Module, msg.Level, ev.Msg.Requestor())
+	}
+	return &api.EventResponse{
+		Requestor: ev.Msg.Requestor(),
+		LogLevels: logLevelsData(),
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"expvar"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/metrics"
+)
+
+// jobMetrics are published via expvar, as "contest_jobmanager". The counter
+// jobs counts the jobs which reached each state, e.g. started, completed or
+// failed, by state, and fetch_errors the failures of the test fetchers, by
+// plugin. The histogram fetch_seconds measures the time the test fetchers
+// took to fetch the tests of the jobs, by plugin.
+var jobMetrics = expvar.NewMap("contest_jobmanager")
+
+var (
+	jobStates    = metrics.NewCounterVec("state")
+	fetchErrors  = metrics.NewCounterVec("fetcher")
+	fetchLatency = metrics.NewHistogramVec("fetcher", metrics.DefaultLatencyBuckets)
+)
+
+func init() {
+	jobMetrics.Set("jobs", jobStates)
+	jobMetrics.Set("fetch_errors", fetchErrors)
+	jobMetrics.Set("fetch_seconds", fetchLatency)
+}
+
+// observeFetch records the outcome of a test fetcher plugin, which started
+// fetching at the given time.
+func observeFetch(name string, start time.Time, err error) {
+	fetchLatency.Observe(name, time.Since(start).Seconds())
+	if err != nil {
+		fetchErrors.Add(name, 1)
+	}
+}
+
+// observeEvent counts the jobs reaching a state, once the event recording it
+// was emitted.
+func observeEvent(eventName event.Name) {
+	for _, name := range JobStateEvents {
+		if name == eventName {
+			jobStates.Add(strings.ToLower(strings.TrimPrefix(string(eventName), "JobState")), 1)
+			return
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"fmt"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+func (jm *JobManager) pauseJob(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventPauseJobMsg)
+	evResp := api.EventResponse{JobID: msg.JobID, Requestor: ev.Msg.Requestor()}
+	if err := jm.authorizeJobAction(ev.Msg.Requestor(), msg.JobID); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	var (
+		state event.Name
+		err   error
+	)
+	if msg.Paused {
+		state, err = jm.requestJobPause(ev.RequestID, msg.JobID)
+	} else {
+		state, err = jm.resumePausedJob(ev.ServerID, ev.RequestID, msg.JobID)
+	}
+	if err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	log.Infof("Job %d in state %s on request of %s", msg.JobID, state, ev.Msg.Requestor())
+	evResp.Status = &job.Status{State: string(state)}
+	return &evResp
+}
+
+// requestJobPause asks a running job to pause. Like with CancelJob, the job
+// is no longer tracked as running, so that it is neither cancelled nor timed
+// out while its steps are pausing. The job is marked as pausing before the
+// pause is signalled, so that it is marked as paused afterwards. requestID is
+// the ID of the API request which paused the job, if any.
+func (jm *JobManager) requestJobPause(requestID string, jobID types.JobID) (event.Name, error) {
+	jm.jobsMu.Lock()
+	j, ok := jm.jobs[jobID]
+	if ok {
+		delete(jm.jobs, jobID)
+	}
+	jm.jobsMu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("job %d is not running on this server", jobID)
+	}
+	_ = jm.emitErrEventTo(forRequest(jm.frameworkEvManager, requestID), jobID, EventJobPausing, nil)
+	j.Pause()
+	return EventJobPausing, nil
+}
+
+// checkResumable returns an error once the server is shutting down or
+// draining, after which no paused job is resumed.
+func (jm *JobManager) checkResumable() error {
+	select {
+	case <-jm.apiCancel:
+		return api.ErrDraining
+	default:
+	}
+	jm.jobsMu.Lock()
+	defer jm.jobsMu.Unlock()
+	if jm.draining {
+		return api.ErrDraining
+	}
+	return nil
+}
+
+// resumePausedJob resumes a job which was paused by this server, from the run
+// in which it was paused. Jobs paused by other servers are left to them, as
+// they may resume them when they start again.
+func (jm *JobManager) resumePausedJob(serverID, requestID string, jobID types.JobID) (event.Name, error) {
+	if err := jm.checkResumable(); err != nil {
+		return "", err
+	}
+	state, err := jm.jobState(jobID)
+	if err != nil {
+		return "", err
+	}
+	if state != EventJobPaused {
+		return "", fmt.Errorf("job %d cannot be resumed in state %s", jobID, state)
+	}
+	req, err := storage.NewJobStorageManager().GetJobRequest(jobID)
+	if err != nil {
+		return "", err
+	}
+	if req.ServerID != serverID {
+		return "", fmt.Errorf("job %d was paused by server %s", jobID, req.ServerID)
+	}
+	return jm.resumeJob(requestID, jobID, state)
+}
@@ -0,0 +1,51 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"sort"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/pluginregistry"
+)
+
+// describePlugins describes the plugins of a kind. kind is empty for the
+// plugins which cannot publish parameters schemas.
+func (jm *JobManager) describePlugins(kind string, names []string) []api.PluginDescription {
+	descs := make([]api.PluginDescription, 0, len(names))
+	for _, name := range names {
+		desc := api.PluginDescription{Name: name}
+		if kind != "" {
+			desc.ParametersSchemas = jm.pluginRegistry.ParametersSchemas(kind, name)
+		}
+		descs = append(descs, desc)
+	}
+	return descs
+}
+
+func (jm *JobManager) plugins(ev *api.Event) *api.EventResponse {
+	names := jm.pluginRegistry.Names()
+	plugins := api.ResponseDataPlugins{
+		TargetManagers: jm.describePlugins(pluginregistry.KindTargetManager, names.TargetManagers),
+		TestFetchers:   jm.describePlugins(pluginregistry.KindTestFetcher, names.TestFetchers),
+		TestSteps:      jm.describePlugins(pluginregistry.KindTestStep, names.TestSteps),
+		Reporters:      jm.describePlugins(pluginregistry.KindReporter, names.Reporters),
+		Lockers:        jm.describePlugins("", names.Lockers),
+	}
+	for idx := range plugins.TestSteps {
+		step := &plugins.TestSteps[idx]
+		// a test step may be registered without any event
+		stepEvents, _ := jm.pluginRegistry.NewTestStepEvents(step.Name)
+		for name := range stepEvents {
+			step.Events = append(step.Events, string(name))
+		}
+		sort.Strings(step.Events)
+	}
+	return &api.EventResponse{
+		Requestor: ev.Msg.Requestor(),
+		Plugins:   &plugins,
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/config"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// PreemptJobs lets the jobs which cannot lock their targets pause the jobs of
+// lower priority run by the server which hold them, and take over their
+// locks. The preempted jobs are resumed once the jobs preempting them ended.
+// The target locker must implement target.TransferableLocker.
+func PreemptJobs() Opt {
+	return func(jm *JobManager) {
+		jm.jobRunner.SetPreemptFunc(jm.preempt)
+	}
+}
+
+// PreemptionEventPayload is the payload of the events recording the
+// preemption of a job. TargetIDs are the targets whose locks were
+// transferred, if any.
+type PreemptionEventPayload struct {
+	PreemptedJobID  types.JobID
+	PreemptingJobID types.JobID
+	TargetIDs       []string `json:",omitempty"`
+}
+
+// preempt frees the targets of a job which other jobs locked, see
+// runner.PreemptFunc. All of them must be jobs of lower priority run by this
+// server: they are paused, and their locks transferred to the job once they
+// stopped running.
+func (jm *JobManager) preempt(j *job.Job, targets []*target.Target) error {
+	tl, ok := target.GetLocker().(target.TransferableLocker)
+	if !ok {
+		return fmt.Errorf("target locker %T cannot transfer locks", target.GetLocker())
+	}
+	owners, err := tl.LockOwners(targets)
+	if err != nil {
+		return fmt.Errorf("could not look up the owners of the locks: %v", err)
+	}
+	lockedTargets := make(map[types.JobID][]string)
+	for targetID, owner := range owners {
+		if owner != j.ID {
+			lockedTargets[owner] = append(lockedTargets[owner], targetID)
+		}
+	}
+
+	jm.jobsMu.Lock()
+	preemptions := make(map[types.JobID]chan struct{}, len(lockedTargets))
+	for owner := range lockedTargets {
+		other, ok := jm.jobs[owner]
+		if !ok || other.Priority >= j.Priority {
+			jm.jobsMu.Unlock()
+			return fmt.Errorf("job %d locks targets, and cannot be preempted by job %d", owner, j.ID)
+		}
+		preemptions[owner] = make(chan struct{})
+	}
+	for owner, stopped := range preemptions {
+		jm.preemptions[owner] = stopped
+		jm.preemptedJobs[j.ID] = append(jm.preemptedJobs[j.ID], owner)
+	}
+	jm.jobsMu.Unlock()
+
+	for owner := range preemptions {
+		log.Infof("Job %d preempts job %d to lock its targets", j.ID, owner)
+		_ = jm.emitPayloadEvent(owner, EventJobPreempted, PreemptionEventPayload{PreemptedJobID: owner, PreemptingJobID: j.ID})
+		if _, err := jm.requestJobPause("", owner); err != nil {
+			// the job ended meanwhile, and unlocked its targets
+			log.Infof("Could not pause job %d: %v", owner, err)
+			jm.preemptedJobStopped(owner)
+		}
+	}
+	for owner, stopped := range preemptions {
+		select {
+		case <-stopped:
+		case <-j.CancelCh:
+			return errors.New("job cancelled while preempting other jobs")
+		case <-time.After(config.TargetManagerTimeout):
+			return fmt.Errorf("job %d did not pause within %v", owner, config.TargetManagerTimeout)
+		}
+	}
+	for owner := range preemptions {
+		targetIDs := lockedTargets[owner]
+		sort.Strings(targetIDs)
+		if err := tl.TransferLocks(owner, j.ID, targets); err != nil {
+			return fmt.Errorf("could not transfer the locks of job %d: %v", owner, err)
+		}
+		_ = jm.emitPayloadEvent(j.ID, EventJobLocksTransferred, PreemptionEventPayload{PreemptedJobID: owner, PreemptingJobID: j.ID, TargetIDs: targetIDs})
+	}
+	return nil
+}
+
+// preemptedJobStopped signals a job preempting a job that the job no longer
+// runs, if it was preempted.
+func (jm *JobManager) preemptedJobStopped(jobID types.JobID) {
+	jm.jobsMu.Lock()
+	defer jm.jobsMu.Unlock()
+	stopped, ok := jm.preemptions[jobID]
+	if !ok {
+		return
+	}
+	select {
+	case <-stopped:
+	default:
+		close(stopped)
+	}
+}
+
+// resumePreemptedJobs resumes the jobs which a job preempted, once it ended.
+// The preempted jobs which were stopped meanwhile, or which did not pause,
+// are left as they are, as are all of them once the server is shutting down
+// or draining.
+func (jm *JobManager) resumePreemptedJobs(jobID types.JobID) {
+	jm.jobsMu.Lock()
+	preempted := jm.preemptedJobs[jobID]
+	delete(jm.preemptedJobs, jobID)
+	for _, id := range preempted {
+		delete(jm.preemptions, id)
+	}
+	jm.jobsMu.Unlock()
+	for _, id := range preempted {
+		_ = jm.emitPayloadEvent(id, EventJobPreemptionEnded, PreemptionEventPayload{PreemptedJobID: id, PreemptingJobID: jobID})
+		if err := jm.checkResumable(); err != nil {
+			log.Infof("Job %d preempted by job %d is left paused: %v", id, jobID, err)
+			continue
+		}
+		state, err := jm.jobState(id)
+		if err != nil {
+			log.Warningf("Could not resume job %d preempted by job %d: %v", id, jobID, err)
+			continue
+		}
+		if state != EventJobPaused {
+			log.Infof("Job %d preempted by job %d is not resumed in state %s", id, jobID, state)
+			continue
+		}
+		if _, err := jm.resumeJob("", id, state); err != nil {
+			log.Errorf("Could not resume job %d preempted by job %d: %v", id, jobID, err)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// Quotas bounds the resources used by the jobs of each requestor with
+// defaultQuota, unless overridden in overrides. The jobs of a requestor which
+// ran for its daily runtime are rejected until the next day, in UTC, and so
+// are the ones of a requestor whose jobs lock as many targets as allowed.
+// Jobs which would lock more targets than allowed, or which lock targets once
+// their requestor ran for its daily runtime, fail. The quotas can be changed
+// with the SetQuota API. Usage is tracked by the server, from the time it
+// started.
+func Quotas(defaultQuota api.Quota, overrides map[api.EventRequestor]api.Quota) Opt {
+	return func(jm *JobManager) {
+		jm.defaultQuota = defaultQuota
+		for requestor, quota := range overrides {
+			jm.requestorQuotas[requestor] = quota
+		}
+	}
+}
+
+// jobRuntime is the requestor of a running job, and the time it started
+// running.
+type jobRuntime struct {
+	requestor api.EventRequestor
+	since     time.Time
+}
+
+// quotaOf returns the quota of a requestor, and whether it overrides the
+// default one. quotasMu must be held.
+func (jm *JobManager) quotaOf(requestor api.EventRequestor) (api.Quota, bool) {
+	if quota, ok := jm.requestorQuotas[requestor]; ok {
+		return quota, true
+	}
+	return jm.defaultQuota, false
+}
+
+// rollRuntimeDay forgets the runtimes of the previous day once it ended.
+// quotasMu must be held.
+func (jm *JobManager) rollRuntimeDay(now time.Time) {
+	if day := now.UTC().Truncate(24 * time.Hour); !day.Equal(jm.runtimeDay) {
+		jm.runtimeDay = day
+		jm.runtimes = make(map[api.EventRequestor]time.Duration)
+	}
+}
+
+// runtimeToday returns the time the jobs of a requestor ran today, including
+// the ones still running. quotasMu must be held.
+func (jm *JobManager) runtimeToday(requestor api.EventRequestor, now time.Time) time.Duration {
+	jm.rollRuntimeDay(now)
+	runtime := jm.runtimes[requestor]
+	for _, r := range jm.runningSince {
+		if r.requestor == requestor {
+			runtime += now.Sub(latest(r.since, jm.runtimeDay))
+		}
+	}
+	return runtime
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// exhaustedRuntime returns whether a requestor ran for its daily runtime,
+// and for how long it ran. quotasMu must be held.
+func (jm *JobManager) exhaustedRuntime(requestor api.EventRequestor, quota api.Quota, now time.Time) (bool, time.Duration) {
+	if quota.MaxRuntimePerDay <= 0 {
+		return false, 0
+	}
+	runtime := jm.runtimeToday(requestor, now)
+	return runtime >= quota.MaxRuntimePerDay, runtime
+}
+
+// checkQuota returns an error if a requestor may not start a job, as it
+// exhausted its quota.
+func (jm *JobManager) checkQuota(requestor api.EventRequestor) error {
+	jm.quotasMu.Lock()
+	defer jm.quotasMu.Unlock()
+	quota, _ := jm.quotaOf(requestor)
+	now := time.Now()
+	if exhausted, runtime := jm.exhaustedRuntime(requestor, quota, now); exhausted {
+		return &api.LimitError{
+			Limit:      fmt.Sprintf("the jobs of requestor %s ran for %s today, its daily quota being %s", requestor, runtime.Round(time.Second), quota.MaxRuntimePerDay),
+			RetryAfter: jm.runtimeDay.Add(24 * time.Hour).Sub(now).Round(time.Second),
+		}
+	}
+	if quota.MaxTargets > 0 && jm.lockedTargets[requestor] >= quota.MaxTargets {
+		return &api.LimitError{
+			Limit:      fmt.Sprintf("the jobs of requestor %s lock %d targets, its quota", requestor, quota.MaxTargets),
+			RetryAfter: JobCapRetryAfter,
+		}
+	}
+	return nil
+}
+
+// startRuntime counts the runtime of a job of the requestor from now on.
+func (jm *JobManager) startRuntime(requestor api.EventRequestor, jobID types.JobID) {
+	jm.quotasMu.Lock()
+	defer jm.quotasMu.Unlock()
+	jm.runningSince[jobID] = jobRuntime{requestor: requestor, since: time.Now()}
+}
+
+// stopRuntime adds the runtime of a job which stopped running to the runtime
+// of its requestor. The runtimes of the other running jobs of the requestor
+// are added once they stop.
+func (jm *JobManager) stopRuntime(jobID types.JobID) {
+	jm.quotasMu.Lock()
+	defer jm.quotasMu.Unlock()
+	r, ok := jm.runningSince[jobID]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	jm.rollRuntimeDay(now)
+	delete(jm.runningSince, jobID)
+	jm.runtimes[r.requestor] += now.Sub(latest(r.since, jm.runtimeDay))
+}
+
+// reserveTargets counts the targets which a job locked against the quota of
+// its requestor, see runner.ReserveFunc.
+func (jm *JobManager) reserveTargets(j *job.Job, targets []*target.Target) (func(), error) {
+	jm.quotasMu.Lock()
+	defer jm.quotasMu.Unlock()
+	r, ok := jm.runningSince[j.ID]
+	if !ok {
+		return func() {}, nil
+	}
+	quota, _ := jm.quotaOf(r.requestor)
+	if exhausted, runtime := jm.exhaustedRuntime(r.requestor, quota, time.Now()); exhausted {
+		return nil, fmt.Errorf("%w: job %d cannot lock targets, as the jobs of requestor %s ran for %s today, its daily quota being %s", api.ErrQuotaExceeded, j.ID, r.requestor, runtime.Round(time.Second), quota.MaxRuntimePerDay)
+	}
+	locked := jm.lockedTargets[r.requestor]
+	if quota.MaxTargets > 0 && locked+len(targets) > quota.MaxTargets {
+		return nil, fmt.Errorf("%w: job %d cannot lock %d targets, as the jobs of requestor %s already lock %d of the %d targets of its quota", api.ErrQuotaExceeded, j.ID, len(targets), r.requestor, locked, quota.MaxTargets)
+	}
+	jm.lockedTargets[r.requestor] += len(targets)
+	return func() {
+		jm.quotasMu.Lock()
+		defer jm.quotasMu.Unlock()
+		if jm.lockedTargets[r.requestor] -= len(targets); jm.lockedTargets[r.requestor] <= 0 {
+			delete(jm.lockedTargets, r.requestor)
+		}
+	}, nil
+}
+
+// quotasData returns the quotas of the requestors, and the resources their
+// jobs use. quotasMu must be held.
+func (jm *JobManager) quotasData() *api.ResponseDataQuotas {
+	now := time.Now()
+	requestors := make(map[api.EventRequestor]bool)
+	for requestor := range jm.requestorQuotas {
+		requestors[requestor] = true
+	}
+	for requestor := range jm.lockedTargets {
+		requestors[requestor] = true
+	}
+	jm.rollRuntimeDay(now)
+	for requestor := range jm.runtimes {
+		requestors[requestor] = true
+	}
+	for _, r := range jm.runningSince {
+		requestors[r.requestor] = true
+	}
+	data := api.ResponseDataQuotas{Default: jm.defaultQuota}
+	for requestor := range requestors {
+		quota, override := jm.quotaOf(requestor)
+		data.Requestors = append(data.Requestors, api.RequestorQuota{
+			Requestor:     requestor,
+			Quota:         quota,
+			Override:      override,
+			LockedTargets: jm.lockedTargets[requestor],
+			RuntimeToday:  jm.runtimeToday(requestor, now),
+		})
+	}
+	sort.Slice(data.Requestors, func(i, j int) bool {
+		return data.Requestors[i].Requestor < data.Requestors[j].Requestor
+	})
+	return &data
+}
+
+func (jm *JobManager) quotas(ev *api.Event) *api.EventResponse {
+	jm.quotasMu.Lock()
+	defer jm.quotasMu.Unlock()
+	return &api.EventResponse{
+		Requestor: ev.Msg.Requestor(),
+		Quotas:    jm.quotasData(),
+	}
+}
+
+func (jm *JobManager) setQuota(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventSetQuotaMsg)
+	if err := jm.authorizer.Authorize(ev.Msg.Requestor(), api.PermissionManageServer); err != nil {
+		return &api.EventResponse{Requestor: ev.Msg.Requestor(), Err: err}
+	}
+	if msg.Quota != nil && (msg.Quota.MaxTargets < 0 || msg.Quota.MaxRuntimePerDay < 0) {
+		return &api.EventResponse{Requestor: ev.Msg.Requestor(), Err: errors.New("quotas cannot be negative")}
+	}
+	jm.quotasMu.Lock()
+	defer jm.quotasMu.Unlock()
+	switch {
+	case msg.QuotaRequestor == "" && msg.Quota == nil:
+		return &api.EventResponse{Requestor: ev.Msg.Requestor(), Err: errors.New("the default quota cannot be removed")}
+	case msg.QuotaRequestor == "":
+		log.Infof("Default quota set to %+v by %s", *msg.Quota, ev.Msg.Requestor())
+		jm.defaultQuota = *msg.Quota
+	case msg.Quota == nil:
+		log.Infof("Quota of %s reset to the default one by %s", msg.QuotaRequestor, ev.Msg.Requestor())
+		delete(jm.requestorQuotas, msg.QuotaRequestor)
+	default:
+		log.Infof("Quota of %s set to %+v by %s", msg.QuotaRequestor, *msg.Quota, ev.Msg.Requestor())
+		jm.requestorQuotas[msg.QuotaRequestor] = *msg.Quota
+	}
+	return &api.EventResponse{
+		Requestor: ev.Msg.Requestor(),
+		Quotas:    jm.quotasData(),
+	}
+}
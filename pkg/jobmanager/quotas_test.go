@@ -0,0 +1,38 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStopRuntimeConcurrentJobs(t *testing.T) {
+	jm := JobManager{
+		runtimes:     make(map[api.EventRequestor]time.Duration),
+		runningSince: make(map[types.JobID]jobRuntime),
+	}
+	now := time.Now()
+	jm.rollRuntimeDay(now)
+	// two jobs of the requestor started together, within the day
+	since := latest(now.Add(-time.Hour), jm.runtimeDay)
+	jm.runningSince[1] = jobRuntime{requestor: "alice", since: since}
+	jm.runningSince[2] = jobRuntime{requestor: "alice", since: since}
+
+	jm.stopRuntime(1)
+	require.InDelta(t, float64(now.Sub(since)), float64(jm.runtimes["alice"]), float64(time.Second))
+	// the runtime of the job still running is counted once
+	now = time.Now()
+	require.InDelta(t, float64(2*now.Sub(since)), float64(jm.runtimeToday("alice", now)), float64(time.Second))
+
+	jm.stopRuntime(2)
+	require.InDelta(t, float64(2*now.Sub(since)), float64(jm.runtimes["alice"]), float64(time.Second))
+	require.Empty(t, jm.runningSince)
+}
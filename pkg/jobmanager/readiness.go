@@ -0,0 +1,94 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/target"
+)
+
+// ReadinessCheckTimeout is the time given to each dependency of the server
+// to reply to a readiness check. It is shorter than api.DefaultEventTimeout,
+// so that an unreachable dependency fails its check rather than the request.
+var ReadinessCheckTimeout = time.Second
+
+func checkLocker(ctx context.Context) error {
+	locker := target.GetLocker()
+	if locker == nil {
+		return errors.New("no target locker set")
+	}
+	if p, ok := locker.(target.PingableLocker); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// checkPlugins checks that the plugins needed by any job are registered, and
+// returns how many of each kind are.
+func (jm *JobManager) checkPlugins() (string, error) {
+	names := jm.pluginRegistry.Names()
+	detail := fmt.Sprintf("%d target managers, %d test fetchers, %d test steps, %d reporters, %d lockers",
+		len(names.TargetManagers), len(names.TestFetchers), len(names.TestSteps), len(names.Reporters), len(names.Lockers))
+	if len(names.TargetManagers) == 0 || len(names.TestFetchers) == 0 || len(names.TestSteps) == 0 {
+		return detail, errors.New("no target manager, test fetcher or test step registered")
+	}
+	return detail, nil
+}
+
+func (jm *JobManager) readiness(ev *api.Event) *api.EventResponse {
+	readiness := api.ResponseDataReadiness{Ready: true}
+	check := func(name string, fn func(ctx context.Context) (string, error)) {
+		ctx, cancel := context.WithTimeout(context.Background(), ReadinessCheckTimeout)
+		defer cancel()
+		detail, err := fn(ctx)
+		c := api.ReadinessCheck{Name: name, Detail: detail}
+		if err != nil {
+			c.Error = err.Error()
+			readiness.Ready = false
+		}
+		readiness.Checks = append(readiness.Checks, c)
+	}
+	if states := jm.dependencyStates(); states != nil {
+		// the dependencies are checked periodically, see HealthChecks
+		for _, state := range states {
+			c := api.ReadinessCheck{Name: state.name, Detail: "up since " + state.since.Format(time.RFC3339)}
+			if state.err != nil {
+				c.Error = state.err.Error()
+				c.Detail = "down since " + state.since.Format(time.RFC3339)
+				readiness.Ready = false
+			}
+			readiness.Checks = append(readiness.Checks, c)
+		}
+	} else {
+		check("storage", func(ctx context.Context) (string, error) {
+			return "", storage.Ping(ctx)
+		})
+		check("locker", func(ctx context.Context) (string, error) {
+			return "", checkLocker(ctx)
+		})
+	}
+	check("plugins", func(context.Context) (string, error) {
+		return jm.checkPlugins()
+	})
+	check("drain", func(context.Context) (string, error) {
+		jm.jobsMu.Lock()
+		defer jm.jobsMu.Unlock()
+		if jm.draining {
+			return "", api.ErrDraining
+		}
+		return "", nil
+	})
+	return &api.EventResponse{
+		Requestor: ev.Msg.Requestor(),
+		Readiness: &readiness,
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// InterruptedJobPolicy tells what the JobManager does at startup with the
+// jobs which were not over when the server stopped, e.g. because it crashed
+// or was drained.
+type InterruptedJobPolicy string
+
+const (
+	// InterruptedJobsKeep leaves the interrupted jobs in their state, until
+	// a client retries them.
+	InterruptedJobsKeep InterruptedJobPolicy = "keep"
+	// InterruptedJobsResume runs the interrupted jobs again from the run
+	// which was interrupted.
+	InterruptedJobsResume InterruptedJobPolicy = "resume"
+	// InterruptedJobsFail fails the interrupted jobs.
+	InterruptedJobsFail InterruptedJobPolicy = "fail"
+)
+
+// errJobInterrupted is the error of the interrupted jobs which are failed.
+var errJobInterrupted = errors.New("job interrupted by a restart of the server")
+
+// interruptedJobStates are the states of the jobs which are not over.
+var interruptedJobStates = map[event.Name]bool{
+	EventJobAwaitingApproval: true,
+	EventJobScheduled:        true,
+	EventJobWaiting:          true,
+	EventJobQueued:           true,
+	EventJobStarted:          true,
+	EventJobPausing:          true,
+	EventJobPaused:           true,
+	EventJobCancelling:       true,
+}
+
+// ParseInterruptedJobPolicy returns the policy with the given name.
+func ParseInterruptedJobPolicy(name string) (InterruptedJobPolicy, error) {
+	switch p := InterruptedJobPolicy(name); p {
+	case InterruptedJobsKeep, InterruptedJobsResume, InterruptedJobsFail:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid interrupted job policy '%s', must be one of %s, %s, %s", name, InterruptedJobsKeep, InterruptedJobsResume, InterruptedJobsFail)
+}
+
+// InterruptedJobs sets what the JobManager does at startup with the jobs it
+// did not finish before it stopped. By default they are kept as they are.
+func InterruptedJobs(p InterruptedJobPolicy) Opt {
+	return func(jm *JobManager) {
+		jm.interruptedJobPolicy = p
+	}
+}
+
+// handleInterruptedJobs applies the interrupted job policy to the jobs which
+// the server started and did not finish before it stopped. The jobs which
+// were being cancelled are cancelled either way. Jobs are handled from the
+// oldest one, so that resumed jobs are queued in their original order.
+func (jm *JobManager) handleInterruptedJobs(serverID string) {
+	if jm.interruptedJobPolicy == "" || jm.interruptedJobPolicy == InterruptedJobsKeep {
+		return
+	}
+	jobIDs, err := storage.NewJobStorageManager().ListJobs(&storage.JobQuery{ServerID: serverID})
+	if err != nil {
+		log.Warningf("Could not look for interrupted jobs: %v", err)
+		return
+	}
+	for idx := len(jobIDs) - 1; idx >= 0; idx-- {
+		jobID := jobIDs[idx]
+		state, err := jm.jobState(jobID)
+		if err != nil {
+			log.Warningf("Could not check whether job %d was interrupted: %v", jobID, err)
+			continue
+		}
+		if !interruptedJobStates[state] {
+			continue
+		}
+		jm.handleInterruptedJob(jobID, state, jm.interruptedJobPolicy)
+	}
+}
+
+// handleInterruptedJob applies a policy to a job which was interrupted in the
+// given state. Jobs which were being cancelled are cancelled, and resumed
+// jobs which cannot be resumed fail.
+func (jm *JobManager) handleInterruptedJob(jobID types.JobID, state event.Name, policy InterruptedJobPolicy) {
+	switch {
+	case state == EventJobCancelling:
+		log.Infof("Job %d was interrupted while cancelling, cancelling it", jobID)
+		_ = jm.emitEvent(jobID, EventJobCancelled)
+	case policy == InterruptedJobsFail:
+		log.Infof("Job %d was interrupted in state %s, failing it", jobID, state)
+		_ = jm.emitErrEvent(jobID, EventJobFailed, errJobInterrupted)
+	default:
+		if _, err := jm.resumeJob("", jobID, state); err != nil {
+			log.Errorf("Could not resume job %d: %v", jobID, err)
+			_ = jm.emitErrEvent(jobID, EventJobFailed, fmt.Errorf("%w, and could not be resumed: %v", errJobInterrupted, err))
+		}
+	}
+}
+
+// resumeJob starts again an interrupted job from its request. A job which
+// was running resumes from the run which was interrupted, and a job which
+// was waiting for other jobs, for approval or for its start time waits for
+// them again. Resumed jobs are counted as running even if their requestor
+// runs as many jobs as allowed, as they were accepted before. The new state
+// of the job is returned. requestID is the ID of the API request which
+// resumed the job, if any.
+func (jm *JobManager) resumeJob(requestID string, jobID types.JobID, state event.Name) (event.Name, error) {
+	req, err := storage.NewJobStorageManager().GetJobRequest(jobID)
+	if err != nil {
+		return "", err
+	}
+	j, err := NewJob(jm.pluginRegistry, req.JobDescriptor)
+	if err != nil {
+		return "", err
+	}
+	j.ID = jobID
+	j.ScheduleID = req.ScheduleID
+	j.RetryOf = req.RetryOf
+	j.RerunOf = req.RerunOf
+	if j.ResumeRunID, err = jm.jobRunner.GetCurrentRun(jobID); err != nil {
+		return "", err
+	}
+	requestor := api.EventRequestor(req.Requestor)
+	jm.jobsMu.Lock()
+	jm.runningJobs[requestor]++
+	jm.jobsMu.Unlock()
+
+	if state == EventJobAwaitingApproval {
+		log.Infof("Resuming job %d, awaiting approval", jobID)
+		jm.awaitApproval(requestor, j)
+		return state, nil
+	}
+	if state == EventJobScheduled {
+		log.Infof("Resuming job %d, scheduled to start at %v", jobID, j.StartAt)
+		jm.holdUntilStartTime(requestor, j)
+		return state, nil
+	}
+	if state == EventJobWaiting && len(j.DependsOn) > 0 {
+		log.Infof("Resuming job %d, waiting for jobs %v", jobID, j.DependsOn)
+		jm.waitForDependencies(requestor, j)
+		return EventJobWaiting, nil
+	}
+	newState, err := jm.admitJob(requestor, j.Priority)
+	if err != nil {
+		jm.releaseJob(requestor)
+		return "", err
+	}
+	log.Infof("Resuming job %d interrupted in state %s", jobID, state)
+	_ = jm.emitErrEventTo(forRequest(jm.frameworkEvManager, requestID), jobID, newState, nil)
+	if newState == EventJobQueued {
+		jm.enqueueJob(requestor, j)
+	} else {
+		jm.runJob(requestor, j)
+	}
+	return newState, nil
+}
@@ -6,13 +6,180 @@
 package jobmanager
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
+
 	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/types"
 )
 
 func (jm *JobManager) retry(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventRetryMsg)
+	if err := jm.authorizeJobAction(ev.Msg.Requestor(), msg.JobID); err != nil {
+		return &api.EventResponse{Requestor: ev.Msg.Requestor(), Err: err}
+	}
+	rerun, state, err := jm.rerunJob(ev.Msg.Requestor(), ev.ServerID, ev.RequestID, msg.JobID, msg.FailedTargetsOnly)
+	if err != nil {
+		return &api.EventResponse{Requestor: ev.Msg.Requestor(), Err: err}
+	}
+	log.Infof("Job %d rerun as job %d by %s", msg.JobID, rerun.ID, ev.Msg.Requestor())
 	return &api.EventResponse{
+		JobID:     rerun.ID,
 		Requestor: ev.Msg.Requestor(),
-		Err:       fmt.Errorf("Not implemented"),
+		Status: &job.Status{
+			Name:      rerun.Name,
+			State:     string(state),
+			StartTime: time.Now(),
+			RerunOf:   msg.JobID,
+		},
+	}
+}
+
+// rerunJob starts an ended job again on request, on all its targets or only
+// on the ones which did not pass it. Unlike retries, reruns are started by
+// the requestor, and are linked to the job they rerun, which may be a rerun
+// too. The new job and its state are returned. requestID is the ID of the
+// API request which reran the job.
+func (jm *JobManager) rerunJob(requestor api.EventRequestor, serverID, requestID string, jobID types.JobID, failedTargetsOnly bool) (*job.Job, event.Name, error) {
+	state, err := jm.jobState(jobID)
+	if err != nil {
+		return nil, "", err
+	}
+	if state == "" {
+		return nil, "", fmt.Errorf("job %d does not exist", jobID)
+	}
+	if !isJobEnded(state) {
+		return nil, "", fmt.Errorf("job %d cannot be rerun in state %s, only ended jobs can", jobID, state)
+	}
+	req, err := storage.NewJobStorageManager().GetJobRequest(jobID)
+	if err != nil {
+		return nil, "", err
+	}
+	jobDescriptor := req.JobDescriptor
+	if failedTargetsOnly {
+		targetIDs, err := failedTargets(jobID)
+		if err != nil {
+			return nil, "", fmt.Errorf("could not find the failed targets of job %d: %w", jobID, err)
+		}
+		if len(targetIDs) == 0 {
+			return nil, "", fmt.Errorf("job %d has no failed targets", jobID)
+		}
+		if jobDescriptor, err = withTargetIDs(jobDescriptor, targetIDs); err != nil {
+			return nil, "", err
+		}
+	}
+	rerun, err := NewJob(jm.pluginRegistry, jobDescriptor)
+	if err != nil {
+		return nil, "", err
+	}
+	rerun.RerunOf = jobID
+	newState, err := jm.startJob(requestor, serverID, requestID, rerun, jobDescriptor)
+	if err != nil {
+		return nil, "", err
+	}
+	return rerun, newState, nil
+}
+
+// withTargetIDs restricts a job descriptor to the targets with the given IDs.
+func withTargetIDs(jobDescriptor string, targetIDs []string) (string, error) {
+	var jd map[string]interface{}
+	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil {
+		return "", fmt.Errorf("invalid job descriptor: %v", err)
+	}
+	jd["TargetIDs"] = targetIDs
+	data, err := json.Marshal(jd)
+	if err != nil {
+		return "", fmt.Errorf("could not encode job descriptor: %v", err)
+	}
+	return string(data), nil
+}
+
+// failedTargets returns the IDs of the targets which did not pass a job, in
+// any test or run.
+func failedTargets(jobID types.JobID) ([]string, error) {
+	results, err := storage.NewTargetResultManager().GetTargetResults(&storage.TargetResultQuery{
+		JobID:    jobID,
+		Outcomes: []target.Outcome{target.OutcomeFail, target.OutcomeError},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var targetIDs []string
+	seen := make(map[string]bool)
+	for _, result := range results {
+		if !seen[result.Target.ID] {
+			seen[result.Target.ID] = true
+			targetIDs = append(targetIDs, result.Target.ID)
+		}
+	}
+	return targetIDs, nil
+}
+
+// retryJob starts a job again after it failed, or after it completed with
+// unsuccessful reports, as long as its retry policy allows it. Retries are
+// new jobs, started with the job descriptor of the original job, and linked
+// to it. The jobs depending on the original job do not wait for its retries.
+func (jm *JobManager) retryJob(requestor api.EventRequestor, j *job.Job) {
+	if j.Retry.MaxRetries == 0 {
+		return
+	}
+	select {
+	case <-jm.apiCancel:
+		log.Infof("Not retrying job %d, the JobManager is shutting down", j.ID)
+		return
+	default:
+	}
+	original := j.ID
+	if j.RetryOf != 0 {
+		original = j.RetryOf
+	}
+	m := storage.NewJobStorageManager()
+	retries, err := m.ListJobs(&storage.JobQuery{RetryOf: original})
+	if err != nil {
+		log.Warningf("Could not retry job %d: %v", j.ID, err)
+		return
+	}
+	if uint(len(retries)) >= j.Retry.MaxRetries {
+		log.Infof("Job %d was retried %d times already, not retrying it again", original, len(retries))
+		return
+	}
+	req, err := m.GetJobRequest(j.ID)
+	if err != nil {
+		log.Warningf("Could not retry job %d: %v", j.ID, err)
+		return
+	}
+	jobDescriptor := req.JobDescriptor
+	if j.Retry.FailedTargetsOnly {
+		targetIDs, err := failedTargets(j.ID)
+		switch {
+		case errors.Is(err, storage.ErrTargetResultsNotSupported):
+			log.Warningf("Job %d is retried on all its targets: %v", j.ID, err)
+		case err != nil:
+			log.Warningf("Could not retry job %d: %v", j.ID, err)
+			return
+		case len(targetIDs) > 0:
+			if jobDescriptor, err = withTargetIDs(jobDescriptor, targetIDs); err != nil {
+				log.Warningf("Could not retry job %d: %v", j.ID, err)
+				return
+			}
+		}
+	}
+	retry, err := NewJob(jm.pluginRegistry, jobDescriptor)
+	if err != nil {
+		log.Warningf("Could not retry job %d: %v", j.ID, err)
+		return
+	}
+	retry.ScheduleID = j.ScheduleID
+	retry.RetryOf = original
+	if _, err := jm.startJob(requestor, req.ServerID, "", retry, jobDescriptor); err != nil {
+		log.Warningf("Could not retry job %d: %v", j.ID, err)
+		return
 	}
+	log.Infof("Job %d retried as job %d, retry %d of %d", original, retry.ID, len(retries)+1, j.Retry.MaxRetries)
 }
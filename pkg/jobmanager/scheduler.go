@@ -0,0 +1,234 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// queuedJob is a job waiting in the run queue.
+type queuedJob struct {
+	requestor api.EventRequestor
+	job       *job.Job
+	// seq is the arrival order of the job in the queue
+	seq uint64
+}
+
+// runQueue holds the queued jobs by decreasing priority, then by arrival.
+type runQueue []*queuedJob
+
+// before returns whether a job starts before another one, resources allowing.
+func (a *queuedJob) before(b *queuedJob) bool {
+	if a.job.Priority != b.job.Priority {
+		return a.job.Priority > b.job.Priority
+	}
+	return a.seq < b.seq
+}
+
+// insert adds a job to the queue, in order.
+func (q *runQueue) insert(qj *queuedJob) {
+	idx := sort.Search(len(*q), func(i int) bool { return qj.before((*q)[i]) })
+	*q = append(*q, nil)
+	copy((*q)[idx+1:], (*q)[idx:])
+	(*q)[idx] = qj
+}
+
+// MaxConcurrentJobs caps the number of jobs run at once by the server. The
+// jobs started beyond the cap wait in the run queue, by priority.
+func MaxConcurrentJobs(n int) Opt {
+	return func(jm *JobManager) {
+		jm.maxConcurrentJobs = n
+	}
+}
+
+// MaxConcurrentJobsPerRequestor caps the number of jobs run at once for each
+// requestor, within the cap of the server. The caps of the requestors in
+// overrides replace n, zero meaning no cap. The jobs started beyond the cap
+// of their requestor wait in the run queue, while the jobs of the other
+// requestors may start.
+func MaxConcurrentJobsPerRequestor(n int, overrides map[api.EventRequestor]int) Opt {
+	return func(jm *JobManager) {
+		jm.maxConcurrentJobsPerRequestor = n
+		jm.requestorMaxConcurrentJobs = overrides
+	}
+}
+
+// MaxQueuedJobs bounds the run queue. Jobs started while it is full are
+// rejected with an api.LimitError.
+func MaxQueuedJobs(n int) Opt {
+	return func(jm *JobManager) {
+		jm.maxQueuedJobs = n
+	}
+}
+
+// canRun returns whether a job of the requestor may take a run slot. It must
+// be called with jobsMu held.
+func (jm *JobManager) canRun(requestor api.EventRequestor) bool {
+	if jm.maxConcurrentJobs > 0 && jm.activeJobs >= jm.maxConcurrentJobs {
+		return false
+	}
+	limit, ok := jm.requestorMaxConcurrentJobs[requestor]
+	if !ok {
+		limit = jm.maxConcurrentJobsPerRequestor
+	}
+	return limit <= 0 || jm.activeRequestorJobs[requestor] < limit
+}
+
+// takeRunSlot counts a job of the requestor as running. It must be called
+// with jobsMu held.
+func (jm *JobManager) takeRunSlot(requestor api.EventRequestor) {
+	jm.activeJobs++
+	jm.activeRequestorJobs[requestor]++
+}
+
+// freeRunSlot stops counting a job of the requestor as running. It must be
+// called with jobsMu held.
+func (jm *JobManager) freeRunSlot(requestor api.EventRequestor) {
+	jm.activeJobs--
+	if jm.activeRequestorJobs[requestor]--; jm.activeRequestorJobs[requestor] <= 0 {
+		delete(jm.activeRequestorJobs, requestor)
+	}
+}
+
+// queuedAhead returns whether a queued job which can run would start before
+// a new job of the given priority. It must be called with jobsMu held.
+func (jm *JobManager) queuedAhead(priority int) bool {
+	for _, qj := range jm.queue {
+		if qj.job.Priority < priority {
+			return false
+		}
+		if jm.canRun(qj.requestor) {
+			return true
+		}
+	}
+	return false
+}
+
+// admitJob returns whether a new job of the requestor can start at once, in
+// which case it takes a run slot, or must wait in the run queue, in which
+// case it takes a place in the queue. Jobs do not start ahead of the queued
+// ones of the same or higher priority which can run.
+func (jm *JobManager) admitJob(requestor api.EventRequestor, priority int) (event.Name, error) {
+	jm.jobsMu.Lock()
+	defer jm.jobsMu.Unlock()
+	if jm.canRun(requestor) && !jm.queuedAhead(priority) {
+		jm.takeRunSlot(requestor)
+		return EventJobStarted, nil
+	}
+	if jm.maxQueuedJobs > 0 && jm.queuedJobs >= jm.maxQueuedJobs {
+		return "", &api.LimitError{
+			Limit:      fmt.Sprintf("the run queue is full with %d jobs", jm.maxQueuedJobs),
+			RetryAfter: JobCapRetryAfter,
+		}
+	}
+	jm.queuedJobs++
+	return EventJobQueued, nil
+}
+
+// unadmitJob gives back the run slot or the place in the queue taken by a job
+// which could not be stored. A run slot given back goes to the queued jobs.
+func (jm *JobManager) unadmitJob(requestor api.EventRequestor, state event.Name) {
+	var next []*queuedJob
+	jm.jobsMu.Lock()
+	switch state {
+	case EventJobQueued:
+		jm.queuedJobs--
+	case EventJobStarted:
+		jm.freeRunSlot(requestor)
+		next = jm.dequeueRunnableJobs()
+	}
+	jm.jobsMu.Unlock()
+	jm.startDequeuedJobs(next)
+}
+
+// enqueueJob adds a stored job to the run queue. The job may start at once,
+// if a run slot was freed since it was admitted.
+func (jm *JobManager) enqueueJob(requestor api.EventRequestor, j *job.Job) {
+	jm.jobsMu.Lock()
+	jm.queueSeq++
+	jm.queue.insert(&queuedJob{requestor: requestor, job: j, seq: jm.queueSeq})
+	jm.jobsMu.Unlock()
+	log.Infof("Job %d of %s queued with priority %d", j.ID, requestor, j.Priority)
+	jm.dispatchJobs()
+}
+
+// dequeueJob removes a job from the run queue, and returns it if it was
+// queued.
+func (jm *JobManager) dequeueJob(jobID types.JobID) *queuedJob {
+	jm.jobsMu.Lock()
+	defer jm.jobsMu.Unlock()
+	for idx, qj := range jm.queue {
+		if qj.job.ID == jobID {
+			jm.queue = append(jm.queue[:idx], jm.queue[idx+1:]...)
+			jm.queuedJobs--
+			return qj
+		}
+	}
+	return nil
+}
+
+// finishJob frees the run slot of a job of the requestor which ended, and
+// starts the next queued jobs. The slot is handed over to the queued jobs
+// under the same lock, so that no new job takes it first.
+func (jm *JobManager) finishJob(requestor api.EventRequestor) {
+	jm.jobsMu.Lock()
+	jm.freeRunSlot(requestor)
+	next := jm.dequeueRunnableJobs()
+	jm.jobsMu.Unlock()
+	jm.startDequeuedJobs(next)
+}
+
+// dispatchJobs starts the queued jobs which can run, by priority.
+func (jm *JobManager) dispatchJobs() {
+	jm.jobsMu.Lock()
+	next := jm.dequeueRunnableJobs()
+	jm.jobsMu.Unlock()
+	jm.startDequeuedJobs(next)
+}
+
+// dequeueRunnableJobs removes the queued jobs which can run from the run
+// queue, by priority, and takes their run slots. The jobs of the requestors
+// running as many jobs as they may are skipped. No job is dequeued once the
+// JobManager is shutting down: the queued jobs are left in the queued state.
+// It must be called with jobsMu held.
+func (jm *JobManager) dequeueRunnableJobs() []*queuedJob {
+	select {
+	case <-jm.apiCancel:
+		return nil
+	default:
+	}
+	var next []*queuedJob
+	remaining := jm.queue[:0]
+	for _, qj := range jm.queue {
+		if jm.canRun(qj.requestor) {
+			jm.takeRunSlot(qj.requestor)
+			jm.queuedJobs--
+			next = append(next, qj)
+		} else {
+			remaining = append(remaining, qj)
+		}
+	}
+	for idx := len(remaining); idx < len(jm.queue); idx++ {
+		jm.queue[idx] = nil
+	}
+	jm.queue = remaining
+	return next
+}
+
+// startDequeuedJobs starts the jobs removed from the run queue.
+func (jm *JobManager) startDequeuedJobs(next []*queuedJob) {
+	for _, qj := range next {
+		log.Infof("Job %d dequeued", qj.job.ID)
+		_ = jm.emitEvent(qj.job.ID, EventJobStarted)
+		jm.runJob(qj.requestor, qj.job)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/lib/cron"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/storage/limits"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// ScheduleCheckInterval is how often the JobManager looks for the schedules
+// which are due. Cron expressions have a resolution of one minute.
+var ScheduleCheckInterval = 10 * time.Second
+
+// nextRunTime returns when a schedule activates next, or the zero time if it
+// is paused or never activates again. Activations missed, e.g. while the
+// server was down or the schedule paused, are due at once. Cron expressions
+// are evaluated in the time zone of the server.
+func nextRunTime(s *storage.Schedule) time.Time {
+	if s.Paused {
+		return time.Time{}
+	}
+	expr, err := cron.Parse(s.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	from := s.LastRunTime
+	if from.IsZero() {
+		from = s.CreateTime
+	}
+	return expr.Next(from.Local())
+}
+
+func toAPISchedule(s *storage.Schedule) api.Schedule {
+	return api.Schedule{
+		ID:            s.ID,
+		Name:          s.Name,
+		Requestor:     api.EventRequestor(s.Requestor),
+		Cron:          s.Cron,
+		JobDescriptor: s.JobDescriptor,
+		Paused:        s.Paused,
+		CreateTime:    s.CreateTime,
+		NextRunTime:   nextRunTime(s),
+		LastRunTime:   s.LastRunTime,
+		LastJobID:     s.LastJobID,
+		LastError:     s.LastError,
+	}
+}
+
+// authorizeScheduleAction checks that the requestor may change a schedule:
+// requestors may change their own schedules, and those allowed to manage any
+// job may change any schedule.
+func (jm *JobManager) authorizeScheduleAction(requestor api.EventRequestor, s *storage.Schedule) error {
+	if jm.authorizer == nil {
+		return nil
+	}
+	if err := jm.authorizer.Authorize(requestor, api.PermissionManageAnyJob); err == nil {
+		return nil
+	}
+	if s.Requestor != string(requestor) {
+		return fmt.Errorf("%w: schedule %d was created by %s, and requestor %s lacks permission %s", api.ErrForbidden, s.ID, s.Requestor, requestor, api.PermissionManageAnyJob)
+	}
+	return jm.authorizer.Authorize(requestor, api.PermissionSubmitJobs)
+}
+
+func (jm *JobManager) createSchedule(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventCreateScheduleMsg)
+	evResp := api.EventResponse{Requestor: ev.Msg.Requestor()}
+	if err := jm.authorizer.Authorize(ev.Msg.Requestor(), api.PermissionSubmitJobs); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	if _, err := cron.Parse(msg.Cron); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	// the job descriptor is checked like the ones of the jobs started at
+	// once, so that the schedule does not fail at every activation. Its
+	// includes are expanded again by every activation, so that the jobs
+	// use the current fragments of the library.
+	jobDescriptor, err := jm.prepareDescriptor(msg.JobDescriptor)
+	if err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	j, err := NewJob(jm.pluginRegistry, jobDescriptor)
+	if err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	name := msg.Name
+	if name == "" {
+		name = j.Name
+	}
+	if err := limits.NewValidator().ValidateJobName(name); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	schedule := storage.Schedule{
+		Name:          name,
+		Requestor:     string(ev.Msg.Requestor()),
+		Cron:          msg.Cron,
+		JobDescriptor: msg.JobDescriptor,
+		CreateTime:    time.Now(),
+	}
+	if _, err := storage.NewScheduleManager().StoreSchedule(&schedule); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	log.Infof("Schedule %d '%s' created by %s with cron expression '%s'", schedule.ID, schedule.Name, schedule.Requestor, schedule.Cron)
+	evResp.Schedules = []api.Schedule{toAPISchedule(&schedule)}
+	return &evResp
+}
+
+func (jm *JobManager) listSchedules(ev *api.Event) *api.EventResponse {
+	evResp := api.EventResponse{Requestor: ev.Msg.Requestor()}
+	schedules, err := storage.NewScheduleManager().ListSchedules()
+	if err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	evResp.Schedules = make([]api.Schedule, 0, len(schedules))
+	for idx := range schedules {
+		evResp.Schedules = append(evResp.Schedules, toAPISchedule(&schedules[idx]))
+	}
+	return &evResp
+}
+
+func (jm *JobManager) pauseSchedule(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventPauseScheduleMsg)
+	evResp := api.EventResponse{Requestor: ev.Msg.Requestor()}
+	m := storage.NewScheduleManager()
+	schedule, err := m.GetSchedule(msg.ScheduleID)
+	if err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	if err := jm.authorizeScheduleAction(ev.Msg.Requestor(), schedule); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	if schedule.Paused != msg.Paused {
+		schedule.Paused = msg.Paused
+		if err := m.UpdateSchedule(schedule); err != nil {
+			evResp.Err = err
+			return &evResp
+		}
+		action := "resumed"
+		if schedule.Paused {
+			action = "paused"
+		}
+		log.Infof("Schedule %d %s by %s", schedule.ID, action, ev.Msg.Requestor())
+	}
+	evResp.Schedules = []api.Schedule{toAPISchedule(schedule)}
+	return &evResp
+}
+
+func (jm *JobManager) deleteSchedule(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventDeleteScheduleMsg)
+	evResp := api.EventResponse{Requestor: ev.Msg.Requestor()}
+	m := storage.NewScheduleManager()
+	schedule, err := m.GetSchedule(msg.ScheduleID)
+	if err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	if err := jm.authorizeScheduleAction(ev.Msg.Requestor(), schedule); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	if err := m.DeleteSchedule(schedule.ID); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	log.Infof("Schedule %d deleted by %s", schedule.ID, ev.Msg.Requestor())
+	evResp.Schedules = []api.Schedule{toAPISchedule(schedule)}
+	return &evResp
+}
+
+// runSchedules starts a job for each schedule which is due. The outcome is
+// recorded in the schedule, which is due again at its next activation. The
+// schedules due while the server is draining are left for another server.
+func (jm *JobManager) runSchedules(serverID string, now time.Time) {
+	m := storage.NewScheduleManager()
+	schedules, err := m.ListSchedules()
+	if err != nil {
+		if !errors.Is(err, storage.ErrSchedulesNotSupported) {
+			log.Warningf("Could not run schedules: %v", err)
+		}
+		return
+	}
+	for idx := range schedules {
+		s := &schedules[idx]
+		next := nextRunTime(s)
+		if next.IsZero() || next.After(now) {
+			continue
+		}
+		jobID, err := jm.startScheduledJob(serverID, s)
+		if errors.Is(err, api.ErrDraining) {
+			return
+		}
+		s.LastRunTime, s.LastJobID, s.LastError = now, jobID, ""
+		if err != nil {
+			log.Warningf("Schedule %d could not start a job: %v", s.ID, err)
+			s.LastError = err.Error()
+		} else {
+			log.Infof("Schedule %d started job %d", s.ID, jobID)
+		}
+		if err := m.UpdateSchedule(s); err != nil {
+			log.Errorf("Could not record the run of schedule %d: %v", s.ID, err)
+		}
+	}
+}
+
+// startScheduledJob starts the job of a schedule on behalf of its creator.
+func (jm *JobManager) startScheduledJob(serverID string, s *storage.Schedule) (types.JobID, error) {
+	jobDescriptor, err := jm.prepareDescriptor(s.JobDescriptor)
+	if err != nil {
+		return 0, err
+	}
+	j, err := NewJob(jm.pluginRegistry, jobDescriptor)
+	if err != nil {
+		return 0, err
+	}
+	j.ScheduleID = s.ID
+	if _, err := jm.startJob(api.EventRequestor(s.Requestor), serverID, "", j, jobDescriptor); err != nil {
+		return 0, err
+	}
+	return j.ID, nil
+}
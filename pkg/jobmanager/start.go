@@ -6,115 +6,387 @@
 package jobmanager
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/facebookincubator/contest/pkg/api"
 	"github.com/facebookincubator/contest/pkg/event"
 	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/types"
 )
 
+// reserveJob counts a job of the requestor as running, unless the requestor
+// already runs as many jobs as allowed.
+func (jm *JobManager) reserveJob(requestor api.EventRequestor) error {
+	jm.jobsMu.Lock()
+	defer jm.jobsMu.Unlock()
+	if jm.draining {
+		return api.ErrDraining
+	}
+	if jm.maxRunningJobs > 0 && jm.runningJobs[requestor] >= jm.maxRunningJobs {
+		return &api.LimitError{
+			Limit:      fmt.Sprintf("requestor %s already runs %d jobs", requestor, jm.maxRunningJobs),
+			RetryAfter: JobCapRetryAfter,
+		}
+	}
+	jm.runningJobs[requestor]++
+	return nil
+}
+
+// releaseJob stops counting a job of the requestor as running.
+func (jm *JobManager) releaseJob(requestor api.EventRequestor) {
+	jm.jobsMu.Lock()
+	defer jm.jobsMu.Unlock()
+	if jm.runningJobs[requestor]--; jm.runningJobs[requestor] <= 0 {
+		delete(jm.runningJobs, requestor)
+	}
+	if jm.draining && len(jm.runningJobs) == 0 {
+		close(jm.idle)
+	}
+}
+
 func (jm *JobManager) start(ev *api.Event) *api.EventResponse {
 	msg := ev.Msg.(api.EventStartMsg)
-	j, err := NewJob(jm.pluginRegistry, msg.JobDescriptor)
+	if err := jm.authorizer.Authorize(ev.Msg.Requestor(), api.PermissionSubmitJobs); err != nil {
+		return &api.EventResponse{Requestor: ev.Msg.Requestor(), Err: err}
+	}
+	return jm.startDescriptor(ev.Msg.Requestor(), ev.ServerID, ev.RequestID, msg.JobDescriptor)
+}
+
+// startDescriptor validates a job descriptor and starts its job on behalf of
+// an authorized requestor, on the API request with the given ID.
+func (jm *JobManager) startDescriptor(requestor api.EventRequestor, serverID, requestID, jobDescriptor string) *api.EventResponse {
+	jobDescriptor, err := jm.prepareDescriptor(jobDescriptor)
 	if err != nil {
 		return &api.EventResponse{Err: err}
 	}
+	j, err := NewJob(jm.pluginRegistry, jobDescriptor)
+	if err != nil {
+		return &api.EventResponse{Err: err}
+	}
+	state, err := jm.startJob(requestor, serverID, requestID, j, jobDescriptor)
+	if err != nil {
+		return &api.EventResponse{
+			Requestor: requestor,
+			Err:       err,
+		}
+	}
+	return &api.EventResponse{
+		JobID:     j.ID,
+		Requestor: requestor,
+		Err:       nil,
+		Status: &job.Status{
+			Name:      j.Name,
+			State:     string(state),
+			StartTime: time.Now(),
+		},
+	}
+}
+
+func (jm *JobManager) startBatch(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventStartBatchMsg)
+	evResp := api.EventResponse{Requestor: ev.Msg.Requestor()}
+	if err := jm.authorizer.Authorize(ev.Msg.Requestor(), api.PermissionSubmitJobs); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	// all the job descriptors are validated before starting any job
+	jobs := make([]*job.Job, len(msg.JobDescriptors))
+	jobDescriptors := make([]string, len(msg.JobDescriptors))
+	evResp.BatchJobs = make([]api.BatchJob, len(msg.JobDescriptors))
+	var invalid int
+	for idx, jobDescriptor := range msg.JobDescriptors {
+		jobDescriptor, err := jm.prepareDescriptor(jobDescriptor)
+		if err != nil {
+			evResp.BatchJobs[idx].Error = err.Error()
+			invalid++
+			continue
+		}
+		j, err := NewJob(jm.pluginRegistry, jobDescriptor)
+		if err != nil {
+			evResp.BatchJobs[idx].Error = err.Error()
+			invalid++
+			continue
+		}
+		jobs[idx] = j
+		jobDescriptors[idx] = jobDescriptor
+	}
+	if msg.Atomic && invalid > 0 {
+		for idx, j := range jobs {
+			if j != nil {
+				evResp.BatchJobs[idx].Error = "not started, as other job descriptors of the batch are invalid"
+			}
+		}
+		evResp.Err = fmt.Errorf("%d of %d job descriptors are invalid, no job was started", invalid, len(jobs))
+		return &evResp
+	}
+	for idx, j := range jobs {
+		if j == nil {
+			continue
+		}
+		if _, err := jm.startJob(ev.Msg.Requestor(), ev.ServerID, ev.RequestID, j, jobDescriptors[idx]); err != nil {
+			evResp.BatchJobs[idx].Error = err.Error()
+			continue
+		}
+		evResp.BatchJobs[idx].JobID = j.ID
+	}
+	return &evResp
+}
+
+// startJob stores the request of a validated job, and runs the job in the
+// background, or queues it if the server runs as many jobs as it can, or
+// holds it until its start time, or until the jobs it depends on completed.
+// The ID of the job is set once it is stored, and the state of the job is
+// returned. requestID is the ID of the API request which started the job, if
+// any, which the events of the new state record.
+func (jm *JobManager) startJob(requestor api.EventRequestor, serverID, requestID string, j *job.Job, jobDescriptor string) (event.Name, error) {
+	if len(j.Webhooks) > 0 && jm.webhookSender == nil {
+		return "", errors.New("job webhooks are not enabled on this server")
+	}
+	if err := jm.checkQuota(requestor); err != nil {
+		return "", err
+	}
+	if err := jm.reserveJob(requestor); err != nil {
+		return "", err
+	}
+	approvalReason, err := jm.approvalReason(j, jobDescriptor)
+	if err != nil {
+		jm.releaseJob(requestor)
+		return "", err
+	}
+	// jobs with dependencies take a run slot only once the jobs they depend
+	// on completed, jobs awaiting approval once they are approved, and
+	// scheduled jobs once their start time came
+	state := EventJobWaiting
+	if len(j.DependsOn) > 0 {
+		if err := jm.checkDependencies(j.DependsOn); err != nil {
+			jm.releaseJob(requestor)
+			return "", err
+		}
+	}
+	switch {
+	case approvalReason != "":
+		state = EventJobAwaitingApproval
+	case j.StartAt.After(time.Now()):
+		state = EventJobScheduled
+	case len(j.DependsOn) == 0:
+		if state, err = jm.admitJob(requestor, j.Priority); err != nil {
+			jm.releaseJob(requestor)
+			return "", err
+		}
+	}
 	// The job descriptor has been validated correctly, now use the JobRequestEmitter
 	// interface to obtain a JobRequest object with a valid id
 	request := job.Request{
 		JobName:         j.Name,
-		Requestor:       string(ev.Msg.Requestor()),
-		ServerID:        ev.ServerID,
+		Requestor:       string(requestor),
+		ServerID:        serverID,
 		RequestTime:     time.Now(),
-		JobDescriptor:   msg.JobDescriptor,
+		JobDescriptor:   jobDescriptor,
 		TestDescriptors: j.TestDescriptors,
+		Tags:            j.Tags,
+		ScheduleID:      j.ScheduleID,
+		RetryOf:         j.RetryOf,
+		RerunOf:         j.RerunOf,
 	}
-	jobID, err := jm.jobStorageManager.StoreJobRequest(&request)
+	// the job request and the event marking the job as started or queued
+	// are written together, so that no job is left without a state
+	var jobID types.JobID
+	err = storage.Transact(func(tx *storage.Transaction) error {
+		var err error
+		if jobID, err = tx.StoreJobRequest(&request); err != nil {
+			return fmt.Errorf("could not create job request: %v", err)
+		}
+		return jm.emitErrEventTo(forRequest(tx, requestID), jobID, state, nil)
+	})
 	if err != nil {
-		return &api.EventResponse{
-			Requestor: ev.Msg.Requestor(),
-			Err:       fmt.Errorf("could not create job request: %v", err)}
+		jm.unadmitJob(requestor, state)
+		jm.releaseJob(requestor)
+		return "", err
 	}
 	j.ID = jobID
-	if err := jm.emitEvent(j.ID, EventJobStarted); err != nil {
-		return &api.EventResponse{
-			Requestor: ev.Msg.Requestor(),
-			Err:       err,
-		}
+	switch state {
+	case EventJobAwaitingApproval:
+		log.Infof("Job %d of %s awaits approval: %s", jobID, requestor, approvalReason)
+		_ = jm.emitPayloadEventTo(forRequest(jm.frameworkEvManager, requestID), jobID, EventJobApprovalRequested, ApprovalEventPayload{Reason: approvalReason})
+		jm.awaitApproval(requestor, j)
+	case EventJobScheduled:
+		jm.holdUntilStartTime(requestor, j)
+	case EventJobWaiting:
+		jm.waitForDependencies(requestor, j)
+	case EventJobQueued:
+		jm.enqueueJob(requestor, j)
+	default:
+		jm.runJob(requestor, j)
 	}
+	return state, nil
+}
 
+// timeoutJob cancels a job which ran longer than its timeout, unless it was
+// cancelled already. timedOut is closed before the job is cancelled, so that
+// the job is seen as timed out once it ends.
+func (jm *JobManager) timeoutJob(j *job.Job, timedOut chan<- struct{}) {
+	jm.jobsMu.Lock()
+	_, running := jm.jobs[j.ID]
+	if running {
+		close(timedOut)
+	}
+	jm.jobsMu.Unlock()
+	if !running {
+		return
+	}
+	log.Infof("Job %d exceeded its timeout of %s, cancelling it", j.ID, j.Timeout)
+	_ = jm.emitErrEvent(j.ID, EventJobTimeout, fmt.Errorf("job exceeded its timeout of %s", j.Timeout))
+	if err := jm.CancelJob(j.ID); err != nil {
+		log.Warningf("Could not cancel job %d: %v", j.ID, err)
+	}
+}
+
+// runJob runs a started job in the background, in a run slot which is freed
+// once the job ends.
+func (jm *JobManager) runJob(requestor api.EventRequestor, j *job.Job) {
+	jobID := j.ID
+	log := logging.AddField(log, logging.FieldJobID, jobID)
+	// the job is tracked as running until it ends, or until it is cancelled
+	// or paused on request
+	jm.jobsMu.Lock()
+	jm.jobs[jobID] = j
+	jm.jobsMu.Unlock()
 	jm.jobsWg.Add(1)
 	go func() {
 		defer jm.jobsWg.Done()
+		// the job is retried once it freed its run slot, if it failed or
+		// completed with unsuccessful reports
+		var (
+			endState     event.Name
+			unsuccessful bool
+		)
+		defer func() {
+			if endState == EventJobFailed || unsuccessful {
+				jm.retryJob(requestor, j)
+			}
+		}()
+		// the jobs which the job preempted resume once it ended
+		defer jm.resumePreemptedJobs(jobID)
+		defer jm.finishJob(requestor)
+		defer jm.releaseJob(requestor)
+		// the jobs depending on the job are notified once it ended
+		defer func() {
+			if endState != "" {
+				jm.resolveDependents(jobID, endState)
+			}
+		}()
+
+		// a job preempting this one waits until it stopped running
+		defer jm.preemptedJobStopped(jobID)
+		// a resumed job is tracked as another job with the same ID, which is
+		// not to be forgotten when this one ends
+		defer func() {
+			jm.jobsMu.Lock()
+			if jm.jobs[jobID] == j {
+				delete(jm.jobs, jobID)
+			}
+			jm.jobsMu.Unlock()
+		}()
 
-		jm.jobsMu.Lock()
-		jm.jobs[j.ID] = j
-		jm.jobsMu.Unlock()
+		// a job running past its timeout is cancelled, and fails once the
+		// cancellation completed
+		timedOut := make(chan struct{})
+		if j.Timeout > 0 {
+			timer := time.AfterFunc(j.Timeout, func() { jm.timeoutJob(j, timedOut) })
+			defer timer.Stop()
+		}
 
 		start := time.Now()
+		jm.startRuntime(requestor, jobID)
 		runReports, finalReports, err := jm.jobRunner.Run(j)
+		jm.stopRuntime(jobID)
 		duration := time.Since(start)
 		log.Debugf("job %d terminated", j.ID)
+		// the state of a job which the server lost is up to its owner
+		if jm.fencedJobStopped(jobID) {
+			log.Warningf("Job %d stopped after %s, as the server may no longer own it", j.ID, duration)
+			return
+		}
+		select {
+		case <-timedOut:
+			endState = EventJobFailed
+			errTimeout := fmt.Errorf("job exceeded its timeout of %s", j.Timeout)
+			if err != nil {
+				errTimeout = fmt.Errorf("%v, and failed cancellation: %v", errTimeout, err)
+			}
+			_ = jm.emitErrEvent(jobID, endState, errTimeout)
+			return
+		default:
+		}
 		// If the Job was cancelled, the error returned by JobRunner indicates whether
 		// the cancellatioon has been successful or failed
 		if j.IsCancelled() {
+			var errCancellation error
 			if err != nil {
-				errCancellation := fmt.Errorf("Job %+v failed cancellation: %v", j, err)
+				errCancellation = fmt.Errorf("Job %+v failed cancellation: %v", j, err)
 				log.Error(errCancellation)
-				_ = jm.emitErrEvent(jobID, EventJobCancellationFailed, errCancellation)
+				endState = EventJobCancellationFailed
 			} else {
-				_ = jm.emitEvent(jobID, EventJobCancelled)
+				endState = EventJobCancelled
 			}
+			_ = jm.emitErrEvent(jobID, endState, errCancellation)
+			return
+		}
+		// a paused job has no report yet, as it may be resumed
+		if j.IsPaused() {
+			log.Infof("Job %d paused after %s", j.ID, duration)
+			_ = jm.emitEvent(jobID, EventJobPaused)
 			return
 		}
 
-		// store job report before emitting the job status event, to avoid a
-		// race condition when waiting on a job status where the event is marked
-		// as completed but no report exists.
 		jobReport := job.JobReport{
 			JobID:        j.ID,
 			RunReports:   runReports,
 			FinalReports: finalReports,
 		}
-		if storageErr := jm.jobStorageManager.StoreJobReport(&jobReport); storageErr != nil {
-			log.Warningf("Could not emit job report: %v", storageErr)
+		for _, err := range jobReport.EnforceSchema() {
+			log.Warningf("Job %d: %v", j.ID, err)
 		}
-		// at this point it is safe to emit the job status event. Note: this is
-		// checking `err` from the `jm.jobRunner.Run()` call above.
+		// Note: this is checking `err` from the `jm.jobRunner.Run()` call above.
+		// If the JobManager doesn't return any error, the outcome of the Job
+		// might have been any of the following:
+		// * Job completed successfully
+		// * Job was cancelled
+		var eventToEmit event.Name
 		if err != nil {
 			errMsg := fmt.Sprintf("Job %+v failed after %s : %v", j, duration, err)
 			log.Errorf(errMsg)
-			_ = jm.emitErrEvent(jobID, EventJobFailed, err)
+			eventToEmit = EventJobFailed
+		} else if j.IsCancelled() {
+			log.Infof("Job %+v completed cancellation", j)
+			eventToEmit = EventJobCancelled
 		} else {
-			// If the JobManager doesn't return any error, the outcome of the Job
-			// might have been any of the following:
-			// * Job completed successfully
-			// * Job was cancelled
-			var eventToEmit event.Name
-			if j.IsCancelled() {
-				log.Infof("Job %+v completed cancellation", j)
-				eventToEmit = EventJobCancelled
-			} else {
-				log.Infof("Job %+v completed after %s", j, duration)
-				eventToEmit = EventJobCompleted
+			log.Infof("Job %+v completed after %s", j, duration)
+			eventToEmit = EventJobCompleted
+			unsuccessful = !jobReport.Successful()
+		}
+		// store the job report along with the job status event, to avoid a
+		// race condition when waiting on a job status where the event is
+		// marked as completed but no report exists, and so that a crash
+		// cannot persist one without the other. If the report cannot be
+		// stored, the job status event is still emitted.
+		endState = eventToEmit
+		log.Debugf("emitting: %v", eventToEmit)
+		txErr := storage.Transact(func(tx *storage.Transaction) error {
+			if err := tx.StoreJobReport(&jobReport); err != nil {
+				return err
 			}
-			log.Debugf("emitting: %v", eventToEmit)
-			err = jm.emitEvent(jobID, eventToEmit)
-			if err != nil {
+			return jm.emitErrEventTo(tx, jobID, eventToEmit, err)
+		})
+		if txErr != nil {
+			log.Warningf("Could not emit job report: %v", txErr)
+			if err := jm.emitErrEvent(jobID, eventToEmit, err); err != nil {
 				log.Warningf("event emission failed: %v", err)
 			}
 		}
 	}()
-
-	return &api.EventResponse{
-		JobID:     j.ID,
-		Requestor: ev.Msg.Requestor(),
-		Err:       nil,
-		Status: &job.Status{
-			Name:      j.Name,
-			State:     string(EventJobStarted),
-			StartTime: time.Now(),
-		},
-	}
 }
@@ -0,0 +1,86 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// timedJob is a job waiting for its start time.
+type timedJob struct {
+	requestor api.EventRequestor
+	job       *job.Job
+	timer     *time.Timer
+}
+
+// holdUntilStartTime holds a stored job until its start time, and then
+// starts it. Jobs whose start time passed already, e.g. resumed ones, start
+// at once.
+func (jm *JobManager) holdUntilStartTime(requestor api.EventRequestor, j *job.Job) {
+	tj := &timedJob{requestor: requestor, job: j}
+	jm.jobsMu.Lock()
+	jm.timedJobs[j.ID] = tj
+	tj.timer = time.AfterFunc(time.Until(j.StartAt), func() { jm.startTimedJob(j.ID) })
+	jm.jobsMu.Unlock()
+	log.Infof("Job %d of %s scheduled to start at %v", j.ID, requestor, j.StartAt)
+}
+
+// cancelTimedJob stops tracking a job waiting for its start time which is
+// cancelled, and returns it, or nil if the job does not wait for it.
+func (jm *JobManager) cancelTimedJob(jobID types.JobID) *timedJob {
+	jm.jobsMu.Lock()
+	defer jm.jobsMu.Unlock()
+	tj, ok := jm.timedJobs[jobID]
+	if !ok {
+		return nil
+	}
+	tj.timer.Stop()
+	delete(jm.timedJobs, jobID)
+	return tj
+}
+
+// startTimedJob starts a job whose start time came, or holds it until the
+// jobs it depends on completed, or queues it if the server runs as many jobs
+// as it can. No job is started once the JobManager is shutting down: the job
+// is left in the scheduled state.
+func (jm *JobManager) startTimedJob(jobID types.JobID) {
+	select {
+	case <-jm.apiCancel:
+		return
+	default:
+	}
+	jm.jobsMu.Lock()
+	tj, ok := jm.timedJobs[jobID]
+	delete(jm.timedJobs, jobID)
+	jm.jobsMu.Unlock()
+	if !ok {
+		return
+	}
+	j := tj.job
+	if len(j.DependsOn) > 0 {
+		_ = jm.emitEvent(jobID, EventJobWaiting)
+		jm.waitForDependencies(tj.requestor, j)
+		return
+	}
+	state, err := jm.admitJob(tj.requestor, j.Priority)
+	if err != nil {
+		_ = jm.emitErrEvent(jobID, EventJobFailed, err)
+		jm.releaseJob(tj.requestor)
+		jm.resolveDependents(jobID, EventJobFailed)
+		return
+	}
+	log.Infof("Job %d reached its start time", jobID)
+	_ = jm.emitEvent(jobID, state)
+	if state == EventJobQueued {
+		jm.enqueueJob(tj.requestor, j)
+	} else {
+		jm.runJob(tj.requestor, j)
+	}
+}
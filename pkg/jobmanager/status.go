@@ -25,14 +25,14 @@ func (jm *JobManager) status(ev *api.Event) *api.EventResponse {
 		Err:       nil,
 	}
 
-	report, err := jm.jobStorageManager.GetJobReport(jobID)
+	report, err := jm.statusStorageManager.GetJobReport(jobID)
 	if err != nil {
 		evResp.Err = fmt.Errorf("could not fetch job report: %v", err)
 		return &evResp
 	}
 
 	// Fetch all the events associated to changes of state of the Job
-	jobEvents, err := jm.frameworkEvManager.Fetch(
+	jobEvents, err := jm.statusEvFetcher.Fetch(
 		frameworkevent.QueryJobID(jobID),
 		frameworkevent.QueryEventNames(JobStateEvents),
 	)
@@ -40,7 +40,7 @@ func (jm *JobManager) status(ev *api.Event) *api.EventResponse {
 		evResp.Err = fmt.Errorf("could not fetch events associated to job state: %v", err)
 		return &evResp
 	}
-	req, err := jm.jobStorageManager.GetJobRequest(jobID)
+	req, err := jm.statusStorageManager.GetJobRequest(jobID)
 	if err != nil {
 		evResp.Err = fmt.Errorf("failed to fetch request for job ID %d: %w", jobID, err)
 		return &evResp
@@ -97,21 +97,28 @@ func (jm *JobManager) status(ev *api.Event) *api.EventResponse {
 
 	jobStatus := job.Status{
 		Name:        currentJob.Name,
+		Tags:        currentJob.Tags,
 		StartTime:   startTime,
 		EndTime:     endTime,
 		State:       state,
 		StateErrMsg: stateErrMsg,
 		JobReport:   report,
+		ScheduleID:  req.ScheduleID,
+		RetryOf:     req.RetryOf,
+		RerunOf:     req.RerunOf,
+	}
+	if !currentJob.StartAt.IsZero() {
+		jobStatus.StartAt = &currentJob.StartAt
 	}
 
 	// Fetch the ID of the last run that was started
-	runID, err := jm.jobRunner.GetCurrentRun(jobID)
+	runID, err := jm.statusRunner.GetCurrentRun(jobID)
 	if err != nil {
 		evResp.Err = fmt.Errorf("could not determine the current run id being executed: %v", err)
 		return &evResp
 	}
 	runCoordinates := job.RunCoordinates{JobID: jobID, RunID: runID}
-	runStatus, err := jm.jobRunner.BuildRunStatus(runCoordinates, currentJob)
+	runStatus, err := jm.statusRunner.BuildRunStatus(runCoordinates, currentJob)
 	if err != nil {
 		evResp.Err = fmt.Errorf("could not rebuild the status of the job: %v", err)
 		return &evResp
@@ -16,6 +16,88 @@ import (
 func (jm *JobManager) stop(ev *api.Event) *api.EventResponse {
 	msg := ev.Msg.(api.EventStopMsg)
 	jobID := msg.JobID
+	if err := jm.authorizeJobAction(ev.Msg.Requestor(), jobID); err != nil {
+		return &api.EventResponse{Requestor: ev.Msg.Requestor(), Err: err}
+	}
+	emitter := forRequest(jm.frameworkEvManager, ev.RequestID)
+	// a queued job has not started yet, so it is cancelled at once
+	if qj := jm.dequeueJob(jobID); qj != nil {
+		jm.releaseJob(qj.requestor)
+		_ = jm.emitErrEventTo(emitter, jobID, EventJobCancelled, nil)
+		jm.resolveDependents(jobID, EventJobCancelled)
+		return &api.EventResponse{
+			JobID:     jobID,
+			Requestor: ev.Msg.Requestor(),
+			Err:       nil,
+			Status: &job.Status{
+				Name:      qj.job.Name,
+				State:     string(EventJobCancelled),
+				StartTime: time.Now(),
+			},
+		}
+	}
+	// as is a job waiting for the jobs it depends on
+	if wj := jm.cancelWaitingJob(jobID); wj != nil {
+		jm.releaseJob(wj.requestor)
+		_ = jm.emitErrEventTo(emitter, jobID, EventJobCancelled, nil)
+		jm.resolveDependents(jobID, EventJobCancelled)
+		return &api.EventResponse{
+			JobID:     jobID,
+			Requestor: ev.Msg.Requestor(),
+			Err:       nil,
+			Status: &job.Status{
+				Name:      wj.job.Name,
+				State:     string(EventJobCancelled),
+				StartTime: time.Now(),
+			},
+		}
+	}
+	// as is a job awaiting approval
+	if aj := jm.cancelAwaitingJob(jobID); aj != nil {
+		jm.releaseJob(aj.requestor)
+		_ = jm.emitErrEventTo(emitter, jobID, EventJobCancelled, nil)
+		jm.resolveDependents(jobID, EventJobCancelled)
+		return &api.EventResponse{
+			JobID:     jobID,
+			Requestor: ev.Msg.Requestor(),
+			Err:       nil,
+			Status: &job.Status{
+				Name:      aj.job.Name,
+				State:     string(EventJobCancelled),
+				StartTime: time.Now(),
+			},
+		}
+	}
+	// or a job waiting for its start time
+	if tj := jm.cancelTimedJob(jobID); tj != nil {
+		jm.releaseJob(tj.requestor)
+		_ = jm.emitErrEventTo(emitter, jobID, EventJobCancelled, nil)
+		jm.resolveDependents(jobID, EventJobCancelled)
+		return &api.EventResponse{
+			JobID:     jobID,
+			Requestor: ev.Msg.Requestor(),
+			Err:       nil,
+			Status: &job.Status{
+				Name:      tj.job.Name,
+				State:     string(EventJobCancelled),
+				StartTime: time.Now(),
+			},
+		}
+	}
+	// or a paused job, which no longer runs
+	if state, err := jm.jobState(jobID); err == nil && state == EventJobPaused {
+		_ = jm.emitErrEventTo(emitter, jobID, EventJobCancelled, nil)
+		jm.resolveDependents(jobID, EventJobCancelled)
+		return &api.EventResponse{
+			JobID:     jobID,
+			Requestor: ev.Msg.Requestor(),
+			Err:       nil,
+			Status: &job.Status{
+				State:     string(EventJobCancelled),
+				StartTime: time.Now(),
+			},
+		}
+	}
 	// CancelJob is asynchronous, it closes the Job's cancellation signal which
 	// is propagated all the way down to the TestRunner. TestRunner  will wait
 	// TestRunnerShutdownTimeout before flagging the test as timed out. JobRunner
@@ -26,7 +108,7 @@ func (jm *JobManager) stop(ev *api.Event) *api.EventResponse {
 		log.Errorf("Cannot stop job: %v", err)
 		return &api.EventResponse{Err: fmt.Errorf("could not stop job: %v", err)}
 	}
-	_ = jm.emitEvent(jobID, EventJobCancelling)
+	_ = jm.emitErrEventTo(emitter, jobID, EventJobCancelling, nil)
 	return &api.EventResponse{
 		JobID:     jobID,
 		Requestor: ev.Msg.Requestor(),
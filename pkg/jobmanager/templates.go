@@ -0,0 +1,172 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/storage/limits"
+)
+
+// toAPITemplate decodes a stored template.
+func toAPITemplate(t *storage.Template) (api.JobTemplate, error) {
+	template := api.JobTemplate{
+		Requestor:  api.EventRequestor(t.Requestor),
+		CreateTime: t.CreateTime,
+		UpdateTime: t.UpdateTime,
+	}
+	if err := json.Unmarshal([]byte(t.Template), &template.Template); err != nil {
+		return template, fmt.Errorf("invalid template %s: %v", t.Name, err)
+	}
+	return template, nil
+}
+
+// authorizeTemplateAction checks that the requestor may replace or delete a
+// template: requestors may change the templates they stored last, and those
+// allowed to manage any job may change any template.
+func (jm *JobManager) authorizeTemplateAction(requestor api.EventRequestor, t *storage.Template) error {
+	if jm.authorizer == nil {
+		return nil
+	}
+	if err := jm.authorizer.Authorize(requestor, api.PermissionManageAnyJob); err == nil {
+		return nil
+	}
+	if t.Requestor != string(requestor) {
+		return fmt.Errorf("%w: template %s was stored by %s, and requestor %s lacks permission %s", api.ErrForbidden, t.Name, t.Requestor, requestor, api.PermissionManageAnyJob)
+	}
+	return jm.authorizer.Authorize(requestor, api.PermissionSubmitJobs)
+}
+
+func (jm *JobManager) saveTemplate(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventSaveTemplateMsg)
+	evResp := api.EventResponse{Requestor: ev.Msg.Requestor()}
+	if err := jm.authorizer.Authorize(ev.Msg.Requestor(), api.PermissionSubmitJobs); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	var template job.Template
+	if err := json.Unmarshal([]byte(msg.Template), &template); err != nil {
+		evResp.Err = fmt.Errorf("invalid template: %v", err)
+		return &evResp
+	}
+	if err := template.Validate(); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	if err := limits.NewValidator().ValidateJobName(template.Name); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	m := storage.NewTemplateManager()
+	existing, err := m.GetTemplate(template.Name)
+	switch {
+	case err == nil:
+		if err := jm.authorizeTemplateAction(ev.Msg.Requestor(), existing); err != nil {
+			evResp.Err = err
+			return &evResp
+		}
+	case !errors.Is(err, storage.ErrTemplateNotFound):
+		evResp.Err = err
+		return &evResp
+	}
+	// the template is stored in its canonical form
+	data, err := json.Marshal(template)
+	if err != nil {
+		evResp.Err = fmt.Errorf("could not encode template: %v", err)
+		return &evResp
+	}
+	now := time.Now()
+	stored := storage.Template{
+		Name:       template.Name,
+		Requestor:  string(ev.Msg.Requestor()),
+		Template:   string(data),
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	if err := m.StoreTemplate(&stored); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	log.Infof("Template %s stored by %s", stored.Name, stored.Requestor)
+	evResp.Templates = []api.JobTemplate{{
+		Template:   template,
+		Requestor:  ev.Msg.Requestor(),
+		CreateTime: stored.CreateTime,
+		UpdateTime: stored.UpdateTime,
+	}}
+	return &evResp
+}
+
+func (jm *JobManager) listTemplates(ev *api.Event) *api.EventResponse {
+	evResp := api.EventResponse{Requestor: ev.Msg.Requestor()}
+	templates, err := storage.NewTemplateManager().ListTemplates()
+	if err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	evResp.Templates = make([]api.JobTemplate, 0, len(templates))
+	for idx := range templates {
+		template, err := toAPITemplate(&templates[idx])
+		if err != nil {
+			log.Warningf("Could not list template: %v", err)
+			continue
+		}
+		evResp.Templates = append(evResp.Templates, template)
+	}
+	return &evResp
+}
+
+func (jm *JobManager) deleteTemplate(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventDeleteTemplateMsg)
+	evResp := api.EventResponse{Requestor: ev.Msg.Requestor()}
+	m := storage.NewTemplateManager()
+	stored, err := m.GetTemplate(msg.Name)
+	if err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	if err := jm.authorizeTemplateAction(ev.Msg.Requestor(), stored); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	if err := m.DeleteTemplate(stored.Name); err != nil {
+		evResp.Err = err
+		return &evResp
+	}
+	log.Infof("Template %s deleted by %s", stored.Name, ev.Msg.Requestor())
+	if template, err := toAPITemplate(stored); err == nil {
+		evResp.Templates = []api.JobTemplate{template}
+	}
+	return &evResp
+}
+
+// startTemplate renders a template with the given values, and starts the
+// resulting job descriptor like start does.
+func (jm *JobManager) startTemplate(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventStartTemplateMsg)
+	if err := jm.authorizer.Authorize(ev.Msg.Requestor(), api.PermissionSubmitJobs); err != nil {
+		return &api.EventResponse{Requestor: ev.Msg.Requestor(), Err: err}
+	}
+	stored, err := storage.NewTemplateManager().GetTemplate(msg.Name)
+	if err != nil {
+		return &api.EventResponse{Requestor: ev.Msg.Requestor(), Err: err}
+	}
+	template, err := toAPITemplate(stored)
+	if err != nil {
+		return &api.EventResponse{Requestor: ev.Msg.Requestor(), Err: err}
+	}
+	jobDescriptor, err := template.Render(msg.Values)
+	if err != nil {
+		return &api.EventResponse{Requestor: ev.Msg.Requestor(), Err: err}
+	}
+	return jm.startDescriptor(ev.Msg.Requestor(), ev.ServerID, ev.RequestID, jobDescriptor)
+}
@@ -0,0 +1,101 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+)
+
+// testEventQueryFields returns the query fields selecting the test events of
+// a search. Query fields cannot be set to zero values, so only the ones set
+// by the client are added.
+func testEventQueryFields(s api.TestEventSearch) []testevent.QueryField {
+	var fields []testevent.QueryField
+	if s.JobID != 0 {
+		fields = append(fields, testevent.QueryJobID(s.JobID))
+	}
+	if s.RunID != 0 {
+		fields = append(fields, testevent.QueryRunID(s.RunID))
+	}
+	if s.TestName != "" {
+		fields = append(fields, testevent.QueryTestName(s.TestName))
+	}
+	if s.TestStepLabel != "" {
+		fields = append(fields, testevent.QueryTestStepLabel(s.TestStepLabel))
+	}
+	if len(s.EventNames) != 0 {
+		fields = append(fields, testevent.QueryEventNames(s.EventNames))
+	}
+	if s.TargetID != "" {
+		fields = append(fields, testevent.QueryTargetID(s.TargetID))
+	}
+	if !s.EmittedStartTime.IsZero() {
+		fields = append(fields, testevent.QueryEmittedStartTime(s.EmittedStartTime))
+	}
+	if !s.EmittedEndTime.IsZero() {
+		fields = append(fields, testevent.QueryEmittedEndTime(s.EmittedEndTime))
+	}
+	if s.PayloadContains != "" {
+		fields = append(fields, testevent.QueryPayloadContains(s.PayloadContains))
+	}
+	if s.PayloadPath != "" {
+		fields = append(fields, testevent.QueryPayloadMatch(s.PayloadPath, s.PayloadValue))
+	}
+	if s.Limit != 0 {
+		fields = append(fields, testevent.QueryLimit(s.Limit))
+	}
+	if s.Offset != 0 {
+		fields = append(fields, testevent.QueryOffset(s.Offset))
+	}
+	return fields
+}
+
+func (jm *JobManager) testEvents(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventTestEventsMsg)
+	evResp := api.EventResponse{
+		JobID:     msg.JobID,
+		Requestor: ev.Msg.Requestor(),
+	}
+	events, err := jm.statusTestEvFetcher.Fetch(testEventQueryFields(api.TestEventSearch{
+		JobID:         msg.JobID,
+		RunID:         msg.RunID,
+		TestName:      msg.TestName,
+		TestStepLabel: msg.TestStepLabel,
+		Limit:         msg.Limit,
+		Offset:        msg.Offset,
+	})...)
+	if err != nil {
+		evResp.Err = fmt.Errorf("could not fetch events of job %d: %v", msg.JobID, err)
+		return &evResp
+	}
+	evResp.TestEvents = events
+	return &evResp
+}
+
+func (jm *JobManager) search(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventSearchMsg)
+	evResp := api.EventResponse{
+		JobID:     msg.Search.JobID,
+		Requestor: ev.Msg.Requestor(),
+	}
+	// payloads are filtered after reading the candidate events, which must
+	// not be the events of all the jobs
+	if msg.Search.JobID == 0 && (msg.Search.PayloadContains != "" || msg.Search.PayloadPath != "") {
+		evResp.Err = errors.New("searching events by payload requires a job ID")
+		return &evResp
+	}
+	events, err := jm.statusTestEvFetcher.Fetch(testEventQueryFields(msg.Search)...)
+	if err != nil {
+		evResp.Err = fmt.Errorf("could not search events: %v", err)
+		return &evResp
+	}
+	evResp.TestEvents = events
+	return &evResp
+}
@@ -0,0 +1,79 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"fmt"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// unlockTargets releases the locks held on targets by jobs which this server
+// does not run, see api.UnlockTargets. The target locker must implement
+// target.TransferableLocker to tell which jobs hold the locks.
+func (jm *JobManager) unlockTargets(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventUnlockTargetsMsg)
+	if err := jm.authorizer.Authorize(ev.Msg.Requestor(), api.PermissionUnlockTargets); err != nil {
+		return &api.EventResponse{Requestor: ev.Msg.Requestor(), Err: err}
+	}
+	tl, ok := target.GetLocker().(target.TransferableLocker)
+	if !ok {
+		return &api.EventResponse{
+			Requestor: ev.Msg.Requestor(),
+			Err:       fmt.Errorf("target locker %T cannot tell which jobs lock targets", target.GetLocker()),
+		}
+	}
+	targets := make([]*target.Target, 0, len(msg.TargetIDs))
+	for _, id := range msg.TargetIDs {
+		targets = append(targets, &target.Target{ID: id})
+	}
+	owners, err := tl.LockOwners(targets)
+	if err != nil {
+		return &api.EventResponse{
+			Requestor: ev.Msg.Requestor(),
+			Err:       fmt.Errorf("could not look up the owners of the locks: %v", err),
+		}
+	}
+	lockedTargets := make(map[types.JobID][]*target.Target)
+	for targetID, owner := range owners {
+		lockedTargets[owner] = append(lockedTargets[owner], &target.Target{ID: targetID})
+	}
+
+	// the jobs run by the server would lock their targets again when
+	// refreshing their locks
+	jm.jobsMu.Lock()
+	for owner := range lockedTargets {
+		if _, running := jm.jobs[owner]; running {
+			jm.jobsMu.Unlock()
+			return &api.EventResponse{
+				Requestor: ev.Msg.Requestor(),
+				Err:       fmt.Errorf("job %d locks targets and is running, stop it instead", owner),
+			}
+		}
+	}
+	jm.jobsMu.Unlock()
+
+	unlocked := make(map[string]types.JobID, len(owners))
+	for owner, ts := range lockedTargets {
+		log.Infof("Unlocking %d targets of job %d, as requested by %s", len(ts), owner, ev.Msg.Requestor())
+		if err := target.GetLocker().Unlock(owner, ts); err != nil {
+			return &api.EventResponse{
+				Requestor:       ev.Msg.Requestor(),
+				UnlockedTargets: unlocked,
+				Err:             fmt.Errorf("could not unlock the targets of job %d: %v", owner, err),
+			}
+		}
+		for _, t := range ts {
+			unlocked[t.ID] = owner
+		}
+	}
+	return &api.EventResponse{
+		Requestor:       ev.Msg.Requestor(),
+		UnlockedTargets: unlocked,
+	}
+}
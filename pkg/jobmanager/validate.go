@@ -0,0 +1,196 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/pluginregistry"
+	"github.com/facebookincubator/contest/pkg/storage/limits"
+	"github.com/facebookincubator/contest/pkg/test"
+)
+
+// validation collects the diagnostics of a job descriptor.
+type validation struct {
+	api.ResponseDataValidate
+}
+
+func (v *validation) errorf(path string, format string, args ...interface{}) {
+	v.Diagnostics = append(v.Diagnostics, api.Diagnostic{Severity: api.SeverityError, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validation) warnf(path string, format string, args ...interface{}) {
+	v.Diagnostics = append(v.Diagnostics, api.Diagnostic{Severity: api.SeverityWarning, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validation) hasErrors() bool {
+	for _, d := range v.Diagnostics {
+		if d.Severity == api.SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSteps checks a sequence of test steps one by one, so that every
+// invalid step is reported, and returns the labels of the valid ones.
+func (v *validation) validateSteps(pr *pluginregistry.PluginRegistry, path, testName string, testStepDescs []*test.TestStepDescriptor, labels map[string]bool, cleanup bool) []string {
+	var stepLabels []string
+	for idx, testStepDesc := range testStepDescs {
+		bundles, err := newStepBundles(pr, testName, []*test.TestStepDescriptor{testStepDesc}, labels, cleanup)
+		if err != nil {
+			v.errorf(fmt.Sprintf("%s[%d]", path, idx), "test %s: %v", testName, err)
+			continue
+		}
+		stepLabels = append(stepLabels, bundles[0].TestStepLabel)
+	}
+	return stepLabels
+}
+
+// validateTestDescriptor checks a test descriptor, and fetches its tests.
+func (v *validation) validateTestDescriptor(pr *pluginregistry.PluginRegistry, path string, td *test.TestDescriptor, testNames map[string]bool) {
+	if td == nil {
+		v.errorf(path, "test description is null")
+		return
+	}
+	if td.TargetManagerName == "" {
+		v.errorf(path+".TargetManagerName", "target manager name cannot be empty")
+	} else if _, err := pr.NewTargetManagerBundle(td); err != nil {
+		v.errorf(path+".TargetManagerName", "%v", err)
+	}
+	if td.TestFetcherName == "" {
+		v.errorf(path+".TestFetcherName", "test fetcher name cannot be empty")
+		return
+	}
+	tfb, err := pr.NewTestFetcherBundle(td)
+	if err != nil {
+		v.errorf(path+".TestFetcherName", "%v", err)
+		return
+	}
+	fetchedTests, err := fetchTests(tfb)
+	if err != nil {
+		v.errorf(path+".TestFetcherFetchParameters", "could not fetch tests: %v", err)
+		return
+	}
+	setupSteps, err := pr.ResolveIncludes(td.SetupSteps)
+	if err != nil {
+		v.errorf(path+".SetupSteps", "%v", err)
+	}
+	cleanupSteps, err := pr.ResolveIncludes(td.CleanupSteps)
+	if err != nil {
+		v.errorf(path+".CleanupSteps", "%v", err)
+	}
+	for _, fetched := range fetchedTests {
+		name := fetched.Name
+		if err := limits.NewValidator().ValidateTestName(name); err != nil {
+			v.errorf(path, "test %s: %v", name, err)
+		}
+		if testNames[name] {
+			v.errorf(path, "found duplicated test name in job: %s", name)
+		}
+		testNames[name] = true
+		testStepDescs, err := pr.ResolveIncludes(fetched.Steps)
+		if err != nil {
+			v.errorf(path+".TestFetcherFetchParameters", "test %s: %v", name, err)
+			continue
+		}
+		if len(testStepDescs) == 0 {
+			v.warnf(path+".TestFetcherFetchParameters", "test %s has no test step", name)
+		}
+		// labels must be unique across setup, test and cleanup steps
+		labels := make(map[string]bool)
+		validated := api.ValidatedTest{Name: name}
+		validated.Steps = append(validated.Steps, v.validateSteps(pr, path+".SetupSteps", name, setupSteps, labels, false)...)
+		validated.Steps = append(validated.Steps, v.validateSteps(pr, path+".TestFetcherFetchParameters", name, testStepDescs, labels, false)...)
+		validated.Steps = append(validated.Steps, v.validateSteps(pr, path+".CleanupSteps", name, cleanupSteps, labels, true)...)
+		v.Tests = append(v.Tests, validated)
+	}
+}
+
+// ValidateJobDescriptor checks a job descriptor as NewJob does, but reports
+// all the problems found rather than the first one, along with the tests
+// which the job would run. No target is acquired.
+func ValidateJobDescriptor(pr *pluginregistry.PluginRegistry, jobDescriptor string) api.ResponseDataValidate {
+	var v validation
+	jobDescriptor, err := job.MigrateDescriptor(jobDescriptor)
+	if err != nil {
+		v.errorf("Version", "%v", err)
+		return v.ResponseDataValidate
+	}
+	var jd *job.JobDescriptor
+	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil {
+		v.errorf("", "invalid job descriptor: %v", err)
+		return v.ResponseDataValidate
+	}
+	if err := checkJobDescriptor(jd); err != nil {
+		v.errorf("", "%v", err)
+	}
+	if jd == nil {
+		return v.ResponseDataValidate
+	}
+	if jd.Runs == 0 {
+		v.warnf("Runs", "the job runs until it is stopped, and its final reporters never run")
+	} else if jd.Runs == 1 && jd.RunInterval > 0 {
+		v.warnf("RunInterval", "the run interval is unused, as the job runs once")
+	}
+
+	testNames := make(map[string]bool)
+	for idx, td := range jd.TestDescriptors {
+		v.validateTestDescriptor(pr, fmt.Sprintf("TestDescriptors[%d]", idx), td, testNames)
+	}
+	for idx, reporter := range jd.Reporting.RunReporters {
+		if strings.TrimSpace(reporter.Name) == "" {
+			continue
+		}
+		if _, err := pr.NewRunReporterBundle(reporter.Name, reporter.Parameters); err != nil {
+			v.errorf(fmt.Sprintf("Reporting.RunReporters[%d]", idx), "%v", err)
+		}
+	}
+	for idx, reporter := range jd.Reporting.FinalReporters {
+		path := fmt.Sprintf("Reporting.FinalReporters[%d]", idx)
+		if strings.TrimSpace(reporter.Name) == "" {
+			v.errorf(path, "invalid empty or all-whitespace final reporter name")
+			continue
+		}
+		if _, err := pr.NewFinalReporterBundle(reporter.Name, reporter.Parameters); err != nil {
+			v.errorf(path, "%v", err)
+		}
+	}
+
+	// the checks above follow NewJob, which has the final say
+	if !v.hasErrors() {
+		if _, err := NewJob(pr, jobDescriptor); err != nil {
+			v.errorf("", "%v", err)
+		}
+	}
+	v.Valid = !v.hasErrors()
+	return v.ResponseDataValidate
+}
+
+func (jm *JobManager) validate(ev *api.Event) *api.EventResponse {
+	msg := ev.Msg.(api.EventValidateMsg)
+	if err := jm.authorizer.Authorize(ev.Msg.Requestor(), api.PermissionSubmitJobs); err != nil {
+		return &api.EventResponse{Requestor: ev.Msg.Requestor(), Err: err}
+	}
+	jobDescriptor, err := jm.prepareDescriptor(msg.JobDescriptor)
+	if err != nil {
+		var v validation
+		v.errorf("", "%v", err)
+		return &api.EventResponse{
+			Requestor:  ev.Msg.Requestor(),
+			Validation: &v.ResponseDataValidate,
+		}
+	}
+	validation := ValidateJobDescriptor(jm.pluginRegistry, jobDescriptor)
+	return &api.EventResponse{
+		Requestor:  ev.Msg.Requestor(),
+		Validation: &validation,
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jobmanager
+
+import (
+	"encoding/json"
+
+	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/webhook"
+)
+
+// Webhooks makes the JobManager call webhooks with the sender whenever jobs
+// change state: the given URLs for every job, and the ones set in the job
+// descriptors. Without this option, jobs setting webhooks are rejected.
+// Webhooks are called on a best-effort basis: the state changes of jobs
+// emitted faster than they are handled, or while the server stops, may not
+// be notified.
+func Webhooks(sender *webhook.Sender, urls []string) Opt {
+	return func(jm *JobManager) {
+		jm.webhookSender = sender
+		jm.webhookURLs = urls
+	}
+}
+
+// notifyWebhooks calls the webhooks for the job state events delivered to a
+// subscription to the events of all the jobs, until the stop channel is
+// closed.
+func (jm *JobManager) notifyWebhooks(sub *storage.Subscription, stop <-chan struct{}) {
+	defer func() { sub.Close() }()
+	for {
+		select {
+		case n, ok := <-sub.Events:
+			if !ok {
+				log.Warningf("Webhooks did not keep up with the emitted events, some state changes are not notified")
+				sub = storage.Subscribe(0, 0)
+				continue
+			}
+			if ev := n.FrameworkEvent; ev != nil && isEventIn(ev.EventName, JobStateEvents) {
+				go jm.callWebhooks(*ev)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// callWebhooks calls the webhooks of the server and of the job for a job
+// state event.
+func (jm *JobManager) callWebhooks(ev frameworkevent.Event) {
+	req, err := storage.NewJobStorageManager().GetJobRequest(ev.JobID)
+	if err != nil {
+		log.Warningf("Could not look up the webhooks of job %d: %v", ev.JobID, err)
+		return
+	}
+	urls := append([]string(nil), jm.webhookURLs...)
+	var jd job.JobDescriptor
+	if err := json.Unmarshal([]byte(req.JobDescriptor), &jd); err != nil {
+		log.Warningf("Could not look up the webhooks of job %d: %v", ev.JobID, err)
+	}
+	for _, u := range jd.Webhooks {
+		if !isStringIn(u, urls) {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		return
+	}
+	p := webhook.Payload{
+		JobID:     ev.JobID,
+		JobName:   req.JobName,
+		Requestor: req.Requestor,
+		State:     string(ev.EventName),
+		EmitTime:  ev.EmitTime,
+	}
+	if ev.Payload != nil {
+		var errPayload ErrorEventPayload
+		if err := json.Unmarshal(*ev.Payload, &errPayload); err == nil {
+			p.Err = errPayload.Err
+		}
+	}
+	for _, u := range urls {
+		go func(u string) {
+			if err := jm.webhookSender.Send(u, p); err != nil {
+				log.Warningf("Could not notify job %d entering state %s: %v", ev.JobID, ev.EventName, err)
+			}
+		}(u)
+	}
+}
+
+func isStringIn(s string, list []string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
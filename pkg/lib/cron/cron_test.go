@@ -0,0 +1,75 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestNext(t *testing.T) {
+	scenarios := []struct {
+		expr string
+		from string
+		next string
+	}{
+		{"* * * * *", "2020-06-15 10:30", "2020-06-15 10:31"},
+		{"*/15 * * * *", "2020-06-15 10:30", "2020-06-15 10:45"},
+		{"0 * * * *", "2020-06-15 23:30", "2020-06-16 00:00"},
+		{"30 2 * * *", "2020-06-15 10:30", "2020-06-16 02:30"},
+		{"0 8-18/2 * * *", "2020-06-15 10:30", "2020-06-15 12:00"},
+		{"0 0 1 * *", "2020-12-15 10:30", "2021-01-01 00:00"},
+		{"0 0 29 2 *", "2021-01-01 00:00", "2024-02-29 00:00"},
+		{"0 0 * * mon-fri", "2020-06-19 10:30", "2020-06-22 00:00"},
+		{"0 0 * * 7", "2020-06-15 10:30", "2020-06-21 00:00"},
+		{"0 0 1 jan *", "2020-06-15 10:30", "2021-01-01 00:00"},
+		// the day of month or the day of week must match if both are set
+		{"0 0 13 * 5", "2020-06-01 00:00", "2020-06-05 00:00"},
+		{"@daily", "2020-06-15 10:30", "2020-06-16 00:00"},
+		{"@hourly", "2020-06-15 10:30", "2020-06-15 11:00"},
+	}
+	for _, s := range scenarios {
+		e, err := Parse(s.expr)
+		require.NoError(t, err, s.expr)
+		require.Equal(t, date(s.next), e.Next(date(s.from)), s.expr)
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	e, err := Parse("0 0 30 2 *")
+	require.NoError(t, err)
+	require.True(t, e.Next(date("2020-06-15 10:30")).IsZero())
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@often",
+	} {
+		_, err := Parse(expr)
+		require.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,383 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package jsonschema validates JSON documents against JSON schemas. It
+// implements the subset of JSON Schema draft-07 which describes plugin
+// parameters: the type, enum, const, properties, required,
+// additionalProperties, items, minItems, maxItems, minLength, maxLength,
+// pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum, allOf,
+// anyOf, oneOf and not keywords. Annotations, e.g. title, description,
+// default and format, are not validated, and references are not supported.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a compiled JSON schema.
+type Schema struct {
+	// always is set for the true and false schemas, which accept and reject
+	// everything respectively
+	always *bool
+
+	types                []string
+	enum                 []interface{}
+	constValue           *interface{}
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *Schema
+	items                *Schema
+	minItems, maxItems   *int
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+	minimum, maximum     *float64
+	exclusiveMinimum     *float64
+	exclusiveMaximum     *float64
+	allOf, anyOf, oneOf  []*Schema
+	not                  *Schema
+}
+
+// schemaJSON is the JSON representation of a schema.
+type schemaJSON struct {
+	Ref                  string                     `json:"$ref"`
+	Type                 json.RawMessage            `json:"type"`
+	Enum                 []interface{}              `json:"enum"`
+	Const                json.RawMessage            `json:"const"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	Pattern              *string                    `json:"pattern"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	ExclusiveMinimum     *float64                   `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64                   `json:"exclusiveMaximum"`
+	AllOf                []json.RawMessage          `json:"allOf"`
+	AnyOf                []json.RawMessage          `json:"anyOf"`
+	OneOf                []json.RawMessage          `json:"oneOf"`
+	Not                  json.RawMessage            `json:"not"`
+}
+
+var validTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true,
+	"number": true, "integer": true, "string": true,
+}
+
+// Compile parses a JSON schema.
+func Compile(data []byte) (*Schema, error) {
+	return compile(data, "")
+}
+
+// compileAll compiles a list of subschemas.
+func compileAll(schemas []json.RawMessage, path string) ([]*Schema, error) {
+	var compiled []*Schema
+	for idx, data := range schemas {
+		s, err := compile(data, fmt.Sprintf("%s/%d", path, idx))
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, s)
+	}
+	return compiled, nil
+}
+
+// compileOptional compiles a subschema, if set.
+func compileOptional(data json.RawMessage, path string) (*Schema, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return compile(data, path)
+}
+
+func compile(data []byte, path string) (*Schema, error) {
+	data = bytes.TrimSpace(data)
+	switch string(data) {
+	case "true", "false":
+		always := string(data) == "true"
+		return &Schema{always: &always}, nil
+	}
+	var sj schemaJSON
+	if err := json.Unmarshal(data, &sj); err != nil {
+		return nil, fmt.Errorf("invalid schema at '%s': %v", path, err)
+	}
+	if sj.Ref != "" {
+		return nil, fmt.Errorf("invalid schema at '%s': references are not supported", path)
+	}
+	s := Schema{
+		enum:             sj.Enum,
+		required:         sj.Required,
+		minItems:         sj.MinItems,
+		maxItems:         sj.MaxItems,
+		minLength:        sj.MinLength,
+		maxLength:        sj.MaxLength,
+		minimum:          sj.Minimum,
+		maximum:          sj.Maximum,
+		exclusiveMinimum: sj.ExclusiveMinimum,
+		exclusiveMaximum: sj.ExclusiveMaximum,
+	}
+	if len(sj.Type) > 0 {
+		var typ string
+		if err := json.Unmarshal(sj.Type, &typ); err == nil {
+			s.types = []string{typ}
+		} else if err := json.Unmarshal(sj.Type, &s.types); err != nil {
+			return nil, fmt.Errorf("invalid type at '%s', must be a string or an array of strings", path)
+		}
+		for _, typ := range s.types {
+			if !validTypes[typ] {
+				return nil, fmt.Errorf("invalid type '%s' at '%s'", typ, path)
+			}
+		}
+	}
+	if len(sj.Const) > 0 {
+		var v interface{}
+		if err := json.Unmarshal(sj.Const, &v); err != nil {
+			return nil, fmt.Errorf("invalid const at '%s': %v", path, err)
+		}
+		s.constValue = &v
+	}
+	if sj.Pattern != nil {
+		re, err := regexp.Compile(*sj.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern at '%s': %v", path, err)
+		}
+		s.pattern = re
+	}
+	if len(sj.Properties) > 0 {
+		s.properties = make(map[string]*Schema, len(sj.Properties))
+		for name, data := range sj.Properties {
+			prop, err := compile(data, path+"/properties/"+name)
+			if err != nil {
+				return nil, err
+			}
+			s.properties[name] = prop
+		}
+	}
+	var err error
+	if s.additionalProperties, err = compileOptional(sj.AdditionalProperties, path+"/additionalProperties"); err != nil {
+		return nil, err
+	}
+	if s.items, err = compileOptional(sj.Items, path+"/items"); err != nil {
+		return nil, err
+	}
+	if s.not, err = compileOptional(sj.Not, path+"/not"); err != nil {
+		return nil, err
+	}
+	if s.allOf, err = compileAll(sj.AllOf, path+"/allOf"); err != nil {
+		return nil, err
+	}
+	if s.anyOf, err = compileAll(sj.AnyOf, path+"/anyOf"); err != nil {
+		return nil, err
+	}
+	if s.oneOf, err = compileAll(sj.OneOf, path+"/oneOf"); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Validate checks that a JSON document conforms to the schema. The error
+// tells where the document does not, as a JSON pointer.
+func (s *Schema) Validate(doc []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	return s.ValidateValue(v)
+}
+
+// ValidateValue checks that a value decoded by encoding/json conforms to the
+// schema.
+func (s *Schema) ValidateValue(v interface{}) error {
+	return s.validate(v, "")
+}
+
+// typeOf returns the JSON type of a value decoded by encoding/json.
+func typeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func errorAt(path, format string, args ...interface{}) error {
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+}
+
+func (s *Schema) validate(v interface{}, path string) error {
+	if s.always != nil {
+		if !*s.always {
+			return errorAt(path, "no value is allowed")
+		}
+		return nil
+	}
+	typ := typeOf(v)
+	if len(s.types) > 0 {
+		matched := false
+		for _, t := range s.types {
+			if t == typ || (t == "number" && typ == "integer") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return errorAt(path, "expected %s, got %s", strings.Join(s.types, " or "), typ)
+		}
+	}
+	if len(s.enum) > 0 {
+		matched := false
+		for _, allowed := range s.enum {
+			if reflect.DeepEqual(allowed, v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return errorAt(path, "value is not one of the allowed values")
+		}
+	}
+	if s.constValue != nil && !reflect.DeepEqual(*s.constValue, v) {
+		return errorAt(path, "value is not the allowed value")
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if err := s.validateObject(v, path); err != nil {
+			return err
+		}
+	case []interface{}:
+		if s.minItems != nil && len(v) < *s.minItems {
+			return errorAt(path, "expected at least %d items, got %d", *s.minItems, len(v))
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			return errorAt(path, "expected at most %d items, got %d", *s.maxItems, len(v))
+		}
+		if s.items != nil {
+			for idx, item := range v {
+				if err := s.items.validate(item, fmt.Sprintf("%s/%d", path, idx)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.minLength != nil && length < *s.minLength {
+			return errorAt(path, "expected at least %d characters, got %d", *s.minLength, length)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			return errorAt(path, "expected at most %d characters, got %d", *s.maxLength, length)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			return errorAt(path, "'%s' does not match pattern '%s'", v, s.pattern)
+		}
+	case float64:
+		if s.minimum != nil && v < *s.minimum {
+			return errorAt(path, "%v is less than the minimum of %v", v, *s.minimum)
+		}
+		if s.maximum != nil && v > *s.maximum {
+			return errorAt(path, "%v is more than the maximum of %v", v, *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && v <= *s.exclusiveMinimum {
+			return errorAt(path, "%v must be more than %v", v, *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && v >= *s.exclusiveMaximum {
+			return errorAt(path, "%v must be less than %v", v, *s.exclusiveMaximum)
+		}
+	}
+	return s.validateCombinations(v, path)
+}
+
+func (s *Schema) validateObject(v map[string]interface{}, path string) error {
+	for _, name := range s.required {
+		if _, ok := v[name]; !ok {
+			return errorAt(path, "missing required property '%s'", name)
+		}
+	}
+	// properties are checked in order, so that errors are deterministic
+	names := make([]string, 0, len(v))
+	for name := range v {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		propPath := path + "/" + name
+		if prop, ok := s.properties[name]; ok {
+			if err := prop.validate(v[name], propPath); err != nil {
+				return err
+			}
+		} else if s.additionalProperties != nil {
+			if s.additionalProperties.always != nil && !*s.additionalProperties.always {
+				return errorAt(path, "unknown property '%s'", name)
+			}
+			if err := s.additionalProperties.validate(v[name], propPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateCombinations(v interface{}, path string) error {
+	for _, sub := range s.allOf {
+		if err := sub.validate(v, path); err != nil {
+			return err
+		}
+	}
+	if len(s.anyOf) > 0 {
+		var errs []string
+		for _, sub := range s.anyOf {
+			err := sub.validate(v, path)
+			if err == nil {
+				errs = nil
+				break
+			}
+			errs = append(errs, err.Error())
+		}
+		if errs != nil {
+			return errorAt(path, "value matches none of the allowed schemas: %s", strings.Join(errs, "; "))
+		}
+	}
+	if len(s.oneOf) > 0 {
+		matches := 0
+		for _, sub := range s.oneOf {
+			if sub.validate(v, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return errorAt(path, "value matches %d of the schemas, expected exactly one", matches)
+		}
+	}
+	if s.not != nil && s.not.validate(v, path) == nil {
+		return errorAt(path, "value matches a disallowed schema")
+	}
+	return nil
+}
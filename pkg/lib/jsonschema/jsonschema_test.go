@@ -0,0 +1,91 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package jsonschema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const stepSchema = `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"type": "object",
+	"properties": {
+		"host": {"type": "array", "items": {"type": "string", "minLength": 1}, "minItems": 1, "maxItems": 1},
+		"port": {"type": "array", "items": {"type": ["integer", "string"], "minimum": 1, "maximum": 65535}},
+		"mode": {"type": "array", "items": {"enum": ["fast", "slow"]}},
+		"id": {"type": "array", "items": {"type": "string", "pattern": "^[a-z]+$"}},
+		"ratio": {"type": "array", "items": {"type": "number", "exclusiveMinimum": 0, "exclusiveMaximum": 1}},
+		"option": {"type": "array", "items": {"anyOf": [{"type": "boolean"}, {"const": "auto"}]}}
+	},
+	"required": ["host"],
+	"additionalProperties": false
+}`
+
+func TestValidate(t *testing.T) {
+	s, err := Compile([]byte(stepSchema))
+	require.NoError(t, err)
+
+	for _, doc := range []string{
+		`{"host": ["localhost"]}`,
+		`{"host": ["localhost"], "port": [22, "{{ .Port }}"], "mode": ["slow"], "id": ["abc"], "ratio": [0.5], "option": [true, "auto"]}`,
+	} {
+		require.NoError(t, s.Validate([]byte(doc)), doc)
+	}
+
+	for doc, msg := range map[string]string{
+		`[]`:                               "/: expected object, got array",
+		`{}`:                               "/: missing required property 'host'",
+		`{"host": []}`:                     "/host: expected at least 1 items, got 0",
+		`{"host": [""]}`:                   "/host/0: expected at least 1 characters, got 0",
+		`{"host": ["a", "b"]}`:             "/host: expected at most 1 items, got 2",
+		`{"host": ["a"], "port": [1.5]}`:   "/port/0: expected integer or string, got number",
+		`{"host": ["a"], "port": [0]}`:     "/port/0: 0 is less than the minimum of 1",
+		`{"host": ["a"], "mode": ["x"]}`:   "/mode/0: value is not one of the allowed values",
+		`{"host": ["a"], "id": ["A"]}`:     "/id/0: 'A' does not match pattern '^[a-z]+$'",
+		`{"host": ["a"], "ratio": [1]}`:    "/ratio/0: 1 must be less than 1",
+		`{"host": ["a"], "option": ["x"]}`: "/option/0: value matches none of the allowed schemas: /option/0: expected boolean, got string; /option/0: value is not the allowed value",
+		`{"host": ["a"], "other": []}`:     "/: unknown property 'other'",
+	} {
+		err := s.Validate([]byte(doc))
+		require.Error(t, err, doc)
+		require.Equal(t, msg, err.Error(), doc)
+	}
+}
+
+func TestCombinations(t *testing.T) {
+	s, err := Compile([]byte(`{"oneOf": [{"type": "integer"}, {"type": "number", "minimum": 10}], "not": {"const": 42}}`))
+	require.NoError(t, err)
+	require.NoError(t, s.Validate([]byte(`1`)))
+	require.NoError(t, s.Validate([]byte(`10.5`)))
+	require.EqualError(t, s.Validate([]byte(`12`)), "/: value matches 2 of the schemas, expected exactly one")
+	require.EqualError(t, s.Validate([]byte(`42`)), "/: value matches 2 of the schemas, expected exactly one")
+
+	s, err = Compile([]byte(`{"allOf": [{"minLength": 2}, {"maxLength": 3}], "not": {"const": "no"}}`))
+	require.NoError(t, err)
+	require.NoError(t, s.Validate([]byte(`"yes"`)))
+	require.EqualError(t, s.Validate([]byte(`"no"`)), "/: value matches a disallowed schema")
+	require.EqualError(t, s.Validate([]byte(`"four"`)), "/: expected at most 3 characters, got 4")
+
+	s, err = Compile([]byte(`false`))
+	require.NoError(t, err)
+	require.Error(t, s.Validate([]byte(`null`)))
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, schema := range []string{
+		`{"type": "text"}`,
+		`{"type": 1}`,
+		`{"pattern": "("}`,
+		`{"properties": {"a": {"$ref": "#/definitions/a"}}}`,
+		`{"items": []}`,
+		`not json`,
+	} {
+		_, err := Compile([]byte(schema))
+		require.Error(t, err, schema)
+	}
+}
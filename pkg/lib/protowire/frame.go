@@ -0,0 +1,80 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package protowire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// MaxMessageSize is the maximum size of the messages read by ReadMessage, as
+// the default of gRPC servers.
+const MaxMessageSize = 4 << 20
+
+// ErrCompressed is returned by ReadMessage for compressed messages, which
+// are not supported.
+var ErrCompressed = errors.New("compressed messages are not supported")
+
+// ReadMessage reads a length-prefixed gRPC message from r. It returns io.EOF
+// if r ends before the message starts.
+func ReadMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, ErrCompressed
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > MaxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds the maximum size of %d bytes", size, MaxMessageSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// WriteMessage writes a length-prefixed gRPC message to w.
+func WriteMessage(w io.Writer, data []byte) error {
+	buf := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(buf[1:], uint32(len(data)))
+	_, err := w.Write(append(buf, data...))
+	return err
+}
+
+// EncodeStatusMessage percent-encodes a status message as required for the
+// grpc-message trailer.
+func EncodeStatusMessage(msg string) string {
+	var sb strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		} else {
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// DecodeStatusMessage decodes a status message of the grpc-message trailer.
+// Invalid messages are returned as they are.
+func DecodeStatusMessage(msg string) string {
+	decoded, err := url.PathUnescape(msg)
+	if err != nil {
+		return msg
+	}
+	return decoded
+}
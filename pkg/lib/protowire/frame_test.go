@@ -0,0 +1,40 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package protowire
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageFraming(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteMessage(&buf, []byte("first")))
+	require.NoError(t, WriteMessage(&buf, nil))
+
+	data, err := ReadMessage(&buf)
+	require.NoError(t, err)
+	require.Equal(t, "first", string(data))
+	data, err = ReadMessage(&buf)
+	require.NoError(t, err)
+	require.Empty(t, data)
+	_, err = ReadMessage(&buf)
+	require.Equal(t, io.EOF, err)
+
+	_, err = ReadMessage(bytes.NewReader([]byte{1, 0, 0, 0, 0}))
+	require.Equal(t, ErrCompressed, err)
+	_, err = ReadMessage(bytes.NewReader([]byte{0, 0, 0, 0, 5, 'a'}))
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestStatusMessage(t *testing.T) {
+	msg := "job 1: 100% déjà vu\n"
+	require.Equal(t, "job 1: 100%25 d%C3%A9j%C3%A0 vu%0A", EncodeStatusMessage(msg))
+	require.Equal(t, msg, DecodeStatusMessage(EncodeStatusMessage(msg)))
+}
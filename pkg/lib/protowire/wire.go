@@ -0,0 +1,139 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package protowire implements the subset of the protobuf wire format and of
+// the gRPC framing used by the gRPC services of ConTest, i.e. varints,
+// length-delimited fields and length-prefixed messages, so that they do not
+// depend on the protobuf and gRPC runtimes.
+package protowire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Wire types of the protobuf fields.
+const (
+	WireVarint  = 0
+	WireFixed64 = 1
+	WireBytes   = 2
+	WireFixed32 = 5
+)
+
+// Encoder appends fields to a protobuf message. As in proto3, fields set to
+// their zero value are not encoded, except for embedded messages.
+type Encoder struct {
+	Buf []byte
+}
+
+// varint appends a varint.
+func (e *Encoder) varint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	e.Buf = append(e.Buf, buf[:n]...)
+}
+
+// Key appends the key of a field.
+func (e *Encoder) Key(field, wireType int) {
+	e.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// Uint64 appends a varint field.
+func (e *Encoder) Uint64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.Key(field, WireVarint)
+	e.varint(v)
+}
+
+// Int64 appends an int64 field.
+func (e *Encoder) Int64(field int, v int64) {
+	// int64 fields are encoded as two's complement varints, not zigzag
+	e.Uint64(field, uint64(v))
+}
+
+// Bool appends a bool field.
+func (e *Encoder) Bool(field int, v bool) {
+	if v {
+		e.Uint64(field, 1)
+	}
+}
+
+// String appends a string field.
+func (e *Encoder) String(field int, v string) {
+	if v == "" {
+		return
+	}
+	e.Message(field, []byte(v))
+}
+
+// Message appends an embedded message, encoded by the caller. It is encoded
+// even if empty, as its presence is meaningful, e.g. in a oneof.
+func (e *Encoder) Message(field int, data []byte) {
+	e.Key(field, WireBytes)
+	e.varint(uint64(len(data)))
+	e.Buf = append(e.Buf, data...)
+}
+
+// Field is a field decoded from a protobuf message. Varint fields are in
+// Value, length-delimited fields in Data, and fixed-size fields are skipped.
+type Field struct {
+	Number   int
+	WireType int
+	Value    uint64
+	Data     []byte
+}
+
+// String returns the value of a string field.
+func (f Field) String() string {
+	return string(f.Data)
+}
+
+// Decode calls fn for each field of a protobuf message, in wire order.
+func Decode(msg []byte, fn func(f Field) error) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errors.New("invalid field key")
+		}
+		msg = msg[n:]
+		f := Field{Number: int(key >> 3), WireType: int(key & 7)}
+		if f.Number == 0 {
+			return errors.New("invalid field number 0")
+		}
+		switch f.WireType {
+		case WireVarint:
+			if f.Value, n = binary.Uvarint(msg); n <= 0 {
+				return fmt.Errorf("invalid varint in field %d", f.Number)
+			}
+			msg = msg[n:]
+		case WireBytes:
+			length, n := binary.Uvarint(msg)
+			if n <= 0 || length > uint64(len(msg)-n) {
+				return fmt.Errorf("invalid length in field %d", f.Number)
+			}
+			f.Data = msg[n : n+int(length)]
+			msg = msg[n+int(length):]
+		case WireFixed64, WireFixed32:
+			size := 8
+			if f.WireType == WireFixed32 {
+				size = 4
+			}
+			if len(msg) < size {
+				return fmt.Errorf("truncated field %d", f.Number)
+			}
+			msg = msg[size:]
+			continue
+		default:
+			return fmt.Errorf("unsupported wire type %d in field %d", f.WireType, f.Number)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package protowire
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeSkipsUnknownFields(t *testing.T) {
+	var e Encoder
+	e.String(1, "requestor")
+	e.Key(15, WireFixed64)
+	e.Buf = append(e.Buf, make([]byte, 8)...)
+	e.Key(16, WireFixed32)
+	e.Buf = append(e.Buf, make([]byte, 4)...)
+	e.Message(17, nil)
+	e.Uint64(2, 7)
+	e.Int64(3, -1)
+
+	var fields []Field
+	require.NoError(t, Decode(e.Buf, func(f Field) error {
+		fields = append(fields, f)
+		return nil
+	}))
+	require.Len(t, fields, 4)
+	require.Equal(t, "requestor", fields[0].String())
+	require.Equal(t, 17, fields[1].Number)
+	require.Empty(t, fields[1].Data)
+	require.Equal(t, Field{Number: 2, WireType: WireVarint, Value: 7}, fields[2])
+	require.Equal(t, int64(-1), int64(fields[3].Value))
+
+	require.Error(t, Decode([]byte{0x0a, 0x05, 'a'}, func(Field) error { return nil }))
+}
+
+func TestZeroValuesAreNotEncoded(t *testing.T) {
+	var e Encoder
+	e.String(1, "")
+	e.Uint64(2, 0)
+	e.Bool(3, false)
+	require.Empty(t, e.Buf)
+}
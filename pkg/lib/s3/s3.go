@@ -0,0 +1,223 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package s3 implements a minimal client for S3-compatible object stores,
+// covering the few operations needed by ConTest plugins. Requests are signed
+// with AWS Signature Version 4 and use path-style addressing, which is
+// supported by AWS as well as by most S3-compatible stores (e.g. MinIO, GCS
+// interoperability mode).
+package s3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	amzDateFormat  = "20060102T150405Z"
+	shortDate      = "20060102"
+	signAlgorithm  = "AWS4-HMAC-SHA256"
+	service        = "s3"
+	defaultRegion  = "us-east-1"
+	emptySHA256Hex = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// Credentials holds the AWS credentials used to sign requests.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// CredentialsFromEnv returns the credentials set in the standard AWS
+// environment variables.
+func CredentialsFromEnv() Credentials {
+	return Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// Client is a client for an S3-compatible object store.
+type Client struct {
+	// Endpoint is the base URL of the object store, e.g.
+	// https://s3.eu-west-1.amazonaws.com .
+	Endpoint    string
+	Region      string
+	Credentials Credentials
+	HTTPClient  *http.Client
+}
+
+// New returns a Client for the given region. If endpoint is empty, the AWS
+// endpoint for the region is used. If region is empty, us-east-1 is used.
+func New(endpoint, region string, creds Credentials) *Client {
+	if region == "" {
+		region = defaultRegion
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	return &Client{
+		Endpoint:    strings.TrimRight(endpoint, "/"),
+		Region:      region,
+		Credentials: creds,
+		HTTPClient:  &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// ParseURI splits an s3://bucket/key URI into bucket and key.
+func ParseURI(uri string) (string, string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", "", err
+	}
+	if u.Scheme != "s3" {
+		return "", "", fmt.Errorf("invalid scheme '%s', expected 's3'", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", "", fmt.Errorf("missing bucket in URI '%s'", uri)
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+func (c *Client) objectURL(bucket, key string) *url.URL {
+	u, _ := url.Parse(c.Endpoint)
+	u.Path = "/" + bucket + "/" + key
+	return u
+}
+
+func (c *Client) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	c.sign(req, payloadHash, time.Now().UTC())
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%s %s returned status %d: %s", req.Method, req.URL.Path, resp.StatusCode, msg)
+	}
+	return resp, nil
+}
+
+// GetObject returns the content of an object. If versionID is not empty, that
+// specific version of the object is returned. The caller must close the
+// returned reader.
+func (c *Client) GetObject(bucket, key, versionID string) (io.ReadCloser, error) {
+	u := c.objectURL(bucket, key)
+	if versionID != "" {
+		u.RawQuery = url.Values{"versionId": []string{versionID}}.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req, emptySHA256Hex)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// PutObject stores an object and returns the version ID assigned by the
+// store, if versioning is enabled on the bucket.
+func (c *Client) PutObject(bucket, key string, body []byte) (string, error) {
+	req, err := http.NewRequest(http.MethodPut, c.objectURL(bucket, key).String(), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	resp, err := c.do(req, hex.EncodeToString(sum[:]))
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("x-amz-version-id"), nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode encodes a path as required by the canonical request, i.e. every
+// byte except unreserved characters and slashes is percent-encoded.
+func uriEncode(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// sign adds the AWS Signature Version 4 Authorization header to the request.
+func (c *Client) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format(amzDateFormat)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if c.Credentials.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", c.Credentials.SessionToken)
+	}
+
+	// canonical headers: host plus every header that is part of the
+	// request, lower-cased and sorted.
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	// url.Values.Encode sorts by key, as required.
+	canonicalQuery := strings.Replace(req.URL.Query().Encode(), "+", "%20", -1)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path),
+		canonicalQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{now.Format(shortDate), c.Region, service, "aws4_request"}, "/")
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{signAlgorithm, amzDate, scope, hex.EncodeToString(crHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.Credentials.SecretAccessKey), now.Format(shortDate))
+	key = hmacSHA256(key, c.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signAlgorithm, c.Credentials.AccessKeyID, scope, signedHeaders, signature))
+}
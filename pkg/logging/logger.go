@@ -3,54 +3,195 @@
 // This source code is licensed under the MIT license found in the
 // LICENSE file in the root directory of this source tree.
 
+// Package logging provides the loggers of the modules of ConTest. Each module,
+// identified by the prefix passed to GetLogger, has its own logger, whose
+// level can be changed at runtime with SetModuleLevel, and which otherwise
+// logs at the default level. Logs are written as text or as JSON, see
+// SetFormat, and carry the context of the jobs in the fields below.
 package logging
 
 import (
+	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
 
 	log_prefixed "github.com/chappjc/logrus-prefix"
 	"github.com/sirupsen/logrus"
 )
 
+// Fields carrying the context of the logs of the jobs.
+const (
+	FieldJobID     = "job_id"
+	FieldRunID     = "run_id"
+	FieldTestName  = "test"
+	FieldStepLabel = "step"
+	FieldTargetID  = "target"
+	FieldRequestID = "request_id"
+)
+
+// The log formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// moduleLogger is the logger of a module, which logs at the default level
+// unless override is set.
+type moduleLogger struct {
+	logger   *logrus.Logger
+	override bool
+}
+
 var (
-	log *logrus.Logger
+	mu           sync.Mutex
+	out          io.Writer = os.Stderr
+	formatter    logrus.Formatter
+	defaultLevel = logrus.InfoLevel
+	modules      = make(map[string]*moduleLogger)
 )
 
+func newFormatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case FormatText:
+		return &log_prefixed.TextFormatter{FullTimestamp: true}, nil
+	case FormatJSON:
+		return &logrus.JSONFormatter{}, nil
+	}
+	return nil, fmt.Errorf("unknown log format '%s', must be %s or %s", format, FormatText, FormatJSON)
+}
+
 // GetLogger returns a configured logger instance
 func GetLogger(prefix string) *logrus.Entry {
-	return log.WithField("prefix", prefix)
+	mu.Lock()
+	defer mu.Unlock()
+	m, ok := modules[prefix]
+	if !ok {
+		m = &moduleLogger{logger: logrus.New()}
+		m.logger.SetOutput(out)
+		m.logger.SetFormatter(formatter)
+		m.logger.SetLevel(defaultLevel)
+		modules[prefix] = m
+	}
+	return m.logger.WithField("prefix", prefix)
 }
 
 // AddField add a field to an existing logrus.Entry
 func AddField(e *logrus.Entry, name string, value interface{}) *logrus.Entry {
-	l := log.WithField(name, value)
-	for k, v := range e.Data {
-		l = l.WithField(k, v)
-	}
-	return l
+	return e.WithField(name, value)
 }
 
 // AddFields adds multiple fields to an existing logrus.Entry
 func AddFields(e *logrus.Entry, fields map[string]interface{}) *logrus.Entry {
-	l := e
-	for k, v := range fields {
-		l = AddField(l, k, v)
+	return e.WithFields(fields)
+}
+
+// SetOutput sets where the logs are written, by default the standard error.
+func SetOutput(w io.Writer) {
+	mu.Lock()
+	defer mu.Unlock()
+	out = w
+	for _, m := range modules {
+		m.logger.SetOutput(out)
 	}
-	return l
 }
 
 // Disable sends all logging output to the bit bucket.
 func Disable() {
-	log.SetOutput(ioutil.Discard)
+	SetOutput(ioutil.Discard)
 }
 
+// Debug sets the default level to debug.
 func Debug() {
-	log.SetLevel(logrus.DebugLevel)
+	_ = SetLevel(logrus.DebugLevel.String())
 }
 
-func init() {
-	log = logrus.New()
-	log.SetFormatter(&log_prefixed.TextFormatter{
-		FullTimestamp: true,
+// SetFormat sets the format of the logs, FormatText or FormatJSON.
+func SetFormat(format string) error {
+	f, err := newFormatter(format)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	formatter = f
+	for _, m := range modules {
+		m.logger.SetFormatter(formatter)
+	}
+	return nil
+}
+
+// SetLevel sets the default level, e.g. info or debug, of the modules
+// without their own level.
+func SetLevel(level string) error {
+	l, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	defaultLevel = l
+	for _, m := range modules {
+		if !m.override {
+			m.logger.SetLevel(l)
+		}
+	}
+	return nil
+}
+
+// SetModuleLevel sets the level of a module, or makes it log at the default
+// level again if level is empty.
+func SetModuleLevel(module, level string) error {
+	var l logrus.Level
+	if level != "" {
+		var err error
+		if l, err = logrus.ParseLevel(level); err != nil {
+			return err
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	m, ok := modules[module]
+	if !ok {
+		return fmt.Errorf("unknown module '%s'", module)
+	}
+	if level == "" {
+		l = defaultLevel
+	}
+	m.override = level != ""
+	m.logger.SetLevel(l)
+	return nil
+}
+
+// ModuleLevel is the level of a module, which is the default level unless
+// Override is set.
+type ModuleLevel struct {
+	Module   string
+	Level    string
+	Override bool
+}
+
+// Levels returns the default level, and the levels of the modules sorted by
+// module.
+func Levels() (string, []ModuleLevel) {
+	mu.Lock()
+	defer mu.Unlock()
+	levels := make([]ModuleLevel, 0, len(modules))
+	for module, m := range modules {
+		levels = append(levels, ModuleLevel{
+			Module:   module,
+			Level:    m.logger.GetLevel().String(),
+			Override: m.override,
+		})
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].Module < levels[j].Module
 	})
+	return defaultLevel.String(), levels
+}
+
+func init() {
+	formatter, _ = newFormatter(FormatText)
 }
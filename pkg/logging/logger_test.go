@@ -0,0 +1,54 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevels(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer SetOutput(os.Stderr)
+	require.NoError(t, SetFormat(FormatJSON))
+	defer func() { _ = SetFormat(FormatText) }()
+	require.Error(t, SetFormat("xml"))
+
+	runner := GetLogger("test/runner")
+	storage := GetLogger("test/storage")
+	require.Error(t, SetModuleLevel("test/unknown", "debug"))
+	require.Error(t, SetModuleLevel("test/runner", "verbose"))
+	require.NoError(t, SetModuleLevel("test/runner", "debug"))
+	defer func() { _ = SetModuleLevel("test/runner", "") }()
+
+	AddFields(runner, map[string]interface{}{FieldJobID: 1, FieldStepLabel: "cmd"}).Debugf("running")
+	storage.Debugf("not logged")
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, "running", entry["msg"])
+	require.Equal(t, "test/runner", entry["prefix"])
+	require.Equal(t, float64(1), entry[FieldJobID])
+	require.Equal(t, "cmd", entry[FieldStepLabel])
+
+	defaultLevel, levels := Levels()
+	require.Equal(t, "info", defaultLevel)
+	require.Contains(t, levels, ModuleLevel{Module: "test/runner", Level: "debug", Override: true})
+	require.Contains(t, levels, ModuleLevel{Module: "test/storage", Level: "info"})
+
+	require.NoError(t, SetLevel("warning"))
+	defer func() { _ = SetLevel("info") }()
+	_, levels = Levels()
+	require.Contains(t, levels, ModuleLevel{Module: "test/runner", Level: "debug", Override: true})
+	require.Contains(t, levels, ModuleLevel{Module: "test/storage", Level: "warning"})
+	require.NoError(t, SetModuleLevel("test/runner", ""))
+	_, levels = Levels()
+	require.Contains(t, levels, ModuleLevel{Module: "test/runner", Level: "warning"})
+}
@@ -0,0 +1,95 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package metrics implements the metric types published by ConTest via
+// expvar, in addition to the counters of expvar.Map, and exports them to
+// Prometheus.
+package metrics
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultLatencyBuckets are the upper bounds, in seconds, of the buckets of
+// histograms measuring the latency of operations such as database queries.
+var DefaultLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets are the upper bounds of the buckets of histograms
+// measuring the size of batches.
+var DefaultSizeBuckets = []float64{1, 10, 100, 1000, 10000}
+
+// Histogram counts observations in buckets, which are cumulative as in
+// Prometheus histograms. It implements expvar.Var, and it is published as a
+// JSON object with the count and sum of the observations and the count of
+// each bucket, keyed by upper bound.
+type Histogram struct {
+	lock   sync.Mutex
+	bounds []float64
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram returns a histogram with the given bucket upper bounds. A
+// bucket for the observations greater than all the bounds is implied.
+func NewHistogram(bounds []float64) *Histogram {
+	b := append([]float64(nil), bounds...)
+	sort.Float64s(b)
+	return &Histogram{bounds: b, counts: make([]uint64, len(b))}
+}
+
+// Observe adds an observation to the histogram.
+func (h *Histogram) Observe(v float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.count++
+	h.sum += v
+	for i := len(h.bounds) - 1; i >= 0 && v <= h.bounds[i]; i-- {
+		h.counts[i]++
+	}
+}
+
+// Snapshot is the state of a histogram at a given time.
+type Snapshot struct {
+	Count uint64
+	Sum   float64
+	// Buckets are the cumulative counts, in the same order as Bounds
+	Bounds  []float64
+	Buckets []uint64
+}
+
+// Snapshot returns the current state of the histogram.
+func (h *Histogram) Snapshot() Snapshot {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return Snapshot{
+		Count:   h.count,
+		Sum:     h.sum,
+		Bounds:  append([]float64(nil), h.bounds...),
+		Buckets: append([]uint64(nil), h.counts...),
+	}
+}
+
+// String implements expvar.Var.
+func (h *Histogram) String() string {
+	s := h.Snapshot()
+	buckets := make(map[string]uint64, len(s.Bounds)+1)
+	for i, bound := range s.Bounds {
+		buckets[strconv.FormatFloat(bound, 'g', -1, 64)] = s.Buckets[i]
+	}
+	buckets["+Inf"] = s.Count
+	data, err := json.Marshal(struct {
+		Count   uint64            `json:"count"`
+		Sum     float64           `json:"sum"`
+		Buckets map[string]uint64 `json:"buckets"`
+	}{s.Count, s.Sum, buckets})
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
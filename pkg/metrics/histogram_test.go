@@ -0,0 +1,38 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Histogram must be publishable via expvar
+var _ expvar.Var = &Histogram{}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]float64{10, 1})
+	for _, v := range []float64{0.5, 1, 5, 50} {
+		h.Observe(v)
+	}
+	s := h.Snapshot()
+	require.Equal(t, uint64(4), s.Count)
+	require.Equal(t, 56.5, s.Sum)
+	require.Equal(t, []float64{1, 10}, s.Bounds)
+	require.Equal(t, []uint64{2, 3}, s.Buckets)
+
+	var published struct {
+		Count   uint64
+		Sum     float64
+		Buckets map[string]uint64
+	}
+	require.NoError(t, json.Unmarshal([]byte(h.String()), &published))
+	require.Equal(t, uint64(4), published.Count)
+	require.Equal(t, map[string]uint64{"1": 2, "10": 3, "+Inf": 4}, published.Buckets)
+}
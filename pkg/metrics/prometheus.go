@@ -0,0 +1,128 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package metrics
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Prefix is the prefix of the names of the expvar variables holding the
+// metrics of ConTest, which are exported to Prometheus.
+const Prefix = "contest_"
+
+// PrometheusContentType is the content type of the Prometheus text format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WritePrometheus writes the metrics published via expvar under Prefix in
+// the Prometheus text format. The variables of an expvar.Map are exported
+// with the name of the map as prefix, e.g. the "queries" counter of the
+// "contest_rdbms" map as contest_rdbms_queries_total. Integer and float
+// variables are exported as counters, CounterVec as counters with a label,
+// and Histogram and HistogramVec as histograms. Other variables are skipped.
+func WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	expvar.Do(func(kv expvar.KeyValue) {
+		if !strings.HasPrefix(kv.Key, Prefix) {
+			return
+		}
+		if m, ok := kv.Value.(*expvar.Map); ok {
+			m.Do(func(mkv expvar.KeyValue) {
+				writeVar(bw, kv.Key+"_"+mkv.Key, mkv.Value)
+			})
+			return
+		}
+		writeVar(bw, kv.Key, kv.Value)
+	})
+	return bw.Flush()
+}
+
+// Handler returns the HTTP handler exporting the metrics to Prometheus, see
+// WritePrometheus.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", PrometheusContentType)
+		_ = WritePrometheus(w)
+	})
+}
+
+func writeVar(w io.Writer, name string, v expvar.Var) {
+	name = metricName(name)
+	switch val := v.(type) {
+	case *expvar.Int:
+		fmt.Fprintf(w, "# TYPE %s_total counter\n%s_total %d\n", name, name, val.Value())
+	case *expvar.Float:
+		fmt.Fprintf(w, "# TYPE %s_total counter\n%s_total %s\n", name, name, formatFloat(val.Value()))
+	case *CounterVec:
+		counts := val.Counts()
+		fmt.Fprintf(w, "# TYPE %s_total counter\n", name)
+		values := make([]string, 0, len(counts))
+		for value := range counts {
+			values = append(values, value)
+		}
+		sort.Strings(values)
+		for _, value := range values {
+			fmt.Fprintf(w, "%s_total{%s} %d\n", name, labelPair(val.Label(), value), counts[value])
+		}
+	case *Histogram:
+		fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+		writeHistogram(w, name, "", val.Snapshot())
+	case *HistogramVec:
+		snapshots := val.Snapshots()
+		fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+		values := make([]string, 0, len(snapshots))
+		for value := range snapshots {
+			values = append(values, value)
+		}
+		sort.Strings(values)
+		for _, value := range values {
+			writeHistogram(w, name, labelPair(val.Label(), value), snapshots[value])
+		}
+	}
+}
+
+func writeHistogram(w io.Writer, name, labels string, s Snapshot) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	for i, bound := range s.Bounds {
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%s\"} %d\n", name, labels, sep, formatFloat(bound), s.Buckets[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, s.Count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, labels, formatFloat(s.Sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, s.Count)
+}
+
+// metricName replaces the characters which are not allowed in the names of
+// Prometheus metrics.
+func metricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelPair(label, value string) string {
+	return metricName(label) + `="` + labelValueReplacer.Replace(value) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
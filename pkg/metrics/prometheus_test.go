@@ -0,0 +1,77 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// the vectors must be publishable via expvar
+var (
+	_ expvar.Var = &CounterVec{}
+	_ expvar.Var = &HistogramVec{}
+)
+
+func TestVecs(t *testing.T) {
+	c := NewCounterVec("type")
+	c.Add("start", 1)
+	c.Add("start", 2)
+	c.Add("stop", 1)
+	require.Equal(t, map[string]int64{"start": 3, "stop": 1}, c.Counts())
+	var counts map[string]int64
+	require.NoError(t, json.Unmarshal([]byte(c.String()), &counts))
+	require.Equal(t, c.Counts(), counts)
+
+	h := NewHistogramVec("step", []float64{1})
+	h.Observe("cmd", 0.5)
+	h.Observe("cmd", 2)
+	h.Observe("echo", 0.1)
+	require.Equal(t, uint64(2), h.Snapshots()["cmd"].Count)
+	var published map[string]struct{ Count uint64 }
+	require.NoError(t, json.Unmarshal([]byte(h.String()), &published))
+	require.Equal(t, uint64(2), published["cmd"].Count)
+	require.Equal(t, uint64(1), published["echo"].Count)
+}
+
+func TestWritePrometheus(t *testing.T) {
+	m := expvar.NewMap("contest_test")
+	m.Add("runs", 3)
+	requests := NewCounterVec("type")
+	requests.Add(`st"art`, 2)
+	m.Set("requests", requests)
+	latency := NewHistogramVec("step", []float64{0.5, 1})
+	latency.Observe("cmd", 0.75)
+	m.Set("step_seconds", latency)
+	size := NewHistogram([]float64{10})
+	size.Observe(5)
+	expvar.Publish("contest_test_batch-size", size)
+	expvar.NewInt("other_runs").Add(1)
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, PrometheusContentType, rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	require.Contains(t, body, "# TYPE contest_test_runs_total counter\ncontest_test_runs_total 3\n")
+	require.Contains(t, body, "# TYPE contest_test_requests_total counter\ncontest_test_requests_total{type=\"st\\\"art\"} 2\n")
+	require.Contains(t, body, "# TYPE contest_test_step_seconds histogram\n"+
+		"contest_test_step_seconds_bucket{step=\"cmd\",le=\"0.5\"} 0\n"+
+		"contest_test_step_seconds_bucket{step=\"cmd\",le=\"1\"} 1\n"+
+		"contest_test_step_seconds_bucket{step=\"cmd\",le=\"+Inf\"} 1\n"+
+		"contest_test_step_seconds_sum{step=\"cmd\"} 0.75\n"+
+		"contest_test_step_seconds_count{step=\"cmd\"} 1\n")
+	require.Contains(t, body, "# TYPE contest_test_batch_size histogram\n"+
+		"contest_test_batch_size_bucket{le=\"10\"} 1\n"+
+		"contest_test_batch_size_bucket{le=\"+Inf\"} 1\n"+
+		"contest_test_batch_size_sum 5\n"+
+		"contest_test_batch_size_count 1\n")
+	require.False(t, bytes.Contains(rec.Body.Bytes(), []byte("other_runs")))
+}
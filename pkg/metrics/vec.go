@@ -0,0 +1,128 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package metrics
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CounterVec is a set of counters told apart by the value of a label, e.g.
+// the API calls by type. It implements expvar.Var, and it is published as a
+// JSON object with the count of each label value.
+type CounterVec struct {
+	lock   sync.Mutex
+	label  string
+	counts map[string]int64
+}
+
+// NewCounterVec returns a set of counters with the given label.
+func NewCounterVec(label string) *CounterVec {
+	return &CounterVec{label: label, counts: make(map[string]int64)}
+}
+
+// Label returns the name of the label of the counters.
+func (c *CounterVec) Label() string {
+	return c.label
+}
+
+// Add adds delta to the counter of a label value.
+func (c *CounterVec) Add(value string, delta int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.counts[value] += delta
+}
+
+// Counts returns the current counters, by label value.
+func (c *CounterVec) Counts() map[string]int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	counts := make(map[string]int64, len(c.counts))
+	for value, n := range c.counts {
+		counts[value] = n
+	}
+	return counts
+}
+
+// String implements expvar.Var.
+func (c *CounterVec) String() string {
+	data, err := json.Marshal(c.Counts())
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+// HistogramVec is a set of histograms sharing their buckets, told apart by
+// the value of a label, e.g. the duration of test steps by plugin. It
+// implements expvar.Var, and it is published as a JSON object with the
+// histogram of each label value.
+type HistogramVec struct {
+	lock       sync.Mutex
+	label      string
+	bounds     []float64
+	histograms map[string]*Histogram
+}
+
+// NewHistogramVec returns a set of histograms with the given label and bucket
+// upper bounds.
+func NewHistogramVec(label string, bounds []float64) *HistogramVec {
+	return &HistogramVec{label: label, bounds: bounds, histograms: make(map[string]*Histogram)}
+}
+
+// Label returns the name of the label of the histograms.
+func (h *HistogramVec) Label() string {
+	return h.label
+}
+
+// Observe adds an observation to the histogram of a label value.
+func (h *HistogramVec) Observe(value string, v float64) {
+	h.lock.Lock()
+	hist, ok := h.histograms[value]
+	if !ok {
+		hist = NewHistogram(h.bounds)
+		h.histograms[value] = hist
+	}
+	h.lock.Unlock()
+	hist.Observe(v)
+}
+
+// Snapshots returns the current state of the histograms, by label value.
+func (h *HistogramVec) Snapshots() map[string]Snapshot {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	snapshots := make(map[string]Snapshot, len(h.histograms))
+	for value, hist := range h.histograms {
+		snapshots[value] = hist.Snapshot()
+	}
+	return snapshots
+}
+
+// String implements expvar.Var.
+func (h *HistogramVec) String() string {
+	h.lock.Lock()
+	values := make([]string, 0, len(h.histograms))
+	for value := range h.histograms {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	var b strings.Builder
+	b.WriteString("{")
+	for idx, value := range values {
+		if idx > 0 {
+			b.WriteString(",")
+		}
+		key, _ := json.Marshal(value)
+		b.Write(key)
+		b.WriteString(":")
+		b.WriteString(h.histograms[value].String())
+	}
+	h.lock.Unlock()
+	b.WriteString("}")
+	return b.String()
+}
@@ -0,0 +1,290 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package pluginbridge
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/lib/protowire"
+	"github.com/facebookincubator/contest/pkg/pluginregistry"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+)
+
+// StartTimeout is how long Launch waits for a plugin to complete the
+// handshake.
+var StartTimeout = 30 * time.Second
+
+// CallTimeout is the timeout of the calls which are not bounded by the
+// server otherwise, i.e. Describe and Validate.
+var CallTimeout = time.Minute
+
+// KillTimeout is how long Kill waits for a plugin to exit once its standard
+// input is closed, before killing it.
+var KillTimeout = 5 * time.Second
+
+// Client is a plugin binary launched by the server.
+type Client struct {
+	name   string
+	cmd    *exec.Cmd
+	stdin  io.Closer
+	exited chan struct{}
+	url    string
+	http   *http.Client
+	// apiVersion is the version of the plugin API which the plugins of
+	// the binary were built against, as described by the binary
+	apiVersion int
+}
+
+// lineWriter calls fn for each line written to it.
+type lineWriter struct {
+	mu  sync.Mutex
+	buf []byte
+	fn  func(line string)
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			return len(p), nil
+		}
+		w.fn(strings.TrimRight(string(w.buf[:idx]), "\r"))
+		w.buf = w.buf[idx+1:]
+	}
+}
+
+// parseHandshake returns the address a plugin serves on, and the certificate
+// it serves with, from its handshake line.
+func parseHandshake(line string) (string, *x509.Certificate, error) {
+	parts := strings.Split(line, "|")
+	if len(parts) < 5 || len(parts) > 6 {
+		return "", nil, fmt.Errorf("invalid handshake %q", line)
+	}
+	if parts[0] != strconv.Itoa(CoreProtocolVersion) {
+		return "", nil, fmt.Errorf("unsupported handshake version %s, expected %d", parts[0], CoreProtocolVersion)
+	}
+	if parts[1] != strconv.Itoa(ProtocolVersion) {
+		return "", nil, fmt.Errorf("unsupported protocol version %s, expected %d", parts[1], ProtocolVersion)
+	}
+	if parts[2] != "tcp" || parts[4] != "grpc" {
+		return "", nil, fmt.Errorf("unsupported transport %s/%s, expected tcp/grpc", parts[2], parts[4])
+	}
+	if len(parts) == 5 || parts[5] == "" {
+		return "", nil, errors.New("the plugin serves no TLS certificate, which gRPC over HTTP/2 requires")
+	}
+	der, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid certificate encoding: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid certificate: %v", err)
+	}
+	return parts[3], cert, nil
+}
+
+// Launch starts a plugin binary, and waits for it to complete the handshake.
+// The plugin is killed if the handshake fails.
+func Launch(path string, args ...string) (*Client, error) {
+	c := Client{
+		name:   filepath.Base(path),
+		cmd:    exec.Command(path, args...),
+		exited: make(chan struct{}),
+	}
+	c.cmd.Env = append(os.Environ(), MagicCookieKey+"="+MagicCookieValue)
+	stdin, err := c.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	c.stdin = stdin
+	pluginLog := log.WithField("plugin", c.name)
+	handshake := make(chan string, 1)
+	c.cmd.Stdout = &lineWriter{fn: func(line string) {
+		select {
+		case handshake <- line:
+		default:
+			pluginLog.Info(line)
+		}
+	}}
+	c.cmd.Stderr = &lineWriter{fn: func(line string) { pluginLog.Info(line) }}
+	if err := c.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start plugin %s: %v", path, err)
+	}
+	var exitErr error
+	go func() {
+		exitErr = c.cmd.Wait()
+		close(c.exited)
+	}()
+
+	var (
+		addr string
+		cert *x509.Certificate
+	)
+	select {
+	case line := <-handshake:
+		addr, cert, err = parseHandshake(line)
+	case <-c.exited:
+		err = fmt.Errorf("exited before the handshake: %v", exitErr)
+	case <-time.After(StartTimeout):
+		err = fmt.Errorf("no handshake after %v", StartTimeout)
+	}
+	if err != nil {
+		c.Kill()
+		return nil, fmt.Errorf("could not start plugin %s: %v", path, err)
+	}
+	// only the certificate of the plugin is trusted
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	c.url = "https://" + addr + "/" + ServiceName + "/"
+	c.http = &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots},
+		ForceAttemptHTTP2: true,
+	}}
+	log.Infof("Started plugin %s, serving on %s", path, addr)
+	return &c, nil
+}
+
+// Kill stops the plugin: its standard input is closed, and it is killed if
+// it does not exit within KillTimeout.
+func (c *Client) Kill() {
+	_ = c.stdin.Close()
+	select {
+	case <-c.exited:
+	case <-time.After(KillTimeout):
+		log.Warningf("Plugin %s did not exit within %v, killing it", c.name, KillTimeout)
+		_ = c.cmd.Process.Kill()
+		<-c.exited
+	}
+	if c.http != nil {
+		c.http.CloseIdleConnections()
+	}
+}
+
+// newRequest returns a request calling a method of the plugin.
+func (c *Client) newRequest(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+method, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	return req, nil
+}
+
+// call calls an RPC with a single response message.
+func (c *Client) call(ctx context.Context, method string, req, resp Message) error {
+	var body bytes.Buffer
+	if err := protowire.WriteMessage(&body, req.Marshal()); err != nil {
+		return err
+	}
+	httpReq, err := c.newRequest(ctx, method, &body)
+	if err != nil {
+		return err
+	}
+	httpResp, err := c.http.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("could not call plugin %s: %v", c.name, err)
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not call plugin %s: %s", c.name, httpResp.Status)
+	}
+	msgErr := readMessage(httpResp.Body, resp)
+	// the status is only available once the body is read
+	_, _ = io.Copy(ioutil.Discard, httpResp.Body)
+	if err := responseStatus(httpResp); err != nil {
+		return err
+	}
+	if msgErr != nil {
+		return fmt.Errorf("could not read the response of plugin %s: %v", c.name, msgErr)
+	}
+	return nil
+}
+
+// callWithTimeout calls an RPC within CallTimeout.
+func (c *Client) callWithTimeout(method string, req, resp Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), CallTimeout)
+	defer cancel()
+	return c.call(ctx, method, req, resp)
+}
+
+// callWithCancel calls an RPC which is abandoned once cancel is closed.
+func (c *Client) callWithCancel(cancel <-chan struct{}, method string, req, resp Message) error {
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go func() {
+		select {
+		case <-cancel:
+			stop()
+		case <-ctx.Done():
+		}
+	}()
+	err := c.call(ctx, method, req, resp)
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("call %s of plugin %s canceled", method, c.name)
+	}
+	return err
+}
+
+// Register registers the plugins implemented by the plugin binary, which
+// are then used as the built-in ones.
+func (c *Client) Register(registry *pluginregistry.PluginRegistry) error {
+	var desc DescribeResponse
+	if err := c.callWithTimeout("Describe", &DescribeRequest{}, &desc); err != nil {
+		return err
+	}
+	c.apiVersion = int(desc.APIVersion)
+	for _, info := range desc.TestSteps {
+		name := info.Name
+		var events []event.Name
+		for _, ev := range info.Events {
+			events = append(events, event.Name(ev))
+		}
+		factory := func() test.TestStep { return &remoteTestStep{client: c, name: name} }
+		if err := registry.RegisterTestStep(name, factory, events); err != nil {
+			return err
+		}
+	}
+	for _, name := range desc.TargetManagers {
+		name := name
+		factory := func() target.TargetManager { return &remoteTargetManager{client: c, name: name} }
+		if err := registry.RegisterTargetManager(name, factory); err != nil {
+			return err
+		}
+	}
+	for _, name := range desc.Reporters {
+		name := name
+		factory := func() job.Reporter { return &remoteReporter{client: c, name: name} }
+		if err := registry.RegisterReporter(name, factory); err != nil {
+			return err
+		}
+	}
+	log.Infof("Registered %d test steps, %d target managers and %d reporters of plugin %s",
+		len(desc.TestSteps), len(desc.TargetManagers), len(desc.Reporters), c.name)
+	return nil
+}
@@ -0,0 +1,556 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package pluginbridge
+
+import (
+	"github.com/facebookincubator/contest/pkg/lib/protowire"
+	"github.com/facebookincubator/contest/pkg/target"
+)
+
+// The types in this file are the messages of plugin.proto, see there for
+// their documentation. Field numbers must be kept in sync with it.
+
+// Message is implemented by the messages of the plugin protocol.
+type Message interface {
+	Marshal() []byte
+	Unmarshal([]byte) error
+}
+
+// Target is a target passed to or returned by a plugin.
+type Target struct {
+	Name string
+	ID   string
+	FQDN string
+}
+
+func newTarget(t *target.Target) *Target {
+	return &Target{Name: t.Name, ID: t.ID, FQDN: t.FQDN}
+}
+
+func (m *Target) target() *target.Target {
+	return &target.Target{Name: m.Name, ID: m.ID, FQDN: m.FQDN}
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *Target) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.Name)
+	e.String(2, m.ID)
+	e.String(3, m.FQDN)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *Target) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.Name = f.String()
+		case 2:
+			m.ID = f.String()
+		case 3:
+			m.FQDN = f.String()
+		}
+		return nil
+	})
+}
+
+// encodeTarget appends a target field, if set.
+func encodeTarget(e *protowire.Encoder, field int, t *Target) {
+	if t != nil {
+		e.Message(field, t.Marshal())
+	}
+}
+
+// decodeTarget decodes a target field.
+func decodeTarget(f protowire.Field) (*Target, error) {
+	var t Target
+	if err := t.Unmarshal(f.Data); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// DescribeRequest is the request of the Describe RPC.
+type DescribeRequest struct{}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *DescribeRequest) Marshal() []byte {
+	return nil
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *DescribeRequest) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error { return nil })
+}
+
+// TestStepInfo describes a test step implemented by a plugin.
+type TestStepInfo struct {
+	Name   string
+	Events []string
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *TestStepInfo) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.Name)
+	for _, ev := range m.Events {
+		e.Message(2, []byte(ev))
+	}
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *TestStepInfo) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.Name = f.String()
+		case 2:
+			m.Events = append(m.Events, f.String())
+		}
+		return nil
+	})
+}
+
+// DescribeResponse is the response of the Describe RPC.
+type DescribeResponse struct {
+	TestSteps      []TestStepInfo
+	TargetManagers []string
+	Reporters      []string
+	APIVersion     uint32
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *DescribeResponse) Marshal() []byte {
+	var e protowire.Encoder
+	for _, s := range m.TestSteps {
+		e.Message(1, s.Marshal())
+	}
+	for _, name := range m.TargetManagers {
+		e.Message(2, []byte(name))
+	}
+	for _, name := range m.Reporters {
+		e.Message(3, []byte(name))
+	}
+	e.Uint64(4, uint64(m.APIVersion))
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *DescribeResponse) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			var s TestStepInfo
+			if err := s.Unmarshal(f.Data); err != nil {
+				return err
+			}
+			m.TestSteps = append(m.TestSteps, s)
+		case 2:
+			m.TargetManagers = append(m.TargetManagers, f.String())
+		case 3:
+			m.Reporters = append(m.Reporters, f.String())
+		case 4:
+			m.APIVersion = uint32(f.Value)
+		}
+		return nil
+	})
+}
+
+// ValidateKind selects the parameters checked by the Validate RPC.
+type ValidateKind uint32
+
+// Kinds of parameters checked by the Validate RPC.
+const (
+	ValidateTestStep    ValidateKind = 0
+	ValidateAcquire     ValidateKind = 1
+	ValidateRelease     ValidateKind = 2
+	ValidateRunReport   ValidateKind = 3
+	ValidateFinalReport ValidateKind = 4
+)
+
+// ValidateRequest is the request of the Validate RPC.
+type ValidateRequest struct {
+	Kind           ValidateKind
+	Name           string
+	ParametersJSON string
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *ValidateRequest) Marshal() []byte {
+	var e protowire.Encoder
+	e.Uint64(1, uint64(m.Kind))
+	e.String(2, m.Name)
+	e.String(3, m.ParametersJSON)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *ValidateRequest) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.Kind = ValidateKind(f.Value)
+		case 2:
+			m.Name = f.String()
+		case 3:
+			m.ParametersJSON = f.String()
+		}
+		return nil
+	})
+}
+
+// ValidateResponse is the response of the Validate RPC.
+type ValidateResponse struct{}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *ValidateResponse) Marshal() []byte {
+	return nil
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *ValidateResponse) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error { return nil })
+}
+
+// Signal is sent to a running test step to cancel or pause it.
+type Signal uint32
+
+// Signals sent to running test steps.
+const (
+	SignalNone   Signal = 0
+	SignalCancel Signal = 1
+	SignalPause  Signal = 2
+)
+
+// StepStart starts a test step.
+type StepStart struct {
+	Name           string
+	ParametersJSON string
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *StepStart) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.Name)
+	e.String(2, m.ParametersJSON)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *StepStart) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.Name = f.String()
+		case 2:
+			m.ParametersJSON = f.String()
+		}
+		return nil
+	})
+}
+
+// StepInput is an input message of the RunTestStep RPC.
+type StepInput struct {
+	Start        *StepStart
+	Target       *Target
+	EndOfTargets bool
+	Signal       Signal
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *StepInput) Marshal() []byte {
+	var e protowire.Encoder
+	if m.Start != nil {
+		e.Message(1, m.Start.Marshal())
+	}
+	encodeTarget(&e, 2, m.Target)
+	e.Bool(3, m.EndOfTargets)
+	e.Uint64(4, uint64(m.Signal))
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *StepInput) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		var err error
+		switch f.Number {
+		case 1:
+			m.Start = &StepStart{}
+			err = m.Start.Unmarshal(f.Data)
+		case 2:
+			m.Target, err = decodeTarget(f)
+		case 3:
+			m.EndOfTargets = f.Value != 0
+		case 4:
+			m.Signal = Signal(f.Value)
+		}
+		return err
+	})
+}
+
+// TargetResult is the result of a test step for a target.
+type TargetResult struct {
+	Target  *Target
+	Error   string
+	Skipped bool
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *TargetResult) Marshal() []byte {
+	var e protowire.Encoder
+	encodeTarget(&e, 1, m.Target)
+	e.String(2, m.Error)
+	e.Bool(3, m.Skipped)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *TargetResult) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		var err error
+		switch f.Number {
+		case 1:
+			m.Target, err = decodeTarget(f)
+		case 2:
+			m.Error = f.String()
+		case 3:
+			m.Skipped = f.Value != 0
+		}
+		return err
+	})
+}
+
+// StepEvent is an event emitted by a test step.
+type StepEvent struct {
+	Name        string
+	Target      *Target
+	PayloadJSON string
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *StepEvent) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.Name)
+	encodeTarget(&e, 2, m.Target)
+	e.String(3, m.PayloadJSON)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *StepEvent) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		var err error
+		switch f.Number {
+		case 1:
+			m.Name = f.String()
+		case 2:
+			m.Target, err = decodeTarget(f)
+		case 3:
+			m.PayloadJSON = f.String()
+		}
+		return err
+	})
+}
+
+// StepOutput is an output message of the RunTestStep RPC.
+type StepOutput struct {
+	Result *TargetResult
+	Event  *StepEvent
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *StepOutput) Marshal() []byte {
+	var e protowire.Encoder
+	if m.Result != nil {
+		e.Message(1, m.Result.Marshal())
+	}
+	if m.Event != nil {
+		e.Message(2, m.Event.Marshal())
+	}
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *StepOutput) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.Result = &TargetResult{}
+			return m.Result.Unmarshal(f.Data)
+		case 2:
+			m.Event = &StepEvent{}
+			return m.Event.Unmarshal(f.Data)
+		}
+		return nil
+	})
+}
+
+// AcquireRequest is the request of the Acquire RPC.
+type AcquireRequest struct {
+	Name           string
+	JobID          uint64
+	ParametersJSON string
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *AcquireRequest) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.Name)
+	e.Uint64(2, m.JobID)
+	e.String(3, m.ParametersJSON)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *AcquireRequest) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.Name = f.String()
+		case 2:
+			m.JobID = f.Value
+		case 3:
+			m.ParametersJSON = f.String()
+		}
+		return nil
+	})
+}
+
+// AcquireResponse is the response of the Acquire RPC.
+type AcquireResponse struct {
+	Targets []*Target
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *AcquireResponse) Marshal() []byte {
+	var e protowire.Encoder
+	for _, t := range m.Targets {
+		e.Message(1, t.Marshal())
+	}
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *AcquireResponse) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		if f.Number == 1 {
+			t, err := decodeTarget(f)
+			if err != nil {
+				return err
+			}
+			m.Targets = append(m.Targets, t)
+		}
+		return nil
+	})
+}
+
+// ReleaseRequest is the request of the Release RPC.
+type ReleaseRequest struct {
+	Name           string
+	JobID          uint64
+	ParametersJSON string
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *ReleaseRequest) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.Name)
+	e.Uint64(2, m.JobID)
+	e.String(3, m.ParametersJSON)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *ReleaseRequest) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.Name = f.String()
+		case 2:
+			m.JobID = f.Value
+		case 3:
+			m.ParametersJSON = f.String()
+		}
+		return nil
+	})
+}
+
+// ReleaseResponse is the response of the Release RPC.
+type ReleaseResponse struct{}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *ReleaseResponse) Marshal() []byte {
+	return nil
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *ReleaseResponse) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error { return nil })
+}
+
+// ReportRequest is the request of the Report RPC.
+type ReportRequest struct {
+	Name            string
+	Final           bool
+	ParametersJSON  string
+	RunStatusesJSON string
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *ReportRequest) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.Name)
+	e.Bool(2, m.Final)
+	e.String(3, m.ParametersJSON)
+	e.String(4, m.RunStatusesJSON)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *ReportRequest) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.Name = f.String()
+		case 2:
+			m.Final = f.Value != 0
+		case 3:
+			m.ParametersJSON = f.String()
+		case 4:
+			m.RunStatusesJSON = f.String()
+		}
+		return nil
+	})
+}
+
+// ReportResponse is the response of the Report RPC.
+type ReportResponse struct {
+	Success  bool
+	DataJSON string
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *ReportResponse) Marshal() []byte {
+	var e protowire.Encoder
+	e.Bool(1, m.Success)
+	e.String(2, m.DataJSON)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *ReportResponse) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.Success = f.Value != 0
+		case 2:
+			m.DataJSON = f.String()
+		}
+		return nil
+	})
+}
@@ -0,0 +1,574 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package pluginbridge lets test steps, target managers and reporters be
+// implemented by external plugins, i.e. separate binaries which the server
+// launches at startup, so that they can be shipped without rebuilding the
+// server. A plugin binary calls Serve with the plugins it implements, and
+// serves them over the gRPC service defined in plugin.proto. The server
+// launches it with Launch, and registers the plugins it implements with
+// Client.Register, as if they were built in.
+//
+// The handshake follows the one of HashiCorp's go-plugin: the server sets
+// the MagicCookieKey environment variable of the plugin to MagicCookieValue,
+// and the plugin prints the address it serves on as its first line of
+// output, in the form
+//
+//	CORE-PROTOCOL-VERSION|APP-PROTOCOL-VERSION|tcp|ADDRESS|grpc|CERTIFICATE
+//
+// gRPC runs over HTTP/2, which the standard library only serves over TLS.
+// The plugin serves with a self-signed certificate generated at startup,
+// whose DER encoding is the last field of the handshake, in unpadded base64,
+// as with the automatic TLS of go-plugin. The server trusts only this
+// certificate to talk to the plugin.
+//
+// The plugins of a binary are built against the version of the plugin API of
+// the pluginregistry package they import, which the binary declares in its
+// Describe response, so that the server refuses to register plugins built
+// against versions it does not support.
+//
+// The plugin exits when its standard input is closed, i.e. when the server
+// stops, and what it logs on its standard error is logged by the server.
+package pluginbridge
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/cerrors"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/pluginregistry"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/facebookincubator/contest/pkg/xcontext"
+)
+
+var log = logging.GetLogger("pkg/pluginbridge")
+
+// MagicCookieKey and MagicCookieValue are the environment variable set by
+// the server when it launches a plugin, and its value. They are not a
+// security measure, but tell the plugins that they are not run directly.
+const (
+	MagicCookieKey   = "CONTEST_PLUGIN_MAGIC_COOKIE"
+	MagicCookieValue = "b4c5b4d2e7f1a0a8d91e3c0f2d6e8a17"
+)
+
+// CoreProtocolVersion is the version of the handshake, and ProtocolVersion
+// the version of the protocol defined in plugin.proto.
+const (
+	CoreProtocolVersion = 1
+	ProtocolVersion     = 1
+)
+
+// ErrNotLaunched is returned by Serve if the plugin was not launched by the
+// server.
+var ErrNotLaunched = errors.New("this binary is a ConTest plugin, it must be launched by the ConTest server")
+
+// Plugins are the plugins implemented by a plugin binary.
+type Plugins struct {
+	TestSteps      []test.TestStepLoader
+	TargetManagers []target.TargetManagerLoader
+	Reporters      []job.ReporterLoader
+}
+
+// pluginServer serves the plugins of a plugin binary. Plugin names are case
+// insensitive, as in the plugin registry.
+type pluginServer struct {
+	testSteps      map[string]test.TestStepFactory
+	testStepEvents map[string][]event.Name
+	targetManagers map[string]target.TargetManagerFactory
+	reporters      map[string]job.ReporterFactory
+	describe       DescribeResponse
+}
+
+func newPluginServer(plugins Plugins) (*pluginServer, error) {
+	s := pluginServer{
+		testSteps:      make(map[string]test.TestStepFactory),
+		testStepEvents: make(map[string][]event.Name),
+		targetManagers: make(map[string]target.TargetManagerFactory),
+		reporters:      make(map[string]job.ReporterFactory),
+		describe:       DescribeResponse{APIVersion: pluginregistry.APIVersion},
+	}
+	for _, load := range plugins.TestSteps {
+		name, factory, events := load()
+		key := strings.ToLower(name)
+		if _, found := s.testSteps[key]; found {
+			return nil, fmt.Errorf("test step %s is defined twice", name)
+		}
+		s.testSteps[key] = factory
+		info := TestStepInfo{Name: name}
+		for _, ev := range events {
+			info.Events = append(info.Events, string(ev))
+		}
+		s.describe.TestSteps = append(s.describe.TestSteps, info)
+	}
+	for _, load := range plugins.TargetManagers {
+		name, factory := load()
+		key := strings.ToLower(name)
+		if _, found := s.targetManagers[key]; found {
+			return nil, fmt.Errorf("target manager %s is defined twice", name)
+		}
+		s.targetManagers[key] = factory
+		s.describe.TargetManagers = append(s.describe.TargetManagers, name)
+	}
+	for _, load := range plugins.Reporters {
+		name, factory := load()
+		key := strings.ToLower(name)
+		if _, found := s.reporters[key]; found {
+			return nil, fmt.Errorf("reporter %s is defined twice", name)
+		}
+		s.reporters[key] = factory
+		s.describe.Reporters = append(s.describe.Reporters, name)
+	}
+	return &s, nil
+}
+
+// serverCertificate generates the self-signed certificate which the plugin
+// serves with, valid for the loopback address it listens on.
+func serverCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "contest-plugin"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// Serve serves the plugins over the plugin protocol, until the standard
+// input of the plugin is closed. It returns ErrNotLaunched if the binary was
+// not launched by the server.
+func Serve(plugins Plugins) error {
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		return ErrNotLaunched
+	}
+	s, err := newPluginServer(plugins)
+	if err != nil {
+		return err
+	}
+	// only the server, which runs on the same host, talks to the plugin
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("could not listen: %v", err)
+	}
+	cert, err := serverCertificate()
+	if err != nil {
+		return fmt.Errorf("could not generate the TLS certificate: %v", err)
+	}
+	srv := http.Server{
+		Handler:           s,
+		TLSConfig:         &tls.Config{Certificates: []tls.Certificate{cert}},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, os.Stdin)
+		log.Debugf("Standard input closed, shutting down")
+		_ = srv.Close()
+	}()
+	if _, err := fmt.Fprintf(os.Stdout, "%d|%d|tcp|%s|grpc|%s\n", CoreProtocolVersion, ProtocolVersion, l.Addr(), base64.RawStdEncoding.EncodeToString(cert.Certificate[0])); err != nil {
+		return fmt.Errorf("could not write handshake: %v", err)
+	}
+	if err := srv.ServeTLS(l, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *pluginServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	method := strings.TrimPrefix(r.URL.Path, "/"+ServiceName+"/")
+	var err error
+	switch method {
+	case "Describe":
+		err = unary(w, r, &DescribeRequest{}, s.describeHandler)
+	case "Validate":
+		err = unary(w, r, &ValidateRequest{}, s.validate)
+	case "RunTestStep":
+		err = s.runTestStep(w, r)
+	case "Acquire":
+		err = unary(w, r, &AcquireRequest{}, s.acquire)
+	case "Release":
+		err = unary(w, r, &ReleaseRequest{}, s.release)
+	case "Report":
+		err = unary(w, r, &ReportRequest{}, s.report)
+	default:
+		err = errorf(codeUnimplemented, "unknown method %s", r.URL.Path)
+	}
+	if err != nil {
+		log.Debugf("Plugin call %s failed: %v", method, err)
+	}
+	writeStatus(w, err)
+}
+
+// unary handles an RPC with a single response message.
+func unary(w http.ResponseWriter, r *http.Request, req Message, fn func(context.Context, Message) (Message, error)) error {
+	if err := readMessage(r.Body, req); err != nil {
+		return errorf(codeInvalidArgument, "could not read message: %v", err)
+	}
+	resp, err := fn(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	return writeMessage(w, resp)
+}
+
+// parameters returns the JSON encoded parameters of a request, or nil if
+// there are none.
+func parameters(paramsJSON string) []byte {
+	if paramsJSON == "" {
+		return nil
+	}
+	return []byte(paramsJSON)
+}
+
+func (s *pluginServer) testStep(name string) (test.TestStep, error) {
+	factory, ok := s.testSteps[strings.ToLower(name)]
+	if !ok {
+		return nil, errorf(codeNotFound, "unknown test step %s", name)
+	}
+	return factory(), nil
+}
+
+func (s *pluginServer) targetManager(name string) (target.TargetManager, error) {
+	factory, ok := s.targetManagers[strings.ToLower(name)]
+	if !ok {
+		return nil, errorf(codeNotFound, "unknown target manager %s", name)
+	}
+	return factory(), nil
+}
+
+func (s *pluginServer) reporter(name string) (job.Reporter, error) {
+	factory, ok := s.reporters[strings.ToLower(name)]
+	if !ok {
+		return nil, errorf(codeNotFound, "unknown reporter %s", name)
+	}
+	return factory(), nil
+}
+
+func (s *pluginServer) describeHandler(context.Context, Message) (Message, error) {
+	return &s.describe, nil
+}
+
+// testStepParameters decodes the parameters of a test step and validates
+// them.
+func testStepParameters(step test.TestStep, paramsJSON string) (test.TestStepParameters, error) {
+	var params test.TestStepParameters
+	if paramsJSON != "" {
+		if err := json.Unmarshal([]byte(paramsJSON), &params); err != nil {
+			return nil, errorf(codeInvalidArgument, "could not decode parameters: %v", err)
+		}
+	}
+	if err := step.ValidateParameters(params); err != nil {
+		return nil, errorf(codeInvalidArgument, "%v", err)
+	}
+	return params, nil
+}
+
+func (s *pluginServer) validate(_ context.Context, m Message) (Message, error) {
+	req := m.(*ValidateRequest)
+	params := parameters(req.ParametersJSON)
+	var err error
+	switch req.Kind {
+	case ValidateTestStep:
+		var step test.TestStep
+		if step, err = s.testStep(req.Name); err != nil {
+			return nil, err
+		}
+		if _, err := testStepParameters(step, req.ParametersJSON); err != nil {
+			return nil, err
+		}
+		return &ValidateResponse{}, nil
+	case ValidateAcquire, ValidateRelease:
+		var tm target.TargetManager
+		if tm, err = s.targetManager(req.Name); err != nil {
+			return nil, err
+		}
+		if req.Kind == ValidateAcquire {
+			_, err = tm.ValidateAcquireParameters(params)
+		} else {
+			_, err = tm.ValidateReleaseParameters(params)
+		}
+	case ValidateRunReport, ValidateFinalReport:
+		var reporter job.Reporter
+		if reporter, err = s.reporter(req.Name); err != nil {
+			return nil, err
+		}
+		if req.Kind == ValidateRunReport {
+			_, err = reporter.ValidateRunParameters(params)
+		} else {
+			_, err = reporter.ValidateFinalParameters(params)
+		}
+	default:
+		return nil, errorf(codeInvalidArgument, "unknown kind of parameters %d", req.Kind)
+	}
+	if err != nil {
+		return nil, errorf(codeInvalidArgument, "%v", err)
+	}
+	return &ValidateResponse{}, nil
+}
+
+// deferredLocker is the locker passed to the target managers of plugins.
+// Locks always succeed, as the server locks the acquired targets itself.
+type deferredLocker struct{}
+
+func (deferredLocker) Lock(types.JobID, []*target.Target) error         { return nil }
+func (deferredLocker) Unlock(types.JobID, []*target.Target) error       { return nil }
+func (deferredLocker) RefreshLocks(types.JobID, []*target.Target) error { return nil }
+
+func (s *pluginServer) acquire(ctx context.Context, m Message) (Message, error) {
+	req := m.(*AcquireRequest)
+	tm, err := s.targetManager(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	params, err := tm.ValidateAcquireParameters(parameters(req.ParametersJSON))
+	if err != nil {
+		return nil, errorf(codeInvalidArgument, "%v", err)
+	}
+	targets, err := tm.Acquire(types.JobID(req.JobID), ctx.Done(), params, deferredLocker{})
+	if err != nil {
+		return nil, err
+	}
+	var resp AcquireResponse
+	for _, t := range targets {
+		resp.Targets = append(resp.Targets, newTarget(t))
+	}
+	return &resp, nil
+}
+
+func (s *pluginServer) release(ctx context.Context, m Message) (Message, error) {
+	req := m.(*ReleaseRequest)
+	tm, err := s.targetManager(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	params, err := tm.ValidateReleaseParameters(parameters(req.ParametersJSON))
+	if err != nil {
+		return nil, errorf(codeInvalidArgument, "%v", err)
+	}
+	if err := tm.Release(types.JobID(req.JobID), ctx.Done(), params); err != nil {
+		return nil, err
+	}
+	return &ReleaseResponse{}, nil
+}
+
+// noEventsFetcher is the test event fetcher passed to the reporters of
+// plugins, which cannot fetch test events.
+type noEventsFetcher struct{}
+
+func (noEventsFetcher) Fetch(...testevent.QueryField) ([]testevent.Event, error) {
+	return nil, errors.New("test events cannot be fetched by external reporters")
+}
+
+func (s *pluginServer) report(ctx context.Context, m Message) (Message, error) {
+	req := m.(*ReportRequest)
+	reporter, err := s.reporter(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	var runStatuses []job.RunStatus
+	if err := json.Unmarshal([]byte(req.RunStatusesJSON), &runStatuses); err != nil {
+		return nil, errorf(codeInvalidArgument, "could not decode run statuses: %v", err)
+	}
+	var (
+		success bool
+		data    interface{}
+	)
+	if req.Final {
+		params, err := reporter.ValidateFinalParameters(parameters(req.ParametersJSON))
+		if err != nil {
+			return nil, errorf(codeInvalidArgument, "%v", err)
+		}
+		success, data, err = reporter.FinalReport(ctx.Done(), params, runStatuses, noEventsFetcher{})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if len(runStatuses) != 1 {
+			return nil, errorf(codeInvalidArgument, "a run report needs one run status, got %d", len(runStatuses))
+		}
+		params, err := reporter.ValidateRunParameters(parameters(req.ParametersJSON))
+		if err != nil {
+			return nil, errorf(codeInvalidArgument, "%v", err)
+		}
+		success, data, err = reporter.RunReport(ctx.Done(), params, &runStatuses[0], noEventsFetcher{})
+		if err != nil {
+			return nil, err
+		}
+	}
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return nil, errorf(codeInternal, "could not encode report: %v", err)
+	}
+	return &ReportResponse{Success: success, DataJSON: string(dataJSON)}, nil
+}
+
+// streamWriter writes the output messages of a test step, which are sent
+// concurrently by the step and by its emitter.
+type streamWriter struct {
+	mu sync.Mutex
+	w  http.ResponseWriter
+}
+
+func (s *streamWriter) write(msg *StepOutput) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeMessage(s.w, msg)
+}
+
+// Emit implements testevent.Emitter, sending the events to the server.
+func (s *streamWriter) Emit(data testevent.Data) error {
+	ev := StepEvent{Name: string(data.EventName)}
+	if data.Target != nil {
+		ev.Target = newTarget(data.Target)
+	}
+	if data.Payload != nil {
+		ev.PayloadJSON = string(*data.Payload)
+	}
+	return s.write(&StepOutput{Event: &ev})
+}
+
+// runTestStep runs a test step, see plugin.proto.
+func (s *pluginServer) runTestStep(w http.ResponseWriter, r *http.Request) error {
+	var input StepInput
+	if err := readMessage(r.Body, &input); err != nil {
+		return errorf(codeInvalidArgument, "could not read message: %v", err)
+	}
+	if input.Start == nil {
+		return errorf(codeInvalidArgument, "the first message does not start the step")
+	}
+	step, err := s.testStep(input.Start.Name)
+	if err != nil {
+		return err
+	}
+	params, err := testStepParameters(step, input.Start.ParametersJSON)
+	if err != nil {
+		return err
+	}
+	// send the headers, so that the server starts reading the outputs
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	var (
+		in, out      = make(chan *target.Target), make(chan *target.Target)
+		errs         = make(chan cerrors.TargetError)
+		cancel       = make(chan struct{})
+		pause        = make(chan struct{})
+		stepDone     = make(chan struct{})
+		forwardDone  = make(chan struct{})
+		stream       = streamWriter{w: w}
+		cancelOnce   sync.Once
+		pauseOnce    sync.Once
+		ctx, release = xcontext.New(r.Context(), cancel, pause)
+	)
+	defer release()
+	// the inputs are read until the server stops sending them
+	go func() {
+		// if the server went away, the step is canceled
+		defer cancelOnce.Do(func() { close(cancel) })
+		inputsDone := false
+		for {
+			var input StepInput
+			if err := readMessage(r.Body, &input); err != nil {
+				select {
+				case <-stepDone:
+				default:
+					if !errors.Is(err, io.EOF) {
+						log.Warningf("Could not read the inputs of step %s: %v", step.Name(), err)
+					}
+				}
+				return
+			}
+			switch {
+			case input.Target != nil && !inputsDone:
+				select {
+				case in <- input.Target.target():
+				case <-stepDone:
+					return
+				}
+			case input.EndOfTargets && !inputsDone:
+				inputsDone = true
+				close(in)
+			case input.Signal == SignalCancel:
+				cancelOnce.Do(func() { close(cancel) })
+			case input.Signal == SignalPause:
+				pauseOnce.Do(func() { close(pause) })
+			}
+		}
+	}()
+	// the results are sent as they come
+	go func() {
+		defer close(forwardDone)
+		for {
+			var result TargetResult
+			select {
+			case t := <-out:
+				result.Target = newTarget(t)
+			case targetErr := <-errs:
+				result.Target = newTarget(targetErr.Target)
+				result.Error = targetErr.Err.Error()
+				var skipped *cerrors.ErrTargetSkipped
+				if errors.As(targetErr.Err, &skipped) {
+					result.Skipped, result.Error = true, skipped.Reason
+				}
+			case <-stepDone:
+				return
+			}
+			if err := stream.write(&StepOutput{Result: &result}); err != nil {
+				log.Warningf("Could not send the result of step %s for target %s: %v", step.Name(), result.Target.ID, err)
+			}
+		}
+	}()
+	err = step.Run(ctx, test.TestStepChannels{In: in, Out: out, Err: errs}, params, &stream)
+	close(stepDone)
+	<-forwardDone
+	return err
+}
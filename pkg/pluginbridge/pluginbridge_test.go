@@ -0,0 +1,305 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package pluginbridge
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/cerrors"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/pluginregistry"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/facebookincubator/contest/pkg/xcontext"
+	"github.com/facebookincubator/contest/plugins/reporters/noop"
+	"github.com/facebookincubator/contest/plugins/targetmanagers/targetlist"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain runs the test binary as a plugin when launched by Launch.
+func TestMain(m *testing.M) {
+	if os.Getenv(MagicCookieKey) == MagicCookieValue {
+		err := Serve(Plugins{
+			TestSteps:      []test.TestStepLoader{loadStep},
+			TargetManagers: []target.TargetManagerLoader{targetlist.Load},
+			Reporters:      []job.ReporterLoader{noop.Load},
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+var eventTargetSeen = event.Name("TargetSeen")
+
+// step is the test step of the plugin. It fails the targets listed in the
+// fail parameter, skips the ones listed in the skip parameter, and waits
+// for cancellation or pause if the wait parameter is set.
+type step struct{}
+
+func loadStep() (string, test.TestStepFactory, []event.Name) {
+	return "Remote", func() test.TestStep { return step{} }, []event.Name{eventTargetSeen}
+}
+
+func (step) Name() string { return "Remote" }
+
+func (step) ValidateParameters(params test.TestStepParameters) error {
+	if params.GetOne("text").IsEmpty() {
+		return fmt.Errorf("missing text")
+	}
+	return nil
+}
+
+func (step) Run(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
+	if !params.GetOne("wait").IsEmpty() {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	contains := func(key, id string) bool {
+		for _, p := range params.Get(key) {
+			if p.String() == id {
+				return true
+			}
+		}
+		return false
+	}
+	for t := range ch.In {
+		payload := json.RawMessage(fmt.Sprintf(`{"text":%q}`, params.GetOne("text").String()))
+		if err := ev.Emit(testevent.Data{EventName: eventTargetSeen, Target: t, Payload: &payload}); err != nil {
+			return err
+		}
+		switch {
+		case contains("fail", t.ID):
+			ch.Err <- cerrors.TargetError{Target: t, Err: fmt.Errorf("target %s failed", t.ID)}
+		case contains("skip", t.ID):
+			ch.Err <- cerrors.TargetError{Target: t, Err: &cerrors.ErrTargetSkipped{Reason: "not applicable"}}
+		default:
+			ch.Out <- t
+		}
+	}
+	return nil
+}
+
+func (step) CanResume() bool { return false }
+
+func (step) Resume(context.Context, test.TestStepChannels, test.TestStepParameters, testevent.EmitterFetcher) error {
+	return &cerrors.ErrResumeNotSupported{StepName: "Remote"}
+}
+
+type recordingEmitter struct {
+	mu     sync.Mutex
+	events []testevent.Data
+}
+
+func (e *recordingEmitter) Emit(data testevent.Data) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, data)
+	return nil
+}
+
+type recordingLocker struct {
+	locked []*target.Target
+}
+
+func (l *recordingLocker) Lock(_ types.JobID, targets []*target.Target) error {
+	l.locked = append(l.locked, targets...)
+	return nil
+}
+
+func (l *recordingLocker) Unlock(types.JobID, []*target.Target) error       { return nil }
+func (l *recordingLocker) RefreshLocks(types.JobID, []*target.Target) error { return nil }
+
+func params(t *testing.T, kv map[string][]string) test.TestStepParameters {
+	p := make(test.TestStepParameters)
+	for k, values := range kv {
+		for _, v := range values {
+			data, err := json.Marshal(v)
+			require.NoError(t, err)
+			p[k] = append(p[k], test.Param{RawMessage: data})
+		}
+	}
+	return p
+}
+
+func TestServeNotLaunched(t *testing.T) {
+	require.Equal(t, ErrNotLaunched, Serve(Plugins{}))
+}
+
+func TestParseHandshake(t *testing.T) {
+	cert, err := serverCertificate()
+	require.NoError(t, err)
+	encoded := base64.RawStdEncoding.EncodeToString(cert.Certificate[0])
+	addr, parsed, err := parseHandshake("1|1|tcp|127.0.0.1:1234|grpc|" + encoded)
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1:1234", addr)
+	require.Equal(t, cert.Certificate[0], parsed.Raw)
+
+	for _, line := range []string{
+		"",
+		"1|1|tcp|127.0.0.1:1234",
+		"1|1|tcp|127.0.0.1:1234|grpc",
+		"1|1|tcp|127.0.0.1:1234|grpc|bm90IGEgY2VydGlmaWNhdGU",
+		"2|1|tcp|127.0.0.1:1234|grpc|" + encoded,
+		"1|2|tcp|127.0.0.1:1234|grpc|" + encoded,
+		"1|1|unix|/tmp/plugin|grpc|" + encoded,
+		"1|1|tcp|127.0.0.1:1234|netrpc|" + encoded,
+	} {
+		_, _, err := parseHandshake(line)
+		require.Error(t, err, line)
+	}
+}
+
+func TestIncompatibleAPIVersion(t *testing.T) {
+	desc := DescribeResponse{Reporters: []string{"Old"}, APIVersion: 7}
+	var decoded DescribeResponse
+	require.NoError(t, decoded.Unmarshal(desc.Marshal()))
+	require.Equal(t, desc, decoded)
+
+	// binaries which do not describe their version are not supported either
+	for _, version := range []int{0, pluginregistry.APIVersion + 1} {
+		client := &Client{name: "old", apiVersion: version}
+		err := pluginregistry.NewPluginRegistry().RegisterReporter("Old", func() job.Reporter {
+			return &remoteReporter{client: client, name: "Old"}
+		})
+		var versionErr pluginregistry.ErrIncompatibleAPIVersion
+		require.True(t, errors.As(err, &versionErr), "%v", err)
+		require.Equal(t, version, versionErr.Version)
+	}
+}
+
+func TestRemotePlugins(t *testing.T) {
+	client, err := Launch(os.Args[0])
+	require.NoError(t, err)
+	defer client.Kill()
+
+	registry := pluginregistry.NewPluginRegistry()
+	require.NoError(t, client.Register(registry))
+	require.Equal(t, pluginregistry.APIVersion, client.apiVersion)
+	events, err := registry.NewTestStepEvents("remote")
+	require.NoError(t, err)
+	require.Equal(t, map[event.Name]bool{eventTargetSeen: true}, events)
+
+	t.Run("TestStep", func(t *testing.T) {
+		s, err := registry.NewTestStep("remote")
+		require.NoError(t, err)
+		require.Equal(t, "Remote", s.Name())
+		require.False(t, s.CanResume())
+		require.Error(t, s.ValidateParameters(params(t, nil)))
+		p := params(t, map[string][]string{"text": {"hello"}, "fail": {"2"}, "skip": {"3"}})
+		require.NoError(t, s.ValidateParameters(p))
+
+		targets := []*target.Target{{ID: "1", Name: "one"}, {ID: "2", Name: "two"}, {ID: "3", Name: "three"}}
+		var (
+			in     = make(chan *target.Target)
+			out    = make(chan *target.Target, len(targets))
+			errs   = make(chan cerrors.TargetError, len(targets))
+			ev     recordingEmitter
+			result = make(chan error, 1)
+		)
+		go func() {
+			result <- s.Run(context.Background(), test.TestStepChannels{In: in, Out: out, Err: errs}, p, &ev)
+		}()
+		for _, tgt := range targets {
+			in <- tgt
+		}
+		close(in)
+		require.NoError(t, <-result)
+
+		// the targets are returned as they were passed
+		require.Len(t, out, 1)
+		require.Same(t, targets[0], <-out)
+		require.Len(t, errs, 2)
+		failed := <-errs
+		require.Same(t, targets[1], failed.Target)
+		require.EqualError(t, failed.Err, "target 2 failed")
+		skipped := <-errs
+		require.Same(t, targets[2], skipped.Target)
+		require.IsType(t, &cerrors.ErrTargetSkipped{}, skipped.Err)
+
+		require.Len(t, ev.events, 3)
+		for idx, data := range ev.events {
+			require.Equal(t, eventTargetSeen, data.EventName)
+			require.Same(t, targets[idx], data.Target)
+			require.JSONEq(t, `{"text":"hello"}`, string(*data.Payload))
+		}
+	})
+
+	t.Run("TestStepPause", func(t *testing.T) {
+		s, err := registry.NewTestStep("remote")
+		require.NoError(t, err)
+		var (
+			in          = make(chan *target.Target)
+			pause       = make(chan struct{})
+			ctx, cancel = xcontext.New(context.Background(), nil, pause)
+			result      = make(chan error, 1)
+		)
+		defer cancel()
+		p := params(t, map[string][]string{"text": {"hello"}, "wait": {"true"}})
+		go func() {
+			result <- s.Run(ctx, test.TestStepChannels{In: in, Out: make(chan *target.Target), Err: make(chan cerrors.TargetError)}, p, &recordingEmitter{})
+		}()
+		close(pause)
+		select {
+		case err := <-result:
+			require.Equal(t, xcontext.ErrPaused, err)
+		case <-time.After(10 * time.Second):
+			t.Fatal("the step did not return once paused")
+		}
+	})
+
+	t.Run("TargetManager", func(t *testing.T) {
+		tm, err := registry.NewTargetManager("targetlist")
+		require.NoError(t, err)
+		_, err = tm.ValidateAcquireParameters([]byte(`{"Targets": [{"ID": "1"}]}`))
+		require.Error(t, err)
+		acquireParams, err := tm.ValidateAcquireParameters([]byte(`{"Targets": [{"ID": "1", "Name": "one"}, {"ID": "2", "Name": "two"}]}`))
+		require.NoError(t, err)
+
+		var locker recordingLocker
+		targets, err := tm.Acquire(1, nil, acquireParams, &locker)
+		require.NoError(t, err)
+		require.Equal(t, []*target.Target{{ID: "1", Name: "one"}, {ID: "2", Name: "two"}}, targets)
+		require.Equal(t, targets, locker.locked)
+
+		releaseParams, err := tm.ValidateReleaseParameters([]byte(`{}`))
+		require.NoError(t, err)
+		require.NoError(t, tm.Release(1, nil, releaseParams))
+	})
+
+	t.Run("Reporter", func(t *testing.T) {
+		r, err := registry.NewReporter("noop")
+		require.NoError(t, err)
+		runParams, err := r.ValidateRunParameters(nil)
+		require.NoError(t, err)
+		success, data, err := r.RunReport(nil, runParams, &job.RunStatus{}, nil)
+		require.NoError(t, err)
+		require.True(t, success)
+		require.Equal(t, "I did nothing", data)
+
+		finalParams, err := r.ValidateFinalParameters(nil)
+		require.NoError(t, err)
+		success, data, err = r.FinalReport(nil, finalParams, []job.RunStatus{{}, {}}, nil)
+		require.NoError(t, err)
+		require.True(t, success)
+		require.Equal(t, "I did nothing at the end, all good", data)
+	})
+}
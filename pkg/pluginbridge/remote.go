@@ -0,0 +1,354 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package pluginbridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/facebookincubator/contest/pkg/cerrors"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/facebookincubator/contest/pkg/xcontext"
+)
+
+// remoteTestStep is a test step implemented by a plugin.
+type remoteTestStep struct {
+	client *Client
+	name   string
+}
+
+// Name returns the name of the step.
+func (s *remoteTestStep) Name() string {
+	return s.name
+}
+
+// PluginAPIVersion returns the version of the plugin API which the step was
+// built against.
+func (s *remoteTestStep) PluginAPIVersion() int {
+	return s.client.apiVersion
+}
+
+// ValidateParameters validates the parameters of the step in the plugin.
+func (s *remoteTestStep) ValidateParameters(params test.TestStepParameters) error {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.client.callWithTimeout("Validate", &ValidateRequest{
+		Kind:           ValidateTestStep,
+		Name:           s.name,
+		ParametersJSON: string(paramsJSON),
+	}, &ValidateResponse{})
+}
+
+// CanResume returns false, as the steps of plugins cannot resume.
+func (s *remoteTestStep) CanResume() bool {
+	return false
+}
+
+// Resume returns ErrResumeNotSupported.
+func (s *remoteTestStep) Resume(context.Context, test.TestStepChannels, test.TestStepParameters, testevent.EmitterFetcher) error {
+	return &cerrors.ErrResumeNotSupported{StepName: s.name}
+}
+
+// stepTargets maps the targets sent to a step in a plugin back to the
+// targets of the server, so that the step returns the targets it got.
+type stepTargets struct {
+	mu      sync.Mutex
+	targets map[string]*target.Target
+}
+
+func (s *stepTargets) add(t *target.Target) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.targets[t.ID] = t
+}
+
+func (s *stepTargets) get(t *Target) *target.Target {
+	if t == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if found, ok := s.targets[t.ID]; ok {
+		return found
+	}
+	return t.target()
+}
+
+// sendInputs sends the targets of the step to the plugin, and then the
+// signal to cancel or pause the step once its context is done. It returns
+// when the step returns.
+func (s *remoteTestStep) sendInputs(ctx context.Context, w io.Writer, in <-chan *target.Target, targets *stepTargets, stepDone <-chan struct{}) {
+	for {
+		select {
+		case t := <-in:
+			input := StepInput{EndOfTargets: true}
+			if t != nil {
+				targets.add(t)
+				input = StepInput{Target: newTarget(t)}
+			} else {
+				in = nil
+			}
+			if err := writeMessage(w, &input); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			signal := SignalCancel
+			if xcontext.IsPaused(ctx) {
+				signal = SignalPause
+			}
+			_ = writeMessage(w, &StepInput{Signal: signal})
+			return
+		case <-stepDone:
+			return
+		}
+	}
+}
+
+// Run runs the step in the plugin, see the RunTestStep RPC.
+func (s *remoteTestStep) Run(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	start := StepInput{Start: &StepStart{Name: s.name, ParametersJSON: string(paramsJSON)}}
+	// the inputs are streamed through a pipe, which stays open until the step
+	// returns, as closing it cancels the step
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	// the call is not bound to ctx, as the step is told about its
+	// cancellation or pause by a signal, and returns on its own
+	streamCtx, stopStream := context.WithCancel(context.Background())
+	defer stopStream()
+	req, err := s.client.newRequest(streamCtx, "RunTestStep", pr)
+	if err != nil {
+		return err
+	}
+	var (
+		targets  = stepTargets{targets: make(map[string]*target.Target)}
+		stepDone = make(chan struct{})
+	)
+	defer close(stepDone)
+	go func() {
+		if err := writeMessage(pw, &start); err != nil {
+			return
+		}
+		s.sendInputs(ctx, pw, ch.In, &targets, stepDone)
+	}()
+	resp, err := s.client.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not run step %s in plugin %s: %v", s.name, s.client.name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not run step %s in plugin %s: %s", s.name, s.client.name, resp.Status)
+	}
+	for {
+		var output StepOutput
+		if err := readMessage(resp.Body, &output); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("could not read the outputs of step %s in plugin %s: %v", s.name, s.client.name, err)
+		}
+		switch {
+		case output.Result != nil:
+			s.sendResult(ctx, ch, targets.get(output.Result.Target), output.Result)
+		case output.Event != nil:
+			data := testevent.Data{
+				EventName: event.Name(output.Event.Name),
+				Target:    targets.get(output.Event.Target),
+			}
+			if output.Event.PayloadJSON != "" {
+				payload := json.RawMessage(output.Event.PayloadJSON)
+				data.Payload = &payload
+			}
+			if err := ev.Emit(data); err != nil {
+				return fmt.Errorf("could not emit event %s of step %s: %v", output.Event.Name, s.name, err)
+			}
+		}
+	}
+	return responseStatus(resp)
+}
+
+// sendResult passes the result of the step for a target on to the next
+// step. Results are discarded once the step is canceled or paused.
+func (s *remoteTestStep) sendResult(ctx context.Context, ch test.TestStepChannels, t *target.Target, result *TargetResult) {
+	if t == nil {
+		log.Warningf("Step %s of plugin %s returned a result without target", s.name, s.client.name)
+		return
+	}
+	if result.Error == "" {
+		select {
+		case ch.Out <- t:
+		case <-ctx.Done():
+		}
+		return
+	}
+	err := errors.New(result.Error)
+	if result.Skipped {
+		err = &cerrors.ErrTargetSkipped{Reason: result.Error}
+	}
+	select {
+	case ch.Err <- cerrors.TargetError{Target: t, Err: err}:
+	case <-ctx.Done():
+	}
+}
+
+// remoteParameters are the parameters of a target manager or reporter of a
+// plugin. They are validated by the plugin, which gets them as they are
+// when they are used.
+type remoteParameters []byte
+
+// remoteTargetManager is a target manager implemented by a plugin.
+type remoteTargetManager struct {
+	client *Client
+	name   string
+}
+
+// PluginAPIVersion returns the version of the plugin API which the target
+// manager was built against.
+func (tm *remoteTargetManager) PluginAPIVersion() int {
+	return tm.client.apiVersion
+}
+
+func (tm *remoteTargetManager) validate(kind ValidateKind, params []byte) (interface{}, error) {
+	err := tm.client.callWithTimeout("Validate", &ValidateRequest{
+		Kind:           kind,
+		Name:           tm.name,
+		ParametersJSON: string(params),
+	}, &ValidateResponse{})
+	if err != nil {
+		return nil, err
+	}
+	return remoteParameters(params), nil
+}
+
+// ValidateAcquireParameters validates the acquire parameters in the plugin.
+func (tm *remoteTargetManager) ValidateAcquireParameters(params []byte) (interface{}, error) {
+	return tm.validate(ValidateAcquire, params)
+}
+
+// ValidateReleaseParameters validates the release parameters in the plugin.
+func (tm *remoteTargetManager) ValidateReleaseParameters(params []byte) (interface{}, error) {
+	return tm.validate(ValidateRelease, params)
+}
+
+// Acquire acquires the targets from the plugin, and locks them.
+func (tm *remoteTargetManager) Acquire(jobID types.JobID, cancel <-chan struct{}, parameters interface{}, tl target.Locker) ([]*target.Target, error) {
+	var resp AcquireResponse
+	err := tm.client.callWithCancel(cancel, "Acquire", &AcquireRequest{
+		Name:           tm.name,
+		JobID:          uint64(jobID),
+		ParametersJSON: string(parameters.(remoteParameters)),
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]*target.Target, 0, len(resp.Targets))
+	for _, t := range resp.Targets {
+		targets = append(targets, t.target())
+	}
+	if err := tl.Lock(jobID, targets); err != nil {
+		return nil, fmt.Errorf("could not lock %d targets acquired from plugin %s: %v", len(targets), tm.client.name, err)
+	}
+	return targets, nil
+}
+
+// Release releases the targets to the plugin.
+func (tm *remoteTargetManager) Release(jobID types.JobID, cancel <-chan struct{}, parameters interface{}) error {
+	return tm.client.callWithCancel(cancel, "Release", &ReleaseRequest{
+		Name:           tm.name,
+		JobID:          uint64(jobID),
+		ParametersJSON: string(parameters.(remoteParameters)),
+	}, &ReleaseResponse{})
+}
+
+// remoteReporter is a reporter implemented by a plugin. The reporters of
+// plugins cannot fetch test events.
+type remoteReporter struct {
+	client *Client
+	name   string
+}
+
+// Name returns the name of the reporter.
+func (r *remoteReporter) Name() string {
+	return r.name
+}
+
+// PluginAPIVersion returns the version of the plugin API which the reporter
+// was built against.
+func (r *remoteReporter) PluginAPIVersion() int {
+	return r.client.apiVersion
+}
+
+func (r *remoteReporter) validate(kind ValidateKind, params []byte) (interface{}, error) {
+	err := r.client.callWithTimeout("Validate", &ValidateRequest{
+		Kind:           kind,
+		Name:           r.name,
+		ParametersJSON: string(params),
+	}, &ValidateResponse{})
+	if err != nil {
+		return nil, err
+	}
+	return remoteParameters(params), nil
+}
+
+// ValidateRunParameters validates the run report parameters in the plugin.
+func (r *remoteReporter) ValidateRunParameters(params []byte) (interface{}, error) {
+	return r.validate(ValidateRunReport, params)
+}
+
+// ValidateFinalParameters validates the final report parameters in the
+// plugin.
+func (r *remoteReporter) ValidateFinalParameters(params []byte) (interface{}, error) {
+	return r.validate(ValidateFinalReport, params)
+}
+
+func (r *remoteReporter) report(cancel <-chan struct{}, final bool, parameters interface{}, runStatuses []job.RunStatus) (bool, interface{}, error) {
+	runStatusesJSON, err := json.Marshal(runStatuses)
+	if err != nil {
+		return false, nil, err
+	}
+	var resp ReportResponse
+	err = r.client.callWithCancel(cancel, "Report", &ReportRequest{
+		Name:            r.name,
+		Final:           final,
+		ParametersJSON:  string(parameters.(remoteParameters)),
+		RunStatusesJSON: string(runStatusesJSON),
+	}, &resp)
+	if err != nil {
+		return false, nil, err
+	}
+	// the data is decoded, so that documents are reported as strings like
+	// the built-in reporters do
+	var data interface{}
+	if err := json.Unmarshal([]byte(resp.DataJSON), &data); err != nil {
+		return false, nil, fmt.Errorf("could not decode the report of plugin %s: %v", r.client.name, err)
+	}
+	return resp.Success, data, nil
+}
+
+// RunReport computes the report of a run in the plugin.
+func (r *remoteReporter) RunReport(cancel <-chan struct{}, parameters interface{}, runStatus *job.RunStatus, _ testevent.Fetcher) (bool, interface{}, error) {
+	return r.report(cancel, false, parameters, []job.RunStatus{*runStatus})
+}
+
+// FinalReport computes the final report of a job in the plugin.
+func (r *remoteReporter) FinalReport(cancel <-chan struct{}, parameters interface{}, runStatuses []job.RunStatus, _ testevent.Fetcher) (bool, interface{}, error) {
+	return r.report(cancel, true, parameters, runStatuses)
+}
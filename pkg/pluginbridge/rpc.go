@@ -0,0 +1,124 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package pluginbridge
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/facebookincubator/contest/pkg/lib/protowire"
+	"github.com/facebookincubator/contest/pkg/xcontext"
+)
+
+// ServiceName is the fully qualified name of the gRPC service served by the
+// plugins.
+const ServiceName = "contest.plugin.v1.Plugin"
+
+// gRPC status codes, see
+// https://github.com/grpc/grpc/blob/master/doc/statuscodes.md
+const (
+	codeOK              = 0
+	codeCanceled        = 1
+	codeUnknown         = 2
+	codeInvalidArgument = 3
+	codeNotFound        = 5
+	codeAborted         = 10
+	codeUnimplemented   = 12
+	codeInternal        = 13
+)
+
+// rpcError is an error returned to the server as a gRPC status.
+type rpcError struct {
+	code int
+	msg  string
+}
+
+func (e *rpcError) Error() string {
+	return e.msg
+}
+
+func errorf(code int, format string, args ...interface{}) error {
+	return &rpcError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// readMessage reads a length-prefixed gRPC message from r.
+func readMessage(r io.Reader, msg Message) error {
+	data, err := protowire.ReadMessage(r)
+	if err != nil {
+		return err
+	}
+	return msg.Unmarshal(data)
+}
+
+// writeMessage writes a length-prefixed gRPC message to w, and flushes it if
+// w is a ResponseWriter, so that the messages of streams are not delayed.
+func writeMessage(w io.Writer, msg Message) error {
+	if err := protowire.WriteMessage(w, msg.Marshal()); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// writeStatus writes the status of a call in the trailers of its response.
+// The pause and the cancellation of test steps have a status of their own,
+// so that the server can tell them apart from failures.
+func writeStatus(w http.ResponseWriter, err error) {
+	code, msg := codeOK, ""
+	if err != nil {
+		var rpcErr *rpcError
+		switch {
+		case errors.As(err, &rpcErr):
+			code, msg = rpcErr.code, rpcErr.msg
+		case errors.Is(err, xcontext.ErrPaused):
+			code, msg = codeAborted, err.Error()
+		case errors.Is(err, xcontext.ErrCanceled):
+			code, msg = codeCanceled, err.Error()
+		default:
+			code, msg = codeUnknown, err.Error()
+		}
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", protowire.EncodeStatusMessage(msg))
+	}
+}
+
+// responseStatus returns the error carried by the status of a call, once its
+// response has been read. Calls which failed before sending any message may
+// carry their status in the headers rather than the trailers.
+func responseStatus(resp *http.Response) error {
+	h := resp.Trailer
+	if h.Get("Grpc-Status") == "" {
+		h = resp.Header
+	}
+	status := h.Get("Grpc-Status")
+	if status == "" {
+		return errors.New("plugin returned no status")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return fmt.Errorf("plugin returned an invalid status %q", status)
+	}
+	msg := protowire.DecodeStatusMessage(h.Get("Grpc-Message"))
+	switch code {
+	case codeOK:
+		return nil
+	case codeAborted:
+		return xcontext.ErrPaused
+	case codeCanceled:
+		return xcontext.ErrCanceled
+	}
+	if msg == "" {
+		msg = fmt.Sprintf("plugin call failed with status %d", code)
+	}
+	return errors.New(msg)
+}
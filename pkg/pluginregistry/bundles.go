@@ -6,7 +6,10 @@
 package pluginregistry
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/facebookincubator/contest/pkg/event"
 	"github.com/facebookincubator/contest/pkg/job"
@@ -20,6 +23,13 @@ func (r *PluginRegistry) NewTestStepBundle(testStepDescriptor test.TestStepDescr
 	if err != nil {
 		return nil, fmt.Errorf("could not get the desired TestStep (%s): %v", testStepDescriptor.Name, err)
 	}
+	params, err := json.Marshal(testStepDescriptor.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode parameters for test step %s: %v", testStepDescriptor.Name, err)
+	}
+	if err := r.validateSchema(KindTestStep, testStepDescriptor.Name, ParametersStep, params); err != nil {
+		return nil, fmt.Errorf("could not validate parameters for test step %s: %v", testStepDescriptor.Name, err)
+	}
 	if err := testStep.ValidateParameters(testStepDescriptor.Parameters); err != nil {
 		return nil, fmt.Errorf("could not validate parameters for test step %s: %v", testStepDescriptor.Name, err)
 	}
@@ -27,11 +37,17 @@ func (r *PluginRegistry) NewTestStepBundle(testStepDescriptor test.TestStepDescr
 	if label == "" {
 		return nil, ErrStepLabelIsMandatory{TestStepDescriptor: testStepDescriptor}
 	}
+	timeout := time.Duration(testStepDescriptor.Timeout)
+	if timeout < 0 {
+		return nil, fmt.Errorf("invalid timeout for test step %s: %v", label, timeout)
+	}
 	testStepBundle := test.TestStepBundle{
 		TestStep:      testStep,
 		TestStepLabel: label,
 		Parameters:    testStepDescriptor.Parameters,
 		AllowedEvents: allowedEvents,
+		Timeout:       timeout,
+		IgnoreFailure: testStepDescriptor.IgnoreFailure,
 	}
 	return &testStepBundle, nil
 }
@@ -45,12 +61,16 @@ func (r *PluginRegistry) NewTestFetcherBundle(testDescriptor *test.TestDescripto
 		return nil, fmt.Errorf("could not get the desired TestFetcher (%s): %v", testDescriptor.TestFetcherName, err)
 	}
 	// FetchParameters
+	if err := r.validateSchema(KindTestFetcher, testDescriptor.TestFetcherName, ParametersFetch, testDescriptor.TestFetcherFetchParameters); err != nil {
+		return nil, fmt.Errorf("could not validate TestFetcher fetch parameters: %v", err)
+	}
 	fp, err := testFetcher.ValidateFetchParameters(testDescriptor.TestFetcherFetchParameters)
 	if err != nil {
 		return nil, fmt.Errorf("could not validate TestFetcher fetch parameters: %v", err)
 	}
 
 	testFetcherBundle := test.TestFetcherBundle{
+		TestFetcherName: strings.ToLower(testDescriptor.TestFetcherName),
 		TestFetcher:     testFetcher,
 		FetchParameters: fp,
 	}
@@ -65,17 +85,24 @@ func (r *PluginRegistry) NewTargetManagerBundle(testDescriptor *test.TestDescrip
 		return nil, fmt.Errorf("could not get TargetManager (%s): %v", testDescriptor.TargetManagerName, err)
 	}
 	// AcquireParameters
+	if err := r.validateSchema(KindTargetManager, testDescriptor.TargetManagerName, ParametersAcquire, testDescriptor.TargetManagerAcquireParameters); err != nil {
+		return nil, fmt.Errorf("could not validate TargetManager acquire parameters: %v", err)
+	}
 	ap, err := targetManager.ValidateAcquireParameters(testDescriptor.TargetManagerAcquireParameters)
 	if err != nil {
 		return nil, fmt.Errorf("could not validate TargetManager acquire parameters: %v", err)
 	}
 	// ReleaseParameters
+	if err := r.validateSchema(KindTargetManager, testDescriptor.TargetManagerName, ParametersRelease, testDescriptor.TargetManagerReleaseParameters); err != nil {
+		return nil, fmt.Errorf("could not validate TargetManager release parameters: %v", err)
+	}
 	rp, err := targetManager.ValidateReleaseParameters(testDescriptor.TargetManagerReleaseParameters)
 	if err != nil {
 		return nil, fmt.Errorf("could not validate TargetManager release parameters: %v", err)
 	}
 
 	targetManagerBundle := target.TargetManagerBundle{
+		TargetManagerName: strings.ToLower(testDescriptor.TargetManagerName),
 		TargetManager:     targetManager,
 		AcquireParameters: ap,
 		ReleaseParameters: rp,
@@ -91,6 +118,9 @@ func (r *PluginRegistry) NewRunReporterBundle(reporterName string, reporterParam
 		return nil, fmt.Errorf("could not get reporter '%s': %v", reporterName, err)
 	}
 
+	if err := r.validateSchema(KindReporter, reporterName, ParametersRun, reporterParameters); err != nil {
+		return nil, fmt.Errorf("could not validate run reporter parameters: %v", err)
+	}
 	rp, err := reporter.ValidateRunParameters(reporterParameters)
 	if err != nil {
 		return nil, fmt.Errorf("could not validate run reporter parameters: %v", err)
@@ -111,6 +141,9 @@ func (r *PluginRegistry) NewFinalReporterBundle(reporterName string, reporterPar
 		return nil, fmt.Errorf("could not get reporter '%s': %v", reporterName, err)
 	}
 
+	if err := r.validateSchema(KindReporter, reporterName, ParametersFinal, reporterParameters); err != nil {
+		return nil, fmt.Errorf("could not validate final reporter parameters: %v", err)
+	}
 	rp, err := reporter.ValidateFinalParameters(reporterParameters)
 	if err != nil {
 		return nil, fmt.Errorf("could not validate run reporter parameters: %v", err)
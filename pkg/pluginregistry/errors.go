@@ -18,3 +18,17 @@ type ErrStepLabelIsMandatory struct {
 func (err ErrStepLabelIsMandatory) Error() string {
 	return fmt.Sprintf("step has no label, but it is mandatory (step: %+v)", err.TestStepDescriptor)
 }
+
+// ErrIncompatibleAPIVersion is returned when registering a plugin built
+// against a version of the plugin API which this version of the framework
+// does not support.
+type ErrIncompatibleAPIVersion struct {
+	Version int
+}
+
+func (err ErrIncompatibleAPIVersion) Error() string {
+	if err.Version > APIVersion {
+		return fmt.Sprintf("plugin built against plugin API version %d, newer than the supported version %d: upgrade the server", err.Version, APIVersion)
+	}
+	return fmt.Sprintf("plugin built against plugin API version %d, older than the minimum supported version %d: rebuild the plugin", err.Version, MinAPIVersion)
+}
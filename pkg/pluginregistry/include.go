@@ -0,0 +1,81 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package pluginregistry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/facebookincubator/contest/pkg/test"
+)
+
+// maxIncludeDepth limits how deeply includes can be nested, as a safety net
+// against includes which are not identical but grow indefinitely.
+const maxIncludeDepth = 16
+
+// includeKey identifies an include, so that cycles can be detected.
+func includeKey(include *test.IncludeDescriptor) (string, error) {
+	var params bytes.Buffer
+	if len(include.TestFetcherFetchParameters) > 0 {
+		if err := json.Compact(&params, include.TestFetcherFetchParameters); err != nil {
+			return "", fmt.Errorf("invalid include parameters: %v", err)
+		}
+	}
+	return strings.ToLower(include.TestFetcherName) + " " + params.String(), nil
+}
+
+// ResolveIncludes returns the given test step descriptors, where the ones
+// including other steps are replaced by the included steps, fetched with the
+// respective TestFetcher. Included steps are resolved recursively, and an
+// include which includes itself, directly or not, is an error.
+func (r *PluginRegistry) ResolveIncludes(steps []*test.TestStepDescriptor) ([]*test.TestStepDescriptor, error) {
+	return r.resolveIncludes(steps, nil)
+}
+
+func (r *PluginRegistry) resolveIncludes(steps []*test.TestStepDescriptor, stack []string) ([]*test.TestStepDescriptor, error) {
+	var resolved []*test.TestStepDescriptor
+	for _, step := range steps {
+		if step == nil || step.Include == nil {
+			resolved = append(resolved, step)
+			continue
+		}
+		include := step.Include
+		if step.Name != "" || step.Label != "" || len(step.Parameters) > 0 {
+			return nil, fmt.Errorf("include of %s cannot have a name, a label or parameters", include.TestFetcherName)
+		}
+		key, err := includeKey(include)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range stack {
+			if k == key {
+				return nil, fmt.Errorf("include cycle detected: %s", strings.Join(append(stack, key), " -> "))
+			}
+		}
+		if len(stack) >= maxIncludeDepth {
+			return nil, fmt.Errorf("includes nested more than %d levels deep", maxIncludeDepth)
+		}
+		tfb, err := r.NewTestFetcherBundle(&test.TestDescriptor{
+			TestFetcherName:            include.TestFetcherName,
+			TestFetcherFetchParameters: include.TestFetcherFetchParameters,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("cannot include steps: %v", err)
+		}
+		_, included, err := tfb.TestFetcher.Fetch(tfb.FetchParameters)
+		if err != nil {
+			return nil, fmt.Errorf("cannot fetch included steps: %v", err)
+		}
+		included, err = r.resolveIncludes(included, append(stack, key))
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, included...)
+	}
+	return resolved, nil
+}
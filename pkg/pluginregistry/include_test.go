@@ -0,0 +1,75 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package pluginregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/test"
+	"github.com/stretchr/testify/require"
+)
+
+// mapFetcher returns the steps stored under the name given in the fetch
+// parameters.
+type mapFetcher map[string]string
+
+func (f mapFetcher) ValidateFetchParameters(params []byte) (interface{}, error) {
+	var name string
+	if err := json.Unmarshal(params, &name); err != nil {
+		return nil, err
+	}
+	return name, nil
+}
+
+func (f mapFetcher) Fetch(params interface{}) (string, []*test.TestStepDescriptor, error) {
+	data, ok := f[params.(string)]
+	if !ok {
+		return "", nil, fmt.Errorf("no steps named %s", params)
+	}
+	var steps []*test.TestStepDescriptor
+	if err := json.Unmarshal([]byte(data), &steps); err != nil {
+		return "", nil, err
+	}
+	return params.(string), steps, nil
+}
+
+func TestResolveIncludes(t *testing.T) {
+	fetcher := mapFetcher{
+		"prologue":  `[{"name": "AStep", "label": "power_on"}, {"include": {"TestFetcherName": "map", "TestFetcherFetchParameters": "provision"}}]`,
+		"provision": `[{"name": "AStep", "label": "provision"}]`,
+		"loop":      `[{"include": {"TestFetcherName": "map", "TestFetcherFetchParameters": "indirect"}}]`,
+		"indirect":  `[{"include": {"TestFetcherName": "MAP", "TestFetcherFetchParameters": "loop"}}]`,
+	}
+	pr := NewPluginRegistry()
+	require.NoError(t, pr.RegisterTestFetcher("map", func() test.TestFetcher { return fetcher }))
+
+	var steps []*test.TestStepDescriptor
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"include": {"TestFetcherName": "map", "TestFetcherFetchParameters": "prologue"}},
+		{"name": "AStep", "label": "test"}
+	]`), &steps))
+	resolved, err := pr.ResolveIncludes(steps)
+	require.NoError(t, err)
+	var labels []string
+	for _, step := range resolved {
+		require.Nil(t, step.Include)
+		labels = append(labels, step.Label)
+	}
+	require.Equal(t, []string{"power_on", "provision", "test"}, labels)
+
+	_, err = pr.ResolveIncludes([]*test.TestStepDescriptor{
+		{Include: &test.IncludeDescriptor{TestFetcherName: "map", TestFetcherFetchParameters: json.RawMessage(`"loop"`)}},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cycle")
+
+	_, err = pr.ResolveIncludes([]*test.TestStepDescriptor{
+		{Label: "label", Include: &test.IncludeDescriptor{TestFetcherName: "map", TestFetcherFetchParameters: json.RawMessage(`"provision"`)}},
+	})
+	require.Error(t, err)
+}
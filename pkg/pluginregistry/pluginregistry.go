@@ -7,8 +7,10 @@ package pluginregistry
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/facebookincubator/contest/pkg/event"
 	"github.com/facebookincubator/contest/pkg/job"
@@ -40,6 +42,13 @@ type PluginRegistry struct {
 
 	// Reporters collects a mapping of Plugin Name <-> Reporter constructor
 	Reporters map[string]job.ReporterFactory
+
+	// Lockers collects a mapping of Plugin Name <-> Locker constructor
+	Lockers map[string]target.LockerFactory
+
+	// schemas collects the compiled schemas of the parameters published by
+	// the plugins, see ParametersSchemas
+	schemas map[schemaKey]map[string]parametersSchema
 }
 
 // NewPluginRegistry constructs a new empty plugin registry
@@ -50,10 +59,14 @@ func NewPluginRegistry() *PluginRegistry {
 	pr.TestSteps = make(map[string]test.TestStepFactory)
 	pr.TestStepsEvents = make(map[string]map[event.Name]bool)
 	pr.Reporters = make(map[string]job.ReporterFactory)
+	pr.Lockers = make(map[string]target.LockerFactory)
+	pr.schemas = make(map[schemaKey]map[string]parametersSchema)
 	return &pr
 }
 
-// RegisterTargetManager register a factory for TargetManager plugins
+// RegisterTargetManager register a factory for TargetManager plugins. The
+// plugin must be built against a supported version of the plugin API, and the
+// schemas of the parameters it publishes, if any, must be valid.
 func (r *PluginRegistry) RegisterTargetManager(pluginName string, tmf target.TargetManagerFactory) error {
 	pluginName = strings.ToLower(pluginName)
 	r.lock.Lock()
@@ -62,11 +75,22 @@ func (r *PluginRegistry) RegisterTargetManager(pluginName string, tmf target.Tar
 	if _, found := r.TargetManagers[pluginName]; found {
 		return fmt.Errorf("TargetManager %s already registered", pluginName)
 	}
+	tm := tmf()
+	if err := checkPluginAPIVersion(tm); err != nil {
+		return fmt.Errorf("could not register TargetManager %s: %w", pluginName, err)
+	}
+	schemas, err := compileSchemas(targetManagerSchemas(tm))
+	if err != nil {
+		return fmt.Errorf("could not register TargetManager %s: %v", pluginName, err)
+	}
 	r.TargetManagers[pluginName] = tmf
+	r.schemas[schemaKey{kind: KindTargetManager, name: pluginName}] = schemas
 	return nil
 }
 
-// RegisterTestFetcher registers a TestFetcher within the registry
+// RegisterTestFetcher registers a TestFetcher within the registry. The plugin
+// must be built against a supported version of the plugin API, and the schema
+// of the parameters it publishes, if any, must be valid.
 func (r *PluginRegistry) RegisterTestFetcher(pluginName string, tff test.TestFetcherFactory) error {
 	pluginName = strings.ToLower(pluginName)
 	r.lock.Lock()
@@ -75,11 +99,22 @@ func (r *PluginRegistry) RegisterTestFetcher(pluginName string, tff test.TestFet
 	if _, found := r.TestFetchers[pluginName]; found {
 		return fmt.Errorf("TestFetcher %s already registered", pluginName)
 	}
+	tf := tff()
+	if err := checkPluginAPIVersion(tf); err != nil {
+		return fmt.Errorf("could not register TestFetcher %s: %w", pluginName, err)
+	}
+	schemas, err := compileSchemas(testFetcherSchemas(tf))
+	if err != nil {
+		return fmt.Errorf("could not register TestFetcher %s: %v", pluginName, err)
+	}
 	r.TestFetchers[pluginName] = tff
+	r.schemas[schemaKey{kind: KindTestFetcher, name: pluginName}] = schemas
 	return nil
 }
 
-// RegisterTestStep registers a TestStep within the registry and the associated events
+// RegisterTestStep registers a TestStep within the registry and the associated events.
+// The plugin must be built against a supported version of the plugin API, and
+// the schema of the parameters it publishes, if any, must be valid.
 func (r *PluginRegistry) RegisterTestStep(pluginName string, tsf test.TestStepFactory, stepEvents []event.Name) error {
 	pluginName = strings.ToLower(pluginName)
 	r.lock.Lock()
@@ -88,7 +123,16 @@ func (r *PluginRegistry) RegisterTestStep(pluginName string, tsf test.TestStepFa
 	if _, found := r.TestSteps[pluginName]; found {
 		return fmt.Errorf("TestSteps %s already registered", pluginName)
 	}
+	ts := tsf()
+	if err := checkPluginAPIVersion(ts); err != nil {
+		return fmt.Errorf("could not register TestStep %s: %w", pluginName, err)
+	}
+	schemas, err := compileSchemas(testStepSchemas(ts))
+	if err != nil {
+		return fmt.Errorf("could not register TestStep %s: %v", pluginName, err)
+	}
 	r.TestSteps[pluginName] = tsf
+	r.schemas[schemaKey{kind: KindTestStep, name: pluginName}] = schemas
 
 	// Verify that all the events the test step is associated with validate correctly
 	mapEvents := make(map[event.Name]bool)
@@ -103,7 +147,9 @@ func (r *PluginRegistry) RegisterTestStep(pluginName string, tsf test.TestStepFa
 	return nil
 }
 
-// RegisterReporter registers a Reporter within the registry
+// RegisterReporter registers a Reporter within the registry. The plugin must
+// be built against a supported version of the plugin API, and the schemas of
+// the parameters it publishes, if any, must be valid.
 func (r *PluginRegistry) RegisterReporter(pluginName string, rf job.ReporterFactory) error {
 	pluginName = strings.ToLower(pluginName)
 	r.lock.Lock()
@@ -112,7 +158,29 @@ func (r *PluginRegistry) RegisterReporter(pluginName string, rf job.ReporterFact
 	if _, found := r.Reporters[pluginName]; found {
 		return fmt.Errorf("Reporter %s already registered", pluginName)
 	}
+	rep := rf()
+	if err := checkPluginAPIVersion(rep); err != nil {
+		return fmt.Errorf("could not register Reporter %s: %w", pluginName, err)
+	}
+	schemas, err := compileSchemas(reporterSchemas(rep))
+	if err != nil {
+		return fmt.Errorf("could not register Reporter %s: %v", pluginName, err)
+	}
 	r.Reporters[pluginName] = rf
+	r.schemas[schemaKey{kind: KindReporter, name: pluginName}] = schemas
+	return nil
+}
+
+// RegisterLocker registers a Locker within the registry
+func (r *PluginRegistry) RegisterLocker(pluginName string, lf target.LockerFactory) error {
+	pluginName = strings.ToLower(pluginName)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	log.Infof("Registering locker %s", pluginName)
+	if _, found := r.Lockers[pluginName]; found {
+		return fmt.Errorf("Locker %s already registered", pluginName)
+	}
+	r.Lockers[pluginName] = lf
 	return nil
 }
 
@@ -201,3 +269,57 @@ func (r *PluginRegistry) NewReporter(pluginName string) (job.Reporter, error) {
 	reporter := reporterFactory()
 	return reporter, nil
 }
+
+// NewLocker returns a new instance of a Locker from its corresponding name. The
+// Locker must be built against a supported version of the plugin API.
+func (r *PluginRegistry) NewLocker(pluginName string, lockTimeout, refreshTimeout time.Duration) (target.Locker, error) {
+	pluginName = strings.ToLower(pluginName)
+	r.lock.RLock()
+	lockerFactory, found := r.Lockers[pluginName]
+	r.lock.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("Locker %s is not registered", pluginName)
+	}
+	locker := lockerFactory(lockTimeout, refreshTimeout)
+	// lockers may connect to their backend when created, hence their version
+	// is only checked here rather than at registration
+	if err := checkPluginAPIVersion(locker); err != nil {
+		return nil, fmt.Errorf("could not create Locker %s: %w", pluginName, err)
+	}
+	return locker, nil
+}
+
+// PluginNames lists the names of the registered plugins of each kind.
+type PluginNames struct {
+	TargetManagers []string
+	TestFetchers   []string
+	TestSteps      []string
+	Reporters      []string
+	Lockers        []string
+}
+
+// Names returns the sorted names of the registered plugins.
+func (r *PluginRegistry) Names() PluginNames {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var names PluginNames
+	for name := range r.TargetManagers {
+		names.TargetManagers = append(names.TargetManagers, name)
+	}
+	for name := range r.TestFetchers {
+		names.TestFetchers = append(names.TestFetchers, name)
+	}
+	for name := range r.TestSteps {
+		names.TestSteps = append(names.TestSteps, name)
+	}
+	for name := range r.Reporters {
+		names.Reporters = append(names.Reporters, name)
+	}
+	for name := range r.Lockers {
+		names.Lockers = append(names.Lockers, name)
+	}
+	for _, kind := range [][]string{names.TargetManagers, names.TestFetchers, names.TestSteps, names.Reporters, names.Lockers} {
+		sort.Strings(kind)
+	}
+	return names
+}
@@ -6,11 +6,16 @@
 package pluginregistry
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/facebookincubator/contest/pkg/cerrors"
 	"github.com/facebookincubator/contest/pkg/event"
 	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/target"
 	"github.com/facebookincubator/contest/pkg/test"
 
 	"github.com/stretchr/testify/require"
@@ -37,7 +42,7 @@ func (e AStep) Name() string {
 }
 
 // Run executes the AStep
-func (e AStep) Run(cancel, pause <-chan struct{}, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
+func (e AStep) Run(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
 	return nil
 }
 
@@ -47,10 +52,45 @@ func (e AStep) CanResume() bool {
 }
 
 // Resume tries to resume AStep
-func (e AStep) Resume(cancel, pause <-chan struct{}, _ test.TestStepChannels, _ test.TestStepParameters, ev testevent.EmitterFetcher) error {
+func (e AStep) Resume(ctx context.Context, _ test.TestStepChannels, _ test.TestStepParameters, ev testevent.EmitterFetcher) error {
 	return &cerrors.ErrResumeNotSupported{StepName: "AStep"}
 }
 
+// SchemaStep is an AStep which publishes the schema of its parameters
+type SchemaStep struct {
+	AStep
+	schema json.RawMessage
+}
+
+// ParametersSchema returns the schema of the parameters of the SchemaStep
+func (e SchemaStep) ParametersSchema() json.RawMessage {
+	return e.schema
+}
+
+func newSchemaStepFactory(schema string) test.TestStepFactory {
+	return func() test.TestStep {
+		return &SchemaStep{schema: json.RawMessage(schema)}
+	}
+}
+
+// VersionedStep is an AStep which declares the version of the plugin API it
+// was built against
+type VersionedStep struct {
+	AStep
+	version int
+}
+
+// PluginAPIVersion returns the version of the plugin API of the VersionedStep
+func (e VersionedStep) PluginAPIVersion() int {
+	return e.version
+}
+
+func newVersionedStepFactory(version int) test.TestStepFactory {
+	return func() test.TestStep {
+		return &VersionedStep{version: version}
+	}
+}
+
 func TestRegisterTestStep(t *testing.T) {
 	pr := NewPluginRegistry()
 	err := pr.RegisterTestStep("AStep", NewAStep, []event.Name{event.Name("AStepEventName")})
@@ -62,3 +102,72 @@ func TestRegisterTestStepDoesNotValidate(t *testing.T) {
 	err := pr.RegisterTestStep("AStep", NewAStep, []event.Name{event.Name("Event which does not validate")})
 	require.Error(t, err)
 }
+
+func TestNames(t *testing.T) {
+	pr := NewPluginRegistry()
+	require.NoError(t, pr.RegisterTestStep("BStep", NewAStep, nil))
+	require.NoError(t, pr.RegisterTestStep("AStep", NewAStep, []event.Name{event.Name("AStepEventName")}))
+	require.NoError(t, pr.RegisterLocker("ALocker", func(time.Duration, time.Duration) target.Locker { return nil }))
+	require.Error(t, pr.RegisterLocker("alocker", nil))
+
+	names := pr.Names()
+	require.Equal(t, []string{"astep", "bstep"}, names.TestSteps)
+	require.Equal(t, []string{"alocker"}, names.Lockers)
+	require.Empty(t, names.Reporters)
+
+	_, err := pr.NewLocker("ALocker", time.Second, time.Second)
+	require.NoError(t, err)
+	_, err = pr.NewLocker("BLocker", time.Second, time.Second)
+	require.Error(t, err)
+}
+
+func TestRegisterTestStepInvalidSchema(t *testing.T) {
+	pr := NewPluginRegistry()
+	err := pr.RegisterTestStep("SchemaStep", newSchemaStepFactory(`{"type": "nothing"}`), nil)
+	require.Error(t, err)
+	require.Empty(t, pr.Names().TestSteps)
+}
+
+func TestParametersSchemas(t *testing.T) {
+	schema := `{"type": "object", "properties": {"text": {"type": "array", "items": {"type": "string"}}}, "required": ["text"]}`
+	pr := NewPluginRegistry()
+	require.NoError(t, pr.RegisterTestStep("SchemaStep", newSchemaStepFactory(schema), nil))
+	require.NoError(t, pr.RegisterTestStep("AStep", NewAStep, nil))
+
+	require.Equal(t, map[string]json.RawMessage{ParametersStep: json.RawMessage(schema)}, pr.ParametersSchemas(KindTestStep, "schemastep"))
+	require.Nil(t, pr.ParametersSchemas(KindTestStep, "AStep"))
+	require.Nil(t, pr.ParametersSchemas(KindReporter, "SchemaStep"))
+
+	descriptor := test.TestStepDescriptor{
+		Name:       "SchemaStep",
+		Label:      "label",
+		Parameters: test.TestStepParameters{"text": []test.Param{*test.NewParam(`"hello"`)}},
+	}
+	_, err := pr.NewTestStepBundle(descriptor, 0, nil)
+	require.NoError(t, err)
+
+	descriptor.Parameters = test.TestStepParameters{"text": []test.Param{*test.NewParam(`{"not": "a string"}`)}}
+	_, err = pr.NewTestStepBundle(descriptor, 0, nil)
+	require.EqualError(t, err, "could not validate parameters for test step SchemaStep: /text/0: expected string, got object")
+
+	descriptor.Parameters = nil
+	_, err = pr.NewTestStepBundle(descriptor, 0, nil)
+	require.EqualError(t, err, "could not validate parameters for test step SchemaStep: /: missing required property 'text'")
+
+	// steps without a schema are only validated by the step itself
+	descriptor.Name = "AStep"
+	_, err = pr.NewTestStepBundle(descriptor, 0, nil)
+	require.NoError(t, err)
+}
+
+func TestRegisterIncompatibleAPIVersion(t *testing.T) {
+	pr := NewPluginRegistry()
+	require.NoError(t, pr.RegisterTestStep("Current", newVersionedStepFactory(APIVersion), nil))
+	for _, version := range []int{MinAPIVersion - 1, APIVersion + 1} {
+		err := pr.RegisterTestStep("Incompatible", newVersionedStepFactory(version), nil)
+		var versionErr ErrIncompatibleAPIVersion
+		require.True(t, errors.As(err, &versionErr), "%v", err)
+		require.Equal(t, version, versionErr.Version)
+	}
+	require.Equal(t, []string{"current"}, pr.Names().TestSteps)
+}
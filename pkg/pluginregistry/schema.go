@@ -0,0 +1,145 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package pluginregistry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/lib/jsonschema"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+)
+
+// Kinds of plugins which may publish parameters schemas, see
+// ParametersSchemas.
+const (
+	KindTargetManager = "targetmanager"
+	KindTestFetcher   = "testfetcher"
+	KindTestStep      = "teststep"
+	KindReporter      = "reporter"
+)
+
+// Parameters described by the schemas of each kind of plugins, see
+// ParametersSchemas.
+const (
+	// ParametersStep are the parameters of a test step
+	ParametersStep = "parameters"
+	// ParametersFetch are the fetch parameters of a test fetcher
+	ParametersFetch = "fetch"
+	// ParametersAcquire and ParametersRelease are the acquire and release
+	// parameters of a target manager
+	ParametersAcquire = "acquire"
+	ParametersRelease = "release"
+	// ParametersRun and ParametersFinal are the run and final parameters of
+	// a reporter
+	ParametersRun   = "run"
+	ParametersFinal = "final"
+)
+
+// schemaKey identifies a plugin in the schemas registry.
+type schemaKey struct {
+	kind string
+	name string
+}
+
+// parametersSchema is a schema published by a plugin, as published and
+// compiled.
+type parametersSchema struct {
+	raw    json.RawMessage
+	schema *jsonschema.Schema
+}
+
+// compileSchemas compiles the schemas published by a plugin. The parameters
+// whose schema is nil are not described.
+func compileSchemas(schemas map[string]json.RawMessage) (map[string]parametersSchema, error) {
+	compiled := make(map[string]parametersSchema)
+	for params, raw := range schemas {
+		if raw == nil {
+			continue
+		}
+		s, err := jsonschema.Compile(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema of %s parameters: %v", params, err)
+		}
+		compiled[params] = parametersSchema{raw: raw, schema: s}
+	}
+	return compiled, nil
+}
+
+func targetManagerSchemas(tm target.TargetManager) map[string]json.RawMessage {
+	s, ok := tm.(target.TargetManagerWithSchema)
+	if !ok {
+		return nil
+	}
+	return map[string]json.RawMessage{
+		ParametersAcquire: s.AcquireParametersSchema(),
+		ParametersRelease: s.ReleaseParametersSchema(),
+	}
+}
+
+func testFetcherSchemas(tf test.TestFetcher) map[string]json.RawMessage {
+	s, ok := tf.(test.TestFetcherWithSchema)
+	if !ok {
+		return nil
+	}
+	return map[string]json.RawMessage{ParametersFetch: s.FetchParametersSchema()}
+}
+
+func testStepSchemas(ts test.TestStep) map[string]json.RawMessage {
+	s, ok := ts.(test.TestStepWithSchema)
+	if !ok {
+		return nil
+	}
+	return map[string]json.RawMessage{ParametersStep: s.ParametersSchema()}
+}
+
+func reporterSchemas(rep job.Reporter) map[string]json.RawMessage {
+	s, ok := rep.(job.ReporterWithSchema)
+	if !ok {
+		return nil
+	}
+	return map[string]json.RawMessage{
+		ParametersRun:   s.RunParametersSchema(),
+		ParametersFinal: s.FinalParametersSchema(),
+	}
+}
+
+// ParametersSchemas returns the schemas published by a plugin of the given
+// kind, keyed by the parameters they describe, or nil if the plugin does not
+// publish any.
+func (r *PluginRegistry) ParametersSchemas(kind, pluginName string) map[string]json.RawMessage {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	schemas := r.schemas[schemaKey{kind: kind, name: strings.ToLower(pluginName)}]
+	if len(schemas) == 0 {
+		return nil
+	}
+	raw := make(map[string]json.RawMessage, len(schemas))
+	for params, s := range schemas {
+		raw[params] = s.raw
+	}
+	return raw
+}
+
+// validateSchema validates parameters of a plugin against the schema the
+// plugin published for them, if any. Missing parameters are validated as an
+// empty object.
+func (r *PluginRegistry) validateSchema(kind, pluginName, params string, data []byte) error {
+	r.lock.RLock()
+	s, found := r.schemas[schemaKey{kind: kind, name: strings.ToLower(pluginName)}][params]
+	r.lock.RUnlock()
+	if !found {
+		return nil
+	}
+	if data = bytes.TrimSpace(data); len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		data = []byte("{}")
+	}
+	return s.schema.Validate(data)
+}
@@ -0,0 +1,42 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package pluginregistry
+
+// APIVersion is the version of the plugin API, i.e. of the interfaces which
+// plugins implement and of the way the framework calls them. It is increased
+// whenever they change. MinAPIVersion is the oldest version which plugins may
+// still be built against: it is raised when a change breaks the plugins built
+// against older versions, e.g. when a method is added to an interface.
+const (
+	APIVersion    = 1
+	MinAPIVersion = 1
+)
+
+// VersionedPlugin is implemented by plugins which declare the version of the
+// plugin API they were built against, e.g. the plugins of external binaries.
+// Plugins which do not implement it are built along with the framework, hence
+// against APIVersion.
+type VersionedPlugin interface {
+	PluginAPIVersion() int
+}
+
+// CheckAPIVersion returns ErrIncompatibleAPIVersion if plugins built against
+// the given version of the plugin API are not supported.
+func CheckAPIVersion(version int) error {
+	if version < MinAPIVersion || version > APIVersion {
+		return ErrIncompatibleAPIVersion{Version: version}
+	}
+	return nil
+}
+
+// checkPluginAPIVersion checks the version of the plugin API which a plugin
+// was built against, if it declares it.
+func checkPluginAPIVersion(plugin interface{}) error {
+	if v, ok := plugin.(VersionedPlugin); ok {
+		return CheckAPIVersion(v.PluginAPIVersion())
+	}
+	return nil
+}
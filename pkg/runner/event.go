@@ -18,5 +18,45 @@ type RunStartedPayload struct {
 // EventRunStarted indicates that a run has begun
 var EventRunStarted = event.Name("RunStarted")
 
+// TestStepPanickedPayload represents the payload carried by a TestStepPanicked event
+type TestStepPanickedPayload struct {
+	RunID         types.RunID
+	TestName      string
+	TestStepLabel string
+	Panic         string
+	Stack         string
+}
+
+// EventTestStepPanicked indicates that a test step panicked, and that the
+// panic was recovered by the framework
+var EventTestStepPanicked = event.Name("TestStepPanicked")
+
+// StepTimeoutPayload represents the payload carried by a StepTimeout event
+type StepTimeoutPayload struct {
+	RunID         types.RunID
+	TestName      string
+	TestStepLabel string
+	Timeout       string
+	// Targets are the names of the targets that the step had not returned
+	// when the timeout expired
+	Targets []string
+}
+
+// EventStepTimeout indicates that a test step did not complete within its
+// timeout, and that it was abandoned
+var EventStepTimeout = event.Name("StepTimeout")
+
+// TestAbortedPayload represents the payload carried by a TestAborted event
+type TestAbortedPayload struct {
+	RunID         types.RunID
+	TestName      string
+	FailedTargets int
+	TotalTargets  int
+}
+
+// EventTestAborted indicates that a test was aborted early because the number
+// of failed targets exceeded the abort threshold of the job
+var EventTestAborted = event.Name("TestAborted")
+
 // EventTestError indicates that a test failed.
 var EventTestError = event.Name("TestError")
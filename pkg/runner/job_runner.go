@@ -19,6 +19,8 @@ import (
 	"github.com/facebookincubator/contest/pkg/logging"
 	"github.com/facebookincubator/contest/pkg/storage"
 	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+	"github.com/facebookincubator/contest/pkg/tracing"
 	"github.com/facebookincubator/contest/pkg/types"
 )
 
@@ -35,6 +37,36 @@ type JobRunner struct {
 	frameworkEventManager frameworkevent.EmitterFetcher
 	// testEvManager is used by the JobRunner to emit test events
 	testEvManager testevent.Fetcher
+	// targetResultManager is used by the JobRunner to fetch target results
+	targetResultManager storage.TargetResultManager
+	// preempt frees the targets locked by other jobs, if set
+	preempt PreemptFunc
+	// reserve reserves the targets of the jobs, if set
+	reserve ReserveFunc
+}
+
+// PreemptFunc frees the targets which other jobs locked, so that a job can
+// lock them, e.g. by pausing jobs of lower priority and transferring their
+// locks to the job. It returns an error if the targets cannot be freed.
+type PreemptFunc func(j *job.Job, targets []*target.Target) error
+
+// SetPreemptFunc makes the jobs which cannot lock their targets, either while
+// target managers acquire them or afterwards, call preempt and try again once
+// it returned, instead of failing at once.
+func (jr *JobRunner) SetPreemptFunc(preempt PreemptFunc) {
+	jr.preempt = preempt
+}
+
+// ReserveFunc reserves the targets which a job locked for a test, e.g.
+// against a quota, and returns a function giving them back once the job no
+// longer holds them. It returns an error if the targets cannot be reserved.
+type ReserveFunc func(j *job.Job, targets []*target.Target) (func(), error)
+
+// SetReserveFunc makes the jobs reserve the targets they locked with reserve
+// before running a test on them. The jobs whose targets cannot be reserved
+// unlock them, and fail.
+func (jr *JobRunner) SetReserveFunc(reserve ReserveFunc) {
+	jr.reserve = reserve
 }
 
 // GetTargets returns a list of acquired targets for JobID
@@ -56,13 +88,28 @@ func (jr *JobRunner) GetTargets(jobID types.JobID) []*target.Target {
 //                   last
 // * []job.Report:   all the final reports
 // * error:          an error, if any
+//
+// The job is traced by a span, parent of the spans of its tests.
 func (jr *JobRunner) Run(j *job.Job) ([][]*job.Report, []*job.Report, error) {
+	span := tracing.Start(nil, "job",
+		tracing.Attr("job.id", j.ID),
+		tracing.Attr("job.name", j.Name),
+		tracing.Attr("job.runs", j.Runs),
+	).Bind(tracing.Key{JobID: j.ID})
+	runReports, finalReports, err := jr.run(j)
+	span.SetAttributes(tracing.Attr("job.cancelled", j.IsCancelled()))
+	span.End(err)
+	return runReports, finalReports, err
+}
+
+func (jr *JobRunner) run(j *job.Job) ([][]*job.Report, []*job.Report, error) {
+	log := logging.AddField(jobLog, logging.FieldJobID, j.ID)
 	var run uint
 
 	if j.Runs == 0 {
-		jobLog.Infof("Running job '%s' (id %v) indefinitely", j.Name, j.ID)
+		log.Infof("Running job '%s' (id %v) indefinitely", j.Name, j.ID)
 	} else {
-		jobLog.Infof("Running job '%s' %d times", j.Name, j.Runs)
+		log.Infof("Running job '%s' %d times", j.Name, j.Runs)
 	}
 	tl := target.GetLocker()
 	ev := storage.NewTestEventFetcher()
@@ -71,9 +118,18 @@ func (jr *JobRunner) Run(j *job.Job) ([][]*job.Report, []*job.Report, error) {
 		runReports      []*job.Report
 		allRunReports   [][]*job.Report
 		allFinalReports []*job.Report
-		runErr          error
 	)
 
+	// a resumed job runs again the run which was interrupted, and only
+	// reports the runs which completed before
+	if j.ResumeRunID > 1 {
+		log.Infof("Resuming job %d from run #%d", j.ID, j.ResumeRunID)
+		for run = 1; run < uint(j.ResumeRunID); run++ {
+			allRunReports = append(allRunReports, jr.runReports(j, types.RunID(run), ev))
+		}
+		run = uint(j.ResumeRunID) - 1
+	}
+
 	for {
 		if j.Runs != 0 && run == j.Runs {
 			break
@@ -84,183 +140,31 @@ func (jr *JobRunner) Run(j *job.Job) ([][]*job.Report, []*job.Report, error) {
 		payload := RunStartedPayload{RunID: types.RunID(run + 1)}
 		err := jr.emitEvent(j.ID, EventRunStarted, payload)
 		if err != nil {
-			jobLog.Warningf("Could not emit event run (run %d) start for job %d: %v", run+1, j.ID, err)
+			log.Warningf("Could not emit event run (run %d) start for job %d: %v", run+1, j.ID, err)
 		}
+		jr.targetLock.Lock()
+		jr.targetMap[j.ID] = nil
+		jr.targetLock.Unlock()
 
-		for idx, t := range j.Tests {
-			if j.IsCancelled() {
-				jobLog.Debugf("Cancellation requested, skipping test #%d of run #%d", idx, run+1)
-				break
-			}
-			jobLog.Infof("Run #%d: fetching targets for test '%s'", run+1, t.Name)
-			bundle := t.TargetManagerBundle
-			var (
-				targets   []*target.Target
-				targetsCh = make(chan []*target.Target, 1)
-				errCh     = make(chan error, 1)
-			)
-			go func() {
-				// the Acquire semantic is synchronous, so that the implementation
-				// is simpler on the user's side. We run it in a goroutine in
-				// order to use a timeout for target acquisition.
-				targets, err := bundle.TargetManager.Acquire(j.ID, j.CancelCh, bundle.AcquireParameters, tl)
-				if err != nil {
-					errCh <- err
-					targetsCh <- nil
-					return
-				}
-				// Lock all the targets returned by Acquire.
-				// Targets can also be locked in the `Acquire` method, for
-				// example to allow dynamic acquisition.
-				// We lock them again to ensure that all the acquired
-				// targets are locked before running the job.
-				// Locking an already-locked target (by the same owner)
-				// extends the locking deadline.
-				if err := tl.Lock(j.ID, targets); err != nil {
-					errCh <- fmt.Errorf("Target locking failed: %w", err)
-					targetsCh <- nil
-				}
-				errCh <- nil
-				targetsCh <- targets
-			}()
-			// wait for targets up to a certain amount of time
-			select {
-			case err := <-errCh:
-				targets = <-targetsCh
-				if err != nil {
-					err = fmt.Errorf("run #%d: cannot fetch targets for test '%s': %v", run+1, t.Name, err)
-					jobLog.Errorf(err.Error())
-					return nil, nil, err
-				}
-				// Associate the targets with the job for later retrievel
-				jr.targetLock.Lock()
-				jr.targetMap[j.ID] = targets
-				jr.targetLock.Unlock()
-
-			case <-time.After(config.TargetManagerTimeout):
-				return nil, nil, fmt.Errorf("target manager acquire timed out after %s", config.TargetManagerTimeout)
-			case <-j.CancelCh:
-				jobLog.Infof("cancellation requested for job ID %v", j.ID)
-				return nil, nil, nil
-			}
-
-			// refresh the target locks periodically, by extending their
-			// expiration time. If the job is cancelled, the locks are released.
-			// If the job is paused (e.g. because we are migrating the ConTest
-			// instance or upgrading it), the locks are not released, because we
-			// may want to resume once the new ConTest instance starts.
-			done := make(chan struct{})
-			go func(j *job.Job, tl target.Locker, targets []*target.Target, refreshInterval time.Duration) {
-				for {
-					select {
-					case <-j.CancelCh:
-						// unlock targets
-						if err := tl.Unlock(j.ID, targets); err != nil {
-							jobLog.Warningf("Failed to unlock targets (%v) for job ID %d: %v", targets, j.ID, err)
-						}
-						return
-					case <-j.PauseCh:
-						// do not unlock targets, we can resume later, or let
-						// them expire
-						jobLog.Debugf("Received pause request, NOT releasing targets so the job can be resumed")
-						return
-					case <-done:
-						if err := tl.Unlock(j.ID, targets); err != nil {
-							jobLog.Warningf("Failed to unlock %d target(s) (%v): %v", len(targets), targets, err)
-						}
-						jobLog.Infof("Unlocked %d target(s) for job ID %d", len(targets), j.ID)
-						return
-					case <-time.After(refreshInterval):
-						// refresh the locks before the timeout expires
-						if err := tl.RefreshLocks(j.ID, targets); err != nil {
-							jobLog.Warningf("Failed to refresh %d locks for job ID %d: %v", len(targets), j.ID, err)
-						}
-					}
-				}
-				// refresh locks a bit faster than locking timeout to avoid races
-			}(j, tl, targets, config.LockRefreshTimeout/10*9)
-
-			// Emit events tracking targets acquisition
-			header := testevent.Header{JobID: j.ID, RunID: types.RunID(run + 1), TestName: t.Name}
-			testEventEmitter := storage.NewTestEventEmitter(header)
-
-			if runErr = jr.emitAcquiredTargets(testEventEmitter, targets); runErr == nil {
-				jobLog.Infof("Run #%d: running test #%d for job '%s' (job ID: %d) on %d targets", run+1, idx, j.Name, j.ID, len(targets))
-				testRunner := NewTestRunner()
-				runErr = testRunner.Run(j.CancelCh, j.PauseCh, t, targets, j.ID, types.RunID(run+1))
-			}
-
-			// Job is done, release all the targets
-			go func() {
-				// the Release semantic is synchronous, so that the implementation
-				// is simpler on the user's side. We run it in a goroutine in
-				// order to use a timeout for target acquisition. If Release fails, whether
-				// due to an error or for a timeout, the whole Job is considered failed
-				errCh <- bundle.TargetManager.Release(j.ID, j.CancelCh, bundle.ReleaseParameters)
-				// signal that we are done to the goroutine that refreshes the
-				// locks.
-				done <- struct{}{}
-			}()
-			select {
-			case err := <-errCh:
-				if err != nil {
-					errRelease := fmt.Sprintf("Failed to release targets: %v", err)
-					jobLog.Errorf(errRelease)
-					return nil, nil, fmt.Errorf(errRelease)
-				}
-			case <-time.After(config.TargetManagerTimeout):
-				return nil, nil, fmt.Errorf("target manager release timed out after %s", config.TargetManagerTimeout)
-			case <-j.CancelCh:
-				jobLog.Infof("cancellation requested for job ID %v", j.ID)
-				return nil, nil, nil
-			}
-			// return the Run error only after releasing the targets, and only
-			// if we are not running indefinitely. An error returned by the TestRunner
-			// is considered a fatal condition and will cause the termination of the
-			// whole job.
-			if runErr != nil {
-				return nil, nil, runErr
-			}
+		cancelled, err := jr.runTests(j, types.RunID(run+1), tl)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cancelled {
+			return nil, nil, nil
 		}
 
 		// Calculate results for this run via the registered run reporters reporters
-		runCoordinates := job.RunCoordinates{JobID: j.ID, RunID: types.RunID(run + 1)}
-
-		runReports = make([]*job.Report, 0, len(j.RunReporterBundles))
-		for _, bundle := range j.RunReporterBundles {
-			runStatus, err := jr.BuildRunStatus(runCoordinates, j)
-			if err != nil {
-				jobLog.Warningf("could not build run status for job %d: %v. Run report will not execute", j.ID, err)
-				continue
-			}
-			success, data, err := bundle.Reporter.RunReport(j.CancelCh, bundle.Parameters, runStatus, ev)
-			if err != nil {
-				jobLog.Warningf("Run reporter failed while calculating run results, proceeding anyway: %v", err)
-			} else {
-				if success {
-					jobLog.Printf("Run #%d of job %d considered successful according to %s", run+1, j.ID, bundle.Reporter.Name())
-				} else {
-					jobLog.Errorf("Run #%d of job %d considered failed according to %s", run+1, j.ID, bundle.Reporter.Name())
-				}
-			}
-
-			// TODO run report must be sent to the storage layer as soon as it's
-			//      ready, not at the end of the job. This requires a change in
-			//      how we store and expose reports, because this will require
-			//      one DB entry per run report rather than one for all of them.
-			r := job.Report{Success: success, Data: data, ReporterName: bundle.Reporter.Name(), ReportTime: time.Now()}
-			runReports = append(runReports, &r)
-
-		}
+		runReports = jr.runReports(j, types.RunID(run+1), ev)
 		allRunReports = append(allRunReports, runReports)
 
 		if j.IsCancelled() {
-			jobLog.Debugf("Cancellation requested, skipping run #%d", run+1)
+			log.Debugf("Cancellation requested, skipping run #%d", run+1)
 			break
 		}
 		// don't sleep on the last run
 		if j.Runs == 0 || (j.Runs > 1 && run < j.Runs-1) {
-			jobLog.Infof("Sleeping %s before the next run...", j.RunInterval)
+			log.Infof("Sleeping %s before the next run...", j.RunInterval)
 			time.Sleep(j.RunInterval)
 		}
 		run++
@@ -277,27 +181,412 @@ func (jr *JobRunner) Run(j *job.Job) ([][]*job.Report, []*job.Report, error) {
 		// execution early and we did not perform all runs
 		runStatuses, err := jr.BuildRunStatuses(j)
 		if err != nil {
-			jobLog.Warningf("could not calculate run statuses: %v. Run report will not execute", err)
+			log.Warningf("could not calculate run statuses: %v. Run report will not execute", err)
 			continue
 		}
 
 		success, data, err := bundle.Reporter.FinalReport(j.CancelCh, bundle.Parameters, runStatuses, ev)
 		if err != nil {
-			jobLog.Warningf("Final reporter failed while calculating test results, proceeding anyway: %v", err)
+			log.Warningf("Final reporter failed while calculating test results, proceeding anyway: %v", err)
 		} else {
 			if success {
-				jobLog.Printf("Job %d (%d runs out of %d desired) considered successful", j.ID, run, j.Runs)
+				log.Printf("Job %d (%d runs out of %d desired) considered successful", j.ID, run, j.Runs)
 			} else {
-				jobLog.Errorf("Job %d (%d runs out of %d desired) considered failed", j.ID, run, j.Runs)
+				log.Errorf("Job %d (%d runs out of %d desired) considered failed", j.ID, run, j.Runs)
 			}
 		}
-		r := job.Report{Success: success, ReporterName: bundle.Reporter.Name(), ReportTime: time.Now(), Data: data}
+		r := job.Report{SchemaVersion: job.ReportSchemaVersion, Success: success, ReporterName: bundle.Reporter.Name(), ReportTime: time.Now(), Data: data}
 		allFinalReports = append(allFinalReports, &r)
 	}
 
 	return allRunReports, allFinalReports, nil
 }
 
+// runReports calculates the results of a run via the run reporters of the job.
+func (jr *JobRunner) runReports(j *job.Job, runID types.RunID, ev testevent.Fetcher) []*job.Report {
+	log := logging.AddFields(jobLog, map[string]interface{}{
+		logging.FieldJobID: j.ID,
+		logging.FieldRunID: runID,
+	})
+	runCoordinates := job.RunCoordinates{JobID: j.ID, RunID: runID}
+
+	runReports := make([]*job.Report, 0, len(j.RunReporterBundles))
+	for _, bundle := range j.RunReporterBundles {
+		runStatus, err := jr.BuildRunStatus(runCoordinates, j)
+		if err != nil {
+			log.Warningf("could not build run status for job %d: %v. Run report will not execute", j.ID, err)
+			continue
+		}
+		success, data, err := bundle.Reporter.RunReport(j.CancelCh, bundle.Parameters, runStatus, ev)
+		if err != nil {
+			log.Warningf("Run reporter failed while calculating run results, proceeding anyway: %v", err)
+		} else {
+			if success {
+				log.Printf("Run #%d of job %d considered successful according to %s", runID, j.ID, bundle.Reporter.Name())
+			} else {
+				log.Errorf("Run #%d of job %d considered failed according to %s", runID, j.ID, bundle.Reporter.Name())
+			}
+		}
+
+		// TODO run report must be sent to the storage layer as soon as it's
+		//      ready, not at the end of the job. This requires a change in
+		//      how we store and expose reports, because this will require
+		//      one DB entry per run report rather than one for all of them.
+		r := job.Report{SchemaVersion: job.ReportSchemaVersion, Success: success, Data: data, ReporterName: bundle.Reporter.Name(), ReportTime: time.Now()}
+		runReports = append(runReports, &r)
+
+	}
+	return runReports
+}
+
+// runTests runs all the tests of a job for the given run. Tests run one after
+// the other, unless the job allows more than one test to run at the same
+// time, in which case up to MaxParallelTests tests run concurrently, each one
+// acquiring and releasing its own targets. No further test is started once a
+// test failed or the job was cancelled.
+//
+// It returns whether the job was cancelled, and the first error, if any.
+func (jr *JobRunner) runTests(j *job.Job, runID types.RunID, tl target.Locker) (bool, error) {
+	log := logging.AddFields(jobLog, map[string]interface{}{
+		logging.FieldJobID: j.ID,
+		logging.FieldRunID: runID,
+	})
+	if j.MaxParallelTests <= 1 {
+		for idx, t := range j.Tests {
+			if j.IsCancelled() {
+				log.Debugf("Cancellation requested, skipping test #%d of run #%d", idx, runID)
+				break
+			}
+			if cancelled, err := jr.runTest(j, t, idx, runID, tl); cancelled || err != nil {
+				return cancelled, err
+			}
+		}
+		return false, nil
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		firstErr  error
+		cancelled bool
+		slots     = make(chan struct{}, j.MaxParallelTests)
+	)
+	stopped := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil || cancelled
+	}
+	for idx, t := range j.Tests {
+		slots <- struct{}{}
+		if j.IsCancelled() {
+			log.Debugf("Cancellation requested, skipping test #%d of run #%d", idx, runID)
+			<-slots
+			break
+		}
+		if stopped() {
+			<-slots
+			break
+		}
+		wg.Add(1)
+		go func(idx int, t *test.Test) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			testCancelled, err := jr.runTest(j, t, idx, runID, tl)
+			mu.Lock()
+			defer mu.Unlock()
+			if testCancelled {
+				cancelled = true
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}(idx, t)
+	}
+	wg.Wait()
+	if cancelled {
+		return true, nil
+	}
+	return false, firstErr
+}
+
+// runTest acquires the targets for a test, runs the test on them and
+// releases them. It returns whether the job was cancelled, and an error if
+// the test could not complete. The test is traced by a span, parent of the
+// spans of its steps and of the operations on its targets.
+func (jr *JobRunner) runTest(j *job.Job, t *test.Test, idx int, runID types.RunID, tl target.Locker) (cancelled bool, err error) {
+	log := logging.AddFields(jobLog, map[string]interface{}{
+		logging.FieldJobID:    j.ID,
+		logging.FieldRunID:    runID,
+		logging.FieldTestName: t.Name,
+	})
+	key := tracing.Key{JobID: j.ID, RunID: runID, TestName: t.Name}
+	span := tracing.Start(tracing.Lookup(key), "test",
+		tracing.Attr("test.name", t.Name),
+		tracing.Attr("run.id", runID),
+	).Bind(key)
+	defer func() {
+		span.SetAttributes(tracing.Attr("job.cancelled", cancelled))
+		span.End(err)
+	}()
+	log.Infof("Run #%d: fetching targets for test '%s'", runID, t.Name)
+	bundle := t.TargetManagerBundle
+	var (
+		targets   []*target.Target
+		targetsCh = make(chan []*target.Target, 1)
+		errCh     = make(chan error, 1)
+		releaseCh = make(chan func(), 1)
+		release   = func() {}
+		runErr    error
+	)
+	go func() {
+		// the Acquire semantic is synchronous, so that the implementation
+		// is simpler on the user's side. We run it in a goroutine in
+		// order to use a timeout for target acquisition.
+		acquireLocker := jr.acquireLocker(j, tl, span)
+		acquireSpan := tracing.Start(span, "acquire targets")
+		acquireStart := time.Now()
+		targets, err := bundle.TargetManager.Acquire(j.ID, j.CancelCh, bundle.AcquireParameters, acquireLocker)
+		observeAcquire(bundle.TargetManagerName, acquireStart, err)
+		acquireSpan.SetAttributes(tracing.Attr("targets", len(targets)))
+		acquireSpan.End(err)
+		if err != nil {
+			errCh <- err
+			targetsCh <- nil
+			releaseCh <- nil
+			return
+		}
+		// Lock all the targets returned by Acquire.
+		// Targets can also be locked in the `Acquire` method, for
+		// example to allow dynamic acquisition.
+		// We lock them again to ensure that all the acquired
+		// targets are locked before running the job.
+		// Locking an already-locked target (by the same owner)
+		// extends the locking deadline.
+		if err := acquireLocker.Lock(j.ID, targets); err != nil {
+			errCh <- fmt.Errorf("Target locking failed: %w", err)
+			targetsCh <- nil
+			releaseCh <- nil
+			return
+		}
+		// a job restricted to some of the targets frees the other ones
+		if len(j.TargetIDs) > 0 {
+			var others []*target.Target
+			targets, others = selectTargets(targets, j.TargetIDs)
+			if len(others) > 0 {
+				log.Infof("Run #%d: test '%s' runs on %d of %d targets", runID, t.Name, len(targets), len(targets)+len(others))
+				if err := tl.Unlock(j.ID, others); err != nil {
+					log.Warningf("Failed to unlock %d target(s) (%v): %v", len(others), others, err)
+				}
+			}
+		}
+		var reserved func()
+		if jr.reserve != nil {
+			if reserved, err = jr.reserve(j, targets); err != nil {
+				if errUnlock := tl.Unlock(j.ID, targets); errUnlock != nil {
+					log.Warningf("Failed to unlock %d target(s) (%v): %v", len(targets), targets, errUnlock)
+				}
+				errCh <- err
+				targetsCh <- nil
+				releaseCh <- nil
+				return
+			}
+		}
+		errCh <- nil
+		targetsCh <- targets
+		releaseCh <- reserved
+	}()
+	// the targets reserved after the acquisition was abandoned are given
+	// back at once
+	releaseLate := func() {
+		go func() {
+			if release := <-releaseCh; release != nil {
+				release()
+			}
+		}()
+	}
+	// wait for targets up to a certain amount of time
+	select {
+	case err := <-errCh:
+		targets = <-targetsCh
+		if r := <-releaseCh; r != nil {
+			release = r
+		}
+		if err != nil {
+			err = fmt.Errorf("run #%d: cannot fetch targets for test '%s': %v", runID, t.Name, err)
+			log.Errorf(err.Error())
+			return false, err
+		}
+		// Associate the targets with the job for later retrievel
+		jr.targetLock.Lock()
+		jr.targetMap[j.ID] = append(jr.targetMap[j.ID], targets...)
+		jr.targetLock.Unlock()
+
+	case <-time.After(config.TargetManagerTimeout):
+		releaseLate()
+		return false, fmt.Errorf("target manager acquire timed out after %s", config.TargetManagerTimeout)
+	case <-j.CancelCh:
+		releaseLate()
+		log.Infof("cancellation requested for job ID %v", j.ID)
+		return true, nil
+	}
+
+	// refresh the target locks periodically, by extending their
+	// expiration time. If the job is cancelled, the locks are released.
+	// If the job is paused (e.g. because we are migrating the ConTest
+	// instance or upgrading it), the locks are not released, because we
+	// may want to resume once the new ConTest instance starts.
+	done := make(chan struct{})
+	unlocked := make(chan struct{})
+	go func(j *job.Job, tl target.Locker, targets []*target.Target, refreshInterval time.Duration) {
+		defer close(unlocked)
+		// the targets of a paused job are given back too, as the job
+		// reserves them again when it is resumed
+		defer release()
+		for {
+			select {
+			case <-j.CancelCh:
+				// unlock targets
+				if err := unlockTargets(span, tl, j.ID, targets); err != nil {
+					log.Warningf("Failed to unlock targets (%v) for job ID %d: %v", targets, j.ID, err)
+				}
+				return
+			case <-j.PauseCh:
+				// do not unlock targets, we can resume later, or let
+				// them expire
+				log.Debugf("Received pause request, NOT releasing targets so the job can be resumed")
+				return
+			case <-done:
+				if err := unlockTargets(span, tl, j.ID, targets); err != nil {
+					log.Warningf("Failed to unlock %d target(s) (%v): %v", len(targets), targets, err)
+				}
+				log.Infof("Unlocked %d target(s) for job ID %d", len(targets), j.ID)
+				return
+			case <-time.After(refreshInterval):
+				// refresh the locks before the timeout expires
+				refreshSpan := tracing.Start(span, "refresh locks", tracing.Attr("targets", len(targets)))
+				err := tl.RefreshLocks(j.ID, targets)
+				refreshSpan.End(err)
+				if err != nil {
+					lockRefreshErrors.Add(target.LockerName(tl), 1)
+					log.Warningf("Failed to refresh %d locks for job ID %d: %v", len(targets), j.ID, err)
+				}
+			}
+		}
+		// refresh locks a bit faster than locking timeout to avoid races
+	}(j, tl, targets, config.LockRefreshTimeout/10*9)
+
+	// Emit events tracking targets acquisition
+	header := testevent.Header{JobID: j.ID, RunID: runID, TestName: t.Name}
+	testEventEmitter := storage.NewTestEventEmitter(header)
+
+	if runErr = jr.emitAcquiredTargets(testEventEmitter, targets); runErr == nil {
+		log.Infof("Run #%d: running test #%d for job '%s' (job ID: %d) on %d targets", runID, idx, j.Name, j.ID, len(targets))
+		testRunner := NewTestRunner()
+		testRunner.timeouts.TargetTimeout = j.TargetTimeout
+		testRunner.abortThreshold = j.AbortThreshold
+		testRunner.batchSize = int(j.TargetBatchSize)
+		testRunner.resume = runID == j.ResumeRunID
+		runErr = testRunner.Run(j.CancelCh, j.PauseCh, t, targets, j.ID, runID)
+	}
+
+	// Job is done, release all the targets
+	go func() {
+		// the Release semantic is synchronous, so that the implementation
+		// is simpler on the user's side. We run it in a goroutine in
+		// order to use a timeout for target acquisition. If Release fails, whether
+		// due to an error or for a timeout, the whole Job is considered failed
+		releaseSpan := tracing.Start(span, "release targets", tracing.Attr("targets", len(targets)))
+		releaseStart := time.Now()
+		err := bundle.TargetManager.Release(j.ID, j.CancelCh, bundle.ReleaseParameters)
+		observeRelease(bundle.TargetManagerName, releaseStart, err)
+		releaseSpan.End(err)
+		errCh <- err
+		// signal that we are done to the goroutine that refreshes the
+		// locks.
+		done <- struct{}{}
+	}()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			errRelease := fmt.Sprintf("Failed to release targets: %v", err)
+			log.Errorf(errRelease)
+			return false, fmt.Errorf(errRelease)
+		}
+		// wait for the targets to be unlocked, so that the jobs started
+		// once this one ends, e.g. the ones depending on it, can lock them
+		<-unlocked
+	case <-time.After(config.TargetManagerTimeout):
+		return false, fmt.Errorf("target manager release timed out after %s", config.TargetManagerTimeout)
+	case <-j.CancelCh:
+		log.Infof("cancellation requested for job ID %v", j.ID)
+		return true, nil
+	}
+	// return the Run error only after releasing the targets, and only
+	// if we are not running indefinitely. An error returned by the TestRunner
+	// is considered a fatal condition and will cause the termination of the
+	// whole job.
+	return false, runErr
+}
+
+// preemptingLocker locks the targets of a job, and if other jobs locked some
+// of them, preempts these jobs and locks the targets again.
+type preemptingLocker struct {
+	target.Locker
+	job     *job.Job
+	preempt PreemptFunc
+}
+
+// Lock locks the targets, preempting the jobs which locked some of them.
+func (l *preemptingLocker) Lock(jobID types.JobID, targets []*target.Target) error {
+	err := l.Locker.Lock(jobID, targets)
+	if err == nil || jobID != l.job.ID {
+		return err
+	}
+	logging.AddField(jobLog, logging.FieldJobID, jobID).Infof("Job %d could not lock its targets, trying to preempt the jobs holding them: %v", jobID, err)
+	if errPreempt := l.preempt(l.job, targets); errPreempt != nil {
+		return fmt.Errorf("%w, and could not preempt the jobs holding them: %v", err, errPreempt)
+	}
+	return l.Locker.Lock(jobID, targets)
+}
+
+// acquireLocker returns the locker with which the targets of a job are
+// acquired and locked, which preempts other jobs if allowed.
+func (jr *JobRunner) acquireLocker(j *job.Job, tl target.Locker, span *tracing.Span) target.Locker {
+	metered := meteredLocker{Locker: tl, name: target.LockerName(tl), span: span}
+	if jr.preempt == nil {
+		return metered
+	}
+	return &preemptingLocker{Locker: metered, job: j, preempt: jr.preempt}
+}
+
+// unlockTargets unlocks the targets of a job, traced by a child of span.
+func unlockTargets(span *tracing.Span, tl target.Locker, jobID types.JobID, targets []*target.Target) error {
+	unlockSpan := tracing.Start(span, "unlock targets", tracing.Attr("targets", len(targets)))
+	err := tl.Unlock(jobID, targets)
+	unlockSpan.End(err)
+	return err
+}
+
+// selectTargets splits targets into the ones with the given IDs and the
+// other ones.
+func selectTargets(targets []*target.Target, ids []string) ([]*target.Target, []*target.Target) {
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	var selected, others []*target.Target
+	for _, t := range targets {
+		if wanted[t.ID] {
+			selected = append(selected, t)
+		} else {
+			others = append(others, t)
+		}
+	}
+	return selected, others
+}
+
 // emitAcquiredTargets emits test events to keep track of Target acquisition
 func (jr *JobRunner) emitAcquiredTargets(emitter testevent.Emitter, targets []*target.Target) error {
 	// The events hold a serialization of the Target in the payload
@@ -311,7 +600,8 @@ func (jr *JobRunner) emitAcquiredTargets(emitter testevent.Emitter, targets []*t
 	return nil
 }
 
-// GetCurrentRun returns the run which is currently being executed
+// GetCurrentRun returns the run which is currently being executed, or zero
+// if no run started yet
 func (jr *JobRunner) GetCurrentRun(jobID types.JobID) (types.RunID, error) {
 
 	var runID types.RunID
@@ -324,6 +614,9 @@ func (jr *JobRunner) GetCurrentRun(jobID types.JobID) (types.RunID, error) {
 		return runID, fmt.Errorf("could not fetch last run id for job %d: %v", jobID, err)
 	}
 
+	if len(runEvents) == 0 {
+		return runID, nil
+	}
 	lastEvent := runEvents[len(runEvents)-1]
 	payload := RunStartedPayload{}
 	if err := json.Unmarshal([]byte(*lastEvent.Payload), &payload); err != nil {
@@ -334,27 +627,43 @@ func (jr *JobRunner) GetCurrentRun(jobID types.JobID) (types.RunID, error) {
 }
 
 func (jr *JobRunner) emitEvent(jobID types.JobID, eventName event.Name, payload interface{}) error {
+	log := logging.AddField(jobLog, logging.FieldJobID, jobID)
 	payloadJSON, err := json.Marshal(payload)
 	if err != nil {
-		jobLog.Warningf("could not encode payload for event %s: %v", eventName, err)
+		log.Warningf("could not encode payload for event %s: %v", eventName, err)
 		return err
 	}
 
 	rawPayload := json.RawMessage(payloadJSON)
 	ev := frameworkevent.Event{JobID: jobID, EventName: eventName, Payload: &rawPayload, EmitTime: time.Now()}
 	if err := jr.frameworkEventManager.Emit(ev); err != nil {
-		jobLog.Warningf("could not emit event %s: %v", eventName, err)
+		log.Warningf("could not emit event %s: %v", eventName, err)
 		return err
 	}
 	return nil
 }
 
-// NewJobRunner returns a new JobRunner, which holds an empty registry of jobs
-func NewJobRunner() *JobRunner {
+func newJobRunner(consistency storage.ConsistencyModel) *JobRunner {
 	jr := JobRunner{}
 	jr.targetMap = make(map[types.JobID][]*target.Target)
 	jr.targetLock = &sync.RWMutex{}
-	jr.frameworkEventManager = storage.NewFrameworkEventEmitterFetcher()
-	jr.testEvManager = storage.NewTestEventFetcher()
+	jr.frameworkEventManager = storage.FrameworkEventEmitterFetcher{
+		FrameworkEventEmitter: storage.NewFrameworkEventEmitter(),
+		FrameworkEventFetcher: storage.FrameworkEventFetcher{Consistency: consistency},
+	}
+	jr.testEvManager = storage.TestEventFetcher{Consistency: consistency}
+	jr.targetResultManager = storage.TargetResultManager{Consistency: consistency}
 	return &jr
 }
+
+// NewJobRunner returns a new JobRunner, which holds an empty registry of jobs
+func NewJobRunner() *JobRunner {
+	return newJobRunner(storage.ConsistentReadAfterWrite)
+}
+
+// NewStatusJobRunner returns a new JobRunner which fetches events from the
+// read storage engine, if one is set. Since such events may lag behind, it
+// must only be used to build statuses for clients, never to run jobs.
+func NewStatusJobRunner() *JobRunner {
+	return newJobRunner(storage.ConsistentEventually)
+}
@@ -7,12 +7,15 @@ package runner
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/facebookincubator/contest/pkg/event"
 	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
 	"github.com/facebookincubator/contest/pkg/event/testevent"
 	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/storage"
 	"github.com/facebookincubator/contest/pkg/target"
 	"github.com/facebookincubator/contest/pkg/test"
 	"github.com/facebookincubator/contest/pkg/types"
@@ -25,6 +28,16 @@ var targetRoutingEvents = map[event.Name]struct{}{
 	target.EventTargetErr:   struct{}{},
 	target.EventTargetOut:   struct{}{},
 	target.EventTargetInErr: struct{}{},
+	// not strictly a routing event, but it is reflected in TargetStatus.Skipped
+	target.EventTargetSkipped: struct{}{},
+	// reflected in TargetStatus.Attempts
+	target.EventTargetRetry: struct{}{},
+}
+
+// targetHeartbeatEvents gather the events which are only reflected in
+// TargetStatus.LastHeartbeat. Heartbeats with no target are step events.
+var targetHeartbeatEvents = map[event.Name]struct{}{
+	test.EventHeartbeat: struct{}{},
 }
 
 // buildTargetStatuses builds a list of TargetStepStatus, which represent the status of Targets within a TestStep
@@ -47,7 +60,9 @@ func (jr *JobRunner) buildTargetStatuses(coordinates job.TestStepCoordinates, ta
 			targetStatus = &targetStatuses[len(targetStatuses)-1]
 		}
 		// append non-routing events
-		if _, isRoutingEvent := targetRoutingEvents[testEvent.Data.EventName]; !isRoutingEvent {
+		_, isRoutingEvent := targetRoutingEvents[testEvent.Data.EventName]
+		_, isHeartbeatEvent := targetHeartbeatEvents[testEvent.Data.EventName]
+		if !isRoutingEvent && !isHeartbeatEvent {
 			targetStatus.Events = append(targetStatus.Events, testEvent)
 		}
 
@@ -56,6 +71,26 @@ func (jr *JobRunner) buildTargetStatuses(coordinates job.TestStepCoordinates, ta
 			targetStatus.InTime = testEvent.EmitTime
 		} else if evName == target.EventTargetOut {
 			targetStatus.OutTime = testEvent.EmitTime
+		} else if evName == target.EventTargetSkipped {
+			targetStatus.OutTime = testEvent.EmitTime
+			targetStatus.Skipped = true
+			skipPayload := target.SkipPayload{}
+			if testEvent.Data.Payload != nil {
+				if err := json.Unmarshal(*testEvent.Data.Payload, &skipPayload); err != nil {
+					targetStatus.SkipReason = fmt.Sprintf("could not unmarshal payload skip reason: %v", err)
+				} else {
+					targetStatus.SkipReason = skipPayload.Reason
+				}
+			}
+		} else if isHeartbeatEvent {
+			targetStatus.LastHeartbeat = testEvent.EmitTime
+		} else if evName == target.EventTargetRetry {
+			retryPayload := target.RetryPayload{}
+			if testEvent.Data.Payload != nil {
+				if err := json.Unmarshal(*testEvent.Data.Payload, &retryPayload); err == nil {
+					targetStatus.Attempts = retryPayload.Attempt
+				}
+			}
 		} else if evName == target.EventTargetErr {
 			targetStatus.OutTime = testEvent.EmitTime
 			errorPayload := target.ErrPayload{}
@@ -134,11 +169,12 @@ func (jr *JobRunner) buildTestStatus(coordinates job.TestCoordinates, currentJob
 	}
 	testStatus := job.TestStatus{
 		TestCoordinates:  coordinates,
-		TestStepStatuses: make([]job.TestStepStatus, len(currentTest.TestStepsBundles)),
+		TestStepStatuses: make([]job.TestStepStatus, 0, len(currentTest.TestStepsBundles)+len(currentTest.CleanupStepsBundles)),
 	}
 
-	// Build a TestStepStatus object for each TestStep
-	for index, bundle := range currentTest.TestStepsBundles {
+	// Build a TestStepStatus object for each TestStep, cleanup steps included
+	bundles := append(append([]test.TestStepBundle{}, currentTest.TestStepsBundles...), currentTest.CleanupStepsBundles...)
+	for _, bundle := range bundles {
 		testStepCoordinates := job.TestStepCoordinates{
 			TestCoordinates: coordinates,
 			TestStepName:    bundle.TestStep.Name(),
@@ -148,7 +184,7 @@ func (jr *JobRunner) buildTestStatus(coordinates job.TestCoordinates, currentJob
 		if err != nil {
 			return nil, fmt.Errorf("could not build TestStatus for test %s: %v", bundle.TestStep.Name(), err)
 		}
-		testStatus.TestStepStatuses[index] = *testStepStatus
+		testStatus.TestStepStatuses = append(testStatus.TestStepStatuses, *testStepStatus)
 	}
 
 	// Calculate the overall status of the Targets which corresponds to the last TargetStatus
@@ -169,9 +205,10 @@ func (jr *JobRunner) buildTestStatus(coordinates job.TestCoordinates, currentJob
 
 	var targetStatuses []job.TargetStatus
 
-	// Keep track of the last TargetStatus seen for each Target
+	// Keep track of the last TargetStatus seen for each Target. Cleanup steps
+	// do not contribute to the outcome of the test.
 	targetMap := make(map[target.Target]job.TargetStatus)
-	for _, testStepStatus := range testStatus.TestStepStatuses {
+	for _, testStepStatus := range testStatus.TestStepStatuses[:len(currentTest.TestStepsBundles)] {
 		for _, targetStatus := range testStepStatus.TargetStatuses {
 			targetMap[*targetStatus.Target] = targetStatus
 		}
@@ -188,9 +225,152 @@ func (jr *JobRunner) buildTestStatus(coordinates job.TestCoordinates, currentJob
 	}
 
 	testStatus.TargetStatuses = targetStatuses
+
+	targetResults, err := jr.buildTargetResults(coordinates, targetAcquiredEvents)
+	if err != nil {
+		return nil, err
+	}
+	testStatus.TargetResults = targetResults
+	testStatus.Progress = buildTestProgress(&testStatus, targetAcquiredEvents, time.Now())
 	return &testStatus, nil
 }
 
+// inStep returns whether a Target is currently in the TestStep. A Target
+// which is being retried has entered the TestStep again after leaving it.
+func inStep(targetStatus job.TargetStatus) bool {
+	if targetStatus.InTime.IsZero() {
+		return false
+	}
+	return targetStatus.OutTime.IsZero() || targetStatus.OutTime.Before(targetStatus.InTime)
+}
+
+// buildTestProgress summarizes the progress of the targets in a test, given
+// its step statuses and results, and the target acquisition events. Step
+// throughput is measured until now for the steps which still hold targets.
+func buildTestProgress(testStatus *job.TestStatus, targetAcquiredEvents []testevent.Event, now time.Time) job.TestProgress {
+	progress := job.TestProgress{
+		Total:     len(targetAcquiredEvents),
+		Completed: len(testStatus.TargetResults),
+	}
+	currentStep := make(map[target.Target]string)
+	for _, testStepStatus := range testStatus.TestStepStatuses {
+		stepProgress := job.TestStepProgress{TestStepLabel: testStepStatus.TestStepLabel}
+		var first, last time.Time
+		for _, targetStatus := range testStepStatus.TargetStatuses {
+			if targetStatus.InTime.IsZero() {
+				continue
+			}
+			if first.IsZero() || targetStatus.InTime.Before(first) {
+				first = targetStatus.InTime
+			}
+			if inStep(targetStatus) {
+				stepProgress.InProgress++
+				currentStep[*targetStatus.Target] = testStepStatus.TestStepLabel
+				continue
+			}
+			stepProgress.Completed++
+			if targetStatus.Error != "" {
+				stepProgress.Failed++
+			}
+			if targetStatus.OutTime.After(last) {
+				last = targetStatus.OutTime
+			}
+		}
+		if stepProgress.InProgress > 0 {
+			last = now
+		}
+		if elapsed := last.Sub(first).Seconds(); stepProgress.Completed > 0 && elapsed > 0 {
+			stepProgress.Throughput = float64(stepProgress.Completed) / elapsed
+		}
+		progress.Steps = append(progress.Steps, stepProgress)
+	}
+	for _, targetEvent := range targetAcquiredEvents {
+		t := targetEvent.Data.Target
+		if label, ok := currentStep[*t]; ok {
+			progress.Targets = append(progress.Targets, job.TargetProgress{Target: t, TestStepLabel: label})
+		}
+	}
+	progress.InProgress = len(progress.Targets)
+	return progress
+}
+
+// buildTargetResults builds the list of the results of the targets which
+// completed a test, in the same order as the acquisition events. Results are
+// read from the per-target results table if the storage engine maintains one,
+// otherwise, or for jobs which ran before it did, from the events.
+func (jr *JobRunner) buildTargetResults(coordinates job.TestCoordinates, targetAcquiredEvents []testevent.Event) ([]job.TargetResult, error) {
+	resultMap, err := jr.fetchTargetResults(coordinates)
+	if err != nil {
+		return nil, err
+	}
+	if len(resultMap) == 0 {
+		if resultMap, err = jr.fetchTargetResultEvents(coordinates); err != nil {
+			return nil, err
+		}
+	}
+
+	var targetResults []job.TargetResult
+	for _, targetEvent := range targetAcquiredEvents {
+		t := targetEvent.Data.Target
+		if result, ok := resultMap[*t]; ok {
+			result.Target = t
+			targetResults = append(targetResults, result)
+		}
+	}
+	return targetResults, nil
+}
+
+// fetchTargetResults returns the results of the targets of a test stored in
+// the per-target results table, if any.
+func (jr *JobRunner) fetchTargetResults(coordinates job.TestCoordinates) (map[target.Target]job.TargetResult, error) {
+	results, err := jr.targetResultManager.GetTargetResults(&storage.TargetResultQuery{
+		JobID:    coordinates.JobID,
+		RunID:    coordinates.RunID,
+		TestName: coordinates.TestName,
+	})
+	if errors.Is(err, storage.ErrTargetResultsNotSupported) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	resultMap := make(map[target.Target]job.TargetResult)
+	for _, result := range results {
+		if result.Target == nil {
+			continue
+		}
+		resultMap[*result.Target] = job.TargetResult{Result: result.Result, Duration: result.Duration}
+	}
+	return resultMap, nil
+}
+
+// fetchTargetResultEvents returns the results of the targets of a test carried
+// by TargetResult events.
+func (jr *JobRunner) fetchTargetResultEvents(coordinates job.TestCoordinates) (map[target.Target]job.TargetResult, error) {
+	resultEvents, err := jr.testEvManager.Fetch(
+		testevent.QueryJobID(coordinates.JobID),
+		testevent.QueryRunID(coordinates.RunID),
+		testevent.QueryTestName(coordinates.TestName),
+		testevent.QueryEventName(target.EventTargetResult),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch events associated to target results: %v", err)
+	}
+	resultMap := make(map[target.Target]job.TargetResult)
+	for _, resultEvent := range resultEvents {
+		if resultEvent.Data.Target == nil || resultEvent.Data.Payload == nil {
+			jobLog.Warningf("Found %s event with no target or payload associated, ignoring it", target.EventTargetResult)
+			continue
+		}
+		var result target.Result
+		if err := json.Unmarshal(*resultEvent.Data.Payload, &result); err != nil {
+			result = target.Result{Outcome: target.OutcomeError, Message: fmt.Sprintf("could not unmarshal result payload: %v", err)}
+		}
+		resultMap[*resultEvent.Data.Target] = job.TargetResult{Result: result}
+	}
+	return resultMap, nil
+}
+
 // BuildRunStatus builds the status of a run with a job
 func (jr *JobRunner) BuildRunStatus(coordinates job.RunCoordinates, currentJob *job.Job) (*job.RunStatus, error) {
 
@@ -11,7 +11,9 @@ import (
 	"time"
 
 	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
 	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/target"
 	"github.com/stretchr/testify/require"
 )
 
@@ -56,3 +58,83 @@ func TestBuildRunStatuses(t *testing.T) {
 	require.NoError(t, err)
 	require.Len(t, runStatuses, 2)
 }
+
+func TestBuildTargetStatusesSkipped(t *testing.T) {
+	jr := &JobRunner{}
+	t1 := &target.Target{ID: "T1"}
+	t2 := &target.Target{ID: "T2"}
+	events := []testevent.Event{
+		{EmitTime: time.Unix(1, 0), Data: &testevent.Data{EventName: target.EventTargetIn, Target: t1}},
+		{EmitTime: time.Unix(1, 0), Data: &testevent.Data{EventName: target.EventTargetIn, Target: t2}},
+		{EmitTime: time.Unix(2, 0), Data: &testevent.Data{
+			EventName: target.EventTargetSkipped,
+			Target:    t1,
+			Payload:   &[]json.RawMessage{json.RawMessage(`{"Reason":"not applicable"}`)}[0],
+		}},
+		{EmitTime: time.Unix(3, 0), Data: &testevent.Data{
+			EventName: target.EventTargetErr,
+			Target:    t2,
+			Payload:   &[]json.RawMessage{json.RawMessage(`{"Error":"failed"}`)}[0],
+		}},
+	}
+	statuses, err := jr.buildTargetStatuses(job.TestStepCoordinates{}, events)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+
+	require.True(t, statuses[0].Skipped)
+	require.Equal(t, "not applicable", statuses[0].SkipReason)
+	require.Empty(t, statuses[0].Error)
+	require.Equal(t, time.Unix(2, 0), statuses[0].OutTime)
+	require.Empty(t, statuses[0].Events)
+
+	require.False(t, statuses[1].Skipped)
+	require.Equal(t, "failed", statuses[1].Error)
+}
+
+func TestBuildTestProgress(t *testing.T) {
+	t1 := &target.Target{ID: "T1"}
+	t2 := &target.Target{ID: "T2"}
+	t3 := &target.Target{ID: "T3"}
+	acquired := []testevent.Event{
+		{Data: &testevent.Data{EventName: target.EventTargetAcquired, Target: t1}},
+		{Data: &testevent.Data{EventName: target.EventTargetAcquired, Target: t2}},
+		{Data: &testevent.Data{EventName: target.EventTargetAcquired, Target: t3}},
+	}
+	testStatus := job.TestStatus{
+		TestStepStatuses: []job.TestStepStatus{
+			{
+				TestStepCoordinates: job.TestStepCoordinates{TestStepLabel: "first"},
+				TargetStatuses: []job.TargetStatus{
+					{Target: t1, InTime: time.Unix(10, 0), OutTime: time.Unix(12, 0)},
+					{Target: t2, InTime: time.Unix(10, 0), OutTime: time.Unix(14, 0)},
+					// t3 is being retried
+					{Target: t3, InTime: time.Unix(15, 0), OutTime: time.Unix(11, 0), Error: "failed", Attempts: 1},
+				},
+			},
+			{
+				TestStepCoordinates: job.TestStepCoordinates{TestStepLabel: "second"},
+				TargetStatuses: []job.TargetStatus{
+					{Target: t1, InTime: time.Unix(12, 0), OutTime: time.Unix(13, 0), Error: "failed"},
+					{Target: t2, InTime: time.Unix(14, 0)},
+				},
+			},
+		},
+		TargetResults: []job.TargetResult{
+			{Target: t1, Result: target.Result{Outcome: target.OutcomeFail, Step: "second"}},
+		},
+	}
+
+	progress := buildTestProgress(&testStatus, acquired, time.Unix(20, 0))
+	require.Equal(t, 3, progress.Total)
+	require.Equal(t, 1, progress.Completed)
+	require.Equal(t, 2, progress.InProgress)
+	require.Equal(t, []job.TargetProgress{
+		{Target: t2, TestStepLabel: "second"},
+		{Target: t3, TestStepLabel: "first"},
+	}, progress.Targets)
+	require.Equal(t, []job.TestStepProgress{
+		// measured until now, as t3 is still in the step
+		{TestStepLabel: "first", InProgress: 1, Completed: 2, Throughput: 0.2},
+		{TestStepLabel: "second", InProgress: 1, Completed: 1, Failed: 1, Throughput: 0.125},
+	}, progress.Steps)
+}
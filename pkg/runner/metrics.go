@@ -0,0 +1,115 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package runner
+
+import (
+	"expvar"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/metrics"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/tracing"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// runnerMetrics are published via expvar, as "contest_runner". Counters are:
+//
+// * step_errors: test steps which returned an error, by plugin
+// * locks: attempts of jobs to lock the targets they acquired
+// * lock_conflicts: the attempts which failed, as other jobs held some targets
+// * lock_refresh_errors: failures to extend the locks of running jobs
+// * acquire_errors: failures of target managers to acquire targets, by plugin
+// * release_errors: failures of target managers to release targets, by plugin
+//
+// The counters of locks are labelled by locker. Histograms are step_seconds,
+// the time test steps ran for, by plugin, lock_seconds, the latency of
+// locking targets, by locker, and acquire_seconds and release_seconds, the
+// time target managers took to acquire and release targets, by plugin.
+var runnerMetrics = expvar.NewMap("contest_runner")
+
+// stepDurationBuckets are the upper bounds, in seconds, of the buckets of
+// the step_seconds histogram.
+var stepDurationBuckets = []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 4 * 3600, 12 * 3600}
+
+// targetManagerBuckets are the upper bounds, in seconds, of the buckets of
+// the acquire_seconds and release_seconds histograms.
+var targetManagerBuckets = []float64{0.01, 0.1, 0.5, 1, 5, 15, 60, 300, 900}
+
+var (
+	stepDuration      = metrics.NewHistogramVec("step", stepDurationBuckets)
+	stepErrors        = metrics.NewCounterVec("step")
+	locks             = metrics.NewCounterVec("locker")
+	lockConflicts     = metrics.NewCounterVec("locker")
+	lockRefreshErrors = metrics.NewCounterVec("locker")
+	lockLatency       = metrics.NewHistogramVec("locker", metrics.DefaultLatencyBuckets)
+	acquireErrors     = metrics.NewCounterVec("target_manager")
+	acquireLatency    = metrics.NewHistogramVec("target_manager", targetManagerBuckets)
+	releaseErrors     = metrics.NewCounterVec("target_manager")
+	releaseLatency    = metrics.NewHistogramVec("target_manager", targetManagerBuckets)
+)
+
+func init() {
+	runnerMetrics.Set("step_seconds", stepDuration)
+	runnerMetrics.Set("step_errors", stepErrors)
+	runnerMetrics.Set("locks", locks)
+	runnerMetrics.Set("lock_conflicts", lockConflicts)
+	runnerMetrics.Set("lock_refresh_errors", lockRefreshErrors)
+	runnerMetrics.Set("lock_seconds", lockLatency)
+	runnerMetrics.Set("acquire_errors", acquireErrors)
+	runnerMetrics.Set("acquire_seconds", acquireLatency)
+	runnerMetrics.Set("release_errors", releaseErrors)
+	runnerMetrics.Set("release_seconds", releaseLatency)
+}
+
+// observeStep records the outcome of a test step plugin, which started
+// running at the given time.
+func observeStep(name string, start time.Time, err error) {
+	stepDuration.Observe(name, time.Since(start).Seconds())
+	if err != nil {
+		stepErrors.Add(name, 1)
+	}
+}
+
+// observeAcquire records the outcome of the acquisition of targets by a
+// target manager plugin, which started at the given time.
+func observeAcquire(name string, start time.Time, err error) {
+	acquireLatency.Observe(name, time.Since(start).Seconds())
+	if err != nil {
+		acquireErrors.Add(name, 1)
+	}
+}
+
+// observeRelease records the outcome of the release of targets by a target
+// manager plugin, which started at the given time.
+func observeRelease(name string, start time.Time, err error) {
+	releaseLatency.Observe(name, time.Since(start).Seconds())
+	if err != nil {
+		releaseErrors.Add(name, 1)
+	}
+}
+
+// meteredLocker measures the contention on the locks of the targets which
+// jobs acquire, labelled by the name of the locker, and traces the locking
+// with children of span.
+type meteredLocker struct {
+	target.Locker
+	name string
+	span *tracing.Span
+}
+
+// Lock locks the targets, and records the outcome.
+func (l meteredLocker) Lock(jobID types.JobID, targets []*target.Target) error {
+	start := time.Now()
+	span := tracing.Start(l.span, "lock targets", tracing.Attr("targets", len(targets)))
+	err := l.Locker.Lock(jobID, targets)
+	span.End(err)
+	locks.Add(l.name, 1)
+	if err != nil {
+		lockConflicts.Add(l.name, 1)
+	}
+	lockLatency.Observe(l.name, time.Since(start).Seconds())
+	return err
+}
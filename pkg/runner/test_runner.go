@@ -11,6 +11,7 @@ import (
 
 	"github.com/facebookincubator/contest/pkg/cerrors"
 	"github.com/facebookincubator/contest/pkg/config"
+	"github.com/facebookincubator/contest/pkg/job"
 	"github.com/facebookincubator/contest/pkg/logging"
 	"github.com/facebookincubator/contest/pkg/target"
 	"github.com/facebookincubator/contest/pkg/test"
@@ -24,6 +25,14 @@ type TestRunnerTimeouts struct {
 	MessageTimeout      time.Duration
 	ShutdownTimeout     time.Duration
 	StepShutdownTimeout time.Duration
+	LostTargetsTimeout  time.Duration
+	// TargetTimeout is the maximum time a target can spend in the pipeline,
+	// zero means no limit
+	TargetTimeout time.Duration
+	// CleanupTimeout is the maximum time the cleanup steps can still run
+	// once the test is cancelled or paused, zero means
+	// config.TestRunnerCleanupTimeout
+	CleanupTimeout time.Duration
 }
 
 // routingCh represents a set of unidirectional channels used by the routing subsystem.
@@ -43,7 +52,14 @@ type routingCh struct {
 	stepErr <-chan cerrors.TargetError
 	// targetErr connects the routing block directly to the TestRunner. Failing
 	// targets are acquired by the TestRunner via this channel
-	targetErr chan<- cerrors.TargetError
+	targetErr chan<- stepTargetError
+}
+
+// stepTargetError is a TargetError forwarded by a routing block to the
+// TestRunner, annotated with the label of the step that failed the target
+type stepTargetError struct {
+	cerrors.TargetError
+	stepLabel string
 }
 
 // stepCh represents a set of bidirectional channels that a TestStep and its associated
@@ -87,7 +103,7 @@ type pipelineCtrlCh struct {
 	routingResultCh <-chan routeResult
 	stepResultCh    <-chan stepResult
 	targetOut       <-chan *target.Target
-	targetErr       <-chan cerrors.TargetError
+	targetErr       <-chan stepTargetError
 	// cancelRouting is a control channel used to cancel routing blocks in the pipeline
 	cancelRoutingCh chan struct{}
 	// cancelStep is a control channel used to cancel the steps of the pipeline
@@ -100,6 +116,15 @@ type pipelineCtrlCh struct {
 // the results of the run. It is not safe to access `results` concurrently.
 type TestRunner struct {
 	timeouts TestRunnerTimeouts
+	// abortThreshold defines when the test is aborted because too many
+	// targets failed
+	abortThreshold job.AbortThreshold
+	// batchSize is the number of targets injected into the pipeline at once,
+	// zero means all targets are injected at once
+	batchSize int
+	// resume is set if the test runs again in the run of a job which was
+	// paused or interrupted, so that the steps are resumed if they can
+	resume bool
 }
 
 // targetWriter is a helper object which exposes methods to write targets into step channels
@@ -136,7 +161,7 @@ func (w *targetWriter) writeTargetWithResult(terminate <-chan struct{}, target *
 }
 
 // writeTargetError writes a TargetError object to a TargetError channel with timeout
-func (w *targetWriter) writeTargetError(terminate <-chan struct{}, ch chan<- cerrors.TargetError, targetError cerrors.TargetError, timeout time.Duration) error {
+func (w *targetWriter) writeTargetError(terminate <-chan struct{}, ch chan<- stepTargetError, targetError stepTargetError, timeout time.Duration) error {
 	select {
 	case <-terminate:
 	case ch <- targetError:
@@ -151,7 +176,12 @@ func newTargetWriter(log *logrus.Entry, timeouts TestRunnerTimeouts) *targetWrit
 }
 
 // Run implements the main logic of the TestRunner, i.e. the instantiation and
-// connection of the TestSteps, routing blocks and pipeline runner.
+// connection of the TestSteps, routing blocks and pipeline runner. If the test
+// has cleanup steps, they are run on all the targets after the test steps,
+// regardless of their outcome and of cancellation. Cleanup steps are not run
+// if pause is requested, as the job can be resumed later. Once the test is
+// cancelled or paused, the cleanup steps are cancelled in turn if they do not
+// complete within the cleanup timeout.
 func (tr *TestRunner) Run(cancel, pause <-chan struct{}, test *test.Test, targets []*target.Target, jobID types.JobID, runID types.RunID) error {
 
 	if len(test.TestStepsBundles) == 0 {
@@ -160,25 +190,124 @@ func (tr *TestRunner) Run(cancel, pause <-chan struct{}, test *test.Test, target
 
 	// rootLog is propagated to all the subsystems of the pipeline
 	rootLog := logging.GetLogger("pkg/runner")
-	fields := make(map[string]interface{})
-	fields["jobid"] = jobID
-	fields["runid"] = runID
-	rootLog = logging.AddFields(rootLog, fields)
+	rootLog = logging.AddFields(rootLog, map[string]interface{}{
+		logging.FieldJobID:    jobID,
+		logging.FieldRunID:    runID,
+		logging.FieldTestName: test.Name,
+	})
 
 	log := logging.AddField(rootLog, "phase", "run")
 	testPipeline := newPipeline(logging.AddField(rootLog, "entity", "test_pipeline"), test.TestStepsBundles, test, jobID, runID, tr.timeouts)
+	testPipeline.abortThreshold = tr.abortThreshold
+	testPipeline.numTargets = len(targets)
+	testPipeline.emitResults = true
+	testPipeline.resume = tr.resume
+	err := tr.runPipeline(cancel, pause, log, testPipeline, targets, tr.batchSize)
+	tr.emitIncompleteResults(cancel, pause, testPipeline, targets, err)
+
+	if len(test.CleanupStepsBundles) == 0 {
+		return err
+	}
+	select {
+	case <-pause:
+		log.Infof("pause requested, not running cleanup steps")
+		return err
+	default:
+	}
+	// cleanup steps are not paused, a nil channel is never signalled
+	log.Infof("running cleanup steps")
+	cleanupTimeout := tr.timeouts.CleanupTimeout
+	if cleanupTimeout == 0 {
+		cleanupTimeout = config.TestRunnerCleanupTimeout
+	}
+	cleanupDone := make(chan struct{})
+	defer close(cleanupDone)
+	cleanupCancel := cancelAfterTermination(cancel, pause, cleanupTimeout, cleanupDone)
+	cleanupPipeline := newPipeline(logging.AddField(rootLog, "entity", "cleanup_pipeline"), test.CleanupStepsBundles, test, jobID, runID, tr.timeouts)
+	if cleanupErr := tr.runPipeline(cleanupCancel, nil, log, cleanupPipeline, targets, 0); cleanupErr != nil {
+		if err != nil {
+			log.Warningf("cleanup steps failed: %v", cleanupErr)
+			return err
+		}
+		return fmt.Errorf("cleanup steps failed: %w", cleanupErr)
+	}
+	return err
+}
+
+// cancelAfterTermination returns a channel which is closed once timeout has
+// elapsed after cancel or pause are signalled, unless done is closed first.
+func cancelAfterTermination(cancel, pause <-chan struct{}, timeout time.Duration, done <-chan struct{}) <-chan struct{} {
+	ch := make(chan struct{})
+	go func() {
+		select {
+		case <-cancel:
+		case <-pause:
+		case <-done:
+			return
+		}
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		select {
+		case <-t.C:
+			close(ch)
+		case <-done:
+		}
+	}()
+	return ch
+}
+
+// emitIncompleteResults emits an Error result for the targets which did not
+// complete the pipeline because the test failed or was cancelled. Nothing is
+// emitted upon pause, as the targets will complete when the job is resumed.
+func (tr *TestRunner) emitIncompleteResults(cancel, pause <-chan struct{}, p *pipeline, targets []*target.Target, err error) {
+	select {
+	case <-pause:
+		return
+	default:
+	}
+	message := "test was cancelled"
+	if err != nil {
+		message = fmt.Sprintf("test failed: %v", err)
+	} else {
+		select {
+		case <-cancel:
+		default:
+			return
+		}
+	}
+	completed := p.state.CompletedTargets()
+	for _, t := range targets {
+		if _, ok := completed[t]; !ok {
+			p.emitTargetResult(t, target.Result{Outcome: target.OutcomeError, Message: message})
+		}
+	}
+}
 
+// runPipeline injects the targets into a pipeline and runs it until it
+// completes, fails, or termination is requested.
+func (tr *TestRunner) runPipeline(cancel, pause <-chan struct{}, log *logrus.Entry, p *pipeline, targets []*target.Target, batchSize int) error {
 	log.Infof("setting up pipeline")
 	completedTargets := make(chan *target.Target)
-	inCh := testPipeline.init(cancel, pause)
+	inCh := p.init(cancel, pause)
 
-	// inject targets in the step
+	// inject targets in the step. If batching is enabled, each batch is
+	// injected only once the previous one has completed the pipeline, and
+	// batchDone is signalled every time a batch completes.
 	terminateInjectionCh := make(chan struct{})
+	batchDone := make(chan struct{}, 1)
 	go func(terminate <-chan struct{}, inputChannel chan<- *target.Target) {
 		defer close(inputChannel)
-		log := logging.AddField(log, "step", "injection")
+		log := logging.AddField(log, logging.FieldStepLabel, "injection")
 		writer := newTargetWriter(log, tr.timeouts)
-		for _, target := range targets {
+		for idx, target := range targets {
+			if batchSize > 0 && idx > 0 && idx%batchSize == 0 {
+				log.Debugf("waiting for batch of %d targets to complete", batchSize)
+				select {
+				case <-batchDone:
+				case <-terminate:
+					return
+				}
+			}
 			if err := writer.writeTimeout(terminate, inputChannel, target, tr.timeouts.MessageTimeout); err != nil {
 				log.Debugf("could not inject target %+v into first routing block: %+v", target, err)
 			}
@@ -188,10 +317,11 @@ func (tr *TestRunner) Run(cancel, pause <-chan struct{}, test *test.Test, target
 	errCh := make(chan error)
 	go func() {
 		log.Infof("running pipeline")
-		errCh <- testPipeline.run(cancel, pause, completedTargets)
+		errCh <- p.run(cancel, pause, completedTargets)
 	}()
 
 	defer close(terminateInjectionCh)
+	numCompleted := 0
 	// Receive targets from the completed channel controlled by the pipeline, while
 	// waiting for termination signals or fatal errors encountered while running
 	// the pipeline.
@@ -210,6 +340,12 @@ func (tr *TestRunner) Run(cancel, pause <-chan struct{}, test *test.Test, target
 			return err
 		case target := <-completedTargets:
 			log.Infof("test runner completed target: %v", target)
+			numCompleted++
+			if batchSize > 0 && numCompleted%batchSize == 0 {
+				// never blocks, as every signal is consumed before the
+				// next batch is injected
+				batchDone <- struct{}{}
+			}
 		}
 	}
 }
@@ -223,6 +359,8 @@ func NewTestRunner() TestRunner {
 			MessageTimeout:      config.TestRunnerMsgTimeout,
 			ShutdownTimeout:     config.TestRunnerShutdownTimeout,
 			StepShutdownTimeout: config.TestRunnerStepShutdownTimeout,
+			LostTargetsTimeout:  config.TestRunnerLostTargetsTimeout,
+			CleanupTimeout:      config.TestRunnerCleanupTimeout,
 		},
 	}
 }
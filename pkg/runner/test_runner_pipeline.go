@@ -6,19 +6,27 @@
 package runner
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"runtime/debug"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/facebookincubator/contest/pkg/cerrors"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
 	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
 	"github.com/facebookincubator/contest/pkg/logging"
 	"github.com/facebookincubator/contest/pkg/storage"
 	"github.com/facebookincubator/contest/pkg/target"
 	"github.com/facebookincubator/contest/pkg/test"
+	"github.com/facebookincubator/contest/pkg/tracing"
 	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/facebookincubator/contest/pkg/xcontext"
 	"github.com/sirupsen/logrus"
 )
 
@@ -46,6 +54,25 @@ type pipeline struct {
 	// the pipeline. This number is set by the first routing block as soon as the injection
 	// terminates
 	numIngress uint64
+
+	// numTargets is the number of targets the test runs on, and together with
+	// abortThreshold it determines when the test is aborted early
+	numTargets     int
+	abortThreshold job.AbortThreshold
+
+	// ingressTime records when each target entered the pipeline, and it is
+	// used to enforce the target timeout
+	ingressTimeMu sync.Mutex
+	ingressTime   map[*target.Target]time.Time
+
+	// emitResults is set if the pipeline emits a TargetResult event for each
+	// target completing it. Pipelines running cleanup steps do not, as they
+	// do not contribute to the outcome of the test.
+	emitResults bool
+
+	// resume is set if the steps which can be resumed are resumed from their
+	// checkpoints, rather than run from the start
+	resume bool
 }
 
 // runStep runs synchronously a TestStep and peforms sanity checks on the status
@@ -62,17 +89,19 @@ type pipeline struct {
 // indefinitely and does not respond to cancellation signals, the TestRunner will
 // flag it as misbehaving and return. If the TestStep returns once the TestRunner
 // has completed, it will timeout trying to write on the result channel.
-func (p *pipeline) runStep(cancel, pause <-chan struct{}, jobID types.JobID, runID types.RunID, bundle test.TestStepBundle, stepCh stepCh, resultCh chan<- stepResult, ev testevent.EmitterFetcher) {
+func (p *pipeline) runStep(cancel, pause <-chan struct{}, jobID types.JobID, runID types.RunID, bundle test.TestStepBundle, stepCh stepCh, tracker *targetTracker, resultCh chan<- stepResult, ev testevent.EmitterFetcher) {
 
 	stepLabel := bundle.TestStepLabel
-	log := logging.AddField(p.log, "step", stepLabel)
+	log := logging.AddField(p.log, logging.FieldStepLabel, stepLabel)
 	log = logging.AddField(log, "phase", "runStep")
 
 	log.Debugf("initializing step")
 	timeout := p.timeouts.MessageTimeout
 	defer func() {
 		if r := recover(); r != nil {
-			err := fmt.Errorf("step %s paniced (%v): %s", stepLabel, r, debug.Stack())
+			err := &cerrors.ErrTestStepPanicked{StepName: stepLabel, Value: fmt.Sprintf("%v", r), Stack: string(debug.Stack())}
+			log.Errorf("%v: %s", err, err.Stack)
+			p.emitPanicEvent(runID, bundle, err)
 			select {
 			case resultCh <- stepResult{jobID: jobID, runID: runID, bundle: bundle, err: err}:
 			case <-time.After(p.timeouts.MessageTimeout):
@@ -113,7 +142,46 @@ func (p *pipeline) runStep(cancel, pause <-chan struct{}, jobID types.JobID, run
 			Out: stepCh.stepOut,
 			Err: stepCh.stepErr,
 		}
-		err = bundle.TestStep.Run(cancel, pause, channels, bundle.Parameters, ev)
+		header := testevent.Header{JobID: jobID, RunID: runID, TestName: p.test.Name, TestStepLabel: stepLabel}
+		hooks := test.StepHooks()
+		for _, hook := range hooks {
+			if err = hook.BeforeStep(header, bundle); err != nil {
+				log.Errorf("step rejected by step hook: %v", err)
+				break
+			}
+		}
+		if err == nil {
+			ctx, stop := xcontext.New(context.Background(), cancel, pause)
+			defer stop()
+			ctx = xcontext.WithLogger(ctx, logging.AddField(p.log, logging.FieldStepLabel, stepLabel))
+			ctx = test.WithCheckpointStore(ctx, test.NewCheckpointStore(header, ev))
+			run := func(ctx context.Context, ch test.TestStepChannels) error {
+				return bundle.TestStep.Run(ctx, ch, bundle.Parameters, ev)
+			}
+			if p.resume && bundle.TestStep.CanResume() {
+				log.Debugf("resuming step")
+				run = func(ctx context.Context, ch test.TestStepChannels) error {
+					return bundle.TestStep.Resume(ctx, ch, bundle.Parameters, ev)
+				}
+			}
+			key := tracing.Key{JobID: jobID, RunID: runID, TestName: p.test.Name, TestStepLabel: stepLabel}
+			span := tracing.Start(tracing.Lookup(key), "step",
+				tracing.Attr("step.label", stepLabel),
+				tracing.Attr("step.plugin", bundle.TestStep.Name()),
+				tracing.Attr("step.resumed", p.resume && bundle.TestStep.CanResume()),
+			).Bind(key)
+			start := time.Now()
+			if bundle.Timeout > 0 || p.timeouts.TargetTimeout > 0 {
+				err = p.runStepWithTimeouts(ctx, cancel, pause, runID, bundle, channels, run)
+			} else {
+				err = run(ctx, channels)
+			}
+			observeStep(bundle.TestStep.Name(), start, err)
+			span.End(err)
+			for _, hook := range hooks {
+				hook.AfterStep(header, bundle, err)
+			}
+		}
 	}
 
 	log.Debugf("step %s returned", bundle.TestStepLabel)
@@ -179,6 +247,19 @@ func (p *pipeline) runStep(cancel, pause <-chan struct{}, jobID types.JobID, run
 		}
 	}
 
+	// The TestStep returned, but it might not have forwarded all the targets
+	// yet, e.g. if they are still being processed by goroutines which the step
+	// did not wait for. Give them a grace period before flagging them as lost.
+	if err == nil {
+		if lost := tracker.waitLost(cancel, pause, p.timeouts.LostTargetsTimeout); len(lost) > 0 {
+			lostErr := &cerrors.ErrTestStepLostTargets{StepName: stepLabel}
+			for _, t := range lost {
+				lostErr.Targets = append(lostErr.Targets, t.Name)
+			}
+			err = lostErr
+		}
+	}
+
 	select {
 	case _, ok := <-stepCh.stepOut:
 		if !ok {
@@ -217,6 +298,33 @@ func (p *pipeline) runStep(cancel, pause <-chan struct{}, jobID types.JobID, run
 	}
 }
 
+// emitPanicEvent records a framework event carrying the stack trace of a
+// panic recovered from a test step.
+func (p *pipeline) emitPanicEvent(runID types.RunID, bundle test.TestStepBundle, panicErr *cerrors.ErrTestStepPanicked) {
+	p.emitFrameworkEvent(EventTestStepPanicked, TestStepPanickedPayload{
+		RunID:         runID,
+		TestName:      p.test.Name,
+		TestStepLabel: bundle.TestStepLabel,
+		Panic:         panicErr.Value,
+		Stack:         panicErr.Stack,
+	})
+}
+
+// emitFrameworkEvent emits a framework event associated to the job the
+// pipeline belongs to. Failures are logged and otherwise ignored.
+func (p *pipeline) emitFrameworkEvent(name event.Name, payload interface{}) {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		p.log.Warningf("could not encode payload for event %s: %v", name, err)
+		return
+	}
+	rawPayload := json.RawMessage(payloadJSON)
+	ev := frameworkevent.Event{JobID: p.jobID, EventName: name, Payload: &rawPayload, EmitTime: time.Now()}
+	if err := storage.NewFrameworkEventEmitter().Emit(ev); err != nil {
+		p.log.Warningf("could not emit event %s: %v", name, err)
+	}
+}
+
 // waitTargets reads results coming from results channels until all Targets
 // have completed or an error occurs. If all Targets complete successfully, it checks
 // whether TestSteps and routing blocks have completed as well. If not, returns an
@@ -229,6 +337,7 @@ func (p *pipeline) waitTargets(terminate <-chan struct{}, completedCh chan<- *ta
 		err                  error
 		completedTarget      *target.Target
 		completedTargetError error
+		completedTargetStep  string
 	)
 
 	outChannel := p.ctrlChannels.targetOut
@@ -279,6 +388,7 @@ func (p *pipeline) waitTargets(terminate <-chan struct{}, completedCh chan<- *ta
 		case targetErr := <-p.ctrlChannels.targetErr:
 			completedTarget = targetErr.Target
 			completedTargetError = targetErr.Err
+			completedTargetStep = targetErr.stepLabel
 		}
 
 		if err != nil {
@@ -292,12 +402,21 @@ func (p *pipeline) waitTargets(terminate <-chan struct{}, completedCh chan<- *ta
 
 		if completedTarget != nil {
 			p.state.SetTarget(completedTarget, completedTargetError)
+			if p.emitResults {
+				p.emitTargetResult(completedTarget, newTargetResult(completedTargetError, completedTargetStep))
+			}
+			if completedTargetError != nil {
+				if err := p.checkAbortThreshold(); err != nil {
+					return err
+				}
+			}
 			log.Debugf("writing target %+v on the completed channel", completedTarget)
 			if err := writer.writeTimeout(terminate, completedCh, completedTarget, p.timeouts.MessageTimeout); err != nil {
 				log.Panicf("could not write completed target: %v", err)
 			}
 			completedTarget = nil
 			completedTargetError = nil
+			completedTargetStep = ""
 		}
 
 		numIngress := atomic.LoadUint64(&p.numIngress)
@@ -318,6 +437,89 @@ func (p *pipeline) waitTargets(terminate <-chan struct{}, completedCh chan<- *ta
 	return p.waitSteps()
 }
 
+// newTargetResult returns the result of a target which completed the pipeline
+// with the given error, if any, in the given step.
+func newTargetResult(err error, stepLabel string) target.Result {
+	if err == nil {
+		return target.Result{Outcome: target.OutcomePass}
+	}
+	result := target.Result{Outcome: target.OutcomeFail, Message: err.Error(), Step: stepLabel}
+	switch err := err.(type) {
+	case *cerrors.ErrTargetSkipped:
+		result.Outcome = target.OutcomeSkip
+		result.Message = err.Reason
+	case *cerrors.ErrTargetTimedOut, *cerrors.ErrTestStepTimedOut:
+		result.Outcome = target.OutcomeError
+	}
+	return result
+}
+
+// emitTargetResult emits a TargetResult event for a target. The event is
+// associated to the test rather than to any of its steps.
+func (p *pipeline) emitTargetResult(t *target.Target, result target.Result) {
+	log := logging.AddField(p.log, logging.FieldTargetID, t.ID)
+	payload, err := json.Marshal(result)
+	if err != nil {
+		log.Warningf("could not encode result of target %v: %v", t, err)
+		return
+	}
+	rawPayload := json.RawMessage(payload)
+	header := testevent.Header{JobID: p.jobID, RunID: p.runID, TestName: p.test.Name}
+	ev := testevent.Data{EventName: target.EventTargetResult, Target: t, Payload: &rawPayload}
+	if err := storage.NewTestEventEmitter(header).Emit(ev); err != nil {
+		log.Warningf("could not emit %v event for target %v: %v", ev, t, err)
+	}
+	p.storeTargetResult(t, result)
+}
+
+// storeTargetResult records the result of a target in the per-target results
+// table, if the storage engine maintains one. The duration is measured from
+// the time the target entered the pipeline.
+func (p *pipeline) storeTargetResult(t *target.Target, result target.Result) {
+	endTime := time.Now()
+	var duration time.Duration
+	p.ingressTimeMu.Lock()
+	if ingress, ok := p.ingressTime[t]; ok {
+		duration = endTime.Sub(ingress)
+	}
+	p.ingressTimeMu.Unlock()
+	err := storage.NewTargetResultManager().StoreTargetResult(storage.TargetResult{
+		JobID:    p.jobID,
+		RunID:    p.runID,
+		TestName: p.test.Name,
+		Target:   t,
+		Result:   result,
+		Duration: duration,
+		EndTime:  endTime,
+	})
+	if err != nil && !errors.Is(err, storage.ErrTargetResultsNotSupported) {
+		logging.AddField(p.log, logging.FieldTargetID, t.ID).Warningf("could not store result of target %v: %v", t, err)
+	}
+}
+
+// checkAbortThreshold returns an error if the number of failed targets exceeds
+// the abort threshold, in which case it also emits a TestAborted event. Skipped
+// targets are not counted as failed.
+func (p *pipeline) checkAbortThreshold() error {
+	failed := 0
+	for _, err := range p.state.CompletedTargets() {
+		if _, skipped := err.(*cerrors.ErrTargetSkipped); err != nil && !skipped {
+			failed++
+		}
+	}
+	if !p.abortThreshold.Exceeded(failed, p.numTargets) {
+		return nil
+	}
+	p.log.Warningf("aborting test, %d out of %d targets failed", failed, p.numTargets)
+	p.emitFrameworkEvent(EventTestAborted, TestAbortedPayload{
+		RunID:         p.runID,
+		TestName:      p.test.Name,
+		FailedTargets: failed,
+		TotalTargets:  p.numTargets,
+	})
+	return &cerrors.ErrAbortThresholdExceeded{Failed: failed, Total: p.numTargets}
+}
+
 // waitTermination reads results coming from result channels waiting
 // for the pipeline to completely shutdown before `ShutdownTimeout` occurs. A
 // "complete shutdown" means that all TestSteps and routing blocks have sent
@@ -430,7 +632,7 @@ func (p *pipeline) init(cancel, pause <-chan struct{}) (routeInFirst chan *targe
 	// and step executors
 	routingResultCh := make(chan routeResult)
 	stepResultCh := make(chan stepResult)
-	targetErrCh := make(chan cerrors.TargetError)
+	targetErrCh := make(chan stepTargetError)
 
 	routeIn = make(chan *target.Target)
 	for position, testStepBundle := range p.bundles {
@@ -453,6 +655,7 @@ func (p *pipeline) init(cancel, pause <-chan struct{}) (routeInFirst chan *targe
 				defer close(routeInStep)
 				numIngress := uint64(0)
 				for t := range routeInFirst {
+					p.setIngressTime(t, time.Now())
 					routeInStep <- t
 					numIngress++
 				}
@@ -479,9 +682,12 @@ func (p *pipeline) init(cancel, pause <-chan struct{}) (routeInFirst chan *targe
 		}
 		ev := storage.NewTestEventEmitterFetcher(Header)
 
-		router := newStepRouter(p.log, testStepBundle, routingChannels, ev, p.timeouts)
+		tracker := newTargetTracker()
+		router := newStepRouter(p.log, testStepBundle, routingChannels, ev, tracker, p.timeouts)
+		router.retryPolicy = p.test.RetryPolicy
+		router.header = Header
 		go router.route(routingCancelCh, routingResultCh)
-		go p.runStep(stepsCancelCh, stepsPauseCh, p.jobID, p.runID, testStepBundle, stepChannels, stepResultCh, ev)
+		go p.runStep(stepsCancelCh, stepsPauseCh, p.jobID, p.runID, testStepBundle, stepChannels, tracker, stepResultCh, ev)
 		// The input of the next routing block is the output of the current routing block
 		routeIn = routeOut
 	}
@@ -585,8 +791,30 @@ func (p *pipeline) run(cancel, pause <-chan struct{}, completedTargetsCh chan<-
 
 }
 
+func (p *pipeline) setIngressTime(t *target.Target, ingress time.Time) {
+	p.ingressTimeMu.Lock()
+	defer p.ingressTimeMu.Unlock()
+	p.ingressTime[t] = ingress
+}
+
+// targetDeadline returns the time by which a target must complete the
+// pipeline. It returns false if there is no target timeout.
+func (p *pipeline) targetDeadline(t *target.Target) (time.Time, bool) {
+	if p.timeouts.TargetTimeout <= 0 {
+		return time.Time{}, false
+	}
+	p.ingressTimeMu.Lock()
+	defer p.ingressTimeMu.Unlock()
+	ingress, ok := p.ingressTime[t]
+	if !ok {
+		return time.Time{}, false
+	}
+	return ingress.Add(p.timeouts.TargetTimeout), true
+}
+
 func newPipeline(log *logrus.Entry, bundles []test.TestStepBundle, test *test.Test, jobID types.JobID, runID types.RunID, timeouts TestRunnerTimeouts) *pipeline {
 	p := pipeline{log: log, bundles: bundles, jobID: jobID, runID: runID, test: test, timeouts: timeouts}
+	p.ingressTime = make(map[*target.Target]time.Time)
 	p.state = NewState()
 	return &p
 }
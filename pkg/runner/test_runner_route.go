@@ -13,6 +13,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/facebookincubator/contest/pkg/cerrors"
 	"github.com/facebookincubator/contest/pkg/event/testevent"
 	"github.com/facebookincubator/contest/pkg/logging"
 	"github.com/facebookincubator/contest/pkg/target"
@@ -28,6 +29,16 @@ type stepRouter struct {
 	routingChannels routingCh
 	bundle          test.TestStepBundle
 	ev              testevent.EmitterFetcher
+	// tracker keeps track of the targets that are inside the test step
+	tracker *targetTracker
+	// retryPolicy defines whether targets failing the test step are injected
+	// again into it
+	retryPolicy test.RetryPolicy
+	// retryCh is used by routeOut to send failed targets back to routeIn
+	// for a further attempt
+	retryCh chan *target.Target
+	// header identifies the test step when invoking step hooks
+	header testevent.Header
 
 	timeouts TestRunnerTimeouts
 }
@@ -47,7 +58,7 @@ func tryClose(ch chan struct{}) {
 func (r *stepRouter) routeIn(terminate <-chan struct{}) (int, error) {
 
 	stepLabel := r.bundle.TestStepLabel
-	log := logging.AddField(r.log, "step", stepLabel)
+	log := logging.AddField(r.log, logging.FieldStepLabel, stepLabel)
 	log = logging.AddField(log, "phase", "routeIn")
 
 	var (
@@ -75,17 +86,27 @@ func (r *stepRouter) routeIn(terminate <-chan struct{}) (int, error) {
 	// injectionChannels are used to inject targets into test step and return results to `routeIn`
 	injectionChannels := injectionCh{stepIn: r.routingChannels.stepIn, resultCh: injectResultCh}
 
+	// trackerChanged is set when routeIn is waiting for targets in the step
+	// to either leave it or fail and be retried, before closing its input
+	var trackerChanged <-chan struct{}
+
 	log.Debugf("initializing routeIn for %s", stepLabel)
 	targetWriter := newTargetWriter(log, r.timeouts)
 
 	for {
 		select {
+		case <-trackerChanged:
+			trackerChanged = nil
+		case t := <-r.retryCh:
+			log.Debugf("received target %v to retry", t)
+			targets.PushFront(t)
 		case <-terminate:
 			err = fmt.Errorf("termination requested for routing into %s", stepLabel)
 		case injectionResult := <-injectResultCh:
 			log.Debugf("received injection result for %v", injectionResult.target)
 			routeInProgress = false
 			if injectionResult.err != nil {
+				r.tracker.remove(injectionResult.target)
 				err = fmt.Errorf("routing failed while injecting target %+v into %s", injectionResult.target, stepLabel)
 				targetInErrEv := testevent.Data{EventName: target.EventTargetInErr, Target: injectionResult.target}
 				if err := r.ev.Emit(targetInErrEv); err != nil {
@@ -103,6 +124,10 @@ func (r *stepRouter) routeIn(terminate <-chan struct{}) (int, error) {
 				r.routingChannels.routeIn = nil
 			} else {
 				log.Debugf("received target %v in input", t)
+				if hookErr := r.beforeTarget(t); hookErr != nil {
+					err = r.rejectTarget(terminate, t, hookErr)
+					break
+				}
 				targets.PushFront(t)
 			}
 		}
@@ -118,6 +143,14 @@ func (r *stepRouter) routeIn(terminate <-chan struct{}) (int, error) {
 		// no targets currently being injected in the test step
 		if targets.Len() == 0 {
 			if r.routingChannels.routeIn == nil {
+				if r.retryPolicy.Retries > 0 {
+					if pending, changed := r.tracker.pending(); len(pending) > 0 {
+						// targets in the step might still fail and need
+						// to be injected again, keep the input open
+						trackerChanged = changed
+						continue
+					}
+				}
 				log.Debugf("input channel is closed and no more targets are available, closing step input channel")
 				close(r.routingChannels.stepIn)
 				break
@@ -127,6 +160,7 @@ func (r *stepRouter) routeIn(terminate <-chan struct{}) (int, error) {
 
 		t := targets.Back().Value.(*target.Target)
 		ingressTarget[t] = time.Now()
+		r.tracker.add(t)
 		targets.Remove(targets.Back())
 		log.Debugf("writing target %v into test step", t)
 		routeInProgress = true
@@ -152,10 +186,21 @@ func (r *stepRouter) routeIn(terminate <-chan struct{}) (int, error) {
 
 func (r *stepRouter) emitOutEvent(t *target.Target, err error) error {
 
-	log := logging.AddField(r.log, "step", r.bundle.TestStepLabel)
+	log := logging.AddField(r.log, logging.FieldStepLabel, r.bundle.TestStepLabel)
 	log = logging.AddField(log, "phase", "emitOutEvent")
+	log = logging.AddField(log, logging.FieldTargetID, t.ID)
 
-	if err != nil {
+	if skipErr, ok := err.(*cerrors.ErrTargetSkipped); ok {
+		payloadEncoded, err := json.Marshal(target.SkipPayload{Reason: skipErr.Reason})
+		if err != nil {
+			log.Warningf("could not encode target skip reason ('%s'): %v", skipErr.Reason, err)
+		}
+		rawPayload := json.RawMessage(payloadEncoded)
+		targetSkippedEv := testevent.Data{EventName: target.EventTargetSkipped, Target: t, Payload: &rawPayload}
+		if err := r.ev.Emit(targetSkippedEv); err != nil {
+			return err
+		}
+	} else if err != nil {
 		targetErrPayload := target.ErrPayload{Error: err.Error()}
 		payloadEncoded, err := json.Marshal(targetErrPayload)
 		if err != nil {
@@ -175,13 +220,113 @@ func (r *stepRouter) emitOutEvent(t *target.Target, err error) error {
 	return nil
 }
 
+// beforeTarget invokes the BeforeTarget method of the registered step hooks,
+// and returns the first error.
+func (r *stepRouter) beforeTarget(t *target.Target) error {
+	for _, hook := range test.StepHooks() {
+		if err := hook.BeforeTarget(r.header, r.bundle, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// afterTarget invokes the AfterTarget method of the registered step hooks.
+func (r *stepRouter) afterTarget(t *target.Target, err error) {
+	for _, hook := range test.StepHooks() {
+		hook.AfterTarget(r.header, r.bundle, t, err)
+	}
+}
+
+// rejectTarget fails a target which a step hook did not allow into the test
+// step. The target never enters the step, so it is not accounted for in the
+// ingress and egress counters.
+func (r *stepRouter) rejectTarget(terminate <-chan struct{}, t *target.Target, hookErr error) error {
+	log := logging.AddField(r.log, logging.FieldStepLabel, r.bundle.TestStepLabel)
+	log = logging.AddField(log, "phase", "rejectTarget")
+	log = logging.AddField(log, logging.FieldTargetID, t.ID)
+
+	log.Infof("target %s rejected by step hook: %v", t, hookErr)
+	if err := r.emitOutEvent(t, hookErr); err != nil {
+		log.Warningf("could not emit err event for target: %v", *t)
+	}
+	targetWriter := newTargetWriter(log, r.timeouts)
+	if err := targetWriter.writeTargetError(terminate, r.routingChannels.targetErr, stepTargetError{TargetError: cerrors.TargetError{Target: t, Err: hookErr}, stepLabel: r.bundle.TestStepLabel}, r.timeouts.MessageTimeout); err != nil {
+		return fmt.Errorf("could not forward rejected target %+v to the test runner: %v", t, err)
+	}
+	return nil
+}
+
+// isRetryable returns whether a target which failed a test step with the given
+// error can be injected again into the step. Skipped targets and targets which
+// ran out of time are never retried.
+func isRetryable(err error) bool {
+	switch err.(type) {
+	case *cerrors.ErrTargetSkipped, *cerrors.ErrTargetTimedOut, *cerrors.ErrTestStepTimedOut:
+		return false
+	}
+	return true
+}
+
+// isIgnorable returns whether the failure of a target can be ignored in steps
+// flagged with IgnoreFailure. Skipped targets and targets which ran out of
+// time always leave the test.
+func isIgnorable(err error) bool {
+	switch err.(type) {
+	case *cerrors.ErrTargetSkipped, *cerrors.ErrTargetTimedOut:
+		return false
+	}
+	return true
+}
+
+// emitIgnoredErrEvent emits a TargetErrIgnored event for a target which failed
+// a step flagged with IgnoreFailure.
+func (r *stepRouter) emitIgnoredErrEvent(t *target.Target, targetErr error) {
+	log := logging.AddField(r.log, logging.FieldStepLabel, r.bundle.TestStepLabel)
+	log = logging.AddField(log, "phase", "emitIgnoredErrEvent")
+	log = logging.AddField(log, logging.FieldTargetID, t.ID)
+
+	payloadEncoded, err := json.Marshal(target.ErrPayload{Error: targetErr.Error()})
+	if err != nil {
+		log.Warningf("could not encode target error ('%v'): %v", targetErr, err)
+	}
+	rawPayload := json.RawMessage(payloadEncoded)
+	ev := testevent.Data{EventName: target.EventTargetErrIgnored, Target: t, Payload: &rawPayload}
+	if err := r.ev.Emit(ev); err != nil {
+		log.Warningf("could not emit %v event for target %v: %v", ev, *t, err)
+	}
+}
+
+// retry emits a TargetRetry event for a failed target, and sends the target
+// back to routeIn to be injected again into the test step.
+func (r *stepRouter) retry(terminate <-chan struct{}, targetError cerrors.TargetError, attempt int) {
+	log := logging.AddField(r.log, logging.FieldStepLabel, r.bundle.TestStepLabel)
+	log = logging.AddField(log, "phase", "retry")
+	log = logging.AddField(log, logging.FieldTargetID, targetError.Target.ID)
+
+	log.Infof("target %s failed (%v), starting attempt %d", targetError.Target, targetError.Err, attempt)
+	payloadEncoded, err := json.Marshal(target.RetryPayload{Attempt: attempt, Error: targetError.Err.Error()})
+	if err != nil {
+		log.Warningf("could not encode retry payload: %v", err)
+	}
+	rawPayload := json.RawMessage(payloadEncoded)
+	targetRetryEv := testevent.Data{EventName: target.EventTargetRetry, Target: targetError.Target, Payload: &rawPayload}
+	if err := r.ev.Emit(targetRetryEv); err != nil {
+		log.Warningf("could not emit %v event for target %v: %v", targetRetryEv, *targetError.Target, err)
+	}
+	select {
+	case r.retryCh <- targetError.Target:
+	case <-terminate:
+	}
+}
+
 // routeOut is responsible for accepting a target from the associated test step
 // and forward it to the next routing block. Returns the number of targets
 // received from the test step or an error upon failure
 func (r *stepRouter) routeOut(terminate <-chan struct{}) (int, error) {
 
 	stepLabel := r.bundle.TestStepLabel
-	log := logging.AddField(r.log, "step", stepLabel)
+	log := logging.AddField(r.log, logging.FieldStepLabel, stepLabel)
 	log = logging.AddField(log, "phase", "routeOut")
 
 	targetWriter := newTargetWriter(log, r.timeouts)
@@ -191,6 +336,8 @@ func (r *stepRouter) routeOut(terminate <-chan struct{}) (int, error) {
 	log.Debugf("initializing routeOut for %s", stepLabel)
 	// `egressTarget` is used to keep track of egress times of a target from a test step
 	egressTarget := make(map[*target.Target]time.Time)
+	// `failedAttempts` counts how many times a target has failed the test step
+	failedAttempts := make(map[*target.Target]int)
 
 	for {
 		select {
@@ -207,6 +354,8 @@ func (r *stepRouter) routeOut(terminate <-chan struct{}) (int, error) {
 				err = fmt.Errorf("step %s returned target %+v multiple times", r.bundle.TestStepLabel, t)
 				break
 			}
+			r.tracker.remove(t)
+			r.afterTarget(t, nil)
 			// Emit an event signaling that the target has left the TestStep
 			if err := r.emitOutEvent(t, nil); err != nil {
 				log.Warningf("could not emit out event for target %v: %v", *t, err)
@@ -225,12 +374,30 @@ func (r *stepRouter) routeOut(terminate <-chan struct{}) (int, error) {
 
 			if _, targetPresent := egressTarget[targetError.Target]; targetPresent {
 				err = fmt.Errorf("step %s returned target %+v multiple times", r.bundle.TestStepLabel, targetError.Target)
+			} else if failedAttempts[targetError.Target] < int(r.retryPolicy.Retries) && isRetryable(targetError.Err) {
+				failedAttempts[targetError.Target]++
+				r.retry(terminate, targetError, failedAttempts[targetError.Target]+1)
+			} else if r.bundle.IgnoreFailure && isIgnorable(targetError.Err) {
+				// the failure is recorded, but the target proceeds to the next
+				// routing block as if it had succeeded
+				r.tracker.remove(targetError.Target)
+				r.afterTarget(targetError.Target, targetError.Err)
+				r.emitIgnoredErrEvent(targetError.Target, targetError.Err)
+				if err := r.emitOutEvent(targetError.Target, nil); err != nil {
+					log.Warningf("could not emit out event for target %v: %v", *targetError.Target, err)
+				}
+				egressTarget[targetError.Target] = time.Now()
+				if err := targetWriter.writeTimeout(terminate, r.routingChannels.routeOut, targetError.Target, r.timeouts.MessageTimeout); err != nil {
+					log.Panicf("could not forward target to the test runner: %+v", err)
+				}
 			} else {
+				r.tracker.remove(targetError.Target)
+				r.afterTarget(targetError.Target, targetError.Err)
 				if err := r.emitOutEvent(targetError.Target, targetError.Err); err != nil {
 					log.Warningf("could not emit err event for target: %v", *targetError.Target)
 				}
 				egressTarget[targetError.Target] = time.Now()
-				if err := targetWriter.writeTargetError(terminate, r.routingChannels.targetErr, targetError, r.timeouts.MessageTimeout); err != nil {
+				if err := targetWriter.writeTargetError(terminate, r.routingChannels.targetErr, stepTargetError{TargetError: targetError, stepLabel: stepLabel}, r.timeouts.MessageTimeout); err != nil {
 					log.Panicf("could not forward target (%+v) to the test runner: %v", targetError.Target, err)
 				}
 			}
@@ -307,7 +474,12 @@ func (r *stepRouter) route(terminate <-chan struct{}, resultCh chan<- routeResul
 	}
 
 	if routingErr == nil && inTargets != outTargets {
-		routingErr = fmt.Errorf("step %s completed but did not return all injected Targets (%d!=%d)", r.bundle.TestStepLabel, inTargets, outTargets)
+		lost, _ := r.tracker.pending()
+		lostErr := &cerrors.ErrTestStepLostTargets{StepName: r.bundle.TestStepLabel}
+		for _, t := range lost {
+			lostErr.Targets = append(lostErr.Targets, t.Name)
+		}
+		routingErr = lostErr
 	}
 
 	// Send the result to the test runner, which is expected to be listening
@@ -320,8 +492,16 @@ func (r *stepRouter) route(terminate <-chan struct{}, resultCh chan<- routeResul
 	}
 }
 
-func newStepRouter(log *logrus.Entry, bundle test.TestStepBundle, routingChannels routingCh, ev testevent.EmitterFetcher, timeouts TestRunnerTimeouts) *stepRouter {
-	routerLogger := logging.AddField(log, "step", bundle.TestStepLabel)
-	r := stepRouter{log: routerLogger, bundle: bundle, routingChannels: routingChannels, ev: ev, timeouts: timeouts}
+func newStepRouter(log *logrus.Entry, bundle test.TestStepBundle, routingChannels routingCh, ev testevent.EmitterFetcher, tracker *targetTracker, timeouts TestRunnerTimeouts) *stepRouter {
+	routerLogger := logging.AddField(log, logging.FieldStepLabel, bundle.TestStepLabel)
+	r := stepRouter{
+		log:             routerLogger,
+		bundle:          bundle,
+		routingChannels: routingChannels,
+		ev:              ev,
+		tracker:         tracker,
+		retryCh:         make(chan *target.Target),
+		timeouts:        timeouts,
+	}
 	return &r
 }
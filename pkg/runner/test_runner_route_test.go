@@ -50,7 +50,7 @@ type TestRunnerSuite struct {
 	stepOutCh chan<- *target.Target
 	stepErrCh chan<- cerrors.TargetError
 
-	targetErrCh <-chan cerrors.TargetError
+	targetErrCh <-chan stepTargetError
 }
 
 func (suite *TestRunnerSuite) SetupTest() {
@@ -77,7 +77,7 @@ func (suite *TestRunnerSuite) SetupTest() {
 	stepInCh := make(chan *target.Target)
 	stepOutCh := make(chan *target.Target)
 	stepErrCh := make(chan cerrors.TargetError)
-	targetErrCh := make(chan cerrors.TargetError)
+	targetErrCh := make(chan stepTargetError)
 
 	suite.routeInCh = routeInCh
 	suite.routeOutCh = routeOutCh
@@ -114,7 +114,7 @@ func (suite *TestRunnerSuite) SetupTest() {
 		StepShutdownTimeout: 5 * time.Second,
 	}
 
-	suite.router = newStepRouter(log, bundle, suite.routingChannels, ev, timeouts)
+	suite.router = newStepRouter(log, bundle, suite.routingChannels, ev, newTargetTracker(), timeouts)
 }
 
 func (suite *TestRunnerSuite) TestRouteInRoutesAllTargets() {
@@ -397,6 +397,127 @@ func (suite *TestRunnerSuite) TestRouteOutRoutesAllFailedTargets() {
 	}
 }
 
+func (suite *TestRunnerSuite) TestRouteRetriesFailedTargets() {
+
+	// test that a target failing the step is injected again into the step,
+	// and that the step input is closed only after the target left the step
+	suite.router.retryPolicy = test.RetryPolicy{Retries: 1}
+	tgt := &target.Target{Name: "host001", ID: "001", FQDN: "host001.facebook.com"}
+
+	terminate := make(chan struct{})
+	defer close(terminate)
+	resultCh := make(chan routeResult)
+	go suite.router.route(terminate, resultCh)
+
+	suite.routeInCh <- tgt
+	close(suite.routeInCh)
+
+	readStepIn := func() *target.Target {
+		select {
+		case t := <-suite.stepInCh:
+			return t
+		case <-time.After(2 * time.Second):
+			suite.T().Fatalf("target should be injected into the step within timeout")
+		}
+		return nil
+	}
+	require.Equal(suite.T(), tgt, readStepIn())
+	suite.stepErrCh <- cerrors.TargetError{Target: tgt, Err: fmt.Errorf("test error")}
+	// the target is injected again
+	require.Equal(suite.T(), tgt, readStepIn())
+	suite.stepOutCh <- tgt
+	select {
+	case t := <-suite.routeOutCh:
+		require.Equal(suite.T(), tgt, t)
+	case <-time.After(2 * time.Second):
+		suite.T().Fatalf("target should be forwarded within timeout")
+	}
+	// no more targets will be retried, the step input is closed
+	require.Nil(suite.T(), readStepIn())
+
+	close(suite.stepOutCh)
+	close(suite.stepErrCh)
+	select {
+	case res := <-resultCh:
+		require.NoError(suite.T(), res.err)
+	case <-time.After(2 * time.Second):
+		suite.T().Fatalf("routing should complete within timeout")
+	}
+}
+
+type rejectingStepHook struct {
+	test.NoopStepHook
+	reject string
+	after  chan *target.Target
+}
+
+func (h *rejectingStepHook) BeforeTarget(header testevent.Header, bundle test.TestStepBundle, t *target.Target) error {
+	if t.Name == h.reject {
+		return fmt.Errorf("target %s not allowed", t.Name)
+	}
+	return nil
+}
+
+func (h *rejectingStepHook) AfterTarget(header testevent.Header, bundle test.TestStepBundle, t *target.Target, err error) {
+	h.after <- t
+}
+
+func (suite *TestRunnerSuite) TestRouteStepHooks() {
+
+	// test that a target rejected by a step hook is failed without entering
+	// the step, and that hooks are notified of targets leaving the step
+	hook := &rejectingStepHook{reject: "host002", after: make(chan *target.Target, 2)}
+	require.NoError(suite.T(), test.RegisterStepHook("TestRouteStepHooks", hook))
+	defer test.UnregisterStepHook("TestRouteStepHooks")
+
+	allowed := &target.Target{Name: "host001", ID: "001", FQDN: "host001.facebook.com"}
+	rejected := &target.Target{Name: "host002", ID: "002", FQDN: "host002.facebook.com"}
+
+	terminate := make(chan struct{})
+	defer close(terminate)
+	resultCh := make(chan routeResult)
+	go suite.router.route(terminate, resultCh)
+
+	go func() {
+		suite.routeInCh <- allowed
+		suite.routeInCh <- rejected
+		close(suite.routeInCh)
+	}()
+
+	var stepIn <-chan *target.Target = suite.stepInCh
+	for stepIn != nil || allowed != nil || rejected != nil {
+		select {
+		case t, ok := <-stepIn:
+			if !ok {
+				stepIn = nil
+				break
+			}
+			require.Equal(suite.T(), allowed, t)
+			suite.stepOutCh <- t
+		case t := <-suite.routeOutCh:
+			require.Equal(suite.T(), allowed, t)
+			allowed = nil
+		case targetErr := <-suite.targetErrCh:
+			require.Equal(suite.T(), rejected, targetErr.Target)
+			require.Error(suite.T(), targetErr.Err)
+			rejected = nil
+		case <-time.After(2 * time.Second):
+			suite.T().Fatalf("targets should be routed within timeout")
+		}
+	}
+	require.Equal(suite.T(), "host001", (<-hook.after).Name)
+	require.Len(suite.T(), hook.after, 0)
+
+	close(suite.stepOutCh)
+	close(suite.stepErrCh)
+	select {
+	case res := <-resultCh:
+		require.NoError(suite.T(), res.err)
+	case <-time.After(2 * time.Second):
+		suite.T().Fatalf("routing should complete within timeout")
+	}
+}
+
 func TestTestRunnerSuite(t *testing.T) {
 	TestRunnerSuite := &TestRunnerSuite{}
 	suite.Run(t, TestRunnerSuite)
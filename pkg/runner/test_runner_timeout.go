@@ -0,0 +1,283 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/cerrors"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// runStepWithTimeouts runs a TestStep for which a step timeout or a target
+// timeout is configured. The step is connected to intermediate channels, so
+// that the targets which are being processed by the step are known at any
+// time.
+//
+// If a target exceeds the target timeout while in the step, it is forwarded to
+// the error channel with an ErrTargetTimedOut error, and it is dropped if the
+// step returns it afterwards. Once the step has no targets left to process
+// other than timed out ones, its context is cancelled.
+//
+// If the step does not return before the step timeout expires, which is also
+// the deadline of its context, it is abandoned: a StepTimeout framework event
+// is emitted, and all the targets that the step has not returned yet, as well
+// as the ones still to be injected, are forwarded to the error channel with
+// an ErrTestStepTimedOut error. The abandoned step is not waited for.
+//
+// run runs or resumes the step on the given channels.
+func (p *pipeline) runStepWithTimeouts(ctx context.Context, cancel, pause <-chan struct{}, runID types.RunID, bundle test.TestStepBundle, ch test.TestStepChannels, run func(context.Context, test.TestStepChannels) error) error {
+
+	stepLabel := bundle.TestStepLabel
+	log := logging.AddField(p.log, logging.FieldStepLabel, stepLabel)
+	log = logging.AddField(log, "phase", "runStepWithTimeouts")
+
+	stepIn := make(chan *target.Target)
+	stepOut := make(chan *target.Target)
+	stepErr := make(chan cerrors.TargetError)
+	// the context of the step is done upon cancellation or pause of the
+	// pipeline, upon timeout, or when the step is released
+	var (
+		stepCtx    context.Context
+		stepCancel context.CancelFunc
+	)
+	if bundle.Timeout > 0 {
+		stepCtx, stepCancel = context.WithTimeout(ctx, bundle.Timeout)
+	} else {
+		stepCtx, stepCancel = context.WithCancel(ctx)
+	}
+	defer stepCancel()
+
+	// done is buffered, as nobody will read it if the step is abandoned
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err := &cerrors.ErrTestStepPanicked{StepName: stepLabel, Value: fmt.Sprintf("%v", r), Stack: string(debug.Stack())}
+				log.Errorf("%v: %s", err, err.Stack)
+				p.emitPanicEvent(runID, bundle, err)
+				done <- err
+			}
+		}()
+		channels := test.TestStepChannels{In: stepIn, Out: stepOut, Err: stepErr}
+		done <- run(stepCtx, channels)
+	}()
+
+	var (
+		in = ch.In
+		// pending is a target which has been received, but not yet injected
+		// into the step
+		pending  *target.Target
+		inFlight = make(map[*target.Target]struct{})
+		// expired holds the targets which have been failed because they
+		// exceeded the target timeout while in the step
+		expired = make(map[*target.Target]struct{})
+		// released is set if the step has been asked to return because all
+		// of its remaining targets timed out
+		released bool
+	)
+	targetTimeoutErr := &cerrors.ErrTargetTimedOut{Timeout: p.timeouts.TargetTimeout}
+
+	var stepTimeout <-chan time.Time
+	if bundle.Timeout > 0 {
+		timer := time.NewTimer(bundle.Timeout)
+		defer timer.Stop()
+		stepTimeout = timer.C
+	}
+
+	for {
+		if in == nil && pending == nil && len(inFlight) == 0 && len(expired) > 0 && !released {
+			// the step is still processing targets which timed out, and it
+			// won't receive any more targets: ask it to return
+			log.Debugf("all the remaining targets timed out, cancelling step")
+			stepCancel()
+			released = true
+		}
+		var (
+			readCh   <-chan *target.Target
+			injectCh chan<- *target.Target
+		)
+		if pending == nil {
+			readCh = in
+		} else {
+			injectCh = stepIn
+		}
+		var (
+			targetTimer   *time.Timer
+			targetTimeout <-chan time.Time
+		)
+		if deadline, ok := p.nextDeadline(pending, inFlight); ok {
+			targetTimer = time.NewTimer(time.Until(deadline))
+			targetTimeout = targetTimer.C
+		}
+		select {
+		case t, ok := <-readCh:
+			if !ok {
+				log.Debugf("input channel closed")
+				in = nil
+				close(stepIn)
+				break
+			}
+			pending = t
+		case injectCh <- pending:
+			inFlight[pending] = struct{}{}
+			pending = nil
+		case t := <-stepOut:
+			if _, ok := expired[t]; ok {
+				log.Debugf("dropping target %s returned after its timeout", t)
+				delete(expired, t)
+				break
+			}
+			delete(inFlight, t)
+			select {
+			case ch.Out <- t:
+			case <-cancel:
+			case <-pause:
+			}
+		case targetErr := <-stepErr:
+			if _, ok := expired[targetErr.Target]; ok {
+				log.Debugf("dropping target %s returned after its timeout", targetErr.Target)
+				delete(expired, targetErr.Target)
+				break
+			}
+			delete(inFlight, targetErr.Target)
+			select {
+			case ch.Err <- targetErr:
+			case <-cancel:
+			case <-pause:
+			}
+		case err := <-done:
+			if released && err != nil {
+				log.Infof("step returned after being cancelled due to target timeouts: %v", err)
+				return nil
+			}
+			return err
+		case <-targetTimeout:
+			if pending != nil && p.targetExpired(pending) {
+				// the target has not been injected into the step yet, so
+				// the step will not return it
+				log.Infof("target %s timed out before being injected", pending)
+				if !failTarget(cancel, pause, ch.Err, pending, targetTimeoutErr) {
+					return nil
+				}
+				pending = nil
+			}
+			for t := range inFlight {
+				if !p.targetExpired(t) {
+					continue
+				}
+				log.Infof("target %s timed out", t)
+				delete(inFlight, t)
+				expired[t] = struct{}{}
+				if !failTarget(cancel, pause, ch.Err, t, targetTimeoutErr) {
+					return nil
+				}
+			}
+		case <-stepTimeout:
+			stepCancel()
+			if pending != nil {
+				inFlight[pending] = struct{}{}
+			}
+			if targetTimer != nil {
+				targetTimer.Stop()
+			}
+			return p.abandonStep(cancel, pause, runID, bundle, in, inFlight, ch.Err)
+		}
+		if targetTimer != nil {
+			targetTimer.Stop()
+		}
+	}
+}
+
+// nextDeadline returns the earliest deadline among the given targets, if any
+func (p *pipeline) nextDeadline(pending *target.Target, inFlight map[*target.Target]struct{}) (time.Time, bool) {
+	var (
+		next  time.Time
+		found bool
+	)
+	check := func(t *target.Target) {
+		if deadline, ok := p.targetDeadline(t); ok && (!found || deadline.Before(next)) {
+			next, found = deadline, true
+		}
+	}
+	if pending != nil {
+		check(pending)
+	}
+	for t := range inFlight {
+		check(t)
+	}
+	return next, found
+}
+
+// targetExpired returns whether a target has exceeded the target timeout
+func (p *pipeline) targetExpired(t *target.Target) bool {
+	deadline, ok := p.targetDeadline(t)
+	return ok && !time.Now().Before(deadline)
+}
+
+// failTarget forwards a target to the error channel of a step. It returns
+// false if cancellation or pause were requested in the meantime.
+func failTarget(cancel, pause <-chan struct{}, errCh chan<- cerrors.TargetError, t *target.Target, err error) bool {
+	select {
+	case errCh <- cerrors.TargetError{Target: t, Err: err}:
+		return true
+	case <-cancel:
+	case <-pause:
+	}
+	return false
+}
+
+// abandonStep handles the expiration of the timeout of a step, by marking as
+// failed the targets that the step did not return and the ones which are still
+// to be injected.
+func (p *pipeline) abandonStep(cancel, pause <-chan struct{}, runID types.RunID, bundle test.TestStepBundle, in <-chan *target.Target, inFlight map[*target.Target]struct{}, errCh chan<- cerrors.TargetError) error {
+	log := logging.AddField(p.log, logging.FieldStepLabel, bundle.TestStepLabel)
+	log.Warningf("step did not complete within %v, abandoning it with %d targets in flight", bundle.Timeout, len(inFlight))
+
+	timeoutErr := &cerrors.ErrTestStepTimedOut{StepName: bundle.TestStepLabel, Timeout: bundle.Timeout}
+	targetNames := make([]string, 0, len(inFlight))
+	for t := range inFlight {
+		targetNames = append(targetNames, t.Name)
+	}
+	p.emitFrameworkEvent(EventStepTimeout, StepTimeoutPayload{
+		RunID:         runID,
+		TestName:      p.test.Name,
+		TestStepLabel: bundle.TestStepLabel,
+		Timeout:       bundle.Timeout.String(),
+		Targets:       targetNames,
+	})
+
+	for t := range inFlight {
+		if !failTarget(cancel, pause, errCh, t, timeoutErr) {
+			return nil
+		}
+	}
+	if in == nil {
+		return nil
+	}
+	// targets which are injected after the timeout are failed right away
+	for {
+		select {
+		case t, ok := <-in:
+			if !ok {
+				return nil
+			}
+			if !failTarget(cancel, pause, errCh, t, timeoutErr) {
+				return nil
+			}
+		case <-cancel:
+			return nil
+		case <-pause:
+			return nil
+		}
+	}
+}
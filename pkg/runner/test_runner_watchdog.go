@@ -0,0 +1,87 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package runner
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/target"
+)
+
+// targetTracker keeps track of the targets which have been injected into a
+// TestStep and which the TestStep has not returned yet. It is updated by the
+// routing block associated to the step, and it is used by the step runner as
+// a watchdog for targets which are lost by the step, i.e. targets which are
+// neither forwarded nor errored after the step returned.
+type targetTracker struct {
+	mu      sync.Mutex
+	targets map[*target.Target]struct{}
+	// changed is closed and replaced every time a target is returned by the step
+	changed chan struct{}
+}
+
+// add records that a target has been injected into the step
+func (t *targetTracker) add(tgt *target.Target) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.targets[tgt] = struct{}{}
+}
+
+// remove records that a target has been returned by the step
+func (t *targetTracker) remove(tgt *target.Target) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.targets, tgt)
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// pending returns the targets which have not been returned by the step yet,
+// sorted by name, and a channel which is closed upon the next change.
+func (t *targetTracker) pending() ([]*target.Target, <-chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	targets := make([]*target.Target, 0, len(t.targets))
+	for tgt := range t.targets {
+		targets = append(targets, tgt)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].Name < targets[j].Name
+	})
+	return targets, t.changed
+}
+
+// waitLost waits up to `timeout` for all the targets injected into the step
+// to be returned, and returns the ones which are still missing afterwards.
+// Waiting is interrupted by the cancel and pause signals.
+func (t *targetTracker) waitLost(cancel, pause <-chan struct{}, timeout time.Duration) []*target.Target {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		targets, changed := t.pending()
+		if len(targets) == 0 {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return targets
+		case <-cancel:
+			return targets
+		case <-pause:
+			return targets
+		}
+	}
+}
+
+func newTargetTracker() *targetTracker {
+	return &targetTracker{
+		targets: make(map[*target.Target]struct{}),
+		changed: make(chan struct{}),
+	}
+}
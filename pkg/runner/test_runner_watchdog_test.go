@@ -0,0 +1,33 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package runner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetTrackerWaitLost(t *testing.T) {
+	t1 := &target.Target{Name: "host001"}
+	t2 := &target.Target{Name: "host002"}
+	tracker := newTargetTracker()
+	tracker.add(t1)
+	tracker.add(t2)
+
+	// t1 is returned within the grace period, t2 is lost
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		tracker.remove(t1)
+	}()
+	lost := tracker.waitLost(nil, nil, 200*time.Millisecond)
+	require.Equal(t, []*target.Target{t2}, lost)
+
+	tracker.remove(t2)
+	require.Empty(t, tracker.waitLost(nil, nil, 0))
+}
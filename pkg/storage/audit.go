@@ -0,0 +1,100 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// ErrAuditNotSupported is returned by AuditManager when the storage engine
+// does not implement AuditStorage.
+var ErrAuditNotSupported = errors.New("storage engine does not support the audit log")
+
+// AuditRecord is an entry of the audit log, recording an API call which
+// changed the state of jobs or of the server. RequestID is the ID of the
+// request which made the call, if any. Action is the type of the call, e.g.
+// start or stop, and JobID the job it affected or started, if any.
+// PayloadHash is the hex encoded SHA-256 hash of the JSON encoded arguments
+// of the call, and Error why the call failed, if it did.
+type AuditRecord struct {
+	ID          int64
+	Time        time.Time
+	ServerID    string
+	RequestID   string
+	Requestor   string
+	Action      string
+	JobID       types.JobID
+	PayloadHash string
+	Error       string
+}
+
+// AuditQuery defines which records are returned by
+// AuditStorage.GetAuditRecords. Fields only restrict the records if set.
+// Limit is the maximum number of records returned, if positive, and Offset
+// is the number of matching records skipped.
+type AuditQuery struct {
+	Requestor string
+	Action    string
+	JobID     types.JobID
+	StartTime time.Time
+	EndTime   time.Time
+	Limit     uint
+	Offset    uint
+}
+
+// AuditStorage is implemented by storage engines which maintain the audit
+// log. Records are never updated nor deleted, and GetAuditRecords returns
+// them in the order they were stored.
+type AuditStorage interface {
+	StoreAuditRecord(record *AuditRecord) error
+	GetAuditRecords(query *AuditQuery) ([]AuditRecord, error)
+}
+
+// AuditManager stores and fetches audit records via the storage engine, if
+// it supports it. Records are always read from the main storage engine.
+type AuditManager struct{}
+
+func auditStorage() (AuditStorage, error) {
+	s, ok := storage.(AuditStorage)
+	if !ok {
+		return nil, ErrAuditNotSupported
+	}
+	return s, nil
+}
+
+// StoreAuditRecord appends a record to the audit log
+func (m AuditManager) StoreAuditRecord(record *AuditRecord) error {
+	s, err := auditStorage()
+	if err != nil {
+		return err
+	}
+	if err := s.StoreAuditRecord(record); err != nil {
+		return fmt.Errorf("could not store audit record of %s by %s: %v", record.Action, record.Requestor, err)
+	}
+	return nil
+}
+
+// GetAuditRecords fetches the audit records matching the query
+func (m AuditManager) GetAuditRecords(query *AuditQuery) ([]AuditRecord, error) {
+	s, err := auditStorage()
+	if err != nil {
+		return nil, err
+	}
+	records, err := s.GetAuditRecords(query)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch audit records: %v", err)
+	}
+	return records, nil
+}
+
+// NewAuditManager creates a new AuditManager object
+func NewAuditManager() AuditManager {
+	return AuditManager{}
+}
@@ -0,0 +1,133 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// ErrClusterNotSupported is returned by ClusterManager when the storage
+// engine does not implement ClusterStorage.
+var ErrClusterNotSupported = errors.New("storage engine does not support clusters of servers")
+
+// Server is a ConTest server of a cluster sharing the storage engine, and
+// the time of the last heartbeat it recorded.
+type Server struct {
+	ID            string
+	LastHeartbeat time.Time
+}
+
+// ClusterStorage is implemented by storage engines which several servers can
+// share, so that the jobs of the servers which stopped are taken over by the
+// other ones. Now returns the current time of the storage engine, which the
+// servers use as a shared clock. Heartbeat records that a server is alive at
+// the given time. ListServers returns the servers which recorded a heartbeat, sorted by ID.
+// ClaimJob hands a job of a server over to another server, unless it was
+// already claimed, and returns whether it did. ForgetServer deletes a server
+// unless it recorded a heartbeat at or after the given time.
+type ClusterStorage interface {
+	Now() (time.Time, error)
+	Heartbeat(serverID string, now time.Time) error
+	ListServers() ([]Server, error)
+	ClaimJob(jobID types.JobID, fromServerID, toServerID string) (bool, error)
+	ForgetServer(serverID string, before time.Time) error
+}
+
+// ClusterManager records the servers of a cluster and the ownership of their
+// jobs via the storage engine, if it supports it. It always uses the main
+// storage engine, as servers must see the heartbeats and claims of the other
+// ones.
+type ClusterManager struct{}
+
+func clusterStorage() (ClusterStorage, error) {
+	s, ok := storage.(ClusterStorage)
+	if !ok {
+		return nil, ErrClusterNotSupported
+	}
+	return s, nil
+}
+
+// CheckClusterSupported returns ErrClusterNotSupported unless the storage
+// engine supports clusters of servers.
+func CheckClusterSupported() error {
+	_, err := clusterStorage()
+	return err
+}
+
+// Now returns the current time of the storage engine, which the servers of
+// the cluster share
+func (m ClusterManager) Now() (time.Time, error) {
+	s, err := clusterStorage()
+	if err != nil {
+		return time.Time{}, err
+	}
+	now, err := s.Now()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not get the time of the storage engine: %v", err)
+	}
+	return now, nil
+}
+
+// Heartbeat records that a server is alive at the given time
+func (m ClusterManager) Heartbeat(serverID string, now time.Time) error {
+	s, err := clusterStorage()
+	if err != nil {
+		return err
+	}
+	if err := s.Heartbeat(serverID, now); err != nil {
+		return fmt.Errorf("could not record heartbeat of server %s: %v", serverID, err)
+	}
+	return nil
+}
+
+// ListServers fetches the servers of the cluster, sorted by ID
+func (m ClusterManager) ListServers() ([]Server, error) {
+	s, err := clusterStorage()
+	if err != nil {
+		return nil, err
+	}
+	servers, err := s.ListServers()
+	if err != nil {
+		return nil, fmt.Errorf("could not list servers: %v", err)
+	}
+	return servers, nil
+}
+
+// ClaimJob hands a job of a server over to another server, and returns
+// whether it did, i.e. whether the job still belonged to the former server
+func (m ClusterManager) ClaimJob(jobID types.JobID, fromServerID, toServerID string) (bool, error) {
+	s, err := clusterStorage()
+	if err != nil {
+		return false, err
+	}
+	claimed, err := s.ClaimJob(jobID, fromServerID, toServerID)
+	if err != nil {
+		return false, fmt.Errorf("could not claim job %d of server %s: %v", jobID, fromServerID, err)
+	}
+	return claimed, nil
+}
+
+// ForgetServer deletes a server, unless it recorded a heartbeat at or after
+// the given time, e.g. because it restarted meanwhile
+func (m ClusterManager) ForgetServer(serverID string, before time.Time) error {
+	s, err := clusterStorage()
+	if err != nil {
+		return err
+	}
+	if err := s.ForgetServer(serverID, before); err != nil {
+		return fmt.Errorf("could not forget server %s: %v", serverID, err)
+	}
+	return nil
+}
+
+// NewClusterManager creates a new ClusterManager object
+func NewClusterManager() ClusterManager {
+	return ClusterManager{}
+}
@@ -6,11 +6,15 @@
 package storage
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"time"
 
+	"github.com/facebookincubator/contest/pkg/artifact"
 	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
 	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/tracing"
 )
 
 // TestEventEmitter implements Emitter interface from the testevent package
@@ -20,6 +24,8 @@ type TestEventEmitter struct {
 
 // TestEventFetcher implements the Fetcher interface from the testevent package
 type TestEventFetcher struct {
+	// Consistency is the consistency model of the fetched events
+	Consistency ConsistencyModel
 }
 
 // TestEventEmitterFetcher implements Emitter and Fetcher interface of the testevent package
@@ -31,19 +37,46 @@ type TestEventEmitterFetcher struct {
 // Emit emits an event using the selected storage layer
 func (e TestEventEmitter) Emit(data testevent.Data) error {
 	event := testevent.Event{Header: &e.header, Data: &data, EmitTime: time.Now()}
-	if err := storage.StoreTestEvent(event); err != nil {
+	span := tracing.StartIn(tracing.Key{
+		JobID:         e.header.JobID,
+		RunID:         e.header.RunID,
+		TestName:      e.header.TestName,
+		TestStepLabel: e.header.TestStepLabel,
+	}, "store test event", tracing.Attr("event.name", data.EventName))
+	err := storage.StoreTestEvent(event)
+	span.End(err)
+	observeEventWrite("test", event.EmitTime, err)
+	if err != nil {
 		return fmt.Errorf("could not persist event data %v: %v", data, err)
 	}
+	forwardTestEvent(event)
 	return nil
 }
 
+// EmitArtifact stores an artifact using the selected artifact store, and emits
+// an event referencing it. It implements the Emitter interface from the
+// artifact package.
+func (e TestEventEmitter) EmitArtifact(data testevent.Data, name string, r io.Reader) error {
+	ref, err := artifact.Put(artifact.Key(e.header, data.Target, name), name, r)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(artifact.Payload{Artifacts: []artifact.Ref{*ref}})
+	if err != nil {
+		return fmt.Errorf("could not encode artifact payload: %v", err)
+	}
+	rm := json.RawMessage(payload)
+	data.Payload = &rm
+	return e.Emit(data)
+}
+
 // Fetch retrieves events based on QueryFields that are used to build a Query object for TestEvents
 func (ev TestEventFetcher) Fetch(queryFields ...testevent.QueryField) ([]testevent.Event, error) {
 	eventQuery, err := testevent.QueryFields(queryFields).BuildQuery()
 	if err != nil {
 		return nil, fmt.Errorf("unable to build a query: %w", err)
 	}
-	return storage.GetTestEvents(eventQuery)
+	return engine(ev.Consistency).GetTestEvents(eventQuery)
 }
 
 // NewTestEventEmitter creates a new Emitter object associated with a Header
@@ -70,6 +103,8 @@ type FrameworkEventEmitter struct {
 
 // FrameworkEventFetcher implements the Fetcher interface from the frameworkevent package
 type FrameworkEventFetcher struct {
+	// Consistency is the consistency model of the fetched events
+	Consistency ConsistencyModel
 }
 
 // FrameworkEventEmitterFetcher implements Emitter and Fetcher interface from the frameworkevent package
@@ -80,9 +115,15 @@ type FrameworkEventEmitterFetcher struct {
 
 // Emit emits an event using the selected storage engine
 func (ev FrameworkEventEmitter) Emit(event frameworkevent.Event) error {
-	if err := storage.StoreFrameworkEvent(event); err != nil {
+	start := time.Now()
+	span := tracing.StartIn(tracing.Key{JobID: event.JobID}, "store framework event", tracing.Attr("event.name", event.EventName))
+	err := storage.StoreFrameworkEvent(event)
+	span.End(err)
+	observeEventWrite("framework", start, err)
+	if err != nil {
 		return fmt.Errorf("could not persist event %v: %v", event, err)
 	}
+	forwardFrameworkEvent(event)
 	return nil
 }
 
@@ -92,7 +133,7 @@ func (ev FrameworkEventFetcher) Fetch(queryFields ...frameworkevent.QueryField)
 	if err != nil {
 		return nil, fmt.Errorf("unable to build a query: %w", err)
 	}
-	return storage.GetFrameworkEvent(eventQuery)
+	return engine(ev.Consistency).GetFrameworkEvent(eventQuery)
 }
 
 // NewFrameworkEventEmitter creates a new Emitter object for framework events
@@ -0,0 +1,59 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package storage
+
+import (
+	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/logging"
+)
+
+var log = logging.GetLogger("pkg/storage")
+
+// forwarder optionally defines where the emitted events are published once
+// persisted, e.g. a message bus. It can be set via the exported function
+// SetEventForwarder.
+var forwarder EventForwarder
+
+// EventForwarder is implemented by publishers of the emitted events, so that
+// external systems can react to them without polling the storage engine.
+// Forwarders are called synchronously by the emitters, and must not block:
+// slow publishers should queue the events. Forwarding errors do not fail the
+// emission, since the events are already persisted.
+type EventForwarder interface {
+	ForwardTestEvent(event testevent.Event) error
+	ForwardFrameworkEvent(event frameworkevent.Event) error
+}
+
+// SetEventForwarder sets the forwarder of the emitted events. If nil, events
+// are only persisted.
+func SetEventForwarder(f EventForwarder) {
+	forwarder = f
+}
+
+// forwardTestEvent publishes a persisted test event to the subscriptions and
+// to the forwarder.
+func forwardTestEvent(event testevent.Event) {
+	notify(event.Header.JobID, Notification{TestEvent: &event})
+	if forwarder == nil {
+		return
+	}
+	if err := forwarder.ForwardTestEvent(event); err != nil {
+		log.Warningf("could not forward test event %s of job %d: %v", event.Data.EventName, event.Header.JobID, err)
+	}
+}
+
+// forwardFrameworkEvent publishes a persisted framework event to the
+// subscriptions and to the forwarder.
+func forwardFrameworkEvent(event frameworkevent.Event) {
+	notify(event.JobID, Notification{FrameworkEvent: &event})
+	if forwarder == nil {
+		return
+	}
+	if err := forwarder.ForwardFrameworkEvent(event); err != nil {
+		log.Warningf("could not forward framework event %s of job %d: %v", event.EventName, event.JobID, err)
+	}
+}
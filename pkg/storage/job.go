@@ -14,6 +14,8 @@ import (
 
 // JobStorageManager implements JobStorage interface
 type JobStorageManager struct {
+	// Consistency is the consistency model of the reads
+	Consistency ConsistencyModel
 }
 
 // StoreJobRequest submits a job request to the storage layer
@@ -28,7 +30,7 @@ func (jsm JobStorageManager) StoreJobRequest(request *job.Request) (types.JobID,
 
 // GetJobRequest fetches a job request from the storage layer
 func (jsm JobStorageManager) GetJobRequest(jobID types.JobID) (*job.Request, error) {
-	request, err := storage.GetJobRequest(jobID)
+	request, err := engine(jsm.Consistency).GetJobRequest(jobID)
 	if err != nil {
 		return nil, fmt.Errorf("could not fetch job request: %v", err)
 	}
@@ -45,13 +47,27 @@ func (jsm JobStorageManager) StoreJobReport(report *job.JobReport) error {
 
 // GetJobReport fetches a job report to the storage layer
 func (jsm JobStorageManager) GetJobReport(jobID types.JobID) (*job.JobReport, error) {
-	report, err := storage.GetJobReport(jobID)
+	report, err := engine(jsm.Consistency).GetJobReport(jobID)
 	if err != nil {
 		return nil, err
 	}
 	return report, nil
 }
 
+// ListJobs lists the jobs matching the query, most recent first, if the
+// storage engine supports it
+func (jsm JobStorageManager) ListJobs(query *JobQuery) ([]types.JobID, error) {
+	lister, ok := engine(jsm.Consistency).(JobLister)
+	if !ok {
+		return nil, fmt.Errorf("storage engine does not support listing jobs")
+	}
+	jobIDs, err := lister.ListJobs(query)
+	if err != nil {
+		return nil, fmt.Errorf("could not list jobs: %v", err)
+	}
+	return jobIDs, nil
+}
+
 // NewJobStorageManager creates a new JobStorageManager object
 func NewJobStorageManager() JobStorageManager {
 	return JobStorageManager{}
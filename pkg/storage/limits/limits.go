@@ -56,6 +56,14 @@ func (v *Validator) ValidateJobName(jobName string) error {
 	return v.validate(jobName, "Job name", MaxJobNameLen)
 }
 
+// MaxJobTagLen is a max length of job tag field
+const MaxJobTagLen = 32
+
+// ValidateJobTag retruns error if the job tag does not match storage limitations
+func (v *Validator) ValidateJobTag(jobTag string) error {
+	return v.validate(jobTag, "Job tag", MaxJobTagLen)
+}
+
 // MaxEventNameLen is a max length of event name field
 const MaxEventNameLen = 32
 
@@ -63,6 +63,14 @@ func TestJobName(t *testing.T) {
 	assertLenError(t, "Job name", err)
 }
 
+func TestJobTag(t *testing.T) {
+	jd := job.JobDescriptor{TestDescriptors: []*test.TestDescriptor{{}}, JobName: "AA", Tags: []string{strings.Repeat("A", limits.MaxJobTagLen+1)}}
+	jsonJd, err := json.Marshal(&jd)
+	require.NoError(t, err)
+	_, err = jobmanager.NewJob(&pluginregistry.PluginRegistry{}, string(jsonJd))
+	assertLenError(t, "Job tag", err)
+}
+
 func TestReporterName(t *testing.T) {
 	jd := job.JobDescriptor{
 		TestDescriptors: []*test.TestDescriptor{{}},
@@ -0,0 +1,39 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package storage
+
+import (
+	"expvar"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/metrics"
+)
+
+// storageMetrics are published via expvar, as "contest_storage", and they
+// measure the events written via the storage engine, whichever it is. The
+// counter event_write_errors counts the events which could not be written,
+// and the histogram event_write_seconds is the latency of the writes, by kind
+// of event, either test or framework.
+var storageMetrics = expvar.NewMap("contest_storage")
+
+var (
+	eventWriteErrors  = metrics.NewCounterVec("kind")
+	eventWriteLatency = metrics.NewHistogramVec("kind", metrics.DefaultLatencyBuckets)
+)
+
+func init() {
+	storageMetrics.Set("event_write_errors", eventWriteErrors)
+	storageMetrics.Set("event_write_seconds", eventWriteLatency)
+}
+
+// observeEventWrite records the outcome of the write of an event of the given
+// kind, which started at the given time.
+func observeEventWrite(kind string, start time.Time, err error) {
+	eventWriteLatency.Observe(kind, time.Since(start).Seconds())
+	if err != nil {
+		eventWriteErrors.Add(kind, 1)
+	}
+}
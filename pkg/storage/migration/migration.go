@@ -0,0 +1,99 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package migration implements versioned schema migrations for the SQL
+// databases used by ConTest, so that plugins can create and upgrade their
+// schema themselves instead of requiring manual SQL scripts.
+package migration
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/facebookincubator/contest/pkg/logging"
+)
+
+var log = logging.GetLogger("pkg/storage/migration")
+
+// DefaultTable is the table recording the schema versions applied to the
+// database of the storage engines.
+const DefaultTable = "schema_migrations"
+
+// Migration upgrades the schema of a database from the previous version to
+// Version. Migrations must be append-only: once released, a migration must
+// never be changed, as databases which already applied it would not pick the
+// change.
+type Migration struct {
+	Version    int
+	Statements []string
+}
+
+// Migrate brings the schema of the database to the latest version, applying
+// each missing migration in its own transaction. The applied versions are
+// recorded in the given table, so that components sharing a database, e.g.
+// the storage and the target locker, can each track their own version.
+// Migrations must be sorted by increasing version.
+func Migrate(driverName, dbURI, table string, migrations []Migration) error {
+	registered := false
+	for _, name := range sql.Drivers() {
+		if name == driverName {
+			registered = true
+			break
+		}
+	}
+	if !registered {
+		return fmt.Errorf("no database/sql driver registered as '%s': ConTest must be built importing it", driverName)
+	}
+	db, err := sql.Open(driverName, dbURI)
+	if err != nil {
+		return fmt.Errorf("could not initialize database: %v", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Warningf("could not close migration connection: %v", err)
+		}
+	}()
+
+	// the table name is not user input, and it cannot be a placeholder
+	if _, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		version INT PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`, table)); err != nil {
+		return fmt.Errorf("could not create migrations table %s: %v", table, err)
+	}
+	var current int
+	if err := db.QueryRow(fmt.Sprintf("SELECT COALESCE(MAX(version), 0) FROM %s", table)).Scan(&current); err != nil {
+		return fmt.Errorf("could not get schema version from %s: %v", table, err)
+	}
+	if len(migrations) > 0 && current > migrations[len(migrations)-1].Version {
+		return fmt.Errorf("schema version %d recorded in %s is newer than the latest known version %d", current, table, migrations[len(migrations)-1].Version)
+	}
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		log.Infof("Migrating database schema of %s to version %d", table, m.Version)
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("could not start migration to version %d: %v", m.Version, err)
+		}
+		for _, stmt := range m.Statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				_ = tx.Rollback()
+				return fmt.Errorf("migration to version %d failed: %v", m.Version, err)
+			}
+		}
+		// the version is an integer, so there is no need for a placeholder,
+		// whose syntax depends on the database
+		if _, err := tx.Exec(fmt.Sprintf("INSERT INTO %s (version) VALUES (%d)", table, m.Version)); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("could not record migration to version %d: %v", m.Version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("could not commit migration to version %d: %v", m.Version, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package migration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateWithoutDriver(t *testing.T) {
+	err := Migrate("contest-nonexistent", "", DefaultTable, []Migration{{Version: 1, Statements: []string{"SELECT 1"}}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no database/sql driver registered")
+}
@@ -0,0 +1,211 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package retention implements a retention policy for the storage, which
+// periodically deletes old events and, optionally, old jobs, so that the
+// event tables do not grow without bound.
+package retention
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/artifact"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+var log = logging.GetLogger("pkg/storage/retention")
+
+// DefaultInterval is the default interval between two prune operations.
+const DefaultInterval = time.Hour
+
+// metrics are published via expvar, as "contest_retention". Purged counters
+// are only increased by prune operations which are not in dry-run mode.
+var metrics = expvar.NewMap("contest_retention")
+
+// Policy defines what is pruned, and when.
+type Policy struct {
+	// MaxAge is how long events, and jobs if PruneJobs is set, are kept
+	// after the jobs ended.
+	MaxAge time.Duration
+	// EndStates are the framework events marking the end of a job. Only
+	// the events and jobs of the jobs which ended are pruned, as the state
+	// of the other ones is derived from their events.
+	EndStates []event.Name
+	// Interval is the interval between two prune operations. If zero,
+	// DefaultInterval is used.
+	Interval time.Duration
+	// PruneJobs enables deleting the requests and reports of old jobs.
+	PruneJobs bool
+	// DryRun only logs how many rows would be deleted.
+	DryRun bool
+	// Archive stores the events about to be deleted in the artifact store,
+	// as JSON lines, before deleting them.
+	Archive bool
+}
+
+// Pruner applies a retention Policy to a storage engine.
+type Pruner struct {
+	policy  Policy
+	storage storage.PrunableStorage
+	fetcher storage.Storage
+}
+
+// New returns a Pruner applying the policy to the storage engine, which must
+// implement storage.PrunableStorage.
+func New(s storage.Storage, policy Policy) (*Pruner, error) {
+	ps, ok := s.(storage.PrunableStorage)
+	if !ok {
+		return nil, fmt.Errorf("storage engine %T does not support pruning", s)
+	}
+	if policy.MaxAge <= 0 {
+		return nil, fmt.Errorf("retention period must be positive, got %v", policy.MaxAge)
+	}
+	if len(policy.EndStates) == 0 {
+		return nil, fmt.Errorf("the events marking the end of the jobs are required")
+	}
+	if policy.Interval < 0 {
+		return nil, fmt.Errorf("prune interval cannot be negative, got %v", policy.Interval)
+	}
+	if policy.Interval == 0 {
+		policy.Interval = DefaultInterval
+	}
+	if policy.Archive && artifact.GetStore() == nil {
+		return nil, fmt.Errorf("archiving pruned events requires an artifact store")
+	}
+	return &Pruner{policy: policy, storage: ps, fetcher: s}, nil
+}
+
+// archive stores the encoded items under key in the artifact store.
+func archive(key string, encode func(enc *json.Encoder) error) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(encode(json.NewEncoder(pw)))
+	}()
+	_, err := artifact.Put(key, key, pr)
+	// unblock the encoder if the store failed before reading everything
+	_ = pr.CloseWithError(io.ErrClosedPipe)
+	return err
+}
+
+// archiveEvents archives the events which are about to be pruned, i.e. the
+// ones emitted before the given time by the jobs which ended before it.
+func (p *Pruner) archiveEvents(before time.Time) error {
+	// emission times are inclusive in queries, while pruning is not
+	query := event.Query{EmittedEndTime: before.Add(-time.Nanosecond)}
+	endEvents, err := p.fetcher.GetFrameworkEvent(&frameworkevent.Query{Query: event.Query{
+		EventNames:     p.policy.EndStates,
+		EmittedEndTime: query.EmittedEndTime,
+	}})
+	if err != nil {
+		return fmt.Errorf("could not fetch the end events of the jobs: %v", err)
+	}
+	ended := make(map[types.JobID]bool, len(endEvents))
+	for _, ev := range endEvents {
+		ended[ev.JobID] = true
+	}
+	allTestEvents, err := p.fetcher.GetTestEvents(&testevent.Query{Query: query})
+	if err != nil {
+		return fmt.Errorf("could not fetch test events: %v", err)
+	}
+	var testEvents []testevent.Event
+	for _, ev := range allTestEvents {
+		if ended[ev.Header.JobID] {
+			testEvents = append(testEvents, ev)
+		}
+	}
+	allFrameworkEvents, err := p.fetcher.GetFrameworkEvent(&frameworkevent.Query{Query: query})
+	if err != nil {
+		return fmt.Errorf("could not fetch framework events: %v", err)
+	}
+	var frameworkEvents []frameworkevent.Event
+	for _, ev := range allFrameworkEvents {
+		if ended[ev.JobID] {
+			frameworkEvents = append(frameworkEvents, ev)
+		}
+	}
+	prefix := fmt.Sprintf("retention/%d", before.Unix())
+	if len(testEvents) > 0 {
+		err := archive(prefix+"/test_events.json", func(enc *json.Encoder) error {
+			for _, ev := range testEvents {
+				if err := enc.Encode(ev); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not archive test events: %v", err)
+		}
+	}
+	if len(frameworkEvents) > 0 {
+		err := archive(prefix+"/framework_events.json", func(enc *json.Encoder) error {
+			for _, ev := range frameworkEvents {
+				if err := enc.Encode(ev); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not archive framework events: %v", err)
+		}
+	}
+	return nil
+}
+
+// Prune applies the policy once, deleting what is older than MaxAge before
+// now.
+func (p *Pruner) Prune(now time.Time) (storage.PruneStats, error) {
+	metrics.Add("runs", 1)
+	before := now.Add(-p.policy.MaxAge)
+	if p.policy.Archive && !p.policy.DryRun {
+		if err := p.archiveEvents(before); err != nil {
+			metrics.Add("errors", 1)
+			return storage.PruneStats{}, err
+		}
+	}
+	stats, err := p.storage.Prune(before, p.policy.EndStates, p.policy.PruneJobs, p.policy.DryRun)
+	if err != nil {
+		metrics.Add("errors", 1)
+		return stats, fmt.Errorf("could not prune storage: %v", err)
+	}
+	if p.policy.DryRun {
+		log.Infof("Dry run: would prune %d test events, %d framework events and %d jobs older than %v",
+			stats.TestEvents, stats.FrameworkEvents, stats.Jobs, before)
+		return stats, nil
+	}
+	metrics.Add("test_events_purged", stats.TestEvents)
+	metrics.Add("framework_events_purged", stats.FrameworkEvents)
+	metrics.Add("jobs_purged", stats.Jobs)
+	log.Infof("Pruned %d test events, %d framework events and %d jobs older than %v",
+		stats.TestEvents, stats.FrameworkEvents, stats.Jobs, before)
+	return stats, nil
+}
+
+// Run prunes the storage every Interval, until stop is closed. Errors are
+// logged, and the next prune operation is attempted anyway.
+func (p *Pruner) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(p.policy.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := p.Prune(time.Now()); err != nil {
+			log.Warningf("Retention policy failed: %v", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
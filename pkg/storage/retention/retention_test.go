@@ -0,0 +1,143 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package retention
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/artifact"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/facebookincubator/contest/plugins/artifactstores/localdir"
+	"github.com/facebookincubator/contest/plugins/storage/memory"
+	"github.com/stretchr/testify/require"
+)
+
+var endStates = []event.Name{"JobStateCompleted"}
+
+// setup stores jobs which ended 48h, 36h and 1h ago, and a job requested 48h
+// ago which did not end.
+func setup(t *testing.T, now time.Time) storage.Storage {
+	s, err := memory.New()
+	require.NoError(t, err)
+	for _, age := range []time.Duration{48 * time.Hour, 36 * time.Hour, time.Hour, 48 * time.Hour} {
+		jobID, err := s.StoreJobRequest(&job.Request{JobName: "job", RequestTime: now.Add(-age)})
+		require.NoError(t, err)
+		require.NoError(t, s.StoreTestEvent(testevent.Event{
+			Header:   &testevent.Header{JobID: jobID, RunID: 1, TestName: "test"},
+			Data:     &testevent.Data{EventName: "event"},
+			EmitTime: now.Add(-age),
+		}))
+		require.NoError(t, s.StoreFrameworkEvent(frameworkevent.Event{JobID: jobID, EventName: "JobStateStarted", EmitTime: now.Add(-age)}))
+		if jobID < 4 {
+			require.NoError(t, s.StoreFrameworkEvent(frameworkevent.Event{JobID: jobID, EventName: "JobStateCompleted", EmitTime: now.Add(-age)}))
+		}
+	}
+	return s
+}
+
+func TestNew(t *testing.T) {
+	s, err := memory.New()
+	require.NoError(t, err)
+	_, err = New(s, Policy{})
+	require.Error(t, err)
+	_, err = New(s, Policy{MaxAge: time.Hour})
+	require.Error(t, err)
+	_, err = New(s, Policy{MaxAge: time.Hour, EndStates: endStates, Archive: true})
+	require.Error(t, err)
+}
+
+func TestPruneDryRun(t *testing.T) {
+	now := time.Now()
+	s := setup(t, now)
+	p, err := New(s, Policy{MaxAge: 24 * time.Hour, EndStates: endStates, PruneJobs: true, DryRun: true})
+	require.NoError(t, err)
+	stats, err := p.Prune(now)
+	require.NoError(t, err)
+	require.Equal(t, storage.PruneStats{TestEvents: 2, FrameworkEvents: 4, Jobs: 2}, stats)
+
+	events, err := s.GetTestEvents(&testevent.Query{TestName: "test"})
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	s := setup(t, now)
+	p, err := New(s, Policy{MaxAge: 24 * time.Hour, EndStates: endStates})
+	require.NoError(t, err)
+	stats, err := p.Prune(now)
+	require.NoError(t, err)
+	require.Equal(t, storage.PruneStats{TestEvents: 2, FrameworkEvents: 4}, stats)
+
+	events, err := s.GetTestEvents(&testevent.Query{TestName: "test"})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	_, err = s.GetJobRequest(1)
+	require.NoError(t, err)
+}
+
+func TestPruneJobs(t *testing.T) {
+	now := time.Now()
+	s := setup(t, now)
+	p, err := New(s, Policy{MaxAge: 24 * time.Hour, EndStates: endStates, PruneJobs: true})
+	require.NoError(t, err)
+	stats, err := p.Prune(now)
+	require.NoError(t, err)
+	require.Equal(t, storage.PruneStats{TestEvents: 2, FrameworkEvents: 4, Jobs: 2}, stats)
+
+	for _, jobID := range []types.JobID{1, 2} {
+		_, err = s.GetJobRequest(jobID)
+		require.Error(t, err)
+	}
+	// the job which did not end keeps its request and its state
+	_, err = s.GetJobRequest(4)
+	require.NoError(t, err)
+	events, err := s.GetFrameworkEvent(&frameworkevent.Query{Query: event.Query{JobID: 4}})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+}
+
+func TestPruneArchive(t *testing.T) {
+	dir := t.TempDir()
+	store, err := localdir.New(dir)
+	require.NoError(t, err)
+	artifact.SetStore(store)
+	defer artifact.SetStore(nil)
+
+	now := time.Now()
+	s := setup(t, now)
+	p, err := New(s, Policy{MaxAge: 24 * time.Hour, EndStates: endStates, PruneJobs: true, Archive: true})
+	require.NoError(t, err)
+	stats, err := p.Prune(now)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), stats.Jobs)
+	_, err = s.GetJobRequest(1)
+	require.Error(t, err)
+
+	for _, name := range []string{"test_events.json", "framework_events.json"} {
+		matches, err := filepath.Glob(filepath.Join(dir, "retention", "*", name))
+		require.NoError(t, err)
+		require.Len(t, matches, 1)
+		f, err := os.Open(matches[0])
+		require.NoError(t, err)
+		lines := 0
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			lines++
+		}
+		require.NoError(t, f.Close())
+		require.Equal(t, map[string]int{"test_events.json": 2, "framework_events.json": 4}[name], lines, name)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// ErrSchedulesNotSupported is returned by ScheduleManager when the storage
+// engine does not implement ScheduleStorage.
+var ErrSchedulesNotSupported = errors.New("storage engine does not support schedules")
+
+// ErrScheduleNotFound is returned by ScheduleStorage when no schedule has
+// the requested ID.
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// Schedule is a recurring job: the job descriptor is started every time the
+// cron expression activates, unless the schedule is paused. LastRunTime is
+// the last activation time of the schedule, and LastJobID and LastError the
+// job started then, or the error which prevented it from starting.
+type Schedule struct {
+	ID            types.ScheduleID
+	Name          string
+	Requestor     string
+	Cron          string
+	JobDescriptor string
+	Paused        bool
+	CreateTime    time.Time
+	LastRunTime   time.Time
+	LastJobID     types.JobID
+	LastError     string
+}
+
+// ScheduleStorage is implemented by storage engines which store schedules.
+// ListSchedules returns the schedules in the order they were created.
+type ScheduleStorage interface {
+	StoreSchedule(schedule *Schedule) (types.ScheduleID, error)
+	UpdateSchedule(schedule *Schedule) error
+	GetSchedule(id types.ScheduleID) (*Schedule, error)
+	ListSchedules() ([]Schedule, error)
+	DeleteSchedule(id types.ScheduleID) error
+}
+
+// ScheduleManager stores and fetches schedules via the storage engine, if it
+// supports it. Schedules are always read from the main storage engine, as
+// they are updated by the server itself.
+type ScheduleManager struct{}
+
+func scheduleStorage() (ScheduleStorage, error) {
+	s, ok := storage.(ScheduleStorage)
+	if !ok {
+		return nil, ErrSchedulesNotSupported
+	}
+	return s, nil
+}
+
+// StoreSchedule stores a new schedule, and returns its ID
+func (m ScheduleManager) StoreSchedule(schedule *Schedule) (types.ScheduleID, error) {
+	s, err := scheduleStorage()
+	if err != nil {
+		return 0, err
+	}
+	id, err := s.StoreSchedule(schedule)
+	if err != nil {
+		return 0, fmt.Errorf("could not store schedule: %v", err)
+	}
+	return id, nil
+}
+
+// UpdateSchedule updates the state of a schedule
+func (m ScheduleManager) UpdateSchedule(schedule *Schedule) error {
+	s, err := scheduleStorage()
+	if err != nil {
+		return err
+	}
+	if err := s.UpdateSchedule(schedule); err != nil {
+		return fmt.Errorf("could not update schedule %d: %w", schedule.ID, err)
+	}
+	return nil
+}
+
+// GetSchedule fetches a schedule by its ID
+func (m ScheduleManager) GetSchedule(id types.ScheduleID) (*Schedule, error) {
+	s, err := scheduleStorage()
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := s.GetSchedule(id)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch schedule %d: %w", id, err)
+	}
+	return schedule, nil
+}
+
+// ListSchedules fetches all the schedules
+func (m ScheduleManager) ListSchedules() ([]Schedule, error) {
+	s, err := scheduleStorage()
+	if err != nil {
+		return nil, err
+	}
+	schedules, err := s.ListSchedules()
+	if err != nil {
+		return nil, fmt.Errorf("could not list schedules: %v", err)
+	}
+	return schedules, nil
+}
+
+// DeleteSchedule deletes a schedule. The jobs it started are kept.
+func (m ScheduleManager) DeleteSchedule(id types.ScheduleID) error {
+	s, err := scheduleStorage()
+	if err != nil {
+		return err
+	}
+	if err := s.DeleteSchedule(id); err != nil {
+		return fmt.Errorf("could not delete schedule %d: %w", id, err)
+	}
+	return nil
+}
+
+// NewScheduleManager creates a new ScheduleManager object
+func NewScheduleManager() ScheduleManager {
+	return ScheduleManager{}
+}
@@ -6,6 +6,12 @@
 package storage
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event"
 	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
 	"github.com/facebookincubator/contest/pkg/event/testevent"
 	"github.com/facebookincubator/contest/pkg/job"
@@ -16,6 +22,32 @@ import (
 // via the exported function SetStorage.
 var storage Storage
 
+// readStorage optionally defines a separate storage engine for reads which
+// tolerate stale data, e.g. backed by a replica of the database of storage,
+// so that queries from clients do not contend with writes. It can be set via
+// the exported function SetReadStorage.
+var readStorage Storage
+
+// ConsistencyModel defines how up to date the data returned by reads must be.
+type ConsistencyModel int
+
+const (
+	// ConsistentReadAfterWrite reads see all the previous writes. Such reads
+	// always go to the main storage engine.
+	ConsistentReadAfterWrite ConsistencyModel = iota
+	// ConsistentEventually reads may not see recent writes. Such reads go to
+	// the read storage engine, if one is set.
+	ConsistentEventually
+)
+
+// engine returns the storage engine serving reads with the given consistency.
+func engine(consistency ConsistencyModel) Storage {
+	if consistency == ConsistentEventually && readStorage != nil {
+		return readStorage
+	}
+	return storage
+}
+
 // JobStorage defines the interface that implements persistence for job
 // related information
 type JobStorage interface {
@@ -55,9 +87,140 @@ type ResettableStorage interface {
 	Reset() error
 }
 
+// PingableStorage is implemented by storage engines which depend on a
+// backend, e.g. a database server, to check that it is reachable.
+type PingableStorage interface {
+	Ping(ctx context.Context) error
+}
+
+// PruneStats counts the rows deleted, or which would be deleted in dry-run
+// mode, by a prune operation.
+type PruneStats struct {
+	TestEvents      int64
+	FrameworkEvents int64
+	Jobs            int64
+}
+
+// PrunableStorage is implemented by storage engines that support deleting old
+// data. Prune deletes the test and framework events emitted before the given
+// time by the jobs which ended before it, i.e. which emitted one of the given
+// final state events, and, if jobs is set, the requests and reports of those
+// jobs requested before it. The data of the other jobs is kept, as their
+// state is derived from their events. In dry-run mode, nothing is deleted and
+// the returned stats count what would be.
+type PrunableStorage interface {
+	Prune(before time.Time, endStates []event.Name, jobs, dryRun bool) (PruneStats, error)
+}
+
+// JobQuery defines which jobs are listed by JobLister.ListJobs. The unset
+// filters match every job. Limit is the maximum number of jobs returned, if
+// positive, and Offset is the number of matching jobs skipped.
+type JobQuery struct {
+	// Requestor matches the jobs of this requestor
+	Requestor string
+	// NameContains matches the jobs whose name contains this string
+	NameContains string
+	// Tags match the jobs having all these tags
+	Tags []string
+	// RequestedAfter and RequestedBefore match the jobs requested at or
+	// after, and before, these times
+	RequestedAfter  time.Time
+	RequestedBefore time.Time
+	// ScheduleID matches the jobs started by this schedule
+	ScheduleID types.ScheduleID
+	// ServerID matches the jobs started by this server
+	ServerID string
+	// RetryOf matches the retries of this job
+	RetryOf types.JobID
+	// RerunOf matches the reruns of this job
+	RerunOf types.JobID
+	Limit   uint
+	Offset  uint
+}
+
+// HasNameFilter returns whether the query filters jobs by name, which storage
+// engines may only be able to check on the decoded requests, see MatchName.
+func (q *JobQuery) HasNameFilter() bool {
+	return q.NameContains != ""
+}
+
+// MatchName returns whether the job name matches the query.
+func (q *JobQuery) MatchName(name string) bool {
+	return strings.Contains(name, q.NameContains)
+}
+
+// MatchTags returns whether the tags of a job match the query.
+func (q *JobQuery) MatchTags(jobTags []string) bool {
+	tags := make(map[string]bool, len(jobTags))
+	for _, tag := range jobTags {
+		tags[tag] = true
+	}
+	for _, tag := range q.Tags {
+		if !tags[tag] {
+			return false
+		}
+	}
+	return true
+}
+
+// Match returns whether the job request matches the query.
+func (q *JobQuery) Match(req *job.Request) bool {
+	if q.Requestor != "" && req.Requestor != q.Requestor {
+		return false
+	}
+	if q.ScheduleID != 0 && req.ScheduleID != q.ScheduleID {
+		return false
+	}
+	if q.ServerID != "" && req.ServerID != q.ServerID {
+		return false
+	}
+	if q.RetryOf != 0 && req.RetryOf != q.RetryOf {
+		return false
+	}
+	if q.RerunOf != 0 && req.RerunOf != q.RerunOf {
+		return false
+	}
+	if !q.RequestedAfter.IsZero() && req.RequestTime.Before(q.RequestedAfter) {
+		return false
+	}
+	if !q.RequestedBefore.IsZero() && !req.RequestTime.Before(q.RequestedBefore) {
+		return false
+	}
+	return q.MatchName(req.JobName) && q.MatchTags(req.Tags)
+}
+
+// JobLister is implemented by storage engines that support listing jobs.
+// ListJobs returns the IDs of the jobs matching the query, most recent first.
+type JobLister interface {
+	ListJobs(query *JobQuery) ([]types.JobID, error)
+}
+
 // SetStorage sets the desired storage engine for events. Switching to a new
 // storage engine implies garbage collecting the old one, with possible loss of
 // pending events if not flushed correctly
 func SetStorage(storageEngine Storage) {
 	storage = storageEngine
 }
+
+// SetReadStorage sets the storage engine serving eventually consistent reads.
+// If nil, all reads are served by the main storage engine.
+func SetReadStorage(storageEngine Storage) {
+	readStorage = storageEngine
+}
+
+// Ping checks that the storage engines are set and that their backends are
+// reachable. Storage engines which do not implement PingableStorage are
+// assumed to be.
+func Ping(ctx context.Context) error {
+	if storage == nil {
+		return errors.New("no storage engine set")
+	}
+	for _, s := range []Storage{storage, readStorage} {
+		if p, ok := s.(PingableStorage); ok {
+			if err := p.Ping(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/artifact"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+// namedStorage is a storage engine which only answers job requests, with
+// its name.
+type namedStorage struct {
+	Storage
+	name string
+}
+
+func (s namedStorage) GetJobRequest(jobID types.JobID) (*job.Request, error) {
+	return &job.Request{JobName: s.name}, nil
+}
+
+func (s namedStorage) GetFrameworkEvent(eventQuery *frameworkevent.Query) ([]frameworkevent.Event, error) {
+	return []frameworkevent.Event{{EventName: event.Name("from " + s.name)}}, nil
+}
+
+func TestReadStorage(t *testing.T) {
+	SetStorage(namedStorage{name: "primary"})
+	defer SetStorage(nil)
+
+	consistent := NewJobStorageManager()
+	eventual := JobStorageManager{Consistency: ConsistentEventually}
+
+	// without a read storage engine, all reads go to the main one
+	req, err := eventual.GetJobRequest(1)
+	require.NoError(t, err)
+	require.Equal(t, "primary", req.JobName)
+
+	SetReadStorage(namedStorage{name: "replica"})
+	defer SetReadStorage(nil)
+	req, err = consistent.GetJobRequest(1)
+	require.NoError(t, err)
+	require.Equal(t, "primary", req.JobName)
+	req, err = eventual.GetJobRequest(1)
+	require.NoError(t, err)
+	require.Equal(t, "replica", req.JobName)
+
+	events, err := FrameworkEventFetcher{Consistency: ConsistentEventually}.Fetch(frameworkevent.QueryJobID(1))
+	require.NoError(t, err)
+	require.Equal(t, "from replica", string(events[0].EventName))
+}
+
+// recordingStorage stores framework events, failing for the ones of job 0.
+type recordingStorage struct {
+	Storage
+}
+
+func (s recordingStorage) StoreFrameworkEvent(event frameworkevent.Event) error {
+	if event.JobID == 0 {
+		return errors.New("invalid job ID")
+	}
+	return nil
+}
+
+type recordingForwarder struct {
+	frameworkEvents []frameworkevent.Event
+}
+
+func (f *recordingForwarder) ForwardTestEvent(event testevent.Event) error {
+	return nil
+}
+
+func (f *recordingForwarder) ForwardFrameworkEvent(event frameworkevent.Event) error {
+	f.frameworkEvents = append(f.frameworkEvents, event)
+	return errors.New("forwarding errors are ignored")
+}
+
+// unreachableStorage is a storage engine whose backend is unreachable.
+type unreachableStorage struct {
+	Storage
+}
+
+func (unreachableStorage) Ping(ctx context.Context) error {
+	return errors.New("unreachable")
+}
+
+func TestPing(t *testing.T) {
+	require.Error(t, Ping(context.Background()))
+
+	SetStorage(namedStorage{name: "primary"})
+	defer SetStorage(nil)
+	require.NoError(t, Ping(context.Background()))
+
+	SetReadStorage(unreachableStorage{})
+	defer SetReadStorage(nil)
+	require.Error(t, Ping(context.Background()))
+}
+
+func TestEventForwarder(t *testing.T) {
+	SetStorage(recordingStorage{})
+	defer SetStorage(nil)
+	f := &recordingForwarder{}
+	SetEventForwarder(f)
+	defer SetEventForwarder(nil)
+
+	emitter := NewFrameworkEventEmitter()
+	require.NoError(t, emitter.Emit(frameworkevent.Event{JobID: 1, EventName: "JobStarted"}))
+	// events which are not persisted are not forwarded
+	require.Error(t, emitter.Emit(frameworkevent.Event{JobID: 0, EventName: "JobStarted"}))
+	require.Len(t, f.frameworkEvents, 1)
+	require.Equal(t, types.JobID(1), f.frameworkEvents[0].JobID)
+}
+
+// txStorage is a transactional storage engine which records how its
+// transactions end.
+type txStorage struct {
+	recordingStorage
+	committed, rolledBack *int
+}
+
+func (s txStorage) BeginTx() (TransactionalStorage, error) {
+	return s, nil
+}
+
+func (s txStorage) Commit() error {
+	*s.committed++
+	return nil
+}
+
+func (s txStorage) Rollback() error {
+	*s.rolledBack++
+	return nil
+}
+
+func TestTransact(t *testing.T) {
+	var committed, rolledBack int
+	SetStorage(txStorage{committed: &committed, rolledBack: &rolledBack})
+	defer SetStorage(nil)
+	f := &recordingForwarder{}
+	SetEventForwarder(f)
+	defer SetEventForwarder(nil)
+
+	// events are only forwarded once the transaction is committed
+	err := Transact(func(tx *Transaction) error {
+		if err := tx.Emit(frameworkevent.Event{JobID: 1, EventName: "JobStarted"}); err != nil {
+			return err
+		}
+		require.Empty(t, f.frameworkEvents)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, committed)
+	require.Len(t, f.frameworkEvents, 1)
+
+	err = Transact(func(tx *Transaction) error {
+		if err := tx.Emit(frameworkevent.Event{JobID: 2, EventName: "JobCompleted"}); err != nil {
+			return err
+		}
+		return tx.Emit(frameworkevent.Event{JobID: 0, EventName: "JobCompleted"})
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, committed)
+	require.Equal(t, 1, rolledBack)
+	require.Len(t, f.frameworkEvents, 1)
+}
+
+func TestSubscribe(t *testing.T) {
+	SetStorage(recordingStorage{})
+	defer SetStorage(nil)
+
+	job1 := Subscribe(1, 0)
+	defer job1.Close()
+	all := Subscribe(0, 1)
+	defer all.Close()
+
+	emitter := NewFrameworkEventEmitter()
+	require.NoError(t, emitter.Emit(frameworkevent.Event{JobID: 1, EventName: "JobStarted"}))
+	require.NoError(t, emitter.Emit(frameworkevent.Event{JobID: 2, EventName: "JobStarted"}))
+
+	n := <-job1.Events
+	require.Equal(t, types.JobID(1), n.FrameworkEvent.JobID)
+	require.Empty(t, job1.Events)
+	require.False(t, job1.Overflowed())
+
+	// the second event does not fit in the buffer
+	n, ok := <-all.Events
+	require.True(t, ok)
+	require.Equal(t, types.JobID(1), n.FrameworkEvent.JobID)
+	_, ok = <-all.Events
+	require.False(t, ok)
+	require.True(t, all.Overflowed())
+
+	job1.Close()
+	_, ok = <-job1.Events
+	require.False(t, ok)
+}
+
+// testEventStorage records the test events it stores.
+type testEventStorage struct {
+	Storage
+	events *[]testevent.Event
+}
+
+func (s testEventStorage) StoreTestEvent(event testevent.Event) error {
+	*s.events = append(*s.events, event)
+	return nil
+}
+
+// memArtifactStore is an artifact store keeping artifacts in memory.
+type memArtifactStore map[string][]byte
+
+func (memArtifactStore) Name() string {
+	return "mem"
+}
+
+func (s memArtifactStore) Put(key string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	s[key] = data
+	return err
+}
+
+func (s memArtifactStore) Get(key string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(s[key])), nil
+}
+
+func TestEmitArtifact(t *testing.T) {
+	var events []testevent.Event
+	SetStorage(testEventStorage{events: &events})
+	defer SetStorage(nil)
+
+	header := testevent.Header{JobID: 1, RunID: 2, TestName: "test", TestStepLabel: "step"}
+	emitter := NewTestEventEmitter(header).(artifact.Emitter)
+	tgt := &target.Target{ID: "T1"}
+	data := testevent.Data{EventName: "CrashCollectLog", Target: tgt}
+
+	// without an artifact store, nothing is emitted
+	require.Equal(t, artifact.ErrNoStore, emitter.EmitArtifact(data, "dmesg.txt", strings.NewReader("kernel log")))
+	require.Empty(t, events)
+
+	store := memArtifactStore{}
+	artifact.SetStore(store)
+	defer artifact.SetStore(nil)
+	payload := json.RawMessage(`"replaced"`)
+	data.Payload = &payload
+	require.NoError(t, emitter.EmitArtifact(data, "dmesg.txt", strings.NewReader("kernel log")))
+	require.Equal(t, "kernel log", string(store["1/2/test/step/T1/dmesg.txt"]))
+
+	require.Len(t, events, 1)
+	require.Equal(t, header, *events[0].Header)
+	require.Equal(t, event.Name("CrashCollectLog"), events[0].Data.EventName)
+	require.Equal(t, tgt, events[0].Data.Target)
+	require.JSONEq(t, `{"Artifacts": [{
+		"Store": "mem",
+		"Key": "1/2/test/step/T1/dmesg.txt",
+		"Name": "dmesg.txt",
+		"Size": 10,
+		"SHA256": "e034eba3dba42a465b0c9370d9a1ae7e08433ca1ac7e0f1dd011c23a49cdff1c"
+	}]}`, string(*events[0].Data.Payload))
+}
@@ -0,0 +1,105 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package storage
+
+import (
+	"sync"
+
+	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// DefaultSubscriptionBufferSize is the number of events a subscription can
+// hold before it is considered too slow and closed.
+const DefaultSubscriptionBufferSize = 1000
+
+// Notification is an event delivered to a Subscription. Exactly one of the
+// events is set.
+type Notification struct {
+	TestEvent      *testevent.Event
+	FrameworkEvent *frameworkevent.Event
+}
+
+// Subscription delivers the events emitted by this process once they are
+// persisted, so that API clients can follow jobs without polling the storage
+// engine. Events emitted by other ConTest instances sharing the storage
+// engine are not delivered.
+type Subscription struct {
+	// Events is closed when the subscription is closed, either by Close or
+	// because the subscriber did not keep up with the events, see Overflowed.
+	Events <-chan Notification
+
+	jobID      types.JobID
+	events     chan Notification
+	closed     bool
+	overflowed bool
+}
+
+var (
+	subscriptionsLock sync.Mutex
+	subscriptions     = make(map[*Subscription]struct{})
+)
+
+// Subscribe returns a subscription to the events of the given job, or of all
+// the jobs if jobID is 0, emitted from now on. If bufferSize is 0,
+// DefaultSubscriptionBufferSize is used. The subscription must be closed
+// when no longer used.
+func Subscribe(jobID types.JobID, bufferSize int) *Subscription {
+	if bufferSize <= 0 {
+		bufferSize = DefaultSubscriptionBufferSize
+	}
+	events := make(chan Notification, bufferSize)
+	s := &Subscription{Events: events, jobID: jobID, events: events}
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
+	subscriptions[s] = struct{}{}
+	return s
+}
+
+// Close ends the subscription. It is safe to call it more than once.
+func (s *Subscription) Close() {
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
+	s.close()
+}
+
+// Overflowed returns whether the subscription was closed because its buffer
+// was full, in which case some events were not delivered.
+func (s *Subscription) Overflowed() bool {
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
+	return s.overflowed
+}
+
+// close must be called with subscriptionsLock held.
+func (s *Subscription) close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(subscriptions, s)
+	close(s.events)
+}
+
+// notify delivers an event of the given job to the matching subscriptions.
+// It never blocks the emitter: subscriptions whose buffer is full are closed.
+func notify(jobID types.JobID, n Notification) {
+	subscriptionsLock.Lock()
+	defer subscriptionsLock.Unlock()
+	for s := range subscriptions {
+		if s.jobID != 0 && s.jobID != jobID {
+			continue
+		}
+		select {
+		case s.events <- n:
+		default:
+			log.Warningf("Closing subscription to events of job %d, which does not keep up with them", s.jobID)
+			s.overflowed = true
+			s.close()
+		}
+	}
+}
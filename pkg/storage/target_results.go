@@ -0,0 +1,96 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// ErrTargetResultsNotSupported is returned by TargetResultManager when the
+// storage engine does not implement TargetResultStorage.
+var ErrTargetResultsNotSupported = errors.New("storage engine does not support target results")
+
+// TargetResult is the result of a Target in a Test of a run, as maintained in
+// the per-target results table by the runner. It duplicates the information
+// carried by the TargetResult events, so that the results can be queried
+// without scanning the event stream.
+type TargetResult struct {
+	JobID    types.JobID
+	RunID    types.RunID
+	TestName string
+	Target   *target.Target
+	target.Result
+	// Duration is how long the Target took to complete the Test, if known
+	Duration time.Duration
+	EndTime  time.Time
+}
+
+// TargetResultQuery defines which target results are returned by
+// TargetResultStorage.GetTargetResults. JobID is mandatory, while the other
+// fields only restrict the results if set. Limit is the maximum number of
+// results returned, if positive, and Offset is the number of matching results
+// skipped.
+type TargetResultQuery struct {
+	JobID    types.JobID
+	RunID    types.RunID
+	TestName string
+	Outcomes []target.Outcome
+	Limit    uint
+	Offset   uint
+}
+
+// TargetResultStorage is implemented by storage engines which maintain the
+// per-target results table. GetTargetResults returns the results in the order
+// they were stored.
+type TargetResultStorage interface {
+	StoreTargetResult(result TargetResult) error
+	GetTargetResults(query *TargetResultQuery) ([]TargetResult, error)
+}
+
+// TargetResultManager stores and fetches target results via the storage
+// engines, if they support it
+type TargetResultManager struct {
+	// Consistency is the consistency model of the reads
+	Consistency ConsistencyModel
+}
+
+// StoreTargetResult stores the result of a Target
+func (m TargetResultManager) StoreTargetResult(result TargetResult) error {
+	s, ok := storage.(TargetResultStorage)
+	if !ok {
+		return ErrTargetResultsNotSupported
+	}
+	if err := s.StoreTargetResult(result); err != nil {
+		return fmt.Errorf("could not store result of target %v: %v", result.Target, err)
+	}
+	return nil
+}
+
+// GetTargetResults fetches the target results matching the query
+func (m TargetResultManager) GetTargetResults(query *TargetResultQuery) ([]TargetResult, error) {
+	if query.JobID == 0 {
+		return nil, fmt.Errorf("job ID is required to fetch target results")
+	}
+	s, ok := engine(m.Consistency).(TargetResultStorage)
+	if !ok {
+		return nil, ErrTargetResultsNotSupported
+	}
+	results, err := s.GetTargetResults(query)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch target results: %v", err)
+	}
+	return results, nil
+}
+
+// NewTargetResultManager creates a new TargetResultManager object
+func NewTargetResultManager() TargetResultManager {
+	return TargetResultManager{}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTemplatesNotSupported is returned by TemplateManager when the storage
+// engine does not implement TemplateStorage.
+var ErrTemplatesNotSupported = errors.New("storage engine does not support job templates")
+
+// ErrTemplateNotFound is returned by TemplateStorage when no template has
+// the requested name.
+var ErrTemplateNotFound = errors.New("job template not found")
+
+// Template is a job template, identified by its name. Template is the JSON
+// encoded job.Template, and Requestor the requestor who stored it last.
+type Template struct {
+	Name       string
+	Requestor  string
+	Template   string
+	CreateTime time.Time
+	UpdateTime time.Time
+}
+
+// TemplateStorage is implemented by storage engines which store job
+// templates. StoreTemplate creates the template, or replaces the one with the
+// same name, keeping its creation time. ListTemplates returns the templates
+// sorted by name.
+type TemplateStorage interface {
+	StoreTemplate(template *Template) error
+	GetTemplate(name string) (*Template, error)
+	ListTemplates() ([]Template, error)
+	DeleteTemplate(name string) error
+}
+
+// TemplateManager stores and fetches job templates via the storage engine,
+// if it supports it. Templates are always read from the main storage engine,
+// so that a template can be used as soon as it is stored.
+type TemplateManager struct{}
+
+func templateStorage() (TemplateStorage, error) {
+	s, ok := storage.(TemplateStorage)
+	if !ok {
+		return nil, ErrTemplatesNotSupported
+	}
+	return s, nil
+}
+
+// StoreTemplate creates or replaces a template
+func (m TemplateManager) StoreTemplate(template *Template) error {
+	s, err := templateStorage()
+	if err != nil {
+		return err
+	}
+	if err := s.StoreTemplate(template); err != nil {
+		return fmt.Errorf("could not store template %s: %v", template.Name, err)
+	}
+	return nil
+}
+
+// GetTemplate fetches a template by its name
+func (m TemplateManager) GetTemplate(name string) (*Template, error) {
+	s, err := templateStorage()
+	if err != nil {
+		return nil, err
+	}
+	template, err := s.GetTemplate(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch template %s: %w", name, err)
+	}
+	return template, nil
+}
+
+// ListTemplates fetches all the templates
+func (m TemplateManager) ListTemplates() ([]Template, error) {
+	s, err := templateStorage()
+	if err != nil {
+		return nil, err
+	}
+	templates, err := s.ListTemplates()
+	if err != nil {
+		return nil, fmt.Errorf("could not list templates: %v", err)
+	}
+	return templates, nil
+}
+
+// DeleteTemplate deletes a template. The jobs started from it are kept.
+func (m TemplateManager) DeleteTemplate(name string) error {
+	s, err := templateStorage()
+	if err != nil {
+		return err
+	}
+	if err := s.DeleteTemplate(name); err != nil {
+		return fmt.Errorf("could not delete template %s: %w", name, err)
+	}
+	return nil
+}
+
+// NewTemplateManager creates a new TemplateManager object
+func NewTemplateManager() TemplateManager {
+	return TemplateManager{}
+}
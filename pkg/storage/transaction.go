@@ -0,0 +1,107 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/tracing"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// Transaction groups writes which are applied atomically, see Transact. It
+// implements JobStorage and the Emitter interface of the frameworkevent
+// package, so that job state transitions and their framework events are
+// written together.
+type Transaction struct {
+	storage         Storage
+	frameworkEvents []frameworkevent.Event
+}
+
+// StoreJobRequest submits a job request within the transaction
+func (t *Transaction) StoreJobRequest(request *job.Request) (types.JobID, error) {
+	jobID, err := t.storage.StoreJobRequest(request)
+	if err != nil {
+		return jobID, fmt.Errorf("could not store job request: %v", err)
+	}
+	return jobID, nil
+}
+
+// GetJobRequest fetches a job request within the transaction
+func (t *Transaction) GetJobRequest(jobID types.JobID) (*job.Request, error) {
+	request, err := t.storage.GetJobRequest(jobID)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch job request: %v", err)
+	}
+	return request, nil
+}
+
+// StoreJobReport submits a job report within the transaction
+func (t *Transaction) StoreJobReport(report *job.JobReport) error {
+	if err := t.storage.StoreJobReport(report); err != nil {
+		return fmt.Errorf("could not persist job report: %v", err)
+	}
+	return nil
+}
+
+// GetJobReport fetches a job report within the transaction
+func (t *Transaction) GetJobReport(jobID types.JobID) (*job.JobReport, error) {
+	return t.storage.GetJobReport(jobID)
+}
+
+// Emit emits a framework event within the transaction. The event is forwarded
+// once the transaction is committed.
+func (t *Transaction) Emit(event frameworkevent.Event) error {
+	start := time.Now()
+	span := tracing.StartIn(tracing.Key{JobID: event.JobID}, "store framework event", tracing.Attr("event.name", event.EventName))
+	err := t.storage.StoreFrameworkEvent(event)
+	span.End(err)
+	observeEventWrite("framework", start, err)
+	if err != nil {
+		return fmt.Errorf("could not persist event %v: %v", event, err)
+	}
+	t.frameworkEvents = append(t.frameworkEvents, event)
+	return nil
+}
+
+// Transact runs fn within a transaction of the storage engine, which is
+// committed if fn succeeds and rolled back otherwise, so that a crash or a
+// failure cannot leave only part of the writes of fn persisted. Storage
+// engines which do not support transactions apply the writes as fn goes.
+func Transact(fn func(tx *Transaction) error) error {
+	ts, ok := storage.(TransactionalStorage)
+	if !ok {
+		t := Transaction{storage: storage}
+		err := fn(&t)
+		t.forward()
+		return err
+	}
+	txStorage, err := ts.BeginTx()
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %v", err)
+	}
+	t := Transaction{storage: txStorage}
+	if err := fn(&t); err != nil {
+		if rollbackErr := txStorage.Rollback(); rollbackErr != nil {
+			log.Warningf("could not roll back transaction: %v", rollbackErr)
+		}
+		return err
+	}
+	if err := txStorage.Commit(); err != nil {
+		return fmt.Errorf("could not commit transaction: %v", err)
+	}
+	t.forward()
+	return nil
+}
+
+func (t *Transaction) forward() {
+	for _, event := range t.frameworkEvents {
+		forwardFrameworkEvent(event)
+	}
+}
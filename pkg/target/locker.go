@@ -6,6 +6,8 @@
 package target
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/facebookincubator/contest/pkg/types"
@@ -48,6 +50,40 @@ type Locker interface {
 	RefreshLocks(types.JobID, []*Target) error
 }
 
+// TransferableLocker is implemented by lockers which can tell which jobs lock
+// targets, and hand their locks over to other jobs, e.g. so that a job of
+// higher priority preempts a job of lower priority.
+type TransferableLocker interface {
+	// LockOwners returns the jobs holding valid locks on the specified
+	// targets, by target ID. Targets which are not locked are omitted.
+	LockOwners([]*Target) (map[string]types.JobID, error)
+	// TransferLocks hands the valid locks held by the first job on the
+	// specified targets over to the second job. Targets which are not
+	// locked by the first job are skipped.
+	TransferLocks(from, to types.JobID, targets []*Target) error
+}
+
+// PingableLocker is implemented by lockers which depend on a backend, e.g. a
+// database server, to check that it is reachable.
+type PingableLocker interface {
+	Ping(ctx context.Context) error
+}
+
+// NamedLocker is implemented by lockers which report the name of their
+// plugin, e.g. to label their metrics.
+type NamedLocker interface {
+	Name() string
+}
+
+// LockerName returns the name of the plugin of a locker, or its type if it
+// does not implement NamedLocker.
+func LockerName(l Locker) string {
+	if nl, ok := l.(NamedLocker); ok {
+		return nl.Name()
+	}
+	return fmt.Sprintf("%T", l)
+}
+
 // SetLocker sets the desired lock engine for targets.
 func SetLocker(targetLocker Locker) {
 	locker = targetLocker
@@ -0,0 +1,42 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package target
+
+import (
+	"github.com/facebookincubator/contest/pkg/event"
+)
+
+// EventTargetResult is emitted once per Target at the end of a Test, and it
+// carries the result of the Target in that Test. Its payload is a Result.
+var EventTargetResult = event.Name("TargetResult")
+
+// Outcome is the outcome of a Target in a Test.
+type Outcome string
+
+// Possible outcomes of a Target in a Test.
+const (
+	// OutcomePass means that the Target went through all the TestSteps.
+	OutcomePass Outcome = "Pass"
+	// OutcomeFail means that a TestStep failed the Target.
+	OutcomeFail Outcome = "Fail"
+	// OutcomeSkip means that a TestStep skipped the Target.
+	OutcomeSkip Outcome = "Skip"
+	// OutcomeError means that the Target could not complete the Test, e.g.
+	// because it ran out of time, or because the Test itself failed or was
+	// cancelled.
+	OutcomeError Outcome = "Error"
+)
+
+// Result represents the result of a Target in a Test, and it is the payload
+// of an EventTargetResult event.
+type Result struct {
+	Outcome Outcome
+	// Message explains the outcome, if the Target did not pass
+	Message string `json:",omitempty"`
+	// Step is the label of the TestStep which failed or skipped the Target,
+	// if any
+	Step string `json:",omitempty"`
+}
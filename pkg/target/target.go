@@ -23,6 +23,20 @@ var EventTargetOut = event.Name("TargetOut")
 // EventTargetErr indicates that a target has encountered an error in a TestStep
 var EventTargetErr = event.Name("TargetErr")
 
+// EventTargetErrIgnored indicates that a target has encountered an error in a
+// TestStep which ignores failures, and that the target proceeds to the next
+// TestStep regardless. Its payload is an ErrPayload.
+var EventTargetErrIgnored = event.Name("TargetErrIgnored")
+
+// EventTargetSkipped indicates that a TestStep has skipped a target, e.g.
+// because the test is not applicable to it. Skipped targets leave the test
+// like failed ones, but are not counted as failures.
+var EventTargetSkipped = event.Name("TargetSkipped")
+
+// EventTargetRetry indicates that a target which failed a TestStep is injected
+// again into the same TestStep, according to the retry policy of the test
+var EventTargetRetry = event.Name("TargetRetry")
+
 // EventTargetAcquired indicates that a target has been acquired for a Test
 var EventTargetAcquired = event.Name("TargetAcquired")
 
@@ -31,6 +45,20 @@ type ErrPayload struct {
 	Error string
 }
 
+// RetryPayload represents the payload associated with a TargetRetry event
+type RetryPayload struct {
+	// Attempt is the number of the attempt which is about to start, the
+	// first attempt being 1
+	Attempt int
+	// Error is the error of the previous attempt
+	Error string
+}
+
+// SkipPayload represents the payload associated with a TargetSkipped event
+type SkipPayload struct {
+	Reason string
+}
+
 // Target represents a target to run tests on
 type Target struct {
 	Name string
@@ -5,7 +5,11 @@
 
 package target
 
-import "github.com/facebookincubator/contest/pkg/types"
+import (
+	"encoding/json"
+
+	"github.com/facebookincubator/contest/pkg/types"
+)
 
 // TargetManagerFactory is a type representing a function which builds
 // a TargetManager.
@@ -24,9 +28,22 @@ type TargetManager interface {
 	Release(jobID types.JobID, cancel <-chan struct{}, parameters interface{}) error
 }
 
+// TargetManagerWithSchema is implemented by TargetManagers which publish JSON
+// schemas of their acquire and release parameters. Either may be nil, if the
+// parameters are not described. Descriptors are validated against them before
+// ValidateAcquireParameters and ValidateReleaseParameters are called.
+type TargetManagerWithSchema interface {
+	TargetManager
+	AcquireParametersSchema() json.RawMessage
+	ReleaseParametersSchema() json.RawMessage
+}
+
 // TargetManagerBundle bundles the selected TargetManager together with its
-// acquire and release parameters based on the content of the job descriptor
+// acquire and release parameters based on the content of the job descriptor.
+// TargetManagerName is the lower case name of the plugin, which labels its
+// metrics.
 type TargetManagerBundle struct {
+	TargetManagerName string
 	TargetManager     TargetManager
 	AcquireParameters interface{}
 	ReleaseParameters interface{}
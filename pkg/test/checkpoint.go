@@ -0,0 +1,134 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/target"
+)
+
+// EventTargetCheckpoint is emitted every time a TestStep saves a checkpoint
+// for a target. Its payload is a CheckpointPayload.
+var EventTargetCheckpoint = event.Name("TargetCheckpoint")
+
+// CheckpointPayload represents the payload associated with a TargetCheckpoint
+// event.
+type CheckpointPayload struct {
+	Data []byte
+}
+
+// CheckpointStore is where a TestStep can save opaque information about its
+// progress on each target. The TestRunner passes a CheckpointStore to the
+// step via the context, see GetCheckpointStore. Checkpoints are persisted
+// as events, so the ones saved before a pause or a crash are available to
+// the step again, both in Run and in Resume, when the same step of the same
+// run of the job is executed again.
+type CheckpointStore interface {
+	// Save stores the progress of the step on a target, replacing the
+	// previous checkpoint, if any.
+	Save(t *target.Target, data []byte) error
+	// Load returns the last checkpoint saved for a target, or nil if there
+	// is none.
+	Load(t *target.Target) ([]byte, error)
+}
+
+// eventCheckpointStore is a CheckpointStore backed by test events.
+type eventCheckpointStore struct {
+	header testevent.Header
+	ev     testevent.EmitterFetcher
+
+	mu sync.Mutex
+	// checkpoints caches the last checkpoint of each target, and it is
+	// populated from the stored events upon first use
+	checkpoints map[target.Target][]byte
+}
+
+// NewCheckpointStore returns a CheckpointStore which persists checkpoints
+// as events of the test step identified by the given header.
+func NewCheckpointStore(header testevent.Header, ev testevent.EmitterFetcher) CheckpointStore {
+	return &eventCheckpointStore{header: header, ev: ev}
+}
+
+// load populates the cache. It must be called with the lock held.
+func (s *eventCheckpointStore) load() error {
+	if s.checkpoints != nil {
+		return nil
+	}
+	events, err := s.ev.Fetch(
+		testevent.QueryJobID(s.header.JobID),
+		testevent.QueryRunID(s.header.RunID),
+		testevent.QueryTestName(s.header.TestName),
+		testevent.QueryTestStepLabel(s.header.TestStepLabel),
+		testevent.QueryEventName(EventTargetCheckpoint),
+	)
+	if err != nil {
+		return fmt.Errorf("could not fetch checkpoints: %v", err)
+	}
+	checkpoints := make(map[target.Target][]byte)
+	// events are returned in emission order, the last one wins
+	for _, ev := range events {
+		if ev.Data.Target == nil || ev.Data.Payload == nil {
+			continue
+		}
+		var payload CheckpointPayload
+		if err := json.Unmarshal(*ev.Data.Payload, &payload); err != nil {
+			return fmt.Errorf("could not decode checkpoint of target %s: %v", ev.Data.Target, err)
+		}
+		checkpoints[*ev.Data.Target] = payload.Data
+	}
+	s.checkpoints = checkpoints
+	return nil
+}
+
+// Save implements CheckpointStore.Save
+func (s *eventCheckpointStore) Save(t *target.Target, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(CheckpointPayload{Data: data})
+	if err != nil {
+		return fmt.Errorf("could not encode checkpoint: %v", err)
+	}
+	rawPayload := json.RawMessage(payload)
+	if err := s.ev.Emit(testevent.Data{EventName: EventTargetCheckpoint, Target: t, Payload: &rawPayload}); err != nil {
+		return fmt.Errorf("could not save checkpoint of target %s: %v", t, err)
+	}
+	s.checkpoints[*t] = data
+	return nil
+}
+
+// Load implements CheckpointStore.Load
+func (s *eventCheckpointStore) Load(t *target.Target) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s.checkpoints[*t], nil
+}
+
+type checkpointStoreKey struct{}
+
+// WithCheckpointStore returns a copy of the context carrying the given
+// CheckpointStore.
+func WithCheckpointStore(ctx context.Context, s CheckpointStore) context.Context {
+	return context.WithValue(ctx, checkpointStoreKey{}, s)
+}
+
+// GetCheckpointStore returns the CheckpointStore carried by the context, or
+// nil if there is none.
+func GetCheckpointStore(ctx context.Context) CheckpointStore {
+	s, _ := ctx.Value(checkpointStoreKey{}).(CheckpointStore)
+	return s
+}
@@ -0,0 +1,63 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/stretchr/testify/require"
+)
+
+// memEmitterFetcher records events in memory. Fetch ignores the query, as all
+// the events belong to the same step in these tests.
+type memEmitterFetcher struct {
+	events []testevent.Event
+}
+
+func (m *memEmitterFetcher) Emit(data testevent.Data) error {
+	m.events = append(m.events, testevent.Event{Data: &data})
+	return nil
+}
+
+func (m *memEmitterFetcher) Fetch(fields ...testevent.QueryField) ([]testevent.Event, error) {
+	return m.events, nil
+}
+
+func TestCheckpointStore(t *testing.T) {
+	ev := &memEmitterFetcher{}
+	header := testevent.Header{JobID: 1, RunID: 1, TestName: "test", TestStepLabel: "step"}
+	t1 := &target.Target{Name: "host001"}
+	t2 := &target.Target{Name: "host002"}
+
+	s := NewCheckpointStore(header, ev)
+	data, err := s.Load(t1)
+	require.NoError(t, err)
+	require.Nil(t, data)
+
+	require.NoError(t, s.Save(t1, []byte("first")))
+	require.NoError(t, s.Save(t1, []byte("second")))
+	require.NoError(t, s.Save(t2, []byte("other")))
+	data, err = s.Load(t1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("second"), data)
+
+	// a new store, e.g. after a restart, gets the checkpoints back from the
+	// events
+	ctx := WithCheckpointStore(context.Background(), NewCheckpointStore(header, ev))
+	s = GetCheckpointStore(ctx)
+	require.NotNil(t, s)
+	data, err = s.Load(&target.Target{Name: "host001"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("second"), data)
+	data, err = s.Load(t2)
+	require.NoError(t, err)
+	require.Equal(t, []byte("other"), data)
+
+	require.Nil(t, GetCheckpointStore(context.Background()))
+}
@@ -0,0 +1,113 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/insomniacslk/xjson"
+)
+
+// DefaultCacheTTL is how long a test definition is cached when no TTL is
+// specified in the CacheOptions.
+const DefaultCacheTTL = time.Minute
+
+// CacheOptions control how a remote TestFetcher caches test definitions.
+// TestFetchers embed them in their fetch parameters.
+type CacheOptions struct {
+	// Checksum is the expected SHA256 of the test definition, hex encoded.
+	// If set, a test definition with a different checksum is rejected, which
+	// makes sure that jobs run the exact test they were written for.
+	Checksum string `json:",omitempty"`
+	// CacheTTL is how long the test definition is reused for. Zero means
+	// DefaultCacheTTL.
+	CacheTTL xjson.Duration `json:",omitempty"`
+	// NoCache makes the TestFetcher fetch the test definition again even if
+	// it is cached. The fetched definition replaces the cached one.
+	NoCache bool `json:",omitempty"`
+}
+
+// Validate checks that the options are valid.
+func (o CacheOptions) Validate() error {
+	if o.Checksum != "" {
+		if sum, err := hex.DecodeString(o.Checksum); err != nil || len(sum) != sha256.Size {
+			return fmt.Errorf("checksum must be a hex encoded SHA256, got '%s'", o.Checksum)
+		}
+	}
+	if o.CacheTTL < 0 {
+		return fmt.Errorf("cache TTL cannot be negative")
+	}
+	return nil
+}
+
+type cacheEntry struct {
+	data      []byte
+	fetchTime time.Time
+	ttl       time.Duration
+}
+
+// DescriptorCache caches the test definitions fetched by remote TestFetchers,
+// so that many jobs submitted at once do not fetch the same definition over
+// and over. It is safe for concurrent use.
+type DescriptorCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// now is overridden in tests
+	now func() time.Time
+}
+
+// NewDescriptorCache returns an empty DescriptorCache.
+func NewDescriptorCache() *DescriptorCache {
+	return &DescriptorCache{
+		entries: make(map[string]cacheEntry),
+		now:     time.Now,
+	}
+}
+
+// Fetch returns the test definition identified by uri, calling fetch if it is
+// not cached, it expired or the options require bypassing the cache. The
+// cache is keyed by both the URI and the expected checksum, if any, and the
+// definition returned by fetch is verified against the checksum.
+func (c *DescriptorCache) Fetch(uri string, opts CacheOptions, fetch func() ([]byte, error)) ([]byte, error) {
+	key := uri + "#" + strings.ToLower(opts.Checksum)
+	ttl := time.Duration(opts.CacheTTL)
+	if ttl == 0 {
+		ttl = DefaultCacheTTL
+	}
+	if !opts.NoCache {
+		c.mu.Lock()
+		entry, ok := c.entries[key]
+		c.mu.Unlock()
+		if ok && c.now().Sub(entry.fetchTime) < ttl {
+			return entry.data, nil
+		}
+	}
+	data, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Checksum != "" {
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != strings.ToLower(opts.Checksum) {
+			return nil, fmt.Errorf("checksum mismatch for %s: expected %s, got %x", uri, opts.Checksum, sum)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// drop expired entries, so that the cache does not grow indefinitely
+	for k, entry := range c.entries {
+		if c.now().Sub(entry.fetchTime) >= entry.ttl {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = cacheEntry{data: data, fetchTime: c.now(), ttl: ttl}
+	return data, nil
+}
@@ -0,0 +1,62 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/insomniacslk/xjson"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescriptorCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := NewDescriptorCache()
+	c.now = func() time.Time { return now }
+
+	var fetches int
+	fetch := func() ([]byte, error) {
+		fetches++
+		return []byte("definition"), nil
+	}
+	opts := CacheOptions{CacheTTL: xjson.Duration(time.Minute)}
+
+	for i := 0; i < 3; i++ {
+		data, err := c.Fetch("uri", opts, fetch)
+		require.NoError(t, err)
+		require.Equal(t, []byte("definition"), data)
+	}
+	require.Equal(t, 1, fetches)
+
+	// bypassing the cache
+	_, err := c.Fetch("uri", CacheOptions{CacheTTL: opts.CacheTTL, NoCache: true}, fetch)
+	require.NoError(t, err)
+	require.Equal(t, 2, fetches)
+
+	// expiration
+	now = now.Add(2 * time.Minute)
+	_, err = c.Fetch("uri", opts, fetch)
+	require.NoError(t, err)
+	require.Equal(t, 3, fetches)
+
+	// checksum verification
+	sum := sha256.Sum256([]byte("definition"))
+	_, err = c.Fetch("uri", CacheOptions{Checksum: hex.EncodeToString(sum[:])}, fetch)
+	require.NoError(t, err)
+	require.Equal(t, 4, fetches)
+	sum = sha256.Sum256([]byte("other definition"))
+	_, err = c.Fetch("uri", CacheOptions{Checksum: hex.EncodeToString(sum[:])}, fetch)
+	require.Error(t, err)
+}
+
+func TestCacheOptionsValidate(t *testing.T) {
+	require.NoError(t, CacheOptions{}.Validate())
+	require.Error(t, CacheOptions{Checksum: "abc"}.Validate())
+	require.Error(t, CacheOptions{CacheTTL: -1}.Validate())
+}
@@ -5,6 +5,8 @@
 
 package test
 
+import "encoding/json"
+
 // TestFetcherFactory is a type representing a function which builds
 // a TestFetcher
 type TestFetcherFactory func() TestFetcher
@@ -20,9 +22,35 @@ type TestFetcher interface {
 	Fetch(interface{}) (string, []*TestStepDescriptor, error)
 }
 
+// TestFetcherWithSchema is implemented by TestFetchers which publish a JSON
+// schema of their fetch parameters. Descriptors are validated against it
+// before ValidateFetchParameters is called.
+type TestFetcherWithSchema interface {
+	TestFetcher
+	FetchParametersSchema() json.RawMessage
+}
+
+// FetchedTest is a test returned by a MultiTestFetcher.
+type FetchedTest struct {
+	Name  string
+	Steps []*TestStepDescriptor
+}
+
+// MultiTestFetcher is implemented by TestFetchers which can return more than
+// one test, e.g. a whole suite. Each fetched test becomes a separate test of
+// the job, and they all share the target manager, the retry policy, and the
+// setup and cleanup steps of the test descriptor.
+type MultiTestFetcher interface {
+	TestFetcher
+	FetchTests(interface{}) ([]FetchedTest, error)
+}
+
 // TestFetcherBundle bundles the selected TestFetcher together with its acquire
-// and release parameters based on the content of the job descriptor
+// and release parameters based on the content of the job descriptor.
+// TestFetcherName is the lower case name of the plugin, which labels its
+// metrics.
 type TestFetcherBundle struct {
+	TestFetcherName string
 	TestFetcher     TestFetcher
 	FetchParameters interface{}
 }
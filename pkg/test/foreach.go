@@ -0,0 +1,118 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/facebookincubator/contest/pkg/cerrors"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/target"
+)
+
+var log = logging.GetLogger("pkg/test")
+
+// PerTargetFunc is a function type that is called on each target by
+// ForEachTarget. A nil return value forwards the target to the output channel
+// of the step, a non-nil one to the error channel.
+type PerTargetFunc func(ctx context.Context, target *target.Target) error
+
+// ForEachTarget is a facility provided to simplify TestStep implementations.
+// It handles the routing of targets through the in/out/err channels of the
+// step, and cancellation and pausing. It runs f on every incoming target, each
+// in its own goroutine, and forwards the target to the output or error channel
+// according to the result. A panic in f is recovered and reported as an error
+// for that target. It is equivalent to ForEachTargetWithLimit with no limit.
+//
+// Unless cancellation or pause are requested, every target that is read from
+// the input channel is forwarded exactly once before ForEachTarget returns.
+// Once the context is done, no more targets are read, the function waits for
+// the in-flight invocations of f to return and discards their results. f is
+// responsible for honoring the context.
+func ForEachTarget(ctx context.Context, stepName string, ch TestStepChannels, f PerTargetFunc) error {
+	return ForEachTargetWithLimit(ctx, stepName, ch, 0, f)
+}
+
+// ForEachTargetWithLimit works like ForEachTarget, but it runs f on at most
+// maxConcurrency targets at the same time. Further targets are left in the
+// input channel until a slot frees up. A value of zero or less means no limit.
+func ForEachTargetWithLimit(ctx context.Context, stepName string, ch TestStepChannels, maxConcurrency int, f PerTargetFunc) error {
+	type targetResult struct {
+		target *target.Target
+		err    error
+	}
+	results := make(chan targetResult)
+	run := func(tgt *target.Target) {
+		var err error
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%s: panic while processing target %s: %v: %s", stepName, tgt, r, debug.Stack())
+			}
+			results <- targetResult{target: tgt, err: err}
+		}()
+		err = f(ctx, tgt)
+	}
+
+	var (
+		in       = ch.In
+		inFlight int
+		// terminated is set once the context is done. From that moment on no
+		// more targets are accepted and results are discarded.
+		terminated bool
+	)
+	for {
+		if in == nil && inFlight == 0 {
+			log.Debugf("%s: ForEachTarget: all targets have been processed", stepName)
+			return nil
+		}
+		// do not read the input channel if the concurrency limit is reached
+		readCh := in
+		if maxConcurrency > 0 && inFlight >= maxConcurrency {
+			readCh = nil
+		}
+		var doneCh <-chan struct{}
+		if !terminated {
+			doneCh = ctx.Done()
+		}
+		select {
+		case tgt := <-readCh:
+			if tgt == nil {
+				log.Debugf("%s: ForEachTarget: all targets have been received", stepName)
+				in = nil
+				continue
+			}
+			log.Debugf("%s: ForEachTarget: received target %s", stepName, tgt)
+			inFlight++
+			go run(tgt)
+		case res := <-results:
+			inFlight--
+			if terminated {
+				log.Debugf("%s: ForEachTarget: the result for target %s is ignored due to cancellation or pause: %v", stepName, res.target, res.err)
+				continue
+			}
+			if res.err != nil {
+				log.Errorf("%s: ForEachTarget: failed to apply test step function on target %s: %v", stepName, res.target, res.err)
+				select {
+				case ch.Err <- cerrors.TargetError{Target: res.target, Err: res.err}:
+				case <-ctx.Done():
+					terminated, in = true, nil
+				}
+			} else {
+				log.Debugf("%s: ForEachTarget: target %s completed successfully", stepName, res.target)
+				select {
+				case ch.Out <- res.target:
+				case <-ctx.Done():
+					terminated, in = true, nil
+				}
+			}
+		case <-doneCh:
+			log.Debugf("%s: ForEachTarget: context done: %v", stepName, ctx.Err())
+			terminated, in = true, nil
+		}
+	}
+}
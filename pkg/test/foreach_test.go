@@ -0,0 +1,84 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/cerrors"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/stretchr/testify/require"
+)
+
+// runForEach feeds numTargets targets to ForEachTargetWithLimit and returns
+// the number of targets forwarded to the output and error channels.
+func runForEach(t *testing.T, numTargets, limit int, f PerTargetFunc) (int, int) {
+	inCh := make(chan *target.Target)
+	outCh := make(chan *target.Target)
+	errCh := make(chan cerrors.TargetError)
+	ch := TestStepChannels{In: inCh, Out: outCh, Err: errCh}
+
+	go func() {
+		for i := 0; i < numTargets; i++ {
+			inCh <- &target.Target{Name: fmt.Sprintf("target%03d", i)}
+		}
+		close(inCh)
+	}()
+	done := make(chan error)
+	go func() {
+		done <- ForEachTargetWithLimit(context.Background(), "test", ch, limit, f)
+	}()
+	var out, errs int
+	for {
+		select {
+		case <-outCh:
+			out++
+		case <-errCh:
+			errs++
+		case err := <-done:
+			require.NoError(t, err)
+			return out, errs
+		case <-time.After(10 * time.Second):
+			t.Fatal("ForEachTargetWithLimit did not return")
+		}
+	}
+}
+
+func TestForEachTargetWithLimit(t *testing.T) {
+	var running, maxRunning int32
+	f := func(ctx context.Context, tgt *target.Target) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}
+	out, errs := runForEach(t, 10, 3, f)
+	require.Equal(t, 10, out)
+	require.Equal(t, 0, errs)
+	require.True(t, maxRunning <= 3, "at most 3 targets should run concurrently, got %d", maxRunning)
+}
+
+func TestForEachTargetPanic(t *testing.T) {
+	f := func(ctx context.Context, tgt *target.Target) error {
+		if tgt.Name == "target001" {
+			panic("boom")
+		}
+		return nil
+	}
+	out, errs := runForEach(t, 3, 0, f)
+	require.Equal(t, 2, out)
+	require.Equal(t, 1, errs)
+}
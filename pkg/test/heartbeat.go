@@ -0,0 +1,68 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/xcontext"
+)
+
+// EventHeartbeat is emitted periodically on behalf of a TestStep which is
+// still working, either on a specific Target or on the whole step. Its
+// payload is a HeartbeatPayload.
+var EventHeartbeat = event.Name("Heartbeat")
+
+// HeartbeatPayload represents the payload associated with a Heartbeat event.
+type HeartbeatPayload struct {
+	// Beat is the sequence number of the heartbeat, starting from 1
+	Beat int
+}
+
+// StartHeartbeat emits a Heartbeat event for the given Target every interval,
+// until either the context is done or the returned function is called. A nil
+// Target means that the heartbeat is for the whole step. TestSteps doing long
+// operations should use it, so that a slow step can be told apart from a hung
+// one. The returned function waits for the last heartbeat to be emitted, and
+// it is safe to call it more than once.
+func StartHeartbeat(ctx context.Context, ev testevent.Emitter, t *target.Target, interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for beat := 1; ; beat++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			payload, err := json.Marshal(HeartbeatPayload{Beat: beat})
+			if err != nil {
+				xcontext.Logger(ctx).Warningf("could not encode heartbeat: %v", err)
+				continue
+			}
+			rawPayload := json.RawMessage(payload)
+			if err := ev.Emit(testevent.Data{EventName: EventHeartbeat, Target: t, Payload: &rawPayload}); err != nil {
+				xcontext.Logger(ctx).Warningf("could not emit heartbeat for target %v: %v", t, err)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+		<-done
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeartbeat(t *testing.T) {
+	ev := &memEmitterFetcher{}
+	tgt := &target.Target{Name: "host001"}
+
+	stop := StartHeartbeat(context.Background(), ev, tgt, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	// stopping again is harmless, and no more heartbeats are emitted
+	stop()
+	beats := len(ev.events)
+	require.True(t, beats > 0)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, beats, len(ev.events))
+
+	for idx, e := range ev.events {
+		require.Equal(t, EventHeartbeat, e.Data.EventName)
+		require.Equal(t, tgt, e.Data.Target)
+		var payload HeartbeatPayload
+		require.NoError(t, json.Unmarshal(*e.Data.Payload, &payload))
+		require.Equal(t, idx+1, payload.Beat)
+	}
+}
+
+func TestHeartbeatContextDone(t *testing.T) {
+	ev := &memEmitterFetcher{}
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := StartHeartbeat(ctx, ev, nil, time.Hour)
+	cancel()
+	// returns once the heartbeat goroutine has exited
+	stop()
+	require.Empty(t, ev.events)
+}
@@ -0,0 +1,101 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package test
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/target"
+)
+
+// StepHook is a middleware which is invoked by the TestRunner around every
+// test step, and around every target going through a test step. It allows to
+// implement cross-cutting concerns like timing, logging or policy checks
+// without modifying the individual plugins. Hooks are registered with
+// RegisterStepHook, and their methods may be called concurrently.
+type StepHook interface {
+	// BeforeStep is called before a test step is started. If it returns an
+	// error, the step is not run and the test fails with that error.
+	BeforeStep(header testevent.Header, bundle TestStepBundle) error
+	// AfterStep is called after a test step returned, with the error returned
+	// by the step, if any.
+	AfterStep(header testevent.Header, bundle TestStepBundle, err error)
+	// BeforeTarget is called when a target reaches a test step. If it returns
+	// an error, the target is not injected and it fails the step with that
+	// error. Retries of a target within the same step are not checked again.
+	BeforeTarget(header testevent.Header, bundle TestStepBundle, t *target.Target) error
+	// AfterTarget is called when a target leaves a test step for good, with
+	// the error the target failed with, if any.
+	AfterTarget(header testevent.Header, bundle TestStepBundle, t *target.Target, err error)
+}
+
+// NoopStepHook implements StepHook doing nothing. It can be embedded by hooks
+// which are only interested in some of the methods.
+type NoopStepHook struct{}
+
+// BeforeStep implements StepHook.BeforeStep
+func (NoopStepHook) BeforeStep(testevent.Header, TestStepBundle) error { return nil }
+
+// AfterStep implements StepHook.AfterStep
+func (NoopStepHook) AfterStep(testevent.Header, TestStepBundle, error) {}
+
+// BeforeTarget implements StepHook.BeforeTarget
+func (NoopStepHook) BeforeTarget(testevent.Header, TestStepBundle, *target.Target) error {
+	return nil
+}
+
+// AfterTarget implements StepHook.AfterTarget
+func (NoopStepHook) AfterTarget(testevent.Header, TestStepBundle, *target.Target, error) {}
+
+type namedStepHook struct {
+	name string
+	hook StepHook
+}
+
+// stepHooks holds the registered hooks, in registration order.
+var stepHooks []namedStepHook
+var stepHooksMutex sync.Mutex
+
+// RegisterStepHook registers a hook which is invoked around every test step.
+// Hooks are invoked in registration order.
+func RegisterStepHook(name string, hook StepHook) error {
+	stepHooksMutex.Lock()
+	defer stepHooksMutex.Unlock()
+	for _, h := range stepHooks {
+		if h.name == name {
+			return fmt.Errorf("step hook '%s' is already registered", name)
+		}
+	}
+	stepHooks = append(stepHooks, namedStepHook{name: name, hook: hook})
+	return nil
+}
+
+// UnregisterStepHook removes a previously registered hook. It returns false
+// if no hook is registered with the given name.
+func UnregisterStepHook(name string) bool {
+	stepHooksMutex.Lock()
+	defer stepHooksMutex.Unlock()
+	for idx, h := range stepHooks {
+		if h.name == name {
+			stepHooks = append(stepHooks[:idx:idx], stepHooks[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// StepHooks returns a copy of the list of the registered hooks.
+func StepHooks() []StepHook {
+	stepHooksMutex.Lock()
+	defer stepHooksMutex.Unlock()
+	hooks := make([]StepHook, 0, len(stepHooks))
+	for _, h := range stepHooks {
+		hooks = append(hooks, h.hook)
+	}
+	return hooks
+}
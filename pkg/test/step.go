@@ -6,14 +6,18 @@
 package test
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/facebookincubator/contest/pkg/cerrors"
 	"github.com/facebookincubator/contest/pkg/event"
 	"github.com/facebookincubator/contest/pkg/event/testevent"
 	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/insomniacslk/xjson"
 )
 
 // TestStepParameters represents the parameters that a TestStep should consume
@@ -73,6 +77,27 @@ type TestStepDescriptor struct {
 	Name       string
 	Label      string
 	Parameters TestStepParameters
+	// Timeout is the maximum time the step is allowed to run for. If the
+	// step does not complete within the timeout, it is abandoned and the
+	// targets it has not returned yet are marked as failed. Zero means no
+	// timeout.
+	Timeout xjson.Duration `json:",omitempty"`
+	// IgnoreFailure makes targets which fail the step proceed to the next
+	// step instead of leaving the test. The failure is still recorded.
+	IgnoreFailure bool `json:",omitempty"`
+	// Include, if set, makes the descriptor a placeholder for the steps
+	// fetched as described by the IncludeDescriptor. The other fields must
+	// be empty in this case.
+	Include *IncludeDescriptor `json:",omitempty"`
+}
+
+// IncludeDescriptor references a sequence of test steps stored elsewhere, e.g.
+// a provisioning prologue shared by many tests. The steps are fetched with the
+// given TestFetcher when the job is created, and they can include other steps
+// in turn.
+type IncludeDescriptor struct {
+	TestFetcherName            string
+	TestFetcherFetchParameters json.RawMessage
 }
 
 // TestStepBundle bundles the selected TestStep together with its parameters as
@@ -82,6 +107,12 @@ type TestStepBundle struct {
 	TestStepLabel string
 	Parameters    TestStepParameters
 	AllowedEvents map[event.Name]bool
+	// Timeout is the maximum time the step is allowed to run for, zero means
+	// no timeout. See TestStepDescriptor.
+	Timeout time.Duration
+	// IgnoreFailure makes targets which fail the step proceed to the next
+	// step. See TestStepDescriptor.
+	IgnoreFailure bool
 }
 
 // TestStepChannels represents the input and output  channels used by a TestStep
@@ -98,14 +129,37 @@ type TestStep interface {
 	// Name returns the name of the step
 	Name() string
 	// Run runs the test step. The test step is expected to be synchronous.
-	Run(cancel, pause <-chan struct{}, ch TestStepChannels, params TestStepParameters, ev testevent.Emitter) error
+	// The context is done when cancellation or pause are requested, which
+	// can be told apart with xcontext.IsCanceled and xcontext.IsPaused, or
+	// when the deadline of the step, if any, expires. It also carries a
+	// logger, see xcontext.Logger, and a CheckpointStore where the step can
+	// save its progress, see GetCheckpointStore.
+	Run(ctx context.Context, ch TestStepChannels, params TestStepParameters, ev testevent.Emitter) error
 	// CanResume signals whether a test step can be resumed.
 	CanResume() bool
 	// Resume is called if a test step resume is requested, and CanResume
 	// returns true. If resume is not supported, this method should return
-	// ErrResumeNotSupported.
-	Resume(cancel, pause <-chan struct{}, ch TestStepChannels, params TestStepParameters, ev testevent.EmitterFetcher) error
+	// ErrResumeNotSupported. The checkpoints saved before the interruption
+	// are available in the CheckpointStore carried by the context.
+	Resume(ctx context.Context, ch TestStepChannels, params TestStepParameters, ev testevent.EmitterFetcher) error
 	// ValidateParameters checks that the parameters are correct before passing
 	// them to Run.
 	ValidateParameters(params TestStepParameters) error
 }
+
+// CleanupTestStep is implemented by TestSteps which must see every acquired
+// target, including the ones which failed the previous steps. When CleanupOnly
+// returns true, the step can only be used in the cleanup steps of a test.
+type CleanupTestStep interface {
+	TestStep
+	CleanupOnly() bool
+}
+
+// TestStepWithSchema is implemented by TestSteps which publish a JSON schema
+// of their parameters. The schema describes the parameters object of the test
+// step descriptor, hence each of its properties is a list. Descriptors are
+// validated against it before ValidateParameters is called.
+type TestStepWithSchema interface {
+	TestStep
+	ParametersSchema() json.RawMessage
+}
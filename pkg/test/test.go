@@ -17,6 +17,20 @@ type Test struct {
 	TestStepsBundles    []TestStepBundle
 	TargetManagerBundle *target.TargetManagerBundle
 	TestFetcherBundle   *TestFetcherBundle
+	RetryPolicy         RetryPolicy
+	// CleanupStepsBundles are run on all the targets after TestStepsBundles,
+	// regardless of the outcome of the test and of cancellation
+	CleanupStepsBundles []TestStepBundle
+}
+
+// RetryPolicy defines how targets which fail a test step are retried.
+type RetryPolicy struct {
+	// Retries is the number of times a target which fails a test step is
+	// injected again into the same step before being reported as failed.
+	// When retries are enabled, the input channel of a step is closed only
+	// once all the targets have left the step, so steps must not hold targets
+	// until their input channel is closed.
+	Retries uint
 }
 
 // TestDescriptor models the JSON encoded blob which is given as input to the
@@ -31,4 +45,16 @@ type TestDescriptor struct {
 	// TestFetcher-related parameters
 	TestFetcherName            string
 	TestFetcherFetchParameters json.RawMessage
+
+	// RetryPolicy applies to all the test steps of the test
+	RetryPolicy RetryPolicy
+
+	// SetupSteps are run before the steps returned by the TestFetcher. They
+	// behave like any other test step, e.g. targets failing a setup step do
+	// not proceed to the following steps.
+	SetupSteps []*TestStepDescriptor `json:",omitempty"`
+	// CleanupSteps are run on all the acquired targets once the other steps
+	// are done, even if the test failed or was cancelled. They are meant for
+	// actions which must happen regardless, e.g. powering targets off.
+	CleanupSteps []*TestStepDescriptor `json:",omitempty"`
 }
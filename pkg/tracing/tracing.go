@@ -0,0 +1,249 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package tracing records the spans of the operations of the jobs, e.g.
+// running a test step or locking targets, so that operators can trace where
+// a slow job spends its time. Spans follow the OpenTelemetry data model, and
+// are handed over to an Exporter when they end. Without an exporter, no span
+// is recorded, and the functions of the package are no-ops.
+//
+// Since the framework does not thread a context through jobs, the spans of a
+// job, of its tests and of their steps are bound to a Key while they run, so
+// that the operations within them, e.g. the storage calls, find their parent
+// with Lookup.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// TraceID identifies a trace, i.e. the spans of a job.
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid returns whether the ID is set.
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// Attribute is a key-value pair describing a span. Values are strings,
+// booleans, integers or floats, other values being formatted as strings.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr returns an attribute.
+func Attr(key string, value interface{}) Attribute {
+	switch v := value.(type) {
+	case string, bool, int64, float64:
+	case int:
+		value = int64(v)
+	case uint:
+		value = int64(v)
+	case types.JobID:
+		value = int64(v)
+	case types.RunID:
+		value = int64(v)
+	case fmt.Stringer:
+		value = v.String()
+	default:
+		value = fmt.Sprint(v)
+	}
+	return Attribute{Key: key, Value: value}
+}
+
+// SpanData is a span which ended.
+type SpanData struct {
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Name         string
+	Start        time.Time
+	End          time.Time
+	Attributes   []Attribute
+	// Err is the error with which the operation of the span failed, if any
+	Err string
+}
+
+// Exporter exports the spans which ended, e.g. to an OpenTelemetry
+// collector. ExportSpan must not block.
+type Exporter interface {
+	ExportSpan(span SpanData)
+}
+
+var (
+	exporterMu sync.RWMutex
+	exporter   Exporter
+)
+
+// SetExporter sets the exporter of the spans. If nil, spans are not recorded.
+func SetExporter(e Exporter) {
+	exporterMu.Lock()
+	defer exporterMu.Unlock()
+	exporter = e
+}
+
+func getExporter() Exporter {
+	exporterMu.RLock()
+	defer exporterMu.RUnlock()
+	return exporter
+}
+
+// Span is an operation being traced. The methods of a nil span, returned when
+// no span is recorded, do nothing.
+type Span struct {
+	mu    sync.Mutex
+	data  SpanData
+	key   *Key
+	ended bool
+}
+
+// Start starts a span, child of parent, or the root of a new trace if parent
+// is nil. It returns nil if there is no exporter.
+func Start(parent *Span, name string, attrs ...Attribute) *Span {
+	if getExporter() == nil {
+		return nil
+	}
+	s := Span{data: SpanData{Name: name, Start: time.Now(), Attributes: attrs}}
+	if parent != nil {
+		s.data.TraceID = parent.data.TraceID
+		s.data.ParentSpanID = parent.data.SpanID
+	} else {
+		_, _ = rand.Read(s.data.TraceID[:])
+	}
+	_, _ = rand.Read(s.data.SpanID[:])
+	return &s
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+}
+
+// End ends the span, which failed if err is not nil, and exports it. The span
+// is unbound from its key, if any. Spans are exported once.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	if err != nil {
+		s.data.Err = err.Error()
+	}
+	data := s.data
+	data.Attributes = append([]Attribute(nil), s.data.Attributes...)
+	key := s.key
+	s.mu.Unlock()
+	if key != nil {
+		unbind(*key, s)
+	}
+	if e := getExporter(); e != nil {
+		e.ExportSpan(data)
+	}
+}
+
+// Key identifies what a span traces while it runs: a job, a test of a run of
+// the job if RunID and TestName are set, or a step of the test if
+// TestStepLabel is set too.
+type Key struct {
+	JobID         types.JobID
+	RunID         types.RunID
+	TestName      string
+	TestStepLabel string
+}
+
+// parent returns the key of what encloses what the key identifies, and
+// whether there is any.
+func (k Key) parent() (Key, bool) {
+	switch {
+	case k.TestStepLabel != "":
+		return Key{JobID: k.JobID, RunID: k.RunID, TestName: k.TestName}, true
+	case k.RunID != 0 || k.TestName != "":
+		return Key{JobID: k.JobID}, true
+	}
+	return Key{}, false
+}
+
+var (
+	boundMu sync.Mutex
+	bound   = make(map[Key]*Span)
+)
+
+// Bind binds the span to a key until it ends, and returns it.
+func (s *Span) Bind(key Key) *Span {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	s.key = &key
+	s.mu.Unlock()
+	boundMu.Lock()
+	defer boundMu.Unlock()
+	bound[key] = s
+	return s
+}
+
+func unbind(key Key, s *Span) {
+	boundMu.Lock()
+	defer boundMu.Unlock()
+	if bound[key] == s {
+		delete(bound, key)
+	}
+}
+
+// Lookup returns the span bound to a key or, if there is none, the span of
+// what encloses it, e.g. the span of the test of a step, or nil.
+func Lookup(key Key) *Span {
+	boundMu.Lock()
+	defer boundMu.Unlock()
+	for {
+		if s, ok := bound[key]; ok {
+			return s
+		}
+		var ok bool
+		if key, ok = key.parent(); !ok {
+			return nil
+		}
+	}
+}
+
+// StartIn starts a span, child of the span returned by Lookup for a key. It
+// returns nil if there is none, so that the operations outside of the jobs
+// being traced, e.g. the storage calls of the API, are not traced.
+func StartIn(key Key, name string, attrs ...Attribute) *Span {
+	parent := Lookup(key)
+	if parent == nil {
+		return nil
+	}
+	return Start(parent, name, attrs...)
+}
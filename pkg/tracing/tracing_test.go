@@ -0,0 +1,75 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package tracing
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (r *recorder) ExportSpan(span SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+func TestNoExporter(t *testing.T) {
+	SetExporter(nil)
+	span := Start(nil, "job").Bind(Key{JobID: 1})
+	require.Nil(t, span)
+	span.SetAttributes(Attr("job.id", 1))
+	span.End(nil)
+	require.Nil(t, Lookup(Key{JobID: 1}))
+}
+
+func TestSpans(t *testing.T) {
+	r := &recorder{}
+	SetExporter(r)
+	defer SetExporter(nil)
+
+	jobKey := Key{JobID: 1}
+	testKey := Key{JobID: 1, RunID: 1, TestName: "test"}
+	stepKey := Key{JobID: 1, RunID: 1, TestName: "test", TestStepLabel: "step"}
+	job := Start(nil, "job", Attr("job.id", types.JobID(1))).Bind(jobKey)
+	require.Equal(t, job, Lookup(stepKey))
+	test := Start(Lookup(testKey), "test").Bind(testKey)
+	require.Equal(t, test, Lookup(stepKey))
+	require.Equal(t, job, Lookup(Key{JobID: 1, RunID: 1, TestName: "other"}))
+	step := Start(Lookup(stepKey), "step").Bind(stepKey)
+	require.Equal(t, step, Lookup(stepKey))
+	require.Nil(t, Lookup(Key{JobID: 2}))
+	require.Nil(t, StartIn(Key{JobID: 2}, "store"))
+	StartIn(stepKey, "store").End(nil)
+
+	step.End(errors.New("step failed"))
+	step.End(nil)
+	require.Equal(t, test, Lookup(stepKey))
+	test.End(nil)
+	job.SetAttributes(Attr("job.cancelled", false))
+	job.End(nil)
+	require.Nil(t, Lookup(stepKey))
+
+	require.Len(t, r.spans, 4)
+	storeData, stepData, testData, jobData := r.spans[0], r.spans[1], r.spans[2], r.spans[3]
+	require.Equal(t, stepData.SpanID, storeData.ParentSpanID)
+	require.Equal(t, "step failed", stepData.Err)
+	require.Equal(t, testData.SpanID, stepData.ParentSpanID)
+	require.Equal(t, jobData.SpanID, testData.ParentSpanID)
+	require.False(t, jobData.ParentSpanID.IsValid())
+	require.Equal(t, jobData.TraceID, stepData.TraceID)
+	require.Equal(t, []Attribute{{"job.id", int64(1)}, {"job.cancelled", false}}, jobData.Attributes)
+	require.False(t, jobData.End.Before(jobData.Start))
+	require.Len(t, jobData.TraceID.String(), 32)
+}
@@ -10,3 +10,6 @@ type JobID uint64
 
 // RunID represents the id of a run within the Job
 type RunID uint64
+
+// ScheduleID represents a unique identifier of a recurring job
+type ScheduleID uint64
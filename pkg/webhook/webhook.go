@@ -0,0 +1,185 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package webhook implements the webhooks which ConTest calls when jobs
+// change state, so that external systems such as CI pipelines learn about
+// them without polling. Payloads are signed with a secret shared with the
+// receivers, which check the signature with Verify.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// metrics are published via expvar, as "contest_webhooks".
+var metrics = expvar.NewMap("contest_webhooks")
+
+// SignatureHeader is the HTTP header carrying the signature of the payload,
+// in the form sha256=<hex encoded HMAC-SHA256 of the body>.
+const SignatureHeader = "X-Contest-Signature"
+
+// EventHeader is the HTTP header carrying the state of the job, so that
+// receivers can route calls without decoding them.
+const EventHeader = "X-Contest-Event"
+
+const (
+	// DefaultTimeout is the default time after which a call is abandoned.
+	DefaultTimeout = 10 * time.Second
+	// DefaultAttempts is the default number of times a call is made before
+	// giving up.
+	DefaultAttempts = 3
+	// DefaultRetryInterval is the default time waited after the first failed
+	// call, which doubles after each failure.
+	DefaultRetryInterval = time.Second
+)
+
+// Payload is the JSON body posted to the webhooks.
+type Payload struct {
+	JobID     types.JobID
+	JobName   string
+	Requestor string
+	// State is the name of the job state event, e.g. JobStateCompleted.
+	State string
+	// Err is the error of the job, if it failed or was cancelled.
+	Err string `json:",omitempty"`
+	// EmitTime is the time at which the job changed state. Calls are made
+	// concurrently, so receivers should order them by EmitTime.
+	EmitTime time.Time
+}
+
+// CheckURL checks that a webhook URL can be called.
+func CheckURL(webhookURL string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL '%s': %v", webhookURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid webhook URL '%s': scheme must be http or https", webhookURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid webhook URL '%s': host cannot be empty", webhookURL)
+	}
+	return nil
+}
+
+// Sign returns the signature of a body, as set in SignatureHeader.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns whether signature is the signature of body, see Sign.
+func Verify(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, body)))
+}
+
+// Config configures a Sender.
+type Config struct {
+	// Secret signs the payloads. It cannot be empty.
+	Secret []byte
+	// Timeout is the time after which a call is abandoned. If zero,
+	// DefaultTimeout is used.
+	Timeout time.Duration
+	// Attempts is the number of times a call is made before giving up. If
+	// zero, DefaultAttempts is used.
+	Attempts int
+	// RetryInterval is the time waited after the first failed call. If
+	// zero, DefaultRetryInterval is used.
+	RetryInterval time.Duration
+}
+
+// Sender calls webhooks with signed payloads.
+type Sender struct {
+	config Config
+	client *http.Client
+}
+
+// NewSender returns a Sender signing the payloads with the configured secret.
+func NewSender(config Config) (*Sender, error) {
+	if len(config.Secret) == 0 {
+		return nil, errors.New("webhook secret cannot be empty")
+	}
+	if config.Timeout < 0 || config.Attempts < 0 || config.RetryInterval < 0 {
+		return nil, errors.New("webhook timeout, attempts and retry interval cannot be negative")
+	}
+	if config.Timeout == 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.Attempts == 0 {
+		config.Attempts = DefaultAttempts
+	}
+	if config.RetryInterval == 0 {
+		config.RetryInterval = DefaultRetryInterval
+	}
+	return &Sender{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Send posts the payload to a webhook, retrying with exponential backoff
+// while the call fails with a network error or a server error. Any 2xx
+// status is a success.
+func (s *Sender) Send(webhookURL string, p Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("could not encode webhook payload: %v", err)
+	}
+	interval := s.config.RetryInterval
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(webhookURL, p.State, body)
+		if err == nil {
+			metrics.Add("delivered", 1)
+			return nil
+		}
+		if !retry || attempt >= s.config.Attempts {
+			metrics.Add("failed", 1)
+			return fmt.Errorf("webhook %s failed after %d attempts: %w", webhookURL, attempt, err)
+		}
+		metrics.Add("retried", 1)
+		time.Sleep(interval)
+		interval *= 2
+	}
+}
+
+// post makes a single call, and returns whether a failed call may succeed
+// if retried.
+func (s *Sender) post(webhookURL, state string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, state)
+	req.Header.Set(SignatureHeader, Sign(s.config.Secret, body))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return false, nil
+	}
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, err
+}
@@ -0,0 +1,82 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckURL(t *testing.T) {
+	require.NoError(t, CheckURL("https://ci.example.com/hooks/contest"))
+	require.NoError(t, CheckURL("http://localhost:8080"))
+	require.Error(t, CheckURL("ftp://ci.example.com/hooks"))
+	require.Error(t, CheckURL("https:///hooks"))
+	require.Error(t, CheckURL("://bad"))
+}
+
+func TestSignVerify(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"JobID":1}`)
+	signature := Sign(secret, body)
+	require.Equal(t, "sha256=", signature[:7])
+	require.True(t, Verify(secret, body, signature))
+	require.False(t, Verify([]byte("other"), body, signature))
+	require.False(t, Verify(secret, []byte(`{"JobID":2}`), signature))
+}
+
+func TestNewSender(t *testing.T) {
+	_, err := NewSender(Config{})
+	require.Error(t, err)
+	_, err = NewSender(Config{Secret: []byte("secret"), Attempts: -1})
+	require.Error(t, err)
+}
+
+func TestSend(t *testing.T) {
+	secret := []byte("secret")
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.True(t, Verify(secret, body, r.Header.Get(SignatureHeader)))
+		require.Equal(t, "JobStateCompleted", r.Header.Get(EventHeader))
+		var p Payload
+		require.NoError(t, json.Unmarshal(body, &p))
+		require.Equal(t, "JobStateCompleted", p.State)
+		// the first call fails, and is retried
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	s, err := NewSender(Config{Secret: secret, RetryInterval: time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, s.Send(srv.URL, Payload{JobID: 1, JobName: "test", State: "JobStateCompleted", EmitTime: time.Now()}))
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestSendClientError(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	s, err := NewSender(Config{Secret: []byte("secret"), RetryInterval: time.Millisecond})
+	require.NoError(t, err)
+	require.Error(t, s.Send(srv.URL, Payload{JobID: 1, State: "JobStateFailed"}))
+	// client errors are not retried
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,111 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package xcontext provides the context which is passed to test steps. The
+// context is done when either cancellation or pause of the test are
+// requested, and its Err method tells which one happened. It also carries a
+// logger which is annotated with information about the running step.
+package xcontext
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrCanceled is returned by the Err method of a context when cancellation
+// was requested.
+var ErrCanceled = context.Canceled
+
+// ErrPaused is returned by the Err method of a context when pause was
+// requested.
+var ErrPaused = errors.New("paused")
+
+var defaultLogger = logging.GetLogger("pkg/xcontext")
+
+type loggerKey struct{}
+
+// signalCtx is a context which is done when either one of its cancel and
+// pause channels is closed, or its parent is done.
+type signalCtx struct {
+	context.Context
+	done chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func (c *signalCtx) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *signalCtx) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *signalCtx) finish(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+}
+
+// New returns a context which is done when the cancel or the pause channel is
+// closed, in which case its Err method returns ErrCanceled or ErrPaused
+// respectively. Calling the returned CancelFunc releases the resources
+// associated to the context, and cancels it if not done yet.
+func New(parent context.Context, cancel, pause <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx := &signalCtx{Context: parent, done: make(chan struct{})}
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-cancel:
+			ctx.finish(ErrCanceled)
+		case <-pause:
+			ctx.finish(ErrPaused)
+		case <-parent.Done():
+			ctx.finish(parent.Err())
+		case <-stop:
+			ctx.finish(context.Canceled)
+		}
+	}()
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() { close(stop) })
+	}
+}
+
+// IsPaused returns whether the context is done because pause was requested.
+func IsPaused(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), ErrPaused)
+}
+
+// IsCanceled returns whether the context is done because cancellation was
+// requested.
+func IsCanceled(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), ErrCanceled)
+}
+
+// WithLogger returns a copy of the context carrying the given logger.
+func WithLogger(ctx context.Context, log *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, log)
+}
+
+// Logger returns the logger carried by the context. If the context carries no
+// logger, a default one is returned.
+func Logger(ctx context.Context) *logrus.Entry {
+	if log, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok {
+		return log
+	}
+	return defaultLogger
+}
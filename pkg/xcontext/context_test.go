@@ -0,0 +1,57 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package xcontext
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func waitDone(t *testing.T, ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context should be done")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	cancel, pause := make(chan struct{}), make(chan struct{})
+	ctx, stop := New(context.Background(), cancel, pause)
+	defer stop()
+	require.NoError(t, ctx.Err())
+
+	close(cancel)
+	waitDone(t, ctx)
+	require.True(t, IsCanceled(ctx))
+	require.False(t, IsPaused(ctx))
+}
+
+func TestPause(t *testing.T) {
+	cancel, pause := make(chan struct{}), make(chan struct{})
+	ctx, stop := New(context.Background(), cancel, pause)
+	defer stop()
+
+	// the reason is propagated to derived contexts
+	child, childCancel := context.WithTimeout(ctx, time.Hour)
+	defer childCancel()
+
+	close(pause)
+	waitDone(t, child)
+	require.True(t, IsPaused(ctx))
+	require.True(t, IsPaused(child))
+	require.False(t, IsCanceled(child))
+}
+
+func TestLogger(t *testing.T) {
+	ctx := context.Background()
+	require.Equal(t, defaultLogger, Logger(ctx))
+	log := defaultLogger.WithField("step", "test")
+	require.Equal(t, log, Logger(WithLogger(ctx, log)))
+}
@@ -0,0 +1,71 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package localdir
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Name is the name of this artifact store.
+var Name = "LocalDir"
+
+// LocalDir stores artifacts as files under a local directory.
+type LocalDir struct {
+	root string
+}
+
+// Name returns the name of the store.
+func (d *LocalDir) Name() string {
+	return Name
+}
+
+func (d *LocalDir) path(key string) string {
+	return filepath.Join(d.root, filepath.FromSlash(key))
+}
+
+// Put stores an artifact. The content is first written to a temporary file
+// which is then renamed, so that partially written artifacts are never
+// visible.
+func (d *LocalDir) Put(key string, r io.Reader) error {
+	dst := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// Get returns the content of an artifact.
+func (d *LocalDir) Get(key string) (io.ReadCloser, error) {
+	return os.Open(d.path(key))
+}
+
+// New returns a new LocalDir store rooted at the given directory, which is
+// created if it does not exist.
+func New(root string) (*LocalDir, error) {
+	if root == "" {
+		return nil, fmt.Errorf("artifact directory cannot be empty")
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("cannot create artifact directory: %v", err)
+	}
+	return &LocalDir{root: root}, nil
+}
@@ -0,0 +1,51 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package localdir
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/artifact"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutGet(t *testing.T) {
+	d, err := New(t.TempDir())
+	require.NoError(t, err)
+	artifact.SetStore(d)
+	defer artifact.SetStore(nil)
+
+	header := testevent.Header{JobID: 1, RunID: 2, TestName: "test", TestStepLabel: "step/1"}
+	key := artifact.Key(header, &target.Target{ID: "T1"}, "dmesg.txt")
+	require.Equal(t, "1/2/test/step%2F1/T1/dmesg.txt", key)
+
+	ref, err := artifact.Put(key, "dmesg.txt", strings.NewReader("kernel log"))
+	require.NoError(t, err)
+	require.Equal(t, Name, ref.Store)
+	require.Equal(t, int64(len("kernel log")), ref.Size)
+	require.Equal(t, "e034eba3dba42a465b0c9370d9a1ae7e08433ca1ac7e0f1dd011c23a49cdff1c", ref.SHA256)
+
+	r, err := artifact.Get(*ref)
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "kernel log", string(data))
+}
+
+func TestPutInvalidKey(t *testing.T) {
+	d, err := New(t.TempDir())
+	require.NoError(t, err)
+	artifact.SetStore(d)
+	defer artifact.SetStore(nil)
+
+	_, err = artifact.Put("../escape", "escape", strings.NewReader(""))
+	require.Error(t, err)
+}
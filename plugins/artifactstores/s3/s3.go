@@ -0,0 +1,77 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package s3
+
+import (
+	"io"
+	"io/ioutil"
+	"path"
+
+	"github.com/facebookincubator/contest/pkg/artifact"
+	"github.com/facebookincubator/contest/pkg/lib/s3"
+)
+
+// Name is the name of this artifact store.
+var Name = "S3"
+
+// S3 stores artifacts as objects in an S3-compatible bucket.
+type S3 struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+// Name returns the name of the store.
+func (s *S3) Name() string {
+	return Name
+}
+
+// objectKey returns the key of the object holding an artifact, rejecting keys
+// which would resolve outside of the prefix.
+func (s *S3) objectKey(key string) (string, error) {
+	if err := artifact.ValidateKey(key); err != nil {
+		return "", err
+	}
+	return path.Join(s.prefix, key), nil
+}
+
+// Put stores an artifact. The content is buffered in memory, since the
+// object size must be known upfront.
+func (s *S3) Put(key string, r io.Reader) error {
+	objKey, err := s.objectKey(key)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.PutObject(s.bucket, objKey, data)
+	return err
+}
+
+// Get returns the content of an artifact.
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	objKey, err := s.objectKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.GetObject(s.bucket, objKey, "")
+}
+
+// New returns a new S3 store writing under s3://bucket/prefix. Credentials
+// are read from the standard AWS environment variables.
+func New(uri, endpoint, region string) (*S3, error) {
+	bucket, prefix, err := s3.ParseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	return &S3{
+		client: s3.New(endpoint, region, s3.CredentialsFromEnv()),
+		bucket: bucket,
+		prefix: prefix,
+	}, nil
+}
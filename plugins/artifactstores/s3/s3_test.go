@@ -0,0 +1,105 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package s3
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/artifact"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/lib/s3"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/stretchr/testify/require"
+)
+
+// newServer returns a fake object store, and the objects it holds by path.
+func newServer() (*httptest.Server, map[string]string) {
+	objects := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			http.Error(w, "AccessDenied", http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			body, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			objects[r.URL.Path] = string(body)
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				http.Error(w, "NoSuchKey", http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(body))
+		}
+	}))
+	return srv, objects
+}
+
+func newStore(t *testing.T, uri string) (*S3, map[string]string) {
+	srv, objects := newServer()
+	t.Cleanup(srv.Close)
+	s, err := New(uri, srv.URL, "eu-west-1")
+	require.NoError(t, err)
+	s.client.Credentials = s3.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+	return s, objects
+}
+
+func TestPutGet(t *testing.T) {
+	s, objects := newStore(t, "s3://bucket/artifacts/contest")
+	artifact.SetStore(s)
+	defer artifact.SetStore(nil)
+
+	header := testevent.Header{JobID: 1, RunID: 2, TestName: "test", TestStepLabel: "step/1"}
+	key := artifact.Key(header, &target.Target{ID: "T1"}, "dmesg.txt")
+	ref, err := artifact.Put(key, "dmesg.txt", strings.NewReader("kernel log"))
+	require.NoError(t, err)
+	require.Equal(t, Name, ref.Store)
+	require.Equal(t, map[string]string{
+		"/bucket/artifacts/contest/1/2/test/step%2F1/T1/dmesg.txt": "kernel log",
+	}, objects)
+
+	r, err := artifact.Get(*ref)
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "kernel log", string(data))
+
+	_, err = s.Get("1/2/missing")
+	require.Error(t, err)
+}
+
+func TestNoPrefix(t *testing.T) {
+	s, objects := newStore(t, "s3://bucket")
+	require.NoError(t, s.Put("a/b", strings.NewReader("data")))
+	require.Equal(t, map[string]string{"/bucket/a/b": "data"}, objects)
+}
+
+func TestInvalidKey(t *testing.T) {
+	s, objects := newStore(t, "s3://bucket/prefix")
+	for _, key := range []string{"", "..", "../x", "a/../../x", "a/../b", "/a", "a//b"} {
+		require.Error(t, s.Put(key, strings.NewReader("data")), key)
+		_, err := s.Get(key)
+		require.Error(t, err, key)
+	}
+	require.Empty(t, objects)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("https://bucket/prefix", "", "")
+	require.Error(t, err)
+	_, err = New("s3:///prefix", "", "")
+	require.Error(t, err)
+}
@@ -0,0 +1,231 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package kafka implements an event forwarder which publishes every test and
+// framework event to a Kafka topic, so that external systems can react to
+// ConTest activity in real time. Messages are keyed by job ID, so that the
+// events of a job land in the same partition and keep their order.
+package kafka
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+var log = logging.GetLogger("eventforwarders/kafka")
+
+// metrics are published via expvar, as "contest_kafka_forwarder".
+var metrics = expvar.NewMap("contest_kafka_forwarder")
+
+// Supported serializations of the events
+const (
+	// SerializationJSON publishes a Message as JSON.
+	SerializationJSON = "json"
+	// SerializationCloudEvents publishes a CloudEvents 1.0 JSON envelope,
+	// whose data is the event.
+	SerializationCloudEvents = "cloudevents"
+)
+
+// Kinds of the forwarded events
+const (
+	KindTestEvent      = "testevent"
+	KindFrameworkEvent = "frameworkevent"
+)
+
+const (
+	// DefaultQueueSize is the default number of events waiting to be produced.
+	DefaultQueueSize = 10000
+	// DefaultSource is the default CloudEvents source.
+	DefaultSource = "contest"
+	// maxBatchSize is the maximum number of records produced at once.
+	maxBatchSize = 500
+)
+
+// ErrQueueFull is returned when an event is dropped because the producer
+// does not keep up with the emitted events.
+var ErrQueueFull = errors.New("kafka forwarder queue is full, event dropped")
+
+// Record is a message to be produced.
+type Record struct {
+	Key   []byte
+	Value []byte
+}
+
+// Producer publishes records to a Kafka topic. RESTProducer implements it
+// via the Kafka REST Proxy; binaries linking a native Kafka client can plug
+// it by implementing this interface.
+type Producer interface {
+	Produce(topic string, records []Record) error
+}
+
+// Message is the JSON serialization of an event. Exactly one of TestEvent
+// and FrameworkEvent is set, according to Kind.
+type Message struct {
+	Kind           string
+	TestEvent      *testevent.Event      `json:",omitempty"`
+	FrameworkEvent *frameworkevent.Event `json:",omitempty"`
+}
+
+// cloudEvent is the CloudEvents 1.0 structured JSON envelope.
+type cloudEvent struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	Data            interface{} `json:"data"`
+}
+
+// Config configures the forwarder.
+type Config struct {
+	// Topic is the Kafka topic events are published to.
+	Topic string
+	// Serialization is either "json" (the default) or "cloudevents".
+	Serialization string
+	// Source is the CloudEvents source. If empty, DefaultSource is used.
+	Source string
+	// QueueSize is the number of events waiting to be produced, beyond which
+	// events are dropped. If zero, DefaultQueueSize is used.
+	QueueSize int
+}
+
+// Forwarder implements storage.EventForwarder. Events are serialized when
+// forwarded, and produced in the background by Run.
+type Forwarder struct {
+	producer Producer
+	config   Config
+	queue    chan Record
+}
+
+// New returns a Forwarder publishing events via the producer.
+func New(producer Producer, config Config) (*Forwarder, error) {
+	if config.Topic == "" {
+		return nil, errors.New("kafka topic cannot be empty")
+	}
+	switch config.Serialization {
+	case "":
+		config.Serialization = SerializationJSON
+	case SerializationJSON, SerializationCloudEvents:
+	default:
+		return nil, fmt.Errorf("unknown serialization '%s', must be one of %s, %s", config.Serialization, SerializationJSON, SerializationCloudEvents)
+	}
+	if config.QueueSize < 0 {
+		return nil, fmt.Errorf("queue size cannot be negative, got %d", config.QueueSize)
+	}
+	if config.QueueSize == 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if config.Source == "" {
+		config.Source = DefaultSource
+	}
+	return &Forwarder{
+		producer: producer,
+		config:   config,
+		queue:    make(chan Record, config.QueueSize),
+	}, nil
+}
+
+// ForwardTestEvent queues a test event to be published.
+func (f *Forwarder) ForwardTestEvent(ev testevent.Event) error {
+	var (
+		jobID types.JobID
+		name  event.Name
+	)
+	if ev.Header != nil {
+		jobID = ev.Header.JobID
+	}
+	if ev.Data != nil {
+		name = ev.Data.EventName
+	}
+	return f.enqueue(KindTestEvent, jobID, name, ev.EmitTime, Message{Kind: KindTestEvent, TestEvent: &ev})
+}
+
+// ForwardFrameworkEvent queues a framework event to be published.
+func (f *Forwarder) ForwardFrameworkEvent(ev frameworkevent.Event) error {
+	return f.enqueue(KindFrameworkEvent, ev.JobID, ev.EventName, ev.EmitTime, Message{Kind: KindFrameworkEvent, FrameworkEvent: &ev})
+}
+
+func (f *Forwarder) enqueue(kind string, jobID types.JobID, name event.Name, emitTime time.Time, msg Message) error {
+	value, err := f.serialize(kind, jobID, name, emitTime, msg)
+	if err != nil {
+		return fmt.Errorf("could not serialize %s: %v", kind, err)
+	}
+	select {
+	case f.queue <- Record{Key: []byte(strconv.FormatUint(uint64(jobID), 10)), Value: value}:
+		return nil
+	default:
+		metrics.Add("dropped", 1)
+		return ErrQueueFull
+	}
+}
+
+func (f *Forwarder) serialize(kind string, jobID types.JobID, name event.Name, emitTime time.Time, msg Message) ([]byte, error) {
+	if f.config.Serialization == SerializationJSON {
+		return json.Marshal(msg)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("could not generate event ID: %v", err)
+	}
+	ce := cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              hex.EncodeToString(id),
+		Source:          f.config.Source,
+		Type:            "contest." + kind + "." + string(name),
+		Subject:         "job/" + strconv.FormatUint(uint64(jobID), 10),
+		Time:            emitTime,
+		DataContentType: "application/json",
+	}
+	if msg.TestEvent != nil {
+		ce.Data = msg.TestEvent
+	} else {
+		ce.Data = msg.FrameworkEvent
+	}
+	return json.Marshal(ce)
+}
+
+// Run produces the queued events until the stop channel is closed. Records
+// are produced in batches of what is queued at once; failed batches are
+// logged and dropped.
+func (f *Forwarder) Run(stop <-chan struct{}) {
+	for {
+		var first Record
+		select {
+		case <-stop:
+			return
+		case first = <-f.queue:
+		}
+		batch := []Record{first}
+	drain:
+		for len(batch) < maxBatchSize {
+			select {
+			case r := <-f.queue:
+				batch = append(batch, r)
+			default:
+				break drain
+			}
+		}
+		if err := f.producer.Produce(f.config.Topic, batch); err != nil {
+			log.Warningf("could not produce %d events to topic %s: %v", len(batch), f.config.Topic, err)
+			metrics.Add("failed", int64(len(batch)))
+			continue
+		}
+		metrics.Add("forwarded", int64(len(batch)))
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package kafka
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProducer struct {
+	mu      sync.Mutex
+	topic   string
+	records []Record
+}
+
+func (p *fakeProducer) Produce(topic string, records []Record) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.topic = topic
+	p.records = append(p.records, records...)
+	return nil
+}
+
+func (p *fakeProducer) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.records)
+}
+
+func testEvent() testevent.Event {
+	return testevent.Event{
+		EmitTime: time.Unix(1600000000, 0).UTC(),
+		Header:   &testevent.Header{JobID: 42, RunID: 1, TestName: "test", TestStepLabel: "step"},
+		Data:     &testevent.Data{EventName: "TargetIn"},
+	}
+}
+
+func TestForwardJSON(t *testing.T) {
+	p := &fakeProducer{}
+	f, err := New(p, Config{Topic: "contest"})
+	require.NoError(t, err)
+	stop := make(chan struct{})
+	defer close(stop)
+	go f.Run(stop)
+
+	require.NoError(t, f.ForwardTestEvent(testEvent()))
+	require.NoError(t, f.ForwardFrameworkEvent(frameworkevent.Event{JobID: 43, EventName: "JobStarted"}))
+	require.Eventually(t, func() bool { return p.count() == 2 }, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, "contest", p.topic)
+	require.Equal(t, "42", string(p.records[0].Key))
+	var msg Message
+	require.NoError(t, json.Unmarshal(p.records[0].Value, &msg))
+	require.Equal(t, KindTestEvent, msg.Kind)
+	require.Nil(t, msg.FrameworkEvent)
+	require.Equal(t, "step", msg.TestEvent.Header.TestStepLabel)
+
+	require.Equal(t, "43", string(p.records[1].Key))
+	msg = Message{}
+	require.NoError(t, json.Unmarshal(p.records[1].Value, &msg))
+	require.Equal(t, KindFrameworkEvent, msg.Kind)
+	require.Equal(t, "JobStarted", string(msg.FrameworkEvent.EventName))
+}
+
+func TestForwardCloudEvents(t *testing.T) {
+	f, err := New(&fakeProducer{}, Config{Topic: "contest", Serialization: SerializationCloudEvents})
+	require.NoError(t, err)
+	require.NoError(t, f.ForwardTestEvent(testEvent()))
+	r := <-f.queue
+
+	var ce map[string]interface{}
+	require.NoError(t, json.Unmarshal(r.Value, &ce))
+	require.Equal(t, "1.0", ce["specversion"])
+	require.Equal(t, DefaultSource, ce["source"])
+	require.Equal(t, "contest.testevent.TargetIn", ce["type"])
+	require.Equal(t, "job/42", ce["subject"])
+	require.Equal(t, "2020-09-13T12:26:40Z", ce["time"])
+	require.NotEmpty(t, ce["id"])
+	require.Contains(t, ce["data"], "Header")
+}
+
+func TestQueueFull(t *testing.T) {
+	f, err := New(&fakeProducer{}, Config{Topic: "contest", QueueSize: 1})
+	require.NoError(t, err)
+	require.NoError(t, f.ForwardTestEvent(testEvent()))
+	require.Equal(t, ErrQueueFull, f.ForwardTestEvent(testEvent()))
+}
+
+func TestInvalidConfig(t *testing.T) {
+	_, err := New(&fakeProducer{}, Config{})
+	require.Error(t, err)
+	_, err = New(&fakeProducer{}, Config{Topic: "contest", Serialization: "avro"})
+	require.Error(t, err)
+	_, err = NewRESTProducer("kafka:9092")
+	require.Error(t, err)
+}
+
+func TestRESTProducer(t *testing.T) {
+	var req restRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/topics/contest-events", r.URL.Path)
+		require.Equal(t, "application/vnd.kafka.binary.v2+json", r.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &req))
+		if string(req.Records[0].Key) == "fail" {
+			_, _ = w.Write([]byte(`{"offsets": [{"partition": null, "offset": null, "error_code": 50002, "error": "broker unavailable"}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"offsets": [{"partition": 0, "offset": 12}]}`))
+	}))
+	defer srv.Close()
+
+	p, err := NewRESTProducer(srv.URL + "/")
+	require.NoError(t, err)
+	require.NoError(t, p.Produce("contest-events", []Record{{Key: []byte("42"), Value: []byte(`{"a":1}`)}}))
+	require.Len(t, req.Records, 1)
+	require.Equal(t, `{"a":1}`, string(req.Records[0].Value))
+
+	err = p.Produce("contest-events", []Record{{Key: []byte("fail"), Value: []byte(`{}`)}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "broker unavailable")
+}
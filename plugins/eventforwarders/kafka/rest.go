@@ -0,0 +1,108 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// RESTProducer produces records via the v2 API of the Kafka REST Proxy, so
+// that ConTest does not depend on a native Kafka client.
+type RESTProducer struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewRESTProducer returns a producer posting to the REST Proxy at baseURL,
+// e.g. http://kafka-rest:8082.
+func NewRESTProducer(baseURL string) (*RESTProducer, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kafka REST Proxy URL '%s': %v", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid Kafka REST Proxy URL '%s': scheme must be http or https", baseURL)
+	}
+	return &RESTProducer{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: defaultTimeout},
+	}, nil
+}
+
+// restRecord is a record in the binary embedded format, whose key and value
+// are base64 encoded, which encoding/json does for byte slices.
+type restRecord struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type restRequest struct {
+	Records []restRecord `json:"records"`
+}
+
+type restResponse struct {
+	Offsets []struct {
+		Partition *int   `json:"partition"`
+		Offset    *int64 `json:"offset"`
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+// Produce posts the records to the topic.
+func (p *RESTProducer) Produce(topic string, records []Record) error {
+	req := restRequest{Records: make([]restRecord, 0, len(records))}
+	for _, r := range records {
+		req.Records = append(req.Records, restRecord{Key: r.Key, Value: r.Value})
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("could not encode records: %v", err)
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, p.baseURL+"/topics/"+url.PathEscape(topic), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/vnd.kafka.binary.v2+json")
+	httpReq.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("could not read response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("REST Proxy returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	var res restResponse
+	if err := json.Unmarshal(respBody, &res); err != nil {
+		return fmt.Errorf("could not decode response: %v", err)
+	}
+	failed := 0
+	var lastErr string
+	for _, o := range res.Offsets {
+		if o.ErrorCode != nil || o.Error != "" {
+			failed++
+			lastErr = o.Error
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d records were not produced, last error: %s", failed, len(records), lastErr)
+	}
+	return nil
+}
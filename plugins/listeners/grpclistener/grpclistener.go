@@ -0,0 +1,452 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package grpclistener implements an API listener serving the gRPC service
+// defined in contest.proto. The gRPC protocol is implemented on top of the
+// HTTP/2 server of the standard library, so that any gRPC client generated
+// from contest.proto can talk to it. The standard library only serves HTTP/2
+// over TLS, hence the listener requires a certificate.
+package grpclistener
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/lib/protowire"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+var log = logging.GetLogger("listeners/grpclistener")
+
+// DefaultAddr is the address the listener binds to if none is configured.
+const DefaultAddr = ":8081"
+
+// DefaultPollInterval is the default interval between two polls for new
+// events of the streams which follow a job.
+const DefaultPollInterval = time.Second
+
+// ServiceName is the fully qualified name of the gRPC service.
+const ServiceName = "contest.v1.ConTest"
+
+// gRPC status codes, see
+// https://github.com/grpc/grpc/blob/master/doc/statuscodes.md
+const (
+	codeOK                = 0
+	codeUnknown           = 2
+	codeInvalidArgument   = 3
+	codeNotFound          = 5
+	codePermissionDenied  = 7
+	codeResourceExhausted = 8
+	codeUnimplemented     = 12
+	codeInternal          = 13
+	codeUnavailable       = 14
+)
+
+// rpcError is an error returned to the client as a gRPC status.
+type rpcError struct {
+	code int
+	msg  string
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("rpc error: code = %d desc = %s", e.code, e.msg)
+}
+
+func errorf(code int, format string, args ...interface{}) error {
+	return &rpcError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// GRPCListener implements the api.Listener interface.
+type GRPCListener struct {
+	// Addr is the address to bind to, DefaultAddr if empty
+	Addr string
+	// CertFile and KeyFile are the TLS certificate and key of the server,
+	// which are required.
+	CertFile string
+	KeyFile  string
+	// PollInterval is the interval between two polls for new events of the
+	// streams which follow a job, DefaultPollInterval if 0
+	PollInterval time.Duration
+	// Authenticator, if set, authenticates the calls, and the verified
+	// identity replaces the requestor of the requests
+	Authenticator api.Authenticator
+	// RateLimiter, if set, limits the rate of the calls of each requestor, or
+	// of each client host if the calls are not authenticated
+	RateLimiter *api.RateLimiter
+}
+
+type grpcHandler struct {
+	api          *api.API
+	pollInterval time.Duration
+}
+
+// readMessage reads a length-prefixed gRPC message from r.
+func readMessage(r io.Reader, msg Message) error {
+	data, err := protowire.ReadMessage(r)
+	if errors.Is(err, protowire.ErrCompressed) {
+		return errorf(codeUnimplemented, "%v", err)
+	}
+	if err != nil {
+		return errorf(codeInvalidArgument, "could not read message: %v", err)
+	}
+	if err := msg.Unmarshal(data); err != nil {
+		return errorf(codeInvalidArgument, "could not decode message: %v", err)
+	}
+	return nil
+}
+
+// writeMessage writes a length-prefixed gRPC message to w, and flushes it so
+// that the messages of streams are not delayed.
+func writeMessage(w http.ResponseWriter, msg Message) error {
+	if err := protowire.WriteMessage(w, msg.Marshal()); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// writeStatus writes the status of the call in the trailers of the response.
+func writeStatus(w http.ResponseWriter, err error) {
+	code, msg := codeOK, ""
+	if err != nil {
+		var rpcErr *rpcError
+		if errors.As(err, &rpcErr) {
+			code, msg = rpcErr.code, rpcErr.msg
+		} else {
+			code, msg = codeInternal, err.Error()
+		}
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", protowire.EncodeStatusMessage(msg))
+	}
+}
+
+// checkResponse turns the errors of an API call into gRPC statuses.
+func checkResponse(resp api.Response, err error) error {
+	if err != nil {
+		return errorf(codeUnavailable, "%v", err)
+	}
+	if errors.Is(resp.Err, api.ErrForbidden) {
+		return errorf(codePermissionDenied, "%v", resp.Err)
+	}
+	if errors.Is(resp.Err, api.ErrLimitExceeded) {
+		return errorf(codeResourceExhausted, "%v", resp.Err)
+	}
+	if errors.Is(resp.Err, api.ErrDraining) {
+		return errorf(codeUnavailable, "%v", resp.Err)
+	}
+	if resp.Err != nil {
+		return errorf(codeUnknown, "%v", resp.Err)
+	}
+	return nil
+}
+
+func (h *grpcHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	// the calls record the ID of the request, see api.AccessLogMiddleware
+	if requestID := api.RequestIDFromContext(r.Context()); requestID != "" {
+		h = &grpcHandler{api: h.api.ForRequest(requestID), pollInterval: h.pollInterval}
+	}
+	method := strings.TrimPrefix(r.URL.Path, "/"+ServiceName+"/")
+	var err error
+	switch method {
+	case "Version":
+		err = h.unary(w, r, &VersionRequest{}, h.version)
+	case "Start":
+		err = h.unary(w, r, &StartRequest{}, h.start)
+	case "Stop":
+		err = h.unary(w, r, &JobRequest{}, h.stop)
+	case "Status":
+		err = h.unary(w, r, &JobRequest{}, h.status)
+	case "Retry":
+		err = h.unary(w, r, &JobRequest{}, h.retry)
+	case "Report":
+		err = h.unary(w, r, &ReportRequest{}, h.report)
+	case "StreamTestEvents":
+		err = h.streamTestEvents(w, r)
+	default:
+		err = errorf(codeUnimplemented, "unknown method %s", r.URL.Path)
+	}
+	if err != nil {
+		log.Debugf("gRPC call %s failed: %v", method, err)
+	}
+	writeStatus(w, err)
+}
+
+// unary handles an RPC with a single response message.
+func (h *grpcHandler) unary(w http.ResponseWriter, r *http.Request, req Message, fn func(context.Context, Message) (Message, error)) error {
+	if err := readMessage(r.Body, req); err != nil {
+		return err
+	}
+	resp, err := fn(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	if err := writeMessage(w, resp); err != nil {
+		log.Printf("Cannot write to client socket: %v", err)
+	}
+	return nil
+}
+
+func (h *grpcHandler) version(context.Context, Message) (Message, error) {
+	resp := h.api.Version()
+	data := resp.Data.(api.ResponseDataVersion)
+	return &VersionResponse{
+		ServerID:            resp.ServerID,
+		Version:             data.Version,
+		ReportSchemaVersion: uint32(data.ReportSchemaVersion),
+	}, nil
+}
+
+func (h *grpcHandler) start(ctx context.Context, m Message) (Message, error) {
+	req := m.(*StartRequest)
+	if req.JobDescriptor == "" {
+		return nil, errorf(codeInvalidArgument, "missing job description")
+	}
+	resp, err := h.api.Start(api.RequestorFromContext(ctx, req.Requestor), req.JobDescriptor)
+	if err := checkResponse(resp, err); err != nil {
+		return nil, err
+	}
+	return &StartResponse{
+		ServerID: resp.ServerID,
+		JobID:    uint64(resp.Data.(api.ResponseDataStart).JobID),
+	}, nil
+}
+
+func (h *grpcHandler) stop(ctx context.Context, m Message) (Message, error) {
+	req := m.(*JobRequest)
+	resp, err := h.api.Stop(api.RequestorFromContext(ctx, req.Requestor), types.JobID(req.JobID))
+	if err := checkResponse(resp, err); err != nil {
+		return nil, err
+	}
+	return &StopResponse{ServerID: resp.ServerID}, nil
+}
+
+func (h *grpcHandler) status(ctx context.Context, m Message) (Message, error) {
+	req := m.(*JobRequest)
+	resp, err := h.api.Status(api.RequestorFromContext(ctx, req.Requestor), types.JobID(req.JobID))
+	if err := checkResponse(resp, err); err != nil {
+		return nil, err
+	}
+	status := resp.Data.(api.ResponseDataStatus).Status
+	if status == nil {
+		return nil, errorf(codeNotFound, "no status for job %d", req.JobID)
+	}
+	statusJSON, err := json.Marshal(status)
+	if err != nil {
+		return nil, errorf(codeInternal, "cannot marshal status: %v", err)
+	}
+	return &StatusResponse{
+		ServerID:   resp.ServerID,
+		State:      status.State,
+		StatusJSON: string(statusJSON),
+	}, nil
+}
+
+func (h *grpcHandler) retry(ctx context.Context, m Message) (Message, error) {
+	req := m.(*JobRequest)
+	resp, err := h.api.Retry(api.RequestorFromContext(ctx, req.Requestor), types.JobID(req.JobID))
+	if err := checkResponse(resp, err); err != nil {
+		return nil, err
+	}
+	return &RetryResponse{
+		ServerID: resp.ServerID,
+		JobID:    uint64(resp.Data.(api.ResponseDataRetry).JobID),
+	}, nil
+}
+
+func (h *grpcHandler) report(ctx context.Context, m Message) (Message, error) {
+	req := m.(*ReportRequest)
+	if req.Reporter == "" {
+		return nil, errorf(codeInvalidArgument, "reporter name cannot be empty")
+	}
+	resp, err := h.api.Status(api.RequestorFromContext(ctx, req.Requestor), types.JobID(req.JobID))
+	if err := checkResponse(resp, err); err != nil {
+		return nil, err
+	}
+	status := resp.Data.(api.ResponseDataStatus).Status
+	if status == nil || status.JobReport == nil {
+		return nil, errorf(codeNotFound, "no report available for job %d", req.JobID)
+	}
+	report, err := status.JobReport.FindReport(req.Reporter, int(req.Run))
+	if err != nil {
+		return nil, errorf(codeNotFound, "%v", err)
+	}
+	reportResp := ReportResponse{
+		ServerID:     resp.ServerID,
+		ReporterName: report.ReporterName,
+		Success:      report.Success,
+	}
+	// reports rendered as documents, e.g. JUnit XML, are returned as they
+	// are, the others are encoded as JSON
+	if doc, ok := report.Data.(string); ok {
+		reportResp.Data = doc
+		if strings.HasPrefix(doc, "<?xml") {
+			reportResp.ContentType = "application/xml"
+		} else {
+			reportResp.ContentType = "text/plain; charset=utf-8"
+		}
+		return &reportResp, nil
+	}
+	data, err := report.ToJSON()
+	if err != nil {
+		return nil, errorf(codeInternal, "cannot marshal report: %v", err)
+	}
+	reportResp.Data = string(data)
+	reportResp.ContentType = "application/json"
+	return &reportResp, nil
+}
+
+func newTestEvent(ev testevent.Event) *TestEvent {
+	msg := TestEvent{EmitTimeUnixNano: ev.EmitTime.UnixNano()}
+	if ev.Header != nil {
+		msg.JobID = uint64(ev.Header.JobID)
+		msg.RunID = uint32(ev.Header.RunID)
+		msg.TestName = ev.Header.TestName
+		msg.TestStepLabel = ev.Header.TestStepLabel
+	}
+	if ev.Data != nil {
+		msg.EventName = string(ev.Data.EventName)
+		if ev.Data.Target != nil {
+			msg.TargetID = ev.Data.Target.ID
+			msg.TargetName = ev.Data.Target.Name
+			msg.TargetFQDN = ev.Data.Target.FQDN
+		}
+		if ev.Data.Payload != nil {
+			msg.PayloadJSON = string(*ev.Data.Payload)
+		}
+	}
+	return &msg
+}
+
+// jobCompleted returns whether the job has reached a completion state, after
+// which it emits no more test events.
+func (h *grpcHandler) jobCompleted(requestor api.EventRequestor, jobID types.JobID) (bool, error) {
+	resp, err := h.api.Status(requestor, jobID)
+	if err := checkResponse(resp, err); err != nil {
+		return false, err
+	}
+	status := resp.Data.(api.ResponseDataStatus).Status
+	return status != nil && status.EndTime != nil, nil
+}
+
+// streamTestEvents pages through the test events of a job. If the request
+// follows the job, it then polls for new events until the job completes or
+// the client goes away.
+func (h *grpcHandler) streamTestEvents(w http.ResponseWriter, r *http.Request) error {
+	var req StreamTestEventsRequest
+	if err := readMessage(r.Body, &req); err != nil {
+		return err
+	}
+	var (
+		requestor = api.RequestorFromContext(r.Context(), req.Requestor)
+		jobID     = types.JobID(req.JobID)
+		offset    uint
+	)
+	for {
+		// check for completion before fetching, so that no event emitted
+		// before the end of the job is missed.
+		completed := !req.Follow
+		if req.Follow {
+			var err error
+			if completed, err = h.jobCompleted(requestor, jobID); err != nil {
+				return err
+			}
+		}
+		for {
+			resp, err := h.api.TestEvents(requestor, jobID, types.RunID(req.RunID), req.TestName, req.TestStepLabel, api.MaxPageLimit, offset)
+			if err := checkResponse(resp, err); err != nil {
+				return err
+			}
+			data := resp.Data.(api.ResponseDataTestEvents)
+			for _, ev := range data.Events {
+				if err := writeMessage(w, newTestEvent(ev)); err != nil {
+					// the client went away
+					return err
+				}
+			}
+			offset += uint(len(data.Events))
+			if uint(len(data.Events)) < data.Limit {
+				break
+			}
+		}
+		if completed {
+			return nil
+		}
+		select {
+		case <-time.After(h.pollInterval):
+		case <-r.Context().Done():
+			return r.Context().Err()
+		}
+	}
+}
+
+func listenWithCancellation(cancel <-chan struct{}, s *http.Server, certFile, keyFile string) error {
+	var (
+		errCh = make(chan error, 1)
+	)
+	// start the listener asynchronously, and report errors and completion via
+	// channels.
+	go func() {
+		errCh <- s.ListenAndServeTLS(certFile, keyFile)
+	}()
+	log.Infof("Started gRPC API listener on %s", s.Addr)
+	// wait for cancellation or for completion
+	select {
+	case err := <-errCh:
+		return err
+	case <-cancel:
+		log.Printf("Received server shut down request")
+		return s.Close()
+	}
+}
+
+// Serve implements the api.Listener.Serve interface method. It starts a gRPC
+// API listener, which calls the API methods on behalf of the clients.
+func (l *GRPCListener) Serve(cancel <-chan struct{}, a *api.API) error {
+	if a == nil {
+		return errors.New("API object is nil")
+	}
+	if l.CertFile == "" || l.KeyFile == "" {
+		return errors.New("the TLS certificate and key are required, as gRPC is served over HTTP/2 over TLS")
+	}
+	addr := l.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+	pollInterval := l.PollInterval
+	if pollInterval == 0 {
+		pollInterval = DefaultPollInterval
+	}
+	// there is no write timeout, as streams last as long as the jobs they
+	// follow.
+	s := http.Server{
+		Addr:              addr,
+		Handler:           api.AccessLogMiddleware(api.AuthMiddleware(l.Authenticator, api.RateLimitMiddleware(l.RateLimiter, &grpcHandler{api: a, pollInterval: pollInterval}))),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if err := listenWithCancellation(cancel, &s, l.CertFile, l.KeyFile); err != nil {
+		return fmt.Errorf("gRPC listener failed: %v", err)
+	}
+	log.Printf("Server shut down successfully.")
+	return nil
+}
@@ -0,0 +1,221 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package grpclistener
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/lib/protowire"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/types"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	in := TestEvent{
+		EmitTimeUnixNano: -1,
+		JobID:            1 << 40,
+		RunID:            3,
+		TestName:         "test",
+		EventName:        "TargetOut",
+		TargetID:         "42",
+		PayloadJSON:      `{"a":1}`,
+	}
+	var out TestEvent
+	require.NoError(t, out.Unmarshal(in.Marshal()))
+	require.Equal(t, in, out)
+
+	// zero values are not encoded
+	require.Empty(t, (&StreamTestEventsRequest{}).Marshal())
+}
+
+func TestDecodeSkipsUnknownFields(t *testing.T) {
+	var e protowire.Encoder
+	e.String(1, "requestor")
+	e.Key(15, protowire.WireFixed64)
+	e.Buf = append(e.Buf, make([]byte, 8)...)
+	e.Key(16, protowire.WireFixed32)
+	e.Buf = append(e.Buf, make([]byte, 4)...)
+	e.String(17, "unknown")
+	e.Uint64(2, 7)
+	var req JobRequest
+	require.NoError(t, req.Unmarshal(e.Buf))
+	require.Equal(t, JobRequest{Requestor: "requestor", JobID: 7}, req)
+
+	require.Error(t, req.Unmarshal([]byte{0x0a, 0x05, 'a'}))
+}
+
+// serveAPI answers the API events like the JobManager would, for a job which
+// completes after its second status request. Each status request makes one
+// more test event available, to exercise following the job.
+func serveAPI(a *api.API, events []testevent.Event) {
+	statusRequests := 0
+	for ev := range a.Events {
+		resp := api.EventResponse{Requestor: ev.Msg.Requestor()}
+		switch msg := ev.Msg.(type) {
+		case api.EventStartMsg:
+			resp.JobID = 1
+		case api.EventStatusMsg:
+			if msg.JobID != 1 {
+				resp.Err = errors.New("unknown job")
+				break
+			}
+			statusRequests++
+			resp.Status = &job.Status{State: "JobStateStarted", JobReport: &job.JobReport{
+				RunReports: [][]*job.Report{{{ReporterName: "TargetSuccess", Success: true, Data: map[string]int{"passed": 1}}}},
+			}}
+			if statusRequests > 1 {
+				end := time.Now()
+				resp.Status.State = "JobStateCompleted"
+				resp.Status.EndTime = &end
+			}
+		case api.EventTestEventsMsg:
+			if int(msg.Offset) < len(events) && statusRequests > int(msg.Offset) {
+				resp.TestEvents = events[msg.Offset : msg.Offset+1]
+			}
+		}
+		ev.RespCh <- &resp
+	}
+}
+
+type client struct {
+	t      *testing.T
+	server *httptest.Server
+}
+
+func newClient(t *testing.T, events []testevent.Event) *client {
+	a, err := api.New(func() string { return "server" })
+	require.NoError(t, err)
+	go serveAPI(a, events)
+	server := httptest.NewUnstartedServer(&grpcHandler{api: a, pollInterval: time.Millisecond})
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return &client{t: t, server: server}
+}
+
+// call makes an RPC and returns the response messages, and the status code
+// and message.
+func (c *client) call(method string, req Message) ([][]byte, string, string) {
+	body := req.Marshal()
+	prefix := make([]byte, 5)
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(body)))
+	httpReq, err := http.NewRequest(http.MethodPost, c.server.URL+"/"+ServiceName+"/"+method, bytes.NewReader(append(prefix, body...)))
+	require.NoError(c.t, err)
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	httpReq.Header.Set("TE", "trailers")
+	resp, err := c.server.Client().Do(httpReq)
+	require.NoError(c.t, err)
+	defer resp.Body.Close()
+	require.Equal(c.t, 2, resp.ProtoMajor)
+	require.Equal(c.t, http.StatusOK, resp.StatusCode)
+	var msgs [][]byte
+	for {
+		if _, err := io.ReadFull(resp.Body, prefix); err == io.EOF {
+			break
+		} else {
+			require.NoError(c.t, err)
+		}
+		msg := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+		_, err := io.ReadFull(resp.Body, msg)
+		require.NoError(c.t, err)
+		msgs = append(msgs, msg)
+	}
+	return msgs, resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+}
+
+func TestUnaryCalls(t *testing.T) {
+	c := newClient(t, nil)
+
+	msgs, code, _ := c.call("Version", &VersionRequest{})
+	require.Equal(t, "0", code)
+	require.Len(t, msgs, 1)
+	var version VersionResponse
+	require.NoError(t, version.Unmarshal(msgs[0]))
+	require.Equal(t, VersionResponse{ServerID: "server", Version: api.CurrentAPIVersion, ReportSchemaVersion: job.ReportSchemaVersion}, version)
+
+	msgs, code, _ = c.call("Start", &StartRequest{Requestor: "test", JobDescriptor: "{}"})
+	require.Equal(t, "0", code)
+	var start StartResponse
+	require.NoError(t, start.Unmarshal(msgs[0]))
+	require.Equal(t, uint64(1), start.JobID)
+
+	msgs, code, _ = c.call("Status", &JobRequest{Requestor: "test", JobID: 1})
+	require.Equal(t, "0", code)
+	var status StatusResponse
+	require.NoError(t, status.Unmarshal(msgs[0]))
+	require.Equal(t, "JobStateStarted", status.State)
+	var jobStatus job.Status
+	require.NoError(t, json.Unmarshal([]byte(status.StatusJSON), &jobStatus))
+
+	msgs, code, _ = c.call("Report", &ReportRequest{Requestor: "test", JobID: 1, Reporter: "targetsuccess"})
+	require.Equal(t, "0", code)
+	var report ReportResponse
+	require.NoError(t, report.Unmarshal(msgs[0]))
+	require.Equal(t, ReportResponse{ServerID: "server", ReporterName: "TargetSuccess", Success: true, Data: "{\"passed\":1}\n", ContentType: "application/json"}, report)
+
+	msgs, code, msg := c.call("Status", &JobRequest{Requestor: "test", JobID: 2})
+	require.Empty(t, msgs)
+	require.Equal(t, "2", code)
+	require.Equal(t, "unknown job", msg)
+
+	_, code, _ = c.call("Start", &StartRequest{Requestor: "test"})
+	require.Equal(t, "3", code)
+
+	_, code, _ = c.call("Unknown", &VersionRequest{})
+	require.Equal(t, "12", code)
+}
+
+func TestStreamTestEvents(t *testing.T) {
+	var events []testevent.Event
+	for _, name := range []event.Name{"TargetIn", "TargetOut"} {
+		events = append(events, testevent.Event{
+			EmitTime: time.Unix(0, 42),
+			Header:   &testevent.Header{JobID: types.JobID(1), RunID: types.RunID(1), TestName: "test", TestStepLabel: "step"},
+			Data:     &testevent.Data{EventName: name, Target: &target.Target{ID: "1", FQDN: "host"}},
+		})
+	}
+	c := newClient(t, events)
+
+	msgs, code, _ := c.call("StreamTestEvents", &StreamTestEventsRequest{Requestor: "test", JobID: 1, Follow: true})
+	require.Equal(t, "0", code)
+	require.Len(t, msgs, 2)
+	for i, msg := range msgs {
+		var ev TestEvent
+		require.NoError(t, ev.Unmarshal(msg))
+		require.Equal(t, TestEvent{
+			EmitTimeUnixNano: 42,
+			JobID:            1,
+			RunID:            1,
+			TestName:         "test",
+			TestStepLabel:    "step",
+			EventName:        string(events[i].Data.EventName),
+			TargetID:         "1",
+			TargetFQDN:       "host",
+		}, ev)
+	}
+}
+
+func TestServeRequiresTLS(t *testing.T) {
+	a, err := api.New(func() string { return "server" })
+	require.NoError(t, err)
+	cancel := make(chan struct{})
+	close(cancel)
+	require.Error(t, (&GRPCListener{Addr: "localhost:0"}).Serve(cancel, a))
+}
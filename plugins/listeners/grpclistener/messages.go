@@ -0,0 +1,399 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package grpclistener
+
+import "github.com/facebookincubator/contest/pkg/lib/protowire"
+
+// The types in this file are the messages of contest.proto, see there for
+// their documentation. Field numbers must be kept in sync with it.
+
+// Message is implemented by the messages of the gRPC API.
+type Message interface {
+	Marshal() []byte
+	Unmarshal([]byte) error
+}
+
+// VersionRequest is the request of the Version RPC.
+type VersionRequest struct{}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *VersionRequest) Marshal() []byte {
+	return nil
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *VersionRequest) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error { return nil })
+}
+
+// VersionResponse is the response of the Version RPC.
+type VersionResponse struct {
+	ServerID            string
+	Version             uint32
+	ReportSchemaVersion uint32
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *VersionResponse) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.ServerID)
+	e.Uint64(2, uint64(m.Version))
+	e.Uint64(3, uint64(m.ReportSchemaVersion))
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *VersionResponse) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.ServerID = f.String()
+		case 2:
+			m.Version = uint32(f.Value)
+		case 3:
+			m.ReportSchemaVersion = uint32(f.Value)
+		}
+		return nil
+	})
+}
+
+// StartRequest is the request of the Start RPC.
+type StartRequest struct {
+	Requestor     string
+	JobDescriptor string
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *StartRequest) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.Requestor)
+	e.String(2, m.JobDescriptor)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *StartRequest) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.Requestor = f.String()
+		case 2:
+			m.JobDescriptor = f.String()
+		}
+		return nil
+	})
+}
+
+// StartResponse is the response of the Start RPC.
+type StartResponse struct {
+	ServerID string
+	JobID    uint64
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *StartResponse) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.ServerID)
+	e.Uint64(2, m.JobID)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *StartResponse) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.ServerID = f.String()
+		case 2:
+			m.JobID = f.Value
+		}
+		return nil
+	})
+}
+
+// JobRequest is the request of the RPCs which act on a job: Stop, Status and
+// Retry.
+type JobRequest struct {
+	Requestor string
+	JobID     uint64
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *JobRequest) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.Requestor)
+	e.Uint64(2, m.JobID)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *JobRequest) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.Requestor = f.String()
+		case 2:
+			m.JobID = f.Value
+		}
+		return nil
+	})
+}
+
+// StopResponse is the response of the Stop RPC.
+type StopResponse struct {
+	ServerID string
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *StopResponse) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.ServerID)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *StopResponse) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		if f.Number == 1 {
+			m.ServerID = f.String()
+		}
+		return nil
+	})
+}
+
+// StatusResponse is the response of the Status RPC.
+type StatusResponse struct {
+	ServerID   string
+	State      string
+	StatusJSON string
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *StatusResponse) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.ServerID)
+	e.String(2, m.State)
+	e.String(3, m.StatusJSON)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *StatusResponse) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.ServerID = f.String()
+		case 2:
+			m.State = f.String()
+		case 3:
+			m.StatusJSON = f.String()
+		}
+		return nil
+	})
+}
+
+// RetryResponse is the response of the Retry RPC.
+type RetryResponse struct {
+	ServerID string
+	JobID    uint64
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *RetryResponse) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.ServerID)
+	e.Uint64(2, m.JobID)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *RetryResponse) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.ServerID = f.String()
+		case 2:
+			m.JobID = f.Value
+		}
+		return nil
+	})
+}
+
+// ReportRequest is the request of the Report RPC.
+type ReportRequest struct {
+	Requestor string
+	JobID     uint64
+	Reporter  string
+	Run       uint32
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *ReportRequest) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.Requestor)
+	e.Uint64(2, m.JobID)
+	e.String(3, m.Reporter)
+	e.Uint64(4, uint64(m.Run))
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *ReportRequest) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.Requestor = f.String()
+		case 2:
+			m.JobID = f.Value
+		case 3:
+			m.Reporter = f.String()
+		case 4:
+			m.Run = uint32(f.Value)
+		}
+		return nil
+	})
+}
+
+// ReportResponse is the response of the Report RPC.
+type ReportResponse struct {
+	ServerID     string
+	ReporterName string
+	Success      bool
+	Data         string
+	ContentType  string
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *ReportResponse) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.ServerID)
+	e.String(2, m.ReporterName)
+	e.Bool(3, m.Success)
+	e.String(4, m.Data)
+	e.String(5, m.ContentType)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *ReportResponse) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.ServerID = f.String()
+		case 2:
+			m.ReporterName = f.String()
+		case 3:
+			m.Success = f.Value != 0
+		case 4:
+			m.Data = f.String()
+		case 5:
+			m.ContentType = f.String()
+		}
+		return nil
+	})
+}
+
+// StreamTestEventsRequest is the request of the StreamTestEvents RPC.
+type StreamTestEventsRequest struct {
+	Requestor     string
+	JobID         uint64
+	RunID         uint32
+	TestName      string
+	TestStepLabel string
+	Follow        bool
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *StreamTestEventsRequest) Marshal() []byte {
+	var e protowire.Encoder
+	e.String(1, m.Requestor)
+	e.Uint64(2, m.JobID)
+	e.Uint64(3, uint64(m.RunID))
+	e.String(4, m.TestName)
+	e.String(5, m.TestStepLabel)
+	e.Bool(6, m.Follow)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *StreamTestEventsRequest) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.Requestor = f.String()
+		case 2:
+			m.JobID = f.Value
+		case 3:
+			m.RunID = uint32(f.Value)
+		case 4:
+			m.TestName = f.String()
+		case 5:
+			m.TestStepLabel = f.String()
+		case 6:
+			m.Follow = f.Value != 0
+		}
+		return nil
+	})
+}
+
+// TestEvent is a message of the stream returned by the StreamTestEvents RPC.
+type TestEvent struct {
+	EmitTimeUnixNano int64
+	JobID            uint64
+	RunID            uint32
+	TestName         string
+	TestStepLabel    string
+	EventName        string
+	TargetID         string
+	TargetName       string
+	TargetFQDN       string
+	PayloadJSON      string
+}
+
+// Marshal encodes the message in the protobuf wire format.
+func (m *TestEvent) Marshal() []byte {
+	var e protowire.Encoder
+	e.Int64(1, m.EmitTimeUnixNano)
+	e.Uint64(2, m.JobID)
+	e.Uint64(3, uint64(m.RunID))
+	e.String(4, m.TestName)
+	e.String(5, m.TestStepLabel)
+	e.String(6, m.EventName)
+	e.String(7, m.TargetID)
+	e.String(8, m.TargetName)
+	e.String(9, m.TargetFQDN)
+	e.String(10, m.PayloadJSON)
+	return e.Buf
+}
+
+// Unmarshal decodes the message from the protobuf wire format.
+func (m *TestEvent) Unmarshal(data []byte) error {
+	return protowire.Decode(data, func(f protowire.Field) error {
+		switch f.Number {
+		case 1:
+			m.EmitTimeUnixNano = int64(f.Value)
+		case 2:
+			m.JobID = f.Value
+		case 3:
+			m.RunID = uint32(f.Value)
+		case 4:
+			m.TestName = f.String()
+		case 5:
+			m.TestStepLabel = f.String()
+		case 6:
+			m.EventName = f.String()
+		case 7:
+			m.TargetID = f.String()
+		case 8:
+			m.TargetName = f.String()
+		case 9:
+			m.TargetFQDN = f.String()
+		case 10:
+			m.PayloadJSON = f.String()
+		}
+		return nil
+	})
+}
@@ -0,0 +1,68 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package httplistener
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/facebookincubator/contest/pkg/api"
+)
+
+// Paths of the liveness and readiness probes, e.g. for load balancers and
+// Kubernetes. They are served without authentication nor rate limiting.
+const (
+	HealthzPath = "healthz"
+	ReadyzPath  = "readyz"
+)
+
+// healthHandler serves the probes.
+type healthHandler struct {
+	api *api.API
+}
+
+// withProbes serves the probes, and passes the other requests to next.
+func withProbes(a *api.API, next http.Handler) http.Handler {
+	h := &healthHandler{api: a}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/"+HealthzPath, h.healthz)
+	mux.HandleFunc("/"+ReadyzPath, h.readyz)
+	mux.Handle("/", next)
+	return mux
+}
+
+// healthz reports that the listener is alive.
+func (h *healthHandler) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	reply(w, http.StatusOK, "ok\n")
+}
+
+// readyz reports whether the server is ready to run jobs, with the result of
+// each of its checks.
+func (h *healthHandler) readyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	// probes are anonymous
+	resp, err := h.api.Readiness(api.EventRequestor(ReadyzPath))
+	if err == nil {
+		err = resp.Err
+	}
+	if err != nil {
+		msg, _ := json.Marshal(HTTPAPIError{Msg: fmt.Sprintf("Readiness failed: %v", err)})
+		reply(w, http.StatusServiceUnavailable, string(msg))
+		return
+	}
+	readiness, _ := resp.Data.(api.ResponseDataReadiness)
+	msg, err := json.Marshal(readiness)
+	if err != nil {
+		panic(fmt.Sprintf("cannot marshal readiness: %v", err))
+	}
+	httpStatus := http.StatusOK
+	if !readiness.Ready {
+		httpStatus = http.StatusServiceUnavailable
+	}
+	reply(w, httpStatus, string(msg))
+}
@@ -0,0 +1,53 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package httplistener
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/api"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbes(t *testing.T) {
+	a, err := api.New(nil)
+	require.NoError(t, err)
+	ready := true
+	go func() {
+		for ev := range a.Events {
+			ev.RespCh <- &api.EventResponse{
+				Requestor: ev.Msg.Requestor(),
+				Readiness: &api.ResponseDataReadiness{Ready: ready, Checks: []api.ReadinessCheck{{Name: "storage"}}},
+			}
+		}
+	}()
+	defer close(a.Events)
+	// the API itself refuses every request
+	h := withProbes(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	require.Equal(t, http.StatusOK, get("/"+HealthzPath).Code)
+	w := get("/" + ReadyzPath)
+	require.Equal(t, http.StatusOK, w.Code)
+	var readiness api.ResponseDataReadiness
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &readiness))
+	require.True(t, readiness.Ready)
+	require.Equal(t, "storage", readiness.Checks[0].Name)
+	require.Equal(t, http.StatusUnauthorized, get("/status").Code)
+
+	ready = false
+	require.Equal(t, http.StatusServiceUnavailable, get("/"+ReadyzPath).Code)
+}
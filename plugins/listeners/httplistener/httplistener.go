@@ -7,29 +7,97 @@ package httplistener
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/artifact"
+	"github.com/facebookincubator/contest/pkg/config"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/job"
 	"github.com/facebookincubator/contest/pkg/logging"
 	"github.com/facebookincubator/contest/pkg/types"
 )
 
 var log = logging.GetLogger("listeners/httplistener")
 
+// DefaultAddr is the address on which the API is served by default.
+const DefaultAddr = ":8080"
+
 // HTTPListener implements the api.Listener interface.
 type HTTPListener struct {
+	// Addr is the address on which the API is served, DefaultAddr if empty
+	Addr string
+	// Authenticator, if set, authenticates the requests, and the verified
+	// identity replaces the requestor supplied by the clients
+	Authenticator api.Authenticator
+	// CertFile and KeyFile are the TLS certificate and key of the server. If
+	// not set, the API is served over cleartext HTTP.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile, if set, enables mutual TLS: clients must present a
+	// certificate signed by one of the CAs in this PEM file. See
+	// api.ClientCertAuthenticator to use their common name as requestor.
+	ClientCAFile string
+	// RateLimiter, if set, limits the rate of the requests of each requestor,
+	// or of each client host if the requests are not authenticated
+	RateLimiter *api.RateLimiter
+}
+
+// tlsConfig returns the TLS configuration of the listener, or nil if TLS is
+// not enabled.
+func (h *HTTPListener) tlsConfig() (*tls.Config, error) {
+	if h.CertFile == "" && h.KeyFile == "" {
+		if h.ClientCAFile != "" {
+			return nil, errors.New("mutual TLS requires a server certificate and key")
+		}
+		return nil, nil
+	}
+	if h.CertFile == "" || h.KeyFile == "" {
+		return nil, errors.New("both the TLS certificate and key must be set")
+	}
+	cert, err := tls.LoadX509KeyPair(h.CertFile, h.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load TLS certificate: %v", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if h.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(h.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read client CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in client CA file %s", h.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
 }
 
 // HTTPAPIResponse is returned when an API method succeeds. It wraps the content
 // of an api.Response and reworks some of its fields
 type HTTPAPIResponse struct {
 	ServerID string
+	// RequestID is the ID of the request, also returned in the X-Request-ID
+	// header
+	RequestID string `json:",omitempty"`
 	// the original type is ResponseType. Here we want the mnemonic string to
 	// return in the HTTP API response.
 	Type  string
@@ -50,10 +118,11 @@ func NewHTTPAPIResponse(r *api.Response) *HTTPAPIResponse {
 		errStr = &e
 	}
 	return &HTTPAPIResponse{
-		ServerID: r.ServerID,
-		Type:     rtype,
-		Data:     r.Data,
-		Error:    errStr,
+		ServerID:  r.ServerID,
+		RequestID: r.RequestID,
+		Type:      rtype,
+		Data:      r.Data,
+		Error:     errStr,
 	}
 }
 
@@ -61,6 +130,11 @@ func NewHTTPAPIResponse(r *api.Response) *HTTPAPIResponse {
 // message.
 type HTTPAPIError struct {
 	Msg string
+	// RetryAfter is the number of seconds to wait before retrying calls
+	// which exceeded a limit
+	RetryAfter int `json:",omitempty"`
+	// RequestID is the ID of the failed request, to report it
+	RequestID string `json:",omitempty"`
 }
 
 func strToJobID(s string) (types.JobID, error) {
@@ -74,8 +148,268 @@ func strToJobID(s string) (types.JobID, error) {
 	return types.JobID(jobIDInt), nil
 }
 
+func strToScheduleID(s string) (types.ScheduleID, error) {
+	if strings.TrimSpace(s) == "" {
+		return 0, errors.New("schedule ID cannot be empty")
+	}
+	scheduleID, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return types.ScheduleID(scheduleID), nil
+}
+
+// templateValues parses the name=value pairs giving the values of the
+// variables of a template.
+func templateValues(pairs []string) (map[string]string, error) {
+	values := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid variable '%s', expected name=value", pair)
+		}
+		values[kv[0]] = kv[1]
+	}
+	return values, nil
+}
+
+// strToUint parses an optional non-negative integer parameter, which is zero
+// if not set by the client.
+func strToUint(name, s string) (uint, error) {
+	if strings.TrimSpace(s) == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s': %v", name, s, err)
+	}
+	return uint(n), nil
+}
+
+// pageParams parses the limit and offset parameters of paginated requests.
+func pageParams(r *http.Request) (uint, uint, error) {
+	limit, err := strToUint("limit", r.PostFormValue("limit"))
+	if err != nil {
+		return 0, 0, err
+	}
+	offset, err := strToUint("offset", r.PostFormValue("offset"))
+	if err != nil {
+		return 0, 0, err
+	}
+	return limit, offset, nil
+}
+
+// strToBool parses an optional boolean parameter, which is false if not set
+// by the client.
+func strToBool(name, s string) (bool, error) {
+	if strings.TrimSpace(s) == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s '%s': %v", name, s, err)
+	}
+	return b, nil
+}
+
+// strToTime parses an optional RFC 3339 time parameter, which is the zero
+// time if not set by the client.
+func strToTime(name, s string) (time.Time, error) {
+	if strings.TrimSpace(s) == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s '%s': %v", name, s, err)
+	}
+	return t, nil
+}
+
+// searchParams parses the parameters of a search request. All of them are
+// optional, and eventName can be repeated.
+func searchParams(r *http.Request) (api.TestEventSearch, error) {
+	var (
+		search api.TestEventSearch
+		err    error
+	)
+	if jobIDStr := r.PostFormValue("jobID"); jobIDStr != "" {
+		if search.JobID, err = strToJobID(jobIDStr); err != nil {
+			return search, err
+		}
+	}
+	runID, err := strToUint("runID", r.PostFormValue("runID"))
+	if err != nil {
+		return search, err
+	}
+	search.RunID = types.RunID(runID)
+	if search.EmittedStartTime, err = strToTime("emittedStartTime", r.PostFormValue("emittedStartTime")); err != nil {
+		return search, err
+	}
+	if search.EmittedEndTime, err = strToTime("emittedEndTime", r.PostFormValue("emittedEndTime")); err != nil {
+		return search, err
+	}
+	if search.Limit, search.Offset, err = pageParams(r); err != nil {
+		return search, err
+	}
+	for _, name := range r.PostForm["eventName"] {
+		search.EventNames = append(search.EventNames, event.Name(name))
+	}
+	search.TestName = r.PostFormValue("testName")
+	search.TestStepLabel = r.PostFormValue("testStepLabel")
+	search.TargetID = r.PostFormValue("targetID")
+	search.PayloadContains = r.PostFormValue("payloadContains")
+	search.PayloadPath = r.PostFormValue("payloadPath")
+	search.PayloadValue = r.PostFormValue("payloadValue")
+	return search, nil
+}
+
+// listParams parses the parameters of a list request. All of them are
+// optional, and state and tag can be repeated.
+func listParams(r *http.Request) (api.JobSearch, error) {
+	var (
+		search api.JobSearch
+		err    error
+	)
+	if search.RequestedAfter, err = strToTime("requestedAfter", r.PostFormValue("requestedAfter")); err != nil {
+		return search, err
+	}
+	if search.RequestedBefore, err = strToTime("requestedBefore", r.PostFormValue("requestedBefore")); err != nil {
+		return search, err
+	}
+	if search.Limit, search.Offset, err = pageParams(r); err != nil {
+		return search, err
+	}
+	search.JobRequestor = api.EventRequestor(r.PostFormValue("jobRequestor"))
+	search.States = r.PostForm["state"]
+	search.Tags = r.PostForm["tag"]
+	search.NameContains = r.PostFormValue("name")
+	if schedule := r.PostFormValue("scheduleID"); schedule != "" {
+		if search.ScheduleID, err = strToScheduleID(schedule); err != nil {
+			return search, fmt.Errorf("invalid scheduleID '%s': %v", schedule, err)
+		}
+	}
+	if retryOf := r.PostFormValue("retryOf"); retryOf != "" {
+		if search.RetryOf, err = strToJobID(retryOf); err != nil {
+			return search, fmt.Errorf("invalid retryOf '%s': %v", retryOf, err)
+		}
+	}
+	if rerunOf := r.PostFormValue("rerunOf"); rerunOf != "" {
+		if search.RerunOf, err = strToJobID(rerunOf); err != nil {
+			return search, fmt.Errorf("invalid rerunOf '%s': %v", rerunOf, err)
+		}
+	}
+	return search, nil
+}
+
+// historyParams returns the jobs selected by the parameters of a history
+// request.
+func historyParams(r *http.Request) (api.HistorySearch, error) {
+	var (
+		search api.HistorySearch
+		err    error
+	)
+	if search.RequestedAfter, err = strToTime("requestedAfter", r.PostFormValue("requestedAfter")); err != nil {
+		return search, err
+	}
+	if search.RequestedBefore, err = strToTime("requestedBefore", r.PostFormValue("requestedBefore")); err != nil {
+		return search, err
+	}
+	if search.Limit, _, err = pageParams(r); err != nil {
+		return search, err
+	}
+	search.JobName = r.PostFormValue("jobName")
+	search.Template = r.PostFormValue("template")
+	search.Tags = r.PostForm["tag"]
+	return search, nil
+}
+
+// auditParams parses the parameters of an auditLog request. All of them are
+// optional.
+func auditParams(r *http.Request) (api.AuditSearch, error) {
+	var (
+		search api.AuditSearch
+		err    error
+	)
+	if jobIDStr := r.PostFormValue("jobID"); jobIDStr != "" {
+		if search.JobID, err = strToJobID(jobIDStr); err != nil {
+			return search, err
+		}
+	}
+	if search.StartTime, err = strToTime("startTime", r.PostFormValue("startTime")); err != nil {
+		return search, err
+	}
+	if search.EndTime, err = strToTime("endTime", r.PostFormValue("endTime")); err != nil {
+		return search, err
+	}
+	if search.Limit, search.Offset, err = pageParams(r); err != nil {
+		return search, err
+	}
+	search.AuditRequestor = api.EventRequestor(r.PostFormValue("auditRequestor"))
+	search.Action = r.PostFormValue("action")
+	return search, nil
+}
+
+// quotaParams returns the requestor and the quota set by a setQuota request,
+// which is nil if the requestor is reset to the default quota.
+func quotaParams(r *http.Request) (api.EventRequestor, *api.Quota, error) {
+	quotaRequestor := api.EventRequestor(r.PostFormValue("quotaRequestor"))
+	reset, err := strToBool("reset", r.PostFormValue("reset"))
+	if err != nil || reset {
+		return quotaRequestor, nil, err
+	}
+	var quota api.Quota
+	maxTargets, err := strToUint("maxTargets", r.PostFormValue("maxTargets"))
+	if err != nil {
+		return quotaRequestor, nil, err
+	}
+	quota.MaxTargets = int(maxTargets)
+	if d := r.PostFormValue("maxRuntimePerDay"); d != "" {
+		if quota.MaxRuntimePerDay, err = time.ParseDuration(d); err != nil {
+			return quotaRequestor, nil, fmt.Errorf("invalid maxRuntimePerDay '%s': %v", d, err)
+		}
+	}
+	return quotaRequestor, &quota, nil
+}
+
+// bodyJobDescFormats are the content types of the job descriptors posted as
+// the body of start and validate requests, and their formats.
+var bodyJobDescFormats = map[string]config.JobDescFormat{
+	"application/json":   config.JobDescFormatJSON,
+	"application/yaml":   config.JobDescFormatYAML,
+	"application/x-yaml": config.JobDescFormatYAML,
+	"text/yaml":          config.JobDescFormatYAML,
+}
+
+// bodyJobDescriptor returns the job descriptor posted as the body of a
+// request, converted to JSON, or an empty string if the content type of the
+// request is not the one of a job descriptor. The other parameters of such a
+// request are passed in its query string.
+func bodyJobDescriptor(r *http.Request) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return "", nil
+	}
+	format, ok := bodyJobDescFormats[mediaType]
+	if !ok {
+		return "", nil
+	}
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", fmt.Errorf("could not read job descriptor: %v", err)
+	}
+	jobDescJSON, err := config.ParseJobDescriptor(data, format)
+	if err != nil {
+		return "", err
+	}
+	// the parameters are read from PostForm, which the body did not fill
+	r.PostForm = r.URL.Query()
+	return string(jobDescJSON), nil
+}
+
 type apiHandler struct {
 	api *api.API
+	// done is closed when the listener shuts down, to end the streams
+	done <-chan struct{}
 }
 
 func reply(w http.ResponseWriter, status int, msg string) {
@@ -85,7 +419,81 @@ func reply(w http.ResponseWriter, status int, msg string) {
 	}
 }
 
+// findReport returns the report of the given reporter from the response to a
+// status request. If run is empty, the final report is returned if there is
+// one, or the report of the last run otherwise.
+func findReport(resp api.Response, reporter, run string) (*job.Report, error) {
+	if reporter == "" {
+		return nil, errors.New("reporter name cannot be empty")
+	}
+	data, ok := resp.Data.(api.ResponseDataStatus)
+	if !ok || data.Status == nil || data.Status.JobReport == nil {
+		return nil, errors.New("no report available for the job")
+	}
+	runID := 0
+	if run != "" {
+		var err error
+		if runID, err = strconv.Atoi(run); err != nil || runID < 1 {
+			return nil, fmt.Errorf("invalid run '%s'", run)
+		}
+	}
+	return data.Status.JobReport.FindReport(reporter, runID)
+}
+
+// replyReport writes the data of a report. Reports rendered as documents,
+// e.g. JUnit XML, are written as they are, the others are encoded as JSON.
+func replyReport(w http.ResponseWriter, report *job.Report) {
+	if doc, ok := report.Data.(string); ok {
+		if strings.HasPrefix(doc, "<?xml") {
+			w.Header().Set("Content-Type", "application/xml")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		reply(w, http.StatusOK, doc)
+		return
+	}
+	msg, err := report.ToJSON()
+	if err != nil {
+		reply(w, http.StatusInternalServerError, fmt.Sprintf("cannot marshal report: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	reply(w, http.StatusOK, string(msg))
+}
+
+// replyArtifact writes the content of an artifact of the given job, e.g. the
+// page rendered by the HTML reporter.
+func replyArtifact(w http.ResponseWriter, jobID types.JobID, key string) error {
+	store := artifact.GetStore()
+	if store == nil {
+		return artifact.ErrNoStore
+	}
+	// artifact keys start with the job ID, see artifact.Key
+	if !strings.HasPrefix(key, fmt.Sprintf("%d/", jobID)) || path.Clean("/"+key) != "/"+key {
+		return fmt.Errorf("invalid artifact key '%s' for job %d", key, jobID)
+	}
+	r, err := store.Get(key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, r); err != nil {
+		log.Printf("Cannot write to client socket: %v", err)
+	}
+	return nil
+}
+
 func (h *apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// the calls record the ID of the request, see api.AccessLogMiddleware
+	if requestID := api.RequestIDFromContext(r.Context()); requestID != "" {
+		h = &apiHandler{api: h.api.ForRequest(requestID), done: h.done}
+	}
 	verb := strings.TrimLeft(r.URL.Path, "/")
 	var (
 		httpStatus = http.StatusOK
@@ -93,15 +501,46 @@ func (h *apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		errMsg     string
 		err        error
 	)
+	// streams are opened by GET requests: the event stream is a WebSocket,
+	// and the status stream uses server-sent events. The OpenAPI document and
+	// the web UI are fetched by GET requests too.
+	switch verb {
+	case "events/stream":
+		h.streamEvents(w, r)
+		return
+	case "status/stream":
+		h.streamStatus(w, r)
+		return
+	case OpenAPIPath:
+		replyOpenAPI(w)
+		return
+	case UIPath:
+		replyUI(w)
+		return
+	case "":
+		if r.Method == http.MethodGet {
+			http.Redirect(w, r, "/"+UIPath, http.StatusFound)
+			return
+		}
+	}
 	// This is only used by status, stop, and reply. Ignored for other
 	// methods. If not set by the client, this is an empty string.
 	if r.Method != "POST" {
 		reply(w, http.StatusBadRequest, "Only POST requests are supported")
 		return
 	}
+	var jobDesc string
+	if verb == "start" || verb == "validate" {
+		if jobDesc, err = bodyJobDescriptor(r); err != nil {
+			reply(w, http.StatusBadRequest, fmt.Sprintf("Invalid job description: %v", err))
+			return
+		}
+	}
+	if jobDesc == "" {
+		jobDesc = r.PostFormValue("jobDesc")
+	}
 	jobIDStr := r.PostFormValue("jobID")
-	jobDesc := r.PostFormValue("jobDesc")
-	requestor := api.EventRequestor(r.PostFormValue("requestor"))
+	requestor := api.RequestorFromContext(r.Context(), r.PostFormValue("requestor"))
 
 	switch verb {
 	case "start":
@@ -114,6 +553,34 @@ func (h *apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			httpStatus = http.StatusBadRequest
 			errMsg = fmt.Sprintf("Start failed: %v", err)
 		}
+	case "validate":
+		if jobDesc == "" {
+			httpStatus = http.StatusBadRequest
+			errMsg = "Missing job description"
+			break
+		}
+		if resp, err = h.api.Validate(requestor, jobDesc); err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Validate failed: %v", err)
+		}
+	case "batch":
+		jobDescs := r.PostForm["jobDesc"]
+		if len(jobDescs) == 0 {
+			httpStatus = http.StatusBadRequest
+			errMsg = "Missing job descriptions"
+			break
+		}
+		atomic, err := strToBool("atomic", r.PostFormValue("atomic"))
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Batch failed: %v", err)
+			break
+		}
+		// large batches may outlive the write timeout, see unboundedPaths
+		if resp, err = h.api.StartBatch(requestor, jobDescs, atomic); err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Batch failed: %v", err)
+		}
 	case "status":
 		jobID, err := strToJobID(jobIDStr)
 		if err != nil {
@@ -136,6 +603,39 @@ func (h *apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			httpStatus = http.StatusBadRequest
 			errMsg = fmt.Sprintf("Stop failed: %v", err)
 		}
+	case "pause", "resume":
+		jobID, err := strToJobID(jobIDStr)
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("%s failed: %v", verb, err)
+			break
+		}
+		if verb == "pause" {
+			resp, err = h.api.PauseJob(requestor, jobID)
+		} else {
+			resp, err = h.api.ResumeJob(requestor, jobID)
+		}
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("%s failed: %v", verb, err)
+		}
+	case "approve", "reject":
+		jobID, err := strToJobID(jobIDStr)
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("%s failed: %v", verb, err)
+			break
+		}
+		reason := r.PostFormValue("reason")
+		if verb == "approve" {
+			resp, err = h.api.ApproveJob(requestor, jobID, reason)
+		} else {
+			resp, err = h.api.RejectJob(requestor, jobID, reason)
+		}
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("%s failed: %v", verb, err)
+		}
 	case "retry":
 		jobID, err := strToJobID(jobIDStr)
 		if err != nil {
@@ -147,15 +647,280 @@ func (h *apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			httpStatus = http.StatusBadRequest
 			errMsg = fmt.Sprintf("Retry failed: %v", err)
 		}
+	case "rerun":
+		jobID, err := strToJobID(jobIDStr)
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Rerun failed: %v", err)
+			break
+		}
+		failedTargetsOnly, err := strToBool("failedTargetsOnly", r.PostFormValue("failedTargetsOnly"))
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Rerun failed: %v", err)
+			break
+		}
+		if resp, err = h.api.Rerun(requestor, jobID, failedTargetsOnly); err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Rerun failed: %v", err)
+		}
+	case "report":
+		jobID, err := strToJobID(jobIDStr)
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Report failed: %v", err)
+			break
+		}
+		if resp, err = h.api.Status(requestor, jobID); err != nil || resp.Err != nil {
+			if err == nil {
+				err = resp.Err
+			}
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Report failed: %v", err)
+			break
+		}
+		report, err := findReport(resp, r.PostFormValue("reporter"), r.PostFormValue("run"))
+		if err != nil {
+			httpStatus = http.StatusNotFound
+			errMsg = fmt.Sprintf("Report failed: %v", err)
+			break
+		}
+		replyReport(w, report)
+		return
+	case "artifact":
+		jobID, err := strToJobID(jobIDStr)
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Artifact failed: %v", err)
+			break
+		}
+		if err := replyArtifact(w, jobID, r.PostFormValue("key")); err != nil {
+			httpStatus = http.StatusNotFound
+			errMsg = fmt.Sprintf("Artifact failed: %v", err)
+			break
+		}
+		return
+	case "list":
+		search, err := listParams(r)
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("List failed: %v", err)
+			break
+		}
+		if resp, err = h.api.ListJobs(requestor, search); err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("List failed: %v", err)
+		}
+	case "reports":
+		search, err := listParams(r)
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Reports failed: %v", err)
+			break
+		}
+		if resp, err = h.api.Reports(requestor, search); err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Reports failed: %v", err)
+		}
+	case "history":
+		search, err := historyParams(r)
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("History failed: %v", err)
+			break
+		}
+		if resp, err = h.api.History(requestor, search); err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("History failed: %v", err)
+		}
+	case "events":
+		jobID, err := strToJobID(jobIDStr)
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Events failed: %v", err)
+			break
+		}
+		runID, err := strToUint("runID", r.PostFormValue("runID"))
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Events failed: %v", err)
+			break
+		}
+		limit, offset, err := pageParams(r)
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Events failed: %v", err)
+			break
+		}
+		if resp, err = h.api.TestEvents(requestor, jobID, types.RunID(runID), r.PostFormValue("testName"), r.PostFormValue("testStepLabel"), limit, offset); err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Events failed: %v", err)
+		}
+	case "search":
+		search, err := searchParams(r)
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Search failed: %v", err)
+			break
+		}
+		if resp, err = h.api.SearchTestEvents(requestor, search); err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Search failed: %v", err)
+		}
+	case "drain":
+		var deadline time.Duration
+		if d := r.PostFormValue("deadline"); d != "" {
+			if deadline, err = time.ParseDuration(d); err != nil {
+				httpStatus = http.StatusBadRequest
+				errMsg = fmt.Sprintf("Drain failed: invalid deadline '%s': %v", d, err)
+				break
+			}
+		}
+		if resp, err = h.api.Drain(requestor, deadline); err != nil {
+			httpStatus = http.StatusInternalServerError
+			errMsg = fmt.Sprintf("Drain failed: %v", err)
+		}
+	case "unlockTargets":
+		if resp, err = h.api.UnlockTargets(requestor, r.PostForm["target"]); err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("UnlockTargets failed: %v", err)
+		}
+	case "quotas":
+		if resp, err = h.api.Quotas(requestor); err != nil {
+			httpStatus = http.StatusInternalServerError
+			errMsg = fmt.Sprintf("Quotas failed: %v", err)
+		}
+	case "setQuota":
+		quotaRequestor, quota, err := quotaParams(r)
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("SetQuota failed: %v", err)
+			break
+		}
+		if resp, err = h.api.SetQuota(requestor, quotaRequestor, quota); err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("SetQuota failed: %v", err)
+		}
+	case "logLevels":
+		if resp, err = h.api.LogLevels(requestor); err != nil {
+			httpStatus = http.StatusInternalServerError
+			errMsg = fmt.Sprintf("LogLevels failed: %v", err)
+		}
+	case "setLogLevel":
+		if resp, err = h.api.SetLogLevel(requestor, r.PostFormValue("module"), r.PostFormValue("level")); err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("SetLogLevel failed: %v", err)
+		}
+	case "auditLog":
+		search, err := auditParams(r)
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("AuditLog failed: %v", err)
+			break
+		}
+		if resp, err = h.api.AuditLog(requestor, search); err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("AuditLog failed: %v", err)
+		}
+	case "schedule":
+		if jobDesc == "" {
+			httpStatus = http.StatusBadRequest
+			errMsg = "Missing job description"
+			break
+		}
+		if resp, err = h.api.CreateSchedule(requestor, r.PostFormValue("name"), r.PostFormValue("cron"), jobDesc); err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("Schedule failed: %v", err)
+		}
+	case "schedules":
+		if resp, err = h.api.ListSchedules(requestor); err != nil {
+			httpStatus = http.StatusInternalServerError
+			errMsg = fmt.Sprintf("Schedules failed: %v", err)
+		}
+	case "pauseSchedule", "resumeSchedule", "deleteSchedule":
+		scheduleID, err := strToScheduleID(r.PostFormValue("scheduleID"))
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("%s failed: %v", verb, err)
+			break
+		}
+		switch verb {
+		case "pauseSchedule":
+			resp, err = h.api.PauseSchedule(requestor, scheduleID)
+		case "resumeSchedule":
+			resp, err = h.api.ResumeSchedule(requestor, scheduleID)
+		default:
+			resp, err = h.api.DeleteSchedule(requestor, scheduleID)
+		}
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("%s failed: %v", verb, err)
+		}
+	case "saveTemplate":
+		template := r.PostFormValue("template")
+		if template == "" {
+			httpStatus = http.StatusBadRequest
+			errMsg = "Missing template"
+			break
+		}
+		if resp, err = h.api.SaveTemplate(requestor, template); err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("SaveTemplate failed: %v", err)
+		}
+	case "templates":
+		if resp, err = h.api.ListTemplates(requestor); err != nil {
+			httpStatus = http.StatusInternalServerError
+			errMsg = fmt.Sprintf("Templates failed: %v", err)
+		}
+	case "deleteTemplate":
+		if resp, err = h.api.DeleteTemplate(requestor, r.PostFormValue("name")); err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("DeleteTemplate failed: %v", err)
+		}
+	case "startTemplate":
+		values, err := templateValues(r.PostForm["var"])
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("StartTemplate failed: %v", err)
+			break
+		}
+		if resp, err = h.api.StartTemplate(requestor, r.PostFormValue("name"), values); err != nil {
+			httpStatus = http.StatusBadRequest
+			errMsg = fmt.Sprintf("StartTemplate failed: %v", err)
+		}
+	case "plugins":
+		if resp, err = h.api.Plugins(requestor); err != nil {
+			httpStatus = http.StatusInternalServerError
+			errMsg = fmt.Sprintf("Plugins failed: %v", err)
+		}
 	case "version":
 		resp = h.api.Version()
 	default:
 		errMsg = fmt.Sprintf("unknown verb: %s", verb)
 		httpStatus = http.StatusBadRequest
 	}
+	// denied and limited calls are rejected like unauthenticated ones,
+	// instead of being reported in the response
+	if httpStatus == http.StatusOK && errors.Is(resp.Err, api.ErrForbidden) {
+		httpStatus = http.StatusForbidden
+		errMsg = resp.Err.Error()
+	}
+	if httpStatus == http.StatusOK && errors.Is(resp.Err, api.ErrDraining) {
+		httpStatus = http.StatusServiceUnavailable
+		errMsg = resp.Err.Error()
+	}
+	var retryAfter int
+	if d, ok := api.RetryAfter(resp.Err); ok && httpStatus == http.StatusOK {
+		httpStatus = http.StatusTooManyRequests
+		errMsg = resp.Err.Error()
+		retryAfter = api.RetryAfterSeconds(d)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
 	if httpStatus != http.StatusOK {
 		errResp := HTTPAPIError{
-			Msg: errMsg,
+			Msg:        errMsg,
+			RetryAfter: retryAfter,
+			RequestID:  api.RequestIDFromContext(r.Context()),
 		}
 		msg, err := json.Marshal(errResp)
 		if err != nil {
@@ -177,6 +942,10 @@ func (h *apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	reply(w, httpStatus, string(msg))
 }
 
+// shutdownTimeout is the time given to the requests in flight to complete
+// when the listener shuts down.
+var shutdownTimeout = 5 * time.Second
+
 func listenWithCancellation(cancel <-chan struct{}, s *http.Server) error {
 	var (
 		errCh = make(chan error, 1)
@@ -184,7 +953,12 @@ func listenWithCancellation(cancel <-chan struct{}, s *http.Server) error {
 	// start the listener asynchronously, and report errors and completion via
 	// channels.
 	go func() {
-		errCh <- s.ListenAndServe()
+		if s.TLSConfig != nil {
+			// the certificate is already in the TLS configuration
+			errCh <- s.ListenAndServeTLS("", "")
+		} else {
+			errCh <- s.ListenAndServe()
+		}
 	}()
 	log.Infof("Started HTTP API listener on %s", s.Addr)
 	// wait for cancellation or for completion
@@ -193,21 +967,67 @@ func listenWithCancellation(cancel <-chan struct{}, s *http.Server) error {
 		return err
 	case <-cancel:
 		log.Printf("Received server shut down request")
-		return s.Close()
+		// the requests in flight are completed, e.g. the one which drained
+		// the server, while the streams end as cancel is closed
+		ctx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancelShutdown()
+		if err := s.Shutdown(ctx); err != nil {
+			return s.Close()
+		}
+		return nil
 	}
 }
 
+// writeTimeout is the time allowed to serve a request, except for the
+// requests whose response is not bounded, see unboundedPaths.
+var writeTimeout = 10 * time.Second
+
+// unboundedPaths are the paths of the requests whose response may take
+// longer than writeTimeout: the streams, which last as long as the jobs they
+// follow, and the batches, whose jobs are all validated and stored before
+// the reply.
+var unboundedPaths = map[string]bool{
+	"/events/stream": true,
+	"/status/stream": true,
+	"/batch":         true,
+}
+
+// withWriteTimeout replies with an error to the requests which are not served
+// within writeTimeout, except for unboundedPaths. The server has no write
+// timeout, which would end the streams, and the deadline of a single
+// response cannot be lifted.
+func withWriteTimeout(next http.Handler) http.Handler {
+	bounded := http.TimeoutHandler(next, writeTimeout, "Request timed out")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unboundedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		bounded.ServeHTTP(w, r)
+	})
+}
+
 // Serve implements the api.Listener.Serve interface method. It starts an HTTP
 // API listener and returns an api.Event channel that the caller can iterate on.
 func (h *HTTPListener) Serve(cancel <-chan struct{}, a *api.API) error {
 	if a == nil {
 		return errors.New("API object is nil")
 	}
+	tlsConfig, err := h.tlsConfig()
+	if err != nil {
+		return fmt.Errorf("HTTP listener failed: %v", err)
+	}
+	addr := h.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+	// the write timeout is enforced by withWriteTimeout, as the streams
+	// outlive it
 	s := http.Server{
-		Addr:         ":8080",
-		Handler:      &apiHandler{api: a},
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		Addr:        addr,
+		TLSConfig:   tlsConfig,
+		Handler:     withWriteTimeout(withProbes(a, api.AccessLogMiddleware(api.AuthMiddleware(h.Authenticator, api.RateLimitMiddleware(h.RateLimiter, &apiHandler{api: a, done: cancel}))))),
+		ReadTimeout: 10 * time.Second,
 	}
 	if err := listenWithCancellation(cancel, &s); err != nil {
 		return fmt.Errorf("HTTP listener failed: %v", err)
@@ -0,0 +1,56 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package httplistener
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/api"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartYAML(t *testing.T) {
+	a, err := api.New(nil)
+	require.NoError(t, err)
+	started := make(chan api.EventStartMsg, 2)
+	go func() {
+		for ev := range a.Events {
+			started <- ev.Msg.(api.EventStartMsg)
+			ev.RespCh <- &api.EventResponse{Requestor: ev.Msg.Requestor(), JobID: 1}
+		}
+	}()
+	server := httptest.NewServer(&apiHandler{api: a, done: make(chan struct{})})
+	defer server.Close()
+
+	// YAML job descriptors are converted to JSON, whether they are posted as
+	// a parameter or as the body of the request
+	resp, err := http.PostForm(server.URL+"/start", url.Values{"requestor": {"test"}, "jobDesc": {"JobName: yaml job\nRuns: 1\n"}})
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, err = http.Post(server.URL+"/start?requestor=test", "application/yaml", strings.NewReader("JobName: yaml job\nRuns: 1\n"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	for i := 0; i < 2; i++ {
+		msg := <-started
+		require.Equal(t, api.EventRequestor("test"), msg.Requestor())
+		var jobDesc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(msg.JobDescriptor), &jobDesc))
+		require.Equal(t, "yaml job", jobDesc["JobName"])
+	}
+
+	resp, err = http.Post(server.URL+"/start?requestor=test", "application/yaml", strings.NewReader("JobName: [\n"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,421 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package httplistener
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/api"
+)
+
+// OpenAPIPath is the path of the OpenAPI document describing the API.
+const OpenAPIPath = "openapi.json"
+
+// param is a parameter of an endpoint, sent in the form of POST requests or
+// in the query of GET requests.
+type param struct {
+	name        string
+	typ         string
+	format      string
+	repeated    bool
+	required    bool
+	description string
+}
+
+// endpoint describes a verb of the API. If data is set, the response is an
+// HTTPAPIResponse whose Data is of the same type; otherwise contentType is
+// the media type of the response.
+type endpoint struct {
+	verb        string
+	method      string
+	summary     string
+	params      []param
+	data        interface{}
+	contentType string
+}
+
+var (
+	paramRequestor = param{name: "requestor", typ: "string", description: "Requestor of the call, replaced by the authenticated identity if any"}
+	paramJobID     = param{name: "jobID", typ: "integer", format: "int64", required: true, description: "ID of the job"}
+	paramLimit     = param{name: "limit", typ: "integer", description: "Maximum number of items returned, capped by the server"}
+	paramOffset    = param{name: "offset", typ: "integer", description: "Number of items skipped"}
+	paramTemplate  = param{name: "name", typ: "string", required: true, description: "Name of the job template"}
+	paramSchedule  = param{name: "scheduleID", typ: "integer", format: "int64", required: true, description: "ID of the schedule"}
+	paramReason    = param{name: "reason", typ: "string", description: "Reason of the decision, recorded in the events of the job"}
+)
+
+// paramsJobSearch select the jobs of the requests listing jobs, see listParams.
+var paramsJobSearch = []param{
+	{name: "jobRequestor", typ: "string", description: "Requestor of the jobs"},
+	{name: "state", typ: "string", repeated: true, description: "Current state of the jobs, e.g. JobStateCompleted"},
+	{name: "tag", typ: "string", repeated: true, description: "Tag of the jobs, which must have all the given tags"},
+	{name: "requestedAfter", typ: "string", format: "date-time", description: "Earliest request time of the jobs"},
+	{name: "requestedBefore", typ: "string", format: "date-time", description: "Request time before which the jobs were requested"},
+	{name: "name", typ: "string", description: "Substring of the name of the jobs"},
+	optional(paramSchedule),
+	{name: "retryOf", typ: "integer", format: "int64", description: "ID of the job whose retries are listed"},
+	{name: "rerunOf", typ: "integer", format: "int64", description: "ID of the job whose reruns are listed"},
+	paramLimit, paramOffset,
+}
+
+func optional(p param) param {
+	p.required = false
+	return p
+}
+
+// endpoints are the verbs served by apiHandler.
+var endpoints = []endpoint{
+	{verb: "start", method: http.MethodPost, summary: "Start a job", data: api.ResponseDataStart{}, params: []param{
+		paramRequestor,
+		{name: "jobDesc", typ: "string", required: true, description: "JSON or YAML job descriptor, which can also be posted as the body of the request, with a JSON or YAML content type"},
+	}},
+	{verb: "validate", method: http.MethodPost, summary: "Validate a job descriptor without starting a job", data: api.ResponseDataValidate{}, params: []param{
+		paramRequestor,
+		{name: "jobDesc", typ: "string", required: true, description: "JSON or YAML job descriptor, which can also be posted as the body of the request, with a JSON or YAML content type"},
+	}},
+	{verb: "batch", method: http.MethodPost, summary: "Start a batch of jobs", data: api.ResponseDataStartBatch{}, params: []param{
+		paramRequestor,
+		{name: "jobDesc", typ: "string", repeated: true, required: true, description: "JSON or YAML job descriptors"},
+		{name: "atomic", typ: "boolean", description: "Start no job unless all the job descriptors are valid"},
+	}},
+	{verb: "stop", method: http.MethodPost, summary: "Stop a job", data: api.ResponseDataStop{}, params: []param{paramRequestor, paramJobID}},
+	{verb: "pause", method: http.MethodPost, summary: "Pause a running job, which can be resumed later", data: api.ResponseDataPauseJob{}, params: []param{paramRequestor, paramJobID}},
+	{verb: "resume", method: http.MethodPost, summary: "Resume a paused job from the run in which it was paused", data: api.ResponseDataPauseJob{}, params: []param{paramRequestor, paramJobID}},
+	{verb: "approve", method: http.MethodPost, summary: "Approve a job awaiting approval, which then starts", data: api.ResponseDataApproveJob{}, params: []param{paramRequestor, paramJobID, paramReason}},
+	{verb: "reject", method: http.MethodPost, summary: "Reject a job awaiting approval, which is cancelled", data: api.ResponseDataApproveJob{}, params: []param{paramRequestor, paramJobID, paramReason}},
+	{verb: "status", method: http.MethodPost, summary: "Get the status of a job", data: api.ResponseDataStatus{}, params: []param{paramRequestor, paramJobID}},
+	{verb: "retry", method: http.MethodPost, summary: "Retry a job", data: api.ResponseDataRetry{}, params: []param{paramRequestor, paramJobID}},
+	{verb: "rerun", method: http.MethodPost, summary: "Start an ended job again, as a new job linked to it", data: api.ResponseDataRetry{}, params: []param{
+		paramRequestor, paramJobID,
+		{name: "failedTargetsOnly", typ: "boolean", description: "Only test the targets which did not pass the job"},
+	}},
+	{verb: "report", method: http.MethodPost, summary: "Get a report of a job, as produced by the reporter", contentType: "application/json", params: []param{
+		paramRequestor, paramJobID,
+		{name: "reporter", typ: "string", description: "Name of the reporter, if the job has several"},
+		{name: "run", typ: "string", description: "Run of the report, e.g. 1, or final. Defaults to the final report if any, or the report of the last run"},
+	}},
+	{verb: "artifact", method: http.MethodPost, summary: "Download an artifact of a job", contentType: "application/octet-stream", params: []param{
+		paramRequestor, paramJobID,
+		{name: "key", typ: "string", required: true, description: "Key of the artifact"},
+	}},
+	{verb: "list", method: http.MethodPost, summary: "List the jobs, most recent first", data: api.ResponseDataList{}, params: append([]param{paramRequestor}, paramsJobSearch...)},
+	{verb: "reports", method: http.MethodPost, summary: "Get the reports of the jobs, most recent first", data: api.ResponseDataReports{}, params: append([]param{paramRequestor}, paramsJobSearch...)},
+	{verb: "history", method: http.MethodPost, summary: "Get the pass rate and durations of the most recent jobs sharing a name or a template, and of their tests and steps", data: api.ResponseDataHistory{}, params: []param{
+		paramRequestor,
+		{name: "jobName", typ: "string", description: "Name of the jobs, required unless template is set"},
+		{name: "template", typ: "string", description: "Name of the template the jobs were started from, required unless jobName is set"},
+		{name: "tag", typ: "string", repeated: true, description: "Tag of the jobs, which must have all the given tags"},
+		{name: "requestedAfter", typ: "string", format: "date-time", description: "Earliest request time of the jobs"},
+		{name: "requestedBefore", typ: "string", format: "date-time", description: "Request time before which the jobs were requested"},
+		{name: "limit", typ: "integer", description: "Maximum number of jobs aggregated, capped by the server"},
+	}},
+	{verb: "events", method: http.MethodPost, summary: "Get the test events of a job, in emission order", data: api.ResponseDataTestEvents{}, params: []param{
+		paramRequestor, paramJobID,
+		{name: "runID", typ: "integer", description: "Run of the events"},
+		{name: "testName", typ: "string", description: "Test of the events"},
+		{name: "testStepLabel", typ: "string", description: "Test step of the events"},
+		paramLimit, paramOffset,
+	}},
+	{verb: "search", method: http.MethodPost, summary: "Search test events, in emission order", data: api.ResponseDataTestEvents{}, params: []param{
+		paramRequestor, optional(paramJobID),
+		{name: "runID", typ: "integer", description: "Run of the events"},
+		{name: "testName", typ: "string", description: "Test of the events"},
+		{name: "testStepLabel", typ: "string", description: "Test step of the events"},
+		{name: "eventName", typ: "string", repeated: true, description: "Name of the events"},
+		{name: "targetID", typ: "string", description: "Target of the events"},
+		{name: "emittedStartTime", typ: "string", format: "date-time", description: "Earliest emission time of the events"},
+		{name: "emittedEndTime", typ: "string", format: "date-time", description: "Latest emission time of the events"},
+		{name: "payloadContains", typ: "string", description: "Substring of the payload of the events, requires a job ID"},
+		{name: "payloadPath", typ: "string", description: "JSON path in the payload of the events, requires a job ID"},
+		{name: "payloadValue", typ: "string", description: "Value at payloadPath in the payload of the events"},
+		paramLimit, paramOffset,
+	}},
+	{verb: "drain", method: http.MethodPost, summary: "Drain the server: no job is started anymore, and the server exits once its jobs ended. The status of job submissions is then 503", data: api.ResponseDataDrain{}, params: []param{
+		paramRequestor,
+		{name: "deadline", typ: "string", description: "Duration after which the jobs still running are paused, e.g. 30m. If unset, the jobs are waited for"},
+	}},
+	{verb: "unlockTargets", method: http.MethodPost, summary: "Release the locks held on targets by jobs which the server does not run, e.g. jobs which crashed", data: api.ResponseDataUnlockTargets{}, params: []param{
+		paramRequestor,
+		{name: "target", typ: "string", repeated: true, required: true, description: "ID of the targets to unlock"},
+	}},
+	{verb: "quotas", method: http.MethodPost, summary: "Get the quotas of the requestors, and the targets and runtime their jobs use", data: api.ResponseDataQuotas{}, params: []param{paramRequestor}},
+	{verb: "setQuota", method: http.MethodPost, summary: "Set the quota of a requestor, or the default quota, until the server restarts", data: api.ResponseDataQuotas{}, params: []param{
+		paramRequestor,
+		{name: "quotaRequestor", typ: "string", description: "Requestor whose quota is set. If unset, the default quota is set"},
+		{name: "maxTargets", typ: "integer", description: "Number of targets which the jobs of the requestor may lock at once. If unset, targets are not limited"},
+		{name: "maxRuntimePerDay", typ: "string", description: "Time for which the jobs of the requestor may run each day, in UTC, e.g. 8h. If unset, runtime is not limited"},
+		{name: "reset", typ: "boolean", description: "Make the requestor use the default quota again"},
+	}},
+	{verb: "logLevels", method: http.MethodPost, summary: "Get the default log level of the server, and the levels of its modules", data: api.ResponseDataLogLevels{}, params: []param{paramRequestor}},
+	{verb: "setLogLevel", method: http.MethodPost, summary: "Set the log level of a module of the server, or the default level, until the server restarts", data: api.ResponseDataLogLevels{}, params: []param{
+		paramRequestor,
+		{name: "module", typ: "string", description: "Module whose level is set, e.g. pkg/runner. If unset, the default level is set"},
+		{name: "level", typ: "string", description: "Level, e.g. debug or info. If unset, the module logs at the default level again"},
+	}},
+	{verb: "auditLog", method: http.MethodPost, summary: "Get the records of the API calls which changed the state of jobs or of the server, in the order they were made", data: api.ResponseDataAuditLog{}, params: []param{
+		paramRequestor,
+		{name: "auditRequestor", typ: "string", description: "Requestor of the calls"},
+		{name: "action", typ: "string", description: "Type of the calls, e.g. start or stop"},
+		optional(paramJobID),
+		{name: "startTime", typ: "string", format: "date-time", description: "Earliest time of the calls"},
+		{name: "endTime", typ: "string", format: "date-time", description: "Latest time of the calls"},
+		paramLimit, paramOffset,
+	}},
+	{verb: "schedule", method: http.MethodPost, summary: "Create a schedule, which starts a job every time its cron expression activates", data: api.ResponseDataSchedule{}, params: []param{
+		paramRequestor,
+		{name: "jobDesc", typ: "string", required: true, description: "JSON or YAML job descriptor"},
+		{name: "cron", typ: "string", required: true, description: "Cron expression, e.g. 0 2 * * * or @daily, evaluated in the time zone of the server"},
+		{name: "name", typ: "string", description: "Name of the schedule. Defaults to the name of the job"},
+	}},
+	{verb: "schedules", method: http.MethodPost, summary: "List the schedules", data: api.ResponseDataSchedules{}, params: []param{paramRequestor}},
+	{verb: "pauseSchedule", method: http.MethodPost, summary: "Pause a schedule", data: api.ResponseDataSchedule{}, params: []param{paramRequestor, paramSchedule}},
+	{verb: "resumeSchedule", method: http.MethodPost, summary: "Resume a schedule. If activations were missed, a job is started at once", data: api.ResponseDataSchedule{}, params: []param{paramRequestor, paramSchedule}},
+	{verb: "deleteSchedule", method: http.MethodPost, summary: "Delete a schedule. The jobs it started are kept", data: api.ResponseDataSchedule{}, params: []param{paramRequestor, paramSchedule}},
+	{verb: "saveTemplate", method: http.MethodPost, summary: "Store a job template, or replace the one with the same name", data: api.ResponseDataTemplate{}, params: []param{
+		paramRequestor,
+		{name: "template", typ: "string", required: true, description: "JSON job template, with Name, Description, Variables and JobDescriptor, whose strings may reference the variables as ${name}"},
+	}},
+	{verb: "templates", method: http.MethodPost, summary: "List the job templates", data: api.ResponseDataTemplates{}, params: []param{paramRequestor}},
+	{verb: "deleteTemplate", method: http.MethodPost, summary: "Delete a job template. The jobs started from it are kept", data: api.ResponseDataTemplate{}, params: []param{paramRequestor, paramTemplate}},
+	{verb: "startTemplate", method: http.MethodPost, summary: "Start a job from a job template", data: api.ResponseDataStart{}, params: []param{
+		paramRequestor, paramTemplate,
+		{name: "var", typ: "string", repeated: true, description: "Value of a variable of the template, as name=value. Variables with a default value may be omitted"},
+	}},
+	{verb: "plugins", method: http.MethodPost, summary: "List the registered plugins, the events which each test step may emit, and the schemas of their parameters", data: api.ResponseDataPlugins{}, params: []param{paramRequestor}},
+	{verb: "version", method: http.MethodPost, summary: "Get the version of the API", data: api.ResponseDataVersion{}},
+	{verb: "events/stream", method: http.MethodGet, summary: "Stream the events of a job over a WebSocket, as StreamedEvent text messages", contentType: "application/json", data: StreamedEvent{}, params: []param{paramJobID}},
+	{verb: "status/stream", method: http.MethodGet, summary: "Stream the state transitions of a job, or of all the jobs, as server-sent events with JobStateUpdate data", contentType: "text/event-stream", data: JobStateUpdate{}, params: []param{
+		paramRequestor, optional(paramJobID),
+	}},
+	{verb: HealthzPath, method: http.MethodGet, summary: "Check that the server is alive", contentType: "text/plain"},
+	{verb: ReadyzPath, method: http.MethodGet, summary: "Check that the server is ready to run jobs. The status is 503 if it is not", contentType: "application/json", data: api.ResponseDataReadiness{}},
+	{verb: UIPath, method: http.MethodGet, summary: "Get the web UI", contentType: "text/html"},
+	{verb: OpenAPIPath, method: http.MethodGet, summary: "Get this OpenAPI document", contentType: "application/json"},
+}
+
+// schemaGenerator builds JSON schemas from Go types, with the named structs
+// as components referenced by name.
+type schemaGenerator struct {
+	components map[string]interface{}
+}
+
+// componentName returns the name of the component of a named struct, e.g.
+// job.Status.
+func componentName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	return pkg[strings.LastIndex(pkg, "/")+1:] + "." + t.Name()
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		return map[string]interface{}{}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := g.schema(t.Elem())
+		if _, ok := s["$ref"]; ok {
+			return map[string]interface{}{"allOf": []interface{}{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := componentName(t)
+		if _, ok := g.components[name]; !ok {
+			// registered before the fields, for recursive types
+			g.components[name] = nil
+			g.components[name] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	// interfaces, and the kinds which cannot be encoded, can be anything
+	return map[string]interface{}{}
+}
+
+// structSchema returns the schema of a struct as encoded by encoding/json,
+// with the fields of the embedded structs promoted.
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts := tag, ""
+			if idx := strings.Index(tag, ","); idx >= 0 {
+				name, opts = tag[:idx], tag[idx+1:]
+			}
+			if f.Anonymous && name == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					addFields(ft)
+					continue
+				}
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = g.schema(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+	s := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// responseSchema returns the schema of the HTTPAPIResponse of an endpoint.
+func (g *schemaGenerator) responseSchema(data interface{}) map[string]interface{} {
+	s := g.structSchema(reflect.TypeOf(HTTPAPIResponse{}))
+	s["properties"].(map[string]interface{})["Data"] = g.schema(reflect.TypeOf(data))
+	return s
+}
+
+func (e endpoint) operation(g *schemaGenerator) map[string]interface{} {
+	op := map[string]interface{}{
+		"operationId": strings.ReplaceAll(strings.TrimSuffix(e.verb, ".json"), "/", "_"),
+		"summary":     e.summary,
+	}
+	if len(e.params) > 0 {
+		properties := make(map[string]interface{})
+		var (
+			required []string
+			params   []interface{}
+		)
+		for _, p := range e.params {
+			s := map[string]interface{}{"type": p.typ, "description": p.description}
+			if p.format != "" {
+				s["format"] = p.format
+			}
+			if p.repeated {
+				s = map[string]interface{}{"type": "array", "items": s, "description": p.description}
+			}
+			if e.method == http.MethodGet {
+				params = append(params, map[string]interface{}{"name": p.name, "in": "query", "required": p.required, "schema": s})
+				continue
+			}
+			properties[p.name] = s
+			if p.required {
+				required = append(required, p.name)
+			}
+		}
+		if e.method == http.MethodGet {
+			op["parameters"] = params
+		} else {
+			form := map[string]interface{}{"type": "object", "properties": properties}
+			if len(required) > 0 {
+				form["required"] = required
+			}
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/x-www-form-urlencoded": map[string]interface{}{"schema": form},
+				},
+			}
+		}
+	}
+	var ok map[string]interface{}
+	description := "The call succeeded"
+	switch {
+	case e.contentType == "":
+		ok = map[string]interface{}{"schema": g.responseSchema(e.data)}
+		e.contentType = "application/json"
+		description = "The call succeeded, or failed with an Error in the response"
+	case e.data != nil:
+		ok = map[string]interface{}{"schema": g.schema(reflect.TypeOf(e.data))}
+	default:
+		ok = map[string]interface{}{}
+	}
+	errResp := map[string]interface{}{
+		"description": "The call failed",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(HTTPAPIError{}))},
+		},
+	}
+	op["responses"] = map[string]interface{}{
+		"200": map[string]interface{}{
+			"description": description,
+			"content":     map[string]interface{}{e.contentType: ok},
+		},
+		"400": errResp,
+		"401": map[string]interface{}{"description": "The client could not be authenticated"},
+		"403": errResp,
+		"429": errResp,
+	}
+	return op
+}
+
+// OpenAPI returns the OpenAPI 3 document describing the API served by the
+// HTTP listener. The schemas of the payloads are generated from the types of
+// the API.
+func OpenAPI() map[string]interface{} {
+	g := schemaGenerator{components: make(map[string]interface{})}
+	paths := make(map[string]interface{})
+	for _, e := range endpoints {
+		paths["/"+e.verb] = map[string]interface{}{strings.ToLower(e.method): e.operation(&g)}
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "ConTest HTTP API",
+			"version": fmt.Sprintf("%d", api.CurrentAPIVersion),
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": g.components},
+	}
+}
+
+func replyOpenAPI(w http.ResponseWriter) {
+	msg, err := json.Marshal(OpenAPI())
+	if err != nil {
+		reply(w, http.StatusInternalServerError, fmt.Sprintf("cannot marshal OpenAPI document: %v", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	reply(w, http.StatusOK, string(msg))
+}
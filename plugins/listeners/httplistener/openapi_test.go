@@ -0,0 +1,81 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package httplistener
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/api"
+
+	"github.com/stretchr/testify/require"
+)
+
+// collectRefs returns the components referenced in a JSON document.
+func collectRefs(v interface{}, refs map[string]bool) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if ref, ok := val.(string); ok && k == "$ref" {
+				refs[strings.TrimPrefix(ref, "#/components/schemas/")] = true
+				continue
+			}
+			collectRefs(val, refs)
+		}
+	case []interface{}:
+		for _, val := range v {
+			collectRefs(val, refs)
+		}
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	a, err := api.New(nil)
+	require.NoError(t, err)
+	go func() {
+		for ev := range a.Events {
+			ev.RespCh <- &api.EventResponse{Requestor: ev.Msg.Requestor()}
+		}
+	}()
+	defer close(a.Events)
+	h := &apiHandler{api: a}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+OpenAPIPath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	require.Equal(t, "3.0.3", doc["openapi"])
+
+	// every referenced component is defined
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	refs := make(map[string]bool)
+	collectRefs(doc, refs)
+	require.NotEmpty(t, refs)
+	for ref := range refs {
+		require.Contains(t, schemas, ref)
+	}
+
+	// the payloads follow the API types
+	status := schemas["job.Status"].(map[string]interface{})["properties"].(map[string]interface{})
+	require.Equal(t, map[string]interface{}{"type": "string", "format": "date-time"}, status["StartTime"])
+	apiErr := schemas["httplistener.HTTPAPIError"].(map[string]interface{})
+	require.Equal(t, []interface{}{"Msg"}, apiErr["required"])
+
+	// every POST endpoint is served
+	for _, e := range endpoints {
+		if e.method != http.MethodPost {
+			continue
+		}
+		require.Contains(t, doc["paths"], "/"+e.verb)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/"+e.verb, strings.NewReader("jobID=x")))
+		require.NotContains(t, w.Body.String(), "unknown verb", e.verb)
+	}
+}
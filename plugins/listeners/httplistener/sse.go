@@ -0,0 +1,145 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package httplistener
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/jobmanager"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// sseHeartbeatInterval is the interval between two comments sent to keep
+// the status streams alive through proxies.
+var sseHeartbeatInterval = 30 * time.Second
+
+// JobStateUpdate is the data of the events of the /status/stream endpoint,
+// which are named after the state, e.g. JobStateCompleted.
+type JobStateUpdate struct {
+	JobID    types.JobID
+	State    string
+	EmitTime time.Time
+	// Error is set for failures
+	Error string `json:",omitempty"`
+}
+
+func isEventIn(name event.Name, names []event.Name) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// writeSSE writes a server-sent event, and flushes it.
+func writeSSE(w http.ResponseWriter, f http.Flusher, update JobStateUpdate) error {
+	data, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", update.State, data); err != nil {
+		return err
+	}
+	f.Flush()
+	return nil
+}
+
+// streamStatus sends the state transitions of a job, or of all the jobs if
+// no job ID is set, as server-sent events. The stream of a job starts with
+// its current state, and ends once the job completes. Only the transitions
+// of the jobs run by this server are sent. The stream is not bounded by the
+// write timeout, see withWriteTimeout.
+func (h *apiHandler) streamStatus(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		reply(w, http.StatusInternalServerError, "Stream failed: the connection cannot stream")
+		return
+	}
+	var (
+		jobID types.JobID
+		err   error
+	)
+	if jobIDStr := r.FormValue("jobID"); jobIDStr != "" {
+		if jobID, err = strToJobID(jobIDStr); err != nil {
+			reply(w, http.StatusBadRequest, fmt.Sprintf("Stream failed: %v", err))
+			return
+		}
+	}
+	// subscribe before fetching the current state, so that no transition is
+	// missed in between
+	sub := storage.Subscribe(jobID, 0)
+	defer sub.Close()
+	var current *JobStateUpdate
+	if jobID != 0 {
+		resp, err := h.api.Status(api.RequestorFromContext(r.Context(), r.FormValue("requestor")), jobID)
+		if err == nil {
+			err = resp.Err
+		}
+		if err != nil {
+			reply(w, http.StatusBadRequest, fmt.Sprintf("Stream failed: %v", err))
+			return
+		}
+		status := resp.Data.(api.ResponseDataStatus).Status
+		current = &JobStateUpdate{JobID: jobID, State: status.State, Error: status.StateErrMsg}
+		if status.EndTime != nil {
+			current.EmitTime = *status.EndTime
+		} else {
+			current.EmitTime = status.StartTime
+		}
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if current != nil {
+		if err := writeSSE(w, flusher, *current); err != nil || isEventIn(event.Name(current.State), jobmanager.JobCompletionEvents) {
+			return
+		}
+	}
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case n, ok := <-sub.Events:
+			if !ok {
+				// the client did not keep up, it can reconnect
+				return
+			}
+			ev := n.FrameworkEvent
+			if ev == nil || !isEventIn(ev.EventName, jobmanager.JobStateEvents) {
+				continue
+			}
+			update := JobStateUpdate{JobID: ev.JobID, State: string(ev.EventName), EmitTime: ev.EmitTime}
+			if ev.Payload != nil {
+				var payload jobmanager.ErrorEventPayload
+				if err := json.Unmarshal(*ev.Payload, &payload); err == nil {
+					update.Error = payload.Err
+				}
+			}
+			if err := writeSSE(w, flusher, update); err != nil {
+				return
+			}
+			if jobID != 0 && isEventIn(ev.EventName, jobmanager.JobCompletionEvents) {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package httplistener
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/api"
+	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/jobmanager"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/facebookincubator/contest/plugins/storage/memory"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readSSE reads the next server-sent event, skipping comments.
+func readSSE(t *testing.T, br *bufio.Reader) (string, JobStateUpdate) {
+	var (
+		name   string
+		update JobStateUpdate
+	)
+	for {
+		line, err := br.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, update
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &update))
+		}
+	}
+}
+
+func TestStreamStatus(t *testing.T) {
+	s, err := memory.New()
+	require.NoError(t, err)
+	storage.SetStorage(s)
+	defer storage.SetStorage(nil)
+
+	a, err := api.New(nil)
+	require.NoError(t, err)
+	go func() {
+		for ev := range a.Events {
+			ev.RespCh <- &api.EventResponse{
+				Requestor: ev.Msg.Requestor(),
+				Status:    &job.Status{State: string(jobmanager.EventJobStarted), StartTime: time.Now()},
+			}
+		}
+	}()
+	server := httptest.NewServer(&apiHandler{api: a, done: make(chan struct{})})
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/status/stream?jobID=1&requestor=test")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	br := bufio.NewReader(resp.Body)
+
+	// the current state comes first
+	name, update := readSSE(t, br)
+	require.Equal(t, "JobStateStarted", name)
+	require.Equal(t, types.JobID(1), update.JobID)
+
+	emitter := storage.NewFrameworkEventEmitter()
+	payload := json.RawMessage(`{"Err":"target manager failed"}`)
+	require.NoError(t, emitter.Emit(frameworkevent.Event{JobID: 2, EventName: jobmanager.EventJobCompleted, EmitTime: time.Now()}))
+	require.NoError(t, emitter.Emit(frameworkevent.Event{JobID: 1, EventName: "TargetAcquired", EmitTime: time.Now()}))
+	require.NoError(t, emitter.Emit(frameworkevent.Event{JobID: 1, EventName: jobmanager.EventJobFailed, EmitTime: time.Now(), Payload: &payload}))
+
+	name, update = readSSE(t, br)
+	require.Equal(t, "JobStateFailed", name)
+	require.Equal(t, "target manager failed", update.Error)
+
+	// the stream of a job ends when it completes
+	_, err = br.ReadString('\n')
+	require.Error(t, err)
+}
+
+func TestWriteTimeout(t *testing.T) {
+	prev := writeTimeout
+	writeTimeout = 50 * time.Millisecond
+	defer func() { writeTimeout = prev }()
+	server := httptest.NewServer(withWriteTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = w.Write([]byte("done"))
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	})))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/status")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	// streams and batches outlive the timeout
+	for _, path := range []string{"/status/stream", "/batch"} {
+		resp, err = http.Get(server.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode, path)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package httplistener
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/storage"
+)
+
+// wsPingInterval is the interval between two pings of the event streams.
+var wsPingInterval = 30 * time.Second
+
+// StreamedEvent is a message of the /events/stream WebSocket. Exactly one of
+// the events is set.
+type StreamedEvent struct {
+	TestEvent      *testevent.Event      `json:",omitempty"`
+	FrameworkEvent *frameworkevent.Event `json:",omitempty"`
+}
+
+// streamEvents pushes the test and framework events of a job to a WebSocket
+// client as they are stored, until the client or the server closes the
+// connection. Only the events emitted after the connection are pushed, past
+// ones can be fetched with the events verb.
+func (h *apiHandler) streamEvents(w http.ResponseWriter, r *http.Request) {
+	jobID, err := strToJobID(r.FormValue("jobID"))
+	if err != nil {
+		reply(w, http.StatusBadRequest, fmt.Sprintf("Stream failed: %v", err))
+		return
+	}
+	sub := storage.Subscribe(jobID, 0)
+	defer sub.Close()
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		reply(w, http.StatusBadRequest, fmt.Sprintf("Stream failed: %v", err))
+		return
+	}
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case n, ok := <-sub.Events:
+			if !ok {
+				ws.Close(wsClosePolicy, "client too slow, events were dropped")
+				return
+			}
+			msg, err := json.Marshal(StreamedEvent{TestEvent: n.TestEvent, FrameworkEvent: n.FrameworkEvent})
+			if err != nil {
+				log.Warningf("Cannot marshal event of job %d: %v", jobID, err)
+				continue
+			}
+			if err := ws.WriteText(msg); err != nil {
+				log.Debugf("Cannot write to WebSocket client: %v", err)
+				ws.conn.Close()
+				return
+			}
+		case <-ping.C:
+			if err := ws.Ping(); err != nil {
+				ws.conn.Close()
+				return
+			}
+		case <-ws.closed:
+			return
+		case <-h.done:
+			ws.Close(wsCloseGoingAway, "server shutting down")
+			return
+		}
+	}
+}
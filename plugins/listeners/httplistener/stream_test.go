@@ -0,0 +1,112 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package httplistener
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/facebookincubator/contest/plugins/storage/memory"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readServerFrame reads an unmasked frame sent by the server.
+func readServerFrame(t *testing.T, br *bufio.Reader) (byte, []byte) {
+	var header [2]byte
+	_, err := io.ReadFull(br, header[:])
+	require.NoError(t, err)
+	size := int(header[1] & 0x7f)
+	if size == 126 {
+		var ext [2]byte
+		_, err := io.ReadFull(br, ext[:])
+		require.NoError(t, err)
+		size = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, size)
+	_, err = io.ReadFull(br, payload)
+	require.NoError(t, err)
+	return header[0] & 0x0f, payload
+}
+
+// writeClientFrame writes a masked frame, as clients do.
+func writeClientFrame(t *testing.T, conn net.Conn, opcode byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	frame := append([]byte{0x80 | opcode, 0x80 | byte(len(payload))}, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := conn.Write(frame)
+	require.NoError(t, err)
+}
+
+func TestStreamEvents(t *testing.T) {
+	s, err := memory.New()
+	require.NoError(t, err)
+	storage.SetStorage(s)
+	defer storage.SetStorage(nil)
+
+	done := make(chan struct{})
+	server := httptest.NewServer(&apiHandler{done: done})
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events/stream?jobID=1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET /events/stream?jobID=1 HTTP/1.1\r\nHost: contest\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	require.NoError(t, err)
+	br := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(br, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	require.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+
+	// events of other jobs are not pushed
+	require.NoError(t, storage.NewFrameworkEventEmitter().Emit(frameworkevent.Event{JobID: 2, EventName: "JobStateStarted", EmitTime: time.Now()}))
+	require.NoError(t, storage.NewFrameworkEventEmitter().Emit(frameworkevent.Event{JobID: 1, EventName: "JobStateStarted", EmitTime: time.Now()}))
+	emitter := storage.NewTestEventEmitter(testevent.Header{JobID: 1, RunID: 1, TestName: "test", TestStepLabel: "step"})
+	require.NoError(t, emitter.Emit(testevent.Data{EventName: "TargetIn"}))
+
+	var ev StreamedEvent
+	opcode, payload := readServerFrame(t, br)
+	require.Equal(t, byte(wsOpText), opcode)
+	require.NoError(t, json.Unmarshal(payload, &ev))
+	require.Nil(t, ev.TestEvent)
+	require.Equal(t, types.JobID(1), ev.FrameworkEvent.JobID)
+	require.Equal(t, "JobStateStarted", string(ev.FrameworkEvent.EventName))
+
+	ev = StreamedEvent{}
+	_, payload = readServerFrame(t, br)
+	require.NoError(t, json.Unmarshal(payload, &ev))
+	require.Equal(t, "TargetIn", string(ev.TestEvent.Data.EventName))
+
+	writeClientFrame(t, conn, wsOpPing, []byte("ping"))
+	opcode, payload = readServerFrame(t, br)
+	require.Equal(t, byte(wsOpPong), opcode)
+	require.Equal(t, "ping", string(payload))
+
+	close(done)
+	opcode, payload = readServerFrame(t, br)
+	require.Equal(t, byte(wsOpClose), opcode)
+	require.Equal(t, uint16(wsCloseGoingAway), binary.BigEndian.Uint16(payload))
+}
@@ -0,0 +1,111 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package httplistener
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/api"
+
+	"github.com/stretchr/testify/require"
+)
+
+// issueCert returns a certificate with the given common name, signed by the
+// parent, or self-signed CA certificate if parent is nil.
+func issueCert(t *testing.T, cn string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, interface{}(key)
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func writePEM(t *testing.T, path string, cert tls.Certificate) (string, string) {
+	certFile, keyFile := path+".crt", path+".key"
+	require.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600))
+	der, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+	return certFile, keyFile
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := issueCert(t, "ca", nil)
+	caFile, _ := writePEM(t, filepath.Join(dir, "ca"), ca)
+	certFile, keyFile := writePEM(t, filepath.Join(dir, "server"), issueCert(t, "server", &ca))
+
+	l := HTTPListener{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}
+	config, err := l.tlsConfig()
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(api.AuthMiddleware(api.ClientCertAuthenticator{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(api.RequestorFromContext(r.Context(), r.FormValue("requestor"))))
+	})))
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	get := func(clientCerts ...tls.Certificate) (string, error) {
+		client := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: clientCerts}}}
+		resp, err := client.Get(server.URL + "/status?requestor=spoofed")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	requestor, err := get(issueCert(t, "alice", &ca))
+	require.NoError(t, err)
+	require.Equal(t, "alice", requestor)
+
+	// clients without a certificate, or with one from another CA, are rejected
+	_, err = get()
+	require.Error(t, err)
+	_, err = get(issueCert(t, "mallory", nil))
+	require.Error(t, err)
+
+	_, err = (&HTTPListener{ClientCAFile: caFile}).tlsConfig()
+	require.Error(t, err)
+	config, err = (&HTTPListener{}).tlsConfig()
+	require.NoError(t, err)
+	require.Nil(t, config)
+}
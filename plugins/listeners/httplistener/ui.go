@@ -0,0 +1,362 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package httplistener
+
+import (
+	"net/http"
+)
+
+// UIPath is the path of the web UI, a single page using the HTTP API to list
+// the jobs, follow their events and submit new ones.
+const UIPath = "ui"
+
+func replyUI(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// the page only talks to the API it is served by
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self' ws: wss:")
+	reply(w, http.StatusOK, uiPage)
+}
+
+// uiPage is written without a build step nor dependencies, so that it can be
+// served from the binary.
+const uiPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>ConTest</title>
+<style>
+body { font-family: sans-serif; margin: 0; color: #222; }
+header { background: #2b4c7e; color: #fff; padding: 8px 16px; display: flex; gap: 16px; align-items: center; }
+header a { color: #fff; cursor: pointer; text-decoration: underline; }
+header input { width: 10em; }
+main { padding: 16px; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #ddd; font-size: 14px; vertical-align: top; }
+tr.job:hover { background: #eef; cursor: pointer; }
+textarea { width: 100%; font-family: monospace; }
+fieldset { margin-bottom: 12px; }
+label { display: block; margin: 4px 0; }
+pre { background: #f4f4f4; padding: 8px; overflow: auto; max-height: 40em; }
+.error { color: #b00; }
+.JobStateCompleted { color: #070; }
+.JobStateFailed, .JobStateCancelled, .JobStateCancellationFailed { color: #b00; }
+.hidden { display: none; }
+</style>
+</head>
+<body>
+<header>
+<strong>ConTest</strong>
+<a id="nav-jobs">Jobs</a>
+<a id="nav-submit">Submit</a>
+<span style="flex: 1"></span>
+<label>Requestor <input id="requestor"></label>
+</header>
+<main>
+<p id="error" class="error"></p>
+
+<section id="jobs">
+<form id="filter">
+<input id="filter-name" placeholder="Name contains">
+<input id="filter-tag" placeholder="Tag">
+<select id="filter-state"><option value="">Any state</option></select>
+<button>Filter</button>
+<button type="button" id="prev">&lt;</button>
+<button type="button" id="next">&gt;</button>
+</form>
+<table>
+<thead><tr><th>ID</th><th>Name</th><th>Tags</th><th>State</th><th>Started</th><th>Ended</th></tr></thead>
+<tbody id="job-rows"></tbody>
+</table>
+</section>
+
+<section id="job" class="hidden">
+<h2 id="job-title"></h2>
+<p>State: <span id="job-state"></span> <span id="job-live"></span></p>
+<button id="job-stop">Stop</button>
+<button id="job-pause">Pause</button>
+<button id="job-resume">Resume</button>
+<button id="job-approve">Approve</button>
+<button id="job-reject">Reject</button>
+<button id="job-rerun">Rerun</button>
+<button id="job-rerun-failed">Rerun failed targets</button>
+<h3>Events</h3>
+<table>
+<thead><tr><th>Time</th><th>Event</th><th>Test</th><th>Step</th><th>Target</th><th>Payload</th></tr></thead>
+<tbody id="event-rows"></tbody>
+</table>
+<h3>Report</h3>
+<pre id="job-report"></pre>
+</section>
+
+<section id="submit" class="hidden">
+<form id="submit-form">
+<fieldset><legend>Job</legend>
+<label>Name <input id="s-name" required></label>
+<label>Runs <input id="s-runs" type="number" min="0" value="1"></label>
+<label>Tags <input id="s-tags" placeholder="comma separated"></label>
+</fieldset>
+<fieldset><legend>Targets</legend>
+<label>Target manager <select id="s-tm"></select></label>
+<label>Acquire parameters <textarea id="s-tm-acquire" rows="4">{}</textarea></label>
+<label>Release parameters <textarea id="s-tm-release" rows="2">{}</textarea></label>
+</fieldset>
+<fieldset><legend>Test</legend>
+<label>Test fetcher <select id="s-tf"></select></label>
+<div id="s-literal">
+<label>Test name <input id="s-test-name"></label>
+<table><thead><tr><th>Step</th><th>Label</th><th>Parameters</th><th></th></tr></thead><tbody id="s-steps"></tbody></table>
+<button type="button" id="s-add-step">Add step</button>
+</div>
+<label id="s-fetch-label">Fetch parameters <textarea id="s-fetch" rows="6">{}</textarea></label>
+</fieldset>
+<fieldset><legend>Reporting</legend>
+<label>Run reporter <select id="s-run-reporter"></select></label>
+<label>Final reporter <select id="s-final-reporter"></select></label>
+</fieldset>
+<button type="button" id="s-preview">Preview</button>
+<button type="button" id="s-validate">Validate</button>
+<button>Start</button>
+</form>
+<h3>Descriptor</h3>
+<textarea id="s-descriptor" rows="16"></textarea>
+<pre id="s-result"></pre>
+</section>
+</main>
+
+<script>
+"use strict";
+var $ = function (id) { return document.getElementById(id); };
+var pageSize = 50, offset = 0, plugins = null, stream = null;
+var jobStates = ["JobStateAwaitingApproval", "JobStateScheduled", "JobStateWaiting", "JobStateQueued", "JobStateStarted", "JobStateCompleted", "JobStateFailed", "JobStatePausing", "JobStatePaused",
+  "JobStateCancelling", "JobStateCancelled", "JobStateCancellationFailed"];
+
+$("requestor").value = localStorage.getItem("contest-requestor") || "webui";
+$("requestor").onchange = function () { localStorage.setItem("contest-requestor", this.value); };
+
+function showError(err) { $("error").textContent = err ? String(err) : ""; }
+
+// call posts a request to the API, and resolves with the data of the response
+function call(verb, params) {
+  var body = new URLSearchParams();
+  body.append("requestor", $("requestor").value);
+  Object.keys(params || {}).forEach(function (k) {
+    [].concat(params[k]).forEach(function (v) { if (v !== "" && v !== undefined) body.append(k, v); });
+  });
+  return fetch(verb, { method: "POST", body: body, credentials: "same-origin" })
+    .then(function (r) { return r.text().then(function (t) { return { status: r.status, text: t }; }); })
+    .then(function (r) {
+      var resp;
+      try { resp = JSON.parse(r.text); } catch (e) { throw new Error(r.text || ("HTTP " + r.status)); }
+      if (r.status !== 200) throw new Error(resp.Msg || r.text);
+      if (resp.Error) throw new Error(resp.Error);
+      return resp.Data;
+    });
+}
+
+function cell(tr, text, cls) {
+  var td = document.createElement("td");
+  td.textContent = text === undefined || text === null ? "" : text;
+  if (cls) td.className = cls;
+  tr.appendChild(td);
+  return td;
+}
+
+function time(t) { return t && t.indexOf("0001-") !== 0 ? new Date(t).toLocaleString() : ""; }
+
+function show(section) {
+  ["jobs", "job", "submit"].forEach(function (s) { $(s).classList.toggle("hidden", s !== section); });
+  if (stream && section !== "job") { stream.close(); stream = null; }
+  showError();
+}
+
+function listJobs() {
+  show("jobs");
+  call("list", { name: $("filter-name").value, tag: $("filter-tag").value, state: $("filter-state").value,
+    limit: pageSize, offset: offset }).then(function (data) {
+    var rows = $("job-rows");
+    rows.textContent = "";
+    (data.JobIDs || []).forEach(function (id) {
+      var tr = document.createElement("tr");
+      tr.className = "job";
+      tr.onclick = function () { openJob(id); };
+      cell(tr, id);
+      var name = cell(tr, ""), tags = cell(tr, ""), state = cell(tr, ""), start = cell(tr, ""), end = cell(tr, "");
+      rows.appendChild(tr);
+      call("status", { jobID: id }).then(function (d) {
+        name.textContent = d.Status.Name;
+        tags.textContent = (d.Status.Tags || []).join(", ");
+        state.textContent = d.Status.State;
+        state.className = d.Status.State;
+        start.textContent = time(d.Status.StartTime);
+        end.textContent = time(d.Status.EndTime);
+      }).catch(function () {});
+    });
+  }).catch(showError);
+}
+
+function addEvent(ev) {
+  var tr = document.createElement("tr");
+  if (ev.FrameworkEvent) {
+    var f = ev.FrameworkEvent;
+    cell(tr, time(f.EmitTime)); cell(tr, f.EventName); cell(tr, ""); cell(tr, ""); cell(tr, "");
+    cell(tr, f.Payload ? JSON.stringify(f.Payload) : "");
+    if (jobStates.indexOf(f.EventName) >= 0) { $("job-state").textContent = f.EventName; $("job-state").className = f.EventName; }
+  } else {
+    var t = ev.TestEvent || ev, h = t.Header || {}, d = t.Data || {};
+    cell(tr, time(t.EmitTime)); cell(tr, d.EventName); cell(tr, h.TestName); cell(tr, h.TestStepLabel);
+    cell(tr, d.Target ? d.Target.ID : ""); cell(tr, d.Payload ? JSON.stringify(d.Payload) : "");
+  }
+  $("event-rows").appendChild(tr);
+}
+
+function openJob(id) {
+  show("job");
+  $("job-title").textContent = "Job " + id;
+  $("event-rows").textContent = "";
+  $("job-report").textContent = "";
+  $("job-stop").onclick = function () { call("stop", { jobID: id }).then(function () { openJob(id); }).catch(showError); };
+  $("job-pause").onclick = function () { call("pause", { jobID: id }).then(function () { openJob(id); }).catch(showError); };
+  $("job-resume").onclick = function () { call("resume", { jobID: id }).then(function () { openJob(id); }).catch(showError); };
+  $("job-approve").onclick = function () { call("approve", { jobID: id }).then(function () { openJob(id); }).catch(showError); };
+  $("job-reject").onclick = function () {
+    var reason = prompt("Reason of the rejection");
+    if (reason !== null) call("reject", { jobID: id, reason: reason }).then(function () { openJob(id); }).catch(showError);
+  };
+  $("job-rerun").onclick = function () { call("rerun", { jobID: id }).then(function (d) { openJob(d.NewJobID); }).catch(showError); };
+  $("job-rerun-failed").onclick = function () { call("rerun", { jobID: id, failedTargetsOnly: true }).then(function (d) { openJob(d.NewJobID); }).catch(showError); };
+  call("status", { jobID: id }).then(function (d) {
+    $("job-title").textContent = "Job " + id + ": " + d.Status.Name;
+    $("job-state").textContent = d.Status.State;
+    $("job-state").className = d.Status.State;
+    if (d.Status.JobReport) $("job-report").textContent = JSON.stringify(d.Status.JobReport, null, 2);
+  }).catch(showError);
+  // the past events are fetched, then the new ones are streamed
+  call("events", { jobID: id, limit: 1000 }).then(function (d) {
+    (d.Events || []).forEach(addEvent);
+  }).catch(showError);
+  var url = (location.protocol === "https:" ? "wss://" : "ws://") + location.host +
+    location.pathname.replace(/ui$/, "") + "events/stream?jobID=" + id;
+  stream = new WebSocket(url);
+  stream.onopen = function () { $("job-live").textContent = "(live)"; };
+  stream.onclose = function () { $("job-live").textContent = ""; };
+  stream.onmessage = function (m) { addEvent(JSON.parse(m.data)); };
+}
+
+function options(select, descs, empty) {
+  select.textContent = "";
+  if (empty) select.appendChild(new Option(empty, ""));
+  (descs || []).forEach(function (p) { select.appendChild(new Option(p.Name, p.Name)); });
+}
+
+function addStep() {
+  var tr = document.createElement("tr");
+  var name = document.createElement("select");
+  options(name, plugins.TestSteps);
+  var label = document.createElement("input");
+  label.value = "step" + ($("s-steps").children.length + 1);
+  var params = document.createElement("textarea");
+  params.rows = 2;
+  params.value = "{}";
+  var remove = document.createElement("button");
+  remove.type = "button";
+  remove.textContent = "Remove";
+  remove.onclick = function () { tr.remove(); };
+  [name, label, params, remove].forEach(function (e) { var td = document.createElement("td"); td.appendChild(e); tr.appendChild(td); });
+  $("s-steps").appendChild(tr);
+}
+
+function isLiteral() { return $("s-tf").value === "literal"; }
+
+function parse(id) {
+  try { return JSON.parse($(id).value || "{}"); } catch (e) { throw new Error(id + ": " + e.message); }
+}
+
+function descriptor() {
+  var fetch;
+  if (isLiteral()) {
+    fetch = { TestName: $("s-test-name").value || $("s-name").value, Steps: [] };
+    Array.prototype.forEach.call($("s-steps").children, function (tr) {
+      var f = tr.querySelectorAll("select, input, textarea"), params;
+      try { params = JSON.parse(f[2].value || "{}"); } catch (e) { throw new Error("step " + f[1].value + ": " + e.message); }
+      fetch.Steps.push({ name: f[0].value, label: f[1].value, parameters: params });
+    });
+  } else {
+    fetch = parse("s-fetch");
+  }
+  var reporter = function (id) { return $(id).value ? [{ Name: $(id).value, Parameters: {} }] : []; };
+  return {
+    JobName: $("s-name").value,
+    Runs: Number($("s-runs").value),
+    Tags: $("s-tags").value.split(",").map(function (s) { return s.trim(); }).filter(Boolean),
+    TestDescriptors: [{
+      TargetManagerName: $("s-tm").value,
+      TargetManagerAcquireParameters: parse("s-tm-acquire"),
+      TargetManagerReleaseParameters: parse("s-tm-release"),
+      TestFetcherName: $("s-tf").value,
+      TestFetcherFetchParameters: fetch
+    }],
+    Reporting: { RunReporters: reporter("s-run-reporter"), FinalReporters: reporter("s-final-reporter") }
+  };
+}
+
+// jobDesc returns the descriptor to submit: the edited one if any
+function jobDesc() {
+  if (!$("s-descriptor").value) preview();
+  return $("s-descriptor").value;
+}
+
+function preview() {
+  try { $("s-descriptor").value = JSON.stringify(descriptor(), null, 2); } catch (e) { showError(e); }
+}
+
+function openSubmit() {
+  show("submit");
+  if (plugins) return;
+  call("plugins").then(function (p) {
+    plugins = p;
+    options($("s-tm"), p.TargetManagers);
+    options($("s-tf"), p.TestFetchers);
+    options($("s-run-reporter"), p.Reporters, "None");
+    options($("s-final-reporter"), p.Reporters, "None");
+    // jobs need a reporter
+    if ((p.Reporters || []).length) $("s-run-reporter").value = p.Reporters[0].Name;
+    if ((p.TestFetchers || []).some(function (f) { return f.Name === "literal"; })) $("s-tf").value = "literal";
+    $("s-tf").onchange();
+    addStep();
+  }).catch(showError);
+}
+
+$("s-tf").onchange = function () {
+  $("s-literal").classList.toggle("hidden", !isLiteral());
+  $("s-fetch-label").classList.toggle("hidden", isLiteral());
+};
+$("submit-form").oninput = function (e) { if (e.target.id !== "s-descriptor") $("s-descriptor").value = ""; };
+$("s-add-step").onclick = addStep;
+$("s-preview").onclick = preview;
+$("s-validate").onclick = function () {
+  showError();
+  call("validate", { jobDesc: jobDesc() }).then(function (d) {
+    $("s-result").textContent = JSON.stringify(d, null, 2);
+  }).catch(showError);
+};
+$("submit-form").onsubmit = function (e) {
+  e.preventDefault();
+  showError();
+  call("start", { jobDesc: jobDesc() }).then(function (d) { openJob(d.JobID); }).catch(showError);
+};
+
+jobStates.forEach(function (s) { $("filter-state").appendChild(new Option(s, s)); });
+$("filter").onsubmit = function (e) { e.preventDefault(); offset = 0; listJobs(); };
+$("prev").onclick = function () { offset = Math.max(0, offset - pageSize); listJobs(); };
+$("next").onclick = function () { offset += pageSize; listJobs(); };
+$("nav-jobs").onclick = listJobs;
+$("nav-submit").onclick = openSubmit;
+listJobs();
+</script>
+</body>
+</html>
+`
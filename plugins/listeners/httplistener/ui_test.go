@@ -0,0 +1,40 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package httplistener
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUI(t *testing.T) {
+	h := &apiHandler{}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	require.Equal(t, "/"+UIPath, w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+UIPath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Header().Get("Content-Type"), "text/html")
+
+	// the page only calls the verbs of the API
+	verbs := make(map[string]bool)
+	for _, e := range endpoints {
+		verbs[e.verb] = true
+	}
+	calls := regexp.MustCompile(`call\("([a-z/]+)"`).FindAllStringSubmatch(uiPage, -1)
+	require.NotEmpty(t, calls)
+	for _, c := range calls {
+		require.True(t, verbs[c[1]], c[1])
+	}
+}
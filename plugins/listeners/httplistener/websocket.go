@@ -0,0 +1,229 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package httplistener
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This file implements the server side of the WebSocket protocol (RFC 6455)
+// needed to push events to the clients: text and control frames, without
+// extensions nor fragmented messages.
+
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xa
+
+	// wsGUID is appended to the key of the client to compute the accept
+	// header of the handshake
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// wsMaxControlPayload is the maximum size of the payload of control
+	// frames, the only ones clients are expected to send.
+	wsMaxControlPayload = 125
+
+	// close status codes
+	wsCloseNormal      = 1000
+	wsCloseGoingAway   = 1001
+	wsClosePolicy      = 1008
+	wsCloseTooBig      = 1009
+	wsCloseUnsupported = 1003
+)
+
+// wsConn is a server WebSocket connection. Frames can be written
+// concurrently.
+type wsConn struct {
+	conn      net.Conn
+	br        *bufio.Reader
+	writeLock sync.Mutex
+	// closed is closed when the client closes the connection or goes away
+	closed chan struct{}
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeWebSocket performs the opening handshake of a WebSocket connection,
+// and takes over the connection of the request. The read and write timeouts
+// of the server do not apply to the connection.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if r.Method != http.MethodGet {
+		return nil, errors.New("WebSocket connections must use GET")
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, errors.New("not a WebSocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, fmt.Errorf("unsupported WebSocket version '%s'", r.Header.Get("Sec-WebSocket-Version"))
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, errors.New("missing WebSocket key")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("connection does not support WebSocket")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("cannot take over connection: %v", err)
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	accept := sha1.Sum([]byte(key + wsGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(accept[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	ws := &wsConn{conn: conn, br: rw.Reader, closed: make(chan struct{})}
+	go ws.readLoop()
+	return ws, nil
+}
+
+// writeFrame writes an unfragmented frame. Server frames are not masked.
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xffff:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(payload)))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(payload)))
+	}
+	ws.writeLock.Lock()
+	defer ws.writeLock.Unlock()
+	if err := ws.conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		return err
+	}
+	_, err := ws.conn.Write(append(header, payload...))
+	return err
+}
+
+// WriteText sends a text message.
+func (ws *wsConn) WriteText(msg []byte) error {
+	return ws.writeFrame(wsOpText, msg)
+}
+
+// Ping sends a ping, so that clients which went away are detected.
+func (ws *wsConn) Ping() error {
+	return ws.writeFrame(wsOpPing, nil)
+}
+
+// Close sends a close frame with the given status, and closes the connection.
+func (ws *wsConn) Close(code int, reason string) {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	if len(reason) > wsMaxControlPayload-2 {
+		reason = reason[:wsMaxControlPayload-2]
+	}
+	if err := ws.writeFrame(wsOpClose, append(payload, reason...)); err != nil {
+		log.Debugf("Cannot send WebSocket close frame: %v", err)
+	}
+	ws.conn.Close()
+}
+
+// readFrame reads a frame sent by the client, and returns its opcode and
+// unmasked payload.
+func (ws *wsConn) readFrame() (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.br, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0f
+	if header[1]&0x80 == 0 {
+		return opcode, nil, errors.New("client frames must be masked")
+	}
+	size := uint64(header[1] & 0x7f)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.br, ext[:]); err != nil {
+			return opcode, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.br, ext[:]); err != nil {
+			return opcode, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if size > wsMaxControlPayload {
+		return opcode, nil, errFrameTooBig
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.br, mask[:]); err != nil {
+		return opcode, nil, err
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(ws.br, payload); err != nil {
+		return opcode, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+var errFrameTooBig = errors.New("frame too big")
+
+// readLoop answers the control frames of the client until it closes the
+// connection. The stream is one-way, so data frames are rejected.
+func (ws *wsConn) readLoop() {
+	defer close(ws.closed)
+	for {
+		opcode, payload, err := ws.readFrame()
+		switch {
+		case errors.Is(err, errFrameTooBig):
+			ws.Close(wsCloseTooBig, "messages are not accepted")
+			return
+		case err != nil:
+			ws.conn.Close()
+			return
+		}
+		switch opcode {
+		case wsOpPing:
+			if err := ws.writeFrame(wsOpPong, payload); err != nil {
+				ws.conn.Close()
+				return
+			}
+		case wsOpPong:
+		case wsOpClose:
+			ws.Close(wsCloseNormal, "")
+			return
+		default:
+			ws.Close(wsCloseUnsupported, "messages are not accepted")
+			return
+		}
+	}
+}
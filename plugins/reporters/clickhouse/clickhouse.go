@@ -0,0 +1,285 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package clickhouse implements a run reporter which streams the result of
+// each target in each step into a ClickHouse table, through the HTTP
+// interface of ClickHouse, enabling long-term trend analysis across jobs.
+// The table is expected to exist, see the Schema constant.
+package clickhouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/insomniacslk/xjson"
+)
+
+// Name defines the name of the reporter used within the plugin registry
+var (
+	Name = "ClickHouse"
+	log  = logging.GetLogger("reporters/" + strings.ToLower(Name))
+)
+
+// Schema is the schema of the table the rows are inserted into, where %s is
+// the table name.
+const Schema = `CREATE TABLE %s (
+	job_id UInt64,
+	run_id UInt64,
+	test_name String,
+	test_step_label String,
+	target_id String,
+	target_name String,
+	in_time DateTime64(3),
+	out_time Nullable(DateTime64(3)),
+	duration_ms Nullable(UInt64),
+	outcome LowCardinality(String),
+	error String,
+	attempts UInt32
+) ENGINE = MergeTree ORDER BY (job_id, run_id, test_name, test_step_label, target_id)`
+
+const (
+	defaultTable     = "contest_results"
+	defaultBatchSize = 1000
+	defaultTimeout   = 30 * time.Second
+	timeFormat       = "2006-01-02 15:04:05.000"
+)
+
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// RunParameters contains the parameters of the run reporter.
+type RunParameters struct {
+	// URL is the URL of the HTTP interface of ClickHouse, e.g.
+	// http://clickhouse:8123
+	URL string
+	// Database and Table identify the table. If empty, the default database
+	// of the user and the "contest_results" table are used.
+	Database string
+	Table    string
+	// Username and PasswordFile are the credentials of the ClickHouse user.
+	// The file contains the password, so that it does not end up in the
+	// job descriptor.
+	Username     string
+	PasswordFile string
+	// BatchSize is the maximum number of rows inserted per request. If zero,
+	// 1000 rows are inserted at a time.
+	BatchSize int
+	// Timeout is the maximum time of each request. If zero, 30 seconds are
+	// allowed.
+	Timeout xjson.Duration
+}
+
+// Row is a row of the table, encoded in the JSONEachRow format.
+type Row struct {
+	JobID         uint64  `json:"job_id"`
+	RunID         uint64  `json:"run_id"`
+	TestName      string  `json:"test_name"`
+	TestStepLabel string  `json:"test_step_label"`
+	TargetID      string  `json:"target_id"`
+	TargetName    string  `json:"target_name"`
+	InTime        string  `json:"in_time"`
+	OutTime       *string `json:"out_time"`
+	DurationMs    *uint64 `json:"duration_ms"`
+	Outcome       string  `json:"outcome"`
+	Error         string  `json:"error"`
+	Attempts      int     `json:"attempts"`
+}
+
+// ClickHouseReporter implements a run reporter which inserts the results of
+// the runs in ClickHouse. The report is successful if no target failed.
+type ClickHouseReporter struct {
+}
+
+// ValidateRunParameters validates the parameters for the run reporter
+func (r *ClickHouseReporter) ValidateRunParameters(params []byte) (interface{}, error) {
+	var rp RunParameters
+	if err := json.Unmarshal(params, &rp); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rp.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ClickHouse URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("ClickHouse URL must be http or https, got '%s'", rp.URL)
+	}
+	if rp.Table == "" {
+		rp.Table = defaultTable
+	}
+	if !identifierRegexp.MatchString(rp.Table) {
+		return nil, fmt.Errorf("invalid table name '%s'", rp.Table)
+	}
+	if rp.Database != "" && !identifierRegexp.MatchString(rp.Database) {
+		return nil, fmt.Errorf("invalid database name '%s'", rp.Database)
+	}
+	if rp.PasswordFile != "" && rp.Username == "" {
+		return nil, fmt.Errorf("a username is required when a password file is specified")
+	}
+	if rp.BatchSize < 0 {
+		return nil, fmt.Errorf("batch size cannot be negative")
+	}
+	if rp.BatchSize == 0 {
+		rp.BatchSize = defaultBatchSize
+	}
+	if rp.Timeout < 0 {
+		return nil, fmt.Errorf("timeout cannot be negative")
+	}
+	return rp, nil
+}
+
+// ValidateFinalParameters validates the parameters for the final reporter
+func (r *ClickHouseReporter) ValidateFinalParameters(params []byte) (interface{}, error) {
+	return nil, fmt.Errorf("the %s reporter can only be used as a run reporter", Name)
+}
+
+// Name returns the Name of the reporter
+func (r *ClickHouseReporter) Name() string {
+	return Name
+}
+
+// buildRows returns a row for each target in each step of the run.
+func buildRows(runStatus *job.RunStatus) ([]Row, bool) {
+	var (
+		rows    []Row
+		success = true
+	)
+	for _, testStatus := range runStatus.TestStatuses {
+		for _, stepStatus := range testStatus.TestStepStatuses {
+			for _, ts := range stepStatus.TargetStatuses {
+				if ts.Target == nil || ts.InTime.IsZero() {
+					continue
+				}
+				row := Row{
+					JobID:         uint64(runStatus.JobID),
+					RunID:         uint64(runStatus.RunID),
+					TestName:      testStatus.TestName,
+					TestStepLabel: stepStatus.TestStepLabel,
+					TargetID:      ts.Target.ID,
+					TargetName:    ts.Target.Name,
+					InTime:        ts.InTime.UTC().Format(timeFormat),
+					Error:         ts.Error,
+					Attempts:      ts.Attempts,
+				}
+				switch {
+				case ts.Skipped:
+					row.Outcome = "skip"
+					row.Error = ts.SkipReason
+				case ts.Error != "":
+					row.Outcome = "fail"
+					success = false
+				case ts.OutTime.IsZero():
+					row.Outcome = "running"
+				default:
+					row.Outcome = "pass"
+				}
+				if !ts.OutTime.IsZero() {
+					outTime := ts.OutTime.UTC().Format(timeFormat)
+					duration := uint64(ts.OutTime.Sub(ts.InTime) / time.Millisecond)
+					row.OutTime, row.DurationMs = &outTime, &duration
+				}
+				rows = append(rows, row)
+			}
+		}
+	}
+	return rows, success
+}
+
+// insert inserts a batch of rows.
+func insert(client *http.Client, rp RunParameters, password string, rows []Row) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return fmt.Errorf("cannot encode row: %v", err)
+		}
+	}
+	table := rp.Table
+	if rp.Database != "" {
+		table = rp.Database + "." + rp.Table
+	}
+	q := url.Values{}
+	q.Set("query", fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", table))
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(rp.URL, "/")+"/?"+q.Encode(), &body)
+	if err != nil {
+		return fmt.Errorf("cannot create request: %v", err)
+	}
+	if rp.Username != "" {
+		req.Header.Set("X-ClickHouse-User", rp.Username)
+		req.Header.Set("X-ClickHouse-Key", password)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot insert rows: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("ClickHouse returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// RunReport inserts the results of a run, in batches.
+func (r *ClickHouseReporter) RunReport(cancel <-chan struct{}, parameters interface{}, runStatus *job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
+	rp, ok := parameters.(RunParameters)
+	if !ok {
+		return false, nil, fmt.Errorf("report parameters should be of type clickhouse.RunParameters")
+	}
+	rows, success := buildRows(runStatus)
+
+	var password string
+	if rp.PasswordFile != "" {
+		buf, err := ioutil.ReadFile(rp.PasswordFile)
+		if err != nil {
+			return success, nil, fmt.Errorf("cannot read password file: %v", err)
+		}
+		password = strings.TrimSpace(string(buf))
+	}
+	timeout := time.Duration(rp.Timeout)
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	for start := 0; start < len(rows); start += rp.BatchSize {
+		select {
+		case <-cancel:
+			return success, nil, fmt.Errorf("cancelled after inserting %d rows out of %d", start, len(rows))
+		default:
+		}
+		end := start + rp.BatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		if err := insert(client, rp, password, rows[start:end]); err != nil {
+			return success, nil, fmt.Errorf("inserted %d rows out of %d: %v", start, len(rows), err)
+		}
+	}
+	log.Debugf("Inserted %d rows for run %d of job %d", len(rows), runStatus.RunID, runStatus.JobID)
+	return success, fmt.Sprintf("Inserted %d rows into %s", len(rows), rp.Table), nil
+}
+
+// FinalReport is not supported, see ValidateFinalParameters.
+func (r *ClickHouseReporter) FinalReport(cancel <-chan struct{}, parameters interface{}, runStatuses []job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
+	return false, nil, fmt.Errorf("the %s reporter can only be used as a run reporter", Name)
+}
+
+// New builds a new ClickHouseReporter
+func New() job.Reporter {
+	return &ClickHouseReporter{}
+}
+
+// Load returns the name and factory which are needed to register the Reporter
+func Load() (string, job.ReporterFactory) {
+	return Name, New
+}
@@ -0,0 +1,102 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package clickhouse
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunReport(t *testing.T) {
+	type request struct {
+		query, user, key string
+		rows             []Row
+	}
+	var requests []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{
+			query: r.URL.Query().Get("query"),
+			user:  r.Header.Get("X-ClickHouse-User"),
+			key:   r.Header.Get("X-ClickHouse-Key"),
+		}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var row Row
+			if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.rows = append(req.rows, row)
+		}
+		requests = append(requests, req)
+	}))
+	defer srv.Close()
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, ioutil.WriteFile(passwordFile, []byte("s3cret\n"), 0600))
+
+	r := New()
+	for _, params := range []string{
+		`{"URL": "clickhouse:8123"}`,
+		`{"URL": "http://clickhouse:8123", "Table": "results; DROP TABLE x"}`,
+		`{"URL": "http://clickhouse:8123", "PasswordFile": "/tmp/x"}`,
+	} {
+		_, err := r.ValidateRunParameters([]byte(params))
+		require.Error(t, err, params)
+	}
+	params, err := r.ValidateRunParameters([]byte(`{"URL": "` + srv.URL + `", "Database": "qa", "Username": "contest", "PasswordFile": "` + passwordFile + `", "BatchSize": 2}`))
+	require.NoError(t, err)
+
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	t1, t2, t3 := &target.Target{ID: "1", Name: "host1"}, &target.Target{ID: "2"}, &target.Target{ID: "3"}
+	runStatus := job.RunStatus{
+		RunCoordinates: job.RunCoordinates{JobID: 5, RunID: 1},
+		TestStatuses: []job.TestStatus{{
+			TestCoordinates: job.TestCoordinates{TestName: "boot"},
+			TestStepStatuses: []job.TestStepStatus{{
+				TestStepCoordinates: job.TestStepCoordinates{TestStepLabel: "power"},
+				TargetStatuses: []job.TargetStatus{
+					{Target: t1, InTime: start, OutTime: start.Add(1500 * time.Millisecond)},
+					{Target: t2, InTime: start, OutTime: start.Add(time.Second), Error: "no power"},
+					{Target: t3, InTime: start},
+				},
+			}},
+		}},
+	}
+	success, _, err := r.RunReport(nil, params, &runStatus, nil)
+	require.NoError(t, err)
+	require.False(t, success)
+
+	require.Len(t, requests, 2)
+	require.Equal(t, "INSERT INTO qa.contest_results FORMAT JSONEachRow", requests[0].query)
+	require.Equal(t, "contest", requests[0].user)
+	require.Equal(t, "s3cret", requests[0].key)
+	require.Len(t, requests[0].rows, 2)
+	require.Len(t, requests[1].rows, 1)
+
+	row := requests[0].rows[0]
+	require.Equal(t, uint64(5), row.JobID)
+	require.Equal(t, "power", row.TestStepLabel)
+	require.Equal(t, "host1", row.TargetName)
+	require.Equal(t, "2020-01-02 03:04:05.000", row.InTime)
+	require.Equal(t, "2020-01-02 03:04:06.500", *row.OutTime)
+	require.Equal(t, uint64(1500), *row.DurationMs)
+	require.Equal(t, "pass", row.Outcome)
+	require.Equal(t, "fail", requests[0].rows[1].Outcome)
+	require.Equal(t, "no power", requests[0].rows[1].Error)
+	require.Equal(t, "running", requests[1].rows[0].Outcome)
+	require.Nil(t, requests[1].rows[0].OutTime)
+}
@@ -0,0 +1,192 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package composite implements a reporter which wraps several child
+// reporters, runs them all, and combines their verdicts, so that a job does
+// not have to pick a single perspective on success.
+package composite
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/pluginregistry"
+)
+
+// Name defines the name of the reporter used within the plugin registry
+var (
+	Name = "Composite"
+	log  = logging.GetLogger("reporters/" + strings.ToLower(Name))
+)
+
+// registry is used to instantiate the child reporters.
+var registry *pluginregistry.PluginRegistry
+
+// SetPluginRegistry sets the plugin registry used to look up the child
+// reporters. It must be called before any parameters are validated.
+func SetPluginRegistry(pr *pluginregistry.PluginRegistry) {
+	registry = pr
+}
+
+// Ways of combining the verdicts of the child reporters
+const (
+	// VerdictAll requires all the child reporters to be successful
+	VerdictAll = "all"
+	// VerdictAny requires at least one child reporter to be successful
+	VerdictAny = "any"
+	// VerdictMajority requires more than half of the child reporters to be
+	// successful
+	VerdictMajority = "majority"
+)
+
+// ChildReporter is a child reporter and its parameters, as in the job
+// descriptor.
+type ChildReporter struct {
+	Name       string
+	Parameters json.RawMessage
+}
+
+// Parameters contains the parameters of both the run and the final reporter.
+type Parameters struct {
+	Reporters []ChildReporter
+	// Verdict is how the verdicts of the child reporters are combined, one
+	// of "all" (the default), "any" and "majority".
+	Verdict string
+}
+
+type config struct {
+	verdict string
+	bundles []*job.ReporterBundle
+}
+
+// Section is the report of a child reporter. A child reporter which failed
+// to report is considered unsuccessful, and Error explains why.
+type Section struct {
+	ReporterName string
+	Success      bool
+	Data         interface{}
+	Error        string `json:",omitempty"`
+}
+
+// Report is the data of the composite report.
+type Report struct {
+	Verdict  string
+	Sections []Section
+}
+
+// CompositeReporter implements a reporter which combines the reports of
+// several child reporters.
+type CompositeReporter struct {
+}
+
+func validateParameters(params []byte, newBundle func(name string, params []byte) (*job.ReporterBundle, error)) (interface{}, error) {
+	if registry == nil {
+		return nil, fmt.Errorf("plugin registry not set for the %s reporter", Name)
+	}
+	var p Parameters
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	cfg := config{verdict: strings.ToLower(p.Verdict)}
+	switch cfg.verdict {
+	case "":
+		cfg.verdict = VerdictAll
+	case VerdictAll, VerdictAny, VerdictMajority:
+	default:
+		return nil, fmt.Errorf("unknown verdict '%s'", p.Verdict)
+	}
+	if len(p.Reporters) == 0 {
+		return nil, fmt.Errorf("no child reporters specified")
+	}
+	for idx, child := range p.Reporters {
+		bundle, err := newBundle(child.Name, child.Parameters)
+		if err != nil {
+			return nil, fmt.Errorf("invalid child reporter #%d: %v", idx, err)
+		}
+		cfg.bundles = append(cfg.bundles, bundle)
+	}
+	return cfg, nil
+}
+
+// ValidateRunParameters validates the parameters for the run reporter
+func (r *CompositeReporter) ValidateRunParameters(params []byte) (interface{}, error) {
+	return validateParameters(params, func(name string, params []byte) (*job.ReporterBundle, error) {
+		return registry.NewRunReporterBundle(name, params)
+	})
+}
+
+// ValidateFinalParameters validates the parameters for the final reporter
+func (r *CompositeReporter) ValidateFinalParameters(params []byte) (interface{}, error) {
+	return validateParameters(params, func(name string, params []byte) (*job.ReporterBundle, error) {
+		return registry.NewFinalReporterBundle(name, params)
+	})
+}
+
+// Name returns the Name of the reporter
+func (r *CompositeReporter) Name() string {
+	return Name
+}
+
+// combine runs the child reporters and combines their verdicts.
+func combine(parameters interface{}, report func(bundle *job.ReporterBundle) (bool, interface{}, error)) (bool, interface{}, error) {
+	cfg, ok := parameters.(config)
+	if !ok {
+		return false, nil, fmt.Errorf("report parameters should be of type composite.Parameters")
+	}
+	result := Report{Verdict: cfg.verdict}
+	successes := 0
+	for _, bundle := range cfg.bundles {
+		section := Section{ReporterName: bundle.Reporter.Name()}
+		success, data, err := report(bundle)
+		if err != nil {
+			log.Warningf("Child reporter %s failed: %v", section.ReporterName, err)
+			section.Error = err.Error()
+		} else {
+			section.Success, section.Data = success, data
+			if success {
+				successes++
+			}
+		}
+		result.Sections = append(result.Sections, section)
+	}
+	var success bool
+	switch cfg.verdict {
+	case VerdictAny:
+		success = successes > 0
+	case VerdictMajority:
+		success = 2*successes > len(cfg.bundles)
+	default:
+		success = successes == len(cfg.bundles)
+	}
+	return success, result, nil
+}
+
+// RunReport runs all the child run reporters.
+func (r *CompositeReporter) RunReport(cancel <-chan struct{}, parameters interface{}, runStatus *job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
+	return combine(parameters, func(bundle *job.ReporterBundle) (bool, interface{}, error) {
+		return bundle.Reporter.RunReport(cancel, bundle.Parameters, runStatus, ev)
+	})
+}
+
+// FinalReport runs all the child final reporters.
+func (r *CompositeReporter) FinalReport(cancel <-chan struct{}, parameters interface{}, runStatuses []job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
+	return combine(parameters, func(bundle *job.ReporterBundle) (bool, interface{}, error) {
+		return bundle.Reporter.FinalReport(cancel, bundle.Parameters, runStatuses, ev)
+	})
+}
+
+// New builds a new CompositeReporter
+func New() job.Reporter {
+	return &CompositeReporter{}
+}
+
+// Load returns the name and factory which are needed to register the Reporter
+func Load() (string, job.ReporterFactory) {
+	return Name, New
+}
@@ -0,0 +1,69 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package composite
+
+import (
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/pluginregistry"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/plugins/reporters/noop"
+	"github.com/facebookincubator/contest/plugins/reporters/tap"
+	"github.com/stretchr/testify/require"
+)
+
+func setup(t *testing.T) job.Reporter {
+	pr := pluginregistry.NewPluginRegistry()
+	require.NoError(t, pr.RegisterReporter(noop.Load()))
+	require.NoError(t, pr.RegisterReporter(tap.Load()))
+	require.NoError(t, pr.RegisterReporter(Load()))
+	SetPluginRegistry(pr)
+	t.Cleanup(func() { SetPluginRegistry(nil) })
+	return New()
+}
+
+func TestValidateParameters(t *testing.T) {
+	r := setup(t)
+	for _, params := range []string{
+		`{"Reporters": []}`,
+		`{"Reporters": [{"Name": "noop"}], "Verdict": "some"}`,
+		`{"Reporters": [{"Name": "nonexistent"}]}`,
+		`{"Reporters": [{"Name": "composite", "Parameters": {"Reporters": []}}]}`,
+	} {
+		_, err := r.ValidateRunParameters([]byte(params))
+		require.Error(t, err, params)
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	r := setup(t)
+	runStatus := &job.RunStatus{TestStatuses: []job.TestStatus{{
+		TestCoordinates: job.TestCoordinates{TestName: "boot"},
+		TargetResults: []job.TargetResult{
+			{Target: &target.Target{ID: "1"}, Result: target.Result{Outcome: target.OutcomeFail}},
+		},
+	}}}
+	for verdict, want := range map[string]bool{
+		"":         false,
+		"All":      false,
+		"any":      true,
+		"majority": false,
+	} {
+		params, err := r.ValidateRunParameters([]byte(`{"Reporters": [{"Name": "noop"}, {"Name": "TAP"}], "Verdict": "` + verdict + `"}`))
+		require.NoError(t, err)
+		success, data, err := r.RunReport(nil, params, runStatus, nil)
+		require.NoError(t, err)
+		require.Equal(t, want, success, verdict)
+		report := data.(Report)
+		require.Len(t, report.Sections, 2)
+		require.Equal(t, "noop", report.Sections[0].ReporterName)
+		require.True(t, report.Sections[0].Success)
+		require.Equal(t, "TAP", report.Sections[1].ReporterName)
+		require.False(t, report.Sections[1].Success)
+		require.Contains(t, report.Sections[1].Data, "not ok 1 - boot: 1")
+	}
+}
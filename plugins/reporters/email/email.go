@@ -0,0 +1,226 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package email implements a final reporter which sends a summary of the job
+// by email. The SMTP server is configured on the server side via SetConfig,
+// while the recipients are specified in the job descriptor.
+package email
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/target"
+)
+
+// Name defines the name of the reporter used within the plugin registry
+var (
+	Name = "Email"
+	log  = logging.GetLogger("reporters/" + strings.ToLower(Name))
+)
+
+// Config is the server side configuration of the reporter.
+type Config struct {
+	// Server is the address of the SMTP server, in host:port form.
+	Server string
+	// From is the sender of the emails.
+	From string
+	// Username and Password are used to authenticate to the SMTP server, if
+	// set.
+	Username string
+	Password string
+	// JobURL, if set, is the URL of the jobs, to which the job ID is appended
+	// in order to link the job from the emails, e.g.
+	// https://contest.example.com/status?jobID=
+	JobURL string
+}
+
+var config *Config
+
+// SetConfig sets the configuration of the reporter. The reporter cannot be
+// used until it is configured.
+func SetConfig(c Config) {
+	config = &c
+}
+
+// sendMail is overridden in tests
+var sendMail = smtp.SendMail
+
+// FinalParameters contains the parameters of the final reporter.
+type FinalParameters struct {
+	// Recipients are the email addresses the summary is sent to.
+	Recipients []string
+	// OnlyOnFailure makes the reporter send an email only if some of the
+	// targets failed.
+	OnlyOnFailure bool
+}
+
+// Summary is the report data, describing the email which was sent.
+type Summary struct {
+	Sent       bool
+	Recipients []string `json:",omitempty"`
+	Passed     int
+	Failed     int
+	Skipped    int
+}
+
+// EmailReporter implements a final reporter which sends the results of the
+// job by email. The report is successful if no target failed.
+type EmailReporter struct {
+}
+
+// ValidateRunParameters validates the parameters for the run reporter
+func (r *EmailReporter) ValidateRunParameters(params []byte) (interface{}, error) {
+	return nil, fmt.Errorf("the %s reporter can only be used as a final reporter", Name)
+}
+
+// ValidateFinalParameters validates the parameters for the final reporter
+func (r *EmailReporter) ValidateFinalParameters(params []byte) (interface{}, error) {
+	if config == nil || config.Server == "" {
+		return nil, fmt.Errorf("the %s reporter is not configured on this server", Name)
+	}
+	var fp FinalParameters
+	if err := json.Unmarshal(params, &fp); err != nil {
+		return nil, err
+	}
+	if len(fp.Recipients) == 0 {
+		return nil, fmt.Errorf("no recipients specified")
+	}
+	for _, rcpt := range fp.Recipients {
+		if _, err := mail.ParseAddress(rcpt); err != nil {
+			return nil, fmt.Errorf("invalid recipient '%s': %v", rcpt, err)
+		}
+	}
+	return fp, nil
+}
+
+// Name returns the Name of the reporter
+func (r *EmailReporter) Name() string {
+	return Name
+}
+
+// RunReport is not supported, see ValidateRunParameters.
+func (r *EmailReporter) RunReport(cancel <-chan struct{}, parameters interface{}, runStatus *job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
+	return false, nil, fmt.Errorf("the %s reporter can only be used as a final reporter", Name)
+}
+
+// buildMessage returns the summary of the given runs, along with the subject
+// and the body of the email.
+func buildMessage(runStatuses []job.RunStatus) (Summary, string, string) {
+	var (
+		summary Summary
+		jobID   interface{} = "unknown"
+		failing []string
+	)
+	for _, runStatus := range runStatuses {
+		jobID = runStatus.JobID
+		for _, testStatus := range runStatus.TestStatuses {
+			for _, result := range testStatus.TargetResults {
+				switch result.Outcome {
+				case target.OutcomePass:
+					summary.Passed++
+				case target.OutcomeSkip:
+					summary.Skipped++
+				default:
+					summary.Failed++
+					name := result.Target.Name
+					if name == "" {
+						name = result.Target.ID
+					}
+					line := fmt.Sprintf("  run %d, test %s, target %s: %s", runStatus.RunID, testStatus.TestName, name, strings.ToLower(string(result.Outcome)))
+					if result.Step != "" {
+						line += fmt.Sprintf(" in step %s", result.Step)
+					}
+					if result.Message != "" {
+						line += ": " + result.Message
+					}
+					failing = append(failing, line)
+				}
+			}
+		}
+	}
+
+	verdict := "passed"
+	if summary.Failed > 0 {
+		verdict = "failed"
+	}
+	subject := fmt.Sprintf("ConTest job %v %s", jobID, verdict)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Job %v %s after %d run(s).\n\n", jobID, verdict, len(runStatuses))
+	fmt.Fprintf(&body, "Passed targets:  %d\n", summary.Passed)
+	fmt.Fprintf(&body, "Failed targets:  %d\n", summary.Failed)
+	fmt.Fprintf(&body, "Skipped targets: %d\n", summary.Skipped)
+	if len(failing) > 0 {
+		body.WriteString("\nFailing targets:\n")
+		body.WriteString(strings.Join(failing, "\n"))
+		body.WriteString("\n")
+	}
+	if config.JobURL != "" {
+		fmt.Fprintf(&body, "\nJob details: %s%v\n", config.JobURL, jobID)
+	}
+	return summary, subject, body.String()
+}
+
+// FinalReport sends the summary of all the runs to the recipients, unless
+// the job succeeded and the email is only wanted on failure.
+func (r *EmailReporter) FinalReport(cancel <-chan struct{}, parameters interface{}, runStatuses []job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
+	fp, ok := parameters.(FinalParameters)
+	if !ok {
+		return false, nil, fmt.Errorf("report parameters should be of type email.FinalParameters")
+	}
+	if config == nil {
+		return false, nil, fmt.Errorf("the %s reporter is not configured on this server", Name)
+	}
+	summary, subject, body := buildMessage(runStatuses)
+	success := summary.Failed == 0
+	if success && fp.OnlyOnFailure {
+		return success, summary, nil
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(fp.Recipients, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+
+	var auth smtp.Auth
+	if config.Username != "" {
+		host, _, err := net.SplitHostPort(config.Server)
+		if err != nil {
+			return false, nil, fmt.Errorf("invalid SMTP server address '%s': %v", config.Server, err)
+		}
+		auth = smtp.PlainAuth("", config.Username, config.Password, host)
+	}
+	if err := sendMail(config.Server, auth, config.From, fp.Recipients, msg.Bytes()); err != nil {
+		return success, summary, fmt.Errorf("cannot send email: %v", err)
+	}
+	log.Infof("Sent summary email to %s", strings.Join(fp.Recipients, ", "))
+	summary.Sent = true
+	summary.Recipients = fp.Recipients
+	return success, summary, nil
+}
+
+// New builds a new EmailReporter
+func New() job.Reporter {
+	return &EmailReporter{}
+}
+
+// Load returns the name and factory which are needed to register the Reporter
+func Load() (string, job.ReporterFactory) {
+	return Name, New
+}
@@ -0,0 +1,104 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package email
+
+import (
+	"net/smtp"
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/stretchr/testify/require"
+)
+
+type sentMail struct {
+	addr string
+	from string
+	to   []string
+	msg  string
+}
+
+func setup(t *testing.T) *[]sentMail {
+	var sent []sentMail
+	origSendMail, origConfig := sendMail, config
+	t.Cleanup(func() {
+		sendMail, config = origSendMail, origConfig
+	})
+	sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sent = append(sent, sentMail{addr: addr, from: from, to: to, msg: string(msg)})
+		return nil
+	}
+	SetConfig(Config{Server: "smtp.example.com:25", From: "contest@example.com", JobURL: "https://contest.example.com/jobs/"})
+	return &sent
+}
+
+func runStatuses(outcome target.Outcome) []job.RunStatus {
+	return []job.RunStatus{{
+		RunCoordinates: job.RunCoordinates{JobID: 42, RunID: 1},
+		TestStatuses: []job.TestStatus{{
+			TestCoordinates: job.TestCoordinates{TestName: "boot"},
+			TargetResults: []job.TargetResult{
+				{Target: &target.Target{Name: "host001"}, Result: target.Result{Outcome: target.OutcomePass}},
+				{Target: &target.Target{Name: "host002"}, Result: target.Result{Outcome: outcome, Step: "power_on", Message: "no power"}},
+			},
+		}},
+	}}
+}
+
+func TestValidateFinalParameters(t *testing.T) {
+	r := New()
+	config = nil
+	_, err := r.ValidateFinalParameters([]byte(`{"Recipients": ["a@example.com"]}`))
+	require.Error(t, err)
+
+	setup(t)
+	_, err = r.ValidateFinalParameters([]byte(`{"Recipients": []}`))
+	require.Error(t, err)
+	_, err = r.ValidateFinalParameters([]byte(`{"Recipients": ["not an address"]}`))
+	require.Error(t, err)
+	_, err = r.ValidateFinalParameters([]byte(`{"Recipients": ["a@example.com", "B <b@example.com>"]}`))
+	require.NoError(t, err)
+	_, err = r.ValidateRunParameters([]byte(`{}`))
+	require.Error(t, err)
+}
+
+func TestFinalReport(t *testing.T) {
+	sent := setup(t)
+	r := New()
+	params, err := r.ValidateFinalParameters([]byte(`{"Recipients": ["a@example.com"]}`))
+	require.NoError(t, err)
+
+	success, data, err := r.FinalReport(nil, params, runStatuses(target.OutcomeFail), nil)
+	require.NoError(t, err)
+	require.False(t, success)
+	require.Equal(t, Summary{Sent: true, Recipients: []string{"a@example.com"}, Passed: 1, Failed: 1}, data)
+	require.Len(t, *sent, 1)
+	m := (*sent)[0]
+	require.Equal(t, "smtp.example.com:25", m.addr)
+	require.Equal(t, "contest@example.com", m.from)
+	require.Equal(t, []string{"a@example.com"}, m.to)
+	require.Contains(t, m.msg, "Subject: ConTest job 42 failed\r\n")
+	require.Contains(t, m.msg, "run 1, test boot, target host002: fail in step power_on: no power\r\n")
+	require.Contains(t, m.msg, "Job details: https://contest.example.com/jobs/42\r\n")
+}
+
+func TestFinalReportOnlyOnFailure(t *testing.T) {
+	sent := setup(t)
+	r := New()
+	params, err := r.ValidateFinalParameters([]byte(`{"Recipients": ["a@example.com"], "OnlyOnFailure": true}`))
+	require.NoError(t, err)
+
+	success, data, err := r.FinalReport(nil, params, runStatuses(target.OutcomeSkip), nil)
+	require.NoError(t, err)
+	require.True(t, success)
+	require.Equal(t, Summary{Passed: 1, Skipped: 1}, data)
+	require.Empty(t, *sent)
+
+	success, _, err = r.FinalReport(nil, params, runStatuses(target.OutcomeError), nil)
+	require.NoError(t, err)
+	require.False(t, success)
+	require.Len(t, *sent, 1)
+}
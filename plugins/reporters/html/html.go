@@ -0,0 +1,339 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package html implements a final reporter which renders a standalone HTML
+// page for the job, with a target by step matrix, the events of each target
+// and a timing chart for each test. The page is stored in the artifact store,
+// and the reference to it is the data of the report, so that it is linked
+// from the job status.
+package html
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/artifact"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// Name defines the name of the reporter used within the plugin registry
+var (
+	Name = "HTML"
+	log  = logging.GetLogger("reporters/" + strings.ToLower(Name))
+)
+
+// FinalParameters contains the parameters of the final reporter.
+type FinalParameters struct {
+	// Title is the title of the page. If empty, the job ID is used.
+	Title string
+}
+
+// HTMLReporter implements a final reporter which renders the results of the
+// job as an HTML page. The report is successful if no target failed.
+type HTMLReporter struct {
+}
+
+// ValidateRunParameters validates the parameters for the run reporter
+func (r *HTMLReporter) ValidateRunParameters(params []byte) (interface{}, error) {
+	return nil, fmt.Errorf("the %s reporter can only be used as a final reporter", Name)
+}
+
+// ValidateFinalParameters validates the parameters for the final reporter
+func (r *HTMLReporter) ValidateFinalParameters(params []byte) (interface{}, error) {
+	if artifact.GetStore() == nil {
+		return nil, fmt.Errorf("the %s reporter requires an artifact store", Name)
+	}
+	var fp FinalParameters
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &fp); err != nil {
+			return nil, err
+		}
+	}
+	return fp, nil
+}
+
+// Name returns the Name of the reporter
+func (r *HTMLReporter) Name() string {
+	return Name
+}
+
+// RunReport is not supported, see ValidateRunParameters.
+func (r *HTMLReporter) RunReport(cancel <-chan struct{}, parameters interface{}, runStatus *job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
+	return false, nil, fmt.Errorf("the %s reporter can only be used as a final reporter", Name)
+}
+
+type cellView struct {
+	Class string
+	Text  string
+	Title string
+}
+
+type logView struct {
+	Time    string
+	Step    string
+	Event   string
+	Payload string
+}
+
+type barView struct {
+	Left  float64
+	Width float64
+	Class string
+	Title string
+}
+
+type rowView struct {
+	Target string
+	Class  string
+	Cells  []cellView
+	Bars   []barView
+	Logs   []logView
+}
+
+type testView struct {
+	RunID    types.RunID
+	Name     string
+	Steps    []string
+	Rows     []rowView
+	Duration string
+	// StepLogs are the events which are not associated to a target
+	StepLogs []logView
+}
+
+type pageView struct {
+	Title     string
+	Generated string
+	Verdict   string
+	Tests     []testView
+}
+
+// statusClass classifies a target in a step.
+func statusClass(ts job.TargetStatus) string {
+	switch {
+	case ts.Skipped:
+		return "skip"
+	case ts.Error != "":
+		return "fail"
+	case ts.OutTime.IsZero():
+		return "running"
+	default:
+		return "pass"
+	}
+}
+
+func newLog(e testevent.Event) logView {
+	l := logView{Time: e.EmitTime.UTC().Format(time.RFC3339), Step: e.Header.TestStepLabel}
+	if e.Data != nil {
+		l.Event = string(e.Data.EventName)
+		if e.Data.Payload != nil {
+			l.Payload = string(*e.Data.Payload)
+		}
+	}
+	return l
+}
+
+// buildTest builds the view of a test.
+func buildTest(runID types.RunID, testStatus job.TestStatus) (testView, bool) {
+	tv := testView{RunID: runID, Name: testStatus.TestName}
+	success := true
+
+	// the time span of the test, to scale the timing chart
+	var start, end time.Time
+	for _, stepStatus := range testStatus.TestStepStatuses {
+		tv.Steps = append(tv.Steps, stepStatus.TestStepLabel)
+		for _, e := range stepStatus.Events {
+			tv.StepLogs = append(tv.StepLogs, newLog(e))
+		}
+		for _, ts := range stepStatus.TargetStatuses {
+			if !ts.InTime.IsZero() && (start.IsZero() || ts.InTime.Before(start)) {
+				start = ts.InTime
+			}
+			if ts.OutTime.After(end) {
+				end = ts.OutTime
+			}
+		}
+	}
+	span := end.Sub(start)
+	if span > 0 {
+		tv.Duration = span.Round(time.Millisecond).String()
+	}
+
+	rows := make(map[string]*rowView)
+	var order []string
+	for i, stepStatus := range testStatus.TestStepStatuses {
+		for _, ts := range stepStatus.TargetStatuses {
+			if ts.Target == nil {
+				continue
+			}
+			row, ok := rows[ts.Target.ID]
+			if !ok {
+				row = &rowView{Target: ts.Target.ID, Class: "pass", Cells: make([]cellView, len(testStatus.TestStepStatuses))}
+				for j := range row.Cells {
+					row.Cells[j] = cellView{Class: "none", Text: "-"}
+				}
+				rows[ts.Target.ID] = row
+				order = append(order, ts.Target.ID)
+			}
+			class := statusClass(ts)
+			cell := cellView{Class: class}
+			switch class {
+			case "running":
+				cell.Text = "running"
+			default:
+				cell.Text = ts.OutTime.Sub(ts.InTime).Round(time.Millisecond).String()
+			}
+			if ts.Error != "" {
+				cell.Title = ts.Error
+			} else if ts.SkipReason != "" {
+				cell.Title = ts.SkipReason
+			}
+			row.Cells[i] = cell
+			if class == "fail" {
+				row.Class = "fail"
+				success = false
+			}
+			if span > 0 && !ts.InTime.IsZero() {
+				out := ts.OutTime
+				if out.IsZero() {
+					out = end
+				}
+				row.Bars = append(row.Bars, barView{
+					Left:  100 * float64(ts.InTime.Sub(start)) / float64(span),
+					Width: 100 * float64(out.Sub(ts.InTime)) / float64(span),
+					Class: class,
+					Title: fmt.Sprintf("%s: %s", stepStatus.TestStepLabel, cell.Text),
+				})
+			}
+			for _, e := range ts.Events {
+				row.Logs = append(row.Logs, newLog(e))
+			}
+		}
+	}
+	for _, id := range order {
+		row := rows[id]
+		sort.SliceStable(row.Logs, func(i, j int) bool { return row.Logs[i].Time < row.Logs[j].Time })
+		tv.Rows = append(tv.Rows, *row)
+	}
+	return tv, success
+}
+
+var pageTemplate = template.Must(template.New(Name).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; font-size: 0.9em; }
+.pass { background: #c8e6c9; }
+.fail { background: #ffcdd2; }
+.skip { background: #fff9c4; }
+.running { background: #bbdefb; }
+.none { color: #999; }
+.timeline { position: relative; height: 14px; width: 400px; background: #f5f5f5; }
+.timeline span { position: absolute; top: 0; height: 14px; }
+pre { white-space: pre-wrap; margin: 0; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}: {{ .Verdict }}</h1>
+<p>Generated on {{ .Generated }}</p>
+{{ range .Tests }}
+<h2>Run {{ .RunID }}: {{ .Name }}{{ if .Duration }} ({{ .Duration }}){{ end }}</h2>
+<table>
+<tr><th>Target</th>{{ range .Steps }}<th>{{ . }}</th>{{ end }}<th>Timing</th></tr>
+{{ range .Rows }}<tr>
+<td class="{{ .Class }}">{{ .Target }}</td>
+{{ range .Cells }}<td class="{{ .Class }}"{{ if .Title }} title="{{ .Title }}"{{ end }}>{{ .Text }}</td>
+{{ end }}<td><div class="timeline">{{ range .Bars }}<span class="{{ .Class }}" style="left: {{ printf "%.2f" .Left }}%; width: {{ printf "%.2f" .Width }}%" title="{{ .Title }}"></span>{{ end }}</div></td>
+</tr>
+{{ end }}</table>
+{{ range .Rows }}{{ if .Logs }}<details>
+<summary>Events of {{ .Target }} ({{ len .Logs }})</summary>
+<table>
+<tr><th>Time</th><th>Step</th><th>Event</th><th>Payload</th></tr>
+{{ range .Logs }}<tr><td>{{ .Time }}</td><td>{{ .Step }}</td><td>{{ .Event }}</td><td><pre>{{ .Payload }}</pre></td></tr>
+{{ end }}</table>
+</details>
+{{ end }}{{ end }}{{ if .StepLogs }}<details>
+<summary>Step events ({{ len .StepLogs }})</summary>
+<table>
+<tr><th>Time</th><th>Step</th><th>Event</th><th>Payload</th></tr>
+{{ range .StepLogs }}<tr><td>{{ .Time }}</td><td>{{ .Step }}</td><td>{{ .Event }}</td><td><pre>{{ .Payload }}</pre></td></tr>
+{{ end }}</table>
+</details>
+{{ end }}{{ end }}
+</body>
+</html>
+`))
+
+// render renders the page for the given runs.
+func render(title string, runStatuses []job.RunStatus) ([]byte, bool, error) {
+	page := pageView{Title: title, Generated: time.Now().UTC().Format(time.RFC3339)}
+	success := true
+	for _, runStatus := range runStatuses {
+		for _, testStatus := range runStatus.TestStatuses {
+			tv, ok := buildTest(runStatus.RunID, testStatus)
+			success = success && ok
+			page.Tests = append(page.Tests, tv)
+		}
+	}
+	if success {
+		page.Verdict = "PASS"
+	} else {
+		page.Verdict = "FAIL"
+	}
+	var buf bytes.Buffer
+	if err := pageTemplate.Execute(&buf, page); err != nil {
+		return nil, false, fmt.Errorf("cannot render HTML report: %v", err)
+	}
+	return buf.Bytes(), success, nil
+}
+
+// FinalReport renders the page and stores it in the artifact store. The data
+// of the report is the reference to the stored page.
+func (r *HTMLReporter) FinalReport(cancel <-chan struct{}, parameters interface{}, runStatuses []job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
+	fp, ok := parameters.(FinalParameters)
+	if !ok {
+		return false, nil, fmt.Errorf("report parameters should be of type html.FinalParameters")
+	}
+	if len(runStatuses) == 0 {
+		return false, nil, fmt.Errorf("no runs to report")
+	}
+	jobID := runStatuses[0].JobID
+	title := fp.Title
+	if title == "" {
+		title = fmt.Sprintf("Job %d", jobID)
+	}
+	page, success, err := render(title, runStatuses)
+	if err != nil {
+		return false, nil, err
+	}
+	ref, err := artifact.Put(fmt.Sprintf("%d/report.html", jobID), "report.html", bytes.NewReader(page))
+	if err != nil {
+		return success, nil, err
+	}
+	log.Infof("Stored HTML report of job %d as %s", jobID, ref.Key)
+	return success, ref, nil
+}
+
+// New builds a new HTMLReporter
+func New() job.Reporter {
+	return &HTMLReporter{}
+}
+
+// Load returns the name and factory which are needed to register the Reporter
+func Load() (string, job.ReporterFactory) {
+	return Name, New
+}
@@ -0,0 +1,88 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package html
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/artifact"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/plugins/artifactstores/localdir"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFinalReport(t *testing.T) {
+	r := New()
+	artifact.SetStore(nil)
+	_, err := r.ValidateFinalParameters(nil)
+	require.Error(t, err)
+
+	store, err := localdir.New(t.TempDir())
+	require.NoError(t, err)
+	artifact.SetStore(store)
+	defer artifact.SetStore(nil)
+	params, err := r.ValidateFinalParameters([]byte(`{"Title": "Nightly <boot>"}`))
+	require.NoError(t, err)
+
+	start := time.Unix(1000, 0)
+	payload := json.RawMessage(`{"Msg": "<b>hello</b>"}`)
+	t1, t2 := &target.Target{ID: "host1"}, &target.Target{ID: "host2"}
+	stepCoords := func(label string) job.TestStepCoordinates {
+		return job.TestStepCoordinates{TestStepLabel: label}
+	}
+	runStatus := job.RunStatus{
+		RunCoordinates: job.RunCoordinates{JobID: 12, RunID: 1},
+		TestStatuses: []job.TestStatus{{
+			TestCoordinates: job.TestCoordinates{TestName: "boot"},
+			TestStepStatuses: []job.TestStepStatus{
+				{
+					TestStepCoordinates: stepCoords("power"),
+					TargetStatuses: []job.TargetStatus{
+						{Target: t1, InTime: start, OutTime: start.Add(time.Second), Events: []testevent.Event{{
+							EmitTime: start,
+							Header:   &testevent.Header{TestStepLabel: "power"},
+							Data:     &testevent.Data{EventName: "Echo", Target: t1, Payload: &payload},
+						}}},
+						{Target: t2, InTime: start, OutTime: start.Add(2 * time.Second), Error: "no power"},
+					},
+				},
+				{
+					TestStepCoordinates: stepCoords("ping"),
+					TargetStatuses: []job.TargetStatus{
+						{Target: t1, InTime: start.Add(time.Second), OutTime: start.Add(4 * time.Second)},
+					},
+				},
+			},
+		}},
+	}
+	success, data, err := r.FinalReport(nil, params, []job.RunStatus{runStatus}, nil)
+	require.NoError(t, err)
+	require.False(t, success)
+	ref, ok := data.(*artifact.Ref)
+	require.True(t, ok)
+	require.Equal(t, "12/report.html", ref.Key)
+
+	rc, err := artifact.Get(*ref)
+	require.NoError(t, err)
+	defer rc.Close()
+	buf, err := ioutil.ReadAll(rc)
+	require.NoError(t, err)
+	page := string(buf)
+	require.Contains(t, page, "<title>Nightly &lt;boot&gt;</title>")
+	require.Contains(t, page, "<h1>Nightly &lt;boot&gt;: FAIL</h1>")
+	require.Contains(t, page, "<th>power</th><th>ping</th>")
+	require.Contains(t, page, `<td class="fail" title="no power">2s</td>`)
+	require.Contains(t, page, `<td class="none">-</td>`)
+	require.Contains(t, page, `<span class="pass" style="left: 25.00%; width: 75.00%" title="ping: 3s"></span>`)
+	require.Contains(t, page, "<summary>Events of host1 (1)</summary>")
+	require.Contains(t, page, "&lt;b&gt;hello&lt;/b&gt;")
+	require.NotContains(t, page, "<b>hello</b>")
+}
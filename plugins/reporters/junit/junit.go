@@ -0,0 +1,211 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package junit implements a reporter which renders the results of a job as a
+// JUnit XML document, so that CI systems can consume them natively. Each test
+// of a run is a test suite, and each target of a test is a test case.
+package junit
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/target"
+)
+
+// Name defines the name of the reporter used within the plugin registry
+var Name = "JUnit"
+
+// Parameters contains the parameters of both the run and the final reporter.
+type Parameters struct {
+	// Name is the name of the document, if any.
+	Name string `json:",omitempty"`
+}
+
+// TestSuites is the root element of a JUnit XML document.
+type TestSuites struct {
+	XMLName  xml.Name    `xml:"testsuites"`
+	Name     string      `xml:"name,attr,omitempty"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Suites   []TestSuite `xml:"testsuite"`
+}
+
+// TestSuite holds the test cases of a test within a run.
+type TestSuite struct {
+	Name     string     `xml:"name,attr"`
+	Tests    int        `xml:"tests,attr"`
+	Failures int        `xml:"failures,attr"`
+	Errors   int        `xml:"errors,attr"`
+	Skipped  int        `xml:"skipped,attr"`
+	Time     float64    `xml:"time,attr"`
+	Cases    []TestCase `xml:"testcase"`
+}
+
+// TestCase holds the result of a target in a test.
+type TestCase struct {
+	Name      string   `xml:"name,attr"`
+	ClassName string   `xml:"classname,attr"`
+	Time      float64  `xml:"time,attr"`
+	Failure   *Message `xml:"failure,omitempty"`
+	Error     *Message `xml:"error,omitempty"`
+	Skipped   *Message `xml:"skipped,omitempty"`
+}
+
+// Message explains why a test case did not pass.
+type Message struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnitReporter implements a reporter which renders the results as JUnit XML.
+// The report is successful if no target failed or errored.
+type JUnitReporter struct {
+}
+
+func validateParameters(params []byte) (interface{}, error) {
+	var p Parameters
+	if len(params) == 0 {
+		return p, nil
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ValidateRunParameters validates the parameters for the run reporter
+func (r *JUnitReporter) ValidateRunParameters(params []byte) (interface{}, error) {
+	return validateParameters(params)
+}
+
+// ValidateFinalParameters validates the parameters for the final reporter
+func (r *JUnitReporter) ValidateFinalParameters(params []byte) (interface{}, error) {
+	return validateParameters(params)
+}
+
+// Name returns the Name of the reporter
+func (r *JUnitReporter) Name() string {
+	return Name
+}
+
+// targetTime returns how long a target spent in a test, from when it entered
+// the first step to when it left the last one.
+func targetTime(testStatus job.TestStatus, t *target.Target) float64 {
+	var in, out time.Time
+	for _, stepStatus := range testStatus.TestStepStatuses {
+		for _, targetStatus := range stepStatus.TargetStatuses {
+			if *targetStatus.Target != *t {
+				continue
+			}
+			if !targetStatus.InTime.IsZero() && (in.IsZero() || targetStatus.InTime.Before(in)) {
+				in = targetStatus.InTime
+			}
+			if targetStatus.OutTime.After(out) {
+				out = targetStatus.OutTime
+			}
+		}
+	}
+	if in.IsZero() || out.Before(in) {
+		return 0
+	}
+	return out.Sub(in).Seconds()
+}
+
+// newTestSuite builds the test suite of a test in a run.
+func newTestSuite(runID int, testStatus job.TestStatus) TestSuite {
+	suite := TestSuite{Name: testStatus.TestName}
+	if runID > 0 {
+		suite.Name = fmt.Sprintf("%s (run %d)", testStatus.TestName, runID)
+	}
+	for _, result := range testStatus.TargetResults {
+		tc := TestCase{
+			Name:      result.Target.ID,
+			ClassName: testStatus.TestName,
+			Time:      targetTime(testStatus, result.Target),
+		}
+		if tc.Name == "" {
+			tc.Name = result.Target.Name
+		}
+		msg := &Message{Message: result.Message}
+		if result.Step != "" {
+			msg.Text = fmt.Sprintf("step %s: %s", result.Step, result.Message)
+		}
+		switch result.Outcome {
+		case target.OutcomeFail:
+			tc.Failure = msg
+			suite.Failures++
+		case target.OutcomeError:
+			tc.Error = msg
+			suite.Errors++
+		case target.OutcomeSkip:
+			tc.Skipped = msg
+			suite.Skipped++
+		}
+		suite.Time += tc.Time
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Tests = len(suite.Cases)
+	return suite
+}
+
+// render builds the XML document out of the given run statuses. The run
+// number is only added to the suite names when there is more than one run.
+func render(name string, runStatuses []job.RunStatus) (bool, string, error) {
+	doc := TestSuites{Name: name}
+	for _, runStatus := range runStatuses {
+		runID := 0
+		if len(runStatuses) > 1 {
+			runID = int(runStatus.RunID)
+		}
+		for _, testStatus := range runStatus.TestStatuses {
+			suite := newTestSuite(runID, testStatus)
+			doc.Tests += suite.Tests
+			doc.Failures += suite.Failures
+			doc.Errors += suite.Errors
+			doc.Skipped += suite.Skipped
+			doc.Suites = append(doc.Suites, suite)
+		}
+	}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return false, "", fmt.Errorf("cannot render JUnit XML: %v", err)
+	}
+	return doc.Failures == 0 && doc.Errors == 0, xml.Header + string(data), nil
+}
+
+// RunReport renders the results of a run.
+func (r *JUnitReporter) RunReport(cancel <-chan struct{}, parameters interface{}, runStatus *job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
+	params, ok := parameters.(Parameters)
+	if !ok {
+		return false, nil, fmt.Errorf("report parameters should be of type junit.Parameters")
+	}
+	return render(params.Name, []job.RunStatus{*runStatus})
+}
+
+// FinalReport renders the results of all the runs.
+func (r *JUnitReporter) FinalReport(cancel <-chan struct{}, parameters interface{}, runStatuses []job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
+	params, ok := parameters.(Parameters)
+	if !ok {
+		return false, nil, fmt.Errorf("report parameters should be of type junit.Parameters")
+	}
+	return render(params.Name, runStatuses)
+}
+
+// New builds a new JUnitReporter
+func New() job.Reporter {
+	return &JUnitReporter{}
+}
+
+// Load returns the name and factory which are needed to register the Reporter
+func Load() (string, job.ReporterFactory) {
+	return Name, New
+}
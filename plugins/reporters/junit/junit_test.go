@@ -0,0 +1,85 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package junit
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunReport(t *testing.T) {
+	t1 := &target.Target{ID: "id1", Name: "host001"}
+	t2 := &target.Target{Name: "host002"}
+	t3 := &target.Target{ID: "id3"}
+	testStatus := job.TestStatus{
+		TestCoordinates: job.TestCoordinates{TestName: "boot"},
+		TestStepStatuses: []job.TestStepStatus{
+			{
+				TargetStatuses: []job.TargetStatus{
+					{Target: t1, InTime: time.Unix(10, 0), OutTime: time.Unix(12, 0)},
+					{Target: t2, InTime: time.Unix(10, 0), OutTime: time.Unix(11, 0), Error: "no power"},
+					{Target: t3, InTime: time.Unix(10, 0), OutTime: time.Unix(10, 0), Skipped: true},
+				},
+			},
+			{
+				TargetStatuses: []job.TargetStatus{
+					{Target: t1, InTime: time.Unix(12, 0), OutTime: time.Unix(15, 0)},
+				},
+			},
+		},
+		TargetResults: []job.TargetResult{
+			{Target: t1, Result: target.Result{Outcome: target.OutcomePass}},
+			{Target: t2, Result: target.Result{Outcome: target.OutcomeFail, Message: "no power", Step: "power_on"}},
+			{Target: t3, Result: target.Result{Outcome: target.OutcomeSkip, Message: "not applicable", Step: "power_on"}},
+		},
+	}
+
+	r := New()
+	params, err := r.ValidateRunParameters([]byte(`{"Name": "nightly"}`))
+	require.NoError(t, err)
+	success, data, err := r.RunReport(nil, params, &job.RunStatus{TestStatuses: []job.TestStatus{testStatus}}, nil)
+	require.NoError(t, err)
+	require.False(t, success)
+	doc, ok := data.(string)
+	require.True(t, ok)
+	require.True(t, strings.HasPrefix(doc, xml.Header))
+
+	var suites TestSuites
+	require.NoError(t, xml.Unmarshal([]byte(doc), &suites))
+	require.Equal(t, "nightly", suites.Name)
+	require.Equal(t, 3, suites.Tests)
+	require.Equal(t, 1, suites.Failures)
+	require.Equal(t, 1, suites.Skipped)
+	require.Len(t, suites.Suites, 1)
+	suite := suites.Suites[0]
+	require.Equal(t, "boot", suite.Name)
+	require.Len(t, suite.Cases, 3)
+	require.Equal(t, TestCase{Name: "id1", ClassName: "boot", Time: 5}, suite.Cases[0])
+	require.Equal(t, "host002", suite.Cases[1].Name)
+	require.Equal(t, &Message{Message: "no power", Text: "step power_on: no power"}, suite.Cases[1].Failure)
+	require.NotNil(t, suite.Cases[2].Skipped)
+
+	// a job where no target failed is successful, across all runs
+	testStatus.TargetResults = testStatus.TargetResults[:1]
+	params, err = r.ValidateFinalParameters(nil)
+	require.NoError(t, err)
+	success, data, err = r.FinalReport(nil, params, []job.RunStatus{
+		{RunCoordinates: job.RunCoordinates{RunID: 1}, TestStatuses: []job.TestStatus{testStatus}},
+		{RunCoordinates: job.RunCoordinates{RunID: 2}, TestStatuses: []job.TestStatus{testStatus}},
+	}, nil)
+	require.NoError(t, err)
+	require.True(t, success)
+	var finalSuites TestSuites
+	require.NoError(t, xml.Unmarshal([]byte(data.(string)), &finalSuites))
+	require.Len(t, finalSuites.Suites, 2)
+	require.Equal(t, "boot (run 2)", finalSuites.Suites[1].Name)
+}
@@ -0,0 +1,281 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package pushgateway implements a run reporter which pushes the metrics of
+// each run to a Prometheus Pushgateway, so that dashboards can track the
+// health of the fleet over time. The metrics are grouped by job name and
+// requestor, and every run replaces the metrics of the previous one.
+package pushgateway
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/insomniacslk/xjson"
+)
+
+// Name defines the name of the reporter used within the plugin registry
+var (
+	Name = "Pushgateway"
+	log  = logging.GetLogger("reporters/" + strings.ToLower(Name))
+)
+
+const (
+	defaultJob     = "contest"
+	defaultTimeout = 30 * time.Second
+)
+
+// getJobRequest is overridden in tests
+var getJobRequest = func(jobID types.JobID) (*job.Request, error) {
+	return storage.NewJobStorageManager().GetJobRequest(jobID)
+}
+
+// RunParameters contains the parameters of the run reporter.
+type RunParameters struct {
+	// URL is the base URL of the Pushgateway, e.g. http://pushgateway:9091
+	URL string
+	// Job is the value of the "job" label of the pushed metrics. If empty,
+	// "contest" is used.
+	Job string
+	// Timeout is the maximum time to push the metrics. If zero, 30 seconds
+	// are allowed.
+	Timeout xjson.Duration
+}
+
+// PushgatewayReporter implements a run reporter which pushes metrics to a
+// Prometheus Pushgateway. The report is successful if no target failed.
+type PushgatewayReporter struct {
+}
+
+// ValidateRunParameters validates the parameters for the run reporter
+func (r *PushgatewayReporter) ValidateRunParameters(params []byte) (interface{}, error) {
+	var rp RunParameters
+	if err := json.Unmarshal(params, &rp); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rp.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Pushgateway URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Pushgateway URL must be http or https, got '%s'", rp.URL)
+	}
+	if rp.Job == "" {
+		rp.Job = defaultJob
+	}
+	if rp.Timeout < 0 {
+		return nil, fmt.Errorf("timeout cannot be negative")
+	}
+	return rp, nil
+}
+
+// ValidateFinalParameters validates the parameters for the final reporter
+func (r *PushgatewayReporter) ValidateFinalParameters(params []byte) (interface{}, error) {
+	return nil, fmt.Errorf("the %s reporter can only be used as a run reporter", Name)
+}
+
+// Name returns the Name of the reporter
+func (r *PushgatewayReporter) Name() string {
+	return Name
+}
+
+// metrics accumulates samples in the Prometheus text exposition format.
+type metrics struct {
+	buf     bytes.Buffer
+	current string
+}
+
+// escape escapes a label value.
+func escape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// add adds a sample to a gauge. Labels are given as name, value pairs.
+func (m *metrics) add(name, help string, value float64, labels ...string) {
+	if name != m.current {
+		fmt.Fprintf(&m.buf, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		m.current = name
+	}
+	m.buf.WriteString(name)
+	if len(labels) > 0 {
+		var pairs []string
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], escape(labels[i+1])))
+		}
+		m.buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	fmt.Fprintf(&m.buf, " %g\n", value)
+}
+
+// outcomes lists the outcomes in a stable order, so that they are always
+// exported, even if no target had them.
+var outcomes = []target.Outcome{target.OutcomePass, target.OutcomeFail, target.OutcomeSkip, target.OutcomeError}
+
+// buildMetrics converts the status of a run into metrics.
+func buildMetrics(runStatus *job.RunStatus) (*metrics, bool) {
+	var (
+		m       metrics
+		success = true
+	)
+	m.add("contest_job_id", "ID of the last reported job.", float64(runStatus.JobID))
+	m.add("contest_run_id", "ID of the last reported run.", float64(runStatus.RunID))
+	m.add("contest_last_run_timestamp_seconds", "Time the last run was reported.", float64(time.Now().Unix()))
+
+	counts := make([]map[target.Outcome]int, len(runStatus.TestStatuses))
+	for i, testStatus := range runStatus.TestStatuses {
+		counts[i] = make(map[target.Outcome]int)
+		for _, result := range testStatus.TargetResults {
+			counts[i][result.Outcome]++
+			if result.Outcome == target.OutcomeFail || result.Outcome == target.OutcomeError {
+				success = false
+			}
+		}
+	}
+	for i, testStatus := range runStatus.TestStatuses {
+		for _, o := range outcomes {
+			m.add("contest_targets", "Number of targets by test and outcome.", float64(counts[i][o]),
+				"test", testStatus.TestName, "outcome", strings.ToLower(string(o)))
+		}
+	}
+
+	type stepDuration struct {
+		test, step    string
+		wall, average float64
+	}
+	var durations []stepDuration
+	for _, testStatus := range runStatus.TestStatuses {
+		for _, stepStatus := range testStatus.TestStepStatuses {
+			var (
+				first, last time.Time
+				total       time.Duration
+				completed   int
+			)
+			for _, ts := range stepStatus.TargetStatuses {
+				if ts.InTime.IsZero() || ts.OutTime.IsZero() {
+					continue
+				}
+				if first.IsZero() || ts.InTime.Before(first) {
+					first = ts.InTime
+				}
+				if ts.OutTime.After(last) {
+					last = ts.OutTime
+				}
+				total += ts.OutTime.Sub(ts.InTime)
+				completed++
+			}
+			if completed == 0 {
+				continue
+			}
+			durations = append(durations, stepDuration{
+				test:    testStatus.TestName,
+				step:    stepStatus.TestStepLabel,
+				wall:    last.Sub(first).Seconds(),
+				average: (total / time.Duration(completed)).Seconds(),
+			})
+		}
+	}
+	for _, d := range durations {
+		m.add("contest_step_duration_seconds", "Time from the first target entering a test step to the last one leaving it.", d.wall,
+			"test", d.test, "step", d.step)
+	}
+	for _, d := range durations {
+		m.add("contest_step_target_duration_seconds", "Average time spent by a target in a test step.", d.average,
+			"test", d.test, "step", d.step)
+	}
+	return &m, success
+}
+
+// groupingKey returns the path identifying the group of metrics in the
+// Pushgateway. Values are base64 encoded, so that they can contain slashes
+// and be empty.
+func groupingKey(jobLabel string, labels map[string]string) string {
+	enc := func(v string) string {
+		if v == "" {
+			return "="
+		}
+		return base64.RawURLEncoding.EncodeToString([]byte(v))
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	path := "/metrics/job@base64/" + enc(jobLabel)
+	for _, name := range names {
+		path += "/" + name + "@base64/" + enc(labels[name])
+	}
+	return path
+}
+
+// RunReport pushes the metrics of a run.
+func (r *PushgatewayReporter) RunReport(cancel <-chan struct{}, parameters interface{}, runStatus *job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
+	rp, ok := parameters.(RunParameters)
+	if !ok {
+		return false, nil, fmt.Errorf("report parameters should be of type pushgateway.RunParameters")
+	}
+	m, success := buildMetrics(runStatus)
+
+	request, err := getJobRequest(runStatus.JobID)
+	if err != nil {
+		return success, nil, err
+	}
+	path := groupingKey(rp.Job, map[string]string{
+		"contest_job_name": request.JobName,
+		"requestor":        request.Requestor,
+	})
+
+	timeout := time.Duration(rp.Timeout)
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	// PUT replaces all the metrics of the group, so that tests which are no
+	// longer part of the job do not linger
+	req, err := http.NewRequest(http.MethodPut, strings.TrimSuffix(rp.URL, "/")+path, &m.buf)
+	if err != nil {
+		return success, nil, fmt.Errorf("cannot create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	client := http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return success, nil, fmt.Errorf("cannot push metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return success, nil, fmt.Errorf("Pushgateway returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	log.Debugf("Pushed metrics of run %d of job %d", runStatus.RunID, runStatus.JobID)
+	return success, fmt.Sprintf("Metrics pushed to %s", path), nil
+}
+
+// FinalReport is not supported, see ValidateFinalParameters.
+func (r *PushgatewayReporter) FinalReport(cancel <-chan struct{}, parameters interface{}, runStatuses []job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
+	return false, nil, fmt.Errorf("the %s reporter can only be used as a run reporter", Name)
+}
+
+// New builds a new PushgatewayReporter
+func New() job.Reporter {
+	return &PushgatewayReporter{}
+}
+
+// Load returns the name and factory which are needed to register the Reporter
+func Load() (string, job.ReporterFactory) {
+	return Name, New
+}
@@ -0,0 +1,76 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package pushgateway
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunReport(t *testing.T) {
+	origGetJobRequest := getJobRequest
+	defer func() { getJobRequest = origGetJobRequest }()
+	getJobRequest = func(jobID types.JobID) (*job.Request, error) {
+		return &job.Request{JobID: jobID, JobName: "fleet/boot", Requestor: ""}, nil
+	}
+
+	var (
+		method, path, body string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, _ := ioutil.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(buf)
+	}))
+	defer srv.Close()
+
+	r := New()
+	_, err := r.ValidateFinalParameters([]byte(`{}`))
+	require.Error(t, err)
+	_, err = r.ValidateRunParameters([]byte(`{"URL": "pushgateway:9091"}`))
+	require.Error(t, err)
+	params, err := r.ValidateRunParameters([]byte(`{"URL": "` + srv.URL + `"}`))
+	require.NoError(t, err)
+
+	start := time.Unix(1000, 0)
+	runStatus := job.RunStatus{
+		RunCoordinates: job.RunCoordinates{JobID: 3, RunID: 2},
+		TestStatuses: []job.TestStatus{{
+			TestCoordinates: job.TestCoordinates{TestName: `say "hi"`},
+			TestStepStatuses: []job.TestStepStatus{{
+				TestStepCoordinates: job.TestStepCoordinates{TestStepLabel: "echo"},
+				TargetStatuses: []job.TargetStatus{
+					{InTime: start, OutTime: start.Add(2 * time.Second)},
+					{InTime: start.Add(time.Second), OutTime: start.Add(5 * time.Second)},
+				},
+			}},
+			TargetResults: []job.TargetResult{
+				{Target: &target.Target{ID: "1"}, Result: target.Result{Outcome: target.OutcomePass}},
+				{Target: &target.Target{ID: "2"}, Result: target.Result{Outcome: target.OutcomeFail}},
+			},
+		}},
+	}
+	success, _, err := r.RunReport(nil, params, &runStatus, nil)
+	require.NoError(t, err)
+	require.False(t, success)
+	require.Equal(t, http.MethodPut, method)
+	require.Equal(t, "/metrics/job@base64/Y29udGVzdA/contest_job_name@base64/ZmxlZXQvYm9vdA/requestor@base64/=", path)
+	require.Contains(t, body, "# TYPE contest_targets gauge\n")
+	require.Contains(t, body, "contest_job_id 3\n")
+	require.Contains(t, body, "contest_run_id 2\n")
+	require.Contains(t, body, `contest_targets{test="say \"hi\"",outcome="pass"} 1`+"\n")
+	require.Contains(t, body, `contest_targets{test="say \"hi\"",outcome="fail"} 1`+"\n")
+	require.Contains(t, body, `contest_targets{test="say \"hi\"",outcome="skip"} 0`+"\n")
+	require.Contains(t, body, `contest_step_duration_seconds{test="say \"hi\"",step="echo"} 5`+"\n")
+	require.Contains(t, body, `contest_step_target_duration_seconds{test="say \"hi\"",step="echo"} 3`+"\n")
+}
@@ -0,0 +1,134 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package tap implements a reporter which renders the results of a job in the
+// Test Anything Protocol, so that they can be consumed by prove and other TAP
+// harnesses. There is a test point for each target of each test.
+package tap
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/target"
+)
+
+// Name defines the name of the reporter used within the plugin registry
+var Name = "TAP"
+
+// TAPReporter implements a reporter which renders the results in TAP version
+// 13. The report is successful if all the test points are ok.
+type TAPReporter struct {
+}
+
+func validateParameters(params []byte) (interface{}, error) {
+	// no parameters, but an empty object is accepted as well
+	if len(params) > 0 {
+		var p struct{}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// ValidateRunParameters validates the parameters for the run reporter
+func (r *TAPReporter) ValidateRunParameters(params []byte) (interface{}, error) {
+	return validateParameters(params)
+}
+
+// ValidateFinalParameters validates the parameters for the final reporter
+func (r *TAPReporter) ValidateFinalParameters(params []byte) (interface{}, error) {
+	return validateParameters(params)
+}
+
+// Name returns the Name of the reporter
+func (r *TAPReporter) Name() string {
+	return Name
+}
+
+// escape makes a string safe for a test point description or directive, in
+// which '#' starts a directive and newlines end the test point.
+func escape(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "#", "\\#", -1)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// testPoint renders the line of a target in a test.
+func testPoint(num int, description string, result target.Result) (string, bool) {
+	var detail string
+	if result.Step != "" {
+		detail = fmt.Sprintf("step %s: %s", result.Step, result.Message)
+	} else {
+		detail = result.Message
+	}
+	switch result.Outcome {
+	case target.OutcomePass:
+		return fmt.Sprintf("ok %d - %s", num, description), true
+	case target.OutcomeSkip:
+		return fmt.Sprintf("ok %d - %s # SKIP %s", num, description, escape(detail)), true
+	default:
+		return fmt.Sprintf("not ok %d - %s # %s: %s", num, description, strings.ToLower(string(result.Outcome)), escape(detail)), false
+	}
+}
+
+// render builds the TAP document out of the given run statuses. The run
+// number is only added to the descriptions when there is more than one run.
+func render(runStatuses []job.RunStatus) (bool, string) {
+	var (
+		lines   []string
+		success = true
+	)
+	for _, runStatus := range runStatuses {
+		for _, testStatus := range runStatus.TestStatuses {
+			for _, result := range testStatus.TargetResults {
+				name := result.Target.ID
+				if name == "" {
+					name = result.Target.Name
+				}
+				description := escape(fmt.Sprintf("%s: %s", testStatus.TestName, name))
+				if len(runStatuses) > 1 {
+					description = fmt.Sprintf("run %d: %s", runStatus.RunID, description)
+				}
+				line, ok := testPoint(len(lines)+1, description, result.Result)
+				success = success && ok
+				lines = append(lines, line)
+			}
+		}
+	}
+	var b strings.Builder
+	b.WriteString("TAP version 13\n")
+	fmt.Fprintf(&b, "1..%d\n", len(lines))
+	for _, line := range lines {
+		b.WriteString(line + "\n")
+	}
+	return success, b.String()
+}
+
+// RunReport renders the results of a run.
+func (r *TAPReporter) RunReport(cancel <-chan struct{}, parameters interface{}, runStatus *job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
+	success, doc := render([]job.RunStatus{*runStatus})
+	return success, doc, nil
+}
+
+// FinalReport renders the results of all the runs.
+func (r *TAPReporter) FinalReport(cancel <-chan struct{}, parameters interface{}, runStatuses []job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
+	success, doc := render(runStatuses)
+	return success, doc, nil
+}
+
+// New builds a new TAPReporter
+func New() job.Reporter {
+	return &TAPReporter{}
+}
+
+// Load returns the name and factory which are needed to register the Reporter
+func Load() (string, job.ReporterFactory) {
+	return Name, New
+}
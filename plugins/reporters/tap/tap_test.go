@@ -0,0 +1,48 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package tap
+
+import (
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport(t *testing.T) {
+	testStatus := job.TestStatus{
+		TestCoordinates: job.TestCoordinates{TestName: "boot"},
+		TargetResults: []job.TargetResult{
+			{Target: &target.Target{ID: "id1"}, Result: target.Result{Outcome: target.OutcomePass}},
+			{Target: &target.Target{Name: "host002"}, Result: target.Result{Outcome: target.OutcomeFail, Message: "exit #1\nstderr", Step: "power_on"}},
+			{Target: &target.Target{ID: "id3"}, Result: target.Result{Outcome: target.OutcomeSkip, Message: "not applicable"}},
+			{Target: &target.Target{ID: "id4"}, Result: target.Result{Outcome: target.OutcomeError, Message: "timed out"}},
+		},
+	}
+	r := New()
+	params, err := r.ValidateRunParameters([]byte(`{}`))
+	require.NoError(t, err)
+	success, data, err := r.RunReport(nil, params, &job.RunStatus{TestStatuses: []job.TestStatus{testStatus}}, nil)
+	require.NoError(t, err)
+	require.False(t, success)
+	require.Equal(t, `TAP version 13
+1..4
+ok 1 - boot: id1
+not ok 2 - boot: host002 # fail: step power_on: exit \#1 stderr
+ok 3 - boot: id3 # SKIP not applicable
+not ok 4 - boot: id4 # error: timed out
+`, data)
+
+	testStatus.TargetResults = testStatus.TargetResults[:1]
+	success, data, err = r.FinalReport(nil, params, []job.RunStatus{
+		{RunCoordinates: job.RunCoordinates{RunID: 1}, TestStatuses: []job.TestStatus{testStatus}},
+		{RunCoordinates: job.RunCoordinates{RunID: 2}, TestStatuses: []job.TestStatus{testStatus}},
+	}, nil)
+	require.NoError(t, err)
+	require.True(t, success)
+	require.Equal(t, "TAP version 13\n1..2\nok 1 - run 1: boot: id1\nok 2 - run 2: boot: id1\n", data)
+}
@@ -0,0 +1,269 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package targetsuccess
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/lib/comparison"
+)
+
+// testStats are the metrics of a test that criteria are evaluated against.
+type testStats struct {
+	success, fail, skip uint64
+	duration            time.Duration
+	stepAvgDuration     time.Duration
+}
+
+func newTestStats(t job.TestStatus) testStats {
+	var (
+		s          testStats
+		start, end time.Time
+	)
+	for _, ts := range t.TargetStatuses {
+		if ts.Skipped {
+			s.skip++
+		} else if ts.Error != "" {
+			s.fail++
+		} else {
+			s.success++
+		}
+	}
+	for _, step := range t.TestStepStatuses {
+		var (
+			total     time.Duration
+			completed int64
+		)
+		for _, ts := range step.TargetStatuses {
+			if ts.InTime.IsZero() || ts.OutTime.IsZero() {
+				continue
+			}
+			if start.IsZero() || ts.InTime.Before(start) {
+				start = ts.InTime
+			}
+			if ts.OutTime.After(end) {
+				end = ts.OutTime
+			}
+			total += ts.OutTime.Sub(ts.InTime)
+			completed++
+		}
+		if completed > 0 {
+			if avg := total / time.Duration(completed); avg > s.stepAvgDuration {
+				s.stepAvgDuration = avg
+			}
+		}
+	}
+	s.duration = end.Sub(start)
+	return s
+}
+
+// criterion is a node of the criteria tree.
+type criterion interface {
+	evaluate(s testStats) (bool, string, error)
+}
+
+type andCriterion []criterion
+
+func (c andCriterion) evaluate(s testStats) (bool, string, error) {
+	pass := true
+	var exprs []string
+	for _, sub := range c {
+		p, expr, err := sub.evaluate(s)
+		if err != nil {
+			return false, "", err
+		}
+		pass = pass && p
+		exprs = append(exprs, expr)
+	}
+	return pass, "(" + strings.Join(exprs, " AND ") + ")", nil
+}
+
+type orCriterion []criterion
+
+func (c orCriterion) evaluate(s testStats) (bool, string, error) {
+	pass := false
+	var exprs []string
+	for _, sub := range c {
+		p, expr, err := sub.evaluate(s)
+		if err != nil {
+			return false, "", err
+		}
+		pass = pass || p
+		exprs = append(exprs, expr)
+	}
+	return pass, "(" + strings.Join(exprs, " OR ") + ")", nil
+}
+
+// countCriterion compares a number of targets, either absolute or relative.
+type countCriterion struct {
+	metric string
+	expr   *comparison.Expression
+}
+
+func (c countCriterion) evaluate(s testStats) (bool, string, error) {
+	count := s.success
+	if c.metric == "failures" {
+		count = s.fail
+	}
+	res, err := c.expr.EvaluateSuccess(count, s.success+s.fail)
+	if err != nil {
+		return false, "", fmt.Errorf("cannot evaluate %s: %v", c.metric, err)
+	}
+	return res.Pass, fmt.Sprintf("%s: %s", c.metric, res.Expr), nil
+}
+
+// durationCriterion compares a duration.
+type durationCriterion struct {
+	metric string
+	cmp    comparison.Comparator
+	rhs    time.Duration
+}
+
+func (c durationCriterion) evaluate(s testStats) (bool, string, error) {
+	lhs := s.duration
+	if c.metric == "step_avg_duration" {
+		lhs = s.stepAvgDuration
+	}
+	if c.cmp.Compare(float64(lhs), float64(c.rhs)) {
+		return true, fmt.Sprintf("%s: %v %s %v", c.metric, lhs, c.cmp.Operator(), c.rhs), nil
+	}
+	return false, fmt.Sprintf("%s: %v is not %s %v", c.metric, lhs, c.cmp.Operator(), c.rhs), nil
+}
+
+var tokenRegexp = regexp.MustCompile(`\(|\)|&&|\|\||>=|<=|=|<|>|[^\s()<>=&|]+`)
+
+// criteriaParser is a recursive descent parser for criteria.
+type criteriaParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *criteriaParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *criteriaParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+func (p *criteriaParser) parseOr() (criterion, error) {
+	var or orCriterion
+	for {
+		c, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, c)
+		if tok := p.peek(); !strings.EqualFold(tok, "OR") && tok != "||" {
+			break
+		}
+		p.next()
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *criteriaParser) parseAnd() (criterion, error) {
+	var and andCriterion
+	for {
+		c, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, c)
+		if tok := p.peek(); !strings.EqualFold(tok, "AND") && tok != "&&" {
+			break
+		}
+		p.next()
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+func (p *criteriaParser) parseFactor() (criterion, error) {
+	if p.peek() == "(" {
+		p.next()
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok != ")" {
+			return nil, fmt.Errorf("expected ')', got '%s'", tok)
+		}
+		return c, nil
+	}
+	metric, op, value := p.next(), p.next(), p.next()
+	if value == "" {
+		return nil, fmt.Errorf("incomplete condition '%s %s'", metric, op)
+	}
+	switch comparison.Operator(op) {
+	case comparison.ExprGt, comparison.ExprLt, comparison.ExprGe, comparison.ExprLe, comparison.ExprEq:
+	default:
+		return nil, fmt.Errorf("expected comparison operator after '%s', got '%s'", metric, op)
+	}
+	switch metric {
+	case "success", "failures":
+		expr, err := comparison.ParseExpression(op + value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition on %s: %v", metric, err)
+		}
+		return countCriterion{metric: metric, expr: expr}, nil
+	case "duration", "step_avg_duration":
+		// reuse the comparison parser for the operator only
+		expr, err := comparison.ParseExpression(op + "0")
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition on %s: %v", metric, err)
+		}
+		rhs, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition on %s: %v", metric, err)
+		}
+		return durationCriterion{metric: metric, cmp: expr.Cmp, rhs: rhs}, nil
+	default:
+		return nil, fmt.Errorf("unknown metric '%s'", metric)
+	}
+}
+
+// parseCriteria parses criteria, which combine conditions on the results of a
+// test with AND and OR, e.g.
+//
+//	success >= 95% AND step_avg_duration <= 10m
+//
+// AND binds tighter than OR, and parentheses can be used for grouping. The
+// metric "success" is the number, or percentage, of targets which succeeded,
+// skipped targets excluded, and "failures" is the number, or percentage, of
+// targets which failed. The metric "duration" is the time from the first
+// target entering the test to the last one leaving it, and
+// "step_avg_duration" is the longest average time spent by a target in a
+// step, i.e. the condition must hold for every step. Durations are specified
+// in the format accepted by time.ParseDuration.
+func parseCriteria(s string) (criterion, error) {
+	p := criteriaParser{tokens: tokenRegexp.FindAllString(s, -1)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty criteria")
+	}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s' in criteria", p.tokens[p.pos])
+	}
+	return c, nil
+}
@@ -0,0 +1,82 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package targetsuccess
+
+import (
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCriteria(t *testing.T) {
+	for _, s := range []string{
+		"success >= 95%",
+		"success>=95% AND step_avg_duration<=10m",
+		"(success = 100% || failures < 2) && duration < 1h",
+		"success > 90% and (step_avg_duration < 5m or duration < 20m)",
+	} {
+		_, err := parseCriteria(s)
+		require.NoError(t, err, s)
+	}
+	for _, s := range []string{
+		"",
+		"success",
+		"success 95%",
+		"successes >= 95%",
+		"step_avg_duration <= 10 minutes",
+		"(success >= 95%",
+		"success >= 95% AND",
+		"success >= 95% failures < 1",
+	} {
+		_, err := parseCriteria(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestEvaluateCriteria(t *testing.T) {
+	stats := testStats{success: 19, fail: 1, duration: 30 * time.Minute, stepAvgDuration: 12 * time.Minute}
+	for s, want := range map[string]bool{
+		"success >= 95%": true,
+		"success >= 96%": false,
+		"failures = 0":   false,
+		"success >= 95% AND step_avg_duration <= 10m":        false,
+		"success >= 95% AND step_avg_duration <= 15m":        true,
+		"failures = 0 OR duration < 1h":                      true,
+		"failures = 0 OR success >= 95% AND duration < 10m":  false,
+		"(failures = 0 OR success >= 95%) AND duration < 1h": true,
+	} {
+		c, err := parseCriteria(s)
+		require.NoError(t, err, s)
+		pass, _, err := c.evaluate(stats)
+		require.NoError(t, err, s)
+		require.Equal(t, want, pass, s)
+	}
+}
+
+func TestRunReportCriteria(t *testing.T) {
+	r := New()
+	_, err := r.ValidateRunParameters([]byte(`{"SuccessExpression": ">=90%", "Criteria": "success >= 90%"}`))
+	require.Error(t, err)
+	params, err := r.ValidateRunParameters([]byte(`{"Criteria": "success >= 50% AND step_avg_duration <= 10m"}`))
+	require.NoError(t, err)
+
+	start := time.Now()
+	statuses := []job.TargetStatus{
+		{InTime: start, OutTime: start.Add(5 * time.Minute)},
+		{InTime: start, OutTime: start.Add(20 * time.Minute), Error: "timed out"},
+	}
+	runStatus := job.RunStatus{TestStatuses: []job.TestStatus{{
+		TestCoordinates:  job.TestCoordinates{TestName: "boot"},
+		TestStepStatuses: []job.TestStepStatus{{TargetStatuses: statuses}},
+		TargetStatuses:   statuses,
+	}}}
+	success, data, err := r.RunReport(nil, params, &runStatus, nil)
+	require.NoError(t, err)
+	require.False(t, success)
+	require.Equal(t, []string{"Test boot does not pass success criteria: (success: 50.00% >= 50.00% AND step_avg_duration: 12m30s is not <= 10m0s)"}, data)
+}
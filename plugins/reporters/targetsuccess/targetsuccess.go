@@ -21,6 +21,10 @@ var Name = "TargetSuccess"
 // elaborate the results of the Job
 type RunParameters struct {
 	SuccessExpression string
+	// Criteria, if set, replace SuccessExpression with conditions combined
+	// with AND and OR, e.g. "success >= 95% AND step_avg_duration <= 10m".
+	// See parseCriteria for the syntax.
+	Criteria string
 }
 
 // FinalParameters contains the parameters necessary for the final reporter to
@@ -42,12 +46,59 @@ type TargetSuccessReport struct {
 	DesiredSuccess  string
 }
 
+// runParametersSchema and finalParametersSchema are the JSON schemas of the
+// run and final parameters. The fields are not required, as they are decoded
+// case-insensitively.
+var (
+	runParametersSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"SuccessExpression": {
+			"description": "The comparison the ratio of successful targets must satisfy, e.g. >=80%",
+			"type": "string"
+		},
+		"Criteria": {
+			"description": "Conditions combined with AND and OR, replacing SuccessExpression, e.g. success >= 95% AND step_avg_duration <= 10m",
+			"type": "string"
+		}
+	}
+}`)
+	finalParametersSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"AverageSuccessExpression": {
+			"description": "The comparison the average ratio of successful targets across runs must satisfy",
+			"type": "string"
+		}
+	}
+}`)
+)
+
+// RunParametersSchema returns the JSON schema of the run parameters.
+func (ts *TargetSuccessReporter) RunParametersSchema() json.RawMessage {
+	return runParametersSchema
+}
+
+// FinalParametersSchema returns the JSON schema of the final parameters.
+func (ts *TargetSuccessReporter) FinalParametersSchema() json.RawMessage {
+	return finalParametersSchema
+}
+
 // ValidateRunParameters validates the parameters for the run reporter
 func (ts *TargetSuccessReporter) ValidateRunParameters(params []byte) (interface{}, error) {
 	var rp RunParameters
 	if err := json.Unmarshal(params, &rp); err != nil {
 		return nil, err
 	}
+	if rp.Criteria != "" {
+		if rp.SuccessExpression != "" {
+			return nil, fmt.Errorf("success expression and criteria cannot be both specified")
+		}
+		if _, err := parseCriteria(rp.Criteria); err != nil {
+			return nil, fmt.Errorf("could not parse criteria: %v", err)
+		}
+		return rp, nil
+	}
 	if _, err := comparison.ParseExpression(rp.SuccessExpression); err != nil {
 		return nil, fmt.Errorf("could not parse success expression")
 	}
@@ -75,8 +126,8 @@ func (ts *TargetSuccessReporter) Name() string {
 func (ts *TargetSuccessReporter) RunReport(cancel <-chan struct{}, parameters interface{}, runStatus *job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
 
 	var (
-		success, fail uint64
-		testReports   []string
+		success, fail, skip uint64
+		testReports         []string
 	)
 
 	runSuccess := true
@@ -90,9 +141,12 @@ func (ts *TargetSuccessReporter) RunReport(cancel <-chan struct{}, parameters in
 	for _, t := range runStatus.TestStatuses {
 		fail = 0
 		success = 0
+		skip = 0
 
 		for _, t := range t.TargetStatuses {
-			if t.Error != "" {
+			if t.Skipped {
+				skip++
+			} else if t.Error != "" {
 				fail++
 			} else {
 				success++
@@ -101,22 +155,50 @@ func (ts *TargetSuccessReporter) RunReport(cancel <-chan struct{}, parameters in
 		}
 
 		if success+fail == 0 {
+			if skip > 0 {
+				// skipped targets are not failures, so a test where all targets
+				// were skipped does not fail the run.
+				testReports = append(testReports, fmt.Sprintf("Test %s skipped all %d targets", t.TestCoordinates.TestName, skip))
+				continue
+			}
 			return false, nil, fmt.Errorf("overall count of success and failures is zero for test %s", t.TestCoordinates.TestName)
 		}
-		cmpExpr, err := comparison.ParseExpression(reportParameters.SuccessExpression)
-		if err != nil {
-			return false, nil, fmt.Errorf("error while calculating run report for test %s: %v", t.TestCoordinates.TestName, err)
-		}
-		res, err := cmpExpr.EvaluateSuccess(success, success+fail)
-		if err != nil {
-			return false, nil, fmt.Errorf("error while calculating run report for test %s: %v", t.TestCoordinates.TestName, err)
+		var (
+			pass bool
+			expr string
+		)
+		if reportParameters.Criteria != "" {
+			criteria, err := parseCriteria(reportParameters.Criteria)
+			if err != nil {
+				return false, nil, fmt.Errorf("error while calculating run report for test %s: %v", t.TestCoordinates.TestName, err)
+			}
+			pass, expr, err = criteria.evaluate(newTestStats(t))
+			if err != nil {
+				return false, nil, fmt.Errorf("error while calculating run report for test %s: %v", t.TestCoordinates.TestName, err)
+			}
+		} else {
+			cmpExpr, err := comparison.ParseExpression(reportParameters.SuccessExpression)
+			if err != nil {
+				return false, nil, fmt.Errorf("error while calculating run report for test %s: %v", t.TestCoordinates.TestName, err)
+			}
+			res, err := cmpExpr.EvaluateSuccess(success, success+fail)
+			if err != nil {
+				return false, nil, fmt.Errorf("error while calculating run report for test %s: %v", t.TestCoordinates.TestName, err)
+			}
+			pass, expr = res.Pass, res.Expr
 		}
 
-		if !res.Pass {
-			testReports = append(testReports, fmt.Sprintf("Test %s does not pass success criteria: %s", t.TestCoordinates.TestName, res.Expr))
+		// skipped targets are counted separately, and are not part of the
+		// success ratio.
+		var skipped string
+		if skip > 0 {
+			skipped = fmt.Sprintf(" (%d targets skipped)", skip)
+		}
+		if !pass {
+			testReports = append(testReports, fmt.Sprintf("Test %s does not pass success criteria: %s%s", t.TestCoordinates.TestName, expr, skipped))
 			runSuccess = false
 		} else {
-			testReports = append(testReports, fmt.Sprintf("Test %s passes success criteria: %s", t.TestCoordinates.TestName, res.Expr))
+			testReports = append(testReports, fmt.Sprintf("Test %s passes success criteria: %s%s", t.TestCoordinates.TestName, expr, skipped))
 		}
 	}
 
@@ -0,0 +1,255 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package webhook implements a reporter which posts a summary of the job runs
+// to a Slack incoming webhook, or to a generic webhook. The message is
+// rendered from a Go template, which receives a Summary.
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/insomniacslk/xjson"
+)
+
+// Name defines the name of the reporter used within the plugin registry
+var (
+	Name = "Webhook"
+	log  = logging.GetLogger("reporters/" + strings.ToLower(Name))
+)
+
+// Supported kinds of webhooks
+const (
+	// KindSlack posts a Slack message, i.e. a JSON object with the rendered
+	// message in the "text" field.
+	KindSlack = "slack"
+	// KindGeneric posts the Summary as JSON, with the rendered message in
+	// the Text field.
+	KindGeneric = "generic"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// DefaultTemplate is used when no template is specified in the parameters.
+const DefaultTemplate = `ConTest job {{ .JobID }}{{ if .RunID }} run {{ .RunID }}{{ end }}: {{ .Verdict }}
+{{ range .Tests }}• {{ if gt $.Runs 1 }}run {{ .RunID }} {{ end }}{{ .Name }}: {{ printf "%.1f" .SuccessPercentage }}% ({{ .Passed }} passed, {{ .Failed }} failed, {{ .Skipped }} skipped)
+{{ end }}`
+
+// Parameters contains the parameters of both the run and the final reporter.
+type Parameters struct {
+	// URL is the webhook the summary is posted to.
+	URL string
+	// Kind is either "slack" (the default) or "generic".
+	Kind string
+	// Template is the Go template of the message. If empty, DefaultTemplate
+	// is used.
+	Template string
+	// Timeout is the maximum time to post the summary. If zero, 30 seconds
+	// are allowed.
+	Timeout xjson.Duration
+}
+
+// config is the validated form of Parameters.
+type config struct {
+	Parameters
+	tmpl *template.Template
+}
+
+// TestSummary is the summary of a test within a run. SuccessPercentage is
+// the percentage of passed targets among the targets which were not
+// skipped.
+type TestSummary struct {
+	RunID             types.RunID
+	Name              string
+	Passed            int
+	Failed            int
+	Skipped           int
+	SuccessPercentage float64
+}
+
+// Summary is passed to the template, and posted to generic webhooks. RunID
+// is zero for the final report.
+type Summary struct {
+	JobID   types.JobID
+	RunID   types.RunID `json:",omitempty"`
+	Runs    int
+	Success bool
+	Verdict string
+	Tests   []TestSummary
+	Text    string
+}
+
+// WebhookReporter implements a reporter which posts the results of the runs
+// to a webhook. The report is successful if no target failed.
+type WebhookReporter struct {
+}
+
+func validateParameters(params []byte) (interface{}, error) {
+	var p Parameters
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("webhook URL must be http or https, got '%s'", p.URL)
+	}
+	switch p.Kind {
+	case "":
+		p.Kind = KindSlack
+	case KindSlack, KindGeneric:
+	default:
+		return nil, fmt.Errorf("unknown webhook kind '%s'", p.Kind)
+	}
+	if p.Template == "" {
+		p.Template = DefaultTemplate
+	}
+	tmpl, err := template.New(Name).Option("missingkey=error").Parse(p.Template)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+	if p.Timeout < 0 {
+		return nil, fmt.Errorf("timeout cannot be negative")
+	}
+	return config{Parameters: p, tmpl: tmpl}, nil
+}
+
+// ValidateRunParameters validates the parameters for the run reporter
+func (r *WebhookReporter) ValidateRunParameters(params []byte) (interface{}, error) {
+	return validateParameters(params)
+}
+
+// ValidateFinalParameters validates the parameters for the final reporter
+func (r *WebhookReporter) ValidateFinalParameters(params []byte) (interface{}, error) {
+	return validateParameters(params)
+}
+
+// Name returns the Name of the reporter
+func (r *WebhookReporter) Name() string {
+	return Name
+}
+
+// summarize builds the summary of the given runs.
+func summarize(runStatuses []job.RunStatus) Summary {
+	s := Summary{Runs: len(runStatuses), Success: true}
+	for _, runStatus := range runStatuses {
+		s.JobID = runStatus.JobID
+		for _, testStatus := range runStatus.TestStatuses {
+			ts := TestSummary{RunID: runStatus.RunID, Name: testStatus.TestName}
+			for _, result := range testStatus.TargetResults {
+				switch result.Outcome {
+				case target.OutcomePass:
+					ts.Passed++
+				case target.OutcomeSkip:
+					ts.Skipped++
+				default:
+					ts.Failed++
+				}
+			}
+			if ts.Passed+ts.Failed > 0 {
+				ts.SuccessPercentage = 100 * float64(ts.Passed) / float64(ts.Passed+ts.Failed)
+			} else {
+				ts.SuccessPercentage = 100
+			}
+			if ts.Failed > 0 {
+				s.Success = false
+			}
+			s.Tests = append(s.Tests, ts)
+		}
+	}
+	if s.Success {
+		s.Verdict = "PASS"
+	} else {
+		s.Verdict = "FAIL"
+	}
+	return s
+}
+
+// post renders the message and posts it to the webhook.
+func post(cfg config, s Summary) error {
+	var text bytes.Buffer
+	if err := cfg.tmpl.Execute(&text, s); err != nil {
+		return fmt.Errorf("cannot render message: %v", err)
+	}
+	s.Text = text.String()
+
+	var payload interface{} = s
+	if cfg.Kind == KindSlack {
+		payload = map[string]string{"text": s.Text}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("cannot encode payload: %v", err)
+	}
+	timeout := time.Duration(cfg.Timeout)
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	client := http.Client{Timeout: timeout}
+	resp, err := client.Post(cfg.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot post to webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// RunReport posts the summary of a run.
+func (r *WebhookReporter) RunReport(cancel <-chan struct{}, parameters interface{}, runStatus *job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
+	cfg, ok := parameters.(config)
+	if !ok {
+		return false, nil, fmt.Errorf("report parameters should be of type webhook.Parameters")
+	}
+	s := summarize([]job.RunStatus{*runStatus})
+	s.RunID = runStatus.RunID
+	if err := post(cfg, s); err != nil {
+		return s.Success, nil, err
+	}
+	log.Debugf("Posted summary of run %d of job %d", s.RunID, s.JobID)
+	return s.Success, s.Tests, nil
+}
+
+// FinalReport posts the summary of all the runs.
+func (r *WebhookReporter) FinalReport(cancel <-chan struct{}, parameters interface{}, runStatuses []job.RunStatus, ev testevent.Fetcher) (bool, interface{}, error) {
+	cfg, ok := parameters.(config)
+	if !ok {
+		return false, nil, fmt.Errorf("report parameters should be of type webhook.Parameters")
+	}
+	s := summarize(runStatuses)
+	if err := post(cfg, s); err != nil {
+		return s.Success, nil, err
+	}
+	log.Debugf("Posted final summary of job %d", s.JobID)
+	return s.Success, s.Tests, nil
+}
+
+// New builds a new WebhookReporter
+func New() job.Reporter {
+	return &WebhookReporter{}
+}
+
+// Load returns the name and factory which are needed to register the Reporter
+func Load() (string, job.ReporterFactory) {
+	return Name, New
+}
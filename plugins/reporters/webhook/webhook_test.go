@@ -0,0 +1,108 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package webhook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func runStatus(runID types.RunID, outcomes ...target.Outcome) job.RunStatus {
+	var results []job.TargetResult
+	for _, o := range outcomes {
+		results = append(results, job.TargetResult{Target: &target.Target{ID: "t"}, Result: target.Result{Outcome: o}})
+	}
+	rs := job.RunStatus{TestStatuses: []job.TestStatus{{
+		TestCoordinates: job.TestCoordinates{TestName: "boot"},
+		TargetResults:   results,
+	}}}
+	rs.JobID = 7
+	rs.RunID = runID
+	return rs
+}
+
+func server(t *testing.T, payloads *[]map[string]interface{}) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		*payloads = append(*payloads, p)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestValidateParameters(t *testing.T) {
+	r := New()
+	for _, params := range []string{
+		`{"URL": "ftp://example.com"}`,
+		`{"URL": "https://example.com", "Kind": "irc"}`,
+		`{"URL": "https://example.com", "Template": "{{ .JobID "}`,
+	} {
+		_, err := r.ValidateRunParameters([]byte(params))
+		require.Error(t, err, params)
+	}
+	_, err := r.ValidateFinalParameters([]byte(`{"URL": "https://hooks.slack.com/services/x"}`))
+	require.NoError(t, err)
+}
+
+func TestSlackRunReport(t *testing.T) {
+	var payloads []map[string]interface{}
+	srv := server(t, &payloads)
+	r := New()
+	params, err := r.ValidateRunParameters([]byte(`{"URL": "` + srv.URL + `"}`))
+	require.NoError(t, err)
+
+	rs := runStatus(1, target.OutcomePass, target.OutcomePass, target.OutcomeFail, target.OutcomeSkip)
+	success, _, err := r.RunReport(nil, params, &rs, nil)
+	require.NoError(t, err)
+	require.False(t, success)
+	require.Len(t, payloads, 1)
+	require.Equal(t, "ConTest job 7 run 1: FAIL\n• boot: 66.7% (2 passed, 1 failed, 1 skipped)\n", payloads[0]["text"])
+}
+
+func TestGenericFinalReport(t *testing.T) {
+	var payloads []map[string]interface{}
+	srv := server(t, &payloads)
+	r := New()
+	params, err := r.ValidateFinalParameters([]byte(`{"URL": "` + srv.URL + `", "Kind": "generic", "Template": "{{ .Verdict }} after {{ .Runs }} runs"}`))
+	require.NoError(t, err)
+
+	success, data, err := r.FinalReport(nil, params, []job.RunStatus{
+		runStatus(1, target.OutcomePass),
+		runStatus(2, target.OutcomePass, target.OutcomeSkip),
+	}, nil)
+	require.NoError(t, err)
+	require.True(t, success)
+	require.Len(t, data, 2)
+	require.Len(t, payloads, 1)
+	require.Equal(t, "PASS after 2 runs", payloads[0]["Text"])
+	require.Equal(t, "PASS", payloads[0]["Verdict"])
+	require.Len(t, payloads[0]["Tests"], 2)
+}
+
+func TestReportWebhookError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer srv.Close()
+	r := New()
+	params, err := r.ValidateRunParameters([]byte(`{"URL": "` + srv.URL + `"}`))
+	require.NoError(t, err)
+	rs := runStatus(1, target.OutcomePass)
+	_, _, err = r.RunReport(nil, params, &rs, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid_token")
+}
@@ -0,0 +1,262 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package otlp implements a span exporter which sends the spans of the jobs
+// to an OpenTelemetry collector, or any backend accepting the OpenTelemetry
+// protocol (OTLP) over HTTP, in its JSON encoding, so that ConTest does not
+// depend on the OpenTelemetry SDK.
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/tracing"
+)
+
+var log = logging.GetLogger("spanexporters/otlp")
+
+// metrics are published via expvar, as "contest_otlp_exporter". Counters
+// are exported, dropped and failed spans.
+var metrics = expvar.NewMap("contest_otlp_exporter")
+
+const (
+	// DefaultQueueSize is the default number of spans waiting to be exported.
+	DefaultQueueSize = 10000
+	// DefaultServiceName is the default name of the service of the spans.
+	DefaultServiceName = "contest"
+	// TracesPath is the path of the traces endpoint of OTLP over HTTP.
+	TracesPath = "/v1/traces"
+	// maxBatchSize is the maximum number of spans exported at once.
+	maxBatchSize = 512
+	// defaultTimeout is the maximum time to export a batch of spans.
+	defaultTimeout = 30 * time.Second
+)
+
+// status codes of OTLP spans
+const (
+	statusCodeUnset = 0
+	statusCodeError = 2
+)
+
+// spanKindInternal is the kind of the spans, which trace internal operations.
+const spanKindInternal = 1
+
+// Config configures the exporter.
+type Config struct {
+	// Endpoint is the base URL of the collector, e.g. http://collector:4318,
+	// to which spans are posted at TracesPath.
+	Endpoint string
+	// ServiceName is the service.name attribute of the resource of the
+	// spans. If empty, DefaultServiceName is used.
+	ServiceName string
+	// QueueSize is the number of spans waiting to be exported, beyond which
+	// spans are dropped. If zero, DefaultQueueSize is used.
+	QueueSize int
+}
+
+// Exporter implements tracing.Exporter. Spans are exported in the background
+// by Run.
+type Exporter struct {
+	url         string
+	serviceName string
+	client      *http.Client
+	queue       chan tracing.SpanData
+}
+
+// New returns an Exporter posting spans to a collector.
+func New(config Config) (*Exporter, error) {
+	u, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint '%s': %v", config.Endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid OTLP endpoint '%s': scheme must be http or https", config.Endpoint)
+	}
+	if config.QueueSize < 0 {
+		return nil, fmt.Errorf("queue size cannot be negative, got %d", config.QueueSize)
+	}
+	if config.QueueSize == 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if config.ServiceName == "" {
+		config.ServiceName = DefaultServiceName
+	}
+	return &Exporter{
+		url:         strings.TrimSuffix(config.Endpoint, "/") + TracesPath,
+		serviceName: config.ServiceName,
+		client:      &http.Client{Timeout: defaultTimeout},
+		queue:       make(chan tracing.SpanData, config.QueueSize),
+	}, nil
+}
+
+// ExportSpan queues a span to be exported, or drops it if the queue is full.
+func (e *Exporter) ExportSpan(span tracing.SpanData) {
+	select {
+	case e.queue <- span:
+	default:
+		metrics.Add("dropped", 1)
+	}
+}
+
+// Run exports the queued spans until the stop channel is closed. Spans are
+// exported in batches of what is queued at once; failed batches are logged
+// and dropped.
+func (e *Exporter) Run(stop <-chan struct{}) {
+	for {
+		var first tracing.SpanData
+		select {
+		case <-stop:
+			return
+		case first = <-e.queue:
+		}
+		batch := []tracing.SpanData{first}
+	drain:
+		for len(batch) < maxBatchSize {
+			select {
+			case s := <-e.queue:
+				batch = append(batch, s)
+			default:
+				break drain
+			}
+		}
+		if err := e.export(batch); err != nil {
+			log.Warningf("could not export %d spans to %s: %v", len(batch), e.url, err)
+			metrics.Add("failed", int64(len(batch)))
+			continue
+		}
+		metrics.Add("exported", int64(len(batch)))
+	}
+}
+
+// The JSON encoding of the OTLP ExportTraceServiceRequest. IDs are hex
+// encoded, and times are nanoseconds since the epoch, as strings.
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type scopeSpans struct {
+	Scope scope  `json:"scope"`
+	Spans []span `json:"spans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+func toKeyValue(attr tracing.Attribute) keyValue {
+	kv := keyValue{Key: attr.Key}
+	switch v := attr.Value.(type) {
+	case bool:
+		kv.Value.BoolValue = &v
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		kv.Value.IntValue = &s
+	case float64:
+		kv.Value.DoubleValue = &v
+	default:
+		s := fmt.Sprint(v)
+		kv.Value.StringValue = &s
+	}
+	return kv
+}
+
+func toSpan(s tracing.SpanData) span {
+	otlpSpan := span{
+		TraceID:           s.TraceID.String(),
+		SpanID:            s.SpanID.String(),
+		Name:              s.Name,
+		Kind:              spanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		Status:            status{Code: statusCodeUnset},
+	}
+	if s.ParentSpanID.IsValid() {
+		otlpSpan.ParentSpanID = s.ParentSpanID.String()
+	}
+	for _, attr := range s.Attributes {
+		otlpSpan.Attributes = append(otlpSpan.Attributes, toKeyValue(attr))
+	}
+	if s.Err != "" {
+		otlpSpan.Status = status{Code: statusCodeError, Message: s.Err}
+	}
+	return otlpSpan
+}
+
+// export posts a batch of spans to the collector.
+func (e *Exporter) export(batch []tracing.SpanData) error {
+	spans := make([]span, 0, len(batch))
+	for _, s := range batch {
+		spans = append(spans, toSpan(s))
+	}
+	req := exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: []keyValue{toKeyValue(tracing.Attr("service.name", e.serviceName))}},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: "github.com/facebookincubator/contest"}, Spans: spans}},
+	}}}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("could not encode spans: %v", err)
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("collector returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package otlp
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/tracing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	for _, endpoint := range []string{"", "collector:4318", "ftp://collector"} {
+		_, err := New(Config{Endpoint: endpoint})
+		require.Error(t, err, endpoint)
+	}
+	_, err := New(Config{Endpoint: "http://collector:4318", QueueSize: -1})
+	require.Error(t, err)
+}
+
+func TestExport(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []map[string]interface{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, TracesPath, r.URL.Path)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		var req map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &req))
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, req)
+	}))
+	defer srv.Close()
+
+	e, err := New(Config{Endpoint: srv.URL + "/", ServiceName: "contest-test"})
+	require.NoError(t, err)
+	tracing.SetExporter(e)
+	defer tracing.SetExporter(nil)
+	job := tracing.Start(nil, "job", tracing.Attr("job.id", 42), tracing.Attr("job.name", "test"))
+	step := tracing.Start(job, "step", tracing.Attr("step.cancelled", true))
+	step.End(errors.New("step failed"))
+	job.End(nil)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go e.Run(stop)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(requests) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	rs := requests[0]["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	require.Equal(t, []interface{}{map[string]interface{}{"key": "service.name", "value": map[string]interface{}{"stringValue": "contest-test"}}},
+		rs["resource"].(map[string]interface{})["attributes"])
+	spans := rs["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	require.Len(t, spans, 2)
+	stepSpan, jobSpan := spans[0].(map[string]interface{}), spans[1].(map[string]interface{})
+	require.Equal(t, "step", stepSpan["name"])
+	require.Equal(t, jobSpan["spanId"], stepSpan["parentSpanId"])
+	require.Equal(t, jobSpan["traceId"], stepSpan["traceId"])
+	require.Len(t, jobSpan["traceId"], 32)
+	require.NotContains(t, jobSpan, "parentSpanId")
+	require.Equal(t, map[string]interface{}{"code": float64(statusCodeError), "message": "step failed"}, stepSpan["status"])
+	require.Equal(t, map[string]interface{}{"code": float64(statusCodeUnset)}, jobSpan["status"])
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"key": "job.id", "value": map[string]interface{}{"intValue": "42"}},
+		map[string]interface{}{"key": "job.name", "value": map[string]interface{}{"stringValue": "test"}},
+	}, jobSpan["attributes"])
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"key": "step.cancelled", "value": map[string]interface{}{"boolValue": true}},
+	}, stepSpan["attributes"])
+}
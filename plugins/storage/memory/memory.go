@@ -7,6 +7,7 @@ package memory
 
 import (
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 	"github.com/facebookincubator/contest/pkg/event/testevent"
 	"github.com/facebookincubator/contest/pkg/job"
 	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/target"
 	"github.com/facebookincubator/contest/pkg/types"
 )
 
@@ -28,6 +30,12 @@ type Memory struct {
 	jobIDCounter    types.JobID
 	jobRequests     map[types.JobID]*job.Request
 	jobReports      map[types.JobID]*job.JobReport
+	targetResults   []storage.TargetResult
+	scheduleCounter types.ScheduleID
+	schedules       map[types.ScheduleID]*storage.Schedule
+	templates       map[string]*storage.Template
+	servers         map[string]time.Time
+	auditRecords    []storage.AuditRecord
 }
 
 func emptyEventQuery(eventQuery *event.Query) bool {
@@ -46,7 +54,8 @@ func emptyFrameworkEventQuery(eventQuery *frameworkevent.Query) bool {
 // values. If so, the Query is considered "empty" and doesn't result in
 // any lookup in the database
 func emptyTestEventQuery(eventQuery *testevent.Query) bool {
-	return emptyEventQuery(&eventQuery.Query) && eventQuery.TestName == "" && eventQuery.TestStepLabel == ""
+	return emptyEventQuery(&eventQuery.Query) && eventQuery.TestName == "" && eventQuery.TestStepLabel == "" &&
+		eventQuery.TargetID == "" && !eventQuery.HasPayloadFilter()
 }
 
 // StoreTestEvent stores a test event into the database
@@ -109,6 +118,27 @@ func eventTestStepMatch(queryTestStepLabel, testStepLabel string) bool {
 	return true
 }
 
+func eventTargetMatch(queryTargetID string, t *target.Target) bool {
+	if queryTargetID != "" && (t == nil || t.ID != queryTargetID) {
+		return false
+	}
+	return true
+}
+
+// page returns the bounds of the page of n matching items selected by limit
+// and offset.
+func page(n int, limit, offset uint) (int, int) {
+	start := int(offset)
+	if start > n {
+		start = n
+	}
+	end := n
+	if limit > 0 && start+int(limit) < n {
+		end = start + int(limit)
+	}
+	return start, end
+}
+
 // GetTestEvents returns all test events that match the given query.
 func (m *Memory) GetTestEvents(eventQuery *testevent.Query) ([]testevent.Event, error) {
 	m.lock.Lock()
@@ -126,11 +156,14 @@ func (m *Memory) GetTestEvents(eventQuery *testevent.Query) ([]testevent.Event,
 			eventNameMatch(eventQuery.EventNames, event.Data.EventName) &&
 			eventTimeMatch(eventQuery.EmittedStartTime, eventQuery.EmittedEndTime, event.EmitTime) &&
 			eventTestMatch(eventQuery.TestName, event.Header.TestName) &&
-			eventTestStepMatch(eventQuery.TestStepLabel, event.Header.TestStepLabel) {
+			eventTestStepMatch(eventQuery.TestStepLabel, event.Header.TestStepLabel) &&
+			eventTargetMatch(eventQuery.TargetID, event.Data.Target) &&
+			eventQuery.MatchPayload(event.Data.Payload) {
 			matchingTestEvents = append(matchingTestEvents, event)
 		}
 	}
-	return matchingTestEvents, nil
+	start, end := page(len(matchingTestEvents), eventQuery.Limit, eventQuery.Offset)
+	return matchingTestEvents[start:end], nil
 }
 
 // Reset restores the original state of the memory storage layer
@@ -141,10 +174,84 @@ func (m *Memory) Reset() error {
 	m.frameworkEvents = []frameworkevent.Event{}
 	m.jobRequests = make(map[types.JobID]*job.Request)
 	m.jobReports = make(map[types.JobID]*job.JobReport)
+	m.targetResults = nil
 	m.jobIDCounter = 1
+	m.schedules = make(map[types.ScheduleID]*storage.Schedule)
+	m.scheduleCounter = 1
+	m.templates = make(map[string]*storage.Template)
+	m.servers = make(map[string]time.Time)
+	m.auditRecords = nil
 	return nil
 }
 
+// Prune deletes the events emitted before the given time by the jobs which
+// ended before it and, if jobs is set, the requests, reports and target
+// results of those jobs requested before it.
+func (m *Memory) Prune(before time.Time, endStates []event.Name, jobs, dryRun bool) (storage.PruneStats, error) {
+	var stats storage.PruneStats
+	if len(endStates) == 0 {
+		return stats, fmt.Errorf("no final state event of the jobs")
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	final := make(map[event.Name]bool, len(endStates))
+	for _, name := range endStates {
+		final[name] = true
+	}
+	ended := make(map[types.JobID]bool)
+	for _, ev := range m.frameworkEvents {
+		if final[ev.EventName] && ev.EmitTime.Before(before) {
+			ended[ev.JobID] = true
+		}
+	}
+	testEvents := []testevent.Event{}
+	for _, ev := range m.testEvents {
+		if ev.EmitTime.Before(before) && ended[ev.Header.JobID] {
+			stats.TestEvents++
+		} else {
+			testEvents = append(testEvents, ev)
+		}
+	}
+	frameworkEvents := []frameworkevent.Event{}
+	for _, ev := range m.frameworkEvents {
+		if ev.EmitTime.Before(before) && ended[ev.JobID] {
+			stats.FrameworkEvents++
+		} else {
+			frameworkEvents = append(frameworkEvents, ev)
+		}
+	}
+	var oldJobs []types.JobID
+	if jobs {
+		for jobID, request := range m.jobRequests {
+			if request.RequestTime.Before(before) && ended[jobID] {
+				oldJobs = append(oldJobs, jobID)
+			}
+		}
+		stats.Jobs = int64(len(oldJobs))
+	}
+	if dryRun {
+		return stats, nil
+	}
+	m.testEvents, m.frameworkEvents = testEvents, frameworkEvents
+	old := make(map[types.JobID]bool)
+	for _, jobID := range oldJobs {
+		delete(m.jobRequests, jobID)
+		delete(m.jobReports, jobID)
+		old[jobID] = true
+	}
+	if len(old) > 0 {
+		var targetResults []storage.TargetResult
+		for _, result := range m.targetResults {
+			if !old[result.JobID] {
+				targetResults = append(targetResults, result)
+			}
+		}
+		m.targetResults = targetResults
+	}
+	return stats, nil
+}
+
 // StoreJobRequest stores a new job request
 func (m *Memory) StoreJobRequest(request *job.Request) (types.JobID, error) {
 	m.lock.Lock()
@@ -167,6 +274,21 @@ func (m *Memory) GetJobRequest(jobID types.JobID) (*job.Request, error) {
 	return v, nil
 }
 
+// ListJobs returns the IDs of the jobs matching the query, most recent first
+func (m *Memory) ListJobs(query *storage.JobQuery) ([]types.JobID, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	jobIDs := make([]types.JobID, 0, len(m.jobRequests))
+	for jobID, req := range m.jobRequests {
+		if query.Match(req) {
+			jobIDs = append(jobIDs, jobID)
+		}
+	}
+	sort.Slice(jobIDs, func(i, j int) bool { return jobIDs[i] > jobIDs[j] })
+	start, end := page(len(jobIDs), query.Limit, query.Offset)
+	return jobIDs[start:end], nil
+}
+
 // StoreJobReport stores a report associated to a job. Returns an error if there is
 // already a report associated to the job
 func (m *Memory) StoreJobReport(report *job.JobReport) error {
@@ -216,7 +338,236 @@ func (m *Memory) GetFrameworkEvent(eventQuery *frameworkevent.Query) ([]framewor
 			matchingFrameworkEvents = append(matchingFrameworkEvents, event)
 		}
 	}
-	return matchingFrameworkEvents, nil
+	start, end := page(len(matchingFrameworkEvents), eventQuery.Limit, eventQuery.Offset)
+	return matchingFrameworkEvents[start:end], nil
+}
+
+// StoreTargetResult stores the result of a target
+func (m *Memory) StoreTargetResult(result storage.TargetResult) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.targetResults = append(m.targetResults, result)
+	return nil
+}
+
+// GetTargetResults returns the target results matching the query, in the
+// order they were stored
+func (m *Memory) GetTargetResults(query *storage.TargetResultQuery) ([]storage.TargetResult, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	matchingResults := []storage.TargetResult{}
+	for _, result := range m.targetResults {
+		if result.JobID != query.JobID ||
+			!eventRunMatch(query.RunID, result.RunID) ||
+			!eventTestMatch(query.TestName, result.TestName) {
+			continue
+		}
+		if len(query.Outcomes) > 0 {
+			found := false
+			for _, outcome := range query.Outcomes {
+				if outcome == result.Outcome {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		matchingResults = append(matchingResults, result)
+	}
+	start, end := page(len(matchingResults), query.Limit, query.Offset)
+	return matchingResults[start:end], nil
+}
+
+// StoreAuditRecord appends a record to the audit log
+func (m *Memory) StoreAuditRecord(record *storage.AuditRecord) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	record.ID = int64(len(m.auditRecords) + 1)
+	m.auditRecords = append(m.auditRecords, *record)
+	return nil
+}
+
+// GetAuditRecords returns the audit records matching the query, in the order
+// they were stored
+func (m *Memory) GetAuditRecords(query *storage.AuditQuery) ([]storage.AuditRecord, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	matchingRecords := []storage.AuditRecord{}
+	for _, record := range m.auditRecords {
+		if (query.Requestor != "" && record.Requestor != query.Requestor) ||
+			(query.Action != "" && record.Action != query.Action) ||
+			(query.JobID != 0 && record.JobID != query.JobID) ||
+			!eventTimeMatch(query.StartTime, query.EndTime, record.Time) {
+			continue
+		}
+		matchingRecords = append(matchingRecords, record)
+	}
+	start, end := page(len(matchingRecords), query.Limit, query.Offset)
+	return matchingRecords[start:end], nil
+}
+
+// StoreSchedule stores a new schedule
+func (m *Memory) StoreSchedule(schedule *storage.Schedule) (types.ScheduleID, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	schedule.ID = m.scheduleCounter
+	m.scheduleCounter++
+	s := *schedule
+	m.schedules[s.ID] = &s
+	return s.ID, nil
+}
+
+// UpdateSchedule replaces a schedule
+func (m *Memory) UpdateSchedule(schedule *storage.Schedule) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.schedules[schedule.ID]; !ok {
+		return storage.ErrScheduleNotFound
+	}
+	s := *schedule
+	m.schedules[s.ID] = &s
+	return nil
+}
+
+// GetSchedule retrieves a schedule
+func (m *Memory) GetSchedule(id types.ScheduleID) (*storage.Schedule, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	s, ok := m.schedules[id]
+	if !ok {
+		return nil, storage.ErrScheduleNotFound
+	}
+	schedule := *s
+	return &schedule, nil
+}
+
+// ListSchedules returns all the schedules, in the order they were created
+func (m *Memory) ListSchedules() ([]storage.Schedule, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	schedules := make([]storage.Schedule, 0, len(m.schedules))
+	for _, s := range m.schedules {
+		schedules = append(schedules, *s)
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].ID < schedules[j].ID })
+	return schedules, nil
+}
+
+// DeleteSchedule deletes a schedule
+func (m *Memory) DeleteSchedule(id types.ScheduleID) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.schedules[id]; !ok {
+		return storage.ErrScheduleNotFound
+	}
+	delete(m.schedules, id)
+	return nil
+}
+
+// StoreTemplate creates or replaces a template
+func (m *Memory) StoreTemplate(template *storage.Template) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if existing, ok := m.templates[template.Name]; ok {
+		template.CreateTime = existing.CreateTime
+	}
+	t := *template
+	m.templates[t.Name] = &t
+	return nil
+}
+
+// GetTemplate retrieves a template
+func (m *Memory) GetTemplate(name string) (*storage.Template, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	t, ok := m.templates[name]
+	if !ok {
+		return nil, storage.ErrTemplateNotFound
+	}
+	template := *t
+	return &template, nil
+}
+
+// ListTemplates returns all the templates, sorted by name
+func (m *Memory) ListTemplates() ([]storage.Template, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	templates := make([]storage.Template, 0, len(m.templates))
+	for _, t := range m.templates {
+		templates = append(templates, *t)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// DeleteTemplate deletes a template
+func (m *Memory) DeleteTemplate(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.templates[name]; !ok {
+		return storage.ErrTemplateNotFound
+	}
+	delete(m.templates, name)
+	return nil
+}
+
+// Now returns the current time, as the memory storage is not shared
+func (m *Memory) Now() (time.Time, error) {
+	return time.Now(), nil
+}
+
+// Heartbeat records that a server is alive at the given time
+func (m *Memory) Heartbeat(serverID string, now time.Time) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.servers[serverID] = now
+	return nil
+}
+
+// ListServers returns the servers which recorded a heartbeat, sorted by ID
+func (m *Memory) ListServers() ([]storage.Server, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	servers := make([]storage.Server, 0, len(m.servers))
+	for id, lastHeartbeat := range m.servers {
+		servers = append(servers, storage.Server{ID: id, LastHeartbeat: lastHeartbeat})
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].ID < servers[j].ID })
+	return servers, nil
+}
+
+// ClaimJob hands a job of a server over to another server, unless it does not
+// belong to the former server anymore
+func (m *Memory) ClaimJob(jobID types.JobID, fromServerID, toServerID string) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	req, ok := m.jobRequests[jobID]
+	if !ok {
+		return false, fmt.Errorf("could not find job request with id %v", jobID)
+	}
+	if req.ServerID != fromServerID {
+		return false, nil
+	}
+	// requests are shared with the callers of GetJobRequest
+	claimed := *req
+	claimed.ServerID = toServerID
+	m.jobRequests[jobID] = &claimed
+	return true, nil
+}
+
+// ForgetServer deletes a server, unless it recorded a heartbeat at or after
+// the given time
+func (m *Memory) ForgetServer(serverID string, before time.Time) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if lastHeartbeat, ok := m.servers[serverID]; ok && lastHeartbeat.Before(before) {
+		delete(m.servers, serverID)
+	}
+	return nil
 }
 
 // New create a new Memory events storage backend
@@ -225,5 +576,9 @@ func New() (storage.Storage, error) {
 	m.jobRequests = make(map[types.JobID]*job.Request)
 	m.jobReports = make(map[types.JobID]*job.JobReport)
 	m.jobIDCounter = 1
+	m.schedules = make(map[types.ScheduleID]*storage.Schedule)
+	m.scheduleCounter = 1
+	m.templates = make(map[string]*storage.Template)
+	m.servers = make(map[string]time.Time)
 	return &m, nil
 }
@@ -6,10 +6,15 @@
 package memory
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
 	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/types"
 	"github.com/stretchr/testify/require"
 )
 
@@ -57,3 +62,258 @@ func TestMemory_GetTestEvents(t *testing.T) {
 
 	require.Equal(t, ev0, ev)
 }
+
+func TestMemory_GetTestEventsPaginated(t *testing.T) {
+	stor, err := New()
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		err := stor.StoreTestEvent(testevent.Event{
+			EmitTime: time.Now(),
+			Header:   &testevent.Header{JobID: 1, RunID: types.RunID(i + 1)},
+			Data:     &testevent.Data{},
+		})
+		require.NoError(t, err)
+	}
+
+	query, err := testevent.BuildQuery(
+		testevent.QueryJobID(1),
+		testevent.QueryLimit(2),
+		testevent.QueryOffset(3),
+	)
+	require.NoError(t, err)
+	evs, err := stor.GetTestEvents(query)
+	require.NoError(t, err)
+	require.Len(t, evs, 2)
+	require.Equal(t, types.RunID(4), evs[0].Header.RunID)
+	require.Equal(t, types.RunID(5), evs[1].Header.RunID)
+
+	query, err = testevent.BuildQuery(testevent.QueryJobID(1), testevent.QueryOffset(10))
+	require.NoError(t, err)
+	evs, err = stor.GetTestEvents(query)
+	require.NoError(t, err)
+	require.Empty(t, evs)
+}
+
+func TestMemory_ListJobs(t *testing.T) {
+	stor, err := New()
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := stor.StoreJobRequest(&job.Request{})
+		require.NoError(t, err)
+	}
+	lister := stor.(storage.JobLister)
+	jobIDs, err := lister.ListJobs(&storage.JobQuery{})
+	require.NoError(t, err)
+	require.Equal(t, []types.JobID{3, 2, 1}, jobIDs)
+
+	jobIDs, err = lister.ListJobs(&storage.JobQuery{Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	require.Equal(t, []types.JobID{2}, jobIDs)
+}
+
+func TestMemory_ListJobsFilters(t *testing.T) {
+	stor, err := New()
+	require.NoError(t, err)
+
+	now := time.Now()
+	for _, req := range []*job.Request{
+		{JobName: "nightly kernel", Requestor: "alice", RequestTime: now.Add(-time.Hour), JobDescriptor: `{"Tags": ["nightly", "kernel"]}`, Tags: []string{"nightly", "kernel"}},
+		{JobName: "firmware", Requestor: "bob", RequestTime: now, JobDescriptor: `{"Tags": ["kernel"]}`, Tags: []string{"kernel"}},
+		{JobName: "nightly firmware", Requestor: "alice", RequestTime: now, JobDescriptor: `{}`, ScheduleID: 1},
+	} {
+		_, err := stor.StoreJobRequest(req)
+		require.NoError(t, err)
+	}
+	lister := stor.(storage.JobLister)
+	for _, tc := range []struct {
+		query  storage.JobQuery
+		jobIDs []types.JobID
+	}{
+		{storage.JobQuery{Requestor: "alice"}, []types.JobID{3, 1}},
+		{storage.JobQuery{NameContains: "firmware"}, []types.JobID{3, 2}},
+		{storage.JobQuery{Tags: []string{"kernel"}}, []types.JobID{2, 1}},
+		{storage.JobQuery{Tags: []string{"kernel", "nightly"}}, []types.JobID{1}},
+		{storage.JobQuery{RequestedAfter: now}, []types.JobID{3, 2}},
+		{storage.JobQuery{RequestedBefore: now}, []types.JobID{1}},
+		{storage.JobQuery{ScheduleID: 1}, []types.JobID{3}},
+		{storage.JobQuery{Requestor: "alice", NameContains: "nightly", Limit: 1}, []types.JobID{3}},
+	} {
+		jobIDs, err := lister.ListJobs(&tc.query)
+		require.NoError(t, err)
+		require.Equal(t, tc.jobIDs, jobIDs, "%+v", tc.query)
+	}
+}
+
+func TestMemory_GetTestEventsByTargetAndPayload(t *testing.T) {
+	stor, err := New()
+	require.NoError(t, err)
+
+	for _, ev := range []struct {
+		targetID, payload string
+	}{
+		{"host1", `{"Stdout": "ok"}`},
+		{"host2", `{"Stdout": "kernel panic"}`},
+		{"host1", `{"Stdout": "kernel panic"}`},
+	} {
+		payload := json.RawMessage(ev.payload)
+		err := stor.StoreTestEvent(testevent.Event{
+			EmitTime: time.Now(),
+			Header:   &testevent.Header{JobID: 1},
+			Data:     &testevent.Data{Target: &target.Target{ID: ev.targetID}, Payload: &payload},
+		})
+		require.NoError(t, err)
+	}
+
+	query, err := testevent.BuildQuery(
+		testevent.QueryTargetID("host1"),
+		testevent.QueryPayloadMatch("Stdout", "kernel panic"),
+	)
+	require.NoError(t, err)
+	evs, err := stor.GetTestEvents(query)
+	require.NoError(t, err)
+	require.Len(t, evs, 1)
+	require.Equal(t, `{"Stdout": "kernel panic"}`, string(*evs[0].Data.Payload))
+}
+
+func TestMemory_GetTargetResults(t *testing.T) {
+	stor, err := New()
+	require.NoError(t, err)
+	m := stor.(*Memory)
+
+	for i, outcome := range []target.Outcome{target.OutcomePass, target.OutcomeFail, target.OutcomeSkip, target.OutcomeFail} {
+		require.NoError(t, m.StoreTargetResult(storage.TargetResult{
+			JobID:    1,
+			RunID:    1,
+			TestName: "test",
+			Target:   &target.Target{ID: string(rune('a' + i))},
+			Result:   target.Result{Outcome: outcome},
+		}))
+	}
+	require.NoError(t, m.StoreTargetResult(storage.TargetResult{JobID: 2, RunID: 1, Result: target.Result{Outcome: target.OutcomeFail}}))
+
+	results, err := m.GetTargetResults(&storage.TargetResultQuery{JobID: 1, Outcomes: []target.Outcome{target.OutcomeFail, target.OutcomeSkip}})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	require.Equal(t, "b", results[0].Target.ID)
+	require.Equal(t, "d", results[2].Target.ID)
+
+	results, err = m.GetTargetResults(&storage.TargetResultQuery{JobID: 1, Limit: 1, Offset: 3})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "d", results[0].Target.ID)
+
+	results, err = m.GetTargetResults(&storage.TargetResultQuery{JobID: 1, RunID: 2})
+	require.NoError(t, err)
+	require.Empty(t, results)
+}
+
+func TestMemory_Schedules(t *testing.T) {
+	stor, err := New()
+	require.NoError(t, err)
+	m := stor.(*Memory)
+
+	for _, name := range []string{"nightly", "weekly"} {
+		_, err := m.StoreSchedule(&storage.Schedule{Name: name, Cron: "@daily"})
+		require.NoError(t, err)
+	}
+	schedule, err := m.GetSchedule(1)
+	require.NoError(t, err)
+	require.Equal(t, "nightly", schedule.Name)
+
+	schedule.Paused = true
+	require.NoError(t, m.UpdateSchedule(schedule))
+	require.NoError(t, m.DeleteSchedule(2))
+	schedules, err := m.ListSchedules()
+	require.NoError(t, err)
+	require.Len(t, schedules, 1)
+	require.True(t, schedules[0].Paused)
+
+	_, err = m.GetSchedule(2)
+	require.Equal(t, storage.ErrScheduleNotFound, err)
+	require.Equal(t, storage.ErrScheduleNotFound, m.DeleteSchedule(2))
+}
+
+func TestMemory_Templates(t *testing.T) {
+	stor, err := New()
+	require.NoError(t, err)
+	m := stor.(*Memory)
+
+	created := time.Now().Add(-time.Hour)
+	for _, name := range []string{"reboot", "flash"} {
+		require.NoError(t, m.StoreTemplate(&storage.Template{Name: name, Template: "{}", CreateTime: created, UpdateTime: created}))
+	}
+	// replacing a template keeps its creation time
+	require.NoError(t, m.StoreTemplate(&storage.Template{Name: "flash", Template: `{"Name": "flash"}`, CreateTime: time.Now(), UpdateTime: time.Now()}))
+	template, err := m.GetTemplate("flash")
+	require.NoError(t, err)
+	require.Equal(t, `{"Name": "flash"}`, template.Template)
+	require.Equal(t, created, template.CreateTime)
+
+	require.NoError(t, m.DeleteTemplate("reboot"))
+	templates, err := m.ListTemplates()
+	require.NoError(t, err)
+	require.Len(t, templates, 1)
+	require.Equal(t, "flash", templates[0].Name)
+
+	_, err = m.GetTemplate("reboot")
+	require.Equal(t, storage.ErrTemplateNotFound, err)
+	require.Equal(t, storage.ErrTemplateNotFound, m.DeleteTemplate("reboot"))
+}
+
+func TestMemory_AuditRecords(t *testing.T) {
+	stor, err := New()
+	require.NoError(t, err)
+	m := stor.(*Memory)
+	start := time.Now()
+	for i, action := range []string{"start", "stop", "start"} {
+		record := storage.AuditRecord{Time: start.Add(time.Duration(i) * time.Second), Requestor: "alice", Action: action, JobID: types.JobID(i + 1)}
+		require.NoError(t, m.StoreAuditRecord(&record))
+		require.Equal(t, int64(i+1), record.ID)
+	}
+	records, err := m.GetAuditRecords(&storage.AuditQuery{Action: "start"})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, types.JobID(3), records[1].JobID)
+	records, err = m.GetAuditRecords(&storage.AuditQuery{StartTime: start.Add(time.Second), Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, "stop", records[0].Action)
+	records, err = m.GetAuditRecords(&storage.AuditQuery{Requestor: "bob"})
+	require.NoError(t, err)
+	require.Empty(t, records)
+}
+
+func TestMemory_Cluster(t *testing.T) {
+	stor, err := New()
+	require.NoError(t, err)
+	m := stor.(*Memory)
+
+	now := time.Now()
+	require.NoError(t, m.Heartbeat("server2", now))
+	require.NoError(t, m.Heartbeat("server1", now.Add(-time.Hour)))
+	servers, err := m.ListServers()
+	require.NoError(t, err)
+	require.Equal(t, []storage.Server{{ID: "server1", LastHeartbeat: now.Add(-time.Hour)}, {ID: "server2", LastHeartbeat: now}}, servers)
+
+	jobID, err := m.StoreJobRequest(&job.Request{JobName: "test", ServerID: "server1"})
+	require.NoError(t, err)
+	claimed, err := m.ClaimJob(jobID, "server1", "server2")
+	require.NoError(t, err)
+	require.True(t, claimed)
+	// jobs are claimed only once
+	claimed, err = m.ClaimJob(jobID, "server1", "server3")
+	require.NoError(t, err)
+	require.False(t, claimed)
+	req, err := m.GetJobRequest(jobID)
+	require.NoError(t, err)
+	require.Equal(t, "server2", req.ServerID)
+
+	// servers which recorded a heartbeat since are not forgotten
+	require.NoError(t, m.ForgetServer("server1", now.Add(-time.Minute)))
+	require.NoError(t, m.ForgetServer("server2", now.Add(-time.Minute)))
+	servers, err = m.ListServers()
+	require.NoError(t, err)
+	require.Equal(t, []storage.Server{{ID: "server2", LastHeartbeat: now}}, servers)
+}
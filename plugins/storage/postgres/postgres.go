@@ -0,0 +1,224 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package postgres implements a storage engine backed by PostgreSQL. It
+// relies on the rdbms storage engine for the queries, and it creates or
+// upgrades the schema of the database via migrations when initialized.
+//
+// The PostgreSQL driver is not linked by this package, so that ConTest does
+// not depend on a specific one: binaries must import a database/sql driver
+// registered as DriverName, e.g. github.com/lib/pq, or set DriverName to the
+// name of the driver in use, e.g. "pgx" for github.com/jackc/pgx/v4/stdlib.
+package postgres
+
+import (
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/storage/migration"
+	"github.com/facebookincubator/contest/plugins/storage/rdbms"
+)
+
+// DriverName is the name of the database/sql driver used to connect to
+// PostgreSQL.
+var DriverName = "postgres"
+
+// migrations create and upgrade the schema of the database, see
+// migration.Migration.
+var migrations = []migration.Migration{
+	{
+		Version: 1,
+		Statements: []string{
+			`CREATE TABLE test_events (
+				event_id BIGSERIAL PRIMARY KEY,
+				job_id BIGINT NOT NULL,
+				run_id BIGINT NOT NULL,
+				test_name VARCHAR(32) NULL,
+				test_step_label VARCHAR(32) NULL,
+				event_name VARCHAR(32) NULL,
+				target_name VARCHAR(64) NULL,
+				target_id VARCHAR(64) NULL,
+				payload TEXT NULL,
+				emit_time TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX test_events_job_id ON test_events (job_id, run_id)`,
+			`CREATE TABLE framework_events (
+				event_id BIGSERIAL PRIMARY KEY,
+				job_id BIGINT NOT NULL,
+				event_name VARCHAR(32) NULL,
+				payload TEXT NULL,
+				emit_time TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX framework_events_job_id ON framework_events (job_id)`,
+			`CREATE TABLE run_reports (
+				report_id BIGSERIAL PRIMARY KEY,
+				job_id BIGINT NOT NULL,
+				run_id BIGINT NOT NULL,
+				reporter_name VARCHAR(32) NOT NULL,
+				success BOOLEAN NULL,
+				report_time TIMESTAMPTZ NOT NULL,
+				schema_version INT NOT NULL DEFAULT 1,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX run_reports_job_id ON run_reports (job_id)`,
+			`CREATE TABLE final_reports (
+				report_id BIGSERIAL PRIMARY KEY,
+				job_id BIGINT NOT NULL,
+				success BOOLEAN NULL,
+				reporter_name VARCHAR(32) NOT NULL,
+				report_time TIMESTAMPTZ NOT NULL,
+				schema_version INT NOT NULL DEFAULT 1,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX final_reports_job_id ON final_reports (job_id)`,
+			`CREATE TABLE jobs (
+				job_id BIGSERIAL PRIMARY KEY,
+				name VARCHAR(32) NOT NULL,
+				requestor VARCHAR(32) NOT NULL,
+				server_id VARCHAR(64) NOT NULL,
+				request_time TIMESTAMPTZ NOT NULL,
+				descriptor TEXT NOT NULL,
+				teststeps TEXT
+			)`,
+		},
+	},
+	{
+		Version: 2,
+		Statements: []string{
+			`CREATE TABLE target_results (
+				result_id BIGSERIAL PRIMARY KEY,
+				job_id BIGINT NOT NULL,
+				run_id BIGINT NOT NULL,
+				test_name VARCHAR(32) NOT NULL,
+				target_name VARCHAR(64) NOT NULL,
+				target_id VARCHAR(64) NOT NULL,
+				target_fqdn VARCHAR(255) NOT NULL,
+				outcome VARCHAR(16) NOT NULL,
+				failing_step VARCHAR(32) NULL,
+				message TEXT NULL,
+				duration_ms BIGINT NOT NULL,
+				end_time TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX target_results_job_id ON target_results (job_id, run_id, outcome)`,
+		},
+	},
+	{
+		Version: 3,
+		Statements: []string{
+			`ALTER TABLE jobs ADD COLUMN schedule_id BIGINT NOT NULL DEFAULT 0`,
+			`CREATE TABLE schedules (
+				schedule_id BIGSERIAL PRIMARY KEY,
+				name VARCHAR(32) NOT NULL,
+				requestor VARCHAR(32) NOT NULL,
+				cron VARCHAR(128) NOT NULL,
+				descriptor TEXT NOT NULL,
+				paused BOOLEAN NOT NULL,
+				create_time TIMESTAMPTZ NOT NULL,
+				last_run_time TIMESTAMPTZ NULL,
+				last_job_id BIGINT NOT NULL,
+				last_error TEXT NULL
+			)`,
+		},
+	},
+	{
+		Version: 4,
+		Statements: []string{
+			`CREATE TABLE templates (
+				name VARCHAR(32) PRIMARY KEY,
+				requestor VARCHAR(32) NOT NULL,
+				template TEXT NOT NULL,
+				create_time TIMESTAMPTZ NOT NULL,
+				update_time TIMESTAMPTZ NOT NULL
+			)`,
+		},
+	},
+	{
+		Version: 5,
+		Statements: []string{
+			`CREATE TABLE job_tags (
+				job_id BIGINT NOT NULL,
+				tag VARCHAR(32) NOT NULL,
+				PRIMARY KEY (job_id, tag)
+			)`,
+			`CREATE INDEX job_tags_tag ON job_tags (tag)`,
+			// the tags of the existing jobs are read from their descriptors
+			`INSERT INTO job_tags (job_id, tag)
+				SELECT DISTINCT jobs.job_id, LEFT(tags.tag, 32)
+				FROM jobs, json_array_elements_text(
+					CASE WHEN json_typeof(jobs.descriptor::json->'Tags') = 'array'
+					THEN jobs.descriptor::json->'Tags' ELSE '[]' END
+				) AS tags (tag)
+				ON CONFLICT DO NOTHING`,
+		},
+	},
+	{
+		Version: 6,
+		Statements: []string{
+			`ALTER TABLE jobs ADD COLUMN retry_of BIGINT NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		Version: 7,
+		Statements: []string{
+			`ALTER TABLE jobs ADD COLUMN rerun_of BIGINT NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		Version: 8,
+		Statements: []string{
+			`CREATE TABLE servers (
+				server_id VARCHAR(64) PRIMARY KEY,
+				last_heartbeat TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE INDEX jobs_server_id ON jobs (server_id)`,
+		},
+	},
+	{
+		Version: 9,
+		Statements: []string{
+			`CREATE TABLE audit_log (
+				record_id BIGSERIAL PRIMARY KEY,
+				record_time TIMESTAMPTZ NOT NULL,
+				server_id VARCHAR(64) NOT NULL,
+				requestor VARCHAR(32) NOT NULL,
+				action VARCHAR(32) NOT NULL,
+				job_id BIGINT NOT NULL,
+				payload_hash CHAR(64) NOT NULL,
+				error TEXT NULL
+			)`,
+			`CREATE INDEX audit_log_requestor ON audit_log (requestor, record_time)`,
+			`CREATE INDEX audit_log_job_id ON audit_log (job_id)`,
+		},
+	},
+	{
+		Version: 10,
+		Statements: []string{
+			`ALTER TABLE framework_events ADD COLUMN request_id VARCHAR(64) NOT NULL DEFAULT ''`,
+			`ALTER TABLE audit_log ADD COLUMN request_id VARCHAR(64) NOT NULL DEFAULT ''`,
+		},
+	},
+}
+
+// Migrate creates or upgrades the schema of the database to the latest
+// version.
+func Migrate(dbURI string) error {
+	return migration.Migrate(DriverName, dbURI, migration.DefaultTable, migrations)
+}
+
+// New creates a PostgreSQL storage engine, migrating the schema of the
+// database if needed. The options are the ones of the rdbms storage engine.
+func New(dbURI string, opts ...rdbms.Opt) (storage.Storage, error) {
+	if err := Migrate(dbURI); err != nil {
+		return nil, err
+	}
+	opts = append([]rdbms.Opt{rdbms.DriverName(DriverName), rdbms.PositionalPlaceholders()}, opts...)
+	return rdbms.New(dbURI, opts...)
+}
+
+// NewReplica creates a PostgreSQL storage engine for a read-only replica,
+// e.g. to serve reads via storage.SetReadStorage. Unlike New, it does not
+// migrate the schema, which is replicated from the primary database.
+func NewReplica(dbURI string, opts ...rdbms.Opt) (storage.Storage, error) {
+	opts = append([]rdbms.Opt{rdbms.DriverName(DriverName), rdbms.PositionalPlaceholders()}, opts...)
+	return rdbms.New(dbURI, opts...)
+}
@@ -0,0 +1,138 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package rdbms
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/facebookincubator/contest/pkg/storage"
+)
+
+// StoreAuditRecord inserts a record in the audit_log table
+func (r *RDBMS) StoreAuditRecord(record *storage.AuditRecord) error {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	insertStatement := "insert into audit_log (record_time, server_id, request_id, requestor, action, job_id, payload_hash, error) values (?, ?, ?, ?, ?, ?, ?, ?)"
+	fields := []interface{}{
+		record.Time,
+		record.ServerID,
+		record.RequestID,
+		record.Requestor,
+		record.Action,
+		record.JobID,
+		record.PayloadHash,
+		record.Error,
+	}
+	if r.positionalPlaceholders {
+		rows, err := r.query(insertStatement+" returning record_id", fields...)
+		if err != nil {
+			return fmt.Errorf("could not store audit record in database: %v", err)
+		}
+		defer func() {
+			if err := rows.Close(); err != nil {
+				log.Warningf("could not close rows for audit record: %v", err)
+			}
+		}()
+		if !rows.Next() {
+			return fmt.Errorf("could not extract id of last audit record inserted into db: %v", rows.Err())
+		}
+		if err := rows.Scan(&record.ID); err != nil {
+			return fmt.Errorf("could not extract id of last audit record inserted into db: %v", err)
+		}
+		return nil
+	}
+	result, err := r.exec(insertStatement, fields...)
+	if err != nil {
+		return fmt.Errorf("could not store audit record in database: %v", err)
+	}
+	if record.ID, err = result.LastInsertId(); err != nil {
+		return fmt.Errorf("could not extract id of last audit record inserted into db")
+	}
+	return nil
+}
+
+// buildAuditQuery returns the clauses selecting the audit records matching a
+// query, and their arguments
+func buildAuditQuery(query *storage.AuditQuery) (string, []interface{}) {
+	var (
+		clauses []string
+		fields  []interface{}
+	)
+	if query.Requestor != "" {
+		clauses = append(clauses, "requestor=?")
+		fields = append(fields, query.Requestor)
+	}
+	if query.Action != "" {
+		clauses = append(clauses, "action=?")
+		fields = append(fields, query.Action)
+	}
+	if query.JobID != 0 {
+		clauses = append(clauses, "job_id=?")
+		fields = append(fields, query.JobID)
+	}
+	if !query.StartTime.IsZero() {
+		clauses = append(clauses, "record_time>=?")
+		fields = append(fields, query.StartTime)
+	}
+	if !query.EndTime.IsZero() {
+		clauses = append(clauses, "record_time<=?")
+		fields = append(fields, query.EndTime)
+	}
+	var where string
+	if len(clauses) > 0 {
+		where = " where " + strings.Join(clauses, " and ")
+	}
+	page, pageFields := pagination(query.Limit, query.Offset)
+	return where + " order by record_id" + page, append(fields, pageFields...)
+}
+
+// GetAuditRecords returns the audit records matching the query, in the order
+// they were stored
+func (r *RDBMS) GetAuditRecords(query *storage.AuditQuery) ([]storage.AuditRecord, error) {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	clauses, fields := buildAuditQuery(query)
+	selectStatement := "select record_id, record_time, server_id, request_id, requestor, action, job_id, payload_hash, error from audit_log" + clauses
+	log.Debugf("Executing query: %s, fields: %v", selectStatement, fields)
+	rows, err := r.query(selectStatement, fields...)
+	if err != nil {
+		return nil, fmt.Errorf("could not get audit records: %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warningf("could not close rows for audit records: %v", err)
+		}
+	}()
+	records := []storage.AuditRecord{}
+	for rows.Next() {
+		var (
+			record  storage.AuditRecord
+			errText sql.NullString
+		)
+		if err := rows.Scan(
+			&record.ID,
+			&record.Time,
+			&record.ServerID,
+			&record.RequestID,
+			&record.Requestor,
+			&record.Action,
+			&record.JobID,
+			&record.PayloadHash,
+			&errText,
+		); err != nil {
+			return nil, fmt.Errorf("could not read audit records from db: %v", err)
+		}
+		record.Error = errText.String
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,33 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package rdbms
+
+import (
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildAuditQuery(t *testing.T) {
+	stmt, fields := buildAuditQuery(&storage.AuditQuery{})
+	require.Equal(t, " order by record_id", stmt)
+	require.Empty(t, fields)
+
+	start := time.Unix(1600000000, 0)
+	stmt, fields = buildAuditQuery(&storage.AuditQuery{
+		Requestor: "alice",
+		Action:    "stop",
+		JobID:     1,
+		StartTime: start,
+		Limit:     10,
+		Offset:    20,
+	})
+	require.Equal(t, " where requestor=? and action=? and job_id=? and record_time>=? order by record_id limit ? offset ?", stmt)
+	require.Equal(t, []interface{}{"alice", "stop", types.JobID(1), start, int64(10), int64(20)}, fields)
+}
@@ -0,0 +1,132 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package rdbms
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// Now returns the current time of the database server, so that the servers
+// of a cluster compare heartbeats with the same clock
+func (r *RDBMS) Now() (time.Time, error) {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	rows, err := r.query("select current_timestamp")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not get the time of the database: %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warningf("could not close rows for the time of the database: %v", err)
+		}
+	}()
+	var now time.Time
+	if !rows.Next() {
+		return time.Time{}, fmt.Errorf("could not get the time of the database: %v", rows.Err())
+	}
+	if err := rows.Scan(&now); err != nil {
+		return time.Time{}, fmt.Errorf("could not read the time of the database: %v", err)
+	}
+	return now, nil
+}
+
+// Heartbeat records the heartbeat of a server in the servers table. Only the
+// server itself records its heartbeats, so looking its row up before
+// updating it does not race with other servers.
+func (r *RDBMS) Heartbeat(serverID string, now time.Time) error {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	servers, err := r.selectServers(" where server_id = ?", serverID)
+	if err != nil {
+		return fmt.Errorf("could not look up server %s: %v", serverID, err)
+	}
+	if len(servers) > 0 {
+		if _, err := r.exec("update servers set last_heartbeat = ? where server_id = ?", now, serverID); err != nil {
+			return fmt.Errorf("could not update server %s: %v", serverID, err)
+		}
+		return nil
+	}
+	if _, err := r.exec("insert into servers (server_id, last_heartbeat) values (?, ?)", serverID, now); err != nil {
+		return fmt.Errorf("could not store server %s: %v", serverID, err)
+	}
+	return nil
+}
+
+func (r *RDBMS) selectServers(clauses string, fields ...interface{}) ([]storage.Server, error) {
+	selectStatement := "select server_id, last_heartbeat from servers" + clauses
+	log.Debugf("Executing query: %s, fields: %v", selectStatement, fields)
+	rows, err := r.query(selectStatement, fields...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warningf("could not close rows for servers: %v", err)
+		}
+	}()
+	servers := []storage.Server{}
+	for rows.Next() {
+		var server storage.Server
+		if err := rows.Scan(&server.ID, &server.LastHeartbeat); err != nil {
+			return nil, fmt.Errorf("could not read servers from db: %v", err)
+		}
+		servers = append(servers, server)
+	}
+	return servers, rows.Err()
+}
+
+// ListServers returns the servers which recorded a heartbeat, sorted by ID
+func (r *RDBMS) ListServers() ([]storage.Server, error) {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	servers, err := r.selectServers(" order by server_id")
+	if err != nil {
+		return nil, fmt.Errorf("could not list servers: %v", err)
+	}
+	return servers, nil
+}
+
+// ClaimJob hands a job of a server over to another server. The update is
+// conditional on the current server of the job, so that a job is claimed by
+// a single server.
+func (r *RDBMS) ClaimJob(jobID types.JobID, fromServerID, toServerID string) (bool, error) {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	result, err := r.exec("update jobs set server_id = ? where job_id = ? and server_id = ?", toServerID, jobID, fromServerID)
+	if err != nil {
+		return false, fmt.Errorf("could not claim job %d: %v", jobID, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("could not count the claimed jobs: %v", err)
+	}
+	return affected > 0, nil
+}
+
+// ForgetServer deletes a server from the servers table, unless it recorded a
+// heartbeat at or after the given time
+func (r *RDBMS) ForgetServer(serverID string, before time.Time) error {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	if _, err := r.exec("delete from servers where server_id = ? and last_heartbeat < ?", serverID, before); err != nil {
+		return fmt.Errorf("could not delete server %s: %v", serverID, err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package rdbms
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+)
+
+// Compressor compresses and decompresses event payloads. Compressed payloads
+// are stored as "<name>:<base64 data>", so that they fit text columns and can
+// be told apart from uncompressed JSON payloads, which never start with a
+// name followed by a colon.
+type Compressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var (
+	compressorsLock sync.RWMutex
+	compressors     = map[string]Compressor{}
+)
+
+// RegisterCompressor makes a compressor available to PayloadCompression and
+// to the decompression of the payloads stored with it. gzip is registered by
+// default; other algorithms, e.g. zstd, are not linked by this package so
+// that ConTest does not depend on a specific implementation.
+func RegisterCompressor(c Compressor) error {
+	name := c.Name()
+	if name == "" || strings.ContainsAny(name, ":{[\"") {
+		return fmt.Errorf("invalid compressor name '%s'", name)
+	}
+	compressorsLock.Lock()
+	defer compressorsLock.Unlock()
+	if _, ok := compressors[name]; ok {
+		return fmt.Errorf("compressor '%s' is already registered", name)
+	}
+	compressors[name] = c
+	return nil
+}
+
+func getCompressor(name string) (Compressor, bool) {
+	compressorsLock.RLock()
+	defer compressorsLock.RUnlock()
+	c, ok := compressors[name]
+	return c, ok
+}
+
+// gzipCompressor implements Compressor via the standard library.
+type gzipCompressor struct{}
+
+func (gzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func init() {
+	if err := RegisterCompressor(gzipCompressor{}); err != nil {
+		panic(err)
+	}
+}
+
+// compressPayload compresses a payload value, as returned by payloadValue,
+// if compression is enabled and the payload is larger than the threshold.
+// Payloads which do not shrink are stored as they are.
+func (r *RDBMS) compressPayload(payload interface{}) (interface{}, error) {
+	s, ok := payload.(string)
+	if !ok || r.compressor == nil || len(s) < r.compressionThreshold {
+		return payload, nil
+	}
+	data, err := r.compressor.Compress([]byte(s))
+	if err != nil {
+		return nil, fmt.Errorf("could not compress payload with %s: %v", r.compressor.Name(), err)
+	}
+	compressed := r.compressor.Name() + ":" + base64.StdEncoding.EncodeToString(data)
+	if len(compressed) >= len(s) {
+		return payload, nil
+	}
+	return compressed, nil
+}
+
+// decompressPayload returns the JSON payload stored in a payload column,
+// decompressing it if needed. Decompression does not depend on the options
+// of the engine, so that payloads stay readable if compression is disabled.
+func decompressPayload(stored string) (string, error) {
+	idx := strings.IndexByte(stored, ':')
+	if idx <= 0 {
+		return stored, nil
+	}
+	c, ok := getCompressor(stored[:idx])
+	if !ok {
+		return stored, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(stored[idx+1:])
+	if err != nil {
+		return "", fmt.Errorf("could not decode %s payload: %v", c.Name(), err)
+	}
+	payload, err := c.Decompress(data)
+	if err != nil {
+		return "", fmt.Errorf("could not decompress %s payload: %v", c.Name(), err)
+	}
+	return string(payload), nil
+}
@@ -0,0 +1,53 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package rdbms
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressPayload(t *testing.T) {
+	c, ok := getCompressor("gzip")
+	require.True(t, ok)
+	r := RDBMS{compressor: c, compressionThreshold: 100}
+
+	// small payloads are stored as they are
+	small := `{"Stdout": "ok"}`
+	stored, err := r.compressPayload(small)
+	require.NoError(t, err)
+	require.Equal(t, small, stored)
+
+	large := `{"Stdout": "` + strings.Repeat("a", 1000) + `"}`
+	stored, err = r.compressPayload(large)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(stored.(string), "gzip:"))
+	require.Less(t, len(stored.(string)), len(large))
+
+	payload, err := decompressPayload(stored.(string))
+	require.NoError(t, err)
+	require.Equal(t, large, payload)
+
+	// null payloads are not compressed
+	stored, err = r.compressPayload(nil)
+	require.NoError(t, err)
+	require.Nil(t, stored)
+}
+
+func TestDecompressUncompressedPayload(t *testing.T) {
+	for _, payload := range []string{`{"a": "gzip:b"}`, `"gzip:abc"`, `null`, `42`} {
+		p, err := decompressPayload(payload)
+		require.NoError(t, err)
+		require.Equal(t, payload, p)
+	}
+}
+
+func TestUnknownCompressor(t *testing.T) {
+	_, err := New("", PayloadCompression("contest-nonexistent", 0))
+	require.Error(t, err)
+}
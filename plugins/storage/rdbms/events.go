@@ -10,6 +10,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"math"
 
 	"github.com/facebookincubator/contest/pkg/event"
 	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
@@ -18,6 +19,20 @@ import (
 	"github.com/facebookincubator/contest/pkg/types"
 )
 
+// pagination returns the clause limiting the rows returned by a query, and
+// its arguments. An offset requires a limit, hence the largest one is used
+// if there is none.
+func pagination(limit, offset uint) (string, []interface{}) {
+	if limit == 0 && offset == 0 {
+		return "", nil
+	}
+	var l int64 = math.MaxInt64
+	if limit > 0 {
+		l = int64(limit)
+	}
+	return " limit ? offset ?", []interface{}{l, int64(offset)}
+}
+
 func assembleQuery(baseQuery bytes.Buffer, selectClauses []string) (string, error) {
 	if len(selectClauses) == 0 {
 		return "", fmt.Errorf("no select clauses available, the query should specify at least one clause")
@@ -70,7 +85,7 @@ func buildEventQuery(baseQuery bytes.Buffer, eventQuery *event.Query) ([]string,
 	}
 	if eventQuery != nil && !eventQuery.EmittedEndTime.IsZero() {
 		selectClauses = append(selectClauses, "emit_time<=?")
-		fields = append(fields, eventQuery.EmittedStartTime)
+		fields = append(fields, eventQuery.EmittedEndTime)
 	}
 	return selectClauses, fields
 }
@@ -82,7 +97,8 @@ func buildFrameworkEventQuery(baseQuery bytes.Buffer, frameworkEventQuery *frame
 		return "", nil, fmt.Errorf("could not assemble query for framework events: %v", err)
 
 	}
-	return query, fields, nil
+	page, pageFields := pagination(frameworkEventQuery.Limit, frameworkEventQuery.Offset)
+	return query + page, append(fields, pageFields...), nil
 }
 
 func buildTestEventQuery(baseQuery bytes.Buffer, testEventQuery *testevent.Query) (string, []interface{}, error) {
@@ -105,12 +121,22 @@ func buildTestEventQuery(baseQuery bytes.Buffer, testEventQuery *testevent.Query
 		selectClauses = append(selectClauses, "test_step_label=?")
 		fields = append(fields, testEventQuery.TestStepLabel)
 	}
+	if testEventQuery.TargetID != "" {
+		selectClauses = append(selectClauses, "target_id=?")
+		fields = append(fields, testEventQuery.TargetID)
+	}
 	query, err := assembleQuery(baseQuery, selectClauses)
 	if err != nil {
 		return "", nil, fmt.Errorf("could not assemble query for framework events: %v", err)
 
 	}
-	return query, fields, nil
+	// payloads may be compressed, so payload filters are applied after
+	// reading the events, and so is the pagination
+	if testEventQuery.HasPayloadFilter() {
+		return query, fields, nil
+	}
+	page, pageFields := pagination(testEventQuery.Limit, testEventQuery.Offset)
+	return query + page, append(fields, pageFields...), nil
 }
 
 // TestEventField is a function type which retrieves information from a TestEvent object.
@@ -180,6 +206,18 @@ func TestEventPayload(ev testevent.Event) interface{} {
 	return ev.Data.Payload
 }
 
+// payloadValue converts a payload into a value suitable for a text column.
+// Drivers may encode byte slices as binary data, hence the conversion.
+func payloadValue(payload interface{}) interface{} {
+	if p, ok := payload.(*json.RawMessage); ok {
+		if p == nil {
+			return nil
+		}
+		return string(*p)
+	}
+	return payload
+}
+
 // TestEventEmitTime returns the emission timestamp from an events.TestEvent object
 func TestEventEmitTime(ev testevent.Event) interface{} {
 	return ev.EmitTime
@@ -208,7 +246,11 @@ func (r *RDBMS) flushTestEvents() error {
 
 	insertStatement := "insert into test_events (job_id, run_id, test_name, test_step_label, event_name, target_name, target_id, payload, emit_time) values (?, ?, ?, ?, ?, ?, ?, ?, ?)"
 	for _, event := range r.buffTestEvents {
-		_, err := r.db.Exec(
+		payload, err := r.compressPayload(payloadValue(TestEventPayload(event)))
+		if err != nil {
+			return fmt.Errorf("could not store event in database: %v", err)
+		}
+		_, err = r.exec(
 			insertStatement,
 			TestEventJobID(event),
 			TestEventRunID(event),
@@ -217,12 +259,16 @@ func (r *RDBMS) flushTestEvents() error {
 			TestEventName(event),
 			TestEventTargetName(event),
 			TestEventTargetID(event),
-			TestEventPayload(event),
+			payload,
 			TestEventEmitTime(event))
 		if err != nil {
 			return fmt.Errorf("could not store event in database: %v", err)
 		}
 	}
+	if n := len(r.buffTestEvents); n > 0 {
+		storageMetrics.Add("test_events_inserted", int64(n))
+		testEventsBatchSize.Observe(float64(n))
+	}
 	r.buffTestEvents = nil
 
 	return nil
@@ -252,7 +298,7 @@ func (r *RDBMS) GetTestEvents(eventQuery *testevent.Query) ([]testevent.Event, e
 
 	results := []testevent.Event{}
 	log.Debugf("Executing query: %s, fields: %v", query, fields)
-	rows, err := r.db.Query(query, fields...)
+	rows, err := r.query(query, fields...)
 	if err != nil {
 		return nil, err
 	}
@@ -297,16 +343,38 @@ func (r *RDBMS) GetTestEvents(eventQuery *testevent.Query) ([]testevent.Event, e
 		}
 
 		if payload.Valid {
-			rawPayload := json.RawMessage(payload.String)
+			p, err := decompressPayload(payload.String)
+			if err != nil {
+				return nil, fmt.Errorf("could not read results from db: %v", err)
+			}
+			rawPayload := json.RawMessage(p)
 			data.Payload = &rawPayload
 
 		}
+		if !eventQuery.MatchPayload(data.Payload) {
+			continue
+		}
 
 		results = append(results, event)
 	}
+	if eventQuery.HasPayloadFilter() {
+		results = paginate(results, eventQuery.Limit, eventQuery.Offset)
+	}
 	return results, nil
 }
 
+// paginate returns the page of the test events selected by limit and offset.
+func paginate(events []testevent.Event, limit, offset uint) []testevent.Event {
+	if offset >= uint(len(events)) {
+		return []testevent.Event{}
+	}
+	events = events[offset:]
+	if limit > 0 && limit < uint(len(events)) {
+		events = events[:limit]
+	}
+	return events
+}
+
 // FrameworkEventField is a function type which retrieves information from a FrameworkEvent object
 type FrameworkEventField func(ev frameworkevent.Event) interface{}
 
@@ -330,6 +398,11 @@ func FrameworkEventEmitTime(ev frameworkevent.Event) interface{} {
 	return ev.EmitTime
 }
 
+// FrameworkEventRequestID returns the ID of the API request which emitted a events.FrameworkEvent object
+func FrameworkEventRequestID(ev frameworkevent.Event) interface{} {
+	return ev.RequestID
+}
+
 // StoreFrameworkEvent appends an event to the internal buffer and triggers a flush
 // when the internal storage utilization goes beyond `frameworkEventsFlushSize`
 func (r *RDBMS) StoreFrameworkEvent(event frameworkevent.Event) error {
@@ -352,18 +425,27 @@ func (r *RDBMS) flushFrameworkEvents() error {
 	r.lockTx()
 	defer r.unlockTx()
 
-	insertStatement := "insert into framework_events (job_id, event_name, payload, emit_time) values (?, ?, ?, ?)"
+	insertStatement := "insert into framework_events (job_id, event_name, payload, emit_time, request_id) values (?, ?, ?, ?, ?)"
 	for _, event := range r.buffFrameworkEvents {
-		_, err := r.db.Exec(
+		payload, err := r.compressPayload(payloadValue(FrameworkEventPayload(event)))
+		if err != nil {
+			return fmt.Errorf("could not store event in database: %v", err)
+		}
+		_, err = r.exec(
 			insertStatement,
 			FrameworkEventJobID(event),
 			FrameworkEventName(event),
-			FrameworkEventPayload(event),
-			FrameworkEventEmitTime(event))
+			payload,
+			FrameworkEventEmitTime(event),
+			FrameworkEventRequestID(event))
 		if err != nil {
 			return fmt.Errorf("could not store event in database: %v", err)
 		}
 	}
+	if n := len(r.buffFrameworkEvents); n > 0 {
+		storageMetrics.Add("framework_events_inserted", int64(n))
+		frameworkEventsBatchSize.Observe(float64(n))
+	}
 	r.buffFrameworkEvents = nil
 	return nil
 }
@@ -384,14 +466,14 @@ func (r *RDBMS) GetFrameworkEvent(eventQuery *frameworkevent.Query) ([]framework
 	defer r.unlockTx()
 
 	baseQuery := bytes.Buffer{}
-	baseQuery.WriteString(`select event_id, job_id, event_name, payload, emit_time from framework_events`)
+	baseQuery.WriteString(`select event_id, job_id, event_name, payload, emit_time, request_id from framework_events`)
 	query, fields, err := buildFrameworkEventQuery(baseQuery, eventQuery)
 	if err != nil {
 		return nil, fmt.Errorf("could not execute select query for test events: %v", err)
 	}
 	results := []frameworkevent.Event{}
 	log.Debugf("Executing query: %s, fields: %v", query, fields)
-	rows, err := r.db.Query(query, fields...)
+	rows, err := r.query(query, fields...)
 	if err != nil {
 		return nil, err
 	}
@@ -404,11 +486,22 @@ func (r *RDBMS) GetFrameworkEvent(eventQuery *frameworkevent.Query) ([]framework
 
 	for rows.Next() {
 		event := frameworkevent.New()
-		var eventID int
-		err := rows.Scan(&eventID, &event.JobID, &event.EventName, &event.Payload, &event.EmitTime)
+		var (
+			eventID int
+			payload sql.NullString
+		)
+		err := rows.Scan(&eventID, &event.JobID, &event.EventName, &payload, &event.EmitTime, &event.RequestID)
 		if err != nil {
 			return nil, fmt.Errorf("could not read results from db: %v", err)
 		}
+		if payload.Valid {
+			p, err := decompressPayload(payload.String)
+			if err != nil {
+				return nil, fmt.Errorf("could not read results from db: %v", err)
+			}
+			rawPayload := json.RawMessage(p)
+			event.Payload = &rawPayload
+		}
 		results = append(results, event)
 	}
 	return results, nil
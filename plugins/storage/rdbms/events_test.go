@@ -0,0 +1,31 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package rdbms
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildTestEventQueryPaginated(t *testing.T) {
+	query, err := testevent.BuildQuery(testevent.QueryJobID(1), testevent.QueryLimit(10), testevent.QueryOffset(20))
+	require.NoError(t, err)
+	stmt, fields, err := buildTestEventQuery(bytes.Buffer{}, query)
+	require.NoError(t, err)
+	require.Equal(t, " where job_id=? order by event_id limit ? offset ?", stmt)
+	require.Equal(t, []interface{}{query.JobID, int64(10), int64(20)}, fields)
+
+	// an offset without a limit still requires a limit clause
+	query, err = testevent.BuildQuery(testevent.QueryJobID(1), testevent.QueryOffset(20))
+	require.NoError(t, err)
+	_, fields, err = buildTestEventQuery(bytes.Buffer{}, query)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{query.JobID, int64(math.MaxInt64), int64(20)}, fields)
+}
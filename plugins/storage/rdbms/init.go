@@ -6,9 +6,12 @@
 package rdbms
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/facebookincubator/contest/pkg/event/frameworkevent"
@@ -49,6 +52,24 @@ type tx interface {
 type RDBMS struct {
 	dbURI, driverName string
 
+	// positionalPlaceholders is set for databases which use $1, $2, ... as
+	// placeholders instead of ?, e.g. PostgreSQL
+	positionalPlaceholders bool
+
+	// maxOpenConns limits the number of open connections to the database,
+	// if positive
+	maxOpenConns int
+
+	// compressor, if set, compresses the event payloads larger than
+	// compressionThreshold bytes before storing them
+	compressionName      string
+	compressor           Compressor
+	compressionThreshold int
+
+	// slowQueryThreshold, if positive, is the duration beyond which
+	// statements are logged
+	slowQueryThreshold time.Duration
+
 	buffTestEvents      []testevent.Event
 	buffFrameworkEvents []frameworkevent.Event
 
@@ -57,8 +78,15 @@ type RDBMS struct {
 
 	// sql.Tx is not safe for concurrent use. This means that both Query, Exec operations
 	// and rows scanning should be serialized. txLock is acquired and released by all
-	// methods of the public interface exposed by RDBMS.
-	txLock sync.Mutex
+	// methods of the public interface exposed by RDBMS, and it is shared by the
+	// nested transactions of a transaction.
+	txLock *sync.Mutex
+
+	// savepoint is the name of the savepoint of a nested transaction, and
+	// savepoints counts the savepoints created within a transaction, to name
+	// them
+	savepoint  string
+	savepoints *uint64
 
 	db db
 
@@ -85,9 +113,75 @@ func (r *RDBMS) unlockTx() {
 	r.txLock.Unlock()
 }
 
-// BeginTx returns a storage.TransactionalStorage object backed by a transactional db object
+// rebind rewrites the placeholders of a query, which are written as ?, in
+// the style of the database in use.
+func (r *RDBMS) rebind(query string) string {
+	if !r.positionalPlaceholders {
+		return query
+	}
+	var (
+		b bytes.Buffer
+		n int
+	)
+	for _, c := range query {
+		if c == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (r *RDBMS) exec(query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := r.db.Exec(r.rebind(query), args...)
+	r.observe("exec", query, start, err)
+	return res, err
+}
+
+func (r *RDBMS) query(query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := r.db.Query(r.rebind(query), args...)
+	r.observe("query", query, start, err)
+	return rows, err
+}
+
+// Ping checks that the database is reachable. A transaction holds its
+// connection, so it is always reachable.
+func (r *RDBMS) Ping(ctx context.Context) error {
+	sqlDb, ok := r.db.(*sql.DB)
+	if !ok {
+		return nil
+	}
+	if err := sqlDb.PingContext(ctx); err != nil {
+		return fmt.Errorf("could not contact database: %w", err)
+	}
+	return nil
+}
+
+// BeginTx returns a storage.TransactionalStorage object backed by a transactional db object.
+// Events buffered by r are written first, so that the writes of the transaction are ordered
+// after them. Within a transaction, BeginTx returns a nested transaction backed by a savepoint.
 func (r *RDBMS) BeginTx() (storage.TransactionalStorage, error) {
 
+	if err := r.flush(); err != nil {
+		return nil, fmt.Errorf("could not flush events before beginning transaction: %v", err)
+	}
+	if _, ok := r.db.(tx); ok {
+		name := fmt.Sprintf("contest_savepoint_%d", atomic.AddUint64(r.savepoints, 1))
+		r.lockTx()
+		_, err := r.exec("savepoint " + name)
+		r.unlockTx()
+		if err != nil {
+			return nil, fmt.Errorf("could not create savepoint: %v", err)
+		}
+		nested := r.txCopy(r.db)
+		nested.txLock, nested.savepoints, nested.savepoint = r.txLock, r.savepoints, name
+		return nested, nil
+	}
+
 	txdb, ok := r.db.(txbeginner)
 	if !ok {
 		return nil, fmt.Errorf("backend does not support initiating a transaction")
@@ -97,25 +191,67 @@ func (r *RDBMS) BeginTx() (storage.TransactionalStorage, error) {
 	if err != nil {
 		return nil, err
 	}
-	txRDBMS := RDBMS{testEventsLock: &sync.Mutex{}, frameworkEventsLock: &sync.Mutex{}, txLock: sync.Mutex{}, db: tx}
-	return &txRDBMS, nil
+	return r.txCopy(tx), nil
+}
+
+// txCopy returns an engine with the same options as r, backed by a transaction
+func (r *RDBMS) txCopy(db db) *RDBMS {
+	return &RDBMS{
+		testEventsLock:         &sync.Mutex{},
+		frameworkEventsLock:    &sync.Mutex{},
+		txLock:                 &sync.Mutex{},
+		savepoints:             new(uint64),
+		db:                     db,
+		positionalPlaceholders: r.positionalPlaceholders,
+		compressor:             r.compressor,
+		compressionThreshold:   r.compressionThreshold,
+		slowQueryThreshold:     r.slowQueryThreshold,
+	}
 }
 
-// Commit persists the current transaction, if there is one active
+// flush writes the buffered events to the database
+func (r *RDBMS) flush() error {
+	r.testEventsLock.Lock()
+	err := r.flushTestEvents()
+	r.testEventsLock.Unlock()
+	if err != nil {
+		return err
+	}
+	r.frameworkEventsLock.Lock()
+	defer r.frameworkEventsLock.Unlock()
+	return r.flushFrameworkEvents()
+}
+
+// Commit persists the current transaction, if there is one active. Committing
+// a nested transaction releases its savepoint, and its writes are persisted
+// along with the enclosing transaction.
 func (r *RDBMS) Commit() error {
 	tx, ok := r.db.(tx)
 	if !ok {
 		return fmt.Errorf("no active transaction")
 	}
+	if r.savepoint != "" {
+		r.lockTx()
+		defer r.unlockTx()
+		_, err := r.exec("release savepoint " + r.savepoint)
+		return err
+	}
 	return tx.Commit()
 }
 
-// Rollback rolls back the current transaction, if there is one active
+// Rollback rolls back the current transaction, if there is one active. Rolling
+// back a nested transaction only discards the writes since its savepoint.
 func (r *RDBMS) Rollback() error {
 	tx, ok := r.db.(tx)
 	if !ok {
 		return fmt.Errorf("no active transaction")
 	}
+	if r.savepoint != "" {
+		r.lockTx()
+		defer r.unlockTx()
+		_, err := r.exec("rollback to savepoint " + r.savepoint)
+		return err
+	}
 	return tx.Rollback()
 }
 
@@ -129,6 +265,9 @@ func (r *RDBMS) init() error {
 	if err != nil {
 		return fmt.Errorf("could not initialize database: %v", err)
 	}
+	if r.maxOpenConns > 0 {
+		sqlDb.SetMaxOpenConns(r.maxOpenConns)
+	}
 	r.db = sqlDb
 
 	if r.testEventsFlushInterval > 0 {
@@ -204,6 +343,42 @@ func DriverName(name string) Opt {
 	}
 }
 
+// PositionalPlaceholders makes the queries use $1, $2, ... as placeholders,
+// for databases which do not support ?, e.g. PostgreSQL. It also makes job
+// IDs be returned by the insert statement, as such databases usually do not
+// support retrieving the last inserted ID.
+func PositionalPlaceholders() Opt {
+	return func(rdbms *RDBMS) {
+		rdbms.positionalPlaceholders = true
+	}
+}
+
+// MaxOpenConns limits the number of open connections to the database, e.g.
+// for databases which do not support concurrent writers, like SQLite.
+func MaxOpenConns(n int) Opt {
+	return func(rdbms *RDBMS) {
+		rdbms.maxOpenConns = n
+	}
+}
+
+// PayloadCompression compresses the event payloads of at least threshold
+// bytes with the named compressor, see RegisterCompressor. Compressed
+// payloads are decompressed transparently when fetching events.
+func PayloadCompression(name string, threshold int) Opt {
+	return func(rdbms *RDBMS) {
+		rdbms.compressionName = name
+		rdbms.compressionThreshold = threshold
+	}
+}
+
+// SlowQueryThreshold logs the statements which take at least the given
+// duration. If zero, no statement is logged.
+func SlowQueryThreshold(threshold time.Duration) Opt {
+	return func(rdbms *RDBMS) {
+		rdbms.slowQueryThreshold = threshold
+	}
+}
+
 // New creates a RDBMS events storage backend with default parameters
 func New(dbURI string, opts ...Opt) (storage.Storage, error) {
 
@@ -212,6 +387,13 @@ func New(dbURI string, opts ...Opt) (storage.Storage, error) {
 	for _, Opt := range opts {
 		Opt(&rdbms)
 	}
+	if rdbms.compressionName != "" {
+		c, ok := getCompressor(rdbms.compressionName)
+		if !ok {
+			return nil, fmt.Errorf("unknown payload compressor '%s'", rdbms.compressionName)
+		}
+		rdbms.compressor = c
+	}
 	if err := rdbms.init(); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,66 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package rdbms
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRebind(t *testing.T) {
+	query := "select job_id from jobs where job_id = ? and name in (?, ?)"
+	r := RDBMS{}
+	require.Equal(t, query, r.rebind(query))
+	PositionalPlaceholders()(&r)
+	require.Equal(t, "select job_id from jobs where job_id = $1 and name in ($2, $3)", r.rebind(query))
+}
+
+// recordingTx is a transaction which records the statements it executes
+type recordingTx struct {
+	statements *[]string
+}
+
+func (t recordingTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	*t.statements = append(*t.statements, query)
+	return nil, nil
+}
+
+func (t recordingTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (t recordingTx) Commit() error {
+	*t.statements = append(*t.statements, "commit")
+	return nil
+}
+
+func (t recordingTx) Rollback() error {
+	*t.statements = append(*t.statements, "rollback")
+	return nil
+}
+
+func TestNestedTransactions(t *testing.T) {
+	var statements []string
+	r := (&RDBMS{}).txCopy(recordingTx{statements: &statements})
+
+	nested, err := r.BeginTx()
+	require.NoError(t, err)
+	require.NoError(t, nested.Commit())
+	nested, err = r.BeginTx()
+	require.NoError(t, err)
+	require.NoError(t, nested.Rollback())
+	require.NoError(t, r.Commit())
+	require.Equal(t, []string{
+		"savepoint contest_savepoint_1",
+		"release savepoint contest_savepoint_1",
+		"savepoint contest_savepoint_2",
+		"rollback to savepoint contest_savepoint_2",
+		"commit",
+	}, statements)
+}
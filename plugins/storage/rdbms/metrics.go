@@ -0,0 +1,57 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package rdbms
+
+import (
+	"expvar"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/metrics"
+)
+
+// storageMetrics are published via expvar, as "contest_rdbms", and they are
+// shared by all the rdbms storage engines of the process. Counters are:
+//
+// * queries, execs: statements run, and query_errors, exec_errors the failed ones
+// * slow_queries: statements which took longer than the slow query threshold
+// * test_events_inserted, framework_events_inserted: events written
+//
+// Histograms are query_seconds and exec_seconds, the latency of statements,
+// and test_events_batch_size and framework_events_batch_size, the number of
+// events written by each flush. The latency of queries does not include
+// scanning their rows.
+var storageMetrics = expvar.NewMap("contest_rdbms")
+
+var (
+	queryLatency             = metrics.NewHistogram(metrics.DefaultLatencyBuckets)
+	execLatency              = metrics.NewHistogram(metrics.DefaultLatencyBuckets)
+	testEventsBatchSize      = metrics.NewHistogram(metrics.DefaultSizeBuckets)
+	frameworkEventsBatchSize = metrics.NewHistogram(metrics.DefaultSizeBuckets)
+	statementLatency         = map[string]*metrics.Histogram{"query": queryLatency, "exec": execLatency}
+)
+
+func init() {
+	storageMetrics.Set("query_seconds", queryLatency)
+	storageMetrics.Set("exec_seconds", execLatency)
+	storageMetrics.Set("test_events_batch_size", testEventsBatchSize)
+	storageMetrics.Set("framework_events_batch_size", frameworkEventsBatchSize)
+}
+
+// observe records the outcome of a statement of the given kind, either
+// "query" or "exec", which started at the given time, and logs it if it was
+// slow. Arguments are not logged, as they may hold large event payloads.
+func (r *RDBMS) observe(kind, statement string, start time.Time, err error) {
+	elapsed := time.Since(start)
+	storageMetrics.Add(kind+"s", 1)
+	if err != nil {
+		storageMetrics.Add(kind+"_errors", 1)
+	}
+	statementLatency[kind].Observe(elapsed.Seconds())
+	if r.slowQueryThreshold > 0 && elapsed >= r.slowQueryThreshold {
+		storageMetrics.Add("slow_queries", 1)
+		log.Warningf("Slow %s took %v: %s", kind, elapsed, statement)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package rdbms
+
+import (
+	"database/sql"
+	"errors"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// failingDB fails all the statements, after the given delay
+type failingDB struct {
+	delay time.Duration
+}
+
+func (d failingDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	time.Sleep(d.delay)
+	return nil, errors.New("exec failed")
+}
+
+func (d failingDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	time.Sleep(d.delay)
+	return nil, errors.New("query failed")
+}
+
+func counter(name string) int64 {
+	if v, ok := storageMetrics.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestStatementMetrics(t *testing.T) {
+	execs, execErrors, slow := counter("execs"), counter("exec_errors"), counter("slow_queries")
+	queries := queryLatency.Snapshot().Count
+
+	r := RDBMS{db: failingDB{}, slowQueryThreshold: time.Hour}
+	_, err := r.exec("delete from jobs")
+	require.Error(t, err)
+	require.Equal(t, execs+1, counter("execs"))
+	require.Equal(t, execErrors+1, counter("exec_errors"))
+	require.Equal(t, slow, counter("slow_queries"))
+
+	r = RDBMS{db: failingDB{delay: time.Millisecond}, slowQueryThreshold: time.Millisecond}
+	_, err = r.query("select job_id from jobs")
+	require.Error(t, err)
+	require.Equal(t, slow+1, counter("slow_queries"))
+	require.Equal(t, queries+1, queryLatency.Snapshot().Count)
+}
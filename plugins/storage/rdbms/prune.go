@@ -0,0 +1,99 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package rdbms
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/storage"
+)
+
+// endedJobs selects the jobs which emitted one of the final state events
+// before a given time. The nested select lets MySQL delete framework events
+// while selecting from them.
+func endedJobs(endStates []event.Name) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(endStates)), ",")
+	return "select job_id from (select distinct job_id from framework_events where event_name in (" + placeholders + ") and emit_time<?) as ended_jobs"
+}
+
+// pruneRows deletes the rows of a table matching the condition, or counts
+// them in dry-run mode.
+func (r *RDBMS) pruneRows(table, condition string, dryRun bool, args ...interface{}) (int64, error) {
+	if dryRun {
+		rows, err := r.query(fmt.Sprintf("select count(*) from %s where %s", table, condition), args...)
+		if err != nil {
+			return 0, fmt.Errorf("could not count rows of %s: %v", table, err)
+		}
+		defer func() {
+			if err := rows.Close(); err != nil {
+				log.Warningf("could not close rows for %s: %v", table, err)
+			}
+		}()
+		var count int64
+		if rows.Next() {
+			if err := rows.Scan(&count); err != nil {
+				return 0, fmt.Errorf("could not count rows of %s: %v", table, err)
+			}
+		}
+		return count, rows.Err()
+	}
+	res, err := r.exec(fmt.Sprintf("delete from %s where %s", table, condition), args...)
+	if err != nil {
+		return 0, fmt.Errorf("could not delete rows of %s: %v", table, err)
+	}
+	count, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("could not get deleted rows of %s: %v", table, err)
+	}
+	return count, nil
+}
+
+// Prune deletes the events emitted before the given time by the jobs which
+// ended before it and, if jobs is set, the requests, reports, target results
+// and tags of those jobs requested before it. The framework events are
+// deleted last, as the jobs which ended are found from them.
+func (r *RDBMS) Prune(before time.Time, endStates []event.Name, jobs, dryRun bool) (storage.PruneStats, error) {
+	var stats storage.PruneStats
+	if len(endStates) == 0 {
+		return stats, fmt.Errorf("no final state event of the jobs")
+	}
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	ended := endedJobs(endStates)
+	endedArgs := make([]interface{}, 0, len(endStates)+2)
+	for _, name := range endStates {
+		endedArgs = append(endedArgs, string(name))
+	}
+	endedArgs = append(endedArgs, before)
+	eventArgs := append([]interface{}{before}, endedArgs...)
+
+	var err error
+	if stats.TestEvents, err = r.pruneRows("test_events", "emit_time<? and job_id in ("+ended+")", dryRun, eventArgs...); err != nil {
+		return stats, err
+	}
+	if jobs {
+		// reports, target results and tags reference jobs, so they are
+		// deleted first
+		oldJobs := "select job_id from jobs where request_time<? and job_id in (" + ended + ")"
+		for _, table := range []string{"run_reports", "final_reports", "target_results", "job_tags"} {
+			if _, err := r.pruneRows(table, "job_id in ("+oldJobs+")", dryRun, eventArgs...); err != nil {
+				return stats, err
+			}
+		}
+		if stats.Jobs, err = r.pruneRows("jobs", "request_time<? and job_id in ("+ended+")", dryRun, eventArgs...); err != nil {
+			return stats, err
+		}
+	}
+	if stats.FrameworkEvents, err = r.pruneRows("framework_events", "emit_time<? and job_id in ("+ended+")", dryRun, eventArgs...); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
@@ -22,7 +22,7 @@ func (r *RDBMS) StoreJobReport(jobReport *job.JobReport) error {
 
 	for runID, runReports := range jobReport.RunReports {
 		for _, report := range runReports {
-			insertStatement := "insert into run_reports (job_id, run_id, reporter_name, success, report_time, data) values (?, ?, ?, ?, ?, ?)"
+			insertStatement := "insert into run_reports (job_id, run_id, reporter_name, success, report_time, schema_version, data) values (?, ?, ?, ?, ?, ?, ?)"
 			reportJSON, err := report.ToJSON()
 			if err != nil {
 				return fmt.Errorf("could not serialize run report for job %v: %v", jobReport.JobID, err)
@@ -30,20 +30,20 @@ func (r *RDBMS) StoreJobReport(jobReport *job.JobReport) error {
 			// note: run ID is a zero-based index, while the run number starts
 			// at 1 (hence the +1). We store the run number, not the run ID. A
 			// zero value means that something is wrong.
-			if _, err := r.db.Exec(insertStatement, jobReport.JobID, runID+1, report.ReporterName, report.Success, report.ReportTime, reportJSON); err != nil {
+			if _, err := r.exec(insertStatement, jobReport.JobID, runID+1, report.ReporterName, report.Success, report.ReportTime, report.SchemaVersion, reportJSON); err != nil {
 				return fmt.Errorf("could not store run report for job %v: %v", jobReport.JobID, err)
 			}
 		}
 	}
 	for _, report := range jobReport.FinalReports {
-		insertStatement := "insert into final_reports (job_id, reporter_name, success, report_time, data) values (?, ?, ?, ?, ?)"
+		insertStatement := "insert into final_reports (job_id, reporter_name, success, report_time, schema_version, data) values (?, ?, ?, ?, ?, ?)"
 		reportJSON, err := report.ToJSON()
 		if err != nil {
 			return fmt.Errorf("could not serialize final report for job %v: %v", jobReport.JobID, err)
 		}
 		// note: run ID is a zero-based index, while the run number starts
 		// at 1 (hence the +1). We store the run number, not the run ID.
-		if _, err := r.db.Exec(insertStatement, jobReport.JobID, report.ReporterName, report.Success, report.ReportTime, reportJSON); err != nil {
+		if _, err := r.exec(insertStatement, jobReport.JobID, report.ReporterName, report.Success, report.ReportTime, report.SchemaVersion, reportJSON); err != nil {
 			return fmt.Errorf("could not store final report for job %v: %v", jobReport.JobID, err)
 		}
 	}
@@ -64,9 +64,9 @@ func (r *RDBMS) GetJobReport(jobID types.JobID) (*job.JobReport, error) {
 
 	// get run reports. Don't change the order by asc, because
 	// the code below assumes sorted results by ascending run number.
-	selectStatement := "select success, report_time, reporter_name, run_id, data from run_reports where job_id = ? order by run_id asc"
+	selectStatement := "select success, report_time, reporter_name, run_id, schema_version, data from run_reports where job_id = ? order by run_id asc"
 	log.Debugf("Executing query: %s", selectStatement)
-	rows, err := r.db.Query(selectStatement, jobID)
+	rows, err := r.query(selectStatement, jobID)
 	if err != nil {
 		return nil, fmt.Errorf("could not get run report for job %v: %v", jobID, err)
 	}
@@ -89,6 +89,7 @@ func (r *RDBMS) GetJobReport(jobID types.JobID) (*job.JobReport, error) {
 			&report.ReportTime,
 			&report.ReporterName,
 			&currentRunID,
+			&report.SchemaVersion,
 			&data,
 		)
 		// Fetch fetches a Job request from storage based on job id
@@ -125,9 +126,9 @@ func (r *RDBMS) GetJobReport(jobID types.JobID) (*job.JobReport, error) {
 	}
 
 	// get final reports
-	selectStatement = "select success, report_time, reporter_name, data from final_reports where job_id = ?"
+	selectStatement = "select success, report_time, reporter_name, schema_version, data from final_reports where job_id = ?"
 	log.Debugf("Executing query: %s", selectStatement)
-	rows, err = r.db.Query(selectStatement, jobID)
+	rows, err = r.query(selectStatement, jobID)
 	if err != nil {
 		return nil, fmt.Errorf("could not get final report for job %v: %v", jobID, err)
 	}
@@ -148,6 +149,7 @@ func (r *RDBMS) GetJobReport(jobID types.JobID) (*job.JobReport, error) {
 			&report.Success,
 			&report.ReportTime,
 			&report.ReporterName,
+			&report.SchemaVersion,
 			&data,
 		)
 		if err != nil {
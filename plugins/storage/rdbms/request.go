@@ -8,23 +8,56 @@ package rdbms
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/storage"
 	"github.com/facebookincubator/contest/pkg/test"
 	"github.com/facebookincubator/contest/pkg/types"
 )
 
-// StoreJobRequest stores a new job request in the database
+// StoreJobRequest stores a new job request in the database, along with the
+// tags of the job
 func (r *RDBMS) StoreJobRequest(request *job.Request) (types.JobID, error) {
 
-	var jobID types.JobID
-
 	r.lockTx()
 	defer r.unlockTx()
 
+	jobID, err := r.insertJobRequest(request)
+	if err != nil {
+		return jobID, err
+	}
+	if err := r.insertJobTags(jobID, request.Tags); err != nil {
+		return jobID, err
+	}
+	return jobID, nil
+}
+
+func (r *RDBMS) insertJobRequest(request *job.Request) (types.JobID, error) {
+
+	var jobID types.JobID
+
 	// store job descriptor
-	insertStatement := "insert into jobs (name, descriptor, teststeps, requestor, server_id, request_time) values (?, ?, ?, ?, ?, ?)"
-	result, err := r.db.Exec(insertStatement, request.JobName, request.JobDescriptor, request.TestDescriptors, request.Requestor, request.ServerID, request.RequestTime)
+	insertStatement := "insert into jobs (name, descriptor, teststeps, requestor, server_id, request_time, schedule_id, retry_of, rerun_of) values (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	if r.positionalPlaceholders {
+		rows, err := r.query(insertStatement+" returning job_id", request.JobName, request.JobDescriptor, request.TestDescriptors, request.Requestor, request.ServerID, request.RequestTime, request.ScheduleID, request.RetryOf, request.RerunOf)
+		if err != nil {
+			return jobID, fmt.Errorf("could not store job request in database: %w", err)
+		}
+		defer func() {
+			if err := rows.Close(); err != nil {
+				log.Warningf("could not close rows for job request: %v", err)
+			}
+		}()
+		if !rows.Next() {
+			return jobID, fmt.Errorf("could not extract id of last request inserted into db: %v", rows.Err())
+		}
+		if err := rows.Scan(&jobID); err != nil {
+			return jobID, fmt.Errorf("could not extract id of last request inserted into db: %v", err)
+		}
+		return jobID, nil
+	}
+	result, err := r.exec(insertStatement, request.JobName, request.JobDescriptor, request.TestDescriptors, request.Requestor, request.ServerID, request.RequestTime, request.ScheduleID, request.RetryOf, request.RerunOf)
 	if err != nil {
 		return jobID, fmt.Errorf("could not store job request in database: %w", err)
 	}
@@ -37,15 +70,55 @@ func (r *RDBMS) StoreJobRequest(request *job.Request) (types.JobID, error) {
 	return jobID, nil
 }
 
+// insertJobTags stores the tags of a job, once each
+func (r *RDBMS) insertJobTags(jobID types.JobID, tags []string) error {
+	stored := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if stored[tag] {
+			continue
+		}
+		stored[tag] = true
+		if _, err := r.exec("insert into job_tags (job_id, tag) values (?, ?)", jobID, tag); err != nil {
+			return fmt.Errorf("could not store tag '%s' of job %d in database: %w", tag, jobID, err)
+		}
+	}
+	return nil
+}
+
+// selectJobTags reads the tags of a job, in alphabetical order
+func (r *RDBMS) selectJobTags(jobID types.JobID) ([]string, error) {
+	rows, err := r.query("select tag from job_tags where job_id = ? order by tag", jobID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get tags of job %d: %v", jobID, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warningf("could not close rows for job tags: %v", err)
+		}
+	}()
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("could not get tags of job %d: %v", jobID, err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not get tags of job %d: %v", jobID, err)
+	}
+	return tags, nil
+}
+
 // GetJobRequest retrieves a JobRequest from the database
 func (r *RDBMS) GetJobRequest(jobID types.JobID) (*job.Request, error) {
 
 	r.lockTx()
 	defer r.unlockTx()
 
-	selectStatement := "select job_id, name, requestor, server_id, request_time, descriptor, teststeps from jobs where job_id = ?"
+	selectStatement := "select job_id, name, requestor, server_id, request_time, descriptor, teststeps, schedule_id, retry_of, rerun_of from jobs where job_id = ?"
 	log.Debugf("Executing query: %s", selectStatement)
-	rows, err := r.db.Query(selectStatement, jobID)
+	rows, err := r.query(selectStatement, jobID)
 	if err != nil {
 		return nil, fmt.Errorf("could not get job request with id %v: %v", jobID, err)
 	}
@@ -75,6 +148,9 @@ func (r *RDBMS) GetJobRequest(jobID types.JobID) (*job.Request, error) {
 			&currRequest.RequestTime,
 			&currRequest.JobDescriptor,
 			&currRequest.TestDescriptors,
+			&currRequest.ScheduleID,
+			&currRequest.RetryOf,
+			&currRequest.RerunOf,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("could not get job request with job id %v: %v", jobID, err)
@@ -84,6 +160,9 @@ func (r *RDBMS) GetJobRequest(jobID types.JobID) (*job.Request, error) {
 	if !found {
 		return nil, fmt.Errorf("no job request found for job ID %d", jobID)
 	}
+	if req.Tags, err = r.selectJobTags(jobID); err != nil {
+		return nil, err
+	}
 	// check that job descriptor is valid JSON
 	var jobDesc job.JobDescriptor
 	if err := json.Unmarshal([]byte(req.JobDescriptor), &jobDesc); err != nil {
@@ -100,3 +179,100 @@ func (r *RDBMS) GetJobRequest(jobID types.JobID) (*job.Request, error) {
 	}
 	return req, nil
 }
+
+// ListJobs returns the IDs of the jobs matching the query, most recent first
+func (r *RDBMS) ListJobs(query *storage.JobQuery) ([]types.JobID, error) {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	var (
+		selectClauses []string
+		fields        []interface{}
+	)
+	if query.Requestor != "" {
+		selectClauses = append(selectClauses, "requestor=?")
+		fields = append(fields, query.Requestor)
+	}
+	if query.ScheduleID != 0 {
+		selectClauses = append(selectClauses, "schedule_id=?")
+		fields = append(fields, query.ScheduleID)
+	}
+	if query.ServerID != "" {
+		selectClauses = append(selectClauses, "server_id=?")
+		fields = append(fields, query.ServerID)
+	}
+	if query.RetryOf != 0 {
+		selectClauses = append(selectClauses, "retry_of=?")
+		fields = append(fields, query.RetryOf)
+	}
+	if query.RerunOf != 0 {
+		selectClauses = append(selectClauses, "rerun_of=?")
+		fields = append(fields, query.RerunOf)
+	}
+	for _, tag := range query.Tags {
+		selectClauses = append(selectClauses, "job_id in (select job_id from job_tags where tag=?)")
+		fields = append(fields, tag)
+	}
+	if !query.RequestedAfter.IsZero() {
+		selectClauses = append(selectClauses, "request_time>=?")
+		fields = append(fields, query.RequestedAfter)
+	}
+	if !query.RequestedBefore.IsZero() {
+		selectClauses = append(selectClauses, "request_time<?")
+		fields = append(fields, query.RequestedBefore)
+	}
+	selectStatement := "select job_id, name from jobs"
+	if len(selectClauses) > 0 {
+		selectStatement += " where " + strings.Join(selectClauses, " and ")
+	}
+	selectStatement += " order by job_id desc"
+	// names are matched after reading the jobs, and so is the pagination
+	if !query.HasNameFilter() {
+		page, pageFields := pagination(query.Limit, query.Offset)
+		selectStatement += page
+		fields = append(fields, pageFields...)
+	}
+	log.Debugf("Executing query: %s, fields: %v", selectStatement, fields)
+	rows, err := r.query(selectStatement, fields...)
+	if err != nil {
+		return nil, fmt.Errorf("could not list jobs: %v", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warningf("could not close rows for jobs: %v", err)
+		}
+	}()
+	jobIDs := []types.JobID{}
+	for rows.Next() {
+		var (
+			jobID types.JobID
+			name  string
+		)
+		if err := rows.Scan(&jobID, &name); err != nil {
+			return nil, fmt.Errorf("could not list jobs: %v", err)
+		}
+		if query.MatchName(name) {
+			jobIDs = append(jobIDs, jobID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("could not list jobs: %v", err)
+	}
+	if query.HasNameFilter() {
+		jobIDs = paginateJobs(jobIDs, query.Limit, query.Offset)
+	}
+	return jobIDs, nil
+}
+
+// paginateJobs returns the page of the job IDs selected by limit and offset.
+func paginateJobs(jobIDs []types.JobID, limit, offset uint) []types.JobID {
+	if offset >= uint(len(jobIDs)) {
+		return []types.JobID{}
+	}
+	jobIDs = jobIDs[offset:]
+	if limit > 0 && limit < uint(len(jobIDs)) {
+		jobIDs = jobIDs[:limit]
+	}
+	return jobIDs
+}
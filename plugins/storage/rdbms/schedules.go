@@ -0,0 +1,184 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package rdbms
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/types"
+)
+
+// nullTime maps the zero time to NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// StoreSchedule inserts a new schedule in the schedules table
+func (r *RDBMS) StoreSchedule(schedule *storage.Schedule) (types.ScheduleID, error) {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	insertStatement := "insert into schedules (name, requestor, cron, descriptor, paused, create_time, last_run_time, last_job_id, last_error) values (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	fields := []interface{}{
+		schedule.Name,
+		schedule.Requestor,
+		schedule.Cron,
+		schedule.JobDescriptor,
+		schedule.Paused,
+		schedule.CreateTime,
+		nullTime(schedule.LastRunTime),
+		schedule.LastJobID,
+		schedule.LastError,
+	}
+	if r.positionalPlaceholders {
+		rows, err := r.query(insertStatement+" returning schedule_id", fields...)
+		if err != nil {
+			return 0, fmt.Errorf("could not store schedule in database: %w", err)
+		}
+		defer func() {
+			if err := rows.Close(); err != nil {
+				log.Warningf("could not close rows for schedule: %v", err)
+			}
+		}()
+		if !rows.Next() {
+			return 0, fmt.Errorf("could not extract id of last schedule inserted into db: %v", rows.Err())
+		}
+		if err := rows.Scan(&schedule.ID); err != nil {
+			return 0, fmt.Errorf("could not extract id of last schedule inserted into db: %v", err)
+		}
+		return schedule.ID, nil
+	}
+	result, err := r.exec(insertStatement, fields...)
+	if err != nil {
+		return 0, fmt.Errorf("could not store schedule in database: %w", err)
+	}
+	lastID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("could not extract id of last schedule inserted into db")
+	}
+	schedule.ID = types.ScheduleID(lastID)
+	return schedule.ID, nil
+}
+
+// UpdateSchedule updates the state of a schedule. The cron expression and the
+// job descriptor of a schedule cannot change. Updating a deleted schedule is
+// not an error, as MySQL does not count the rows left unchanged as affected.
+func (r *RDBMS) UpdateSchedule(schedule *storage.Schedule) error {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	updateStatement := "update schedules set paused = ?, last_run_time = ?, last_job_id = ?, last_error = ? where schedule_id = ?"
+	_, err := r.exec(updateStatement, schedule.Paused, nullTime(schedule.LastRunTime), schedule.LastJobID, schedule.LastError, schedule.ID)
+	if err != nil {
+		return fmt.Errorf("could not update schedule %d: %v", schedule.ID, err)
+	}
+	return nil
+}
+
+// scanSchedules reads the schedules selected by a query
+func scanSchedules(rows *sql.Rows) ([]storage.Schedule, error) {
+	schedules := []storage.Schedule{}
+	for rows.Next() {
+		var (
+			schedule    storage.Schedule
+			lastRunTime sql.NullTime
+			lastError   sql.NullString
+		)
+		if err := rows.Scan(
+			&schedule.ID,
+			&schedule.Name,
+			&schedule.Requestor,
+			&schedule.Cron,
+			&schedule.JobDescriptor,
+			&schedule.Paused,
+			&schedule.CreateTime,
+			&lastRunTime,
+			&schedule.LastJobID,
+			&lastError,
+		); err != nil {
+			return nil, fmt.Errorf("could not read schedules from db: %v", err)
+		}
+		schedule.LastRunTime = lastRunTime.Time
+		schedule.LastError = lastError.String
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
+
+func (r *RDBMS) selectSchedules(clauses string, fields ...interface{}) ([]storage.Schedule, error) {
+	selectStatement := "select schedule_id, name, requestor, cron, descriptor, paused, create_time, last_run_time, last_job_id, last_error from schedules" + clauses
+	log.Debugf("Executing query: %s, fields: %v", selectStatement, fields)
+	rows, err := r.query(selectStatement, fields...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warningf("could not close rows for schedules: %v", err)
+		}
+	}()
+	return scanSchedules(rows)
+}
+
+// GetSchedule retrieves a schedule from the database
+func (r *RDBMS) GetSchedule(id types.ScheduleID) (*storage.Schedule, error) {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	schedules, err := r.selectSchedules(" where schedule_id = ?", id)
+	if err != nil {
+		return nil, fmt.Errorf("could not get schedule %d: %v", id, err)
+	}
+	if len(schedules) == 0 {
+		return nil, storage.ErrScheduleNotFound
+	}
+	return &schedules[0], nil
+}
+
+// ListSchedules returns all the schedules, in the order they were created
+func (r *RDBMS) ListSchedules() ([]storage.Schedule, error) {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	schedules, err := r.selectSchedules(" order by schedule_id")
+	if err != nil {
+		return nil, fmt.Errorf("could not list schedules: %v", err)
+	}
+	return schedules, nil
+}
+
+// DeleteSchedule deletes a schedule from the database
+func (r *RDBMS) DeleteSchedule(id types.ScheduleID) error {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	result, err := r.exec("delete from schedules where schedule_id = ?", id)
+	if err != nil {
+		return fmt.Errorf("could not delete schedule %d: %v", id, err)
+	}
+	return checkScheduleAffected(result)
+}
+
+// checkScheduleAffected returns ErrScheduleNotFound if a statement did not
+// affect any schedule
+func checkScheduleAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not count the affected schedules: %v", err)
+	}
+	if affected == 0 {
+		return storage.ErrScheduleNotFound
+	}
+	return nil
+}
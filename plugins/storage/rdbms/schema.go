@@ -0,0 +1,209 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package rdbms
+
+import (
+	"github.com/facebookincubator/contest/pkg/storage/migration"
+)
+
+// migrations create and upgrade the MySQL schema, see migration.Migration.
+// The first version creates the tables only if they do not exist, so that
+// databases created by the former SQL scripts are upgraded in place.
+// Databases created before report schema versions were introduced must add
+// the schema_version columns to the report tables beforehand.
+var migrations = []migration.Migration{
+	{
+		Version: 1,
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS test_events (
+				event_id BIGINT(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+				job_id BIGINT(20) NOT NULL,
+				run_id BIGINT(20) NOT NULL,
+				test_name VARCHAR(32) NULL,
+				test_step_label VARCHAR(32) NULL,
+				event_name VARCHAR(32) NULL,
+				target_name VARCHAR(64) NULL,
+				target_id VARCHAR(64) NULL,
+				payload TEXT NULL,
+				emit_time TIMESTAMP NOT NULL,
+				PRIMARY KEY (event_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS framework_events (
+				event_id BIGINT(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+				job_id BIGINT(20) NOT NULL,
+				event_name VARCHAR(32) NULL,
+				payload TEXT NULL,
+				emit_time TIMESTAMP NOT NULL,
+				PRIMARY KEY (event_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS run_reports (
+				report_id BIGINT(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+				job_id BIGINT(20) NOT NULL,
+				run_id BIGINT(20) NOT NULL,
+				reporter_name VARCHAR(32) NOT NULL,
+				success TINYINT(1) NULL,
+				report_time TIMESTAMP NOT NULL,
+				schema_version INT NOT NULL DEFAULT 1,
+				data TEXT NOT NULL,
+				PRIMARY KEY (report_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS final_reports (
+				report_id BIGINT(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+				job_id BIGINT(20) NOT NULL,
+				success TINYINT(1) NULL,
+				reporter_name VARCHAR(32) NOT NULL,
+				report_time TIMESTAMP NOT NULL,
+				schema_version INT NOT NULL DEFAULT 1,
+				data TEXT NOT NULL,
+				PRIMARY KEY (report_id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS jobs (
+				job_id BIGINT(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+				name VARCHAR(32) NOT NULL,
+				requestor VARCHAR(32) NOT NULL,
+				server_id VARCHAR(64) NOT NULL,
+				request_time TIMESTAMP NOT NULL,
+				descriptor TEXT NOT NULL,
+				teststeps TEXT,
+				PRIMARY KEY (job_id)
+			)`,
+		},
+	},
+	{
+		Version: 2,
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS target_results (
+				result_id BIGINT(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+				job_id BIGINT(20) NOT NULL,
+				run_id BIGINT(20) NOT NULL,
+				test_name VARCHAR(32) NOT NULL,
+				target_name VARCHAR(64) NOT NULL,
+				target_id VARCHAR(64) NOT NULL,
+				target_fqdn VARCHAR(255) NOT NULL,
+				outcome VARCHAR(16) NOT NULL,
+				failing_step VARCHAR(32) NULL,
+				message TEXT NULL,
+				duration_ms BIGINT(20) NOT NULL,
+				end_time TIMESTAMP NOT NULL,
+				PRIMARY KEY (result_id),
+				INDEX target_results_job_id (job_id, run_id, outcome)
+			)`,
+		},
+	},
+	{
+		Version: 3,
+		Statements: []string{
+			`ALTER TABLE jobs ADD COLUMN schedule_id BIGINT(20) NOT NULL DEFAULT 0`,
+			`CREATE TABLE IF NOT EXISTS schedules (
+				schedule_id BIGINT(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+				name VARCHAR(32) NOT NULL,
+				requestor VARCHAR(32) NOT NULL,
+				cron VARCHAR(128) NOT NULL,
+				descriptor TEXT NOT NULL,
+				paused TINYINT(1) NOT NULL,
+				create_time TIMESTAMP NOT NULL,
+				last_run_time TIMESTAMP NULL,
+				last_job_id BIGINT(20) NOT NULL,
+				last_error TEXT NULL,
+				PRIMARY KEY (schedule_id)
+			)`,
+		},
+	},
+	{
+		Version: 4,
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS templates (
+				name VARCHAR(32) NOT NULL,
+				requestor VARCHAR(32) NOT NULL,
+				template TEXT NOT NULL,
+				create_time TIMESTAMP NOT NULL,
+				update_time TIMESTAMP NOT NULL,
+				PRIMARY KEY (name)
+			)`,
+		},
+	},
+	{
+		Version: 5,
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS job_tags (
+				job_id BIGINT(20) NOT NULL,
+				tag VARCHAR(32) NOT NULL,
+				PRIMARY KEY (job_id, tag),
+				INDEX job_tags_tag (tag)
+			)`,
+			// the tags of the existing jobs are read from their descriptors
+			`INSERT IGNORE INTO job_tags (job_id, tag)
+				SELECT DISTINCT jobs.job_id, LEFT(tags.tag, 32)
+				FROM jobs, JSON_TABLE(
+					IF(JSON_VALID(jobs.descriptor), jobs.descriptor, '{}'),
+					'$.Tags[*]' COLUMNS (tag VARCHAR(255) PATH '$')
+				) AS tags
+				WHERE tags.tag IS NOT NULL`,
+		},
+	},
+	{
+		Version: 6,
+		Statements: []string{
+			`ALTER TABLE jobs ADD COLUMN retry_of BIGINT(20) NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		Version: 7,
+		Statements: []string{
+			`ALTER TABLE jobs ADD COLUMN rerun_of BIGINT(20) NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		Version: 8,
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS servers (
+				server_id VARCHAR(64) NOT NULL,
+				last_heartbeat TIMESTAMP NOT NULL,
+				PRIMARY KEY (server_id)
+			)`,
+			`CREATE INDEX jobs_server_id ON jobs (server_id)`,
+		},
+	},
+	{
+		Version: 9,
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS audit_log (
+				record_id BIGINT(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+				record_time TIMESTAMP NOT NULL,
+				server_id VARCHAR(64) NOT NULL,
+				requestor VARCHAR(32) NOT NULL,
+				action VARCHAR(32) NOT NULL,
+				job_id BIGINT(20) NOT NULL,
+				payload_hash CHAR(64) NOT NULL,
+				error TEXT NULL,
+				PRIMARY KEY (record_id),
+				INDEX audit_log_requestor (requestor, record_time),
+				INDEX audit_log_job_id (job_id)
+			)`,
+		},
+	},
+	{
+		Version: 10,
+		Statements: []string{
+			`ALTER TABLE framework_events ADD COLUMN request_id VARCHAR(64) NOT NULL DEFAULT ''`,
+			`ALTER TABLE audit_log ADD COLUMN request_id VARCHAR(64) NOT NULL DEFAULT ''`,
+		},
+	},
+}
+
+// Migrate creates or upgrades the MySQL schema of the database to the latest
+// version. Only the DriverName option is used.
+func Migrate(dbURI string, opts ...Opt) error {
+	r := RDBMS{}
+	for _, opt := range opts {
+		opt(&r)
+	}
+	driverName := "mysql"
+	if r.driverName != "" {
+		driverName = r.driverName
+	}
+	return migration.Migrate(driverName, dbURI, migration.DefaultTable, migrations)
+}
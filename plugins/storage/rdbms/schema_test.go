@@ -0,0 +1,21 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package rdbms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationsOrdered(t *testing.T) {
+	last := 0
+	for _, m := range migrations {
+		require.Equal(t, last+1, m.Version)
+		require.NotEmpty(t, m.Statements)
+		last = m.Version
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package rdbms
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/target"
+)
+
+// StoreTargetResult inserts the result of a target in the target_results
+// table
+func (r *RDBMS) StoreTargetResult(result storage.TargetResult) error {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	var t target.Target
+	if result.Target != nil {
+		t = *result.Target
+	}
+	insertStatement := "insert into target_results (job_id, run_id, test_name, target_name, target_id, target_fqdn, outcome, failing_step, message, duration_ms, end_time) values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	if _, err := r.exec(insertStatement,
+		result.JobID,
+		result.RunID,
+		result.TestName,
+		t.Name,
+		t.ID,
+		t.FQDN,
+		string(result.Outcome),
+		result.Step,
+		result.Message,
+		result.Duration.Milliseconds(),
+		result.EndTime,
+	); err != nil {
+		return fmt.Errorf("could not store result of target %v for job %d: %v", result.Target, result.JobID, err)
+	}
+	return nil
+}
+
+// buildTargetResultQuery returns the where, order and pagination clauses of a
+// target results query, and their arguments
+func buildTargetResultQuery(query *storage.TargetResultQuery) (string, []interface{}) {
+	clauses := []string{"job_id=?"}
+	fields := []interface{}{query.JobID}
+	if query.RunID != 0 {
+		clauses = append(clauses, "run_id=?")
+		fields = append(fields, query.RunID)
+	}
+	if query.TestName != "" {
+		clauses = append(clauses, "test_name=?")
+		fields = append(fields, query.TestName)
+	}
+	if len(query.Outcomes) > 0 {
+		placeholders := make([]string, 0, len(query.Outcomes))
+		for _, outcome := range query.Outcomes {
+			placeholders = append(placeholders, "?")
+			fields = append(fields, string(outcome))
+		}
+		clauses = append(clauses, fmt.Sprintf("outcome in (%s)", strings.Join(placeholders, ", ")))
+	}
+	page, pageFields := pagination(query.Limit, query.Offset)
+	return " where " + strings.Join(clauses, " and ") + " order by result_id" + page, append(fields, pageFields...)
+}
+
+// GetTargetResults returns the target results matching the query, in the
+// order they were stored
+func (r *RDBMS) GetTargetResults(query *storage.TargetResultQuery) ([]storage.TargetResult, error) {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	clauses, fields := buildTargetResultQuery(query)
+	selectStatement := "select job_id, run_id, test_name, target_name, target_id, target_fqdn, outcome, failing_step, message, duration_ms, end_time from target_results" + clauses
+	log.Debugf("Executing query: %s, fields: %v", selectStatement, fields)
+	rows, err := r.query(selectStatement, fields...)
+	if err != nil {
+		return nil, fmt.Errorf("could not get target results for job %d: %v", query.JobID, err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warningf("could not close rows for target results: %v", err)
+		}
+	}()
+	results := []storage.TargetResult{}
+	for rows.Next() {
+		var (
+			result               storage.TargetResult
+			t                    target.Target
+			outcome              string
+			failingStep, message sql.NullString
+			durationMilliseconds int64
+		)
+		if err := rows.Scan(
+			&result.JobID,
+			&result.RunID,
+			&result.TestName,
+			&t.Name,
+			&t.ID,
+			&t.FQDN,
+			&outcome,
+			&failingStep,
+			&message,
+			&durationMilliseconds,
+			&result.EndTime,
+		); err != nil {
+			return nil, fmt.Errorf("could not read target results from db: %v", err)
+		}
+		result.Target = &t
+		result.Outcome = target.Outcome(outcome)
+		result.Step = failingStep.String
+		result.Message = message.String
+		result.Duration = time.Duration(durationMilliseconds) * time.Millisecond
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
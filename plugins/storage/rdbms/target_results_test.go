@@ -0,0 +1,31 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package rdbms
+
+import (
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildTargetResultQuery(t *testing.T) {
+	stmt, fields := buildTargetResultQuery(&storage.TargetResultQuery{JobID: 1})
+	require.Equal(t, " where job_id=? order by result_id", stmt)
+	require.Equal(t, []interface{}{types.JobID(1)}, fields)
+
+	stmt, fields = buildTargetResultQuery(&storage.TargetResultQuery{
+		JobID:    1,
+		RunID:    2,
+		TestName: "test",
+		Outcomes: []target.Outcome{target.OutcomeFail, target.OutcomeError},
+		Limit:    10,
+	})
+	require.Equal(t, " where job_id=? and run_id=? and test_name=? and outcome in (?, ?) order by result_id limit ? offset ?", stmt)
+	require.Equal(t, []interface{}{types.JobID(1), types.RunID(2), "test", "Fail", "Error", int64(10), int64(0)}, fields)
+}
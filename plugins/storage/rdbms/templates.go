@@ -0,0 +1,123 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package rdbms
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/facebookincubator/contest/pkg/storage"
+)
+
+// StoreTemplate inserts a template in the templates table, or replaces the
+// one with the same name, keeping its creation time
+func (r *RDBMS) StoreTemplate(template *storage.Template) error {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	templates, err := r.selectTemplates(" where name = ?", template.Name)
+	if err != nil {
+		return fmt.Errorf("could not look up template %s: %v", template.Name, err)
+	}
+	if len(templates) > 0 {
+		template.CreateTime = templates[0].CreateTime
+		updateStatement := "update templates set requestor = ?, template = ?, update_time = ? where name = ?"
+		if _, err := r.exec(updateStatement, template.Requestor, template.Template, template.UpdateTime, template.Name); err != nil {
+			return fmt.Errorf("could not update template %s: %v", template.Name, err)
+		}
+		return nil
+	}
+	insertStatement := "insert into templates (name, requestor, template, create_time, update_time) values (?, ?, ?, ?, ?)"
+	if _, err := r.exec(insertStatement, template.Name, template.Requestor, template.Template, template.CreateTime, template.UpdateTime); err != nil {
+		return fmt.Errorf("could not store template %s: %v", template.Name, err)
+	}
+	return nil
+}
+
+func (r *RDBMS) selectTemplates(clauses string, fields ...interface{}) ([]storage.Template, error) {
+	selectStatement := "select name, requestor, template, create_time, update_time from templates" + clauses
+	log.Debugf("Executing query: %s, fields: %v", selectStatement, fields)
+	rows, err := r.query(selectStatement, fields...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Warningf("could not close rows for templates: %v", err)
+		}
+	}()
+	templates := []storage.Template{}
+	for rows.Next() {
+		var template storage.Template
+		if err := rows.Scan(
+			&template.Name,
+			&template.Requestor,
+			&template.Template,
+			&template.CreateTime,
+			&template.UpdateTime,
+		); err != nil {
+			return nil, fmt.Errorf("could not read templates from db: %v", err)
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+// GetTemplate retrieves a template from the database
+func (r *RDBMS) GetTemplate(name string) (*storage.Template, error) {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	templates, err := r.selectTemplates(" where name = ?", name)
+	if err != nil {
+		return nil, fmt.Errorf("could not get template %s: %v", name, err)
+	}
+	if len(templates) == 0 {
+		return nil, storage.ErrTemplateNotFound
+	}
+	return &templates[0], nil
+}
+
+// ListTemplates returns all the templates, sorted by name
+func (r *RDBMS) ListTemplates() ([]storage.Template, error) {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	templates, err := r.selectTemplates(" order by name")
+	if err != nil {
+		return nil, fmt.Errorf("could not list templates: %v", err)
+	}
+	return templates, nil
+}
+
+// DeleteTemplate deletes a template from the database
+func (r *RDBMS) DeleteTemplate(name string) error {
+
+	r.lockTx()
+	defer r.unlockTx()
+
+	result, err := r.exec("delete from templates where name = ?", name)
+	if err != nil {
+		return fmt.Errorf("could not delete template %s: %v", name, err)
+	}
+	return checkTemplateAffected(result)
+}
+
+// checkTemplateAffected returns ErrTemplateNotFound if a statement did not
+// affect any template
+func checkTemplateAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("could not count the affected templates: %v", err)
+	}
+	if affected == 0 {
+		return storage.ErrTemplateNotFound
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package sqlite implements a storage engine backed by an embedded SQLite
+// database, for single-node and development deployments which need durable
+// job and event history without an external database server. It relies on
+// the rdbms storage engine for the queries, and it creates or upgrades the
+// schema of the database via migrations when initialized.
+//
+// The SQLite driver is not linked by this package, as it requires cgo or a
+// large pure Go port: binaries must import a database/sql driver registered
+// as DriverName, e.g. github.com/mattn/go-sqlite3, or set DriverName to the
+// name of the driver in use, e.g. "sqlite" for modernc.org/sqlite.
+package sqlite
+
+import (
+	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/storage/migration"
+	"github.com/facebookincubator/contest/plugins/storage/rdbms"
+)
+
+// DriverName is the name of the database/sql driver used to open the SQLite
+// database.
+var DriverName = "sqlite3"
+
+// migrations create and upgrade the schema of the database, see
+// migration.Migration.
+var migrations = []migration.Migration{
+	{
+		Version: 1,
+		Statements: []string{
+			`CREATE TABLE test_events (
+				event_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				job_id INTEGER NOT NULL,
+				run_id INTEGER NOT NULL,
+				test_name VARCHAR(32) NULL,
+				test_step_label VARCHAR(32) NULL,
+				event_name VARCHAR(32) NULL,
+				target_name VARCHAR(64) NULL,
+				target_id VARCHAR(64) NULL,
+				payload TEXT NULL,
+				emit_time TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX test_events_job_id ON test_events (job_id, run_id)`,
+			`CREATE TABLE framework_events (
+				event_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				job_id INTEGER NOT NULL,
+				event_name VARCHAR(32) NULL,
+				payload TEXT NULL,
+				emit_time TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX framework_events_job_id ON framework_events (job_id)`,
+			`CREATE TABLE run_reports (
+				report_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				job_id INTEGER NOT NULL,
+				run_id INTEGER NOT NULL,
+				reporter_name VARCHAR(32) NOT NULL,
+				success BOOLEAN NULL,
+				report_time TIMESTAMP NOT NULL,
+				schema_version INT NOT NULL DEFAULT 1,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX run_reports_job_id ON run_reports (job_id)`,
+			`CREATE TABLE final_reports (
+				report_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				job_id INTEGER NOT NULL,
+				success BOOLEAN NULL,
+				reporter_name VARCHAR(32) NOT NULL,
+				report_time TIMESTAMP NOT NULL,
+				schema_version INT NOT NULL DEFAULT 1,
+				data TEXT NOT NULL
+			)`,
+			`CREATE INDEX final_reports_job_id ON final_reports (job_id)`,
+			`CREATE TABLE jobs (
+				job_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name VARCHAR(32) NOT NULL,
+				requestor VARCHAR(32) NOT NULL,
+				server_id VARCHAR(64) NOT NULL,
+				request_time TIMESTAMP NOT NULL,
+				descriptor TEXT NOT NULL,
+				teststeps TEXT
+			)`,
+		},
+	},
+	{
+		Version: 2,
+		Statements: []string{
+			`CREATE TABLE target_results (
+				result_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				job_id INTEGER NOT NULL,
+				run_id INTEGER NOT NULL,
+				test_name VARCHAR(32) NOT NULL,
+				target_name VARCHAR(64) NOT NULL,
+				target_id VARCHAR(64) NOT NULL,
+				target_fqdn VARCHAR(255) NOT NULL,
+				outcome VARCHAR(16) NOT NULL,
+				failing_step VARCHAR(32) NULL,
+				message TEXT NULL,
+				duration_ms INTEGER NOT NULL,
+				end_time TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX target_results_job_id ON target_results (job_id, run_id, outcome)`,
+		},
+	},
+	{
+		Version: 3,
+		Statements: []string{
+			`ALTER TABLE jobs ADD COLUMN schedule_id INTEGER NOT NULL DEFAULT 0`,
+			`CREATE TABLE schedules (
+				schedule_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name VARCHAR(32) NOT NULL,
+				requestor VARCHAR(32) NOT NULL,
+				cron VARCHAR(128) NOT NULL,
+				descriptor TEXT NOT NULL,
+				paused BOOLEAN NOT NULL,
+				create_time TIMESTAMP NOT NULL,
+				last_run_time TIMESTAMP NULL,
+				last_job_id INTEGER NOT NULL,
+				last_error TEXT NULL
+			)`,
+		},
+	},
+	{
+		Version: 4,
+		Statements: []string{
+			`CREATE TABLE templates (
+				name VARCHAR(32) PRIMARY KEY,
+				requestor VARCHAR(32) NOT NULL,
+				template TEXT NOT NULL,
+				create_time TIMESTAMP NOT NULL,
+				update_time TIMESTAMP NOT NULL
+			)`,
+		},
+	},
+	{
+		Version: 5,
+		Statements: []string{
+			`CREATE TABLE job_tags (
+				job_id INTEGER NOT NULL,
+				tag VARCHAR(32) NOT NULL,
+				PRIMARY KEY (job_id, tag)
+			)`,
+			`CREATE INDEX job_tags_tag ON job_tags (tag)`,
+			// the tags of the existing jobs are read from their descriptors
+			`INSERT OR IGNORE INTO job_tags (job_id, tag)
+				SELECT DISTINCT jobs.job_id, SUBSTR(tags.value, 1, 32)
+				FROM jobs, json_each(
+					CASE WHEN json_valid(jobs.descriptor) THEN jobs.descriptor ELSE '{}' END,
+					'$.Tags'
+				) AS tags
+				WHERE tags.type = 'text'`,
+		},
+	},
+	{
+		Version: 6,
+		Statements: []string{
+			`ALTER TABLE jobs ADD COLUMN retry_of INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		Version: 7,
+		Statements: []string{
+			`ALTER TABLE jobs ADD COLUMN rerun_of INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		Version: 8,
+		Statements: []string{
+			`CREATE TABLE servers (
+				server_id VARCHAR(64) PRIMARY KEY,
+				last_heartbeat TIMESTAMP NOT NULL
+			)`,
+			`CREATE INDEX jobs_server_id ON jobs (server_id)`,
+		},
+	},
+	{
+		Version: 9,
+		Statements: []string{
+			`CREATE TABLE audit_log (
+				record_id INTEGER PRIMARY KEY AUTOINCREMENT,
+				record_time TIMESTAMP NOT NULL,
+				server_id VARCHAR(64) NOT NULL,
+				requestor VARCHAR(32) NOT NULL,
+				action VARCHAR(32) NOT NULL,
+				job_id INTEGER NOT NULL,
+				payload_hash CHAR(64) NOT NULL,
+				error TEXT NULL
+			)`,
+			`CREATE INDEX audit_log_requestor ON audit_log (requestor, record_time)`,
+			`CREATE INDEX audit_log_job_id ON audit_log (job_id)`,
+		},
+	},
+	{
+		Version: 10,
+		Statements: []string{
+			`ALTER TABLE framework_events ADD COLUMN request_id VARCHAR(64) NOT NULL DEFAULT ''`,
+			`ALTER TABLE audit_log ADD COLUMN request_id VARCHAR(64) NOT NULL DEFAULT ''`,
+		},
+	},
+}
+
+// Migrate creates or upgrades the schema of the database at path to the latest
+// version.
+func Migrate(path string) error {
+	return migration.Migrate(DriverName, path, migration.DefaultTable, migrations)
+}
+
+// New creates a SQLite storage engine backed by the database at path, which
+// is created if it does not exist, migrating its schema if needed. The
+// options are the ones of the rdbms storage engine.
+//
+// SQLite supports a single writer at a time, so the engine uses a single
+// connection. For an in-memory database, which only lives as long as its
+// connections, use a shared cache, e.g. "file::memory:?cache=shared".
+func New(path string, opts ...rdbms.Opt) (storage.Storage, error) {
+	if err := Migrate(path); err != nil {
+		return nil, err
+	}
+	opts = append([]rdbms.Opt{rdbms.DriverName(DriverName), rdbms.MaxOpenConns(1)}, opts...)
+	return rdbms.New(path, opts...)
+}
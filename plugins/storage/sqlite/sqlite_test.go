@@ -0,0 +1,31 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationsOrdered(t *testing.T) {
+	last := 0
+	for _, m := range migrations {
+		require.Equal(t, last+1, m.Version)
+		require.NotEmpty(t, m.Statements)
+		last = m.Version
+	}
+}
+
+func TestNewWithoutDriver(t *testing.T) {
+	origDriverName := DriverName
+	defer func() { DriverName = origDriverName }()
+	DriverName = "contest-nonexistent"
+	_, err := New(filepath.Join(t.TempDir(), "contest.db"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "no database/sql driver registered")
+}
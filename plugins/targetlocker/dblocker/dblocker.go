@@ -245,6 +245,11 @@ func validateTargets(targets []*target.Target) error {
 	return nil
 }
 
+// Name returns the name of the plugin, see target.NamedLocker.
+func (d *DBLocker) Name() string {
+	return Name
+}
+
 // Lock locks the given targets.
 // See target.Locker for API details
 func (d *DBLocker) Lock(jobID types.JobID, targets []*target.Target) error {
@@ -296,6 +301,77 @@ func (d *DBLocker) RefreshLocks(jobID types.JobID, targets []*target.Target) err
 	return d.handleLock(int64(jobID), targetIDList(targets), d.refreshTimeout)
 }
 
+// LockOwners returns the jobs holding valid locks on the given targets.
+// See target.TransferableLocker for API details
+func (d *DBLocker) LockOwners(targets []*target.Target) (map[string]types.JobID, error) {
+	if err := validateTargets(targets); err != nil {
+		return nil, fmt.Errorf("invalid lock owners request: %w", err)
+	}
+	if len(targets) == 0 {
+		return map[string]types.JobID{}, nil
+	}
+	q := "SELECT target_id, job_id FROM locks WHERE expires_at >= ? AND target_id IN " + listQueryString(uint(len(targets))) + ";"
+	queryList := make([]interface{}, 0, len(targets)+1)
+	queryList = append(queryList, time.Now())
+	for _, targetID := range targetIDList(targets) {
+		queryList = append(queryList, targetID)
+	}
+	rows, err := d.db.Query(q, queryList...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read existing locks: %w", err)
+	}
+	defer rows.Close()
+	owners := make(map[string]types.JobID)
+	for rows.Next() {
+		var (
+			targetID string
+			jobID    int64
+		)
+		if err := rows.Scan(&targetID, &jobID); err != nil {
+			return nil, fmt.Errorf("unexpected read from database: %w", err)
+		}
+		owners[targetID] = types.JobID(jobID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("unexpected error iterating db read results: %w", err)
+	}
+	return owners, nil
+}
+
+// TransferLocks hands the valid locks of a job on the given targets over to
+// another job.
+// See target.TransferableLocker for API details
+func (d *DBLocker) TransferLocks(from, to types.JobID, targets []*target.Target) error {
+	if from == 0 || to == 0 {
+		return fmt.Errorf("invalid transfer request, jobIDs cannot be zero (targets: %v)", targets)
+	}
+	if err := validateTargets(targets); err != nil {
+		return fmt.Errorf("invalid transfer request: %w", err)
+	}
+	log.Debugf("Requested to transfer %d locks from job ID %d to job ID %d: %v", len(targets), from, to, targets)
+	if len(targets) == 0 {
+		return nil
+	}
+	upd := "UPDATE locks SET job_id = ? WHERE job_id = ? AND expires_at >= ? AND target_id IN " + listQueryString(uint(len(targets))) + ";"
+	queryList := make([]interface{}, 0, len(targets)+3)
+	queryList = append(queryList, int64(to), int64(from), time.Now())
+	for _, targetID := range targetIDList(targets) {
+		queryList = append(queryList, targetID)
+	}
+	if _, err := d.db.Exec(upd, queryList...); err != nil {
+		return fmt.Errorf("unable to transfer locks on targets %v from owner %d to owner %d: %w", targets, from, to, err)
+	}
+	return nil
+}
+
+// Ping checks that the database is reachable.
+func (d *DBLocker) Ping(ctx context.Context) error {
+	if err := d.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("unable to contact database: %w", err)
+	}
+	return nil
+}
+
 // ResetAllLocks resets the database and clears all locks, regardless of who owns them.
 // This is primarily for testing, and should not be used by used in prod, this
 // is why it is not exposed by target.Locker
@@ -0,0 +1,47 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package dblocker
+
+import (
+	"github.com/facebookincubator/contest/pkg/storage/migration"
+)
+
+// migrationsTable records the schema version of the locks table. It is
+// separate from the one of the storage, which often shares the database.
+const migrationsTable = "locks_schema_migrations"
+
+// migrations create and upgrade the schema of the locks table, see
+// migration.Migration. The first version creates the table only if it does
+// not exist, so that databases created by the former SQL scripts are
+// upgraded in place.
+var migrations = []migration.Migration{
+	{
+		Version: 1,
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS locks (
+				target_id VARCHAR(64) NOT NULL,
+				job_id BIGINT(20) UNSIGNED NOT NULL,
+				created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				expires_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (target_id)
+			)`,
+		},
+	},
+}
+
+// Migrate creates or upgrades the schema of the locks table to the latest
+// version. Only the DriverName option is used.
+func Migrate(dbURI string, opts ...Opt) error {
+	d := DBLocker{}
+	for _, opt := range opts {
+		opt(&d)
+	}
+	driverName := "mysql"
+	if d.driverName != "" {
+		driverName = d.driverName
+	}
+	return migration.Migrate(driverName, dbURI, migrationsTable, migrations)
+}
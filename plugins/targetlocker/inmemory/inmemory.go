@@ -30,6 +30,9 @@ type request struct {
 	// The in-memory locker enforces that the requests are validated against the
 	// right owner.
 	owner types.JobID
+	// newOwner is the job to which the locks of owner are transferred, when
+	// transferring locks.
+	newOwner types.JobID
 	// timeout is how long the lock should be held for. There is no lower or
 	// upper bound on how long the lock can be held.
 	timeout time.Duration
@@ -37,6 +40,9 @@ type request struct {
 	// by a given job ID, and that are not locked by a given job ID. This is only
 	// populated when checking locks for such targets.
 	locked, notLocked []*target.Target
+	// owners are the jobs holding valid locks on the targets, by target ID.
+	// This is only populated when looking up the owners of the locks.
+	owners map[string]types.JobID
 	// err reports whether there were errors in any lock-related operation.
 	err chan error
 }
@@ -63,8 +69,9 @@ func validateRequest(req *request) error {
 // broker is the broker of locking requests, and it's the only goroutine with
 // access to the locks map, in accordance with Go's "share memory by
 // communicating" principle.
-func broker(lockRequests, unlockRequests, checkLocksRequests <-chan *request, done <-chan struct{}) {
-	locks := make(map[target.Target]lock)
+func broker(lockRequests, unlockRequests, checkLocksRequests, ownersRequests, transferRequests <-chan *request, done <-chan struct{}) {
+	// locks are keyed by target ID
+	locks := make(map[string]lock)
 	for {
 		select {
 		case <-done:
@@ -80,16 +87,16 @@ func broker(lockRequests, unlockRequests, checkLocksRequests <-chan *request, do
 			// newLocks is the state of the locks that have been modified by this transaction
 			// If there is an error, we discard newLocks leaving the state of 'locks' untouched
 			// otherwise we update 'locks' with the modifed locks after the transaction has completed
-			newLocks := make(map[target.Target]lock)
+			newLocks := make(map[string]lock)
 			for _, t := range req.targets {
 				now := time.Now()
 
-				if l, ok := locks[*t]; ok {
+				if l, ok := locks[t.ID]; ok {
 					// target has been locked before. Is it still locked, or did
 					// it expire?
 					if now.After(l.expiresAt) {
 						// lock has expired, consider it unlocked
-						newLocks[*t] = lock{
+						newLocks[t.ID] = lock{
 							owner:     req.owner,
 							lockedAt:  now,
 							expiresAt: now.Add(req.timeout),
@@ -99,7 +106,7 @@ func broker(lockRequests, unlockRequests, checkLocksRequests <-chan *request, do
 						if l.owner == req.owner {
 							// we are trying to extend a lock.
 							l.expiresAt = time.Now().Add(req.timeout)
-							newLocks[*t] = l
+							newLocks[t.ID] = l
 						} else {
 							lockErr = fmt.Errorf("lock request: target already locked: %+v (lock: %+v)", t, l)
 							break
@@ -107,7 +114,7 @@ func broker(lockRequests, unlockRequests, checkLocksRequests <-chan *request, do
 					}
 				} else {
 					// target not locked and never seen, create new lock
-					newLocks[*t] = lock{
+					newLocks[t.ID] = lock{
 						owner:     req.owner,
 						lockedAt:  now,
 						expiresAt: now.Add(req.timeout),
@@ -129,9 +136,9 @@ func broker(lockRequests, unlockRequests, checkLocksRequests <-chan *request, do
 			log.Debugf("Requested to transactionally unlock %d targets: %v", len(req.targets), req.targets)
 			var unlockErr error
 			for _, t := range req.targets {
-				if l, ok := locks[*t]; ok {
+				if l, ok := locks[t.ID]; ok {
 					if l.owner == req.owner {
-						delete(locks, *t)
+						delete(locks, t.ID)
 					} else {
 						unlockErr = fmt.Errorf("unlock request: denying unlock request from job ID %d on lock owned by job ID %d", req.owner, l.owner)
 					}
@@ -151,13 +158,13 @@ func broker(lockRequests, unlockRequests, checkLocksRequests <-chan *request, do
 			locked := make([]*target.Target, 0)
 			notLocked := make([]*target.Target, 0)
 			for _, t := range req.targets {
-				if l, ok := locks[*t]; ok {
+				if l, ok := locks[t.ID]; ok {
 					if l.owner == req.owner {
 						now := time.Now()
 						if now.After(l.expiresAt) {
 							// target was locked but lock expired, purge the entry
 							log.Debugf("Purged expired lock for target %+v. Lock time is %s, expiration timeout is %s", t, l.lockedAt, req.timeout)
-							delete(locks, *t)
+							delete(locks, t.ID)
 							notLocked = append(notLocked, t)
 						} else {
 							// target is locked
@@ -175,6 +182,37 @@ func broker(lockRequests, unlockRequests, checkLocksRequests <-chan *request, do
 			req.locked = locked
 			req.notLocked = notLocked
 			req.err <- nil
+		case req := <-ownersRequests:
+			if len(req.targets) == 0 {
+				req.err <- fmt.Errorf("owners request: no target specified")
+				continue
+			}
+			now := time.Now()
+			req.owners = make(map[string]types.JobID)
+			for _, t := range req.targets {
+				if l, ok := locks[t.ID]; ok && !now.After(l.expiresAt) {
+					req.owners[t.ID] = l.owner
+				}
+			}
+			req.err <- nil
+		case req := <-transferRequests:
+			if err := validateRequest(req); err != nil {
+				req.err <- fmt.Errorf("transfer request: %w", err)
+				continue
+			}
+			if req.newOwner == 0 {
+				req.err <- fmt.Errorf("transfer request: new owner cannot be zero")
+				continue
+			}
+			log.Debugf("Requested to transfer locks on %d targets from job ID %d to job ID %d: %v", len(req.targets), req.owner, req.newOwner, req.targets)
+			now := time.Now()
+			for _, t := range req.targets {
+				if l, ok := locks[t.ID]; ok && l.owner == req.owner && !now.After(l.expiresAt) {
+					l.owner = req.newOwner
+					locks[t.ID] = l
+				}
+			}
+			req.err <- nil
 		}
 	}
 }
@@ -182,6 +220,7 @@ func broker(lockRequests, unlockRequests, checkLocksRequests <-chan *request, do
 // InMemory locks targets in an in-memory map.
 type InMemory struct {
 	lockRequests, unlockRequests, checkLocksRequests chan *request
+	ownersRequests, transferRequests                 chan *request
 	done                                             chan struct{}
 	// lockTimeout set on each initial lock request
 	lockTimeout time.Duration
@@ -206,6 +245,11 @@ func (tl *InMemory) Lock(jobID types.JobID, targets []*target.Target) error {
 	return <-req.err
 }
 
+// Name returns the name of the plugin, see target.NamedLocker.
+func (tl *InMemory) Name() string {
+	return Name
+}
+
 // Unlock unlocks the specified targets.
 func (tl *InMemory) Unlock(jobID types.JobID, targets []*target.Target) error {
 	log.Infof("Trying to unlock %d targets", len(targets))
@@ -226,17 +270,41 @@ func (tl *InMemory) RefreshLocks(jobID types.JobID, targets []*target.Target) er
 	return <-req.err
 }
 
+// LockOwners returns the jobs holding valid locks on the specified targets.
+func (tl *InMemory) LockOwners(targets []*target.Target) (map[string]types.JobID, error) {
+	req := newReq(0, targets)
+	tl.ownersRequests <- &req
+	if err := <-req.err; err != nil {
+		return nil, err
+	}
+	return req.owners, nil
+}
+
+// TransferLocks hands the valid locks of a job on the specified targets over
+// to another job.
+func (tl *InMemory) TransferLocks(from, to types.JobID, targets []*target.Target) error {
+	log.Infof("Trying to transfer locks on %d targets from job %d to job %d", len(targets), from, to)
+	req := newReq(from, targets)
+	req.newOwner = to
+	tl.transferRequests <- &req
+	return <-req.err
+}
+
 // New initializes and returns a new InMemory target locker.
 func New(lockTimeout, refreshTimeout time.Duration) target.Locker {
 	lockRequests := make(chan *request)
 	unlockRequests := make(chan *request)
 	checkLocksRequests := make(chan *request)
+	ownersRequests := make(chan *request)
+	transferRequests := make(chan *request)
 	done := make(chan struct{}, 1)
-	go broker(lockRequests, unlockRequests, checkLocksRequests, done)
+	go broker(lockRequests, unlockRequests, checkLocksRequests, ownersRequests, transferRequests, done)
 	return &InMemory{
 		lockRequests:       lockRequests,
 		unlockRequests:     unlockRequests,
 		checkLocksRequests: checkLocksRequests,
+		ownersRequests:     ownersRequests,
+		transferRequests:   transferRequests,
 		done:               done,
 		lockTimeout:        lockTimeout,
 		refreshTimeout:     refreshTimeout,
@@ -164,3 +164,27 @@ func TestLockingTransactional(t *testing.T) {
 	// this means it can be locked by the first owner
 	require.NoError(t, tl.Lock(jobID, []*target.Target{&targetOne}))
 }
+
+func TestInMemoryLockOwners(t *testing.T) {
+	tl := New(10*time.Second, time.Second)
+	owners, err := tl.(target.TransferableLocker).LockOwners(twoTargets)
+	require.NoError(t, err)
+	require.Empty(t, owners)
+	require.NoError(t, tl.Lock(jobID, oneTarget))
+	require.NoError(t, tl.Lock(otherJobID, []*target.Target{&targetTwo}))
+	owners, err = tl.(target.TransferableLocker).LockOwners(twoTargets)
+	require.NoError(t, err)
+	require.Equal(t, map[string]types.JobID{targetOne.ID: jobID, targetTwo.ID: otherJobID}, owners)
+}
+
+func TestInMemoryTransferLocks(t *testing.T) {
+	tl := New(10*time.Second, time.Second)
+	require.NoError(t, tl.Lock(jobID, oneTarget))
+	require.Error(t, tl.Lock(otherJobID, twoTargets))
+	require.NoError(t, tl.(target.TransferableLocker).TransferLocks(jobID, otherJobID, twoTargets))
+	require.NoError(t, tl.Lock(otherJobID, twoTargets))
+	require.Error(t, tl.Lock(jobID, oneTarget))
+	owners, err := tl.(target.TransferableLocker).LockOwners(twoTargets)
+	require.NoError(t, err)
+	require.Equal(t, map[string]types.JobID{targetOne.ID: otherJobID, targetTwo.ID: otherJobID}, owners)
+}
@@ -24,6 +24,11 @@ var log = logging.GetLogger("teststeps/" + strings.ToLower(Name))
 type Noop struct {
 }
 
+// Name returns the name of the plugin, see target.NamedLocker.
+func (tl Noop) Name() string {
+	return Name
+}
+
 // Lock locks the specified targets by doing nothing.
 func (tl Noop) Lock(_ types.JobID, targets []*target.Target) error {
 	log.Infof("Locked %d targets by doing nothing", len(targets))
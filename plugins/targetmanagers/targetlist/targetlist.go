@@ -59,6 +59,40 @@ type TargetList struct {
 	targets []*target.Target
 }
 
+// acquireParametersSchema and releaseParametersSchema are the JSON schemas of
+// the acquire and release parameters. The fields are not required, as they
+// are decoded case-insensitively.
+var (
+	acquireParametersSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"Targets": {
+			"description": "The targets to acquire",
+			"type": "array",
+			"items": {
+				"type": "object",
+				"properties": {
+					"Name": {"type": "string"},
+					"ID": {"type": "string"},
+					"FQDN": {"type": "string"}
+				}
+			}
+		}
+	}
+}`)
+	releaseParametersSchema = json.RawMessage(`{"type": "object"}`)
+)
+
+// AcquireParametersSchema returns the JSON schema of the acquire parameters.
+func (t TargetList) AcquireParametersSchema() json.RawMessage {
+	return acquireParametersSchema
+}
+
+// ReleaseParametersSchema returns the JSON schema of the release parameters.
+func (t TargetList) ReleaseParametersSchema() json.RawMessage {
+	return releaseParametersSchema
+}
+
 // ValidateAcquireParameters performs sanity checks on the fields of the
 // parameters that will be passed to Acquire.
 func (t TargetList) ValidateAcquireParameters(params []byte) (interface{}, error) {
@@ -0,0 +1,301 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package git implements a test fetcher that reads the test step definitions
+// from a file in a git repository, so that they can live next to the code
+// under test.
+package git
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/test"
+	"github.com/insomniacslk/xjson"
+)
+
+// Name defined the name of the plugin
+var (
+	Name = "Git"
+	log  = logging.GetLogger("testfetchers/" + strings.ToLower(Name))
+)
+
+// defaultTimeout is the time allowed to fetch the repository if no timeout
+// is specified in the fetch parameters.
+const defaultTimeout = 5 * time.Minute
+
+// FetchParameters contains the parameters necessary to fetch tests. This
+// structure is populated from a JSON blob.
+type FetchParameters struct {
+	TestName string
+	// Repository is the URL of the git repository, e.g.
+	// https://example.com/repo.git, ssh://git@example.com/repo.git or
+	// git@example.com:repo.git.
+	Repository string
+	// Ref is the branch, tag or commit to fetch. If empty, the default branch
+	// of the repository is used.
+	Ref string
+	// Path is the path of the test definition within the repository. The
+	// file has the same format used by the URI test fetcher.
+	Path string
+	// Username and PasswordFile are the credentials used for HTTPS
+	// repositories. The file contains the password or the access token, so
+	// that it does not end up in the job descriptor.
+	Username     string
+	PasswordFile string
+	// SSHKeyFile is the private key used for SSH repositories, and
+	// KnownHostsFile optionally overrides the known hosts used to verify the
+	// server.
+	//
+	// PasswordFile, SSHKeyFile and KnownHostsFile are names of files in the
+	// credentials directory of the server, see SetCredentialsDir, rather
+	// than paths: job submitters cannot make the server read other files.
+	SSHKeyFile     string
+	KnownHostsFile string
+	// Timeout is the maximum time to fetch the repository. If zero, five
+	// minutes are allowed.
+	Timeout xjson.Duration
+	// CacheOptions control the caching of test definitions. Caching avoids
+	// fetching the repository for every job, but a branch which moved is
+	// only fetched again once the cache expires.
+	test.CacheOptions
+}
+
+// cache holds the fetched test definitions.
+var cache = test.NewDescriptorCache()
+
+// credentialsDir is the directory of the credentials which fetch parameters
+// may use. If empty, fetch parameters cannot use credentials.
+var credentialsDir string
+
+// SetCredentialsDir sets the directory of the files holding the passwords,
+// SSH keys and known hosts which fetch parameters name.
+func SetCredentialsDir(dir string) {
+	credentialsDir = dir
+}
+
+// credentialName matches the names of the files of the credentials
+// directory, which cannot point outside of it.
+var credentialName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// credentialPath returns the path of a file of the credentials directory.
+func credentialPath(name string) (string, error) {
+	if credentialsDir == "" {
+		return "", fmt.Errorf("no credentials directory is configured")
+	}
+	if !credentialName.MatchString(name) {
+		return "", fmt.Errorf("invalid credential name '%s', only letters, digits, '.', '_' and '-' are allowed", name)
+	}
+	return filepath.Join(credentialsDir, name), nil
+}
+
+// shellQuote quotes a string for the shell, which runs the SSH command.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Git implements contest.TestFetcher interface, fetching test steps from a git
+// repository
+type Git struct {
+}
+
+// ValidateFetchParameters performs sanity checks on the fields of the
+// parameters that will be passed to Fetch.
+func (tf Git) ValidateFetchParameters(params []byte) (interface{}, error) {
+	var fp FetchParameters
+	if err := json.Unmarshal(params, &fp); err != nil {
+		return nil, err
+	}
+	if fp.TestName == "" {
+		return nil, fmt.Errorf("test name cannot be empty for fetch parameters")
+	}
+	if fp.Repository == "" {
+		return nil, fmt.Errorf("repository not specified in fetch parameters")
+	}
+	if strings.HasPrefix(fp.Repository, "-") {
+		return nil, fmt.Errorf("invalid repository '%s'", fp.Repository)
+	}
+	if strings.HasPrefix(fp.Ref, "-") {
+		return nil, fmt.Errorf("invalid ref '%s'", fp.Ref)
+	}
+	if fp.Path == "" {
+		return nil, fmt.Errorf("test definition path not specified in fetch parameters")
+	}
+	if filepath.IsAbs(fp.Path) || strings.HasPrefix(filepath.Clean(fp.Path), "..") {
+		return nil, fmt.Errorf("test definition path '%s' must be relative to the repository", fp.Path)
+	}
+	if fp.PasswordFile != "" && fp.Username == "" {
+		return nil, fmt.Errorf("a username is required when a password file is specified")
+	}
+	if fp.KnownHostsFile != "" && fp.SSHKeyFile == "" {
+		return nil, fmt.Errorf("a SSH key file is required when a known hosts file is specified")
+	}
+	for _, name := range []string{fp.PasswordFile, fp.SSHKeyFile, fp.KnownHostsFile} {
+		if name == "" {
+			continue
+		}
+		if _, err := credentialPath(name); err != nil {
+			return nil, err
+		}
+	}
+	if fp.Timeout < 0 {
+		return nil, fmt.Errorf("timeout cannot be negative")
+	}
+	if err := fp.CacheOptions.Validate(); err != nil {
+		return nil, err
+	}
+	return fp, nil
+}
+
+// gitEnv returns the environment for the git commands, which carries the
+// credentials so that they do not show up in the command line.
+func gitEnv(fp FetchParameters) ([]string, error) {
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if fp.PasswordFile != "" {
+		path, err := credentialPath(fp.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		password, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read password file: %v", err)
+		}
+		auth := base64.StdEncoding.EncodeToString([]byte(fp.Username + ":" + strings.TrimSpace(string(password))))
+		env = append(env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth,
+		)
+	}
+	if fp.SSHKeyFile != "" {
+		// git runs the SSH command through the shell
+		keyPath, err := credentialPath(fp.SSHKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		sshCommand := "ssh -i " + shellQuote(keyPath) + " -o IdentitiesOnly=yes -o BatchMode=yes"
+		if fp.KnownHostsFile != "" {
+			knownHostsPath, err := credentialPath(fp.KnownHostsFile)
+			if err != nil {
+				return nil, err
+			}
+			sshCommand += " -o " + shellQuote("UserKnownHostsFile="+knownHostsPath) + " -o StrictHostKeyChecking=yes"
+		}
+		env = append(env, "GIT_SSH_COMMAND="+sshCommand)
+	}
+	return env, nil
+}
+
+// runGit runs a git command in the given directory.
+func runGit(ctx context.Context, dir string, env []string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// fetchFile fetches the repository in a temporary directory, and returns the
+// content of the test definition.
+func fetchFile(fp FetchParameters) ([]byte, error) {
+	env, err := gitEnv(fp)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(fp.Timeout)
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "contest-git-fetcher")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create temporary directory: %v", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Warningf("Cannot remove temporary directory %s: %v", dir, err)
+		}
+	}()
+
+	// fetch only the requested ref, which works for branches, tags and
+	// (on most servers) commits alike
+	ref := fp.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	commands := [][]string{
+		{"init", "--quiet"},
+		{"remote", "add", "origin", fp.Repository},
+		{"fetch", "--quiet", "--depth", "1", "origin", ref},
+		{"checkout", "--quiet", "FETCH_HEAD"},
+	}
+	for _, args := range commands {
+		if err := runGit(ctx, dir, env, args...); err != nil {
+			return nil, fmt.Errorf("cannot fetch %s at ref '%s': %v", fp.Repository, ref, err)
+		}
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(dir, fp.Path))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read test definition: %v", err)
+	}
+	return buf, nil
+}
+
+// Fetch returns the information necessary to build a Test object. The returned
+// values are:
+// * Name of the test
+// * list of step definitions
+// * an error if any
+func (tf *Git) Fetch(params interface{}) (string, []*test.TestStepDescriptor, error) {
+	fetchParams, ok := params.(FetchParameters)
+	if !ok {
+		return "", nil, fmt.Errorf("Fetch expects git.FetchParameters object")
+	}
+	log.Printf("Fetching tests from %s at ref '%s'", fetchParams.Repository, fetchParams.Ref)
+	cacheKey := strings.Join([]string{fetchParams.Repository, fetchParams.Ref, fetchParams.Path, fetchParams.Username, fetchParams.PasswordFile, fetchParams.SSHKeyFile}, " ")
+	buf, err := cache.Fetch(cacheKey, fetchParams.CacheOptions, func() ([]byte, error) {
+		return fetchFile(fetchParams)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	type doc struct {
+		Steps []*test.TestStepDescriptor
+	}
+	var d doc
+	if err := json.Unmarshal(buf, &d); err != nil {
+		return "", nil, fmt.Errorf("cannot decode JSON test description: %v", err)
+	}
+	return fetchParams.TestName, d.Steps, nil
+}
+
+// New initializes the TestFetcher object
+func New() test.TestFetcher {
+	return &Git{}
+}
+
+// Load returns the name and factory which are needed to register the
+// TestFetcher.
+func Load() (string, test.TestFetcherFactory) {
+	return Name, New
+}
@@ -0,0 +1,116 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testDefinition = `{
+    "Steps": [
+        {
+            "name": "echo",
+            "label": "echo_label",
+            "parameters": {"text": ["hello"]}
+        }
+    ]
+}`
+
+// newRepo creates a repository with a test definition on the "tests" branch.
+func newRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "contest"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "contest", "test.json"), []byte(testDefinition), 0644))
+	env := append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"checkout", "--quiet", "-b", "tests"},
+		{"add", "."},
+		{"commit", "--quiet", "-m", "add test"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = env
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	return dir
+}
+
+func TestValidateFetchParameters(t *testing.T) {
+	tf := New().(*Git)
+	_, err := tf.ValidateFetchParameters([]byte(`{"TestName": "test", "Repository": "https://example.com/repo.git", "Path": "test.json"}`))
+	require.NoError(t, err)
+	_, err = tf.ValidateFetchParameters([]byte(`{"TestName": "test", "Path": "test.json"}`))
+	require.Error(t, err)
+	_, err = tf.ValidateFetchParameters([]byte(`{"TestName": "test", "Repository": "https://example.com/repo.git", "Path": "../test.json"}`))
+	require.Error(t, err)
+	_, err = tf.ValidateFetchParameters([]byte(`{"TestName": "test", "Repository": "https://example.com/repo.git", "Path": "test.json", "Ref": "--upload-pack=x"}`))
+	require.Error(t, err)
+	_, err = tf.ValidateFetchParameters([]byte(`{"TestName": "test", "Repository": "https://example.com/repo.git", "Path": "test.json", "PasswordFile": "/tmp/x"}`))
+	require.Error(t, err)
+}
+
+func TestValidateCredentials(t *testing.T) {
+	tf := New().(*Git)
+	params := func(credentials string) []byte {
+		return []byte(`{"TestName": "test", "Repository": "git@example.com:repo.git", "Path": "test.json", ` + credentials + `}`)
+	}
+	SetCredentialsDir("")
+	_, err := tf.ValidateFetchParameters(params(`"SSHKeyFile": "key"`))
+	require.Error(t, err)
+
+	dir := t.TempDir()
+	SetCredentialsDir(dir)
+	defer SetCredentialsDir("")
+	_, err = tf.ValidateFetchParameters(params(`"SSHKeyFile": "key", "KnownHostsFile": "known_hosts"`))
+	require.NoError(t, err)
+	for _, name := range []string{"/etc/passwd", "../key", "..", "key'; touch pwned; '"} {
+		_, err = tf.ValidateFetchParameters(params(`"SSHKeyFile": "` + name + `"`))
+		require.Error(t, err, name)
+		_, err = tf.ValidateFetchParameters(params(`"Username": "user", "PasswordFile": "` + name + `"`))
+		require.Error(t, err, name)
+	}
+}
+
+func TestGitEnvSSHCommand(t *testing.T) {
+	SetCredentialsDir("/etc/contest/it's")
+	defer SetCredentialsDir("")
+	env, err := gitEnv(FetchParameters{SSHKeyFile: "key", KnownHostsFile: "known_hosts"})
+	require.NoError(t, err)
+	require.Contains(t, env, `GIT_SSH_COMMAND=ssh -i '/etc/contest/it'\''s/key' -o IdentitiesOnly=yes -o BatchMode=yes`+
+		` -o 'UserKnownHostsFile=/etc/contest/it'\''s/known_hosts' -o StrictHostKeyChecking=yes`)
+}
+
+func TestFetch(t *testing.T) {
+	repo := newRepo(t)
+	tf := New().(*Git)
+	params, err := tf.ValidateFetchParameters([]byte(`{"TestName": "test", "Repository": "file://` + repo + `", "Ref": "tests", "Path": "contest/test.json"}`))
+	require.NoError(t, err)
+	name, steps, err := tf.Fetch(params)
+	require.NoError(t, err)
+	require.Equal(t, "test", name)
+	require.Len(t, steps, 1)
+	require.Equal(t, "echo", steps[0].Name)
+	require.Equal(t, "echo_label", steps[0].Label)
+
+	params, err = tf.ValidateFetchParameters([]byte(`{"TestName": "test", "Repository": "file://` + repo + `", "Ref": "missing", "Path": "contest/test.json"}`))
+	require.NoError(t, err)
+	_, _, err = tf.Fetch(params)
+	require.Error(t, err)
+}
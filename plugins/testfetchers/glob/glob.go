@@ -0,0 +1,128 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package glob implements a test fetcher which reads all the test definitions
+// matching a glob pattern in the local file system, e.g. a directory with a
+// whole test suite, and returns one test for each of them.
+package glob
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/test"
+)
+
+// Name defined the name of the plugin
+var (
+	Name = "Glob"
+	log  = logging.GetLogger("testfetchers/" + strings.ToLower(Name))
+)
+
+// FetchParameters contains the parameters necessary to fetch tests. This
+// structure is populated from a JSON blob.
+type FetchParameters struct {
+	// Pattern is the glob pattern matching the test definitions, e.g.
+	// /srv/tests/boot/*.json . See filepath.Match for the syntax.
+	Pattern string
+	// TestNamePrefix is prepended to the name of each test.
+	TestNamePrefix string `json:",omitempty"`
+}
+
+// testDefinition is the content of a file. It has the same format used by the
+// URI test fetcher, with an optional test name which defaults to the base
+// name of the file without extension.
+type testDefinition struct {
+	TestName string
+	Steps    []*test.TestStepDescriptor
+}
+
+// Glob implements contest.TestFetcher and test.MultiTestFetcher interfaces,
+// returning a test for each file matching a pattern
+type Glob struct {
+}
+
+// ValidateFetchParameters performs sanity checks on the fields of the
+// parameters that will be passed to Fetch.
+func (tf Glob) ValidateFetchParameters(params []byte) (interface{}, error) {
+	var fp FetchParameters
+	if err := json.Unmarshal(params, &fp); err != nil {
+		return nil, err
+	}
+	if fp.Pattern == "" {
+		return nil, fmt.Errorf("pattern cannot be empty for fetch parameters")
+	}
+	if _, err := filepath.Match(fp.Pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern '%s': %v", fp.Pattern, err)
+	}
+	return fp, nil
+}
+
+// FetchTests returns a test for each file matching the pattern, sorted by
+// file name.
+func (tf *Glob) FetchTests(params interface{}) ([]test.FetchedTest, error) {
+	fetchParams, ok := params.(FetchParameters)
+	if !ok {
+		return nil, fmt.Errorf("FetchTests expects glob.FetchParameters object")
+	}
+	files, err := filepath.Glob(fetchParams.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no test definitions match pattern '%s'", fetchParams.Pattern)
+	}
+	log.Printf("Fetching %d tests matching %s", len(files), fetchParams.Pattern)
+	tests := make([]test.FetchedTest, 0, len(files))
+	for _, file := range files {
+		buf, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var d testDefinition
+		if err := json.Unmarshal(buf, &d); err != nil {
+			return nil, fmt.Errorf("cannot decode JSON test description %s: %v", file, err)
+		}
+		name := d.TestName
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		tests = append(tests, test.FetchedTest{Name: fetchParams.TestNamePrefix + name, Steps: d.Steps})
+	}
+	return tests, nil
+}
+
+// Fetch returns the information necessary to build a Test object. The returned
+// values are:
+// * Name of the test
+// * list of step definitions
+// * an error if any
+// As Fetch can only return one test, it fails if the pattern matches more than
+// one file. Jobs use FetchTests instead.
+func (tf *Glob) Fetch(params interface{}) (string, []*test.TestStepDescriptor, error) {
+	tests, err := tf.FetchTests(params)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(tests) > 1 {
+		return "", nil, fmt.Errorf("pattern matches %d test definitions, only one can be fetched", len(tests))
+	}
+	return tests[0].Name, tests[0].Steps, nil
+}
+
+// New initializes the TestFetcher object
+func New() test.TestFetcher {
+	return &Glob{}
+}
+
+// Load returns the name and factory which are needed to register the
+// TestFetcher.
+func Load() (string, test.TestFetcherFactory) {
+	return Name, New
+}
@@ -0,0 +1,48 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package glob
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchTests(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b_boot.json"), []byte(`{"Steps": [{"name": "echo", "label": "boot"}]}`), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a_flash.json"), []byte(`{"TestName": "flash", "Steps": [{"name": "echo", "label": "flash"}]}`), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README"), []byte(`not a test`), 0644))
+
+	tf := New().(*Glob)
+	params, err := tf.ValidateFetchParameters([]byte(`{"Pattern": "` + filepath.Join(dir, "*.json") + `", "TestNamePrefix": "suite: "}`))
+	require.NoError(t, err)
+	tests, err := tf.FetchTests(params)
+	require.NoError(t, err)
+	require.Len(t, tests, 2)
+	require.Equal(t, "suite: flash", tests[0].Name)
+	require.Equal(t, "flash", tests[0].Steps[0].Label)
+	require.Equal(t, "suite: b_boot", tests[1].Name)
+	require.Equal(t, "boot", tests[1].Steps[0].Label)
+
+	// Fetch can only return one test
+	_, _, err = tf.Fetch(params)
+	require.Error(t, err)
+	params, err = tf.ValidateFetchParameters([]byte(`{"Pattern": "` + filepath.Join(dir, "b_*.json") + `"}`))
+	require.NoError(t, err)
+	name, _, err := tf.Fetch(params)
+	require.NoError(t, err)
+	require.Equal(t, "b_boot", name)
+
+	params, err = tf.ValidateFetchParameters([]byte(`{"Pattern": "` + filepath.Join(dir, "*.yaml") + `"}`))
+	require.NoError(t, err)
+	_, err = tf.FetchTests(params)
+	require.Error(t, err)
+	_, err = tf.ValidateFetchParameters([]byte(`{"Pattern": "[" }`))
+	require.Error(t, err)
+}
@@ -0,0 +1,129 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package s3 implements a test fetcher that reads the test step definitions
+// from an object in an S3-compatible store, e.g. AWS S3, or GCS in
+// interoperability mode.
+package s3
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/facebookincubator/contest/pkg/lib/s3"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/test"
+)
+
+// Name defined the name of the plugin
+var (
+	Name = "S3"
+	log  = logging.GetLogger("testfetchers/" + strings.ToLower(Name))
+)
+
+// FetchParameters contains the parameters necessary to fetch tests. This
+// structure is populated from a JSON blob.
+type FetchParameters struct {
+	TestName string
+	// URI is the location of the test definition, in the form
+	// s3://bucket/key. The object has the same format used by the URI test
+	// fetcher.
+	URI string
+	// VersionID is the version of the object to fetch. Referencing a version
+	// rather than the latest object makes the test definition immutable, as
+	// long as versioning is enabled on the bucket.
+	VersionID string `json:",omitempty"`
+	// Endpoint is the base URL of the store, e.g.
+	// https://storage.googleapis.com for GCS. If empty, the AWS endpoint of
+	// the region is used.
+	Endpoint string `json:",omitempty"`
+	// Region defaults to us-east-1.
+	Region string `json:",omitempty"`
+	// CacheOptions control the caching of test definitions.
+	test.CacheOptions
+}
+
+// cache holds the fetched test definitions.
+var cache = test.NewDescriptorCache()
+
+// S3 implements contest.TestFetcher interface, fetching test steps from an
+// object store. Credentials are read from the standard AWS environment
+// variables.
+type S3 struct {
+}
+
+// ValidateFetchParameters performs sanity checks on the fields of the
+// parameters that will be passed to Fetch.
+func (tf S3) ValidateFetchParameters(params []byte) (interface{}, error) {
+	var fp FetchParameters
+	if err := json.Unmarshal(params, &fp); err != nil {
+		return nil, err
+	}
+	if fp.TestName == "" {
+		return nil, fmt.Errorf("test name cannot be empty for fetch parameters")
+	}
+	_, key, err := s3.ParseURI(fp.URI)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URI in fetch parameters: %v", err)
+	}
+	if key == "" {
+		return nil, fmt.Errorf("missing object key in URI '%s'", fp.URI)
+	}
+	if err := fp.CacheOptions.Validate(); err != nil {
+		return nil, err
+	}
+	return fp, nil
+}
+
+// Fetch returns the information necessary to build a Test object. The returned
+// values are:
+// * Name of the test
+// * list of step definitions
+// * an error if any
+func (tf *S3) Fetch(params interface{}) (string, []*test.TestStepDescriptor, error) {
+	fetchParams, ok := params.(FetchParameters)
+	if !ok {
+		return "", nil, fmt.Errorf("Fetch expects s3.FetchParameters object")
+	}
+	log.Printf("Fetching tests from %s (version '%s')", fetchParams.URI, fetchParams.VersionID)
+	bucket, key, err := s3.ParseURI(fetchParams.URI)
+	if err != nil {
+		return "", nil, err
+	}
+	client := s3.New(fetchParams.Endpoint, fetchParams.Region, s3.CredentialsFromEnv())
+	cacheKey := strings.Join([]string{client.Endpoint, fetchParams.URI, fetchParams.VersionID}, " ")
+	buf, err := cache.Fetch(cacheKey, fetchParams.CacheOptions, func() ([]byte, error) {
+		body, err := client.GetObject(bucket, key, fetchParams.VersionID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot fetch test description: %v", err)
+		}
+		defer body.Close()
+		return ioutil.ReadAll(body)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	type doc struct {
+		Steps []*test.TestStepDescriptor
+	}
+	var d doc
+	if err := json.Unmarshal(buf, &d); err != nil {
+		return "", nil, fmt.Errorf("cannot decode JSON test description: %v", err)
+	}
+	return fetchParams.TestName, d.Steps, nil
+}
+
+// New initializes the TestFetcher object
+func New() test.TestFetcher {
+	return &S3{}
+}
+
+// Load returns the name and factory which are needed to register the
+// TestFetcher.
+func Load() (string, test.TestFetcherFactory) {
+	return Name, New
+}
@@ -0,0 +1,44 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package s3
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchVersion(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bucket/tests/test.json" || r.URL.Query().Get("versionId") != "v1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"Steps": [{"name": "echo", "label": "echo_label", "parameters": {"text": ["hello"]}}]}`))
+	}))
+	defer ts.Close()
+
+	tf := New().(*S3)
+	params, err := tf.ValidateFetchParameters([]byte(`{"TestName": "test", "URI": "s3://bucket/tests/test.json", "VersionID": "v1", "Endpoint": "` + ts.URL + `"}`))
+	require.NoError(t, err)
+	name, steps, err := tf.Fetch(params)
+	require.NoError(t, err)
+	require.Equal(t, "test", name)
+	require.Len(t, steps, 1)
+	require.Equal(t, "echo", steps[0].Name)
+
+	params, err = tf.ValidateFetchParameters([]byte(`{"TestName": "test", "URI": "s3://bucket/tests/test.json", "VersionID": "v2", "Endpoint": "` + ts.URL + `"}`))
+	require.NoError(t, err)
+	_, _, err = tf.Fetch(params)
+	require.Error(t, err)
+
+	_, err = tf.ValidateFetchParameters([]byte(`{"TestName": "test", "URI": "s3://bucket"}`))
+	require.Error(t, err)
+	_, err = tf.ValidateFetchParameters([]byte(`{"TestName": "test", "URI": "https://bucket/test.json"}`))
+	require.Error(t, err)
+}
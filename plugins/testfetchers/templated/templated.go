@@ -0,0 +1,156 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package templated implements a test fetcher which wraps another test
+// fetcher, and expands the test step definitions it returns as templates, with
+// variables supplied by the job. This allows a single parameterized test
+// definition to serve many configurations.
+//
+// Templates use the [[ and ]] delimiters, so that they do not clash with the
+// per-target expansion of step parameters, which uses {{ and }}. For example,
+// with the variable "kernel" set to "5.10", the step parameter
+// "[[ .kernel ]]-{{ .Name }}" becomes "5.10-{{ .Name }}" at fetch time, and
+// then "5.10-host001" when the step runs on target host001.
+package templated
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/pluginregistry"
+	"github.com/facebookincubator/contest/pkg/test"
+)
+
+// Name defined the name of the plugin
+var (
+	Name = "Templated"
+	log  = logging.GetLogger("testfetchers/" + strings.ToLower(Name))
+)
+
+// registry is used to instantiate the wrapped test fetcher.
+var registry *pluginregistry.PluginRegistry
+
+// SetPluginRegistry sets the plugin registry used to look up the wrapped test
+// fetcher. It must be called before any fetch parameters are validated.
+func SetPluginRegistry(pr *pluginregistry.PluginRegistry) {
+	registry = pr
+}
+
+// FetchParameters contains the parameters necessary to fetch tests. This
+// structure is populated from a JSON blob.
+type FetchParameters struct {
+	// Fetcher is the name of the wrapped test fetcher, and FetchParameters
+	// are its parameters. The parameters are expanded as well, so that e.g.
+	// the location of the test definition can depend on the variables.
+	Fetcher         string
+	FetchParameters json.RawMessage
+	// Variables are the values available to the templates. Values are
+	// inserted in the JSON test definition as they are, so they should not
+	// contain double quotes or backslashes.
+	Variables map[string]string
+}
+
+// validatedParameters is what ValidateFetchParameters returns, and Fetch
+// expects.
+type validatedParameters struct {
+	fetcher   test.TestFetcher
+	params    interface{}
+	variables map[string]string
+}
+
+// Templated implements contest.TestFetcher interface, expanding the test steps
+// returned by another test fetcher.
+type Templated struct {
+}
+
+// expand executes data as a template with the given variables. Referencing a
+// variable which is not defined is an error.
+func expand(name string, data []byte, variables map[string]string) ([]byte, error) {
+	tmpl, err := template.New(name).Delims("[[", "]]").Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, variables); err != nil {
+		return nil, fmt.Errorf("cannot expand template: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ValidateFetchParameters performs sanity checks on the fields of the
+// parameters that will be passed to Fetch.
+func (tf Templated) ValidateFetchParameters(params []byte) (interface{}, error) {
+	var fp FetchParameters
+	if err := json.Unmarshal(params, &fp); err != nil {
+		return nil, err
+	}
+	if registry == nil {
+		return nil, fmt.Errorf("plugin registry not set")
+	}
+	if fp.Fetcher == "" {
+		return nil, fmt.Errorf("wrapped test fetcher not specified in fetch parameters")
+	}
+	if strings.EqualFold(fp.Fetcher, Name) {
+		return nil, fmt.Errorf("test fetcher %s cannot wrap itself", Name)
+	}
+	fetcher, err := registry.NewTestFetcher(fp.Fetcher)
+	if err != nil {
+		return nil, err
+	}
+	innerParams, err := expand("FetchParameters", fp.FetchParameters, fp.Variables)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fetch parameters for %s: %v", fp.Fetcher, err)
+	}
+	validated, err := fetcher.ValidateFetchParameters(innerParams)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fetch parameters for %s: %v", fp.Fetcher, err)
+	}
+	return validatedParameters{fetcher: fetcher, params: validated, variables: fp.Variables}, nil
+}
+
+// Fetch returns the information necessary to build a Test object. The returned
+// values are:
+// * Name of the test
+// * list of step definitions
+// * an error if any
+func (tf *Templated) Fetch(params interface{}) (string, []*test.TestStepDescriptor, error) {
+	fetchParams, ok := params.(validatedParameters)
+	if !ok {
+		return "", nil, fmt.Errorf("Fetch expects parameters returned by templated.ValidateFetchParameters")
+	}
+	name, steps, err := fetchParams.fetcher.Fetch(fetchParams.params)
+	if err != nil {
+		return "", nil, err
+	}
+	log.Printf("Expanding %d test steps of test '%s'", len(steps), name)
+	data, err := json.Marshal(steps)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot encode test steps: %v", err)
+	}
+	expanded, err := expand(name, data, fetchParams.variables)
+	if err != nil {
+		return "", nil, fmt.Errorf("test '%s': %v", name, err)
+	}
+	var expandedSteps []*test.TestStepDescriptor
+	if err := json.Unmarshal(expanded, &expandedSteps); err != nil {
+		return "", nil, fmt.Errorf("cannot decode expanded test steps of test '%s': %v", name, err)
+	}
+	return name, expandedSteps, nil
+}
+
+// New initializes the TestFetcher object
+func New() test.TestFetcher {
+	return &Templated{}
+}
+
+// Load returns the name and factory which are needed to register the
+// TestFetcher.
+func Load() (string, test.TestFetcherFactory) {
+	return Name, New
+}
@@ -0,0 +1,55 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package templated
+
+import (
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/pluginregistry"
+	"github.com/facebookincubator/contest/plugins/testfetchers/literal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplated(t *testing.T) {
+	pr := pluginregistry.NewPluginRegistry()
+	require.NoError(t, pr.RegisterTestFetcher(literal.Load()))
+	require.NoError(t, pr.RegisterTestFetcher(Load()))
+	SetPluginRegistry(pr)
+
+	tf := New().(*Templated)
+	params, err := tf.ValidateFetchParameters([]byte(`{
+		"Fetcher": "literal",
+		"FetchParameters": {
+			"TestName": "boot [[ .kernel ]]",
+			"Steps": [
+				{
+					"name": "cmd",
+					"label": "boot",
+					"parameters": {"args": ["--kernel=[[ .kernel ]]", "{{ .Name }}"]}
+				}
+			]
+		},
+		"Variables": {"kernel": "5.10"}
+	}`))
+	require.NoError(t, err)
+	name, steps, err := tf.Fetch(params)
+	require.NoError(t, err)
+	require.Equal(t, "boot 5.10", name)
+	require.Len(t, steps, 1)
+	require.Equal(t, "boot", steps[0].Label)
+	// per-target templates are left for the step to expand
+	require.Equal(t, "--kernel=5.10", steps[0].Parameters["args"][0].String())
+	require.Equal(t, "{{ .Name }}", steps[0].Parameters["args"][1].String())
+
+	// undefined variables are reported
+	_, err = tf.ValidateFetchParameters([]byte(`{
+		"Fetcher": "literal",
+		"FetchParameters": {"TestName": "boot [[ .missing ]]"}
+	}`))
+	require.Error(t, err)
+	_, err = tf.ValidateFetchParameters([]byte(`{"Fetcher": "templated", "FetchParameters": {}}`))
+	require.Error(t, err)
+}
@@ -6,6 +6,8 @@
 package uri
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -23,6 +25,9 @@ var (
 	log  = logging.GetLogger("testfetchers/" + strings.ToLower(Name))
 )
 
+// cache holds the test definitions fetched from http and https URIs.
+var cache = test.NewDescriptorCache()
+
 var supportedSchemes = []string{
 	"file",
 	"https",
@@ -36,6 +41,30 @@ type FetchParameters struct {
 	// URI is the string pointing to where the test definition is stored. At
 	// the moment only file://, https:// and http:// are supported.
 	URI *xjson.URL
+	// Headers are additional HTTP headers sent with the request.
+	Headers map[string]string `json:",omitempty"`
+	// BearerTokenFile is the path of a file containing a token, which is sent
+	// in the Authorization header. Username and PasswordFile are used for
+	// basic authentication instead. Secrets are read from files so that they
+	// do not end up in the job descriptor.
+	BearerTokenFile string `json:",omitempty"`
+	Username        string `json:",omitempty"`
+	PasswordFile    string `json:",omitempty"`
+	// ClientCertFile and ClientKeyFile are the PEM encoded certificate and
+	// key used for TLS client authentication, and CACertFile optionally
+	// replaces the system certificate authorities to verify the server.
+	ClientCertFile string `json:",omitempty"`
+	ClientKeyFile  string `json:",omitempty"`
+	CACertFile     string `json:",omitempty"`
+	// CacheOptions control the caching of test definitions fetched from
+	// http and https URIs.
+	test.CacheOptions
+}
+
+// hasHTTPOptions returns whether any of the HTTP-only parameters is set.
+func (fp FetchParameters) hasHTTPOptions() bool {
+	return len(fp.Headers) > 0 || fp.BearerTokenFile != "" || fp.Username != "" || fp.PasswordFile != "" ||
+		fp.ClientCertFile != "" || fp.ClientKeyFile != "" || fp.CACertFile != "" || fp.CacheOptions != test.CacheOptions{}
 }
 
 // URI implements contest.TestFetcher interface, returning dummy test fetcher
@@ -74,10 +103,136 @@ func (tf URI) ValidateFetchParameters(params []byte) (interface{}, error) {
 		if fp.URI.Host != "" && fp.URI.Host != "localhost" {
 			return nil, fmt.Errorf("invalid host in URI: '%s'. Only 'localhost' or empty string are supported for scheme %s", fp.URI.Host, scheme)
 		}
+		if fp.hasHTTPOptions() {
+			return nil, fmt.Errorf("HTTP headers, credentials, certificates and caching are not supported for scheme %s", scheme)
+		}
+	}
+	if err := fp.CacheOptions.Validate(); err != nil {
+		return nil, err
+	}
+	if fp.BearerTokenFile != "" && (fp.Username != "" || fp.PasswordFile != "") {
+		return nil, fmt.Errorf("bearer token and basic authentication cannot be used together")
+	}
+	if fp.PasswordFile != "" && fp.Username == "" {
+		return nil, fmt.Errorf("a username is required when a password file is specified")
+	}
+	if (fp.ClientCertFile == "") != (fp.ClientKeyFile == "") {
+		return nil, fmt.Errorf("client certificate and key must be specified together")
+	}
+	if (fp.ClientCertFile != "" || fp.CACertFile != "") && scheme != "https" {
+		return nil, fmt.Errorf("certificates are only supported for scheme https")
 	}
 	return fp, nil
 }
 
+// readSecret reads a secret from a file, ignoring leading and trailing white
+// spaces.
+func readSecret(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// httpClient returns the client used to fetch the test definition, set up
+// with the TLS configuration from the fetch parameters.
+func httpClient(fp FetchParameters) (*http.Client, error) {
+	if fp.ClientCertFile == "" && fp.CACertFile == "" {
+		return http.DefaultClient, nil
+	}
+	tlsConfig := &tls.Config{}
+	if fp.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(fp.ClientCertFile, fp.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if fp.CACertFile != "" {
+		caCert, err := ioutil.ReadFile(fp.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no valid certificate found in %s", fp.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
+
+// newRequest builds the request for the test definition, with the headers
+// and the credentials from the fetch parameters.
+func newRequest(fp FetchParameters) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, fp.URI.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range fp.Headers {
+		req.Header.Set(name, value)
+	}
+	if fp.BearerTokenFile != "" {
+		token, err := readSecret(fp.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read bearer token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if fp.Username != "" {
+		var password string
+		if fp.PasswordFile != "" {
+			if password, err = readSecret(fp.PasswordFile); err != nil {
+				return nil, fmt.Errorf("cannot read password: %v", err)
+			}
+		}
+		req.SetBasicAuth(fp.Username, password)
+	}
+	return req, nil
+}
+
+// cacheKey identifies a test definition in the cache. Besides the URI, it
+// includes everything which can change the response, so that e.g. a
+// definition fetched with some credentials is not returned to a request
+// without them.
+func cacheKey(fp FetchParameters) string {
+	request := struct {
+		Headers         map[string]string
+		BearerTokenFile string
+		Username        string
+		PasswordFile    string
+		ClientCertFile  string
+		CACertFile      string
+	}{fp.Headers, fp.BearerTokenFile, fp.Username, fp.PasswordFile, fp.ClientCertFile, fp.CACertFile}
+	// encoding a struct of strings and maps cannot fail
+	data, _ := json.Marshal(request)
+	return fp.URI.String() + " " + string(data)
+}
+
+// fetchHTTP fetches the test definition from a http or https URI.
+func fetchHTTP(fp FetchParameters) ([]byte, error) {
+	client, err := httpClient(fp)
+	if err != nil {
+		return nil, err
+	}
+	req, err := newRequest(fp)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot fetch test description: %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
 // Fetch returns the information necessary to build a Test object. The returned
 // values are:
 // * Name of the test
@@ -102,11 +257,9 @@ func (tf *URI) Fetch(params interface{}) (string, []*test.TestStepDescriptor, er
 			return "", nil, err
 		}
 	case "http", "https":
-		resp, err := http.Get(fetchParams.URI.String())
-		if err != nil {
-			return "", nil, err
-		}
-		buf, err = ioutil.ReadAll(resp.Body)
+		buf, err = cache.Fetch(cacheKey(fetchParams), fetchParams.CacheOptions, func() ([]byte, error) {
+			return fetchHTTP(fetchParams)
+		})
 		if err != nil {
 			return "", nil, err
 		}
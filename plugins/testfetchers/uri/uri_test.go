@@ -0,0 +1,81 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package uri
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testDefinition = `{"Steps": [{"name": "echo", "label": "echo_label", "parameters": {"text": ["hello"]}}]}`
+
+// writeFile writes a file in a temporary directory and returns its path.
+func writeFile(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, ioutil.WriteFile(path, data, 0600))
+	return path
+}
+
+func fetch(t *testing.T, params string) error {
+	tf := New().(*URI)
+	fp, err := tf.ValidateFetchParameters([]byte(params))
+	require.NoError(t, err)
+	_, steps, err := tf.Fetch(fp)
+	if err == nil {
+		require.Len(t, steps, 1)
+	}
+	return err
+}
+
+func TestValidateFetchParametersHTTPOptions(t *testing.T) {
+	tf := New().(*URI)
+	for _, params := range []string{
+		`{"TestName": "test", "URI": "file:///tmp/test.json", "Headers": {"X-Test": "1"}}`,
+		`{"TestName": "test", "URI": "https://example.com/test.json", "BearerTokenFile": "/tmp/token", "Username": "user"}`,
+		`{"TestName": "test", "URI": "https://example.com/test.json", "PasswordFile": "/tmp/password"}`,
+		`{"TestName": "test", "URI": "https://example.com/test.json", "ClientCertFile": "/tmp/cert.pem"}`,
+		`{"TestName": "test", "URI": "http://example.com/test.json", "CACertFile": "/tmp/ca.pem"}`,
+	} {
+		_, err := tf.ValidateFetchParameters([]byte(params))
+		require.Error(t, err, params)
+	}
+}
+
+func TestFetchAuthenticated(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, basic := r.BasicAuth()
+		if r.Header.Get("X-Test") != "1" ||
+			(r.Header.Get("Authorization") != "Bearer secret" && (!basic || user != "user" || password != "secret")) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(testDefinition))
+	}))
+	defer ts.Close()
+	secret := writeFile(t, "secret", []byte("secret\n"))
+
+	require.NoError(t, fetch(t, `{"TestName": "test", "URI": "`+ts.URL+`", "Headers": {"X-Test": "1"}, "BearerTokenFile": "`+secret+`"}`))
+	require.NoError(t, fetch(t, `{"TestName": "test", "URI": "`+ts.URL+`", "Headers": {"X-Test": "1"}, "Username": "user", "PasswordFile": "`+secret+`"}`))
+	require.Error(t, fetch(t, `{"TestName": "test", "URI": "`+ts.URL+`", "Headers": {"X-Test": "1"}}`))
+}
+
+func TestFetchCACert(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(testDefinition))
+	}))
+	defer ts.Close()
+
+	// the test server certificate is not trusted by the system
+	require.Error(t, fetch(t, `{"TestName": "test", "URI": "`+ts.URL+`"}`))
+	caCert := writeFile(t, "ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}))
+	require.NoError(t, fetch(t, `{"TestName": "test", "URI": "`+ts.URL+`", "CACertFile": "`+caCert+`"}`))
+}
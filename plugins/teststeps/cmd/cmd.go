@@ -21,7 +21,6 @@ import (
 	"github.com/facebookincubator/contest/pkg/logging"
 	"github.com/facebookincubator/contest/pkg/target"
 	"github.com/facebookincubator/contest/pkg/test"
-	"github.com/facebookincubator/contest/plugins/teststeps"
 )
 
 // Name is the name used to look this plugin up.
@@ -62,12 +61,12 @@ func (ts Cmd) Name() string {
 }
 
 // Run executes the cmd step.
-func (ts *Cmd) Run(cancel, pause <-chan struct{}, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
+func (ts *Cmd) Run(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
 	if err := ts.validateAndPopulate(params); err != nil {
 		return err
 	}
-	f := func(cancel, pause <-chan struct{}, target *target.Target) error {
-		ctx, ctxCancel := context.WithCancel(context.Background())
+	f := func(ctx context.Context, target *target.Target) error {
+		ctx, ctxCancel := context.WithCancel(ctx)
 		defer ctxCancel()
 		// expand args
 		var args []string
@@ -122,13 +121,11 @@ func (ts *Cmd) Run(cancel, pause <-chan struct{}, ch test.TestStepChannels, para
 		case err := <-errCh:
 			log.Warningf("Stderr of command '%+v' is: '%s'", cmd, stderr.Bytes())
 			return err
-		case <-cancel:
-			return nil
-		case <-pause:
+		case <-ctx.Done():
 			return nil
 		}
 	}
-	return teststeps.ForEachTarget(Name, cancel, pause, ch, f)
+	return test.ForEachTarget(ctx, Name, ch, f)
 }
 
 func (ts *Cmd) validateAndPopulate(params test.TestStepParameters) error {
@@ -154,6 +151,35 @@ func (ts *Cmd) validateAndPopulate(params test.TestStepParameters) error {
 	return nil
 }
 
+// parametersSchema is the JSON schema of the parameters of the step.
+var parametersSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"executable": {
+			"description": "The absolute path of the executable, or its name in PATH",
+			"type": "array",
+			"items": {"type": "string", "minLength": 1},
+			"minItems": 1
+		},
+		"args": {
+			"description": "The arguments of the executable, which may be templates",
+			"type": "array",
+			"items": {"type": "string"}
+		},
+		"dir": {
+			"description": "The working directory of the executable",
+			"type": "array",
+			"items": {"type": "string"}
+		}
+	},
+	"required": ["executable"]
+}`)
+
+// ParametersSchema returns the JSON schema of the parameters of the step.
+func (ts *Cmd) ParametersSchema() json.RawMessage {
+	return parametersSchema
+}
+
 // ValidateParameters validates the parameters associated to the TestStep
 func (ts *Cmd) ValidateParameters(params test.TestStepParameters) error {
 	return ts.validateAndPopulate(params)
@@ -161,7 +187,7 @@ func (ts *Cmd) ValidateParameters(params test.TestStepParameters) error {
 
 // Resume tries to resume a previously interrupted test step. Cmd cannot
 // resume.
-func (ts *Cmd) Resume(cancel, pause <-chan struct{}, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.EmitterFetcher) error {
+func (ts *Cmd) Resume(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.EmitterFetcher) error {
 	return &cerrors.ErrResumeNotSupported{StepName: Name}
 }
 
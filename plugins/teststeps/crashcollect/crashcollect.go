@@ -0,0 +1,396 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package crashcollect
+
+// The CrashCollect plugin gathers kernel logs, the system journal and crash
+// dumps from the targets over SSH. The output of each source is stored in the
+// artifact store, and a CrashCollectLog event references it; errors while
+// collecting are reported in CrashCollectError events. The step never fails a
+// target: every target is always forwarded to the next step.
+//
+// The step must be used in the CleanupSteps of a test descriptor, so that it
+// also collects from the targets which failed the test steps. It requires an
+// artifact store to be configured on the server.
+//
+// Only PublicKey and Password authentication are supported, like in SSHCmd.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/artifact"
+	"github.com/facebookincubator/contest/pkg/cerrors"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+	shellquote "github.com/kballard/go-shellquote"
+	"golang.org/x/crypto/ssh"
+)
+
+// Name is the name used to look this plugin up.
+var Name = "CrashCollect"
+
+var log = logging.GetLogger("teststeps/" + strings.ToLower(Name))
+
+// EventCrashCollectLog is emitted once per target and per collected source,
+// with an artifact.Payload referencing the output of the source.
+const EventCrashCollectLog = event.Name("CrashCollectLog")
+
+// EventCrashCollectError is emitted when a source cannot be collected, or its
+// command fails. Any output is still referenced by a CrashCollectLog event.
+const EventCrashCollectError = event.Name("CrashCollectError")
+
+// Events defines the events that a TestStep is allow to emit
+var Events = []event.Name{EventCrashCollectLog, EventCrashCollectError}
+
+const (
+	defaultSSHPort  = 22
+	defaultCrashDir = "/var/crash"
+	// defaultMaxSize is the default maximum number of bytes stored for each
+	// collected source. Longer outputs are truncated from the beginning.
+	defaultMaxSize = 256 * 1024
+	// defaultTimeout is the default maximum time the command of each source
+	// can run for.
+	defaultTimeout = 2 * time.Minute
+)
+
+// sources that can be collected.
+const (
+	sourceDmesg      = "dmesg"
+	sourceJournal    = "journal"
+	sourceCrashDumps = "crashdumps"
+)
+
+var defaultSources = []string{sourceDmesg, sourceJournal, sourceCrashDumps}
+
+type eventErrorPayload struct {
+	Source  string
+	Command string
+	Error   string
+}
+
+// CrashCollect collects logs and crash dumps from targets.
+type CrashCollect struct {
+	Host           *test.Param
+	Port           *test.Param
+	User           *test.Param
+	PrivateKeyFile *test.Param
+	Password       *test.Param
+	Sources        []string
+	CrashDir       string
+	MaxSize        int
+	Timeout        time.Duration
+}
+
+// Name returns the plugin name.
+func (ts CrashCollect) Name() string {
+	return Name
+}
+
+// CleanupOnly tells that the step must be used in the cleanup steps, so that
+// it also sees the targets which failed the test steps.
+func (ts CrashCollect) CleanupOnly() bool {
+	return true
+}
+
+// command returns the remote command used to collect the given source.
+func (ts *CrashCollect) command(source string) string {
+	switch source {
+	case sourceDmesg:
+		return "dmesg"
+	case sourceJournal:
+		return "journalctl --no-pager -b"
+	case sourceCrashDumps:
+		// list the dumps, and include the kernel log extracted by kdump
+		// for each of them, if any. Dumps themselves are too large for events.
+		dir := shellquote.Join(ts.CrashDir)
+		return fmt.Sprintf("ls -lR %s && for f in $(find %s -name 'vmcore-dmesg*.txt'); do echo \"==> $f <==\"; cat \"$f\"; done", dir, dir)
+	}
+	return ""
+}
+
+func (ts *CrashCollect) dial(tgt *target.Target) (*ssh.Client, error) {
+	user, err := ts.User.Expand(tgt)
+	if err != nil {
+		return nil, fmt.Errorf("cannot expand user parameter: %v", err)
+	}
+	host, err := ts.Host.Expand(tgt)
+	if err != nil {
+		return nil, fmt.Errorf("cannot expand host parameter: %v", err)
+	}
+	portStr, err := ts.Port.Expand(tgt)
+	if err != nil {
+		return nil, fmt.Errorf("cannot expand port parameter: %v", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert port parameter to integer: %v", err)
+	}
+	auth := []ssh.AuthMethod{}
+	privKeyFile, err := ts.PrivateKeyFile.Expand(tgt)
+	if err != nil {
+		return nil, fmt.Errorf("cannot expand private key file parameter: %v", err)
+	}
+	if privKeyFile != "" {
+		key, err := ioutil.ReadFile(privKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read private key at %s: %v", privKeyFile, err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse private key: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	password, err := ts.Password.Expand(tgt)
+	if err != nil {
+		return nil, fmt.Errorf("cannot expand password parameter: %v", err)
+	}
+	if password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+	config := ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	client, err := ssh.Dial("tcp", addr, &config)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to SSH server %s: %v", addr, err)
+	}
+	return client, nil
+}
+
+// remote runs commands on a target.
+type remote interface {
+	// Run runs a command and returns its combined output, which may be
+	// partial if the command fails.
+	Run(ctx context.Context, cmd string) ([]byte, error)
+	Close() error
+}
+
+// connect opens a connection to a target. It is a variable so that tests can
+// replace it.
+var connect = func(ts *CrashCollect, tgt *target.Target) (remote, error) {
+	client, err := ts.dial(tgt)
+	if err != nil {
+		return nil, err
+	}
+	return sshRemote{client: client}, nil
+}
+
+type sshRemote struct {
+	client *ssh.Client
+}
+
+// Run runs a command on the target and returns its combined output.
+func (r sshRemote) Run(ctx context.Context, cmd string) ([]byte, error) {
+	session, err := r.client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create SSH session: %v", err)
+	}
+	var out bytes.Buffer
+	session.Stdout, session.Stderr = &out, &out
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- session.Run(cmd)
+	}()
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		if err := session.Signal(ssh.SIGKILL); err != nil {
+			log.Warningf("Failed to kill remote command: %v", err)
+		}
+		// closing the session makes Run return, after which the output
+		// is no longer written to.
+		if err := session.Close(); err != nil && err != io.EOF {
+			log.Warningf("Failed to close SSH session: %v", err)
+		}
+		<-errCh
+		return out.Bytes(), ctx.Err()
+	}
+	if err := session.Close(); err != nil && err != io.EOF {
+		log.Warningf("Failed to close SSH session: %v", err)
+	}
+	return out.Bytes(), err
+}
+
+// Close closes the connection to the target.
+func (r sshRemote) Close() error {
+	return r.client.Close()
+}
+
+func (ts *CrashCollect) emitError(ev testevent.Emitter, tgt *target.Target, payload eventErrorPayload) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Warningf("Cannot encode payload for %s: %v", EventCrashCollectError, err)
+		return
+	}
+	rm := json.RawMessage(data)
+	if err := ev.Emit(testevent.Data{EventName: EventCrashCollectError, Target: tgt, Payload: &rm}); err != nil {
+		log.Warningf("Cannot emit event %s: %v", EventCrashCollectError, err)
+	}
+}
+
+// emitLog stores the output of a source as an artifact, and emits an event
+// referencing it. Outputs longer than MaxSize are truncated from the
+// beginning, which is noted on their first line.
+func (ts *CrashCollect) emitLog(ev testevent.Emitter, tgt *target.Target, source string, out []byte) {
+	var r io.Reader = bytes.NewReader(out)
+	if len(out) > ts.MaxSize {
+		notice := fmt.Sprintf("[%d bytes truncated]\n", len(out)-ts.MaxSize)
+		r = io.MultiReader(strings.NewReader(notice), bytes.NewReader(out[len(out)-ts.MaxSize:]))
+	}
+	data := testevent.Data{EventName: EventCrashCollectLog, Target: tgt}
+	if err := artifact.Emit(ev, data, source+".log", r); err != nil {
+		log.Warningf("Cannot emit event %s: %v", EventCrashCollectLog, err)
+	}
+}
+
+func (ts *CrashCollect) collect(ctx context.Context, tgt *target.Target, ev testevent.Emitter) {
+	rem, err := connect(ts, tgt)
+	if err != nil {
+		log.Warningf("Cannot collect logs from target %s: %v", tgt, err)
+		for _, source := range ts.Sources {
+			ts.emitError(ev, tgt, eventErrorPayload{Source: source, Command: ts.command(source), Error: err.Error()})
+		}
+		return
+	}
+	defer func() {
+		if err := rem.Close(); err != nil {
+			log.Warningf("Failed to close connection to target %s: %v", tgt, err)
+		}
+	}()
+	for _, source := range ts.Sources {
+		if ctx.Err() != nil {
+			return
+		}
+		cmd := ts.command(source)
+		cmdCtx, cancel := context.WithTimeout(ctx, ts.Timeout)
+		out, err := rem.Run(cmdCtx, cmd)
+		timedOut := cmdCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil
+		cancel()
+		if len(out) > 0 || err == nil {
+			ts.emitLog(ev, tgt, source, out)
+		}
+		if timedOut {
+			err = fmt.Errorf("timed out after %v", ts.Timeout)
+		}
+		if err != nil {
+			ts.emitError(ev, tgt, eventErrorPayload{Source: source, Command: cmd, Error: err.Error()})
+		}
+	}
+}
+
+// Run executes the step.
+func (ts *CrashCollect) Run(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
+	if err := ts.validateAndPopulate(params); err != nil {
+		return err
+	}
+	f := func(ctx context.Context, tgt *target.Target) error {
+		ts.collect(ctx, tgt, ev)
+		// collection errors never fail the target.
+		return nil
+	}
+	return test.ForEachTarget(ctx, Name, ch, f)
+}
+
+func (ts *CrashCollect) validateAndPopulate(params test.TestStepParameters) error {
+	ts.Host = params.GetOne("host")
+	if ts.Host.IsEmpty() {
+		return errors.New("invalid or missing 'host' parameter, must be exactly one string")
+	}
+	ts.Port = params.GetOne("port")
+	if ts.Port.IsEmpty() {
+		ts.Port = test.NewParam(strconv.Itoa(defaultSSHPort))
+	}
+	ts.User = params.GetOne("user")
+	if ts.User.IsEmpty() {
+		return errors.New("invalid or missing 'user' parameter, must be exactly one string")
+	}
+	// do not fail if key file or password are empty, in such case they won't
+	// be used
+	ts.PrivateKeyFile = params.GetOne("private_key_file")
+	ts.Password = params.GetOne("password")
+
+	ts.Sources = nil
+	for _, s := range params.Get("sources") {
+		switch s.String() {
+		case sourceDmesg, sourceJournal, sourceCrashDumps:
+			ts.Sources = append(ts.Sources, s.String())
+		default:
+			return fmt.Errorf("invalid source '%s', must be one of %v", s.String(), defaultSources)
+		}
+	}
+	if len(ts.Sources) == 0 {
+		ts.Sources = defaultSources
+	}
+	ts.CrashDir = params.GetOne("crash_dir").String()
+	if ts.CrashDir == "" {
+		ts.CrashDir = defaultCrashDir
+	}
+	ts.MaxSize = defaultMaxSize
+	if !params.GetOne("max_size").IsEmpty() {
+		size, err := params.GetInt("max_size")
+		if err != nil {
+			return fmt.Errorf("invalid 'max_size' parameter: %v", err)
+		}
+		if size <= 0 {
+			return errors.New("'max_size' must be positive")
+		}
+		ts.MaxSize = int(size)
+	}
+	ts.Timeout = defaultTimeout
+	if timeout := params.GetOne("timeout"); !timeout.IsEmpty() {
+		d, err := time.ParseDuration(timeout.String())
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid 'timeout' parameter '%s', must be a positive duration", timeout.String())
+		}
+		ts.Timeout = d
+	}
+	if artifact.GetStore() == nil {
+		return fmt.Errorf("%s requires an artifact store: %v", Name, artifact.ErrNoStore)
+	}
+	return nil
+}
+
+// ValidateParameters validates the parameters associated to the TestStep
+func (ts *CrashCollect) ValidateParameters(params test.TestStepParameters) error {
+	return ts.validateAndPopulate(params)
+}
+
+// Resume tries to resume a previously interrupted test step. CrashCollect
+// cannot resume.
+func (ts *CrashCollect) Resume(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.EmitterFetcher) error {
+	return &cerrors.ErrResumeNotSupported{StepName: Name}
+}
+
+// CanResume tells whether this step is able to resume.
+func (ts *CrashCollect) CanResume() bool {
+	return false
+}
+
+// New initializes and returns a new CrashCollect test step.
+func New() test.TestStep {
+	return &CrashCollect{}
+}
+
+// Load returns the name, factory and events which are needed to register the step.
+func Load() (string, test.TestStepFactory, []event.Name) {
+	return Name, New, Events
+}
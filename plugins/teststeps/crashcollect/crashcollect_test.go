@@ -0,0 +1,252 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package crashcollect
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/artifact"
+	"github.com/facebookincubator/contest/pkg/cerrors"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+	"github.com/stretchr/testify/require"
+)
+
+// memStore is an artifact store keeping artifacts in memory.
+type memStore struct {
+	mu      sync.Mutex
+	objects map[string]string
+}
+
+func (s *memStore) Name() string {
+	return "mem"
+}
+
+func (s *memStore) Put(key string, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = string(data)
+	return nil
+}
+
+func (s *memStore) Get(key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader([]byte(data))), nil
+}
+
+func setStore(t *testing.T) *memStore {
+	s := &memStore{objects: make(map[string]string)}
+	artifact.SetStore(s)
+	t.Cleanup(func() { artifact.SetStore(nil) })
+	return s
+}
+
+// recordingEmitter records events, storing artifacts like the emitter of the
+// storage package does.
+type recordingEmitter struct {
+	mu     sync.Mutex
+	events []testevent.Data
+}
+
+func (e *recordingEmitter) Emit(data testevent.Data) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, data)
+	return nil
+}
+
+func (e *recordingEmitter) EmitArtifact(data testevent.Data, name string, r io.Reader) error {
+	ref, err := artifact.Put(data.Target.ID+"/"+name, name, r)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(artifact.Payload{Artifacts: []artifact.Ref{*ref}})
+	if err != nil {
+		return err
+	}
+	rm := json.RawMessage(payload)
+	data.Payload = &rm
+	return e.Emit(data)
+}
+
+// fakeRemote runs commands by returning the outputs and errors configured for
+// them. Commands without an output block until the context is done.
+type fakeRemote struct {
+	outputs map[string]string
+	errors  map[string]error
+	closed  *bool
+}
+
+func (r fakeRemote) Run(ctx context.Context, cmd string) ([]byte, error) {
+	out, ok := r.outputs[cmd]
+	if !ok {
+		<-ctx.Done()
+		return []byte("partial"), ctx.Err()
+	}
+	return []byte(out), r.errors[cmd]
+}
+
+func (r fakeRemote) Close() error {
+	*r.closed = true
+	return nil
+}
+
+// setConnect makes the step connect to targets with the given function,
+// until the test ends.
+func setConnect(t *testing.T, f func(ts *CrashCollect, tgt *target.Target) (remote, error)) {
+	prev := connect
+	connect = f
+	t.Cleanup(func() { connect = prev })
+}
+
+func stepParams(t *testing.T, extra map[string][]string) test.TestStepParameters {
+	params := map[string][]string{"host": {"{{ .Name }}"}, "user": {"root"}}
+	for k, v := range extra {
+		params[k] = v
+	}
+	p := make(test.TestStepParameters)
+	for k, values := range params {
+		for _, v := range values {
+			data, err := json.Marshal(v)
+			require.NoError(t, err)
+			p[k] = append(p[k], test.Param{RawMessage: data})
+		}
+	}
+	return p
+}
+
+// run runs the step on the given targets, and checks that all of them are
+// forwarded.
+func run(t *testing.T, params test.TestStepParameters, targets ...*target.Target) []testevent.Data {
+	var (
+		in   = make(chan *target.Target, len(targets))
+		out  = make(chan *target.Target, len(targets))
+		errs = make(chan cerrors.TargetError, len(targets))
+		ev   recordingEmitter
+	)
+	for _, tgt := range targets {
+		in <- tgt
+	}
+	close(in)
+	step := New()
+	require.NoError(t, step.ValidateParameters(params))
+	require.NoError(t, step.Run(context.Background(), test.TestStepChannels{In: in, Out: out, Err: errs}, params, &ev))
+	require.Len(t, out, len(targets))
+	require.Empty(t, errs)
+	return ev.events
+}
+
+// eventsOf returns the payloads of the events with the given name, in order.
+func eventsOf(t *testing.T, events []testevent.Data, name string) []string {
+	var payloads []string
+	for _, data := range events {
+		if string(data.EventName) == name {
+			require.NotNil(t, data.Payload)
+			payloads = append(payloads, string(*data.Payload))
+		}
+	}
+	return payloads
+}
+
+func TestCollect(t *testing.T) {
+	store := setStore(t)
+	ts := &CrashCollect{CrashDir: defaultCrashDir}
+	var closed bool
+	setConnect(t, func(_ *CrashCollect, tgt *target.Target) (remote, error) {
+		require.Equal(t, "T1", tgt.ID)
+		return fakeRemote{
+			outputs: map[string]string{
+				ts.command(sourceDmesg):   "0123456789abcdefghij",
+				ts.command(sourceJournal): "journal",
+			},
+			errors: map[string]error{
+				ts.command(sourceJournal): errors.New("exit status 1"),
+			},
+			closed: &closed,
+		}, nil
+	})
+
+	params := stepParams(t, map[string][]string{"max_size": {"10"}, "timeout": {"10ms"}})
+	events := run(t, params, &target.Target{ID: "T1", Name: "host1"})
+	require.True(t, closed)
+
+	require.Equal(t, map[string]string{
+		"T1/dmesg.log":      "[10 bytes truncated]\nabcdefghij",
+		"T1/journal.log":    "journal",
+		"T1/crashdumps.log": "partial",
+	}, store.objects)
+	logs := eventsOf(t, events, string(EventCrashCollectLog))
+	require.Len(t, logs, 3)
+	for idx, name := range []string{"dmesg.log", "journal.log", "crashdumps.log"} {
+		var payload artifact.Payload
+		require.NoError(t, json.Unmarshal([]byte(logs[idx]), &payload))
+		require.Len(t, payload.Artifacts, 1)
+		require.Equal(t, name, payload.Artifacts[0].Name)
+		require.Equal(t, "T1/"+name, payload.Artifacts[0].Key)
+	}
+
+	// the failing collector and the one which timed out are reported
+	failures := eventsOf(t, events, string(EventCrashCollectError))
+	require.Len(t, failures, 2)
+	require.JSONEq(t, `{"Source": "journal", "Command": "journalctl --no-pager -b", "Error": "exit status 1"}`, failures[0])
+	var payload eventErrorPayload
+	require.NoError(t, json.Unmarshal([]byte(failures[1]), &payload))
+	require.Equal(t, sourceCrashDumps, payload.Source)
+	require.Equal(t, "timed out after 10ms", payload.Error)
+}
+
+func TestCollectConnectError(t *testing.T) {
+	store := setStore(t)
+	setConnect(t, func(_ *CrashCollect, tgt *target.Target) (remote, error) {
+		return nil, errors.New("connection refused")
+	})
+
+	params := stepParams(t, map[string][]string{"sources": {"dmesg", "journal"}})
+	events := run(t, params, &target.Target{ID: "T1"}, &target.Target{ID: "T2"})
+	require.Empty(t, store.objects)
+	require.Empty(t, eventsOf(t, events, string(EventCrashCollectLog)))
+	require.Len(t, eventsOf(t, events, string(EventCrashCollectError)), 4)
+	for _, payload := range eventsOf(t, events, string(EventCrashCollectError)) {
+		require.Contains(t, payload, `"Error":"connection refused"`)
+	}
+}
+
+func TestValidateParameters(t *testing.T) {
+	step := New()
+	require.Error(t, step.ValidateParameters(stepParams(t, nil)), "no artifact store")
+
+	setStore(t)
+	require.NoError(t, step.ValidateParameters(stepParams(t, nil)))
+	require.Error(t, step.ValidateParameters(stepParams(t, map[string][]string{"host": {""}})))
+	require.Error(t, step.ValidateParameters(stepParams(t, map[string][]string{"sources": {"core"}})))
+	require.Error(t, step.ValidateParameters(stepParams(t, map[string][]string{"max_size": {"0"}})))
+	require.Error(t, step.ValidateParameters(stepParams(t, map[string][]string{"timeout": {"soon"}})))
+	require.Error(t, step.ValidateParameters(stepParams(t, map[string][]string{"timeout": {"-1s"}})))
+}
+
+func TestCleanupOnly(t *testing.T) {
+	cts, ok := New().(test.CleanupTestStep)
+	require.True(t, ok)
+	require.True(t, cts.CleanupOnly())
+}
@@ -6,6 +6,8 @@
 package echo
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"strings"
 
@@ -47,13 +49,32 @@ func (e Step) ValidateParameters(params test.TestStepParameters) error {
 	return nil
 }
 
+// parametersSchema is the JSON schema of the parameters of the step.
+var parametersSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"text": {
+			"description": "The text to print",
+			"type": "array",
+			"items": {"type": "string", "minLength": 1},
+			"minItems": 1
+		}
+	},
+	"required": ["text"]
+}`)
+
+// ParametersSchema returns the JSON schema of the parameters of the step.
+func (e Step) ParametersSchema() json.RawMessage {
+	return parametersSchema
+}
+
 // Name returns the name of the Step
 func (e Step) Name() string {
 	return Name
 }
 
 // Run executes the step
-func (e Step) Run(cancel, pause <-chan struct{}, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
+func (e Step) Run(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
 	for {
 		select {
 		case target := <-ch.In:
@@ -63,9 +84,7 @@ func (e Step) Run(cancel, pause <-chan struct{}, ch test.TestStepChannels, param
 			}
 			log.Infof("Running on target %s with text '%s'", target, params.GetOne("text"))
 			ch.Out <- target
-		case <-cancel:
-			return nil
-		case <-pause:
+		case <-ctx.Done():
 			return nil
 		}
 	}
@@ -78,6 +97,6 @@ func (e Step) CanResume() bool {
 
 // Resume tries to resume a previously interrupted test step. EchoStep cannot
 // resume.
-func (e Step) Resume(cancel, pause <-chan struct{}, _ test.TestStepChannels, _ test.TestStepParameters, ev testevent.EmitterFetcher) error {
+func (e Step) Resume(ctx context.Context, _ test.TestStepChannels, _ test.TestStepParameters, ev testevent.EmitterFetcher) error {
 	return &cerrors.ErrResumeNotSupported{StepName: Name}
 }
@@ -0,0 +1,408 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package exec implements the Exec test step, which runs a program that
+// tests the targets, so that test steps can be written in any language. The
+// program is started once per step run, and talks to the step over its
+// standard input and output with JSON messages, one per line. What it writes
+// to its standard error is logged.
+//
+// The step sends the program these messages, in this order:
+//
+//	{"type": "start", "parameters": {...}}
+//	{"type": "target", "target": {"name": "...", "id": "...", "fqdn": "..."}}
+//	{"type": "end"}
+//
+// The start message carries the parameters of the step, as in the job
+// descriptor, then a target message is sent for each target, and the end
+// message once there are no more targets. If the step is canceled or paused,
+// this message is sent at any time:
+//
+//	{"type": "signal", "signal": "cancel"}
+//
+// with "pause" as signal for pause, and the program must then exit within
+// the shutdownTimeout parameter of the step, after which it is killed.
+//
+// The program writes these messages, referring to the targets by ID:
+//
+//	{"type": "result", "target": "..."}
+//	{"type": "result", "target": "...", "error": "..."}
+//	{"type": "result", "target": "...", "error": "...", "skipped": true}
+//	{"type": "event", "target": "...", "name": "...", "payload": {...}}
+//
+// A result without error tells that the target passed the step, and one
+// with an error that it failed, or that it was skipped for this reason if
+// skipped is set. Every target must get one result. Events are emitted as
+// ExecEvent events, whose payload holds the name and the payload set by the
+// program, and the target of an event is optional. The program exits once
+// it has written the results of all the targets, with a status of 0 unless
+// the step itself failed.
+package exec
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/cerrors"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+	"github.com/facebookincubator/contest/pkg/xcontext"
+)
+
+// Name is the name used to look this plugin up.
+var Name = "Exec"
+
+var log = logging.GetLogger("teststeps/" + strings.ToLower(Name))
+
+// EventExec records an event emitted by the program.
+const EventExec = event.Name("ExecEvent")
+
+// Events defines the events that a TestStep is allow to emit
+var Events = []event.Name{
+	EventExec,
+}
+
+// DefaultShutdownTimeout is how long the program has to exit once canceled
+// or paused, if the shutdownTimeout parameter is not set.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// maxMessageSize is the maximum size of a message written by the program.
+const maxMessageSize = 4 << 20
+
+// eventExecPayload is the payload of an EventExec event.
+type eventExecPayload struct {
+	Name    string
+	Payload json.RawMessage `json:",omitempty"`
+}
+
+// messageTarget is a target in the messages sent to the program.
+type messageTarget struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+	FQDN string `json:"fqdn,omitempty"`
+}
+
+// inputMessage is a message sent to the program.
+type inputMessage struct {
+	Type       string                  `json:"type"`
+	Parameters test.TestStepParameters `json:"parameters,omitempty"`
+	Target     *messageTarget          `json:"target,omitempty"`
+	Signal     string                  `json:"signal,omitempty"`
+}
+
+// outputMessage is a message written by the program.
+type outputMessage struct {
+	Type    string          `json:"type"`
+	Target  string          `json:"target"`
+	Error   string          `json:"error"`
+	Skipped bool            `json:"skipped"`
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Exec runs a program which tests the targets.
+type Exec struct {
+	executable      string
+	args            []string
+	dir             string
+	shutdownTimeout time.Duration
+}
+
+// Name returns the plugin name.
+func (ts Exec) Name() string {
+	return Name
+}
+
+// stepTargets are the targets sent to the program, by ID.
+type stepTargets struct {
+	mu      sync.Mutex
+	targets map[string]*target.Target
+}
+
+func (s *stepTargets) add(t *target.Target) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.targets[t.ID] = t
+}
+
+func (s *stepTargets) get(id string) *target.Target {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.targets[id]
+}
+
+// sendInputs sends the start message and the targets to the program, and
+// then the signal to cancel or pause it once the context is done. It returns
+// when the program exits, or cannot be written to.
+func (ts *Exec) sendInputs(ctx context.Context, w io.Writer, in <-chan *target.Target, params test.TestStepParameters, targets *stepTargets, cmd *osexec.Cmd, exited <-chan struct{}) {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(inputMessage{Type: "start", Parameters: params}); err != nil {
+		return
+	}
+	for {
+		select {
+		case t := <-in:
+			msg := inputMessage{Type: "end"}
+			if t != nil {
+				targets.add(t)
+				msg = inputMessage{Type: "target", Target: &messageTarget{Name: t.Name, ID: t.ID, FQDN: t.FQDN}}
+			} else {
+				in = nil
+			}
+			if err := enc.Encode(msg); err != nil {
+				log.Warningf("Cannot write to %s: %v", ts.executable, err)
+				return
+			}
+		case <-ctx.Done():
+			signal := "cancel"
+			if xcontext.IsPaused(ctx) {
+				signal = "pause"
+			}
+			_ = enc.Encode(inputMessage{Type: "signal", Signal: signal})
+			select {
+			case <-time.After(ts.shutdownTimeout):
+				log.Warningf("%s did not exit within %v after the %s signal, killing it", ts.executable, ts.shutdownTimeout, signal)
+				_ = cmd.Process.Kill()
+			case <-exited:
+			}
+			return
+		case <-exited:
+			return
+		}
+	}
+}
+
+// handleOutput handles a message written by the program.
+func (ts *Exec) handleOutput(ctx context.Context, ch test.TestStepChannels, ev testevent.Emitter, targets *stepTargets, msg outputMessage) error {
+	var tgt *target.Target
+	if msg.Target != "" {
+		if tgt = targets.get(msg.Target); tgt == nil {
+			return fmt.Errorf("unknown target %s", msg.Target)
+		}
+	}
+	switch msg.Type {
+	case "result":
+		if tgt == nil {
+			return errors.New("result without target")
+		}
+		if msg.Error == "" {
+			select {
+			case ch.Out <- tgt:
+			case <-ctx.Done():
+			}
+			return nil
+		}
+		err := errors.New(msg.Error)
+		if msg.Skipped {
+			err = &cerrors.ErrTargetSkipped{Reason: msg.Error}
+		}
+		select {
+		case ch.Err <- cerrors.TargetError{Target: tgt, Err: err}:
+		case <-ctx.Done():
+		}
+	case "event":
+		if msg.Name == "" {
+			return errors.New("event without name")
+		}
+		payload, err := json.Marshal(eventExecPayload{Name: msg.Name, Payload: msg.Payload})
+		if err != nil {
+			return fmt.Errorf("invalid payload of event %s: %v", msg.Name, err)
+		}
+		rm := json.RawMessage(payload)
+		if err := ev.Emit(testevent.Data{EventName: EventExec, Target: tgt, Payload: &rm}); err != nil {
+			log.Warningf("Cannot emit event %s: %v", EventExec, err)
+		}
+	default:
+		return fmt.Errorf("unknown message type '%s'", msg.Type)
+	}
+	return nil
+}
+
+// Run executes the program, see the package documentation.
+func (ts *Exec) Run(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
+	if err := ts.validateAndPopulate(params); err != nil {
+		return err
+	}
+	cmd := osexec.Command(ts.executable, ts.args...)
+	cmd.Dir = ts.dir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	log.Printf("Running command '%+v'", cmd)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("cannot start %s: %v", ts.executable, err)
+	}
+	var (
+		targets    = stepTargets{targets: make(map[string]*target.Target)}
+		exited     = make(chan struct{})
+		inputsDone = make(chan struct{})
+		stderrDone = make(chan struct{})
+	)
+	go func() {
+		defer close(inputsDone)
+		ts.sendInputs(ctx, stdin, ch.In, params, &targets, cmd, exited)
+	}()
+	go func() {
+		defer close(stderrDone)
+		s := bufio.NewScanner(stderr)
+		for s.Scan() {
+			log.Infof("%s: %s", filepath.Base(ts.executable), s.Text())
+		}
+	}()
+
+	var protocolErr error
+	s := bufio.NewScanner(stdout)
+	s.Buffer(nil, maxMessageSize)
+	for s.Scan() {
+		if len(strings.TrimSpace(s.Text())) == 0 {
+			continue
+		}
+		var msg outputMessage
+		if err := json.Unmarshal(s.Bytes(), &msg); err != nil {
+			protocolErr = fmt.Errorf("invalid message '%s': %v", s.Text(), err)
+		} else {
+			protocolErr = ts.handleOutput(ctx, ch, ev, &targets, msg)
+		}
+		if protocolErr != nil {
+			break
+		}
+	}
+	if err := s.Err(); err != nil && protocolErr == nil {
+		protocolErr = fmt.Errorf("cannot read messages: %v", err)
+	}
+	if protocolErr != nil {
+		_ = cmd.Process.Kill()
+	}
+	// the outputs must be read before waiting for the program to exit
+	_, _ = io.Copy(ioutil.Discard, stdout)
+	<-stderrDone
+	waitErr := cmd.Wait()
+	close(exited)
+	<-inputsDone
+
+	switch {
+	case protocolErr != nil:
+		return fmt.Errorf("%s: %v", ts.executable, protocolErr)
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case waitErr != nil:
+		return fmt.Errorf("%s failed: %v", ts.executable, waitErr)
+	}
+	return nil
+}
+
+func (ts *Exec) validateAndPopulate(params test.TestStepParameters) error {
+	param := params.GetOne("executable")
+	if param.IsEmpty() {
+		return errors.New("invalid or missing 'executable' parameter, must be exactly one string")
+	}
+	ex := param.String()
+	if filepath.IsAbs(ex) {
+		ts.executable = ex
+	} else {
+		p, err := osexec.LookPath(ex)
+		if err != nil {
+			return fmt.Errorf("cannot find '%s' executable in PATH: %v", ex, err)
+		}
+		ts.executable = p
+	}
+	ts.args = nil
+	for _, arg := range params.Get("args") {
+		ts.args = append(ts.args, arg.String())
+	}
+	ts.dir = params.GetOne("dir").String()
+	ts.shutdownTimeout = DefaultShutdownTimeout
+	if timeout := params.GetOne("shutdownTimeout"); !timeout.IsEmpty() {
+		d, err := time.ParseDuration(timeout.String())
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid 'shutdownTimeout' parameter '%s', must be a positive duration", timeout.String())
+		}
+		ts.shutdownTimeout = d
+	}
+	return nil
+}
+
+// parametersSchema is the JSON schema of the parameters of the step. The
+// program may take further parameters, which are not described.
+var parametersSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"executable": {
+			"description": "The absolute path of the program, or its name in PATH",
+			"type": "array",
+			"items": {"type": "string", "minLength": 1},
+			"minItems": 1
+		},
+		"args": {
+			"description": "The arguments of the program",
+			"type": "array",
+			"items": {"type": "string"}
+		},
+		"dir": {
+			"description": "The working directory of the program",
+			"type": "array",
+			"items": {"type": "string"}
+		},
+		"shutdownTimeout": {
+			"description": "How long the program may take to exit once signalled, e.g. 30s",
+			"type": "array",
+			"items": {"type": "string"}
+		}
+	},
+	"required": ["executable"]
+}`)
+
+// ParametersSchema returns the JSON schema of the parameters of the step.
+func (ts *Exec) ParametersSchema() json.RawMessage {
+	return parametersSchema
+}
+
+// ValidateParameters validates the parameters associated to the TestStep
+func (ts *Exec) ValidateParameters(params test.TestStepParameters) error {
+	return ts.validateAndPopulate(params)
+}
+
+// Resume tries to resume a previously interrupted test step. Exec cannot
+// resume.
+func (ts *Exec) Resume(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.EmitterFetcher) error {
+	return &cerrors.ErrResumeNotSupported{StepName: Name}
+}
+
+// CanResume tells whether this step is able to resume.
+func (ts *Exec) CanResume() bool {
+	return false
+}
+
+// New initializes and returns a new Exec test step.
+func New() test.TestStep {
+	return &Exec{}
+}
+
+// Load returns the name, factory and events which are needed to register the step.
+func Load() (string, test.TestStepFactory, []event.Name) {
+	return Name, New, Events
+}
@@ -0,0 +1,221 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package exec
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/cerrors"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/lib/jsonschema"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+	"github.com/facebookincubator/contest/pkg/xcontext"
+
+	"github.com/stretchr/testify/require"
+)
+
+const programEnv = "CONTEST_EXEC_TEST_PROGRAM"
+
+// TestMain runs the test binary as the program of the step when started by
+// the step, with the behaviour selected by its first argument.
+func TestMain(m *testing.M) {
+	if os.Getenv(programEnv) != "" {
+		runProgram(os.Args[1])
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runProgram implements the exec protocol. Targets are passed, except for
+// the one with ID fail, which fails, and the one with ID skip, which is
+// skipped. In wait mode no result is written, and in stubborn mode signals
+// are ignored too. In garbage mode an invalid message is written.
+func runProgram(mode string) {
+	if mode == "garbage" {
+		fmt.Println("not json")
+	}
+	out := json.NewEncoder(os.Stdout)
+	s := bufio.NewScanner(os.Stdin)
+	var params test.TestStepParameters
+	for s.Scan() {
+		var msg inputMessage
+		if err := json.Unmarshal(s.Bytes(), &msg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		switch msg.Type {
+		case "start":
+			params = msg.Parameters
+		case "target":
+			if mode != "normal" {
+				continue
+			}
+			id := msg.Target.ID
+			_ = out.Encode(map[string]interface{}{"type": "event", "target": id, "name": "Seen", "payload": map[string]string{"text": params.GetOne("text").String()}})
+			switch id {
+			case "fail":
+				_ = out.Encode(map[string]interface{}{"type": "result", "target": id, "error": "failed"})
+			case "skip":
+				_ = out.Encode(map[string]interface{}{"type": "result", "target": id, "error": "not applicable", "skipped": true})
+			default:
+				_ = out.Encode(map[string]interface{}{"type": "result", "target": id})
+			}
+		case "end":
+			if mode == "normal" {
+				return
+			}
+		case "signal":
+			fmt.Fprintf(os.Stderr, "got %s signal\n", msg.Signal)
+			if mode != "stubborn" {
+				return
+			}
+		}
+	}
+	if mode == "stubborn" {
+		time.Sleep(time.Minute)
+	}
+}
+
+type recordingEmitter struct {
+	mu     sync.Mutex
+	events []testevent.Data
+}
+
+func (e *recordingEmitter) Emit(data testevent.Data) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, data)
+	return nil
+}
+
+func stepParams(t *testing.T, mode string, extra map[string]string) test.TestStepParameters {
+	params := map[string]string{"executable": os.Args[0], "args": mode}
+	for k, v := range extra {
+		params[k] = v
+	}
+	p := make(test.TestStepParameters)
+	for k, v := range params {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		p[k] = []test.Param{{RawMessage: data}}
+	}
+	return p
+}
+
+// setProgramEnv makes the programs started by the step run as programs,
+// until the test ends.
+func setProgramEnv(t *testing.T) {
+	prev, set := os.LookupEnv(programEnv)
+	require.NoError(t, os.Setenv(programEnv, "1"))
+	t.Cleanup(func() {
+		if set {
+			_ = os.Setenv(programEnv, prev)
+		} else {
+			_ = os.Unsetenv(programEnv)
+		}
+	})
+}
+
+func TestExec(t *testing.T) {
+	setProgramEnv(t)
+	step := New()
+	params := stepParams(t, "normal", map[string]string{"text": "hello"})
+	require.NoError(t, step.ValidateParameters(params))
+
+	targets := []*target.Target{{ID: "pass", Name: "one"}, {ID: "fail", Name: "two"}, {ID: "skip", Name: "three"}}
+	var (
+		in     = make(chan *target.Target)
+		out    = make(chan *target.Target, len(targets))
+		errs   = make(chan cerrors.TargetError, len(targets))
+		ev     recordingEmitter
+		result = make(chan error, 1)
+	)
+	go func() {
+		result <- step.Run(context.Background(), test.TestStepChannels{In: in, Out: out, Err: errs}, params, &ev)
+	}()
+	for _, tgt := range targets {
+		in <- tgt
+	}
+	close(in)
+	require.NoError(t, <-result)
+
+	require.Len(t, out, 1)
+	require.Same(t, targets[0], <-out)
+	require.Len(t, errs, 2)
+	failed := <-errs
+	require.Same(t, targets[1], failed.Target)
+	require.EqualError(t, failed.Err, "failed")
+	skipped := <-errs
+	require.Same(t, targets[2], skipped.Target)
+	require.Equal(t, &cerrors.ErrTargetSkipped{Reason: "not applicable"}, skipped.Err)
+
+	require.Len(t, ev.events, 3)
+	for idx, data := range ev.events {
+		require.Equal(t, EventExec, data.EventName)
+		require.Same(t, targets[idx], data.Target)
+		require.JSONEq(t, `{"Name":"Seen","Payload":{"text":"hello"}}`, string(*data.Payload))
+	}
+}
+
+func TestExecSignals(t *testing.T) {
+	setProgramEnv(t)
+	for _, mode := range []string{"wait", "stubborn"} {
+		t.Run(mode, func(t *testing.T) {
+			var (
+				in          = make(chan *target.Target, 1)
+				pause       = make(chan struct{})
+				ctx, cancel = xcontext.New(context.Background(), nil, pause)
+				result      = make(chan error, 1)
+			)
+			defer cancel()
+			in <- &target.Target{ID: "pass"}
+			params := stepParams(t, mode, map[string]string{"shutdownTimeout": "100ms"})
+			go func() {
+				result <- New().Run(ctx, test.TestStepChannels{In: in, Out: make(chan *target.Target), Err: make(chan cerrors.TargetError)}, params, &recordingEmitter{})
+			}()
+			close(pause)
+			select {
+			case err := <-result:
+				require.Equal(t, xcontext.ErrPaused, err)
+			case <-time.After(10 * time.Second):
+				t.Fatal("the step did not return once paused")
+			}
+		})
+	}
+}
+
+func TestExecInvalidMessage(t *testing.T) {
+	setProgramEnv(t)
+	in := make(chan *target.Target)
+	close(in)
+	err := New().Run(context.Background(), test.TestStepChannels{In: in}, stepParams(t, "garbage", nil), &recordingEmitter{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid message 'not json'")
+}
+
+func TestExecValidateParameters(t *testing.T) {
+	step := New()
+	require.Error(t, step.ValidateParameters(test.TestStepParameters{}))
+	require.Error(t, step.ValidateParameters(stepParams(t, "normal", map[string]string{"shutdownTimeout": "soon"})))
+	require.NoError(t, step.ValidateParameters(stepParams(t, "normal", map[string]string{"shutdownTimeout": "1s"})))
+}
+
+func TestExecParametersSchema(t *testing.T) {
+	schema, err := jsonschema.Compile(New().(test.TestStepWithSchema).ParametersSchema())
+	require.NoError(t, err)
+	params, err := json.Marshal(stepParams(t, "normal", map[string]string{"shutdownTimeout": "1s"}))
+	require.NoError(t, err)
+	require.NoError(t, schema.Validate(params))
+	require.Error(t, schema.Validate([]byte(`{"args": ["normal"]}`)))
+}
@@ -0,0 +1,118 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package lava
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LAVA job states and healths as reported by the REST API.
+const (
+	stateFinished = "Finished"
+
+	healthComplete = "Complete"
+)
+
+// jobStatus is the subset of a LAVA job object that the step cares about.
+type jobStatus struct {
+	ID     int    `json:"id"`
+	State  string `json:"state"`
+	Health string `json:"health"`
+}
+
+// client is a minimal client for the LAVA REST API (v0.2).
+type client struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+func newClient(server, token string) *client {
+	return &client{
+		server: strings.TrimRight(server, "/"),
+		token:  token,
+		http:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *client) do(method, path string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, c.server+"/api/v0.2"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Token "+c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response to %s %s: %v", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s returned status %d: %s", method, path, resp.StatusCode, data)
+	}
+	return data, nil
+}
+
+// submit submits a job definition and returns the ID of the created job.
+func (c *client) submit(definition string) (int, error) {
+	body, err := json.Marshal(map[string]string{"definition": definition})
+	if err != nil {
+		return 0, err
+	}
+	data, err := c.do(http.MethodPost, "/jobs/", bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("cannot submit job: %v", err)
+	}
+	var resp struct {
+		JobIDs []int `json:"job_ids"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return 0, fmt.Errorf("cannot decode submission response: %v", err)
+	}
+	if len(resp.JobIDs) != 1 {
+		return 0, fmt.Errorf("expected exactly one job ID in submission response, got %d", len(resp.JobIDs))
+	}
+	return resp.JobIDs[0], nil
+}
+
+// status returns the current status of a job.
+func (c *client) status(id int) (*jobStatus, error) {
+	data, err := c.do(http.MethodGet, fmt.Sprintf("/jobs/%d/", id), nil)
+	if err != nil {
+		return nil, err
+	}
+	var st jobStatus
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("cannot decode job status: %v", err)
+	}
+	return &st, nil
+}
+
+// cancel requests the cancellation of a job.
+func (c *client) cancel(id int) error {
+	_, err := c.do(http.MethodPost, fmt.Sprintf("/jobs/%d/cancel/", id), nil)
+	return err
+}
+
+// logs returns the raw log of a job.
+func (c *client) logs(id int) ([]byte, error) {
+	return c.do(http.MethodGet, fmt.Sprintf("/jobs/%d/logs/", id), nil)
+}
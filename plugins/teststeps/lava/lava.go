@@ -0,0 +1,240 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package lava implements a test step that delegates the execution on a target
+// to an external LAVA (https://www.lavasoftware.org) instance. A job definition
+// is expanded for each target, submitted to LAVA, and polled until completion.
+// The LAVA verdict and the job log are mapped back into ConTest events.
+package lava
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/cerrors"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+)
+
+// Name is the name used to look this plugin up.
+var Name = "Lava"
+
+var log = logging.GetLogger("teststeps/" + strings.ToLower(Name))
+
+// event names for this plugin.
+const (
+	EventLavaJobSubmitted = event.Name("LavaJobSubmitted")
+	EventLavaJobFinished  = event.Name("LavaJobFinished")
+	EventLavaJobLog       = event.Name("LavaJobLog")
+)
+
+// Events defines the events that a TestStep is allow to emit
+var Events = []event.Name{
+	EventLavaJobSubmitted,
+	EventLavaJobFinished,
+	EventLavaJobLog,
+}
+
+const (
+	defaultPollInterval = 30 * time.Second
+	// maxLogSize is the maximum number of bytes of the LAVA job log that are
+	// stored in an EventLavaJobLog event. Longer logs are truncated from the
+	// beginning, as the tail is usually the most interesting part.
+	maxLogSize = 64 * 1024
+)
+
+type eventJobPayload struct {
+	Server string
+	JobID  int
+	State  string `json:",omitempty"`
+	Health string `json:",omitempty"`
+}
+
+type eventLogPayload struct {
+	JobID     int
+	Log       string
+	Truncated bool
+}
+
+// Lava is a test step that runs jobs on an external LAVA instance.
+type Lava struct {
+	server       string
+	token        string
+	definition   *test.Param
+	pollInterval time.Duration
+	timeout      time.Duration
+}
+
+// Name returns the plugin name.
+func (ts Lava) Name() string {
+	return Name
+}
+
+func emitEvent(ev testevent.Emitter, name event.Name, tgt *target.Target, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Warningf("Cannot encode payload for %s: %v", name, err)
+		return
+	}
+	rm := json.RawMessage(data)
+	if err := ev.Emit(testevent.Data{EventName: name, Target: tgt, Payload: &rm}); err != nil {
+		log.Warningf("Cannot emit event %s: %v", name, err)
+	}
+}
+
+// waitJob polls LAVA until the job is finished, the timeout expires, or
+// the context is done. It returns a nil status in the latter case.
+func (ts *Lava) waitJob(ctx context.Context, c *client, id int) (*jobStatus, error) {
+	var deadline <-chan time.Time
+	if ts.timeout > 0 {
+		timer := time.NewTimer(ts.timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	ticker := time.NewTicker(ts.pollInterval)
+	defer ticker.Stop()
+	for {
+		st, err := c.status(id)
+		if err != nil {
+			// transient errors are tolerated, LAVA will be polled again at the
+			// next tick.
+			log.Warningf("Cannot get status of LAVA job %d: %v", id, err)
+		} else if st.State == stateFinished {
+			return st, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline:
+			if err := c.cancel(id); err != nil {
+				log.Warningf("Cannot cancel LAVA job %d: %v", id, err)
+			}
+			return nil, fmt.Errorf("LAVA job %d did not finish within %s", id, ts.timeout)
+		case <-ctx.Done():
+			// the step cannot resume, so the LAVA job is useless after a pause
+			// as well.
+			if err := c.cancel(id); err != nil {
+				log.Warningf("Cannot cancel LAVA job %d: %v", id, err)
+			}
+			return nil, nil
+		}
+	}
+}
+
+func (ts *Lava) runTarget(ctx context.Context, tgt *target.Target, ev testevent.Emitter) error {
+	definition, err := ts.definition.Expand(tgt)
+	if err != nil {
+		return fmt.Errorf("failed to expand job definition: %v", err)
+	}
+	c := newClient(ts.server, ts.token)
+	id, err := c.submit(definition)
+	if err != nil {
+		return err
+	}
+	log.Infof("Submitted LAVA job %d for target %s", id, tgt)
+	emitEvent(ev, EventLavaJobSubmitted, tgt, eventJobPayload{Server: ts.server, JobID: id})
+
+	st, err := ts.waitJob(ctx, c, id)
+	if err != nil {
+		return err
+	}
+	if st == nil {
+		return nil
+	}
+	emitEvent(ev, EventLavaJobFinished, tgt, eventJobPayload{Server: ts.server, JobID: id, State: st.State, Health: st.Health})
+
+	if logData, err := c.logs(id); err != nil {
+		log.Warningf("Cannot fetch log of LAVA job %d: %v", id, err)
+	} else {
+		payload := eventLogPayload{JobID: id}
+		if len(logData) > maxLogSize {
+			logData = logData[len(logData)-maxLogSize:]
+			payload.Truncated = true
+		}
+		payload.Log = string(logData)
+		emitEvent(ev, EventLavaJobLog, tgt, payload)
+	}
+
+	if st.Health != healthComplete {
+		return fmt.Errorf("LAVA job %d finished with health '%s'", id, st.Health)
+	}
+	return nil
+}
+
+// Run executes the step.
+func (ts *Lava) Run(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
+	if err := ts.validateAndPopulate(params); err != nil {
+		return err
+	}
+	f := func(ctx context.Context, tgt *target.Target) error {
+		return ts.runTarget(ctx, tgt, ev)
+	}
+	return test.ForEachTarget(ctx, Name, ch, f)
+}
+
+func (ts *Lava) validateAndPopulate(params test.TestStepParameters) error {
+	server := params.GetOne("server")
+	if server.IsEmpty() {
+		return errors.New("missing 'server' parameter")
+	}
+	ts.server = server.String()
+	ts.token = params.GetOne("token").String()
+	ts.definition = params.GetOne("definition")
+	if ts.definition.IsEmpty() {
+		return errors.New("missing 'definition' parameter")
+	}
+	ts.pollInterval = defaultPollInterval
+	if p := params.GetOne("poll_interval"); !p.IsEmpty() {
+		d, err := time.ParseDuration(p.String())
+		if err != nil {
+			return fmt.Errorf("invalid 'poll_interval' parameter: %v", err)
+		}
+		if d <= 0 {
+			return errors.New("'poll_interval' must be positive")
+		}
+		ts.pollInterval = d
+	}
+	ts.timeout = 0
+	if p := params.GetOne("timeout"); !p.IsEmpty() {
+		d, err := time.ParseDuration(p.String())
+		if err != nil {
+			return fmt.Errorf("invalid 'timeout' parameter: %v", err)
+		}
+		ts.timeout = d
+	}
+	return nil
+}
+
+// ValidateParameters validates the parameters associated to the TestStep
+func (ts *Lava) ValidateParameters(params test.TestStepParameters) error {
+	return ts.validateAndPopulate(params)
+}
+
+// Resume tries to resume a previously interrupted test step. Lava cannot
+// resume.
+func (ts *Lava) Resume(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.EmitterFetcher) error {
+	return &cerrors.ErrResumeNotSupported{StepName: Name}
+}
+
+// CanResume tells whether this step is able to resume.
+func (ts *Lava) CanResume() bool {
+	return false
+}
+
+// New initializes and returns a new Lava test step.
+func New() test.TestStep {
+	return &Lava{}
+}
+
+// Load returns the name, factory and events which are needed to register the step.
+func Load() (string, test.TestStepFactory, []event.Name) {
+	return Name, New, Events
+}
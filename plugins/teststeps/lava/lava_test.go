@@ -0,0 +1,114 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package lava
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+	"github.com/stretchr/testify/require"
+)
+
+type memEmitter struct {
+	mu     sync.Mutex
+	events []testevent.Data
+}
+
+func (e *memEmitter) Emit(data testevent.Data) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, data)
+	return nil
+}
+
+func newLavaServer(t *testing.T, health string) *httptest.Server {
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v0.2/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Token secret", r.Header.Get("Authorization"))
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v0.2/jobs/":
+			var req map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			require.Equal(t, "device: host001", req["definition"])
+			fmt.Fprint(w, `{"job_ids": [42]}`)
+		case r.URL.Path == "/api/v0.2/jobs/42/":
+			polls++
+			state := "Running"
+			if polls > 1 {
+				state = "Finished"
+			}
+			fmt.Fprintf(w, `{"id": 42, "state": %q, "health": %q}`, state, health)
+		case r.URL.Path == "/api/v0.2/jobs/42/logs/":
+			fmt.Fprint(w, "boot ok")
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	return httptest.NewServer(mux)
+}
+
+func newParams(server string) test.TestStepParameters {
+	return test.TestStepParameters{
+		"server":        []test.Param{*test.NewParam(server)},
+		"token":         []test.Param{*test.NewParam("secret")},
+		"definition":    []test.Param{*test.NewParam("device: {{ .Name }}")},
+		"poll_interval": []test.Param{*test.NewParam("10ms")},
+	}
+}
+
+func TestLavaJobComplete(t *testing.T) {
+	srv := newLavaServer(t, "Complete")
+	defer srv.Close()
+
+	ts := New().(*Lava)
+	require.NoError(t, ts.ValidateParameters(newParams(srv.URL)))
+	ev := &memEmitter{}
+	err := ts.runTarget(context.Background(), &target.Target{Name: "host001"}, ev)
+	require.NoError(t, err)
+	require.Len(t, ev.events, 3)
+	require.Equal(t, EventLavaJobSubmitted, ev.events[0].EventName)
+	require.Equal(t, EventLavaJobFinished, ev.events[1].EventName)
+	require.Equal(t, EventLavaJobLog, ev.events[2].EventName)
+	var logPayload eventLogPayload
+	require.NoError(t, json.Unmarshal(*ev.events[2].Payload, &logPayload))
+	require.Equal(t, "boot ok", logPayload.Log)
+}
+
+func TestLavaJobIncomplete(t *testing.T) {
+	srv := newLavaServer(t, "Incomplete")
+	defer srv.Close()
+
+	ts := New().(*Lava)
+	require.NoError(t, ts.ValidateParameters(newParams(srv.URL)))
+	err := ts.runTarget(context.Background(), &target.Target{Name: "host001"}, &memEmitter{})
+	require.Error(t, err)
+}
+
+func TestLavaValidateParameters(t *testing.T) {
+	ts := New()
+	params := newParams("http://lava.example.com")
+	delete(params, "definition")
+	require.Error(t, ts.ValidateParameters(params))
+
+	params = newParams("http://lava.example.com")
+	params["poll_interval"] = []test.Param{*test.NewParam("0s")}
+	require.Error(t, ts.ValidateParameters(params))
+
+	params = newParams("http://lava.example.com")
+	params["timeout"] = []test.Param{*test.NewParam("1h")}
+	require.NoError(t, ts.ValidateParameters(params))
+	require.Equal(t, time.Hour, ts.(*Lava).timeout)
+}
@@ -0,0 +1,315 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package limitedcmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/cerrors"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+)
+
+// Name is the name used to look this plugin up.
+var Name = "LimitedCmd"
+
+var log = logging.GetLogger("teststeps/" + strings.ToLower(Name))
+
+// event names for this plugin.
+const (
+	EventLimitedCmdStart     = event.Name("LimitedCmdStart")
+	EventLimitedCmdEnd       = event.Name("LimitedCmdEnd")
+	EventLimitedCmdViolation = event.Name("LimitedCmdViolation")
+)
+
+// Events defines the events that a TestStep is allow to emit
+var Events = []event.Name{
+	EventLimitedCmdStart,
+	EventLimitedCmdEnd,
+	EventLimitedCmdViolation,
+}
+
+// kinds of limit violation reported in EventLimitedCmdViolation.
+const (
+	violationTime   = "time"
+	violationCPU    = "cpu"
+	violationMemory = "memory"
+)
+
+// limits holds the resource constraints applied to the spawned process. Zero
+// values mean no limit.
+type limits struct {
+	// Timeout is the maximum wall-clock time the process is allowed to run.
+	Timeout time.Duration
+	// CPUTime is the maximum CPU time (user + system) of the process,
+	// enforced via RLIMIT_CPU.
+	CPUTime time.Duration
+	// MaxMemory is the maximum size in bytes of the address space of the
+	// process, enforced via RLIMIT_AS. Allocations beyond it fail rather
+	// than kill the process, so a process which fails after its address
+	// space came near the limit is reported as violating it.
+	MaxMemory uint64
+	// Cgroup is the path of an existing cgroup (v2) directory the process
+	// is moved into, for deployments that prefer cgroup controllers over
+	// rlimits.
+	Cgroup string
+}
+
+// resourceUsage is the resource consumption of a terminated process.
+type resourceUsage struct {
+	UserTime   time.Duration
+	SystemTime time.Duration
+	// MaxRSS is the peak resident set size in bytes, if available.
+	MaxRSS uint64
+	// VirtualMemoryPeak is the peak size in bytes of the address space of
+	// the process, as last sampled while it ran, if available.
+	VirtualMemoryPeak uint64
+	// Signal is the name of the signal that terminated the process, if any.
+	Signal string
+}
+
+// memoryNearLimit is the fraction of the memory limit above which the address
+// space of a failed process is deemed to have hit the limit: the allocation
+// which failed is not accounted for, and the last one may not be sampled.
+const memoryNearLimit = 0.9
+
+// eventStartPayload is the payload of an EventLimitedCmdStart event.
+type eventStartPayload struct {
+	Path   string
+	Args   []string
+	Dir    string
+	Limits limits
+}
+
+// eventEndPayload is the payload of an EventLimitedCmdEnd event.
+type eventEndPayload struct {
+	ExitCode int
+	Usage    resourceUsage
+	Duration time.Duration
+}
+
+// eventViolationPayload is the payload of an EventLimitedCmdViolation event.
+type eventViolationPayload struct {
+	Violation string
+	Limits    limits
+	Usage     resourceUsage
+}
+
+// LimitedCmd runs a local command under resource constraints (wall-clock
+// time, CPU time, memory) and kills it when they are violated.
+type LimitedCmd struct {
+	executable string
+	args       []test.Param
+	dir        string
+	limits     limits
+}
+
+// Name returns the plugin name.
+func (ts LimitedCmd) Name() string {
+	return Name
+}
+
+func emitEvent(ev testevent.Emitter, name event.Name, tgt *target.Target, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Warningf("Cannot encode payload for %s: %v", name, err)
+		return
+	}
+	rm := json.RawMessage(data)
+	if err := ev.Emit(testevent.Data{EventName: name, Target: tgt, Payload: &rm}); err != nil {
+		log.Warningf("Cannot emit event %s: %v", name, err)
+	}
+}
+
+// violation returns the kind of limit that the process violated, or an empty
+// string if it did not violate any.
+func (l limits) violation(ctxErr error, exitCode int, usage resourceUsage) string {
+	if l.Timeout > 0 && ctxErr == context.DeadlineExceeded {
+		return violationTime
+	}
+	if usage.Signal == "" && exitCode == 0 {
+		return ""
+	}
+	if l.CPUTime > 0 && usage.Signal != "" && (usage.Signal == "SIGXCPU" || usage.UserTime+usage.SystemTime >= l.CPUTime) {
+		return violationCPU
+	}
+	if l.MaxMemory > 0 && (usage.MaxRSS >= l.MaxMemory || float64(usage.VirtualMemoryPeak) >= memoryNearLimit*float64(l.MaxMemory)) {
+		return violationMemory
+	}
+	return ""
+}
+
+func (ts *LimitedCmd) runTarget(ctx context.Context, target *target.Target, ev testevent.Emitter) error {
+	var (
+		cmdCtx    context.Context
+		ctxCancel context.CancelFunc
+	)
+	if ts.limits.Timeout > 0 {
+		cmdCtx, ctxCancel = context.WithTimeout(ctx, ts.limits.Timeout)
+	} else {
+		cmdCtx, ctxCancel = context.WithCancel(ctx)
+	}
+	defer ctxCancel()
+
+	var args []string
+	for _, arg := range ts.args {
+		expArg, err := arg.Expand(target)
+		if err != nil {
+			return fmt.Errorf("failed to expand argument '%s': %v", arg, err)
+		}
+		args = append(args, expArg)
+	}
+	cmd := exec.CommandContext(cmdCtx, ts.executable, args...)
+	cmd.Dir = ts.dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	log.Printf("Running command '%+v' with limits %+v", cmd, ts.limits)
+	startPayload := eventStartPayload{Path: cmd.Path, Args: cmd.Args, Dir: cmd.Dir, Limits: ts.limits}
+
+	start := time.Now()
+	if err := startLimited(cmd, ts.limits); err != nil {
+		return fmt.Errorf("cannot start command '%s': %v", ts.executable, err)
+	}
+	emitEvent(ev, EventLimitedCmdStart, target, startPayload)
+	stopWatch := watchMemory(cmd.Process.Pid)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- cmd.Wait()
+	}()
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		ctxCancel()
+		<-errCh
+		stopWatch()
+		return nil
+	}
+
+	usage := getUsage(cmd.ProcessState)
+	usage.VirtualMemoryPeak = stopWatch()
+	emitEvent(ev, EventLimitedCmdEnd, target, eventEndPayload{
+		ExitCode: cmd.ProcessState.ExitCode(),
+		Usage:    usage,
+		Duration: time.Since(start),
+	})
+	log.Infof("Stdout of command '%s' with args '%s' is '%s'", startPayload.Path, startPayload.Args, stdout.Bytes())
+	if v := ts.limits.violation(cmdCtx.Err(), cmd.ProcessState.ExitCode(), usage); v != "" {
+		emitEvent(ev, EventLimitedCmdViolation, target, eventViolationPayload{Violation: v, Limits: ts.limits, Usage: usage})
+		return fmt.Errorf("command '%s' failed after exceeding %s limit", ts.executable, v)
+	}
+	if err != nil {
+		log.Warningf("Stderr of command '%s' with args '%s' is: '%s'", startPayload.Path, startPayload.Args, stderr.Bytes())
+	}
+	return err
+}
+
+// Run executes the step.
+func (ts *LimitedCmd) Run(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
+	if err := ts.validateAndPopulate(params); err != nil {
+		return err
+	}
+	f := func(ctx context.Context, target *target.Target) error {
+		return ts.runTarget(ctx, target, ev)
+	}
+	return test.ForEachTarget(ctx, Name, ch, f)
+}
+
+func parseDuration(params test.TestStepParameters, name string) (time.Duration, error) {
+	p := params.GetOne(name)
+	if p.IsEmpty() {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(p.String())
+	if err != nil {
+		return 0, fmt.Errorf("invalid '%s' parameter: %v", name, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("'%s' parameter cannot be negative", name)
+	}
+	return d, nil
+}
+
+func (ts *LimitedCmd) validateAndPopulate(params test.TestStepParameters) error {
+	param := params.GetOne("executable")
+	if param.IsEmpty() {
+		return errors.New("invalid or missing 'executable' parameter, must be exactly one string")
+	}
+	ex := param.String()
+	if filepath.IsAbs(ex) {
+		ts.executable = ex
+	} else {
+		p, err := exec.LookPath(ex)
+		if err != nil {
+			return fmt.Errorf("cannot find '%s' executable in PATH: %v", ex, err)
+		}
+		ts.executable = p
+	}
+	ts.args = params.Get("args")
+	ts.dir = params.GetOne("dir").String()
+
+	var (
+		l   limits
+		err error
+	)
+	if l.Timeout, err = parseDuration(params, "timeout"); err != nil {
+		return err
+	}
+	if l.CPUTime, err = parseDuration(params, "cpu_time"); err != nil {
+		return err
+	}
+	if mem := params.GetOne("max_memory"); !mem.IsEmpty() {
+		l.MaxMemory, err = strconv.ParseUint(mem.String(), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid 'max_memory' parameter, must be a number of bytes: %v", err)
+		}
+	}
+	l.Cgroup = params.GetOne("cgroup").String()
+	if l.Timeout == 0 && l.CPUTime == 0 && l.MaxMemory == 0 && l.Cgroup == "" {
+		return errors.New("at least one of 'timeout', 'cpu_time', 'max_memory' or 'cgroup' must be specified")
+	}
+	ts.limits = l
+	return nil
+}
+
+// ValidateParameters validates the parameters associated to the TestStep
+func (ts *LimitedCmd) ValidateParameters(params test.TestStepParameters) error {
+	return ts.validateAndPopulate(params)
+}
+
+// Resume tries to resume a previously interrupted test step. LimitedCmd cannot
+// resume.
+func (ts *LimitedCmd) Resume(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.EmitterFetcher) error {
+	return &cerrors.ErrResumeNotSupported{StepName: Name}
+}
+
+// CanResume tells whether this step is able to resume.
+func (ts *LimitedCmd) CanResume() bool {
+	return false
+}
+
+// New initializes and returns a new LimitedCmd test step.
+func New() test.TestStep {
+	return &LimitedCmd{}
+}
+
+// Load returns the name, factory and events which are needed to register the step.
+func Load() (string, test.TestStepFactory, []event.Name) {
+	return Name, New, Events
+}
@@ -0,0 +1,142 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package limitedcmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+
+	"github.com/stretchr/testify/require"
+)
+
+const programEnv = "CONTEST_LIMITEDCMD_TEST_PROGRAM"
+
+// TestMain runs the test binary as the command of the step when started by
+// the step, with the behaviour selected by its arguments.
+func TestMain(m *testing.M) {
+	if os.Getenv(programEnv) != "" {
+		os.Exit(runProgram(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+// programs are the behaviours of the test binary run as a command, selected
+// by its first argument. They return the exit code of the command.
+var programs = map[string]func(args []string) int{
+	"sleep": func([]string) int {
+		time.Sleep(time.Minute)
+		return 0
+	},
+	"exit": func(args []string) int {
+		code, _ := strconv.Atoi(args[0])
+		return code
+	},
+}
+
+func runProgram(args []string) int {
+	return programs[args[0]](args[1:])
+}
+
+type recordingEmitter struct {
+	mu     sync.Mutex
+	events []testevent.Data
+}
+
+func (e *recordingEmitter) Emit(data testevent.Data) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, data)
+	return nil
+}
+
+// violation returns the payload of the violation event, if any.
+func (e *recordingEmitter) violation(t *testing.T) *eventViolationPayload {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, data := range e.events {
+		if data.EventName == EventLimitedCmdViolation {
+			var payload eventViolationPayload
+			require.NoError(t, json.Unmarshal(*data.Payload, &payload))
+			return &payload
+		}
+	}
+	return nil
+}
+
+func stepParams(t *testing.T, args []string, limits map[string]string) test.TestStepParameters {
+	p := make(test.TestStepParameters)
+	data, err := json.Marshal(os.Args[0])
+	require.NoError(t, err)
+	p["executable"] = []test.Param{{RawMessage: data}}
+	for _, arg := range args {
+		data, err := json.Marshal(arg)
+		require.NoError(t, err)
+		p["args"] = append(p["args"], test.Param{RawMessage: data})
+	}
+	for k, v := range limits {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		p[k] = []test.Param{{RawMessage: data}}
+	}
+	return p
+}
+
+// run runs the test binary as the command of the step on a target, with the
+// given arguments and limits.
+func run(t *testing.T, args []string, limits map[string]string) (*recordingEmitter, error) {
+	prev, set := os.LookupEnv(programEnv)
+	require.NoError(t, os.Setenv(programEnv, "1"))
+	t.Cleanup(func() {
+		if set {
+			_ = os.Setenv(programEnv, prev)
+		} else {
+			_ = os.Unsetenv(programEnv)
+		}
+	})
+	step := New().(*LimitedCmd)
+	require.NoError(t, step.ValidateParameters(stepParams(t, args, limits)))
+	var ev recordingEmitter
+	err := step.runTarget(context.Background(), &target.Target{ID: "target"}, &ev)
+	return &ev, err
+}
+
+func TestLimitedCmdTimeout(t *testing.T) {
+	start := time.Now()
+	ev, err := run(t, []string{"sleep"}, map[string]string{"timeout": "200ms"})
+	require.Error(t, err)
+	require.Less(t, int64(time.Since(start)), int64(10*time.Second))
+	violation := ev.violation(t)
+	require.NotNil(t, violation)
+	require.Equal(t, violationTime, violation.Violation)
+}
+
+func TestLimitedCmdNoViolation(t *testing.T) {
+	ev, err := run(t, []string{"exit", "0"}, map[string]string{"timeout": "10s"})
+	require.NoError(t, err)
+	require.Nil(t, ev.violation(t))
+
+	ev, err = run(t, []string{"exit", "1"}, map[string]string{"timeout": "10s"})
+	require.Error(t, err)
+	require.Nil(t, ev.violation(t))
+}
+
+func TestLimitedCmdValidateParameters(t *testing.T) {
+	step := New()
+	require.Error(t, step.ValidateParameters(test.TestStepParameters{}))
+	require.Error(t, step.ValidateParameters(stepParams(t, nil, nil)))
+	require.Error(t, step.ValidateParameters(stepParams(t, nil, map[string]string{"timeout": "soon"})))
+	require.Error(t, step.ValidateParameters(stepParams(t, nil, map[string]string{"max_memory": "1G"})))
+	require.NoError(t, step.ValidateParameters(stepParams(t, nil, map[string]string{"cpu_time": "1s", "max_memory": "1000000"})))
+}
@@ -0,0 +1,234 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package limitedcmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// limitsEnv carries the limits to the helper process which applies them, see
+// startLimited.
+const limitsEnv = "CONTEST_LIMITEDCMD_LIMITS"
+
+// memorySampleInterval is the interval between two samples of the peak
+// address space size of a process.
+const memorySampleInterval = 50 * time.Millisecond
+
+func init() {
+	if encoded, ok := os.LookupEnv(limitsEnv); ok {
+		runHelper(encoded)
+	}
+}
+
+// runHelper runs in the helper process started by startLimited. It applies
+// the limits to itself, then executes the command in its arguments, which
+// inherits them. Errors are written to the status pipe, file descriptor 3,
+// which a successful exec closes.
+func runHelper(encoded string) {
+	status := os.NewFile(3, "status")
+	fail := func(err error) {
+		fmt.Fprint(status, err)
+		os.Exit(127)
+	}
+	syscall.CloseOnExec(3)
+	if len(os.Args) < 2 {
+		fail(fmt.Errorf("no command to execute"))
+	}
+	var l limits
+	if err := json.Unmarshal([]byte(encoded), &l); err != nil {
+		fail(fmt.Errorf("invalid limits: %v", err))
+	}
+	var env []string
+	for _, v := range os.Environ() {
+		if !strings.HasPrefix(v, limitsEnv+"=") {
+			env = append(env, v)
+		}
+	}
+	// nothing is allocated once the limits are applied, as they may leave
+	// no room for it
+	argv0, err := syscall.BytePtrFromString(os.Args[1])
+	if err != nil {
+		fail(err)
+	}
+	argv, err := syscall.SlicePtrFromStrings(os.Args[1:])
+	if err != nil {
+		fail(err)
+	}
+	envv, err := syscall.SlicePtrFromStrings(env)
+	if err != nil {
+		fail(err)
+	}
+	if err := applyLimits(os.Getpid(), l); err != nil {
+		fail(err)
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_EXECVE, uintptr(unsafe.Pointer(argv0)), uintptr(unsafe.Pointer(&argv[0])), uintptr(unsafe.Pointer(&envv[0])))
+	fail(fmt.Errorf("cannot execute %s: %v", os.Args[1], errno))
+}
+
+// startLimited starts the command with the given limits in place from its
+// first instruction. Since Go cannot run code between fork and exec, the
+// current binary is executed as a helper which applies the limits and then
+// executes the command.
+func startLimited(cmd *exec.Cmd, l limits) error {
+	if l.CPUTime == 0 && l.MaxMemory == 0 && l.Cgroup == "" {
+		return cmd.Start()
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("cannot find the helper applying the limits: %v", err)
+	}
+	encoded, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env, limitsEnv+"="+string(encoded))
+	cmd.Args = append([]string{self, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = self
+	cmd.ExtraFiles = []*os.File{w}
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return err
+	}
+	// the status pipe is closed once the command is executed
+	msg, _ := ioutil.ReadAll(r)
+	if len(msg) > 0 {
+		_ = cmd.Wait()
+		return fmt.Errorf("cannot apply resource limits: %s", msg)
+	}
+	return nil
+}
+
+// virtualMemoryPeak returns the peak size in bytes of the address space of a
+// process.
+func virtualMemoryPeak(pid int) (uint64, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if fields := strings.Fields(s.Text()); len(fields) == 3 && fields[0] == "VmPeak:" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			return kb * 1024, err
+		}
+	}
+	return 0, fmt.Errorf("no VmPeak in the status of process %d", pid)
+}
+
+// watchMemory samples the peak size of the address space of a process until
+// the returned function is called, which returns the last sample.
+func watchMemory(pid int) func() uint64 {
+	var (
+		done = make(chan struct{})
+		peak = make(chan uint64, 1)
+	)
+	go func() {
+		var last uint64
+		ticker := time.NewTicker(memorySampleInterval)
+		defer ticker.Stop()
+		for {
+			// the status of an exited process has no VmPeak
+			if p, err := virtualMemoryPeak(pid); err == nil {
+				last = p
+			}
+			select {
+			case <-done:
+				peak <- last
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() uint64 {
+		close(done)
+		return <-peak
+	}
+}
+
+// prlimit sets a resource limit on another process, since syscall.Setrlimit
+// only operates on the calling process.
+func prlimit(pid int, resource int, lim *syscall.Rlimit) error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(resource), uintptr(unsafe.Pointer(lim)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func applyLimits(pid int, l limits) error {
+	if l.Cgroup != "" {
+		procs := filepath.Join(l.Cgroup, "cgroup.procs")
+		if err := ioutil.WriteFile(procs, []byte(strconv.Itoa(pid)), 0644); err != nil {
+			return fmt.Errorf("cannot move process %d to cgroup %s: %v", pid, l.Cgroup, err)
+		}
+	}
+	if l.CPUTime > 0 {
+		// RLIMIT_CPU has a granularity of seconds. The soft limit delivers
+		// SIGXCPU, the hard limit one second later delivers SIGKILL.
+		secs := uint64((l.CPUTime + time.Second - 1) / time.Second)
+		if err := prlimit(pid, syscall.RLIMIT_CPU, &syscall.Rlimit{Cur: secs, Max: secs + 1}); err != nil {
+			return fmt.Errorf("cannot set CPU limit: %v", err)
+		}
+	}
+	if l.MaxMemory > 0 {
+		if err := prlimit(pid, syscall.RLIMIT_AS, &syscall.Rlimit{Cur: l.MaxMemory, Max: l.MaxMemory}); err != nil {
+			return fmt.Errorf("cannot set memory limit: %v", err)
+		}
+	}
+	return nil
+}
+
+func getUsage(ps *os.ProcessState) resourceUsage {
+	usage := resourceUsage{
+		UserTime:   ps.UserTime(),
+		SystemTime: ps.SystemTime(),
+	}
+	if ru, ok := ps.SysUsage().(*syscall.Rusage); ok {
+		// on Linux ru_maxrss is expressed in kilobytes.
+		usage.MaxRSS = uint64(ru.Maxrss) * 1024
+	}
+	if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		usage.Signal = signalName(ws.Signal())
+	}
+	return usage
+}
+
+func signalName(sig syscall.Signal) string {
+	switch sig {
+	case syscall.SIGXCPU:
+		return "SIGXCPU"
+	case syscall.SIGKILL:
+		return "SIGKILL"
+	case syscall.SIGSEGV:
+		return "SIGSEGV"
+	case syscall.SIGABRT:
+		return "SIGABRT"
+	default:
+		return sig.String()
+	}
+}
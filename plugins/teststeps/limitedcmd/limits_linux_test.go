@@ -0,0 +1,84 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package limitedcmd
+
+import (
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// raceEnabled is set when the race detector is, whose memory grows in steps
+// too large for the samples of the address space size to come near a limit.
+var raceEnabled bool
+
+func init() {
+	// spin uses CPU time until it is killed
+	programs["spin"] = func([]string) int {
+		for {
+		}
+	}
+	// alloc steadily allocates memory without using it, until allocations
+	// fail
+	programs["alloc"] = func([]string) int {
+		var chunks [][]byte
+		for {
+			chunks = append(chunks, make([]byte, 16<<20))
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	// aslimit fails unless its address space limit is the given one from
+	// its start
+	programs["aslimit"] = func(args []string) int {
+		var lim syscall.Rlimit
+		if err := syscall.Getrlimit(syscall.RLIMIT_AS, &lim); err != nil {
+			return 2
+		}
+		if strconv.FormatUint(lim.Cur, 10) != args[0] {
+			return 1
+		}
+		return 0
+	}
+}
+
+func TestLimitedCmdCPUTime(t *testing.T) {
+	ev, err := run(t, []string{"spin"}, map[string]string{"cpu_time": "1s", "timeout": "30s"})
+	require.Error(t, err)
+	violation := ev.violation(t)
+	require.NotNil(t, violation)
+	require.Equal(t, violationCPU, violation.Violation)
+}
+
+func TestLimitedCmdMemory(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the address space of the command grows in large steps with the race detector")
+	}
+	// Go binaries reserve about 1GB of address space at startup
+	ev, err := run(t, []string{"alloc"}, map[string]string{"max_memory": strconv.Itoa(2 << 30), "timeout": "30s"})
+	require.Error(t, err)
+	violation := ev.violation(t)
+	require.NotNil(t, violation)
+	require.Equal(t, violationMemory, violation.Violation)
+	require.Empty(t, violation.Usage.Signal)
+	require.Less(t, violation.Usage.MaxRSS, uint64(2<<30))
+}
+
+func TestLimitedCmdLimitsBeforeExec(t *testing.T) {
+	maxMemory := strconv.Itoa(3 << 30)
+	ev, err := run(t, []string{"aslimit", maxMemory}, map[string]string{"max_memory": maxMemory})
+	require.NoError(t, err)
+	require.Nil(t, ev.violation(t))
+}
+
+func TestLimitedCmdInvalidCgroup(t *testing.T) {
+	_, err := run(t, []string{"exit", "0"}, map[string]string{"cgroup": filepath.Join(t.TempDir(), "missing")})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cannot apply resource limits")
+}
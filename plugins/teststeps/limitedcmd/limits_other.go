@@ -0,0 +1,33 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+//go:build !linux
+// +build !linux
+
+package limitedcmd
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func startLimited(cmd *exec.Cmd, l limits) error {
+	if l.CPUTime > 0 || l.MaxMemory > 0 || l.Cgroup != "" {
+		return errors.New("only the 'timeout' limit is supported on this platform")
+	}
+	return cmd.Start()
+}
+
+func watchMemory(pid int) func() uint64 {
+	return func() uint64 { return 0 }
+}
+
+func getUsage(ps *os.ProcessState) resourceUsage {
+	return resourceUsage{
+		UserTime:   ps.UserTime(),
+		SystemTime: ps.SystemTime(),
+	}
+}
@@ -0,0 +1,13 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+//go:build race
+// +build race
+
+package limitedcmd
+
+func init() {
+	raceEnabled = true
+}
@@ -0,0 +1,220 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+// Package parallel implements a test step that runs several sequences of
+// child test steps (branches) concurrently on each target, e.g. to stress CPU
+// and disk at the same time. A target succeeds only if every branch succeeds.
+//
+// The step is configured with one "branches" parameter per branch, each being
+// a JSON list of test step descriptors:
+//
+//	"branches": [
+//	    [{"name": "Cmd", "label": "cpu", "parameters": {...}}],
+//	    [{"name": "Cmd", "label": "disk", "parameters": {...}}]
+//	]
+//
+// Child steps emit their events through the emitter of the Parallel step.
+package parallel
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/facebookincubator/contest/pkg/cerrors"
+	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/pluginregistry"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+)
+
+// Name is the name used to look this plugin up.
+var Name = "Parallel"
+
+var log = logging.GetLogger("teststeps/" + strings.ToLower(Name))
+
+// EventParallelBranchEnd is emitted for each target when a branch completes.
+const EventParallelBranchEnd = event.Name("ParallelBranchEnd")
+
+// Events defines the events that a TestStep is allow to emit
+var Events = []event.Name{EventParallelBranchEnd}
+
+// registry is used to instantiate the child steps.
+var registry *pluginregistry.PluginRegistry
+
+// SetPluginRegistry sets the plugin registry used to look up the child steps.
+// It must be called before any Parallel step is validated or run.
+func SetPluginRegistry(pr *pluginregistry.PluginRegistry) {
+	registry = pr
+}
+
+type eventBranchEndPayload struct {
+	Branch int
+	Error  string `json:",omitempty"`
+}
+
+// Parallel runs branches of child steps concurrently on each target.
+type Parallel struct {
+	branches [][]test.TestStepDescriptor
+}
+
+// Name returns the plugin name.
+func (ts Parallel) Name() string {
+	return Name
+}
+
+// runChild runs a single child step on a single target.
+func runChild(ctx context.Context, desc test.TestStepDescriptor, tgt *target.Target, ev testevent.Emitter) error {
+	step, err := registry.NewTestStep(desc.Name)
+	if err != nil {
+		return err
+	}
+	in := make(chan *target.Target, 1)
+	out := make(chan *target.Target, 1)
+	errCh := make(chan cerrors.TargetError, 1)
+	in <- tgt
+	close(in)
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- step.Run(ctx, test.TestStepChannels{In: in, Out: out, Err: errCh}, desc.Parameters, ev)
+	}()
+	// the step returns only after it is done with its only target, so the
+	// outcome is available once Run returns.
+	if err := <-runErr; err != nil {
+		return fmt.Errorf("step %s failed: %v", desc.Label, err)
+	}
+	select {
+	case <-out:
+		return nil
+	case te := <-errCh:
+		return fmt.Errorf("step %s failed: %v", desc.Label, te.Err)
+	default:
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("step %s did not return target %s", desc.Label, tgt)
+	}
+}
+
+func (ts *Parallel) runTarget(ctx context.Context, tgt *target.Target, ev testevent.Emitter) error {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(ts.branches))
+	)
+	for idx, branch := range ts.branches {
+		wg.Add(1)
+		go func(idx int, branch []test.TestStepDescriptor) {
+			defer wg.Done()
+			for _, desc := range branch {
+				if err := runChild(ctx, desc, tgt, ev); err != nil {
+					errs[idx] = err
+					break
+				}
+			}
+			payload := eventBranchEndPayload{Branch: idx}
+			if errs[idx] != nil {
+				payload.Error = errs[idx].Error()
+			}
+			data, err := json.Marshal(payload)
+			if err != nil {
+				log.Warningf("Cannot encode payload for %s: %v", EventParallelBranchEnd, err)
+				return
+			}
+			rm := json.RawMessage(data)
+			if err := ev.Emit(testevent.Data{EventName: EventParallelBranchEnd, Target: tgt, Payload: &rm}); err != nil {
+				log.Warningf("Cannot emit event %s: %v", EventParallelBranchEnd, err)
+			}
+		}(idx, branch)
+	}
+	wg.Wait()
+
+	var failed []string
+	for idx, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("branch %d: %v", idx, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d/%d branches failed: %s", len(failed), len(ts.branches), strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Run executes the step.
+func (ts *Parallel) Run(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
+	if err := ts.validateAndPopulate(params); err != nil {
+		return err
+	}
+	f := func(ctx context.Context, tgt *target.Target) error {
+		return ts.runTarget(ctx, tgt, ev)
+	}
+	return test.ForEachTarget(ctx, Name, ch, f)
+}
+
+func (ts *Parallel) validateAndPopulate(params test.TestStepParameters) error {
+	if registry == nil {
+		return errors.New("no plugin registry set for the Parallel step")
+	}
+	branches := params.Get("branches")
+	if len(branches) == 0 {
+		return errors.New("missing 'branches' parameter")
+	}
+	ts.branches = make([][]test.TestStepDescriptor, 0, len(branches))
+	for idx, b := range branches {
+		var descs []test.TestStepDescriptor
+		if err := json.Unmarshal(b.JSON(), &descs); err != nil {
+			return fmt.Errorf("invalid branch %d, must be a list of test step descriptors: %v", idx, err)
+		}
+		if len(descs) == 0 {
+			return fmt.Errorf("branch %d is empty", idx)
+		}
+		for _, desc := range descs {
+			if desc.Label == "" {
+				return fmt.Errorf("missing label for step %s in branch %d", desc.Name, idx)
+			}
+			step, err := registry.NewTestStep(desc.Name)
+			if err != nil {
+				return fmt.Errorf("invalid step %s in branch %d: %v", desc.Label, idx, err)
+			}
+			if err := step.ValidateParameters(desc.Parameters); err != nil {
+				return fmt.Errorf("invalid parameters for step %s in branch %d: %v", desc.Label, idx, err)
+			}
+		}
+		ts.branches = append(ts.branches, descs)
+	}
+	return nil
+}
+
+// ValidateParameters validates the parameters associated to the TestStep
+func (ts *Parallel) ValidateParameters(params test.TestStepParameters) error {
+	return ts.validateAndPopulate(params)
+}
+
+// Resume tries to resume a previously interrupted test step. Parallel cannot
+// resume.
+func (ts *Parallel) Resume(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.EmitterFetcher) error {
+	return &cerrors.ErrResumeNotSupported{StepName: Name}
+}
+
+// CanResume tells whether this step is able to resume.
+func (ts *Parallel) CanResume() bool {
+	return false
+}
+
+// New initializes and returns a new Parallel test step.
+func New() test.TestStep {
+	return &Parallel{}
+}
+
+// Load returns the name, factory and events which are needed to register the step.
+func Load() (string, test.TestStepFactory, []event.Name) {
+	return Name, New, Events
+}
@@ -0,0 +1,84 @@
+// Copyright (c) Facebook, Inc. and its affiliates.
+//
+// This source code is licensed under the MIT license found in the
+// LICENSE file in the root directory of this source tree.
+
+package parallel
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/facebookincubator/contest/pkg/event/testevent"
+	"github.com/facebookincubator/contest/pkg/pluginregistry"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/test"
+	"github.com/facebookincubator/contest/plugins/teststeps/echo"
+	"github.com/facebookincubator/contest/tests/plugins/teststeps/fail"
+	"github.com/stretchr/testify/require"
+)
+
+type memEmitter struct {
+	mu     sync.Mutex
+	events []testevent.Data
+}
+
+func (e *memEmitter) Emit(data testevent.Data) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, data)
+	return nil
+}
+
+func setup(t *testing.T) {
+	pr := pluginregistry.NewPluginRegistry()
+	require.NoError(t, pr.RegisterTestStep(echo.Load()))
+	require.NoError(t, pr.RegisterTestStep(fail.Name, fail.New, fail.Events))
+	SetPluginRegistry(pr)
+}
+
+func branchesParams(branches ...string) test.TestStepParameters {
+	var params []test.Param
+	for _, b := range branches {
+		params = append(params, *test.NewParam(b))
+	}
+	return test.TestStepParameters{"branches": params}
+}
+
+const (
+	echoBranch = `[{"name": "Echo", "label": "echo1", "parameters": {"text": ["hello"]}}, {"name": "Echo", "label": "echo2", "parameters": {"text": ["world"]}}]`
+	failBranch = `[{"name": "Fail", "label": "fail"}]`
+)
+
+func TestParallelAllBranchesSucceed(t *testing.T) {
+	setup(t)
+	ts := New().(*Parallel)
+	require.NoError(t, ts.ValidateParameters(branchesParams(echoBranch, echoBranch)))
+
+	ev := &memEmitter{}
+	err := ts.runTarget(context.Background(), &target.Target{Name: "host001"}, ev)
+	require.NoError(t, err)
+	require.Len(t, ev.events, 2)
+}
+
+func TestParallelOneBranchFails(t *testing.T) {
+	setup(t)
+	ts := New().(*Parallel)
+	require.NoError(t, ts.ValidateParameters(branchesParams(echoBranch, failBranch)))
+
+	err := ts.runTarget(context.Background(), &target.Target{Name: "host001"}, &memEmitter{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "1/2 branches failed")
+}
+
+func TestParallelValidateParameters(t *testing.T) {
+	setup(t)
+	ts := New()
+	require.Error(t, ts.ValidateParameters(test.TestStepParameters{}))
+	require.Error(t, ts.ValidateParameters(branchesParams(`[]`)))
+	require.Error(t, ts.ValidateParameters(branchesParams(`[{"name": "Echo"}]`)))
+	require.Error(t, ts.ValidateParameters(branchesParams(`[{"name": "Unknown", "label": "x"}]`)))
+	// echo requires a 'text' parameter
+	require.Error(t, ts.ValidateParameters(branchesParams(`[{"name": "Echo", "label": "x"}]`)))
+}
@@ -6,6 +6,7 @@
 package slowecho
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strconv"
@@ -84,7 +85,7 @@ func (e *Step) ValidateParameters(params test.TestStepParameters) error {
 }
 
 // Run executes the step
-func (e *Step) Run(cancel, pause <-chan struct{}, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
+func (e *Step) Run(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
 	sleep, err := sleepTime(params.GetOne("sleep").String())
 	if err != nil {
 		return err
@@ -104,31 +105,20 @@ processing:
 				defer wg.Done()
 				log.Infof("Waiting %v for target %s", sleep, t.Name)
 				select {
-				case <-cancel:
-					log.Infof("Returning because cancellation is requested")
-					return
-				case <-pause:
-					log.Infof("Returning because pause is requested")
+				case <-ctx.Done():
+					log.Infof("Returning because the context is done: %v", ctx.Err())
 					return
 				case <-time.After(sleep):
 				}
 				log.Infof("target %s: %s", t, params.GetOne("text"))
-				select {
-				case <-cancel:
-					log.Debug("Returning because cancellation is requested")
+				if ctx.Err() != nil {
+					log.Debugf("Returning because the context is done: %v", ctx.Err())
 					return
-				case <-pause:
-					log.Debug("Returning because pause is requested")
-					return
-				default:
-					ch.Out <- t
 				}
+				ch.Out <- t
 			}(t)
-		case <-cancel:
-			log.Infof("Requested cancellation")
-			break processing
-		case <-pause:
-			log.Infof("Requested pause")
+		case <-ctx.Done():
+			log.Infof("Requested cancellation or pause: %v", ctx.Err())
 			break processing
 		}
 	}
@@ -145,6 +135,6 @@ func (e Step) CanResume() bool {
 
 // Resume tries to resume a previously interrupted test step. EchoStep cannot
 // resume.
-func (e Step) Resume(cancel, pause <-chan struct{}, _ test.TestStepChannels, _ test.TestStepParameters, ev testevent.EmitterFetcher) error {
+func (e Step) Resume(ctx context.Context, _ test.TestStepChannels, _ test.TestStepParameters, ev testevent.EmitterFetcher) error {
 	return &cerrors.ErrResumeNotSupported{StepName: Name}
 }
@@ -17,6 +17,7 @@ package sshcmd
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -32,7 +33,6 @@ import (
 	"github.com/facebookincubator/contest/pkg/logging"
 	"github.com/facebookincubator/contest/pkg/target"
 	"github.com/facebookincubator/contest/pkg/test"
-	"github.com/facebookincubator/contest/plugins/teststeps"
 	shellquote "github.com/kballard/go-shellquote"
 	"golang.org/x/crypto/ssh"
 )
@@ -67,7 +67,7 @@ func (ts SSHCmd) Name() string {
 }
 
 // Run executes the cmd step.
-func (ts *SSHCmd) Run(cancel, pause <-chan struct{}, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
+func (ts *SSHCmd) Run(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
 	// XXX: Dragons ahead! The target (%t) substitution, and function
 	// expression evaluations are done at run-time, so they may still fail
 	// despite passing at early validation time.
@@ -80,7 +80,7 @@ func (ts *SSHCmd) Run(cancel, pause <-chan struct{}, ch test.TestStepChannels, p
 		return err
 	}
 
-	f := func(cancel, pause <-chan struct{}, target *target.Target) error {
+	f := func(ctx context.Context, target *target.Target) error {
 		// apply filters and substitutions to user, host, private key, and command args
 		user, err := ts.User.Expand(target)
 		if err != nil {
@@ -207,13 +207,11 @@ func (ts *SSHCmd) Run(cancel, pause <-chan struct{}, ch test.TestStepChannels, p
 				log.Warningf("Stderr of command '%s' is '%s'", cmd, stderr.Bytes())
 			}
 			return err
-		case <-cancel:
-			return session.Signal(ssh.SIGKILL)
-		case <-pause:
+		case <-ctx.Done():
 			return session.Signal(ssh.SIGKILL)
 		}
 	}
-	return teststeps.ForEachTarget(Name, cancel, pause, ch, f)
+	return test.ForEachTarget(ctx, Name, ch, f)
 }
 
 func (ts *SSHCmd) validateAndPopulate(params test.TestStepParameters) error {
@@ -264,7 +262,7 @@ func (ts *SSHCmd) ValidateParameters(params test.TestStepParameters) error {
 
 // Resume tries to resume a previously interrupted test step. SSHCmd cannot
 // resume.
-func (ts *SSHCmd) Resume(cancel, pause <-chan struct{}, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.EmitterFetcher) error {
+func (ts *SSHCmd) Resume(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.EmitterFetcher) error {
 	return &cerrors.ErrResumeNotSupported{StepName: Name}
 }
 
@@ -6,6 +6,7 @@
 package terminalexpect
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -18,7 +19,6 @@ import (
 	"github.com/facebookincubator/contest/pkg/logging"
 	"github.com/facebookincubator/contest/pkg/target"
 	"github.com/facebookincubator/contest/pkg/test"
-	"github.com/facebookincubator/contest/plugins/teststeps"
 	"github.com/insomniacslk/termhook"
 )
 
@@ -56,7 +56,7 @@ func match(match string) termhook.LineHandler {
 }
 
 // Run executes the terminal step.
-func (ts *TerminalExpect) Run(cancel, pause <-chan struct{}, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
+func (ts *TerminalExpect) Run(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
 	if err := ts.validateAndPopulate(params); err != nil {
 		return err
 	}
@@ -66,7 +66,7 @@ func (ts *TerminalExpect) Run(cancel, pause <-chan struct{}, ch test.TestStepCha
 	}
 	hook.ReadOnly = true
 	// f implements plugins.PerTargetFunc
-	f := func(cancel, pause <-chan struct{}, target *target.Target) error {
+	f := func(ctx context.Context, target *target.Target) error {
 		errCh := make(chan error)
 		go func() {
 			errCh <- hook.Run()
@@ -76,14 +76,12 @@ func (ts *TerminalExpect) Run(cancel, pause <-chan struct{}, ch test.TestStepCha
 			return err
 		case <-time.After(ts.Timeout):
 			return fmt.Errorf("timed out after %s", ts.Timeout)
-		case <-cancel:
-			return nil
-		case <-pause:
+		case <-ctx.Done():
 			return nil
 		}
 	}
 	log.Printf("%s: waiting for string '%s' with timeout %s", Name, ts.Match, ts.Timeout)
-	return teststeps.ForEachTarget(Name, cancel, pause, ch, f)
+	return test.ForEachTarget(ctx, Name, ch, f)
 }
 
 func (ts *TerminalExpect) validateAndPopulate(params test.TestStepParameters) error {
@@ -122,7 +120,7 @@ func (ts *TerminalExpect) ValidateParameters(params test.TestStepParameters) err
 
 // Resume tries to resume a previously interrupted test step. TerminalExpect cannot
 // resume.
-func (ts *TerminalExpect) Resume(cancel, pause <-chan struct{}, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.EmitterFetcher) error {
+func (ts *TerminalExpect) Resume(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.EmitterFetcher) error {
 	return &cerrors.ErrResumeNotSupported{StepName: Name}
 }
 
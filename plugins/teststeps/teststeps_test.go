@@ -6,6 +6,7 @@
 package teststeps
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -16,6 +17,7 @@ import (
 	"github.com/facebookincubator/contest/pkg/logging"
 	"github.com/facebookincubator/contest/pkg/target"
 	"github.com/facebookincubator/contest/pkg/test"
+	"github.com/facebookincubator/contest/pkg/xcontext"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -23,6 +25,8 @@ import (
 type data struct {
 	done          chan struct{}
 	cancel, pause chan struct{}
+	ctx           context.Context
+	stop          context.CancelFunc
 	inCh, outCh   chan *target.Target
 	errCh         chan cerrors.TargetError
 	stepChans     test.TestStepChannels
@@ -32,10 +36,15 @@ func newData() data {
 	inCh := make(chan *target.Target)
 	outCh := make(chan *target.Target)
 	errCh := make(chan cerrors.TargetError)
+	cancel := make(chan struct{})
+	pause := make(chan struct{})
+	ctx, stop := xcontext.New(context.Background(), cancel, pause)
 	return data{
 		done:   make(chan struct{}, 1),
-		cancel: make(chan struct{}),
-		pause:  make(chan struct{}),
+		cancel: cancel,
+		pause:  pause,
+		ctx:    ctx,
+		stop:   stop,
 		inCh:   inCh,
 		outCh:  outCh,
 		errCh:  errCh,
@@ -49,7 +58,7 @@ func newData() data {
 
 func TestForEachTargetOneTarget(t *testing.T) {
 	d := newData()
-	fn := func(cancel, pause <-chan struct{}, tgt *target.Target) error {
+	fn := func(ctx context.Context, tgt *target.Target) error {
 		log.Printf("Handling target %+v", tgt)
 		return nil
 	}
@@ -70,14 +79,14 @@ func TestForEachTargetOneTarget(t *testing.T) {
 			}
 		}
 	}()
-	err := ForEachTarget("test_one_target ", d.cancel, d.pause, d.stepChans, fn)
+	err := ForEachTarget(d.ctx, "test_one_target ", d.stepChans, fn)
 	d.done <- struct{}{}
 	require.NoError(t, err)
 }
 
 func TestForEachTargetOneTargetAllFail(t *testing.T) {
 	d := newData()
-	fn := func(cancel, pause <-chan struct{}, t *target.Target) error {
+	fn := func(ctx context.Context, t *target.Target) error {
 		log.Printf("Handling target %+v", t)
 		return fmt.Errorf("error with target %+v", t)
 	}
@@ -98,14 +107,14 @@ func TestForEachTargetOneTargetAllFail(t *testing.T) {
 			}
 		}
 	}()
-	err := ForEachTarget("test_one_target ", d.cancel, d.pause, d.stepChans, fn)
+	err := ForEachTarget(d.ctx, "test_one_target ", d.stepChans, fn)
 	d.done <- struct{}{}
 	require.NoError(t, err)
 }
 
 func TestForEachTargetTenTargets(t *testing.T) {
 	d := newData()
-	fn := func(cancel, pause <-chan struct{}, tgt *target.Target) error {
+	fn := func(ctx context.Context, tgt *target.Target) error {
 		log.Printf("Handling target %+v", tgt)
 		return nil
 	}
@@ -128,7 +137,7 @@ func TestForEachTargetTenTargets(t *testing.T) {
 			}
 		}
 	}()
-	err := ForEachTarget("test_one_target ", d.cancel, d.pause, d.stepChans, fn)
+	err := ForEachTarget(d.ctx, "test_one_target ", d.stepChans, fn)
 	d.done <- struct{}{}
 	require.NoError(t, err)
 }
@@ -136,7 +145,7 @@ func TestForEachTargetTenTargets(t *testing.T) {
 func TestForEachTargetTenTargetsAllFail(t *testing.T) {
 	logging.Debug()
 	d := newData()
-	fn := func(cancel, pause <-chan struct{}, tgt *target.Target) error {
+	fn := func(ctx context.Context, tgt *target.Target) error {
 		log.Printf("Handling target %+v", tgt)
 		return fmt.Errorf("error with target %+v", tgt)
 	}
@@ -159,7 +168,7 @@ func TestForEachTargetTenTargetsAllFail(t *testing.T) {
 			}
 		}
 	}()
-	err := ForEachTarget("test_one_target ", d.cancel, d.pause, d.stepChans, fn)
+	err := ForEachTarget(d.ctx, "test_one_target ", d.stepChans, fn)
 	d.done <- struct{}{}
 	require.NoError(t, err)
 }
@@ -169,7 +178,7 @@ func TestForEachTargetTenTargetsOneFails(t *testing.T) {
 	// chosen by fair dice roll.
 	// guaranteed to be random.
 	failingTarget := "target004"
-	fn := func(cancel, pause <-chan struct{}, tgt *target.Target) error {
+	fn := func(ctx context.Context, tgt *target.Target) error {
 		log.Printf("Handling target %+v", tgt)
 		if tgt.Name == failingTarget {
 			return fmt.Errorf("error with target %+v", tgt)
@@ -203,7 +212,7 @@ func TestForEachTargetTenTargetsOneFails(t *testing.T) {
 			}
 		}
 	}()
-	err := ForEachTarget("test_one_target ", d.cancel, d.pause, d.stepChans, fn)
+	err := ForEachTarget(d.ctx, "test_one_target ", d.stepChans, fn)
 	d.done <- struct{}{}
 	require.NoError(t, err)
 }
@@ -217,13 +226,11 @@ func TestForEachTargetTenTargetsParallelism(t *testing.T) {
 	logging.Debug()
 	sleepTime := time.Second
 	d := newData()
-	fn := func(cancel, pause <-chan struct{}, tgt *target.Target) error {
+	fn := func(ctx context.Context, tgt *target.Target) error {
 		log.Printf("Handling target %+v", tgt)
 		select {
-		case <-cancel:
-			log.Printf("target %+v caneled", tgt)
-		case <-pause:
-			log.Printf("target %+v paused", tgt)
+		case <-ctx.Done():
+			log.Printf("target %+v stopped: %v", tgt, ctx.Err())
 		case <-time.After(sleepTime):
 			log.Printf("target %+v processed", tgt)
 		}
@@ -275,7 +282,7 @@ func TestForEachTargetTenTargetsParallelism(t *testing.T) {
 		}
 	}()
 
-	err := ForEachTarget("test_parallel", d.cancel, d.pause, d.stepChans, fn)
+	err := ForEachTarget(d.ctx, "test_parallel", d.stepChans, fn)
 
 	wg.Wait() //wait for receiver
 
@@ -294,14 +301,16 @@ func TestForEachTargetCancelSignalPropagation(t *testing.T) {
 	var canceledTargets int32
 	d := newData()
 
-	fn := func(cancel, pause <-chan struct{}, tgt *target.Target) error {
+	fn := func(ctx context.Context, tgt *target.Target) error {
 		log.Printf("Handling target %+v", tgt)
 		select {
-		case <-cancel:
+		case <-ctx.Done():
+			if xcontext.IsPaused(ctx) {
+				log.Printf("target %+v paused", tgt)
+				break
+			}
 			log.Printf("target %+v caneled", tgt)
 			atomic.AddInt32(&canceledTargets, 1)
-		case <-pause:
-			log.Printf("target %+v paused", tgt)
 		case <-time.After(sleepTime):
 			log.Printf("target %+v processed", tgt)
 		}
@@ -320,7 +329,7 @@ func TestForEachTargetCancelSignalPropagation(t *testing.T) {
 		close(d.cancel)
 	}()
 
-	err := ForEachTarget("test_cancelation", d.cancel, d.pause, d.stepChans, fn)
+	err := ForEachTarget(d.ctx, "test_cancelation", d.stepChans, fn)
 	require.NoError(t, err)
 
 	assert.Equal(t, int32(numTargets), canceledTargets)
@@ -333,14 +342,16 @@ func TestForEachTargetCancelBeforeInputChannelClosed(t *testing.T) {
 	var canceledTargets int32
 	d := newData()
 
-	fn := func(cancel, pause <-chan struct{}, tgt *target.Target) error {
+	fn := func(ctx context.Context, tgt *target.Target) error {
 		log.Printf("Handling target %+v", tgt)
 		select {
-		case <-cancel:
+		case <-ctx.Done():
+			if xcontext.IsPaused(ctx) {
+				log.Printf("target %+v paused", tgt)
+				break
+			}
 			log.Printf("target %+v cancelled", tgt)
 			atomic.AddInt32(&canceledTargets, 1)
-		case <-pause:
-			log.Printf("target %+v paused", tgt)
 		case <-time.After(sleepTime):
 			log.Printf("target %+v processed", tgt)
 		}
@@ -361,7 +372,7 @@ func TestForEachTargetCancelBeforeInputChannelClosed(t *testing.T) {
 		close(d.cancel)
 	}()
 
-	err := ForEachTarget("test_cancelation", d.cancel, d.pause, d.stepChans, fn)
+	err := ForEachTarget(d.ctx, "test_cancelation", d.stepChans, fn)
 	require.NoError(t, err)
 
 	wg.Done()
@@ -34,7 +34,7 @@ func populateFrameworkEvents(backend storage.Storage, emitTime time.Time) error
 	data := []byte("{ 'test_key': 'test_value' }")
 	payload := (*json.RawMessage)(&data)
 
-	eventFirst := frameworkevent.Event{JobID: 1, EventName: "AFrameworkEvent", Payload: payload, EmitTime: emitTime}
+	eventFirst := frameworkevent.Event{JobID: 1, EventName: "AFrameworkEvent", Payload: payload, EmitTime: emitTime, RequestID: "request-id"}
 	eventSecond := frameworkevent.Event{JobID: 1, EventName: "BFrameworkEvent", Payload: payload, EmitTime: emitTime}
 
 	err := backend.StoreFrameworkEvent(eventFirst)
@@ -52,6 +52,7 @@ func assertFrameworkEvents(t *testing.T, ev []frameworkevent.Event, emitTime tim
 	assert.Equal(t, event.Name("AFrameworkEvent"), ev[0].EventName)
 	assert.Equal(t, payload, ev[0].Payload)
 	assert.Equal(t, emitTime.UTC(), ev[0].EmitTime.UTC())
+	assert.Equal(t, "request-id", ev[0].RequestID)
 
 	if len(ev) == 2 {
 		assert.Equal(t, types.JobID(1), ev[1].JobID)
@@ -75,6 +75,7 @@ func (suite *JobSuite) TestGetJobRequest() {
 		RequestTime:     time.Now(),
 		JobDescriptor:   jobDescriptorFirst,
 		TestDescriptors: testDescs,
+		Tags:            []string{"integ", "tests"},
 	}
 	jobIDa, err := suite.txStorage.StoreJobRequest(&jobRequestFirst)
 	require.NoError(suite.T(), err)
@@ -94,6 +95,7 @@ func (suite *JobSuite) TestGetJobRequest() {
 	require.Equal(suite.T(), types.JobID(jobIDa), request.JobID)
 	require.Equal(suite.T(), request.Requestor, "AIntegrationTest")
 	require.Equal(suite.T(), request.JobDescriptor, jobDescriptorFirst)
+	require.Equal(suite.T(), []string{"integ", "tests"}, request.Tags)
 
 	// Creation timestamp corresponds to the timestamp of the insertion into the
 	// database. Assert that the timestamp retrieved from the database is within
@@ -110,6 +112,7 @@ func (suite *JobSuite) TestGetJobRequest() {
 	require.Equal(suite.T(), types.JobID(jobIDb), request.JobID)
 	require.Equal(suite.T(), request.Requestor, "BIntegrationTest")
 	require.Equal(suite.T(), request.JobDescriptor, jobDescriptorSecond)
+	require.Empty(suite.T(), request.Tags)
 
 	require.True(suite.T(), request.RequestTime.After(time.Now().Add(-2*time.Second)))
 	require.True(suite.T(), request.RequestTime.Before(time.Now().Add(2*time.Second)))
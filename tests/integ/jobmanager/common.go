@@ -8,9 +8,18 @@
 package test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -22,9 +31,13 @@ import (
 	"github.com/facebookincubator/contest/pkg/jobmanager"
 
 	"github.com/facebookincubator/contest/pkg/logging"
+	"github.com/facebookincubator/contest/pkg/metrics"
 	"github.com/facebookincubator/contest/pkg/pluginregistry"
 	"github.com/facebookincubator/contest/pkg/storage"
+	"github.com/facebookincubator/contest/pkg/target"
+	"github.com/facebookincubator/contest/pkg/tracing"
 	"github.com/facebookincubator/contest/pkg/types"
+	"github.com/facebookincubator/contest/pkg/webhook"
 	"github.com/facebookincubator/contest/plugins/reporters/targetsuccess"
 	"github.com/facebookincubator/contest/plugins/targetmanagers/targetlist"
 	"github.com/facebookincubator/contest/plugins/testfetchers/literal"
@@ -45,14 +58,58 @@ import (
 type CommandType string
 
 var (
-	StartJob CommandType = "start"
-	StopJob  CommandType = "stop"
+	StartJob   CommandType = "start"
+	StopJob    CommandType = "stop"
+	PauseJob   CommandType = "pause"
+	ResumeJob  CommandType = "resume"
+	RerunJob   CommandType = "rerun"
+	ApproveJob CommandType = "approve"
+	RejectJob  CommandType = "reject"
+	ListJobs   CommandType = "list"
+	Reports    CommandType = "reports"
+	History    CommandType = "history"
+	StartBatch CommandType = "batch"
+	Validate   CommandType = "validate"
+	Drain      CommandType = "drain"
+	Quotas     CommandType = "quotas"
+	SetQuota   CommandType = "setQuota"
+
+	LogLevels   CommandType = "logLevels"
+	SetLogLevel CommandType = "setLogLevel"
+	AuditLog    CommandType = "auditLog"
+	Readiness   CommandType = "readiness"
+
+	UnlockTargets CommandType = "unlockTargets"
+
+	CreateSchedule CommandType = "schedule"
+	PauseSchedule  CommandType = "pauseSchedule"
+
+	SaveTemplate  CommandType = "saveTemplate"
+	StartTemplate CommandType = "startTemplate"
 )
 
 type command struct {
 	commandType   CommandType
 	jobID         types.JobID
 	jobDescriptor string
+	search        api.JobSearch
+	historySearch api.HistorySearch
+	auditSearch   api.AuditSearch
+	batch         []string
+	atomic        bool
+	failedOnly    bool
+	reason        string
+	deadline      time.Duration
+	cron          string
+	scheduleID    types.ScheduleID
+	template      string
+	values        map[string]string
+	requestor     api.EventRequestor
+	quota         *api.Quota
+	module        string
+	level         string
+	requestID     string
+	targetIDs     []string
 }
 
 // TestListener implements a dummy api.Listener interface for testing purposes
@@ -75,6 +132,7 @@ func (tl *TestListener) Serve(cancel <-chan struct{}, contestApi *api.API) error
 	for {
 		select {
 		case command := <-tl.commandCh:
+			contestApi := contestApi.ForRequest(command.requestID)
 			if command.commandType == StartJob {
 				resp, err := contestApi.Start("IntegrationTest", command.jobDescriptor)
 				if err != nil {
@@ -87,6 +145,138 @@ func (tl *TestListener) Serve(cancel <-chan struct{}, contestApi *api.API) error
 					tl.errorCh <- err
 				}
 				tl.responseCh <- resp
+			} else if command.commandType == PauseJob {
+				resp, err := contestApi.PauseJob("IntegrationTest", command.jobID)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == ResumeJob {
+				resp, err := contestApi.ResumeJob("IntegrationTest", command.jobID)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == RerunJob {
+				resp, err := contestApi.Rerun("IntegrationTest", command.jobID, command.failedOnly)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == ApproveJob {
+				resp, err := contestApi.ApproveJob("IntegrationTest", command.jobID, command.reason)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == RejectJob {
+				resp, err := contestApi.RejectJob("IntegrationTest", command.jobID, command.reason)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == StartBatch {
+				resp, err := contestApi.StartBatch("IntegrationTest", command.batch, command.atomic)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == Validate {
+				resp, err := contestApi.Validate("IntegrationTest", command.jobDescriptor)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == Drain {
+				resp, err := contestApi.Drain("IntegrationTest", command.deadline)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == UnlockTargets {
+				resp, err := contestApi.UnlockTargets("IntegrationTest", command.targetIDs)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == Quotas {
+				resp, err := contestApi.Quotas("IntegrationTest")
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == SetQuota {
+				resp, err := contestApi.SetQuota("IntegrationTest", command.requestor, command.quota)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == LogLevels {
+				resp, err := contestApi.LogLevels("IntegrationTest")
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == SetLogLevel {
+				resp, err := contestApi.SetLogLevel("IntegrationTest", command.module, command.level)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == AuditLog {
+				resp, err := contestApi.AuditLog("IntegrationTest", command.auditSearch)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == Readiness {
+				resp, err := contestApi.Readiness("IntegrationTest")
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == CreateSchedule {
+				resp, err := contestApi.CreateSchedule("IntegrationTest", "", command.cron, command.jobDescriptor)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == PauseSchedule {
+				resp, err := contestApi.PauseSchedule("IntegrationTest", command.scheduleID)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == SaveTemplate {
+				resp, err := contestApi.SaveTemplate("IntegrationTest", command.template)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == StartTemplate {
+				resp, err := contestApi.StartTemplate("IntegrationTest", command.template, command.values)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == ListJobs {
+				resp, err := contestApi.ListJobs("IntegrationTest", command.search)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == Reports {
+				resp, err := contestApi.Reports("IntegrationTest", command.search)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
+			} else if command.commandType == History {
+				resp, err := contestApi.History("IntegrationTest", command.historySearch)
+				if err != nil {
+					tl.errorCh <- err
+				}
+				tl.responseCh <- resp
 			} else {
 				panic(fmt.Sprintf("Command %v not supported", command))
 			}
@@ -134,7 +324,9 @@ type TestJobManagerSuite struct {
 	// what the backend supports
 	txStorage storage.Storage
 
-	jm *jobmanager.JobManager
+	jm             *jobmanager.JobManager
+	testListener   *TestListener
+	pluginRegistry *pluginregistry.PluginRegistry
 
 	jobStorageManager storage.JobStorageManager
 	eventManager      frameworkevent.EmitterFetcher
@@ -183,159 +375,1712 @@ func (suite *TestJobManagerSuite) stopJob(jobID types.JobID) error {
 	return nil
 }
 
-func (suite *TestJobManagerSuite) SetupTest() {
+func (suite *TestJobManagerSuite) pauseJobCommand(cmd command) (api.ResponseDataPauseJob, error) {
+	var resp api.Response
+	suite.commandCh <- cmd
+	select {
+	case resp = <-suite.responseCh:
+		if resp.Err != nil {
+			return api.ResponseDataPauseJob{}, resp.Err
+		}
+	case <-time.After(2 * time.Second):
+		return api.ResponseDataPauseJob{}, fmt.Errorf("Listener response should come within the timeout")
+	}
+	return resp.Data.(api.ResponseDataPauseJob), nil
+}
 
-	jobStorageManager := storage.NewJobStorageManager()
-	eventManager := storage.NewFrameworkEventEmitterFetcher()
+func (suite *TestJobManagerSuite) pauseJob(jobID types.JobID) (api.ResponseDataPauseJob, error) {
+	return suite.pauseJobCommand(command{commandType: PauseJob, jobID: jobID})
+}
 
-	suite.jobStorageManager = jobStorageManager
-	suite.eventManager = eventManager
+func (suite *TestJobManagerSuite) resumeJob(jobID types.JobID) (api.ResponseDataPauseJob, error) {
+	return suite.pauseJobCommand(command{commandType: ResumeJob, jobID: jobID})
+}
 
-	commandCh := make(chan command)
-	suite.commandCh = commandCh
-	responseCh := make(chan api.Response)
-	suite.responseCh = responseCh
-	errorCh := make(chan error)
-	suite.errorCh = errorCh
-	jobManagerCh := make(chan struct{})
-	suite.jobManagerCh = jobManagerCh
+func (suite *TestJobManagerSuite) rerunJob(jobID types.JobID, failedTargetsOnly bool) (types.JobID, error) {
+	var resp api.Response
+	suite.commandCh <- command{commandType: RerunJob, jobID: jobID, failedOnly: failedTargetsOnly}
+	select {
+	case resp = <-suite.responseCh:
+		if resp.Err != nil {
+			return types.JobID(0), resp.Err
+		}
+	case <-time.After(2 * time.Second):
+		return types.JobID(0), fmt.Errorf("Listener response should come within the timeout")
+	}
+	return resp.Data.(api.ResponseDataRetry).NewJobID, nil
+}
+
+func (suite *TestJobManagerSuite) approveJobCommand(cmd command) (api.ResponseDataApproveJob, error) {
+	var resp api.Response
+	suite.commandCh <- cmd
+	select {
+	case resp = <-suite.responseCh:
+		if resp.Err != nil {
+			return api.ResponseDataApproveJob{}, resp.Err
+		}
+	case <-time.After(2 * time.Second):
+		return api.ResponseDataApproveJob{}, fmt.Errorf("Listener response should come within the timeout")
+	}
+	return resp.Data.(api.ResponseDataApproveJob), nil
+}
+
+func (suite *TestJobManagerSuite) approveJob(jobID types.JobID) (api.ResponseDataApproveJob, error) {
+	return suite.approveJobCommand(command{commandType: ApproveJob, jobID: jobID})
+}
+
+func (suite *TestJobManagerSuite) rejectJob(jobID types.JobID, reason string) (api.ResponseDataApproveJob, error) {
+	return suite.approveJobCommand(command{commandType: RejectJob, jobID: jobID, reason: reason})
+}
+
+func (suite *TestJobManagerSuite) startBatch(jobDescriptors []string, atomic bool) (api.Response, error) {
+	suite.commandCh <- command{commandType: StartBatch, batch: jobDescriptors, atomic: atomic}
+	select {
+	case resp := <-suite.responseCh:
+		return resp, nil
+	case <-time.After(2 * time.Second):
+		return api.Response{}, fmt.Errorf("Listener response should come within the timeout")
+	}
+}
+
+func (suite *TestJobManagerSuite) validate(jobDescriptor string) (api.ResponseDataValidate, error) {
+	var resp api.Response
+	suite.commandCh <- command{commandType: Validate, jobDescriptor: jobDescriptor}
+	select {
+	case resp = <-suite.responseCh:
+		if resp.Err != nil {
+			return api.ResponseDataValidate{}, resp.Err
+		}
+	case <-time.After(2 * time.Second):
+		return api.ResponseDataValidate{}, fmt.Errorf("Listener response should come within the timeout")
+	}
+	return resp.Data.(api.ResponseDataValidate), nil
+}
+
+func (suite *TestJobManagerSuite) drain(deadline time.Duration) (api.ResponseDataDrain, error) {
+	var resp api.Response
+	suite.commandCh <- command{commandType: Drain, deadline: deadline}
+	select {
+	case resp = <-suite.responseCh:
+		if resp.Err != nil {
+			return api.ResponseDataDrain{}, resp.Err
+		}
+	case <-time.After(2 * time.Second):
+		return api.ResponseDataDrain{}, fmt.Errorf("Listener response should come within the timeout")
+	}
+	return resp.Data.(api.ResponseDataDrain), nil
+}
+
+func (suite *TestJobManagerSuite) unlockTargets(targetIDs []string) (api.ResponseDataUnlockTargets, error) {
+	var resp api.Response
+	suite.commandCh <- command{commandType: UnlockTargets, targetIDs: targetIDs}
+	select {
+	case resp = <-suite.responseCh:
+		if resp.Err != nil {
+			return api.ResponseDataUnlockTargets{}, resp.Err
+		}
+	case <-time.After(2 * time.Second):
+		return api.ResponseDataUnlockTargets{}, fmt.Errorf("Listener response should come within the timeout")
+	}
+	return resp.Data.(api.ResponseDataUnlockTargets), nil
+}
+
+func (suite *TestJobManagerSuite) quotaCommand(cmd command) (api.ResponseDataQuotas, error) {
+	var resp api.Response
+	suite.commandCh <- cmd
+	select {
+	case resp = <-suite.responseCh:
+		if resp.Err != nil {
+			return api.ResponseDataQuotas{}, resp.Err
+		}
+	case <-time.After(2 * time.Second):
+		return api.ResponseDataQuotas{}, fmt.Errorf("Listener response should come within the timeout")
+	}
+	return resp.Data.(api.ResponseDataQuotas), nil
+}
+
+func (suite *TestJobManagerSuite) quotas() (api.ResponseDataQuotas, error) {
+	return suite.quotaCommand(command{commandType: Quotas})
+}
+
+func (suite *TestJobManagerSuite) setQuota(requestor api.EventRequestor, quota *api.Quota) (api.ResponseDataQuotas, error) {
+	return suite.quotaCommand(command{commandType: SetQuota, requestor: requestor, quota: quota})
+}
+
+func (suite *TestJobManagerSuite) logLevelCommand(cmd command) (api.ResponseDataLogLevels, error) {
+	var resp api.Response
+	suite.commandCh <- cmd
+	select {
+	case resp = <-suite.responseCh:
+		if resp.Err != nil {
+			return api.ResponseDataLogLevels{}, resp.Err
+		}
+	case <-time.After(2 * time.Second):
+		return api.ResponseDataLogLevels{}, fmt.Errorf("Listener response should come within the timeout")
+	}
+	return resp.Data.(api.ResponseDataLogLevels), nil
+}
+
+func (suite *TestJobManagerSuite) logLevels() (api.ResponseDataLogLevels, error) {
+	return suite.logLevelCommand(command{commandType: LogLevels})
+}
+
+func (suite *TestJobManagerSuite) setLogLevel(module, level string) (api.ResponseDataLogLevels, error) {
+	return suite.logLevelCommand(command{commandType: SetLogLevel, module: module, level: level})
+}
+
+func (suite *TestJobManagerSuite) auditLog(search api.AuditSearch) ([]api.AuditRecord, error) {
+	var resp api.Response
+	suite.commandCh <- command{commandType: AuditLog, auditSearch: search}
+	select {
+	case resp = <-suite.responseCh:
+		if resp.Err != nil {
+			return nil, resp.Err
+		}
+	case <-time.After(2 * time.Second):
+		return nil, fmt.Errorf("Listener response should come within the timeout")
+	}
+	return resp.Data.(api.ResponseDataAuditLog).Records, nil
+}
+
+func (suite *TestJobManagerSuite) readiness() (api.ResponseDataReadiness, error) {
+	var resp api.Response
+	suite.commandCh <- command{commandType: Readiness}
+	select {
+	case resp = <-suite.responseCh:
+		if resp.Err != nil {
+			return api.ResponseDataReadiness{}, resp.Err
+		}
+	case <-time.After(2 * time.Second):
+		return api.ResponseDataReadiness{}, fmt.Errorf("Listener response should come within the timeout")
+	}
+	return resp.Data.(api.ResponseDataReadiness), nil
+}
+
+func (suite *TestJobManagerSuite) scheduleCommand(cmd command) (api.Schedule, error) {
+	var resp api.Response
+	suite.commandCh <- cmd
+	select {
+	case resp = <-suite.responseCh:
+		if resp.Err != nil {
+			return api.Schedule{}, resp.Err
+		}
+	case <-time.After(2 * time.Second):
+		return api.Schedule{}, fmt.Errorf("Listener response should come within the timeout")
+	}
+	return resp.Data.(api.ResponseDataSchedule).Schedule, nil
+}
+
+func (suite *TestJobManagerSuite) createSchedule(cron, jobDescriptor string) (api.Schedule, error) {
+	return suite.scheduleCommand(command{commandType: CreateSchedule, cron: cron, jobDescriptor: jobDescriptor})
+}
+
+func (suite *TestJobManagerSuite) pauseSchedule(scheduleID types.ScheduleID) (api.Schedule, error) {
+	return suite.scheduleCommand(command{commandType: PauseSchedule, scheduleID: scheduleID})
+}
+
+func (suite *TestJobManagerSuite) saveTemplate(template string) (api.JobTemplate, error) {
+	var resp api.Response
+	suite.commandCh <- command{commandType: SaveTemplate, template: template}
+	select {
+	case resp = <-suite.responseCh:
+		if resp.Err != nil {
+			return api.JobTemplate{}, resp.Err
+		}
+	case <-time.After(2 * time.Second):
+		return api.JobTemplate{}, fmt.Errorf("Listener response should come within the timeout")
+	}
+	return resp.Data.(api.ResponseDataTemplate).Template, nil
+}
+
+func (suite *TestJobManagerSuite) startTemplate(name string, values map[string]string) (types.JobID, error) {
+	var resp api.Response
+	suite.commandCh <- command{commandType: StartTemplate, template: name, values: values}
+	select {
+	case resp = <-suite.responseCh:
+		if resp.Err != nil {
+			return types.JobID(0), resp.Err
+		}
+	case <-time.After(2 * time.Second):
+		return types.JobID(0), fmt.Errorf("Listener response should come within the timeout")
+	}
+	return resp.Data.(api.ResponseDataStart).JobID, nil
+}
+
+func (suite *TestJobManagerSuite) listJobs(search api.JobSearch) ([]types.JobID, error) {
+	var resp api.Response
+	suite.commandCh <- command{commandType: ListJobs, search: search}
+	select {
+	case resp = <-suite.responseCh:
+		if resp.Err != nil {
+			return nil, resp.Err
+		}
+	case <-time.After(2 * time.Second):
+		return nil, fmt.Errorf("Listener response should come within the timeout")
+	}
+	return resp.Data.(api.ResponseDataList).JobIDs, nil
+}
+
+func (suite *TestJobManagerSuite) reports(search api.JobSearch) ([]*job.JobReport, error) {
+	var resp api.Response
+	suite.commandCh <- command{commandType: Reports, search: search}
+	select {
+	case resp = <-suite.responseCh:
+		if resp.Err != nil {
+			return nil, resp.Err
+		}
+	case <-time.After(2 * time.Second):
+		return nil, fmt.Errorf("Listener response should come within the timeout")
+	}
+	return resp.Data.(api.ResponseDataReports).Reports, nil
+}
+
+func (suite *TestJobManagerSuite) history(search api.HistorySearch) (api.ResponseDataHistory, error) {
+	var resp api.Response
+	suite.commandCh <- command{commandType: History, historySearch: search}
+	select {
+	case resp = <-suite.responseCh:
+		if resp.Err != nil {
+			return api.ResponseDataHistory{}, resp.Err
+		}
+	case <-time.After(2 * time.Second):
+		return api.ResponseDataHistory{}, fmt.Errorf("Listener response should come within the timeout")
+	}
+	return resp.Data.(api.ResponseDataHistory), nil
+}
+
+// storeInterruptedJob stores a job left in the given state by a previous run
+// of the server.
+func (suite *TestJobManagerSuite) storeInterruptedJob(jobDescriptor string, state event.Name) types.JobID {
+	serverID, err := os.Hostname()
+	require.NoError(suite.T(), err)
+	return suite.storeServerJob(serverID, jobDescriptor, state)
+}
+
+// storeServerJob stores a job of the given server, in the given state.
+func (suite *TestJobManagerSuite) storeServerJob(serverID, jobDescriptor string, state event.Name) types.JobID {
+	jobID, err := suite.jobStorageManager.StoreJobRequest(&job.Request{
+		JobName:       "interrupted",
+		Requestor:     "IntegrationTest",
+		ServerID:      serverID,
+		RequestTime:   time.Now(),
+		JobDescriptor: jobDescriptor,
+	})
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), suite.eventManager.Emit(frameworkevent.Event{JobID: jobID, EventName: state, EmitTime: time.Now()}))
+	return jobID
+}
+
+func (suite *TestJobManagerSuite) SetupTest() {
+
+	jobStorageManager := storage.NewJobStorageManager()
+	eventManager := storage.NewFrameworkEventEmitterFetcher()
+
+	suite.jobStorageManager = jobStorageManager
+	suite.eventManager = eventManager
+
+	commandCh := make(chan command)
+	suite.commandCh = commandCh
+	responseCh := make(chan api.Response)
+	suite.responseCh = responseCh
+	errorCh := make(chan error)
+	suite.errorCh = errorCh
+	jobManagerCh := make(chan struct{})
+	suite.jobManagerCh = jobManagerCh
+
+	testListener := TestListener{commandCh: commandCh, responseCh: responseCh, errorCh: errorCh}
+
+	logging.Disable()
+
+	pluginRegistry := pluginregistry.NewPluginRegistry()
+	pluginRegistry.RegisterTargetManager(targetlist.Name, targetlist.New)
+	pluginRegistry.RegisterTestFetcher(literal.Name, literal.New)
+	pluginRegistry.RegisterReporter(targetsuccess.Name, targetsuccess.New)
+	pluginRegistry.RegisterTestStep(noop.Name, noop.New, noop.Events)
+	pluginRegistry.RegisterTestStep(fail.Name, fail.New, fail.Events)
+	pluginRegistry.RegisterTestStep(crash.Name, crash.New, crash.Events)
+	pluginRegistry.RegisterTestStep(noreturn.Name, noreturn.New, noreturn.Events)
+	pluginRegistry.RegisterTestStep(slowecho.Name, slowecho.New, slowecho.Events)
+
+	suite.testListener = &testListener
+	suite.pluginRegistry = pluginRegistry
+	suite.newJobManager()
+	sigs := make(chan os.Signal)
+	suite.sigs = sigs
+
+	suite.txStorage = common.InitStorage(suite.storage)
+	storage.SetStorage(suite.txStorage)
+}
+
+// newJobManager replaces the JobManager of the test, e.g. to set options.
+func (suite *TestJobManagerSuite) newJobManager(opts ...jobmanager.Opt) {
+	jm, err := jobmanager.New(suite.testListener, nil, suite.pluginRegistry, opts...)
+	require.NoError(suite.T(), err)
+	suite.jm = jm
+}
+
+func (suite *TestJobManagerSuite) TearDownTest() {
+
+	// Signal cancellation to the JobManager, which in turn will
+	// propagate cancellation signal to Serve method of the listener.
+	// JobManager.Start() will return and close jobManagerCh.
+	select {
+	case suite.sigs <- syscall.SIGINT:
+	case <-time.After(1 * time.Second):
+		// Some tests do cancel the JobManager, so if is not respondive to SIGINT, it
+		// might not be an issue. Regardless of where the cancellation signal originated,
+		// JobManager.Start() should return and close jobManagerCh.
+	}
+
+	select {
+	case <-suite.jobManagerCh:
+	case <-time.After(2 * time.Second):
+		suite.T().Errorf("JobManager should return within the timeout")
+	}
+	common.FinalizeStorage(suite.txStorage)
+	storage.SetStorage(suite.storage)
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerJobStartSingle() {
+
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	jobID, err := suite.startJob(jobDescriptorNoop)
+	require.NoError(suite.T(), err)
+
+	_, err = suite.jobStorageManager.GetJobRequest(types.JobID(jobID))
+	require.NoError(suite.T(), err)
+
+	r, err := suite.jobStorageManager.GetJobRequest(types.JobID(jobID + 1))
+	require.Error(suite.T(), err)
+	require.NotEqual(suite.T(), nil, r)
+
+	// JobManager will emit an EventJobStarted when the Job is started
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobStarted, types.JobID(jobID))
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+
+	// JobManager will emit an EventJobCompleted when the Job completes
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, types.JobID(jobID))
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerJobReport() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	jobID, err := suite.startJob(jobDescriptorNoop)
+	require.NoError(suite.T(), err)
+
+	// JobManager will emit an EventJobCompleted when the Job completes
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, types.JobID(jobID))
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+
+	// A Report must be persisted for the Job
+	jobReport, err := suite.jobStorageManager.GetJobReport(types.JobID(jobID))
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(jobReport.RunReports))
+	require.Equal(suite.T(), 0, len(jobReport.FinalReports))
+
+	// Any other Job should not have a Job report, but fetching the
+	// report should not error out
+	jobReport, err = suite.jobStorageManager.GetJobReport(types.JobID(2))
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), &job.JobReport{JobID: 2}, jobReport)
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerJobCancellation() {
+
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	jobID, err := suite.startJob(jobDescriptorSlowecho)
+	require.NoError(suite.T(), err)
+
+	// Wait EventJobStarted event. This is necessary so that we can later issue a
+	// Stop command for a Job that we know is already running.
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobStarted, types.JobID(jobID))
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+
+	// Send Stop command to the job
+	err = suite.stopJob(jobID)
+	require.NoError(suite.T(), err)
+
+	// JobManager will emit an EventJobCancelling as soon as the cancellation signal
+	// is asserted
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCancelling, types.JobID(jobID))
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+
+	// JobManager will emit an EventJobCancelled event when the Job has completed
+	// cancellation successfully (completing cancellation successfully means that
+	// the TestRunner returns within the timeout and that TargetManage.Release()
+	// all targets)
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCancelled, types.JobID(jobID))
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerListJobs() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	jobID, err := suite.startJob(jobDescriptorNoop)
+	require.NoError(suite.T(), err)
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, types.JobID(jobID))
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+
+	for _, tc := range []struct {
+		search  api.JobSearch
+		matches bool
+	}{
+		{api.JobSearch{}, true},
+		{api.JobSearch{JobRequestor: "IntegrationTest"}, true},
+		{api.JobSearch{JobRequestor: "someone else"}, false},
+		{api.JobSearch{States: []string{string(jobmanager.EventJobCompleted)}}, true},
+		{api.JobSearch{States: []string{string(jobmanager.EventJobFailed)}}, false},
+		{api.JobSearch{Tags: []string{"integration_testing"}}, true},
+		{api.JobSearch{Tags: []string{"integration_testing", "other"}}, false},
+		{api.JobSearch{NameContains: "test"}, true},
+		{api.JobSearch{NameContains: "other"}, false},
+		{api.JobSearch{RequestedAfter: time.Now()}, false},
+		{api.JobSearch{RequestedBefore: time.Now()}, true},
+	} {
+		jobIDs, err := suite.listJobs(tc.search)
+		require.NoError(suite.T(), err)
+		if tc.matches {
+			require.Equal(suite.T(), []types.JobID{jobID}, jobIDs, "%+v", tc.search)
+		} else {
+			require.Empty(suite.T(), jobIDs, "%+v", tc.search)
+		}
+	}
+
+	_, err = suite.listJobs(api.JobSearch{States: []string{"NoSuchState"}})
+	require.Error(suite.T(), err)
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerTags() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	_, err := suite.startJob(withTags(jobDescriptorNoop, ""))
+	require.Error(suite.T(), err)
+
+	// the jobs run one after the other, as they use the same targets
+	var jobIDs []types.JobID
+	for _, tags := range [][]string{{"release-1", "x86"}, {"release-1", "arm"}} {
+		jobID, err := suite.startJob(withTags(jobDescriptorNoop, tags...))
+		require.NoError(suite.T(), err)
+		ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+		require.NoError(suite.T(), err)
+		require.Equal(suite.T(), 1, len(ev))
+		jobIDs = append(jobIDs, jobID)
+	}
+	firstJobID, secondJobID := jobIDs[0], jobIDs[1]
+
+	jobIDs, err = suite.listJobs(api.JobSearch{Tags: []string{"release-1"}})
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), []types.JobID{secondJobID, firstJobID}, jobIDs)
+	jobIDs, err = suite.listJobs(api.JobSearch{Tags: []string{"release-1", "x86"}})
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), []types.JobID{firstJobID}, jobIDs)
+
+	reports, err := suite.reports(api.JobSearch{Tags: []string{"arm"}})
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(reports))
+	require.Equal(suite.T(), secondJobID, reports[0].JobID)
+	require.NotEmpty(suite.T(), reports[0].RunReports)
+	reports, err = suite.reports(api.JobSearch{Tags: []string{"release-2"}})
+	require.NoError(suite.T(), err)
+	require.Empty(suite.T(), reports)
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerStartBatch() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	// no job is started from an invalid atomic batch
+	resp, err := suite.startBatch([]string{jobDescriptorNoop, jobDescriptorNullTest}, true)
+	require.NoError(suite.T(), err)
+	require.Error(suite.T(), resp.Err)
+	jobs := resp.Data.(api.ResponseDataStartBatch).Jobs
+	require.Equal(suite.T(), 2, len(jobs))
+	for _, j := range jobs {
+		require.Zero(suite.T(), j.JobID)
+		require.NotEmpty(suite.T(), j.Error)
+	}
+	jobIDs, err := suite.listJobs(api.JobSearch{})
+	require.NoError(suite.T(), err)
+	require.Empty(suite.T(), jobIDs)
+
+	// the valid jobs of a batch are started otherwise
+	resp, err = suite.startBatch([]string{jobDescriptorNoop, jobDescriptorNullTest, jobDescriptorNoop}, false)
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), resp.Err)
+	jobs = resp.Data.(api.ResponseDataStartBatch).Jobs
+	require.Equal(suite.T(), 3, len(jobs))
+	require.NotZero(suite.T(), jobs[0].JobID)
+	require.Empty(suite.T(), jobs[0].Error)
+	require.Zero(suite.T(), jobs[1].JobID)
+	require.NotEmpty(suite.T(), jobs[1].Error)
+	require.NotZero(suite.T(), jobs[2].JobID)
+	for _, j := range []api.BatchJob{jobs[0], jobs[2]} {
+		ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobStarted, j.JobID)
+		require.NoError(suite.T(), err)
+		require.Equal(suite.T(), 1, len(ev))
+	}
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerValidate() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	validation, err := suite.validate(jobDescriptorNoop)
+	require.NoError(suite.T(), err)
+	require.True(suite.T(), validation.Valid)
+	require.Equal(suite.T(), 1, len(validation.Tests))
+	require.NotEmpty(suite.T(), validation.Tests[0].Steps)
+
+	validation, err = suite.validate(jobDescriptorNullStep)
+	require.NoError(suite.T(), err)
+	require.False(suite.T(), validation.Valid)
+	var errs []api.Diagnostic
+	for _, d := range validation.Diagnostics {
+		if d.Severity == api.SeverityError {
+			errs = append(errs, d)
+		}
+	}
+	require.Equal(suite.T(), 1, len(errs))
+	require.True(suite.T(), strings.HasPrefix(errs[0].Path, "TestDescriptors[0]"))
+
+	// nothing is started by a validation
+	jobIDs, err := suite.listJobs(api.JobSearch{})
+	require.NoError(suite.T(), err)
+	require.Empty(suite.T(), jobIDs)
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerDrain() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	jobID, err := suite.startJob(jobDescriptorNoop)
+	require.NoError(suite.T(), err)
+	_, err = suite.drain(0)
+	require.NoError(suite.T(), err)
+	_, err = suite.startJob(jobDescriptorNoop)
+	require.True(suite.T(), errors.Is(err, api.ErrDraining))
+
+	// the job manager exits once the running job completed
+	select {
+	case <-suite.jobManagerCh:
+	case <-time.After(5 * time.Second):
+		suite.T().Fatalf("JobManager should exit once drained")
+	}
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerDrainDeadline() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	jobID, err := suite.startJob(jobDescriptorSlowecho)
+	require.NoError(suite.T(), err)
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobStarted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+
+	drain, err := suite.drain(100 * time.Millisecond)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, drain.RunningJobs)
+	require.False(suite.T(), drain.Deadline.IsZero())
+
+	// the job still running after the deadline is paused
+	select {
+	case <-suite.jobManagerCh:
+	case <-time.After(5 * time.Second):
+		suite.T().Fatalf("JobManager should exit once drained")
+	}
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobPaused, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerPriority() {
+	suite.newJobManager(jobmanager.MaxConcurrentJobs(1))
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	slowJobID, err := suite.startJob(jobDescriptorSlowecho)
+	require.NoError(suite.T(), err)
+	lowJobID, err := suite.startJob(withPriority(jobDescriptorNoop, 1))
+	require.NoError(suite.T(), err)
+	highJobID, err := suite.startJob(withPriority(jobDescriptorNoop, 10))
+	require.NoError(suite.T(), err)
+
+	// the jobs started while the slow one runs wait in the queue
+	for _, jobID := range []types.JobID{lowJobID, highJobID} {
+		ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobQueued, jobID)
+		require.NoError(suite.T(), err)
+		require.Equal(suite.T(), 1, len(ev))
+	}
+	require.NoError(suite.T(), suite.stopJob(slowJobID))
+
+	// the job with the highest priority runs first
+	var completed []time.Time
+	for _, jobID := range []types.JobID{highJobID, lowJobID} {
+		ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+		require.NoError(suite.T(), err)
+		require.Equal(suite.T(), 1, len(ev))
+		completed = append(completed, ev[0].EmitTime)
+	}
+	require.True(suite.T(), completed[0].Before(completed[1]))
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerRequestorConcurrency() {
+	suite.newJobManager(jobmanager.MaxConcurrentJobsPerRequestor(0, map[api.EventRequestor]int{"IntegrationTest": 1}))
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	slowJobID, err := suite.startJob(jobDescriptorSlowecho)
+	require.NoError(suite.T(), err)
+	jobID, err := suite.startJob(jobDescriptorNoop)
+	require.NoError(suite.T(), err)
+
+	// the job waits until the other job of its requestor ends
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobQueued, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	require.NoError(suite.T(), suite.stopJob(slowJobID))
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerLogLevels() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	moduleLevel := func(levels api.ResponseDataLogLevels, module string) api.ModuleLogLevel {
+		for _, l := range levels.Modules {
+			if l.Module == module {
+				return l
+			}
+		}
+		suite.T().Fatalf("module %s not found", module)
+		return api.ModuleLogLevel{}
+	}
+	_, err := suite.setLogLevel("pkg/unknown", "debug")
+	require.Error(suite.T(), err)
+	_, err = suite.setLogLevel("pkg/runner", "verbose")
+	require.Error(suite.T(), err)
+	levels, err := suite.setLogLevel("pkg/runner", "warning")
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), api.ModuleLogLevel{Module: "pkg/runner", Level: "warning", Override: true}, moduleLevel(levels, "pkg/runner"))
+	_, err = suite.setLogLevel("pkg/runner", "")
+	require.NoError(suite.T(), err)
+	levels, err = suite.logLevels()
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), api.ModuleLogLevel{Module: "pkg/runner", Level: levels.Default}, moduleLevel(levels, "pkg/runner"))
+}
+
+// pollForDependencyEvent polls for the events recording that a dependency
+// went down or up, which are not related to any job.
+func pollForDependencyEvent(eventManager frameworkevent.EmitterFetcher, ev event.Name) ([]frameworkevent.Event, error) {
+	for pollAttempt := 0; pollAttempt < 50; pollAttempt++ {
+		events, err := eventManager.Fetch(frameworkevent.QueryEventName(ev))
+		if err != nil || len(events) != 0 {
+			return events, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil, nil
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerHealthChecks() {
+	var down int32
+	inventory := jobmanager.Dependency{
+		Name: "inventory",
+		Check: func(ctx context.Context) error {
+			if atomic.LoadInt32(&down) != 0 {
+				return errors.New("inventory unreachable")
+			}
+			return nil
+		},
+	}
+	suite.newJobManager(jobmanager.HealthChecks(100*time.Millisecond, inventory))
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	readiness, err := suite.readiness()
+	require.NoError(suite.T(), err)
+	require.True(suite.T(), readiness.Ready)
+	// storage, locker, inventory, plugins and drain
+	require.Equal(suite.T(), 5, len(readiness.Checks))
+	require.Equal(suite.T(), "inventory", readiness.Checks[2].Name)
+	require.Contains(suite.T(), readiness.Checks[2].Detail, "up since")
+
+	atomic.StoreInt32(&down, 1)
+	ev, err := pollForDependencyEvent(suite.eventManager, jobmanager.EventDependencyDown)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	require.Contains(suite.T(), string(*ev[0].Payload), "inventory unreachable")
+	readiness, err = suite.readiness()
+	require.NoError(suite.T(), err)
+	require.False(suite.T(), readiness.Ready)
+	require.Equal(suite.T(), "inventory unreachable", readiness.Checks[2].Error)
+	require.Empty(suite.T(), readiness.Checks[0].Error)
+
+	atomic.StoreInt32(&down, 0)
+	ev, err = pollForDependencyEvent(suite.eventManager, jobmanager.EventDependencyUp)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	readiness, err = suite.readiness()
+	require.NoError(suite.T(), err)
+	require.True(suite.T(), readiness.Ready)
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerRequestID() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	request := func(cmd command) api.Response {
+		suite.commandCh <- cmd
+		select {
+		case resp := <-suite.responseCh:
+			require.NoError(suite.T(), resp.Err)
+			return resp
+		case <-time.After(2 * time.Second):
+			require.FailNow(suite.T(), "Listener response should come within the timeout")
+		}
+		return api.Response{}
+	}
+	resp := request(command{commandType: StartJob, jobDescriptor: jobDescriptorSlowecho, requestID: "start-request"})
+	require.Equal(suite.T(), "start-request", resp.RequestID)
+	jobID := resp.Data.(api.ResponseDataStart).JobID
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobStarted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	require.Equal(suite.T(), "start-request", ev[0].RequestID)
+
+	resp = request(command{commandType: StopJob, jobID: jobID, requestID: "stop-request"})
+	require.Equal(suite.T(), "stop-request", resp.RequestID)
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCancelling, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	require.Equal(suite.T(), "stop-request", ev[0].RequestID)
+	// the job ends in the background, not while handling the request
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCancelled, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	require.Empty(suite.T(), ev[0].RequestID)
+
+	records, err := suite.auditLog(api.AuditSearch{})
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 2, len(records))
+	require.Equal(suite.T(), "start-request", records[0].RequestID)
+	require.Equal(suite.T(), "stop-request", records[1].RequestID)
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerAuditLog() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	jobID, err := suite.startJob(jobDescriptorSlowecho)
+	require.NoError(suite.T(), err)
+	_, err = pollForEvent(suite.eventManager, jobmanager.EventJobStarted, jobID)
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), suite.stopJob(jobID))
+	_, err = pollForEvent(suite.eventManager, jobmanager.EventJobCancelled, jobID)
+	require.NoError(suite.T(), err)
+	require.Error(suite.T(), suite.stopJob(jobID+1))
+	// reading the jobs is not recorded
+	_, err = suite.listJobs(api.JobSearch{})
+	require.NoError(suite.T(), err)
+
+	records, err := suite.auditLog(api.AuditSearch{})
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 3, len(records))
+	for _, r := range records {
+		require.Equal(suite.T(), api.EventRequestor("IntegrationTest"), r.Requestor)
+		require.Len(suite.T(), r.PayloadHash, 64)
+	}
+	require.Equal(suite.T(), "start", records[0].Action)
+	require.Equal(suite.T(), jobID, records[0].JobID)
+	require.Empty(suite.T(), records[0].Error)
+	require.Equal(suite.T(), "stop", records[1].Action)
+	require.Empty(suite.T(), records[1].Error)
+	require.Equal(suite.T(), "stop", records[2].Action)
+	require.NotEmpty(suite.T(), records[2].Error)
+	require.NotEqual(suite.T(), records[1].PayloadHash, records[2].PayloadHash)
+
+	records, err = suite.auditLog(api.AuditSearch{Action: "stop", JobID: jobID})
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(records))
+	records, err = suite.auditLog(api.AuditSearch{AuditRequestor: "someone else"})
+	require.NoError(suite.T(), err)
+	require.Empty(suite.T(), records)
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerQuotas() {
+	suite.newJobManager(jobmanager.Quotas(api.Quota{}, map[api.EventRequestor]api.Quota{"IntegrationTest": {MaxTargets: 1}}))
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	// the job fails, as it locks more targets than its requestor may
+	jobID, err := suite.startJob(jobDescriptorNoop)
+	require.NoError(suite.T(), err)
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobFailed, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	require.Contains(suite.T(), string(*ev[0].Payload), api.ErrQuotaExceeded.Error())
+
+	_, err = suite.setQuota("IntegrationTest", &api.Quota{MaxTargets: -1})
+	require.Error(suite.T(), err)
+	quotas, err := suite.setQuota("IntegrationTest", &api.Quota{MaxTargets: 2})
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(quotas.Requestors))
+	require.True(suite.T(), quotas.Requestors[0].Override)
+	require.Equal(suite.T(), 2, quotas.Requestors[0].MaxTargets)
+	jobID, err = suite.startJob(jobDescriptorNoop)
+	require.NoError(suite.T(), err)
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	quotas, err = suite.quotas()
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 0, quotas.Requestors[0].LockedTargets)
+	require.True(suite.T(), quotas.Requestors[0].RuntimeToday > 0)
+
+	// jobs are rejected once their requestor ran for its daily runtime
+	_, err = suite.setQuota("", &api.Quota{MaxRuntimePerDay: time.Nanosecond})
+	require.NoError(suite.T(), err)
+	_, err = suite.setQuota("IntegrationTest", nil)
+	require.NoError(suite.T(), err)
+	_, err = suite.startJob(jobDescriptorNoop)
+	require.True(suite.T(), errors.Is(err, api.ErrLimitExceeded))
+	quotas, err = suite.setQuota("", &api.Quota{})
+	require.NoError(suite.T(), err)
+	require.False(suite.T(), quotas.Requestors[0].Override)
+	jobID, err = suite.startJob(jobDescriptorNoop)
+	require.NoError(suite.T(), err)
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerStopQueued() {
+	suite.newJobManager(jobmanager.MaxConcurrentJobs(1))
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	_, err := suite.startJob(jobDescriptorSlowecho)
+	require.NoError(suite.T(), err)
+	jobID, err := suite.startJob(jobDescriptorNoop)
+	require.NoError(suite.T(), err)
+
+	// a queued job is cancelled without being started
+	require.NoError(suite.T(), suite.stopJob(jobID))
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCancelled, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	ev, err = suite.eventManager.Fetch(
+		frameworkevent.QueryJobID(jobID),
+		frameworkevent.QueryEventName(jobmanager.EventJobStarted),
+	)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 0, len(ev))
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerDependencies() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	_, err := suite.startJob(withDependencies(jobDescriptorNoop, 1000000))
+	require.Error(suite.T(), err)
+
+	slowJobID, err := suite.startJob(jobDescriptorSlowecho)
+	require.NoError(suite.T(), err)
+	jobID, err := suite.startJob(withDependencies(jobDescriptorNoop, slowJobID))
+	require.NoError(suite.T(), err)
+
+	// the job starts once the job it depends on completed
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobWaiting, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	completed, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, slowJobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(completed))
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobStarted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	require.False(suite.T(), ev[0].EmitTime.Before(completed[0].EmitTime))
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerDependencyCancelled() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	slowJobID, err := suite.startJob(jobDescriptorSlowecho)
+	require.NoError(suite.T(), err)
+	jobID, err := suite.startJob(withDependencies(jobDescriptorNoop, slowJobID))
+	require.NoError(suite.T(), err)
+	transitiveJobID, err := suite.startJob(withDependencies(jobDescriptorNoop, jobID))
+	require.NoError(suite.T(), err)
+
+	// the jobs depending directly or not on a cancelled job fail
+	require.NoError(suite.T(), suite.stopJob(slowJobID))
+	for _, id := range []types.JobID{jobID, transitiveJobID} {
+		ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobFailed, id)
+		require.NoError(suite.T(), err)
+		require.Equal(suite.T(), 1, len(ev))
+		ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobStarted, id)
+		require.NoError(suite.T(), err)
+		require.Equal(suite.T(), 0, len(ev))
+	}
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerSchedule() {
+	defer func(interval time.Duration) {
+		jobmanager.ScheduleCheckInterval = interval
+	}(jobmanager.ScheduleCheckInterval)
+	jobmanager.ScheduleCheckInterval = 100 * time.Millisecond
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	_, err := suite.createSchedule("every minute", jobDescriptorNoop)
+	require.Error(suite.T(), err)
+	schedule, err := suite.createSchedule("* * * * *", jobDescriptorNoop)
+	require.NoError(suite.T(), err)
+	require.False(suite.T(), schedule.NextRunTime.IsZero())
+
+	// a schedule which missed an activation is due at once
+	scheduleManager := storage.NewScheduleManager()
+	s, err := scheduleManager.GetSchedule(schedule.ID)
+	require.NoError(suite.T(), err)
+	s.LastRunTime = time.Now().Add(-2 * time.Minute)
+	require.NoError(suite.T(), scheduleManager.UpdateSchedule(s))
+
+	var jobIDs []types.JobID
+	for attempt := 0; attempt < 50 && len(jobIDs) == 0; attempt++ {
+		time.Sleep(100 * time.Millisecond)
+		jobIDs, err = suite.listJobs(api.JobSearch{ScheduleID: schedule.ID})
+		require.NoError(suite.T(), err)
+	}
+	require.NotEmpty(suite.T(), jobIDs)
+
+	schedule, err = suite.pauseSchedule(schedule.ID)
+	require.NoError(suite.T(), err)
+	require.True(suite.T(), schedule.Paused)
+	require.True(suite.T(), schedule.NextRunTime.IsZero())
+	require.Equal(suite.T(), jobIDs[0], schedule.LastJobID)
+	require.Empty(suite.T(), schedule.LastError)
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerDescriptorLibrary() {
+	dir, err := ioutil.TempDir("", "contest-library")
+	require.NoError(suite.T(), err)
+	defer os.RemoveAll(dir)
+	fragment := "RunReporters:\n  - Name: TargetSuccess\n    Parameters:\n      SuccessExpression: \">0%\"\n"
+	require.NoError(suite.T(), ioutil.WriteFile(dir+"/reporting.yaml", []byte(fragment), 0644))
+	suite.newJobManager(jobmanager.DescriptorLibrary(job.NewLibrary(dir)))
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	// the job descriptor is stored with the fragments it includes
+	jobID, err := suite.startJob(withReportingInclude(jobDescriptorNoop, "reporting"))
+	require.NoError(suite.T(), err)
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	req, err := suite.jobStorageManager.GetJobRequest(jobID)
+	require.NoError(suite.T(), err)
+	require.NotContains(suite.T(), req.JobDescriptor, job.IncludeKey)
+	require.Contains(suite.T(), req.JobDescriptor, "TargetSuccess")
+
+	_, err = suite.startJob(withReportingInclude(jobDescriptorNoop, "missing"))
+	require.Error(suite.T(), err)
+}
+
+// spanRecorder records the spans of the jobs.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(span tracing.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+// byName returns the recorded spans by name.
+func (r *spanRecorder) byName() map[string][]tracing.SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	spans := make(map[string][]tracing.SpanData)
+	for _, s := range r.spans {
+		spans[s.Name] = append(spans[s.Name], s)
+	}
+	return spans
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerPluginMetrics() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	jobID, err := suite.startJob(jobDescriptorNoop)
+	require.NoError(suite.T(), err)
+	_, err = pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+	require.NoError(suite.T(), err)
+
+	var buf bytes.Buffer
+	require.NoError(suite.T(), metrics.WritePrometheus(&buf))
+	for _, series := range []string{
+		`contest_jobmanager_fetch_seconds_count{fetcher="literal"}`,
+		`contest_runner_acquire_seconds_count{target_manager="targetlist"}`,
+		`contest_runner_release_seconds_count{target_manager="targetlist"}`,
+		`contest_runner_lock_seconds_count{locker="InMemory"}`,
+		`contest_runner_locks_total{locker="InMemory"}`,
+		`contest_runner_step_seconds_count{step="Noop"}`,
+	} {
+		require.Contains(suite.T(), buf.String(), series)
+	}
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerTracing() {
+	recorder := &spanRecorder{}
+	tracing.SetExporter(recorder)
+	defer tracing.SetExporter(nil)
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	jobID, err := suite.startJob(jobDescriptorNoop)
+	require.NoError(suite.T(), err)
+	_, err = pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+	require.NoError(suite.T(), err)
+
+	// job -> test -> step and target operations -> event writes
+	spans := recorder.byName()
+	require.Len(suite.T(), spans["job"], 1)
+	jobSpan := spans["job"][0]
+	require.False(suite.T(), jobSpan.ParentSpanID.IsValid())
+	require.Contains(suite.T(), jobSpan.Attributes, tracing.Attr("job.id", jobID))
+	require.Len(suite.T(), spans["test"], 1)
+	testSpan := spans["test"][0]
+	require.Equal(suite.T(), jobSpan.SpanID, testSpan.ParentSpanID)
+	for _, name := range []string{"acquire targets", "lock targets", "release targets", "unlock targets", "step"} {
+		require.NotEmpty(suite.T(), spans[name], name)
+		for _, s := range spans[name] {
+			require.Equal(suite.T(), jobSpan.TraceID, s.TraceID, name)
+			require.Equal(suite.T(), testSpan.SpanID, s.ParentSpanID, name)
+		}
+	}
+	require.Contains(suite.T(), spans["step"][0].Attributes, tracing.Attr("step.plugin", "Noop"))
+	stepSpans := map[tracing.SpanID]bool{}
+	for _, s := range spans["step"] {
+		stepSpans[s.SpanID] = true
+	}
+	var stepEvents int
+	for _, s := range spans["store test event"] {
+		if stepSpans[s.ParentSpanID] {
+			stepEvents++
+		}
+	}
+	require.NotZero(suite.T(), stepEvents)
+	require.NotEmpty(suite.T(), spans["store framework event"])
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerTemplate() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	_, err := suite.saveTemplate(newTemplate("flash", withJobName(jobDescriptorNoop, "flash ${board}")))
+	require.Error(suite.T(), err)
+	template, err := suite.saveTemplate(newTemplate("flash", withJobName(jobDescriptorNoop, "flash ${platform}"), "platform"))
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), "flash", template.Name)
+	require.Equal(suite.T(), api.EventRequestor("IntegrationTest"), template.Requestor)
+
+	// variables without default values must be given a value
+	_, err = suite.startTemplate("flash", nil)
+	require.Error(suite.T(), err)
+	jobID, err := suite.startTemplate("flash", map[string]string{"platform": "arm64"})
+	require.NoError(suite.T(), err)
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	request, err := suite.jobStorageManager.GetJobRequest(jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), "flash arm64", request.JobName)
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerHistory() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	_, err := suite.history(api.HistorySearch{})
+	require.Error(suite.T(), err)
+	_, err = suite.history(api.HistorySearch{JobName: "nightly", Template: "nightly"})
+	require.Error(suite.T(), err)
+
+	// the jobs run one after the other, as they use the same targets
+	var jobIDs []types.JobID
+	for _, jobDescriptor := range []string{jobDescriptorNoop, jobDescriptorFailure} {
+		jobID, err := suite.startJob(withJobName(jobDescriptor, "nightly"))
+		require.NoError(suite.T(), err)
+		ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+		require.NoError(suite.T(), err)
+		require.Equal(suite.T(), 1, len(ev))
+		jobIDs = append(jobIDs, jobID)
+	}
+	_, err = suite.saveTemplate(newTemplate("nightly", withJobName(jobDescriptorNoop, "nightly ${platform}"), "platform"))
+	require.NoError(suite.T(), err)
+	templateJobID, err := suite.startTemplate("nightly", map[string]string{"platform": "arm64"})
+	require.NoError(suite.T(), err)
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, templateJobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+
+	// the jobs named after the template are not the ones named nightly
+	history, err := suite.history(api.HistorySearch{JobName: "nightly"})
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 2, len(history.Jobs))
+	failed, passed := history.Jobs[0], history.Jobs[1]
+	require.Equal(suite.T(), jobIDs[1], failed.JobID)
+	require.Equal(suite.T(), uint(2), failed.Failed)
+	require.Equal(suite.T(), float64(0), failed.PassRate)
+	require.Equal(suite.T(), jobIDs[0], passed.JobID)
+	require.Equal(suite.T(), uint(2), passed.Passed)
+	require.Equal(suite.T(), float64(100), passed.PassRate)
+	require.Equal(suite.T(), string(jobmanager.EventJobCompleted), passed.State)
+
+	require.Equal(suite.T(), 2, len(history.Tests))
+	require.Equal(suite.T(), "IntegrationTest: fail", history.Tests[0].TestName)
+	require.Equal(suite.T(), uint(2), history.Tests[0].Failed)
+	require.Equal(suite.T(), 1, len(history.Tests[0].Steps))
+	require.Equal(suite.T(), "fail_label", history.Tests[0].Steps[0].TestStepLabel)
+	require.Equal(suite.T(), uint(2), history.Tests[0].Steps[0].Failed)
+	require.Equal(suite.T(), "IntegrationTest: noop", history.Tests[1].TestName)
+	require.Equal(suite.T(), float64(100), history.Tests[1].PassRate)
+	require.Equal(suite.T(), 1, len(history.Tests[1].Steps))
+	require.Equal(suite.T(), "noop_label", history.Tests[1].Steps[0].TestStepLabel)
+
+	history, err = suite.history(api.HistorySearch{JobName: "nightly", Limit: 1})
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(history.Jobs))
+	require.Equal(suite.T(), jobIDs[1], history.Jobs[0].JobID)
+
+	history, err = suite.history(api.HistorySearch{Template: "nightly"})
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(history.Jobs))
+	require.Equal(suite.T(), templateJobID, history.Jobs[0].JobID)
+	require.Equal(suite.T(), "nightly arm64", history.Jobs[0].JobName)
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerPauseJob() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	jobID, err := suite.startJob(jobDescriptorSlowecho)
+	require.NoError(suite.T(), err)
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobStarted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+
+	// only running jobs can be paused, and only paused jobs can be resumed
+	_, err = suite.resumeJob(jobID)
+	require.Error(suite.T(), err)
+	data, err := suite.pauseJob(jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), string(jobmanager.EventJobPausing), data.State)
+	_, err = suite.pauseJob(jobID)
+	require.Error(suite.T(), err)
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobPaused, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+
+	data, err = suite.resumeJob(jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), string(jobmanager.EventJobStarted), data.State)
+	ev, err = suite.eventManager.Fetch(
+		frameworkevent.QueryJobID(jobID),
+		frameworkevent.QueryEventName(jobmanager.EventJobStarted),
+	)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 2, len(ev))
+
+	// the resumed job can be paused again, and a paused job can be stopped
+	_, err = suite.pauseJob(jobID)
+	require.NoError(suite.T(), err)
+	require.Eventually(suite.T(), func() bool {
+		ev, err := suite.eventManager.Fetch(
+			frameworkevent.QueryJobID(jobID),
+			frameworkevent.QueryEventName(jobmanager.EventJobPaused),
+		)
+		return err == nil && len(ev) == 2
+	}, 5*time.Second, 100*time.Millisecond)
+	require.NoError(suite.T(), suite.stopJob(jobID))
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCancelled, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerApproval() {
+	policy, err := jobmanager.NewApprovalPolicy([]string{"production"}, nil, "")
+	require.NoError(suite.T(), err)
+	suite.newJobManager(jobmanager.RequireApproval(policy))
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
 
-	testListener := TestListener{commandCh: commandCh, responseCh: responseCh, errorCh: errorCh}
+	// jobs not matching the policy start right away
+	jobID, err := suite.startJob(jobDescriptorNoop)
+	require.NoError(suite.T(), err)
+	_, err = suite.approveJob(jobID)
+	require.Error(suite.T(), err)
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
 
-	logging.Disable()
+	jobID, err = suite.startJob(withTags(jobDescriptorNoop, "production"))
+	require.NoError(suite.T(), err)
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobAwaitingApproval, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobApprovalRequested, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	require.Equal(suite.T(), "{\"Reason\":\"job has tag production\"}", string(*ev[0].Payload))
+	data, err := suite.approveJob(jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), string(jobmanager.EventJobStarted), data.State)
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobApproved, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	require.Equal(suite.T(), "{\"Requestor\":\"IntegrationTest\"}", string(*ev[0].Payload))
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
 
-	pluginRegistry := pluginregistry.NewPluginRegistry()
-	pluginRegistry.RegisterTargetManager(targetlist.Name, targetlist.New)
-	pluginRegistry.RegisterTestFetcher(literal.Name, literal.New)
-	pluginRegistry.RegisterReporter(targetsuccess.Name, targetsuccess.New)
-	pluginRegistry.RegisterTestStep(noop.Name, noop.New, noop.Events)
-	pluginRegistry.RegisterTestStep(fail.Name, fail.New, fail.Events)
-	pluginRegistry.RegisterTestStep(crash.Name, crash.New, crash.Events)
-	pluginRegistry.RegisterTestStep(noreturn.Name, noreturn.New, noreturn.Events)
-	pluginRegistry.RegisterTestStep(slowecho.Name, slowecho.New, slowecho.Events)
+	// rejected jobs are cancelled without running
+	jobID, err = suite.startJob(withTags(jobDescriptorNoop, "production"))
+	require.NoError(suite.T(), err)
+	data, err = suite.rejectJob(jobID, "maintenance window")
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), string(jobmanager.EventJobCancelled), data.State)
+	_, err = suite.approveJob(jobID)
+	require.Error(suite.T(), err)
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobRejected, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	require.Equal(suite.T(), "{\"Requestor\":\"IntegrationTest\",\"Reason\":\"maintenance window\"}", string(*ev[0].Payload))
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCancelled, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	ev, err = suite.eventManager.Fetch(
+		frameworkevent.QueryJobID(jobID),
+		frameworkevent.QueryEventName(jobmanager.EventJobStarted),
+	)
+	require.NoError(suite.T(), err)
+	require.Empty(suite.T(), ev)
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerStartAt() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
 
-	jm, err := jobmanager.New(&testListener, nil, pluginRegistry)
+	jobID, err := suite.startJob(withStartAt(jobDescriptorNoop, time.Now().Add(3*time.Second)))
+	require.NoError(suite.T(), err)
+	ev, err := suite.eventManager.Fetch(
+		frameworkevent.QueryJobID(jobID),
+		frameworkevent.QueryEventNames(jobmanager.JobStateEvents),
+	)
 	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	require.Equal(suite.T(), jobmanager.EventJobScheduled, ev[0].EventName)
 
-	suite.jm = jm
-	sigs := make(chan os.Signal)
-	suite.sigs = sigs
+	// jobs waiting for their start time can be stopped
+	otherJobID, err := suite.startJob(withStartAt(jobDescriptorNoop, time.Now().Add(time.Hour)))
+	require.NoError(suite.T(), err)
+	require.NoError(suite.T(), suite.stopJob(otherJobID))
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCancelled, otherJobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
 
-	suite.txStorage = common.InitStorage(suite.storage)
-	storage.SetStorage(suite.txStorage)
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobStarted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
 }
 
-func (suite *TestJobManagerSuite) TearDownTest() {
+func (suite *TestJobManagerSuite) TestJobManagerPreemption() {
+	suite.newJobManager(jobmanager.PreemptJobs())
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
 
-	// Signal cancellation to the JobManager, which in turn will
-	// propagate cancellation signal to Serve method of the listener.
-	// JobManager.Start() will return and close jobManagerCh.
-	select {
-	case suite.sigs <- syscall.SIGINT:
-	case <-time.After(1 * time.Second):
-		// Some tests do cancel the JobManager, so if is not respondive to SIGINT, it
-		// might not be an issue. Regardless of where the cancellation signal originated,
-		// JobManager.Start() should return and close jobManagerCh.
+	jobID, err := suite.startJob(jobDescriptorSlowecho)
+	require.NoError(suite.T(), err)
+	targets := []*target.Target{
+		{ID: "id1", Name: "hostname1.example.com"},
+		{ID: "id2", Name: "hostname2.example.com"},
 	}
+	require.Eventually(suite.T(), func() bool {
+		owners, err := target.GetLocker().(target.TransferableLocker).LockOwners(targets)
+		return err == nil && owners["id1"] == jobID && owners["id2"] == jobID
+	}, 5*time.Second, 100*time.Millisecond)
 
-	select {
-	case <-suite.jobManagerCh:
-	case <-time.After(2 * time.Second):
-		suite.T().Errorf("JobManager should return within the timeout")
+	// jobs of the same priority are not preempted
+	otherJobID, err := suite.startJob(jobDescriptorNoop)
+	require.NoError(suite.T(), err)
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobFailed, otherJobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+
+	preemptingJobID, err := suite.startJob(withPriority(jobDescriptorNoop, 10))
+	require.NoError(suite.T(), err)
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobPreempted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	require.Equal(suite.T(), fmt.Sprintf("{\"PreemptedJobID\":%d,\"PreemptingJobID\":%d}", jobID, preemptingJobID), string(*ev[0].Payload))
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobLocksTransferred, preemptingJobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	require.Equal(suite.T(), fmt.Sprintf("{\"PreemptedJobID\":%d,\"PreemptingJobID\":%d,\"TargetIDs\":[\"id1\",\"id2\"]}", jobID, preemptingJobID), string(*ev[0].Payload))
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, preemptingJobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+
+	// the preempted job is resumed once the preempting job ended
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobPreemptionEnded, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	ev, err = suite.eventManager.Fetch(
+		frameworkevent.QueryJobID(jobID),
+		frameworkevent.QueryEventNames(jobmanager.JobStateEvents),
+	)
+	require.NoError(suite.T(), err)
+	var states []event.Name
+	for _, e := range ev {
+		states = append(states, e.EventName)
 	}
-	common.FinalizeStorage(suite.txStorage)
-	storage.SetStorage(suite.storage)
+	require.Equal(suite.T(), []event.Name{jobmanager.EventJobStarted, jobmanager.EventJobPausing, jobmanager.EventJobPaused, jobmanager.EventJobStarted}, states)
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
 }
 
-func (suite *TestJobManagerSuite) TestJobManagerJobStartSingle() {
-
+func (suite *TestJobManagerSuite) TestJobManagerUnlockTargets() {
 	go func() {
 		suite.jm.Start(suite.sigs)
 		close(suite.jobManagerCh)
 	}()
 
-	jobID, err := suite.startJob(jobDescriptorNoop)
+	// the locks of a job which the server does not run are released
+	crashedJobID := types.JobID(1000)
+	crashedTargets := []*target.Target{{ID: "crashed1"}, {ID: "crashed2"}}
+	require.NoError(suite.T(), target.GetLocker().Lock(crashedJobID, crashedTargets))
+	unlocked, err := suite.unlockTargets([]string{"crashed1", "crashed2", "unlocked"})
 	require.NoError(suite.T(), err)
-
-	_, err = suite.jobStorageManager.GetJobRequest(types.JobID(jobID))
+	require.Equal(suite.T(), map[string]types.JobID{"crashed1": crashedJobID, "crashed2": crashedJobID}, unlocked.Unlocked)
+	owners, err := target.GetLocker().(target.TransferableLocker).LockOwners(crashedTargets)
 	require.NoError(suite.T(), err)
+	require.Empty(suite.T(), owners)
 
-	r, err := suite.jobStorageManager.GetJobRequest(types.JobID(jobID + 1))
+	// the locks of the running jobs are not
+	jobID, err := suite.startJob(jobDescriptorSlowecho)
+	require.NoError(suite.T(), err)
+	targets := []*target.Target{{ID: "id1"}, {ID: "id2"}}
+	require.Eventually(suite.T(), func() bool {
+		owners, err := target.GetLocker().(target.TransferableLocker).LockOwners(targets)
+		return err == nil && owners["id1"] == jobID && owners["id2"] == jobID
+	}, 5*time.Second, 100*time.Millisecond)
+	_, err = suite.unlockTargets([]string{"id1"})
 	require.Error(suite.T(), err)
-	require.NotEqual(suite.T(), nil, r)
+	owners, err = target.GetLocker().(target.TransferableLocker).LockOwners(targets)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), jobID, owners["id1"])
+}
 
-	// JobManager will emit an EventJobStarted when the Job is started
-	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobStarted, types.JobID(jobID))
+func (suite *TestJobManagerSuite) TestJobManagerTimeout() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	jobID, err := suite.startJob(withTimeout(jobDescriptorSlowecho, 500*time.Millisecond))
+	require.NoError(suite.T(), err)
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobTimeout, jobID)
 	require.NoError(suite.T(), err)
 	require.Equal(suite.T(), 1, len(ev))
-
-	// JobManager will emit an EventJobCompleted when the Job completes
-	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, types.JobID(jobID))
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobFailed, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	// the targets were released, so that another job can lock them
+	jobID, err = suite.startJob(jobDescriptorNoop)
+	require.NoError(suite.T(), err)
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
 	require.NoError(suite.T(), err)
 	require.Equal(suite.T(), 1, len(ev))
-
 }
 
-func (suite *TestJobManagerSuite) TestJobManagerJobReport() {
+func (suite *TestJobManagerSuite) TestJobManagerRetry() {
 	go func() {
 		suite.jm.Start(suite.sigs)
 		close(suite.jobManagerCh)
 	}()
 
-	jobID, err := suite.startJob(jobDescriptorNoop)
+	jobID, err := suite.startJob(withRetry(jobDescriptorFailure, 1, true))
 	require.NoError(suite.T(), err)
-
-	// JobManager will emit an EventJobCompleted when the Job completes
-	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, types.JobID(jobID))
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
 	require.NoError(suite.T(), err)
 	require.Equal(suite.T(), 1, len(ev))
 
-	// A Report must be persisted for the Job
-	jobReport, err := suite.jobStorageManager.GetJobReport(types.JobID(jobID))
+	// all the targets failed, so the job is retried on all of them
+	retries, err := suite.listJobs(api.JobSearch{RetryOf: jobID})
 	require.NoError(suite.T(), err)
-	require.Equal(suite.T(), 1, len(jobReport.RunReports))
-	require.Equal(suite.T(), 0, len(jobReport.FinalReports))
+	require.Equal(suite.T(), 1, len(retries))
+	request, err := suite.jobStorageManager.GetJobRequest(retries[0])
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), jobID, request.RetryOf)
+	var jd job.JobDescriptor
+	require.NoError(suite.T(), json.Unmarshal([]byte(request.JobDescriptor), &jd))
+	require.ElementsMatch(suite.T(), []string{"id1", "id2"}, jd.TargetIDs)
 
-	// Any other Job should not have a Job report, but fetching the
-	// report should not error out
-	jobReport, err = suite.jobStorageManager.GetJobReport(types.JobID(2))
+	// the retry fails too, but the job is retried only once
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, retries[0])
 	require.NoError(suite.T(), err)
-	require.Equal(suite.T(), &job.JobReport{JobID: 2}, jobReport)
+	require.Equal(suite.T(), 1, len(ev))
+	retries, err = suite.listJobs(api.JobSearch{RetryOf: jobID})
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(retries))
 }
 
-func (suite *TestJobManagerSuite) TestJobManagerJobCancellation() {
+func (suite *TestJobManagerSuite) TestJobManagerRerun() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	jobID, err := suite.startJob(jobDescriptorFailure)
+	require.NoError(suite.T(), err)
+	// running jobs cannot be rerun
+	_, err = suite.rerunJob(jobID, false)
+	require.Error(suite.T(), err)
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+
+	rerunID, err := suite.rerunJob(jobID, true)
+	require.NoError(suite.T(), err)
+	request, err := suite.jobStorageManager.GetJobRequest(rerunID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), jobID, request.RerunOf)
+	require.Equal(suite.T(), types.JobID(0), request.RetryOf)
+	var jd job.JobDescriptor
+	require.NoError(suite.T(), json.Unmarshal([]byte(request.JobDescriptor), &jd))
+	require.ElementsMatch(suite.T(), []string{"id1", "id2"}, jd.TargetIDs)
+	reruns, err := suite.listJobs(api.JobSearch{RerunOf: jobID})
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), []types.JobID{rerunID}, reruns)
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, rerunID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+}
 
+func (suite *TestJobManagerSuite) TestJobManagerResumeInterrupted() {
+	jobID := suite.storeInterruptedJob(jobDescriptorNoop, jobmanager.EventJobStarted)
+	cancellingJobID := suite.storeInterruptedJob(jobDescriptorNoop, jobmanager.EventJobCancelling)
+	suite.newJobManager(jobmanager.InterruptedJobs(jobmanager.InterruptedJobsResume))
 	go func() {
 		suite.jm.Start(suite.sigs)
 		close(suite.jobManagerCh)
 	}()
 
-	jobID, err := suite.startJob(jobDescriptorSlowecho)
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	// the jobs which were being cancelled are not resumed
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCancelled, cancellingJobID)
 	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+}
 
-	// Wait EventJobStarted event. This is necessary so that we can later issue a
-	// Stop command for a Job that we know is already running.
-	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobStarted, types.JobID(jobID))
+func (suite *TestJobManagerSuite) TestJobManagerResumeLegacyDescriptor() {
+	// the job descriptors of earlier versions are migrated when resumed
+	jobID := suite.storeInterruptedJob(withoutReporting(jobDescriptorNoop), jobmanager.EventJobStarted)
+	suite.newJobManager(jobmanager.InterruptedJobs(jobmanager.InterruptedJobsResume))
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
 	require.NoError(suite.T(), err)
 	require.Equal(suite.T(), 1, len(ev))
+	report, err := suite.jobStorageManager.GetJobReport(jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(report.RunReports))
+	require.Equal(suite.T(), "TargetSuccess", report.RunReports[0][0].ReporterName)
+}
 
-	// Send Stop command to the job
-	err = suite.stopJob(jobID)
+func (suite *TestJobManagerSuite) TestJobManagerFailInterrupted() {
+	jobID := suite.storeInterruptedJob(jobDescriptorNoop, jobmanager.EventJobPaused)
+	suite.newJobManager(jobmanager.InterruptedJobs(jobmanager.InterruptedJobsFail))
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobFailed, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	ev, err = suite.eventManager.Fetch(
+		frameworkevent.QueryJobID(jobID),
+		frameworkevent.QueryEventName(jobmanager.EventJobStarted),
+	)
 	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 0, len(ev))
+}
 
-	// JobManager will emit an EventJobCancelling as soon as the cancellation signal
-	// is asserted
-	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCancelling, types.JobID(jobID))
+func (suite *TestJobManagerSuite) TestJobManagerCluster() {
+	cm := storage.NewClusterManager()
+	require.NoError(suite.T(), cm.Heartbeat("stopped-server", time.Now().Add(-time.Hour)))
+	jobID := suite.storeServerJob("stopped-server", jobDescriptorNoop, jobmanager.EventJobStarted)
+	completedJobID := suite.storeServerJob("stopped-server", jobDescriptorNoop, jobmanager.EventJobCompleted)
+	suite.newJobManager(jobmanager.Cluster(100*time.Millisecond, time.Second))
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	// the only live server leads the cluster, and takes over the unfinished
+	// jobs of the stopped servers
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobFailedOver, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	serverID, err := os.Hostname()
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), fmt.Sprintf(`{"FromServerID":"stopped-server","ToServerID":"%s"}`, serverID), string(*ev[0].Payload))
+	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
 	require.NoError(suite.T(), err)
 	require.Equal(suite.T(), 1, len(ev))
+	req, err := suite.jobStorageManager.GetJobRequest(jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), serverID, req.ServerID)
+	req, err = suite.jobStorageManager.GetJobRequest(completedJobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), "stopped-server", req.ServerID)
 
-	// JobManager will emit an EventJobCancelled event when the Job has completed
-	// cancellation successfully (completing cancellation successfully means that
-	// the TestRunner returns within the timeout and that TargetManage.Release()
-	// all targets)
-	ev, err = pollForEvent(suite.eventManager, jobmanager.EventJobCancelled, types.JobID(jobID))
+	// the stopped server is forgotten once its jobs were taken over
+	servers, err := cm.ListServers()
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(servers))
+	require.Equal(suite.T(), serverID, servers[0].ID)
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerClusterFencing() {
+	suite.newJobManager(jobmanager.Cluster(100*time.Millisecond, time.Second))
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	jobID, err := suite.startJob(jobDescriptorSlowecho)
+	require.NoError(suite.T(), err)
+	targets := []*target.Target{{ID: "id1"}, {ID: "id2"}}
+	require.Eventually(suite.T(), func() bool {
+		owners, err := target.GetLocker().(target.TransferableLocker).LockOwners(targets)
+		return err == nil && owners["id1"] == jobID
+	}, 5*time.Second, 100*time.Millisecond)
+
+	// a job claimed by another server stops running, and its state is left
+	// to its new owner
+	serverID, err := os.Hostname()
+	require.NoError(suite.T(), err)
+	claimed, err := storage.NewClusterManager().ClaimJob(jobID, serverID, "other-server")
+	require.NoError(suite.T(), err)
+	require.True(suite.T(), claimed)
+	require.Eventually(suite.T(), func() bool {
+		owners, err := target.GetLocker().(target.TransferableLocker).LockOwners(targets)
+		return err == nil && len(owners) == 0
+	}, 3*time.Second, 100*time.Millisecond)
+	ev, err := suite.eventManager.Fetch(
+		frameworkevent.QueryJobID(jobID),
+		frameworkevent.QueryEventNames(jobmanager.JobStateEvents),
+	)
 	require.NoError(suite.T(), err)
 	require.Equal(suite.T(), 1, len(ev))
+	require.Equal(suite.T(), jobmanager.EventJobStarted, ev[0].EventName)
 }
 
 func (suite *TestJobManagerSuite) TestJobManagerJobNotSuccessful() {
@@ -482,3 +2227,94 @@ func (suite *TestJobManagerSuite) TestTestNull() {
 	_, err := suite.startJob(jobDescriptorNullTest)
 	require.Error(suite.T(), err)
 }
+
+func (suite *TestJobManagerSuite) TestJobManagerParallelTests() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	start := time.Now()
+	jobID, err := suite.startJob(jobDescriptorParallelTests)
+	require.NoError(suite.T(), err)
+
+	// Both tests take 3 seconds, running them one after the other would
+	// exceed the polling time
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, types.JobID(jobID))
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+	require.True(suite.T(), time.Since(start) < 6*time.Second)
+
+	// The run report includes the targets of both tests
+	jobReport, err := suite.jobStorageManager.GetJobReport(types.JobID(jobID))
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(jobReport.RunReports))
+	require.Equal(suite.T(), 1, len(jobReport.RunReports[0]))
+	require.True(suite.T(), jobReport.RunReports[0][0].Success)
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerWebhooksDisabled() {
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	// jobs setting webhooks are rejected unless webhooks are enabled
+	_, err := suite.startJob(withWebhooks(jobDescriptorNoop, "https://ci.example.com/hooks"))
+	require.Error(suite.T(), err)
+	_, err = jobmanager.NewJob(suite.pluginRegistry, withWebhooks(jobDescriptorNoop, "ftp://ci.example.com/hooks"))
+	require.Error(suite.T(), err)
+}
+
+func (suite *TestJobManagerSuite) TestJobManagerWebhooks() {
+	secret := []byte("secret")
+	type call struct {
+		path    string
+		payload webhook.Payload
+	}
+	calls := make(chan call, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil || !webhook.Verify(secret, body, r.Header.Get(webhook.SignatureHeader)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var p webhook.Payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		calls <- call{path: r.URL.Path, payload: p}
+	}))
+	defer srv.Close()
+	sender, err := webhook.NewSender(webhook.Config{Secret: secret})
+	require.NoError(suite.T(), err)
+
+	suite.newJobManager(jobmanager.Webhooks(sender, []string{srv.URL + "/server"}))
+	go func() {
+		suite.jm.Start(suite.sigs)
+		close(suite.jobManagerCh)
+	}()
+
+	jobID, err := suite.startJob(withWebhooks(jobDescriptorNoop, srv.URL+"/job"))
+	require.NoError(suite.T(), err)
+	ev, err := pollForEvent(suite.eventManager, jobmanager.EventJobCompleted, jobID)
+	require.NoError(suite.T(), err)
+	require.Equal(suite.T(), 1, len(ev))
+
+	// both webhooks are called for every state change, possibly out of order
+	states := make(map[string][]string)
+	for len(states["/server"]) < 2 || len(states["/job"]) < 2 {
+		select {
+		case c := <-calls:
+			require.Equal(suite.T(), jobID, c.payload.JobID)
+			require.Equal(suite.T(), "IntegrationTest", c.payload.Requestor)
+			states[c.path] = append(states[c.path], c.payload.State)
+		case <-time.After(5 * time.Second):
+			suite.T().Fatalf("webhooks not called within the timeout, got %v", states)
+		}
+	}
+	for _, path := range []string{"/server", "/job"} {
+		require.ElementsMatch(suite.T(), []string{string(jobmanager.EventJobStarted), string(jobmanager.EventJobCompleted)}, states[path])
+	}
+}
@@ -9,7 +9,12 @@ package test
 
 import (
 	"bytes"
+	"encoding/json"
 	"text/template"
+	"time"
+
+	"github.com/facebookincubator/contest/pkg/job"
+	"github.com/facebookincubator/contest/pkg/types"
 )
 
 var jobDescriptorTemplate = template.Must(template.New("jobDescriptor").Parse(`
@@ -191,3 +196,237 @@ var jobDescriptorNullTest = `
     }
 }
 `
+
+// jobDescriptorParallelTests defines two tests which take 3 seconds each, and
+// which are allowed to run at the same time.
+var jobDescriptorParallelTests = `
+{
+    "JobName": "test job",
+    "Runs": 1,
+    "MaxParallelTests": 2,
+    "Tags": [
+        "integration_testing"
+    ],
+    "TestDescriptors": [
+        {
+            "TargetManagerName": "TargetList",
+            "TargetManagerAcquireParameters": {
+                "Targets": [
+                    {
+                        "ID": "id1",
+                        "Name": "hostname1.example.com"
+                    }
+                ]
+            },
+            "TargetManagerReleaseParameters": {},
+            "TestFetcherName": "literal",
+            "TestFetcherFetchParameters": {
+                "Steps": [
+                    {
+                        "name": "slowecho",
+                        "label": "slowecho_label",
+                        "parameters": {
+                            "sleep": ["3"],
+                            "text": ["Hello world"]
+                        }
+                    }
+                ],
+                "TestName": "IntegrationTest: parallel one"
+            }
+        },
+        {
+            "TargetManagerName": "TargetList",
+            "TargetManagerAcquireParameters": {
+                "Targets": [
+                    {
+                        "ID": "id2",
+                        "Name": "hostname2.example.com"
+                    }
+                ]
+            },
+            "TargetManagerReleaseParameters": {},
+            "TestFetcherName": "literal",
+            "TestFetcherFetchParameters": {
+                "Steps": [
+                    {
+                        "name": "slowecho",
+                        "label": "slowecho_label",
+                        "parameters": {
+                            "sleep": ["3"],
+                            "text": ["Hello world"]
+                        }
+                    }
+                ],
+                "TestName": "IntegrationTest: parallel two"
+            }
+        }
+    ],
+    "Reporting": {
+        "RunReporters": [
+            {
+                "Name": "TargetSuccess",
+                "Parameters": {
+                    "SuccessExpression": ">0%"
+                }
+            }
+        ]
+    }
+}
+`
+
+// withPriority sets the priority of a job descriptor.
+func withPriority(jobDescriptor string, priority int) string {
+	var jd map[string]interface{}
+	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil {
+		panic(err)
+	}
+	jd["Priority"] = priority
+	data, err := json.Marshal(jd)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// withTimeout sets the timeout of a job descriptor.
+func withTimeout(jobDescriptor string, timeout time.Duration) string {
+	var jd map[string]interface{}
+	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil {
+		panic(err)
+	}
+	jd["Timeout"] = timeout.String()
+	data, err := json.Marshal(jd)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// withRetry sets the retry policy of a job descriptor.
+func withRetry(jobDescriptor string, maxRetries uint, failedTargetsOnly bool) string {
+	var jd map[string]interface{}
+	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil {
+		panic(err)
+	}
+	jd["Retry"] = job.RetryPolicy{MaxRetries: maxRetries, FailedTargetsOnly: failedTargetsOnly}
+	data, err := json.Marshal(jd)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// withDependencies sets the jobs which a job descriptor depends on.
+func withDependencies(jobDescriptor string, jobIDs ...types.JobID) string {
+	var jd map[string]interface{}
+	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil {
+		panic(err)
+	}
+	jd["DependsOn"] = jobIDs
+	data, err := json.Marshal(jd)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// withJobName sets the name of a job descriptor.
+func withJobName(jobDescriptor string, name string) string {
+	var jd map[string]interface{}
+	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil {
+		panic(err)
+	}
+	jd["JobName"] = name
+	data, err := json.Marshal(jd)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// withTags sets the tags of a job descriptor.
+func withTags(jobDescriptor string, tags ...string) string {
+	var jd map[string]interface{}
+	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil {
+		panic(err)
+	}
+	jd["Tags"] = tags
+	data, err := json.Marshal(jd)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// withStartAt sets the start time of a job descriptor.
+func withStartAt(jobDescriptor string, startAt time.Time) string {
+	var jd map[string]interface{}
+	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil {
+		panic(err)
+	}
+	jd["StartAt"] = startAt
+	data, err := json.Marshal(jd)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// withWebhooks sets the webhooks of a job descriptor.
+func withWebhooks(jobDescriptor string, urls ...string) string {
+	var jd map[string]interface{}
+	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil {
+		panic(err)
+	}
+	jd["Webhooks"] = urls
+	data, err := json.Marshal(jd)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// withoutReporting removes the reporting of a job descriptor, leaving the run
+// reporter set by ReporterName, as in the job descriptors of version 0.
+func withoutReporting(jobDescriptor string) string {
+	var jd map[string]interface{}
+	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil {
+		panic(err)
+	}
+	delete(jd, "Reporting")
+	delete(jd, "Version")
+	data, err := json.Marshal(jd)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// withReportingInclude replaces the reporting of a job descriptor with a
+// fragment of the job descriptor library.
+func withReportingInclude(jobDescriptor string, fragment string) string {
+	var jd map[string]interface{}
+	if err := json.Unmarshal([]byte(jobDescriptor), &jd); err != nil {
+		panic(err)
+	}
+	jd["Reporting"] = map[string]interface{}{job.IncludeKey: fragment}
+	data, err := json.Marshal(jd)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// newTemplate returns a job template declaring the given variables, without
+// default values.
+func newTemplate(name, jobDescriptor string, variables ...string) string {
+	template := job.Template{Name: name, JobDescriptor: json.RawMessage(jobDescriptor)}
+	for _, v := range variables {
+		template.Variables = append(template.Variables, job.TemplateVariable{Name: v})
+	}
+	data, err := json.Marshal(template)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
@@ -8,6 +8,7 @@
 package tests
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"testing"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/facebookincubator/contest/pkg/cerrors"
 	"github.com/facebookincubator/contest/pkg/event"
+	"github.com/facebookincubator/contest/pkg/event/testevent"
 	"github.com/facebookincubator/contest/pkg/logging"
 	"github.com/facebookincubator/contest/pkg/pluginregistry"
 	"github.com/facebookincubator/contest/pkg/runner"
@@ -27,6 +29,7 @@ import (
 	"github.com/facebookincubator/contest/plugins/teststeps/cmd"
 	"github.com/facebookincubator/contest/plugins/teststeps/echo"
 	"github.com/facebookincubator/contest/plugins/teststeps/example"
+	"github.com/facebookincubator/contest/plugins/teststeps/slowecho"
 	"github.com/facebookincubator/contest/tests/plugins/teststeps/channels"
 	"github.com/facebookincubator/contest/tests/plugins/teststeps/crash"
 	"github.com/facebookincubator/contest/tests/plugins/teststeps/fail"
@@ -53,6 +56,7 @@ var testSteps = map[string]test.TestStepFactory{
 	cmd.Name:       cmd.New,
 	crash.Name:     crash.New,
 	fail.Name:      fail.New,
+	slowecho.Name:  slowecho.New,
 }
 
 var testStepsEvents = map[string][]event.Name{
@@ -65,6 +69,7 @@ var testStepsEvents = map[string][]event.Name{
 	cmd.Name:       cmd.Events,
 	crash.Name:     crash.Events,
 	fail.Name:      fail.Events,
+	slowecho.Name:  slowecho.Events,
 }
 
 func TestMain(m *testing.M) {
@@ -279,6 +284,283 @@ func TestNoReturnStepWithoutTargetForwarding(t *testing.T) {
 	}
 }
 
+func TestHangingStepWithTimeout(t *testing.T) {
+
+	jobID := types.JobID(1)
+	runID := types.RunID(1)
+
+	ts1, err := pluginRegistry.NewTestStep("Hanging")
+	require.NoError(t, err)
+	ts2, err := pluginRegistry.NewTestStep("Example")
+	require.NoError(t, err)
+
+	params := make(test.TestStepParameters)
+	testSteps := []test.TestStepBundle{
+		test.TestStepBundle{TestStep: ts1, TestStepLabel: "StageOne", Parameters: params, Timeout: 500 * time.Millisecond},
+		test.TestStepBundle{TestStep: ts2, TestStepLabel: "StageTwo", Parameters: params},
+	}
+
+	cancel := make(chan struct{})
+	pause := make(chan struct{})
+
+	errCh := make(chan error)
+	go func() {
+		tr := runner.NewTestRunner()
+		err := tr.Run(cancel, pause, &test.Test{TestStepsBundles: testSteps}, targets, jobID, runID)
+		errCh <- err
+	}()
+
+	// the hanging step is abandoned after its timeout, and all targets are
+	// marked as failed, so the test completes without errors
+	select {
+	case err = <-errCh:
+		require.NoError(t, err)
+	case <-time.After(successTimeout):
+		assert.FailNow(t, "TestRunner should return after the step timeout")
+	}
+}
+
+func TestTargetTimeout(t *testing.T) {
+
+	jobID := types.JobID(1)
+	runID := types.RunID(1)
+
+	ts1, err := pluginRegistry.NewTestStep("Example")
+	require.NoError(t, err)
+	ts2, err := pluginRegistry.NewTestStep("SlowEcho")
+	require.NoError(t, err)
+	ts3, err := pluginRegistry.NewTestStep("Example")
+	require.NoError(t, err)
+
+	params := make(test.TestStepParameters)
+	slowParams := test.TestStepParameters{
+		"text":  []test.Param{*test.NewParam("hello")},
+		"sleep": []test.Param{*test.NewParam("9")},
+	}
+	testSteps := []test.TestStepBundle{
+		test.TestStepBundle{TestStep: ts1, TestStepLabel: "StageOne", Parameters: params},
+		test.TestStepBundle{TestStep: ts2, TestStepLabel: "StageTwo", Parameters: slowParams},
+		test.TestStepBundle{TestStep: ts3, TestStepLabel: "StageThree", Parameters: params},
+	}
+
+	cancel := make(chan struct{})
+	pause := make(chan struct{})
+
+	timeouts := runner.TestRunnerTimeouts{
+		StepInjectTimeout:   30 * time.Second,
+		MessageTimeout:      5 * time.Second,
+		ShutdownTimeout:     1 * time.Second,
+		StepShutdownTimeout: 1 * time.Second,
+		TargetTimeout:       500 * time.Millisecond,
+	}
+	errCh := make(chan error)
+	go func() {
+		tr := runner.NewTestRunnerWithTimeouts(timeouts)
+		err := tr.Run(cancel, pause, &test.Test{TestStepsBundles: testSteps}, targets, jobID, runID)
+		errCh <- err
+	}()
+
+	// all targets are failed in the slow step once they exceed their timeout,
+	// and the slow step is cancelled
+	select {
+	case err = <-errCh:
+		require.NoError(t, err)
+	case <-time.After(successTimeout):
+		assert.FailNow(t, "TestRunner should return after the target timeout")
+	}
+}
+
+func TestIgnoreFailure(t *testing.T) {
+
+	jobID := types.JobID(322)
+	runID := types.RunID(1)
+
+	ts1, err := pluginRegistry.NewTestStep("Fail")
+	require.NoError(t, err)
+	ts2, err := pluginRegistry.NewTestStep("Example")
+	require.NoError(t, err)
+
+	params := make(test.TestStepParameters)
+	testSteps := []test.TestStepBundle{
+		test.TestStepBundle{TestStep: ts1, TestStepLabel: "StageOne", Parameters: params, IgnoreFailure: true},
+		test.TestStepBundle{TestStep: ts2, TestStepLabel: "StageTwo", Parameters: params},
+	}
+
+	cancel := make(chan struct{})
+	pause := make(chan struct{})
+
+	errCh := make(chan error)
+	go func() {
+		tr := runner.NewTestRunner()
+		err := tr.Run(cancel, pause, &test.Test{TestStepsBundles: testSteps}, targets, jobID, runID)
+		errCh <- err
+	}()
+	select {
+	case err = <-errCh:
+		require.NoError(t, err)
+	case <-time.After(successTimeout):
+		assert.FailNow(t, "TestRunner should return within timeout")
+	}
+
+	// all targets failed the first step, but reached the second one anyway
+	fetcher := storage.NewTestEventFetcher()
+	ignored, err := fetcher.Fetch(testevent.QueryJobID(jobID), testevent.QueryTestStepLabel("StageOne"), testevent.QueryEventName(target.EventTargetErrIgnored))
+	require.NoError(t, err)
+	require.Len(t, ignored, len(targets))
+	in, err := fetcher.Fetch(testevent.QueryJobID(jobID), testevent.QueryTestStepLabel("StageTwo"), testevent.QueryEventName(target.EventTargetIn))
+	require.NoError(t, err)
+	require.Len(t, in, len(targets))
+}
+
+func TestCleanupSteps(t *testing.T) {
+
+	jobID := types.JobID(325)
+	runID := types.RunID(1)
+
+	ts1, err := pluginRegistry.NewTestStep("Fail")
+	require.NoError(t, err)
+	ts2, err := pluginRegistry.NewTestStep("Example")
+	require.NoError(t, err)
+
+	params := make(test.TestStepParameters)
+	testSteps := []test.TestStepBundle{
+		test.TestStepBundle{TestStep: ts1, TestStepLabel: "StageOne", Parameters: params},
+	}
+	cleanupSteps := []test.TestStepBundle{
+		test.TestStepBundle{TestStep: ts2, TestStepLabel: "Cleanup", Parameters: params},
+	}
+
+	cancel := make(chan struct{})
+	pause := make(chan struct{})
+
+	errCh := make(chan error)
+	go func() {
+		tr := runner.NewTestRunner()
+		err := tr.Run(cancel, pause, &test.Test{TestStepsBundles: testSteps, CleanupStepsBundles: cleanupSteps}, targets, jobID, runID)
+		errCh <- err
+	}()
+	select {
+	case err = <-errCh:
+		require.NoError(t, err)
+	case <-time.After(successTimeout):
+		assert.FailNow(t, "TestRunner should return within timeout")
+	}
+
+	// all targets failed the test step, but went through the cleanup step
+	fetcher := storage.NewTestEventFetcher()
+	in, err := fetcher.Fetch(testevent.QueryJobID(jobID), testevent.QueryTestStepLabel("Cleanup"), testevent.QueryEventName(target.EventTargetIn))
+	require.NoError(t, err)
+	require.Len(t, in, len(targets))
+}
+
+func TestHangingCleanupStepCancelled(t *testing.T) {
+
+	jobID := types.JobID(326)
+	runID := types.RunID(1)
+
+	ts1, err := pluginRegistry.NewTestStep("Example")
+	require.NoError(t, err)
+	ts2, err := pluginRegistry.NewTestStep("Hanging")
+	require.NoError(t, err)
+
+	params := make(test.TestStepParameters)
+	testSteps := []test.TestStepBundle{
+		test.TestStepBundle{TestStep: ts1, TestStepLabel: "StageOne", Parameters: params},
+	}
+	cleanupSteps := []test.TestStepBundle{
+		test.TestStepBundle{TestStep: ts2, TestStepLabel: "Cleanup", Parameters: params},
+	}
+
+	cancel := make(chan struct{})
+	pause := make(chan struct{})
+
+	timeouts := runner.TestRunnerTimeouts{
+		StepInjectTimeout:   30 * time.Second,
+		MessageTimeout:      5 * time.Second,
+		ShutdownTimeout:     1 * time.Second,
+		StepShutdownTimeout: 1 * time.Second,
+		CleanupTimeout:      1 * time.Second,
+	}
+
+	errCh := make(chan error)
+	go func() {
+		tr := runner.NewTestRunnerWithTimeouts(timeouts)
+		err := tr.Run(cancel, pause, &test.Test{TestStepsBundles: testSteps, CleanupStepsBundles: cleanupSteps}, targets, jobID, runID)
+		errCh <- err
+	}()
+
+	// the cleanup step hangs until the test is cancelled, and it is then
+	// cancelled after the cleanup timeout
+	select {
+	case err = <-errCh:
+		assert.FailNow(t, "TestRunner should not return, received an error instead: %v", err)
+	case <-time.After(2 * time.Second):
+		close(cancel)
+		select {
+		case err = <-errCh:
+			require.Error(t, err)
+		case <-time.After(timeouts.CleanupTimeout + timeouts.ShutdownTimeout + 2*time.Second):
+			assert.FailNow(t, "TestRunner should return after cancellation before timeout")
+		}
+	}
+}
+
+func TestTargetResults(t *testing.T) {
+
+	jobID := types.JobID(328)
+
+	ts1, err := pluginRegistry.NewTestStep("Echo")
+	require.NoError(t, err)
+	ts2, err := pluginRegistry.NewTestStep("Fail")
+	require.NoError(t, err)
+
+	params := test.TestStepParameters{"text": []test.Param{*test.NewParam("hello")}}
+	runs := []struct {
+		bundle test.TestStepBundle
+		result target.Result
+	}{
+		{
+			bundle: test.TestStepBundle{TestStep: ts1, TestStepLabel: "StageOne", Parameters: params},
+			result: target.Result{Outcome: target.OutcomePass},
+		},
+		{
+			bundle: test.TestStepBundle{TestStep: ts2, TestStepLabel: "StageOne", Parameters: params},
+			result: target.Result{Outcome: target.OutcomeFail, Step: "StageOne"},
+		},
+	}
+
+	fetcher := storage.NewTestEventFetcher()
+	for idx, run := range runs {
+		runID := types.RunID(idx + 1)
+		cancel := make(chan struct{})
+		pause := make(chan struct{})
+
+		errCh := make(chan error)
+		go func() {
+			tr := runner.NewTestRunner()
+			errCh <- tr.Run(cancel, pause, &test.Test{Name: "TestTargetResults", TestStepsBundles: []test.TestStepBundle{run.bundle}}, targets, jobID, runID)
+		}()
+		select {
+		case err = <-errCh:
+			require.NoError(t, err)
+		case <-time.After(successTimeout):
+			assert.FailNow(t, "TestRunner should return within timeout")
+		}
+
+		// exactly one result is recorded for each target
+		ev, err := fetcher.Fetch(testevent.QueryJobID(jobID), testevent.QueryRunID(runID), testevent.QueryEventName(target.EventTargetResult))
+		require.NoError(t, err)
+		require.Len(t, ev, len(targets))
+		for _, e := range ev {
+			require.Equal(t, "", e.Header.TestStepLabel)
+			var result target.Result
+			require.NoError(t, json.Unmarshal(*e.Data.Payload, &result))
+			require.Equal(t, run.result.Outcome, result.Outcome)
+			require.Equal(t, run.result.Step, result.Step)
+		}
+	}
+}
+
 func TestStepClosesChannels(t *testing.T) {
 
 	jobID := types.JobID(1)
@@ -197,3 +197,24 @@ func TestLockingTransactional(t *testing.T) {
 	// this means it can be locked by the first owner
 	assert.NoError(t, tl.Lock(jobID, []*target.Target{&targetOne}))
 }
+
+func TestLockOwners(t *testing.T) {
+	tl.ResetAllLocks()
+	owners, err := tl.LockOwners(twoTargets)
+	assert.NoError(t, err)
+	assert.Empty(t, owners)
+	assert.NoError(t, tl.Lock(jobID, oneTarget))
+	assert.NoError(t, tl.Lock(jobID+1, []*target.Target{&targetTwo}))
+	owners, err = tl.LockOwners(twoTargets)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]types.JobID{targetOne.ID: jobID, targetTwo.ID: jobID + 1}, owners)
+}
+
+func TestTransferLocks(t *testing.T) {
+	tl.ResetAllLocks()
+	assert.NoError(t, tl.Lock(jobID, oneTarget))
+	assert.Error(t, tl.Lock(jobID+1, twoTargets))
+	assert.NoError(t, tl.TransferLocks(jobID, jobID+1, twoTargets))
+	assert.NoError(t, tl.Lock(jobID+1, twoTargets))
+	assert.Error(t, tl.Lock(jobID, oneTarget))
+}
@@ -6,6 +6,7 @@
 package fail
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/facebookincubator/contest/pkg/cerrors"
@@ -29,7 +30,7 @@ func (ts *fail) Name() string {
 }
 
 // Run executes a step which does never return.
-func (ts *fail) Run(cancel, pause <-chan struct{}, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
+func (ts *fail) Run(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.Emitter) error {
 	for {
 		select {
 		case target := <-ch.In:
@@ -37,9 +38,7 @@ func (ts *fail) Run(cancel, pause <-chan struct{}, ch test.TestStepChannels, par
 				return nil
 			}
 			ch.Err <- cerrors.TargetError{Target: target, Err: fmt.Errorf("Integration test failure for %v", target)}
-		case <-cancel:
-			return nil
-		case <-pause:
+		case <-ctx.Done():
 			return nil
 		}
 	}
@@ -52,7 +51,7 @@ func (ts *fail) ValidateParameters(params test.TestStepParameters) error {
 
 // Resume tries to resume a previously interrupted test step. ExampleTestStep
 // cannot resume.
-func (ts *fail) Resume(cancel, pause <-chan struct{}, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.EmitterFetcher) error {
+func (ts *fail) Resume(ctx context.Context, ch test.TestStepChannels, params test.TestStepParameters, ev testevent.EmitterFetcher) error {
 	return &cerrors.ErrResumeNotSupported{StepName: Name}
 }
 